@@ -86,6 +86,13 @@ func analyzeMessage(data []byte) {
 		fmt.Printf("    PeerFlags:  0x%02x (AddPath=%v)\n", m.PeerFlags, m.HasAddPath)
 		fmt.Printf("    TableName:  %q\n", m.TableName)
 
+		for _, st := range m.Stats {
+			fmt.Printf("    Stat:       %s afi=%d safi=%d value=%d\n", st.Name(), st.AFI, st.SAFI, st.Value)
+		}
+		if m.MsgType == bmp.MsgTypeTermination {
+			fmt.Printf("    Reason:     %d (%s) info=%q\n", m.TermReason, bmp.TermReasonName(m.TermReason), m.TermInfo)
+		}
+
 		if m.BGPData != nil {
 			fmt.Printf("    BGPData:    %d bytes\n", len(m.BGPData))
 			if len(m.BGPData) >= 19 {
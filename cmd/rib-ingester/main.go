@@ -19,10 +19,11 @@ import (
 	"github.com/route-beacon/rib-ingester/internal/history"
 	ribhttp "github.com/route-beacon/rib-ingester/internal/http"
 	"github.com/route-beacon/rib-ingester/internal/kafka"
+	"github.com/route-beacon/rib-ingester/internal/listener"
 	"github.com/route-beacon/rib-ingester/internal/maintenance"
 	"github.com/route-beacon/rib-ingester/internal/metrics"
+	"github.com/route-beacon/rib-ingester/internal/source"
 	"github.com/route-beacon/rib-ingester/internal/state"
-	"github.com/twmb/franz-go/pkg/kgo"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -154,83 +155,123 @@ func runServe() {
 	defer pool.Close()
 
 	// Ensure partitions exist on startup.
-	pm := maintenance.NewPartitionManager(pool, cfg.Retention.Days, cfg.Retention.Timezone, logger)
+	pm := maintenance.NewPartitionManager(pool, cfg.Retention.Days, cfg.Retention.Timezone, cfg.Retention.TimeAxis, logger)
 	if err := pm.CreatePartitions(ctx); err != nil {
 		logger.Fatal("failed to create partitions on startup", zap.Error(err))
 	}
 
-	// Build TLS and SASL from config.
-	tlsCfg, err := cfg.Kafka.BuildTLSConfig()
-	if err != nil {
-		logger.Fatal("failed to build TLS config", zap.Error(err))
-	}
-	saslMech := cfg.Kafka.BuildSASLMechanism()
-
 	// --- State pipeline ---
 	stateWriter := state.NewWriter(pool, logger.Named("state.writer"))
 	statePipeline := state.NewPipeline(stateWriter, cfg.Ingest.BatchSize, cfg.Ingest.FlushIntervalMs, cfg.Kafka.State.RawMode, cfg.Ingest.MaxPayloadBytes, logger.Named("state.pipeline"), cfg.Routers)
 
-	stateRecords := make(chan []*kgo.Record, cfg.Ingest.ChannelBufferSize)
-	stateFlushed := make(chan []*kgo.Record, cfg.Ingest.ChannelBufferSize)
-
-	stateConsumer, err := kafka.NewStateConsumer(
-		cfg.Kafka.Brokers, cfg.Kafka.State.GroupID, cfg.Kafka.State.Topics,
-		cfg.Kafka.ClientID+"-state", cfg.Kafka.FetchMaxBytes, tlsCfg, saslMech, logger.Named("kafka.state"),
-	)
-	if err != nil {
-		logger.Fatal("failed to create state consumer", zap.Error(err))
-	}
-	defer stateConsumer.Close()
+	stateRecords := make(chan []*source.Record, cfg.Ingest.ChannelBufferSize)
+	stateFlushed := make(chan []*source.Record, cfg.Ingest.ChannelBufferSize)
 
 	var wg sync.WaitGroup
 	var commitWg sync.WaitGroup
-	wg.Add(2)
-	go func() { defer wg.Done(); stateConsumer.Run(ctx, stateRecords, stateFlushed, &commitWg) }()
+	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		statePipeline.Run(ctx, stateRecords, stateFlushed)
 		close(stateFlushed)
 	}()
 
-	logger.Info("state pipeline started",
-		zap.Strings("topics", cfg.Kafka.State.Topics),
-		zap.String("group_id", cfg.Kafka.State.GroupID),
-	)
-
 	// --- History pipeline ---
 	historyWriter := history.NewWriter(pool, logger.Named("history.writer"),
-		cfg.Ingest.StoreRawBytes, cfg.Ingest.StoreRawBytesCompress)
+		cfg.Ingest.StoreRawBytes, cfg.Ingest.StoreRawBytesCompress,
+		cfg.Retention.TimeAxis, cfg.Retention.Days)
 	historyPipeline := history.NewPipeline(historyWriter,
 		cfg.Ingest.BatchSize, cfg.Ingest.FlushIntervalMs, cfg.Ingest.MaxPayloadBytes,
 		logger.Named("history.pipeline"), cfg.Routers)
 
-	historyRecords := make(chan []*kgo.Record, cfg.Ingest.ChannelBufferSize)
-	historyFlushed := make(chan []*kgo.Record, cfg.Ingest.ChannelBufferSize)
-
-	historyConsumer, err := kafka.NewHistoryConsumer(
-		cfg.Kafka.Brokers, cfg.Kafka.History.GroupID, cfg.Kafka.History.Topics,
-		cfg.Kafka.ClientID+"-history", cfg.Kafka.FetchMaxBytes, tlsCfg, saslMech, logger.Named("kafka.history"),
-	)
-	if err != nil {
-		logger.Fatal("failed to create history consumer", zap.Error(err))
-	}
-	defer historyConsumer.Close()
+	historyRecords := make(chan []*source.Record, cfg.Ingest.ChannelBufferSize)
+	historyFlushed := make(chan []*source.Record, cfg.Ingest.ChannelBufferSize)
 
-	wg.Add(2)
-	go func() { defer wg.Done(); historyConsumer.Run(ctx, historyRecords, historyFlushed, &commitWg) }()
+	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		historyPipeline.Run(ctx, historyRecords, historyFlushed)
 		close(historyFlushed)
 	}()
 
-	logger.Info("history pipeline started",
-		zap.Strings("topics", cfg.Kafka.History.Topics),
-		zap.String("group_id", cfg.Kafka.History.GroupID),
-	)
+	// --- Kafka sources ---
+	// Interface-typed so a disabled consumer is a nil interface, not a nil pointer.
+	var stateStatus, historyStatus ribhttp.ConsumerStatus
+	if cfg.KafkaEnabled() {
+		// Build TLS and SASL from config.
+		tlsCfg, err := cfg.Kafka.BuildTLSConfig()
+		if err != nil {
+			logger.Fatal("failed to build TLS config", zap.Error(err))
+		}
+		saslMech := cfg.Kafka.BuildSASLMechanism()
+
+		stateConsumer, err := kafka.NewStateConsumer(
+			cfg.Kafka.Brokers, cfg.Kafka.State.GroupID, cfg.Kafka.State.Topics,
+			cfg.Kafka.ClientID+"-state", cfg.Kafka.FetchMaxBytes, tlsCfg, saslMech, logger.Named("kafka.state"),
+		)
+		if err != nil {
+			logger.Fatal("failed to create state consumer", zap.Error(err))
+		}
+		defer stateConsumer.Close()
+
+		wg.Add(1)
+		go func() { defer wg.Done(); stateConsumer.Run(ctx, stateRecords, stateFlushed, &commitWg) }()
+
+		logger.Info("state pipeline started",
+			zap.Strings("topics", cfg.Kafka.State.Topics),
+			zap.String("group_id", cfg.Kafka.State.GroupID),
+		)
+
+		historyConsumer, err := kafka.NewHistoryConsumer(
+			cfg.Kafka.Brokers, cfg.Kafka.History.GroupID, cfg.Kafka.History.Topics,
+			cfg.Kafka.ClientID+"-history", cfg.Kafka.FetchMaxBytes, tlsCfg, saslMech, logger.Named("kafka.history"),
+		)
+		if err != nil {
+			logger.Fatal("failed to create history consumer", zap.Error(err))
+		}
+		defer historyConsumer.Close()
+
+		wg.Add(1)
+		go func() { defer wg.Done(); historyConsumer.Run(ctx, historyRecords, historyFlushed, &commitWg) }()
+
+		logger.Info("history pipeline started",
+			zap.Strings("topics", cfg.Kafka.History.Topics),
+			zap.String("group_id", cfg.Kafka.History.GroupID),
+		)
+
+		stateStatus, historyStatus = stateConsumer, historyConsumer
+	} else {
+		// Listener records need no acknowledgement; drain the flushed
+		// channels so the pipelines never block on them.
+		commitWg.Add(2)
+		go func() {
+			defer commitWg.Done()
+			for range stateFlushed {
+			}
+		}()
+		go func() {
+			defer commitWg.Done()
+			for range historyFlushed {
+			}
+		}()
+	}
+
+	// --- BMP listener source ---
+	var bmpListener *listener.BMPListener
+	if cfg.BMPListener.Enabled {
+		bmpListener = listener.NewBMPListener(cfg.BMPListener.Listen, cfg.Ingest.MaxPayloadBytes, logger.Named("listener"))
+		if err := bmpListener.Start(); err != nil {
+			logger.Fatal("failed to start BMP listener", zap.Error(err))
+		}
+		wg.Add(1)
+		go func() { defer wg.Done(); bmpListener.Run(ctx, stateRecords, historyRecords) }()
+	}
 
 	// --- HTTP server ---
-	httpServer := ribhttp.NewServer(cfg.Service.HTTPListen, pool, stateConsumer, historyConsumer, logger.Named("http"))
+	httpServer := ribhttp.NewServer(cfg.Service.HTTPListen, pool, stateStatus, historyStatus, logger.Named("http"))
+	if bmpListener != nil {
+		httpServer.SetBMPListener(bmpListener)
+	}
 	if err := httpServer.Start(); err != nil {
 		logger.Fatal("failed to start HTTP server", zap.Error(err))
 	}
@@ -303,6 +344,7 @@ func runMaintenance() {
 	logger.Info("running partition maintenance",
 		zap.Int("retention_days", cfg.Retention.Days),
 		zap.String("timezone", cfg.Retention.Timezone),
+		zap.String("time_axis", cfg.Retention.TimeAxis),
 	)
 
 	ctx := context.Background()
@@ -312,7 +354,7 @@ func runMaintenance() {
 	}
 	defer pool.Close()
 
-	pm := maintenance.NewPartitionManager(pool, cfg.Retention.Days, cfg.Retention.Timezone, logger)
+	pm := maintenance.NewPartitionManager(pool, cfg.Retention.Days, cfg.Retention.Timezone, cfg.Retention.TimeAxis, logger)
 	if err := pm.Run(ctx); err != nil {
 		logger.Fatal("maintenance failed", zap.Error(err))
 	}
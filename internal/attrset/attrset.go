@@ -0,0 +1,190 @@
+// Package attrset stores the path attributes of routes once per distinct
+// set, in the content-addressed path_attributes table. current_routes,
+// adj_rib_in and route_events reference a set by its hash in attr_hash.
+package attrset
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+// Hash identifies a Set: the SHA-256 of its canonical encoding.
+type Hash [sha256.Size]byte
+
+// Set is the part of a route shared by the routes of an UPDATE, stored in
+// path_attributes. The next hop, labels, Prefix-SID and parse warnings are
+// kept with each route.
+type Set struct {
+	Origin            string
+	ASPath            string
+	ASPathSegments    bgp.ASPath
+	LocalPref         *uint32
+	MED               *uint32
+	CommStd           []string
+	CommExt           []string
+	CommLarge         []string
+	Attrs             []byte // JSON object of the undecoded attributes
+	OriginatorID      string
+	ClusterList       []string
+	AtomicAggregate   bool
+	AggregatorASN     *uint32
+	AggregatorAddress string
+	OTC               *uint32
+}
+
+// FromEvent returns the attribute set of a route event.
+func FromEvent(e *bgp.RouteEvent) *Set {
+	s := &Set{
+		Origin:            e.Origin,
+		ASPath:            e.ASPath,
+		ASPathSegments:    e.ASPathSegments,
+		LocalPref:         e.LocalPref,
+		MED:               e.MED,
+		CommStd:           e.CommStd,
+		CommExt:           e.CommExt,
+		CommLarge:         e.CommLarge,
+		OriginatorID:      e.OriginatorID,
+		ClusterList:       e.ClusterList,
+		AtomicAggregate:   e.AtomicAggregate,
+		AggregatorASN:     e.AggregatorASN,
+		AggregatorAddress: e.AggregatorAddress,
+		OTC:               e.OTC,
+	}
+	if len(e.Attrs) > 0 {
+		// A map of strings always marshals.
+		s.Attrs, _ = json.Marshal(e.Attrs)
+	}
+	return s
+}
+
+// normalize clears empty lists, which are stored as NULL, so that sets
+// differing only in them hash alike.
+func (s *Set) normalize() {
+	if len(s.CommStd) == 0 {
+		s.CommStd = nil
+	}
+	if len(s.CommExt) == 0 {
+		s.CommExt = nil
+	}
+	if len(s.CommLarge) == 0 {
+		s.CommLarge = nil
+	}
+	if len(s.Attrs) == 0 {
+		s.Attrs = nil
+	}
+	if len(s.ClusterList) == 0 {
+		s.ClusterList = nil
+	}
+	if s.ASPath == "" {
+		s.ASPathSegments = nil
+	}
+}
+
+// IsZero reports whether s carries no attributes, as for a route whose
+// UPDATE had none that are stored in a set.
+func (s *Set) IsZero() bool {
+	return s.Origin == "" && s.ASPath == "" && s.LocalPref == nil && s.MED == nil &&
+		len(s.CommStd) == 0 && len(s.CommExt) == 0 && len(s.CommLarge) == 0 && len(s.Attrs) == 0 &&
+		s.OriginatorID == "" && len(s.ClusterList) == 0 && !s.AtomicAggregate &&
+		s.AggregatorASN == nil && s.AggregatorAddress == "" && s.OTC == nil
+}
+
+// Hash returns the hash of s. The AS path is hashed as rendered in ASPath,
+// from which ASPathSegments follows.
+func (s *Set) Hash() Hash {
+	var b []byte
+	b = appendString(b, s.Origin)
+	b = appendString(b, s.ASPath)
+	b = appendUint32(b, s.LocalPref)
+	b = appendUint32(b, s.MED)
+	b = appendStrings(b, s.CommStd)
+	b = appendStrings(b, s.CommExt)
+	b = appendStrings(b, s.CommLarge)
+	b = appendString(b, string(s.Attrs))
+	b = appendString(b, s.OriginatorID)
+	b = appendStrings(b, s.ClusterList)
+	if s.AtomicAggregate {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = appendUint32(b, s.AggregatorASN)
+	b = appendString(b, s.AggregatorAddress)
+	b = appendUint32(b, s.OTC)
+	return sha256.Sum256(b)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendStrings(b []byte, ss []string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(ss)))
+	for _, s := range ss {
+		b = appendString(b, s)
+	}
+	return b
+}
+
+func appendUint32(b []byte, v *uint32) []byte {
+	if v == nil {
+		return append(b, 0)
+	}
+	b = append(b, 1)
+	return binary.BigEndian.AppendUint32(b, *v)
+}
+
+// values returns the path_attributes row of s, in the order of insertSQL.
+func (s *Set) values(h Hash) []any {
+	var asns []int64
+	var length, hasSet any
+	if len(s.ASPathSegments) > 0 {
+		asns, length, hasSet = s.ASPathSegments.ASNs(), s.ASPathSegments.Len(), s.ASPathSegments.HasSet()
+	}
+	return []any{
+		h[:], nilIfEmpty(s.Origin), nilIfEmpty(s.ASPath), asns, length, hasSet,
+		bgp.OriginASN(s.ASPathSegments), s.LocalPref, s.MED,
+		s.CommStd, s.CommExt, s.CommLarge, s.Attrs,
+		nilIfEmpty(s.OriginatorID), s.ClusterList, s.AtomicAggregate,
+		s.AggregatorASN, nilIfEmpty(s.AggregatorAddress), s.OTC,
+	}
+}
+
+func nilIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Batch collects the distinct attribute sets of a batch of routes for
+// Store.Ensure. The zero value is ready to use.
+type Batch struct {
+	sets map[Hash]*Set
+}
+
+// Add adds s to the batch and returns the attr_hash value of a route
+// carrying it: nil, for NULL, if s carries no attributes.
+func (b *Batch) Add(s *Set) []byte {
+	s.normalize()
+	if s.IsZero() {
+		return nil
+	}
+	h := s.Hash()
+	if b.sets == nil {
+		b.sets = make(map[Hash]*Set)
+	}
+	if _, ok := b.sets[h]; !ok {
+		b.sets[h] = s
+	}
+	return h[:]
+}
+
+// Len returns the number of distinct sets in the batch.
+func (b *Batch) Len() int {
+	return len(b.sets)
+}
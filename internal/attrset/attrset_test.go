@@ -0,0 +1,141 @@
+package attrset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+func TestSet_Hash(t *testing.T) {
+	lp, med := uint32(100), uint32(100)
+	path, _ := bgp.ParseASPath("64496 64497")
+	base := func() *Set {
+		return &Set{Origin: "IGP", ASPath: path.String(), ASPathSegments: path, LocalPref: &lp,
+			CommStd: []string{"64496:1"}, Attrs: []byte(`{"99":"ab"}`)}
+	}
+	h := base().Hash()
+
+	same := base()
+	same.LocalPref = new(uint32)
+	*same.LocalPref = 100
+	if same.Hash() != h {
+		t.Error("expected equal sets to hash alike")
+	}
+
+	for name, change := range map[string]func(*Set){
+		"origin":         func(s *Set) { s.Origin = "EGP" },
+		"AS path":        func(s *Set) { s.ASPath = "64496 64498" },
+		"MED for LP":     func(s *Set) { s.LocalPref, s.MED = nil, &med },
+		"community list": func(s *Set) { s.CommStd, s.CommExt = nil, []string{"64496:1"} },
+		"community":      func(s *Set) { s.CommStd = []string{"64496:1", "64496:2"} },
+		"attrs":          func(s *Set) { s.Attrs = nil },
+		"atomic agg":     func(s *Set) { s.AtomicAggregate = true },
+		"OTC":            func(s *Set) { s.OTC = &lp },
+	} {
+		s := base()
+		change(s)
+		if s.Hash() == h {
+			t.Errorf("%s: expected a different hash", name)
+		}
+	}
+}
+
+func TestBatch_Add(t *testing.T) {
+	var b Batch
+	if got := b.Add(&Set{CommStd: []string{}, Attrs: []byte{}}); got != nil || b.Len() != 0 {
+		t.Errorf("expected no hash for an empty set, got %x", got)
+	}
+
+	// Empty lists are stored as NULL and hash as absent.
+	h1 := b.Add(&Set{Origin: "IGP", CommStd: []string{}})
+	h2 := b.Add(&Set{Origin: "IGP"})
+	if len(h1) != 32 || string(h1) != string(h2) || b.Len() != 1 {
+		t.Errorf("expected one set, got %x, %x (%d sets)", h1, h2, b.Len())
+	}
+	if b.Add(&Set{Origin: "EGP"}); b.Len() != 2 {
+		t.Errorf("expected 2 sets, got %d", b.Len())
+	}
+}
+
+func TestFromEvent(t *testing.T) {
+	asn := uint32(64500)
+	path, _ := bgp.ParseASPath("64496 {64497,64498}")
+	e := &bgp.RouteEvent{Prefix: "10.0.0.0/24", Nexthop: "192.0.2.1", Origin: "INCOMPLETE",
+		ASPath: path.String(), ASPathSegments: path, AggregatorASN: &asn, AggregatorAddress: "192.0.2.9",
+		Attrs: map[string]string{"99": "ab"}}
+	s := FromEvent(e)
+	if string(s.Attrs) != `{"99":"ab"}` || s.AggregatorASN != &asn || s.ASPath != "64496 {64497,64498}" {
+		t.Errorf("unexpected set %+v", s)
+	}
+
+	// The next hop is not part of the set.
+	e2 := *e
+	e2.Nexthop = "192.0.2.2"
+	if FromEvent(&e2).Hash() != s.Hash() {
+		t.Error("expected routes differing in next hop to share a set")
+	}
+
+	// A path ending in an AS_SET has no origin AS.
+	v := s.values(s.Hash())
+	if len(v) != 19 || v[5] != true || v[6].(*int) != nil {
+		t.Errorf("unexpected values %v", v)
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2, time.Hour)
+	now := time.Now()
+	a, b, d := Hash{1}, Hash{2}, Hash{3}
+	c.add(a, now)
+	c.add(b, now)
+	c.get(a, now) // b is now the least recently used
+	c.add(d, now)
+	if !c.get(a, now) || c.get(b, now) || !c.get(d, now) {
+		t.Errorf("expected b evicted, have %d items", c.order.Len())
+	}
+	c.add(a, now)
+	if c.order.Len() != 2 || len(c.items) != 2 {
+		t.Errorf("expected 2 items, got %d", c.order.Len())
+	}
+}
+
+func TestLRU_Expiry(t *testing.T) {
+	c := newLRU(2, time.Hour)
+	start := time.Now()
+	a, b := Hash{1}, Hash{2}
+	c.add(a, start)
+	c.add(b, start)
+
+	// Using a hash does not extend its lifetime; adding it again does.
+	c.get(a, start.Add(30*time.Minute))
+	c.add(b, start.Add(30*time.Minute))
+	later := start.Add(time.Hour)
+	if c.get(a, later) {
+		t.Error("expected a expired an hour after it was added")
+	}
+	if !c.get(b, later) {
+		t.Error("expected b, added again, not to have expired")
+	}
+	if c.order.Len() != 1 || len(c.items) != 1 {
+		t.Errorf("expected the expired hash removed, have %d items", c.order.Len())
+	}
+}
+
+func TestStore_EnsureKnown(t *testing.T) {
+	// With every set known no statement is sent, so no pool is needed.
+	s := NewStore(nil, "test", 4)
+	var b Batch
+	for _, origin := range []string{"IGP", "EGP"} {
+		h := b.Add(&Set{Origin: origin})
+		s.known.add(Hash(h), time.Now())
+	}
+	n, err := s.Ensure(context.Background(), &b)
+	if err != nil || n != 0 {
+		t.Errorf("expected nothing inserted, got %d (error %v)", n, err)
+	}
+	if n, err := s.Ensure(context.Background(), &Batch{}); err != nil || n != 0 {
+		t.Errorf("expected nothing inserted for an empty batch, got %d (error %v)", n, err)
+	}
+}
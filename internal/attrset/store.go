@@ -0,0 +1,182 @@
+package attrset
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+)
+
+// DefaultCacheSize is the number of set hashes a Store remembers. A full
+// table carries a few thousand distinct sets per peer.
+const DefaultCacheSize = 1 << 16
+
+// CacheTTL is how long a Store trusts a hash it inserted or found in
+// path_attributes. Each insert or find sets the row's last_seen, and the
+// maintenance sweep (see SweepSQL) only deletes sets unseen for
+// SweepAfter, so a set is never deleted while a Store may still reference
+// it without inserting it.
+const CacheTTL = time.Hour
+
+// SweepAfter is how long a set must go unseen by every Store before the
+// maintenance sweep may delete it. Twice CacheTTL leaves a Store a full
+// CacheTTL to write the routes of a batch after Ensure.
+const SweepAfter = 2 * CacheTTL
+
+const insertSQL = `
+	INSERT INTO path_attributes (attr_hash, origin, as_path, as_path_asns, as_path_len,
+		as_path_has_set, origin_asn, localpref, med,
+		communities_std, communities_ext, communities_large, attrs,
+		originator_id, cluster_list, atomic_aggregate, aggregator_asn, aggregator_address, otc)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+	ON CONFLICT (attr_hash) DO UPDATE SET last_seen = now()
+	RETURNING xmax = 0`
+
+// SweepSQL deletes the sets of path_attributes that no route or route
+// event references and no Store has inserted or found for $1 seconds.
+// The route tables are only written with hashes a Store has seen within
+// CacheTTL, so with $1 at least SweepAfter no set being referenced is
+// deleted. Sets of routes whose transaction failed after Ensure are
+// removed the same way.
+const SweepSQL = `
+	DELETE FROM path_attributes a
+	WHERE a.last_seen < now() - make_interval(secs => $1)
+	  AND NOT EXISTS (SELECT 1 FROM current_routes r WHERE r.attr_hash = a.attr_hash)
+	  AND NOT EXISTS (SELECT 1 FROM adj_rib_in r WHERE r.attr_hash = a.attr_hash)
+	  AND NOT EXISTS (SELECT 1 FROM route_events e WHERE e.attr_hash = a.attr_hash)`
+
+// Store inserts attribute sets into path_attributes, skipping those it
+// has inserted or found there within CacheTTL.
+type Store struct {
+	pool     *pgxpool.Pool
+	pipeline string // metric label
+
+	mu    sync.Mutex
+	known *lru
+}
+
+// NewStore returns a Store remembering up to size hashes.
+func NewStore(pool *pgxpool.Pool, pipeline string, size int) *Store {
+	return &Store{pool: pool, pipeline: pipeline, known: newLRU(size, CacheTTL)}
+}
+
+// Ensure inserts the sets of b not yet in path_attributes, in a
+// transaction of its own, and returns the number inserted. Sets already
+// there have their last_seen refreshed. It is called before the routes
+// referencing the sets are written: a set committed for routes whose
+// transaction then fails is unreferenced until the maintenance sweep
+// deletes it.
+func (s *Store) Ensure(ctx context.Context, b *Batch) (int64, error) {
+	if b.Len() == 0 {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	missing := make([]Hash, 0, b.Len())
+	for h := range b.sets {
+		if !s.known.get(h, now) {
+			missing = append(missing, h)
+		}
+	}
+	s.mu.Unlock()
+
+	metrics.AttrSetLookupsTotal.WithLabelValues(s.pipeline, "hit").Add(float64(b.Len() - len(missing)))
+	metrics.AttrSetLookupsTotal.WithLabelValues(s.pipeline, "miss").Add(float64(len(missing)))
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	// Writers inserting overlapping sets concurrently take their row locks
+	// in the same order and so cannot deadlock.
+	slices.SortFunc(missing, func(a, b Hash) int { return bytes.Compare(a[:], b[:]) })
+	batch := &pgx.Batch{}
+	for _, h := range missing {
+		batch.Queue(insertSQL, b.sets[h].values(h)...)
+	}
+	results := s.pool.SendBatch(ctx, batch)
+	var inserted int64
+	for range missing {
+		var isNew bool
+		if err := results.QueryRow().Scan(&isNew); err != nil {
+			results.Close()
+			return 0, fmt.Errorf("insert path attributes: %w", err)
+		}
+		if isNew {
+			inserted++
+		}
+	}
+	if err := results.Close(); err != nil {
+		return 0, fmt.Errorf("closing batch results: %w", err)
+	}
+
+	// The sets were seen as of now, before the inserts: a hash is not
+	// trusted for longer than CacheTTL after its last_seen.
+	s.mu.Lock()
+	for _, h := range missing {
+		s.known.add(h, now)
+	}
+	s.mu.Unlock()
+
+	metrics.DBRowsAffectedTotal.WithLabelValues(s.pipeline, "path_attributes", "insert").Add(float64(inserted))
+	return inserted, nil
+}
+
+// lru is a set of hashes bounded to size, evicting the least recently
+// used. A hash expires ttl after it was added.
+type lru struct {
+	size  int
+	ttl   time.Duration
+	order *list.List // of lruEntry, most recently used first
+	items map[Hash]*list.Element
+}
+
+type lruEntry struct {
+	hash  Hash
+	added time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{size: size, ttl: ttl, order: list.New(), items: make(map[Hash]*list.Element, size)}
+}
+
+// get reports whether h is in the set and has not expired at now, marking
+// it used.
+func (c *lru) get(h Hash, now time.Time) bool {
+	e, ok := c.items[h]
+	if !ok {
+		return false
+	}
+	if now.Sub(e.Value.(lruEntry).added) >= c.ttl {
+		c.order.Remove(e)
+		delete(c.items, h)
+		return false
+	}
+	c.order.MoveToFront(e)
+	return true
+}
+
+// add adds h, seen at now, to the set.
+func (c *lru) add(h Hash, now time.Time) {
+	if c.size <= 0 {
+		return
+	}
+	if e, ok := c.items[h]; ok {
+		e.Value = lruEntry{hash: h, added: now}
+		c.order.MoveToFront(e)
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(lruEntry).hash)
+	}
+	c.items[h] = c.order.PushFront(lruEntry{hash: h, added: now})
+}
@@ -0,0 +1,302 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ASPathSegment is an AS_SEQUENCE or AS_SET of an AS_PATH (RFC 4271
+// §4.3), or a confederation segment (RFC 5065) while decoding.
+type ASPathSegment struct {
+	Type uint8 // ASPathSegmentSequence or ASPathSegmentSet
+	ASNs []uint32
+}
+
+// ASPath is a decoded AS_PATH, nearest AS first. Confederation segments
+// are dropped: they do not leave the confederation, and RouteEvent.ASPath
+// omits them too.
+type ASPath []ASPathSegment
+
+// String renders the path as in RouteEvent.ASPath: sequences as
+// space-separated ASNs and sets as "{a,b}".
+func (p ASPath) String() string {
+	return string(p.AppendTo(nil))
+}
+
+// AppendTo appends the path as rendered by String to dst.
+func (p ASPath) AppendTo(dst []byte) []byte {
+	for i, seg := range p {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		sep := byte(' ')
+		if seg.Type == ASPathSegmentSet {
+			dst = append(dst, '{')
+			sep = ','
+		}
+		for j, asn := range seg.ASNs {
+			if j > 0 {
+				dst = append(dst, sep)
+			}
+			dst = strconv.AppendUint(dst, uint64(asn), 10)
+		}
+		if seg.Type == ASPathSegmentSet {
+			dst = append(dst, '}')
+		}
+	}
+	return dst
+}
+
+// ASNs returns the ASNs of the path in order, set members included, for
+// the as_path_asns column; nil if there are none.
+func (p ASPath) ASNs() []int64 {
+	n := 0
+	for _, seg := range p {
+		n += len(seg.ASNs)
+	}
+	if n == 0 {
+		return nil
+	}
+	asns := make([]int64, 0, n)
+	for _, seg := range p {
+		for _, asn := range seg.ASNs {
+			asns = append(asns, int64(asn))
+		}
+	}
+	return asns
+}
+
+// Len returns the path length used in route selection (RFC 4271
+// §9.1.2.2): an AS_SET counts as one.
+func (p ASPath) Len() int {
+	n := 0
+	for _, seg := range p {
+		switch seg.Type {
+		case ASPathSegmentSequence:
+			n += len(seg.ASNs)
+		case ASPathSegmentSet:
+			n++
+		}
+	}
+	return n
+}
+
+// HasSet reports whether the path contains an AS_SET, as aggregates do.
+func (p ASPath) HasSet() bool {
+	for _, seg := range p {
+		if seg.Type == ASPathSegmentSet {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseASPath parses a path rendered as by ASPath.String, e.g. by goBMP.
+// Spaces are allowed within sets.
+func ParseASPath(s string) (ASPath, error) {
+	var path ASPath
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '{' {
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("bgp: unterminated AS_SET in AS path")
+			}
+			set := ASPathSegment{Type: ASPathSegmentSet}
+			for _, field := range strings.Split(s[1:end], ",") {
+				asn, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("bgp: invalid ASN in AS_SET: %w", err)
+				}
+				set.ASNs = append(set.ASNs, uint32(asn))
+			}
+			path = append(path, set)
+			s = s[end+1:]
+			continue
+		}
+
+		field := s
+		if end := strings.IndexAny(s, " \t{"); end >= 0 {
+			field = s[:end]
+		}
+		asn, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bgp: invalid ASN in AS path: %w", err)
+		}
+		if n := len(path); n > 0 && path[n-1].Type == ASPathSegmentSequence {
+			path[n-1].ASNs = append(path[n-1].ASNs, uint32(asn))
+		} else {
+			path = append(path, ASPathSegment{Type: ASPathSegmentSequence, ASNs: []uint32{uint32(asn)}})
+		}
+		s = s[len(field):]
+	}
+	return path, nil
+}
+
+// OriginASN returns the origin AS number, the last ASN of the path.
+// Returns nil if the path is empty or ends with an AS_SET, whose origin is
+// ambiguous.
+func OriginASN(path ASPath) *int {
+	if len(path) == 0 {
+		return nil
+	}
+	last := path[len(path)-1]
+	if last.Type != ASPathSegmentSequence || len(last.ASNs) == 0 {
+		return nil
+	}
+	asn := int(last.ASNs[len(last.ASNs)-1])
+	return &asn
+}
+
+// buildASPath decodes the AS_PATH with the given ASN width. For 2-octet
+// sessions, AS4_PATH is merged in per RFC 6793 §4.2.3 so 4-octet ASNs
+// hidden behind AS_TRANS are restored. For 4-octet sessions AS4_PATH is
+// ignored (§4.1).
+func buildASPath(asPath, as4Path, aggregator []byte, width ASNWidth) ASPath {
+	if asPath == nil {
+		return nil
+	}
+	if width == ASNWidthAuto {
+		width = detectASNWidth(asPath, as4Path != nil)
+	}
+	asnLen := 4
+	if width == ASNWidth2 {
+		asnLen = 2
+	}
+
+	segs, _ := decodeASPath(asPath, asnLen)
+	// An AGGREGATOR that is not AS_TRANS was set by a 2-octet speaker after
+	// the AS4 attributes were added, so they are stale.
+	if width == ASNWidth2 && as4Path != nil &&
+		(len(aggregator) < 2 || uint32(binary.BigEndian.Uint16(aggregator[0:2])) == ASTrans) {
+		as4Segs, _ := decodeASPath(as4Path, 4)
+		segs = mergeAS4Path(segs, as4Segs)
+	}
+
+	path := segs[:0]
+	for _, seg := range segs {
+		if seg.Type == ASPathSegmentSequence || seg.Type == ASPathSegmentSet {
+			path = append(path, seg)
+		}
+	}
+	return path
+}
+
+// detectASNWidth guesses the ASN width of an AS_PATH from a session whose
+// capabilities are unknown. Segments must exactly fill the attribute, so
+// usually only one width fits.
+func detectASNWidth(asPath []byte, hasAS4Path bool) ASNWidth {
+	ok4, _ := scanASPath(asPath, 4)
+	ok2, _ := scanASPath(asPath, 2)
+	if ok2 && (!ok4 || hasAS4Path) {
+		return ASNWidth2
+	}
+	return ASNWidth4
+}
+
+// validASPath reports whether the segments of an AS_PATH or AS4_PATH have a
+// defined type and exactly fill it (RFC 7606 §7.2), with either ASN width
+// if width is ASNWidthAuto.
+func validASPath(data []byte, width ASNWidth) bool {
+	valid := func(asnLen int) bool {
+		fits, defined := scanASPath(data, asnLen)
+		return fits && defined
+	}
+	switch width {
+	case ASNWidth2:
+		return valid(2)
+	case ASNWidth4:
+		return valid(4)
+	}
+	return valid(4) || valid(2)
+}
+
+// scanASPath walks AS_PATH segments with asnLen-byte ASNs. fits reports
+// whether they exactly fill data, and defined whether the segments up to a
+// truncated one have a defined type.
+func scanASPath(data []byte, asnLen int) (fits, defined bool) {
+	defined = true
+	offset := 0
+	for offset+2 <= len(data) {
+		segType := data[offset]
+		segLen := int(data[offset+1])
+		offset += 2
+
+		if offset+segLen*asnLen > len(data) {
+			return false, defined
+		}
+		if segType < ASPathSegmentSet || segType > ASPathSegmentConfedSet {
+			defined = false
+		}
+		offset += segLen * asnLen
+	}
+	return offset == len(data), defined
+}
+
+// decodeASPath decodes AS_PATH segments with asnLen-byte ASNs, including
+// confederation segments. A truncated segment ends decoding; ok reports
+// whether the segments exactly filled data.
+func decodeASPath(data []byte, asnLen int) (segs ASPath, ok bool) {
+	// The ASNs of all segments share one array.
+	all := make([]uint32, 0, len(data)/asnLen)
+	offset := 0
+	for offset+2 <= len(data) {
+		segType := data[offset]
+		segLen := int(data[offset+1])
+		offset += 2
+
+		if offset+segLen*asnLen > len(data) {
+			return segs, false
+		}
+
+		start := len(all)
+		for range segLen {
+			if asnLen == 2 {
+				all = append(all, uint32(binary.BigEndian.Uint16(data[offset:offset+2])))
+			} else {
+				all = append(all, binary.BigEndian.Uint32(data[offset:offset+4]))
+			}
+			offset += asnLen
+		}
+		segs = append(segs, ASPathSegment{Type: segType, ASNs: all[start:len(all):len(all)]})
+	}
+	return segs, offset == len(data)
+}
+
+// mergeAS4Path reconstructs the path per RFC 6793 §4.2.3: the leading
+// ASNs of AS_PATH that AS4_PATH does not cover, followed by AS4_PATH. If
+// AS4_PATH is longer than AS_PATH it is ignored. Path lengths do not count
+// confederation segments.
+func mergeAS4Path(asPath, as4Path ASPath) ASPath {
+	var as4 ASPath
+	for _, seg := range as4Path {
+		// Confederation segments in AS4_PATH must be discarded.
+		if seg.Type == ASPathSegmentSequence || seg.Type == ASPathSegmentSet {
+			as4 = append(as4, seg)
+		}
+	}
+
+	n := asPath.Len() - as4.Len()
+	if n < 0 {
+		return asPath
+	}
+
+	var merged ASPath
+	for _, seg := range asPath {
+		if n == 0 {
+			break
+		}
+		switch seg.Type {
+		case ASPathSegmentSequence:
+			if len(seg.ASNs) > n {
+				seg.ASNs = seg.ASNs[:n]
+			}
+			n -= len(seg.ASNs)
+		case ASPathSegmentSet:
+			n--
+		}
+		merged = append(merged, seg)
+	}
+	return append(merged, as4...)
+}
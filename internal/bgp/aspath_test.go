@@ -0,0 +1,90 @@
+package bgp
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseASPath(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		len    int
+		hasSet bool
+		asns   []int64
+	}{
+		{in: "", want: "", len: 0},
+		{in: "64496", want: "64496", len: 1, asns: []int64{64496}},
+		{in: "64496 64497 64497 4200000000", want: "64496 64497 64497 4200000000", len: 4,
+			asns: []int64{64496, 64497, 64497, 4200000000}},
+		{in: "64496 {64497, 64498} 64499", want: "64496 {64497,64498} 64499", len: 3, hasSet: true,
+			asns: []int64{64496, 64497, 64498, 64499}},
+		{in: "  64496{64497}  ", want: "64496 {64497}", len: 2, hasSet: true, asns: []int64{64496, 64497}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			p, err := ParseASPath(tt.in)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := p.String(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if p.Len() != tt.len {
+				t.Errorf("expected length %d, got %d", tt.len, p.Len())
+			}
+			if p.HasSet() != tt.hasSet {
+				t.Errorf("expected HasSet %v", tt.hasSet)
+			}
+			if asns := p.ASNs(); !slices.Equal(asns, tt.asns) {
+				t.Errorf("expected ASNs %v, got %v", tt.asns, asns)
+			}
+		})
+	}
+}
+
+func TestParseASPath_Invalid(t *testing.T) {
+	for _, in := range []string{"64496 {64497", "64496 x", "{}", "4294967296", "-1"} {
+		if _, err := ParseASPath(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestParseUpdate_ASPathSegments(t *testing.T) {
+	asPath := append(asSeg(2, ASPathSegmentConfedSequence, 65100), asSeg(2, ASPathSegmentSequence, 65001, ASTrans, ASTrans)...)
+	pathAttrs := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeASPath, asPath)...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeAS4Path,
+		append(asSeg(4, ASPathSegmentSequence, 4200000001), asSeg(4, ASPathSegmentSet, 65010, 65011)...))...)
+	msg := buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0})
+
+	events, err := ParseUpdateSession(msg, &Session{}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	p := events[0].ASPathSegments
+	want := ASPath{
+		{Type: ASPathSegmentSequence, ASNs: []uint32{65001}},
+		{Type: ASPathSegmentSequence, ASNs: []uint32{4200000001}},
+		{Type: ASPathSegmentSet, ASNs: []uint32{65010, 65011}},
+	}
+	if len(p) != len(want) {
+		t.Fatalf("expected %v, got %v", want, p)
+	}
+	for i := range want {
+		if p[i].Type != want[i].Type || !slices.Equal(p[i].ASNs, want[i].ASNs) {
+			t.Errorf("segment %d: expected %v, got %v", i, want[i], p[i])
+		}
+	}
+	if events[0].ASPath != p.String() {
+		t.Errorf("expected AS path %q to render the segments, got %q", p.String(), events[0].ASPath)
+	}
+	if p.Len() != 3 || !p.HasSet() {
+		t.Errorf("expected length 3 with a set, got %d", p.Len())
+	}
+}
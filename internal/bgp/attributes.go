@@ -5,7 +5,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net"
-	"strings"
+	"net/netip"
+	"strconv"
 )
 
 // PathAttributes holds parsed path attributes from a BGP UPDATE.
@@ -20,345 +21,330 @@ type PathAttributes struct {
 	CommLarge []string
 	Attrs     map[string]string // Unknown attributes keyed by type code
 
-	// MP_REACH_NLRI / MP_UNREACH_NLRI extracted data
-	MPReachAFI     uint16
-	MPReachNLRI    []PrefixInfo
-	MPReachNexthop string
-	MPUnreachAFI   uint16
-	MPUnreachNLRI  []PrefixInfo
-}
-
-// PrefixInfo represents a single NLRI prefix with optional path_id.
-type PrefixInfo struct {
-	Prefix string
-	PathID int64
+	// Route reflection and aggregation attributes
+	OriginatorID      string
+	ClusterList       []string
+	AtomicAggregate   bool
+	AggregatorASN     *uint32
+	AggregatorAddress string
+	OTC               *uint32
+
+	// ASPathSegments is the AS_PATH that ASPath renders.
+	ASPathSegments ASPath
+
+	// MP_REACH_NLRI / MP_UNREACH_NLRI extracted data. The prefixes of the
+	// IP families are read with Decoder.MPReachPrefixes and
+	// Decoder.MPUnreachPrefixes.
+	MPReachAFI       uint16
+	MPReachSAFI      uint8
+	MPReachNexthop   string
+	MPReachNexthopLL string
+	MPUnreachAFI     uint16
+	MPUnreachSAFI    uint8
+	MPReachEVPN      []EVPNRoute // EVPN NLRI (AFI 25)
+	MPUnreachEVPN    []EVPNRoute
+
+	// Flow Specification NLRI (SAFI 133, 134).
+	MPReachFlowSpec   []FlowSpecRule
+	MPUnreachFlowSpec []FlowSpecRule
+
+	// BGP-LS NLRI (AFI 16388) and the BGP-LS Attribute.
+	MPReachLS   []LSRoute
+	MPUnreachLS []LSRoute
+	LinkState   *LSAttribute
+
+	// SR Policy NLRI (SAFI 73). The candidate path of an announcement is
+	// in the Tunnel Encapsulation attribute, which may come after
+	// MP_REACH_NLRI.
+	MPReachSRPolicy   []SRPolicy
+	MPUnreachSRPolicy []SRPolicy
+	tunnelEncap       []byte
+
+	PrefixSID *PrefixSID
+
+	// Warnings are the errors found in the attributes (RFC 7606).
+	Warnings []ParseWarning
 }
 
 // ParsePathAttributes parses the path attributes section of a BGP UPDATE.
-func ParsePathAttributes(data []byte, hasAddPath bool) (*PathAttributes, error) {
-	attrs := &PathAttributes{
-		Attrs: make(map[string]string),
-	}
-
-	offset := 0
-	for offset < len(data) {
-		if offset+2 > len(data) {
-			return attrs, fmt.Errorf("bgp: attr header truncated at offset %d", offset)
-		}
-
-		flags := data[offset]
-		typeCode := data[offset+1]
-		offset += 2
-
-		// Attribute length: 1 byte or 2 bytes depending on Extended Length flag.
-		var attrLen int
-		if flags&0x10 != 0 { // Extended Length
-			if offset+2 > len(data) {
-				return attrs, fmt.Errorf("bgp: extended attr length truncated")
-			}
-			attrLen = int(binary.BigEndian.Uint16(data[offset : offset+2]))
-			offset += 2
-		} else {
-			if offset+1 > len(data) {
-				return attrs, fmt.Errorf("bgp: attr length truncated")
-			}
-			attrLen = int(data[offset])
-			offset++
-		}
+// The AS number width is detected from the AS_PATH. Malformed attributes
+// are recorded in Warnings with the action RFC 7606 prescribes; without
+// the NLRI field, a missing NEXT_HOP is not one of them. The
+// MP_REACH_NLRI and MP_UNREACH_NLRI prefixes of the IP families are read
+// with a Decoder.
+func ParsePathAttributes(data []byte, hasAddPath bool) *PathAttributes {
+	d := Decoder{AddPath: uniformAddPath(hasAddPath)}
+	d.decodeAttrs(data, false)
+	attrs := d.pathAttributes()
+	attrs.Warnings = d.Warnings
+	return attrs
+}
 
-		if offset+attrLen > len(data) {
-			return attrs, fmt.Errorf("bgp: attr data truncated (type %d, need %d, have %d)", typeCode, attrLen, len(data)-offset)
-		}
+// pathAttributes renders the attributes d decoded as strings. The NLRI
+// of the families without an NLRIReader are decoded too, and their errors
+// added to d.Warnings.
+func (d *Decoder) pathAttributes() *PathAttributes {
+	attrs := d.Attrs.Render()
 
-		attrData := data[offset : offset+attrLen]
-		offset += attrLen
-
-		switch typeCode {
-		case AttrTypeOrigin:
-			parseOrigin(attrData, attrs)
-		case AttrTypeASPath:
-			parseASPath(attrData, attrs)
-		case AttrTypeNextHop:
-			parseNextHop(attrData, attrs)
-		case AttrTypeMED:
-			parseMED(attrData, attrs)
-		case AttrTypeLocalPref:
-			parseLocalPref(attrData, attrs)
-		case AttrTypeCommunity:
-			parseCommunity(attrData, attrs)
-		case AttrTypeMPReachNLRI:
-			parseMPReachNLRI(attrData, attrs, hasAddPath)
-		case AttrTypeMPUnreachNLRI:
-			parseMPUnreachNLRI(attrData, attrs, hasAddPath)
-		case AttrTypeExtCommunity:
-			parseExtCommunity(attrData, attrs)
-		case AttrTypeLargeCommunity:
-			parseLargeCommunity(attrData, attrs)
-		default:
-			attrs.Attrs[fmt.Sprintf("%d", typeCode)] = hex.EncodeToString(attrData)
-		}
+	if m := &d.Attrs.MPReach; d.Attrs.Has(AttrTypeMPReachNLRI) && supportedSAFI(m.SAFI) {
+		attrs.MPReachAFI, attrs.MPReachSAFI = m.AFI, m.SAFI
+		attrs.MPReachNexthop, attrs.MPReachNexthopLL = addrString(m.NextHop), addrString(m.NextHopLL)
 	}
+	reach := d.mpReachRoutes()
+	attrs.MPReachEVPN, attrs.MPReachFlowSpec = reach.evpn, reach.flowSpec
+	attrs.MPReachLS, attrs.MPReachSRPolicy = reach.ls, reach.srPolicy
 
-	return attrs, nil
+	if m := &d.Attrs.MPUnreach; d.Attrs.Has(AttrTypeMPUnreachNLRI) && supportedSAFI(m.SAFI) {
+		attrs.MPUnreachAFI, attrs.MPUnreachSAFI = m.AFI, m.SAFI
+	}
+	unreach := d.mpUnreachRoutes()
+	attrs.MPUnreachEVPN, attrs.MPUnreachFlowSpec = unreach.evpn, unreach.flowSpec
+	attrs.MPUnreachLS, attrs.MPUnreachSRPolicy = unreach.ls, unreach.srPolicy
+	return attrs
 }
 
-func parseOrigin(data []byte, attrs *PathAttributes) {
-	if len(data) < 1 {
-		return
+// Render renders the attributes as strings, as RouteEvent carries them.
+// The MP_REACH_NLRI and MP_UNREACH_NLRI fields are left zero. Render
+// returns nil for a nil a.
+func (a *UpdateAttrs) Render() *PathAttributes {
+	if a == nil {
+		return nil
 	}
-	if v, ok := OriginValues[data[0]]; ok {
-		attrs.Origin = v
-	} else {
-		attrs.Origin = fmt.Sprintf("UNKNOWN(%d)", data[0])
+	attrs := &PathAttributes{
+		Attrs: make(map[string]string),
 	}
-}
-
-func parseASPath(data []byte, attrs *PathAttributes) {
-	var segments []string
-	offset := 0
-	for offset+2 <= len(data) {
-		segType := data[offset]
-		segLen := int(data[offset+1])
-		offset += 2
-
-		if offset+segLen*4 > len(data) {
-			break
-		}
-
-		asns := make([]string, segLen)
-		for i := 0; i < segLen; i++ {
-			asn := binary.BigEndian.Uint32(data[offset : offset+4])
-			asns[i] = fmt.Sprintf("%d", asn)
-			offset += 4
-		}
 
-		switch segType {
-		case ASPathSegmentSequence:
-			segments = append(segments, strings.Join(asns, " "))
-		case ASPathSegmentSet:
-			segments = append(segments, "{"+strings.Join(asns, ",")+"}")
+	if a.Has(AttrTypeOrigin) {
+		if v, ok := OriginValues[a.Origin]; ok {
+			attrs.Origin = v
+		} else {
+			attrs.Origin = fmt.Sprintf("UNKNOWN(%d)", a.Origin)
 		}
 	}
-
-	attrs.ASPath = strings.Join(segments, " ")
-}
-
-func parseNextHop(data []byte, attrs *PathAttributes) {
-	if len(data) == 4 {
-		attrs.Nexthop = net.IP(data).String()
+	attrs.ASPathSegments = a.ASPathSegments()
+	attrs.ASPath = attrs.ASPathSegments.String()
+	attrs.Nexthop = addrString(a.NextHop)
+	attrs.MED = optionalUint32(a, AttrTypeMED, a.MED)
+	attrs.LocalPref = optionalUint32(a, AttrTypeLocalPref, a.LocalPref)
+	attrs.OTC = optionalUint32(a, AttrTypeOTC, a.OTC)
+
+	attrs.CommStd = formatEach(a.Communities, 4, appendCommunity)
+	attrs.CommExt = a.extCommunities()
+	attrs.CommLarge = formatEach(a.LargeCommunities, 12, appendLargeCommunity)
+
+	attrs.OriginatorID = addrString(a.OriginatorID)
+	attrs.ClusterList = formatEach(a.ClusterList, 4, appendIPv4)
+	attrs.AtomicAggregate = a.Has(AttrTypeAtomicAggregate)
+	attrs.AggregatorASN, attrs.AggregatorAddress = DecodeAggregator(a.Aggregator, a.AS4Aggregator)
+
+	if a.Has(AttrTypeBGPLS) {
+		attrs.LinkState = parseLSAttribute(a.LinkState)
 	}
-}
-
-func parseMED(data []byte, attrs *PathAttributes) {
-	if len(data) == 4 {
-		v := uint32(binary.BigEndian.Uint32(data))
-		attrs.MED = &v
+	if a.Has(AttrTypePrefixSID) {
+		attrs.PrefixSID = parsePrefixSID(a.PrefixSID)
 	}
-}
-
-func parseLocalPref(data []byte, attrs *PathAttributes) {
-	if len(data) == 4 {
-		v := uint32(binary.BigEndian.Uint32(data))
-		attrs.LocalPref = &v
+	if a.Has(AttrTypeTunnelEncap) {
+		attrs.tunnelEncap = a.TunnelEncap
+		attrs.Attrs[strconv.Itoa(int(AttrTypeTunnelEncap))] = hex.EncodeToString(a.TunnelEncap)
 	}
-}
-
-func parseCommunity(data []byte, attrs *PathAttributes) {
-	for i := 0; i+4 <= len(data); i += 4 {
-		hi := binary.BigEndian.Uint16(data[i : i+2])
-		lo := binary.BigEndian.Uint16(data[i+2 : i+4])
-		attrs.CommStd = append(attrs.CommStd, fmt.Sprintf("%d:%d", hi, lo))
+	for _, u := range a.Unknown {
+		attrs.Attrs[strconv.Itoa(int(u.Type))] = hex.EncodeToString(u.Value)
 	}
+	return attrs
 }
 
-func parseExtCommunity(data []byte, attrs *PathAttributes) {
-	for i := 0; i+8 <= len(data); i += 8 {
-		attrs.CommExt = append(attrs.CommExt, decodeExtCommunity(data[i:i+8]))
+// extCommunities renders the extended and IPv6 extended communities.
+func (a *UpdateAttrs) extCommunities() []string {
+	var commExt []string
+	for i := 0; i+8 <= len(a.ExtCommunities); i += 8 {
+		commExt = append(commExt, decodeExtCommunity(a.ExtCommunities[i:i+8]))
+	}
+	for i := 0; i+20 <= len(a.IPv6ExtCommunities); i += 20 {
+		commExt = append(commExt, decodeIPv6ExtCommunity(a.IPv6ExtCommunities[i:i+20]))
 	}
+	return commExt
 }
 
-// decodeExtCommunity decodes a single 8-byte extended community into a
-// human-readable string. Recognises Route Target (subtype 0x02) and
-// Route Origin / Site-of-Origin (subtype 0x03) for 2-octet AS, IPv4,
-// and 4-octet AS types. Falls back to hex for unknown types.
-func decodeExtCommunity(data []byte) string {
-	typeHigh := data[0]
-	typeLow := data[1]
-
-	// Mask transitive bit for matching.
-	typeHighBase := typeHigh & 0x3F
-
-	switch typeHighBase {
-	case 0x00: // 2-Octet AS Specific
-		asn := binary.BigEndian.Uint16(data[2:4])
-		val := binary.BigEndian.Uint32(data[4:8])
-		switch typeLow {
-		case 0x02:
-			return fmt.Sprintf("RT:%d:%d", asn, val)
-		case 0x03:
-			return fmt.Sprintf("SOO:%d:%d", asn, val)
-		}
-	case 0x01: // IPv4 Address Specific
-		ip := net.IP(data[2:6]).String()
-		val := binary.BigEndian.Uint16(data[6:8])
-		switch typeLow {
-		case 0x02:
-			return fmt.Sprintf("RT:%s:%d", ip, val)
-		case 0x03:
-			return fmt.Sprintf("SOO:%s:%d", ip, val)
-		}
-	case 0x02: // 4-Octet AS Specific
-		asn := binary.BigEndian.Uint32(data[2:6])
-		val := binary.BigEndian.Uint16(data[6:8])
-		switch typeLow {
-		case 0x02:
-			return fmt.Sprintf("RT:%d:%d", asn, val)
-		case 0x03:
-			return fmt.Sprintf("SOO:%d:%d", asn, val)
-		}
+// optionalUint32 returns v if the attribute is present, or nil.
+func optionalUint32(a *UpdateAttrs, typeCode uint8, v uint32) *uint32 {
+	if !a.Has(typeCode) {
+		return nil
 	}
-
-	return hex.EncodeToString(data)
+	return &v
 }
 
-func parseLargeCommunity(data []byte, attrs *PathAttributes) {
-	for i := 0; i+12 <= len(data); i += 12 {
-		global := binary.BigEndian.Uint32(data[i : i+4])
-		data1 := binary.BigEndian.Uint32(data[i+4 : i+8])
-		data2 := binary.BigEndian.Uint32(data[i+8 : i+12])
-		attrs.CommLarge = append(attrs.CommLarge, fmt.Sprintf("%d:%d:%d", global, data1, data2))
+// addrString renders addr, or "" for the zero Addr.
+func addrString(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
 	}
+	return addr.String()
 }
 
-func parseMPReachNLRI(data []byte, attrs *PathAttributes, hasAddPath bool) {
-	if len(data) < 5 {
-		return
+// formatEach renders each size-octet element of data with appendElem. The
+// elements are rendered into one string, which the returned strings share.
+func formatEach(data []byte, size int, appendElem func(dst, elem []byte) []byte) []string {
+	n := len(data) / size
+	if n == 0 {
+		return nil
 	}
-
-	afi := binary.BigEndian.Uint16(data[0:2])
-	safi := data[2]
-	if safi != SAFIUnicast {
-		return // skip non-unicast AFI/SAFI silently
+	var buf [512]byte
+	b := buf[:0]
+	var ends [64]int
+	end := ends[:0]
+	for i := 0; i+size <= len(data); i += size {
+		b = appendElem(b, data[i:i+size])
+		end = append(end, len(b))
+	}
+	joined := string(b)
+	out := make([]string, n)
+	start := 0
+	for i := range out {
+		out[i] = joined[start:end[i]]
+		start = end[i]
 	}
-	nhLen := int(data[3])
+	return out
+}
 
-	attrs.MPReachAFI = afi
-	offset := 4
+// appendCommunity appends a standard community (RFC 1997) as "asn:value".
+func appendCommunity(dst, c []byte) []byte {
+	dst = strconv.AppendUint(dst, uint64(binary.BigEndian.Uint16(c[0:2])), 10)
+	dst = append(dst, ':')
+	return strconv.AppendUint(dst, uint64(binary.BigEndian.Uint16(c[2:4])), 10)
+}
 
-	if offset+nhLen > len(data) {
-		return
-	}
+// appendLargeCommunity appends a large community (RFC 8092) as
+// "global:data1:data2".
+func appendLargeCommunity(dst, c []byte) []byte {
+	dst = strconv.AppendUint(dst, uint64(binary.BigEndian.Uint32(c[0:4])), 10)
+	dst = append(dst, ':')
+	dst = strconv.AppendUint(dst, uint64(binary.BigEndian.Uint32(c[4:8])), 10)
+	dst = append(dst, ':')
+	return strconv.AppendUint(dst, uint64(binary.BigEndian.Uint32(c[8:12])), 10)
+}
 
-	// Parse next-hop based on length.
-	nhData := data[offset : offset+nhLen]
-	switch nhLen {
-	case 4:
-		attrs.MPReachNexthop = net.IP(nhData).String()
-	case 16:
-		attrs.MPReachNexthop = net.IP(nhData).String()
-	case 32:
-		// Global + link-local; use global.
-		attrs.MPReachNexthop = net.IP(nhData[:16]).String()
-	}
-	// nhLen is validated implicitly by the switch above; unrecognized
-	// lengths are silently skipped (Nexthop left empty).
-	if attrs.Nexthop == "" {
-		attrs.Nexthop = attrs.MPReachNexthop
+// appendIPv4 appends a 4-octet address, e.g. a cluster ID, in dotted-quad.
+func appendIPv4(dst, addr []byte) []byte {
+	return netip.AddrFrom4([4]byte(addr)).AppendTo(dst)
+}
+
+// DecodeAggregator decodes an AGGREGATOR attribute, whose ASN is 2 or 4
+// octets depending on the session; the attribute length tells them apart. A
+// 2-octet AGGREGATOR carrying AS_TRANS is replaced by as4Data, the
+// AS4_AGGREGATOR attribute, if present (RFC 6793 §4.2.3). Returns a nil ASN
+// if data is malformed.
+func DecodeAggregator(data, as4Data []byte) (asn *uint32, address string) {
+	var v uint32
+	var addr []byte
+	switch len(data) {
+	case 6:
+		v = uint32(binary.BigEndian.Uint16(data[0:2]))
+		addr = data[2:6]
+		if v == ASTrans && len(as4Data) == 8 {
+			v = binary.BigEndian.Uint32(as4Data[0:4])
+			addr = as4Data[4:8]
+		}
+	case 8:
+		v = binary.BigEndian.Uint32(data[0:4])
+		addr = data[4:8]
+	default:
+		return nil, ""
 	}
-	offset += nhLen
+	return &v, net.IP(addr).String()
+}
 
-	// Skip SNPA entries (RFC 4760: 1-byte count, then N x {1-byte len, len bytes}).
-	if offset >= len(data) {
-		return
+// mpNexthop decodes an MP_REACH_NLRI next hop: one IPv4 or IPv6 address,
+// or an IPv6 global and link-local pair (RFC 2545 §3). For SAFI 128 each
+// address is prefixed by an all-zero Route Distinguisher (RFC 4364 §4.3.2,
+// RFC 4659 §3.2.1). Unnumbered peers send an unspecified global address,
+// or a link-local address alone; the link-local address is then used as
+// the global one too. Unrecognized lengths yield no next hop.
+func mpNexthop(nh []byte, hasRD bool) (global, linkLocal netip.Addr, ipv6 bool) {
+	rdLen := 0
+	if hasRD {
+		rdLen = RDLen
 	}
-	snpaCount := int(data[offset])
-	offset++
-	for i := 0; i < snpaCount; i++ {
-		if offset >= len(data) {
-			return
+	// IPv4-mapped addresses, e.g. of IPv6 over an IPv4 MPLS core
+	// (RFC 4798), are unmapped.
+	switch len(nh) {
+	case rdLen + 4:
+		return netip.AddrFrom4([4]byte(nh[rdLen:])), netip.Addr{}, false
+	case rdLen + 16:
+		addr := netip.AddrFrom16([16]byte(nh[rdLen:])).Unmap()
+		if addr.IsLinkLocalUnicast() {
+			return addr, addr, true
 		}
-		snpaLen := int(data[offset])
-		offset++
-		// SNPA length is in semi-octets; byte length = (snpaLen + 1) / 2
-		snpaByteLen := (snpaLen + 1) / 2
-		if offset+snpaByteLen > len(data) {
-			return
+		return addr, netip.Addr{}, true
+	case 2 * (rdLen + 16):
+		addr := netip.AddrFrom16([16]byte(nh[rdLen : rdLen+16])).Unmap()
+		ll := netip.AddrFrom16([16]byte(nh[2*rdLen+16:])).Unmap()
+		if addr.IsUnspecified() {
+			addr = ll
 		}
-		offset += snpaByteLen
+		return addr, ll, true
 	}
+	return netip.Addr{}, netip.Addr{}, false
+}
 
-	// Parse NLRI.
-	if v := afiToVersion(afi); v != 0 {
-		attrs.MPReachNLRI, _ = parsePrefixes(data[offset:], v, hasAddPath)
-	}
+// mpRoutes are the MP_REACH_NLRI or MP_UNREACH_NLRI routes of the EVPN,
+// BGP-LS, SR Policy and Flow Specification families, which are not read
+// with an NLRIReader.
+type mpRoutes struct {
+	evpn     []EVPNRoute
+	flowSpec []FlowSpecRule
+	ls       []LSRoute
+	srPolicy []SRPolicy
 }
 
-func parseMPUnreachNLRI(data []byte, attrs *PathAttributes, hasAddPath bool) {
-	if len(data) < 3 {
-		return
-	}
+func (r *mpRoutes) len() int {
+	return len(r.evpn) + len(r.flowSpec) + len(r.ls) + len(r.srPolicy)
+}
 
-	afi := binary.BigEndian.Uint16(data[0:2])
-	safi := data[2]
-	if safi != SAFIUnicast {
-		return // skip non-unicast AFI/SAFI silently
+// mpReachRoutes decodes the MP_REACH_NLRI routes of the families without
+// an NLRIReader. The routes decoded before an error are kept.
+func (d *Decoder) mpReachRoutes() mpRoutes {
+	m := &d.Attrs.MPReach
+	if !d.Attrs.Has(AttrTypeMPReachNLRI) || !supportedSAFI(m.SAFI) {
+		return mpRoutes{}
 	}
-
-	attrs.MPUnreachAFI = afi
-	attrs.MPUnreachNLRI, _ = parsePrefixes(data[3:], afiToVersion(afi), hasAddPath)
+	return d.decodeMPRoutes(AttrTypeMPReachNLRI, m.AFI, m.SAFI, m.NLRI)
 }
 
-func parsePrefixes(data []byte, ipVersion int, hasAddPath bool) ([]PrefixInfo, error) {
-	var prefixes []PrefixInfo
-	offset := 0
-
-	for offset < len(data) {
-		var pathID int64
-		if hasAddPath {
-			if offset+4 > len(data) {
-				return prefixes, fmt.Errorf("bgp: prefix data truncated at offset %d", offset)
-			}
-			pathID = int64(binary.BigEndian.Uint32(data[offset : offset+4]))
-			offset += 4
-		}
-
-		if offset >= len(data) {
-			return prefixes, fmt.Errorf("bgp: prefix data truncated at offset %d", offset)
-		}
-
-		prefixLen := int(data[offset])
-		offset++
-
-		// Reject prefix lengths that exceed the AFI maximum.
-		maxBits := maxIPLen(ipVersion) * 8
-		if prefixLen > maxBits {
-			return prefixes, fmt.Errorf("bgp: prefix data truncated at offset %d", offset)
-		}
-
-		// Number of bytes needed for the prefix.
-		byteLen := (prefixLen + 7) / 8
-		if offset+byteLen > len(data) {
-			return prefixes, fmt.Errorf("bgp: prefix data truncated at offset %d", offset)
-		}
-
-		prefixBytes := make([]byte, maxIPLen(ipVersion))
-		copy(prefixBytes, data[offset:offset+byteLen])
-		offset += byteLen
-
-		var ip net.IP
-		if ipVersion == 4 {
-			ip = net.IP(prefixBytes[:4])
-		} else {
-			ip = net.IP(prefixBytes[:16])
-		}
+// mpUnreachRoutes is mpReachRoutes for MP_UNREACH_NLRI.
+func (d *Decoder) mpUnreachRoutes() mpRoutes {
+	m := &d.Attrs.MPUnreach
+	if !d.Attrs.Has(AttrTypeMPUnreachNLRI) || !supportedSAFI(m.SAFI) {
+		return mpRoutes{}
+	}
+	return d.decodeMPRoutes(AttrTypeMPUnreachNLRI, m.AFI, m.SAFI, m.NLRI)
+}
 
-		prefixes = append(prefixes, PrefixInfo{
-			Prefix: fmt.Sprintf("%s/%d", ip.String(), prefixLen),
-			PathID: pathID,
-		})
+// decodeMPRoutes decodes the NLRI of the attribute typeCode, recording an
+// error in d.Warnings. EVPN label fields are only kept for announcements.
+func (d *Decoder) decodeMPRoutes(typeCode uint8, afi uint16, safi uint8, nlri []byte) mpRoutes {
+	var r mpRoutes
+	var err error
+	addPath := d.addPath(afi, safi)
+	switch v := afiToVersion(afi); {
+	case afi == AFIL2VPN:
+		r.evpn, err = parseEVPNNLRI(nlri, addPath, typeCode == AttrTypeMPReachNLRI)
+	case afi == AFIBGPLS:
+		r.ls, err = parseLSNLRI(nlri, addPath)
+	case safi == SAFISRPolicy:
+		r.srPolicy, err = parseSRPolicyNLRI(nlri, addPath)
+	case v != 0 && isFlowSpec(safi):
+		r.flowSpec, err = parseFlowSpecNLRI(nlri, v, addPath, safi == SAFIFlowSpecVPN)
 	}
+	if err != nil {
+		d.malformed(typeCode, "%v", err)
+	}
+	return r
+}
 
-	return prefixes, nil
+// supportedSAFI reports whether NLRI of safi are decoded into route events.
+func supportedSAFI(safi uint8) bool {
+	return safi == SAFIUnicast || safi == SAFILabeledUnicast || safi == SAFIMPLSVPN || safi == SAFIEVPN ||
+		safi == SAFIBGPLS || safi == SAFISRPolicy || isFlowSpec(safi)
 }
 
 func afiToVersion(afi uint16) int {
@@ -371,35 +357,3 @@ func afiToVersion(afi uint16) int {
 		return 0 // unsupported AFI
 	}
 }
-
-func maxIPLen(version int) int {
-	if version == 4 {
-		return 4
-	}
-	return 16
-}
-
-// OriginASN extracts the origin AS number (last ASN) from a space-delimited
-// AS path string. Returns nil if the path is empty or ends with an AS_SET
-// (e.g. "{64497,64498}").
-func OriginASN(asPath string) *int {
-	asPath = strings.TrimSpace(asPath)
-	if asPath == "" {
-		return nil
-	}
-
-	fields := strings.Fields(asPath)
-	last := fields[len(fields)-1]
-
-	// AS_SET at the end → origin is ambiguous.
-	if strings.HasPrefix(last, "{") {
-		return nil
-	}
-
-	var asn int
-	_, err := fmt.Sscanf(last, "%d", &asn)
-	if err != nil {
-		return nil
-	}
-	return &asn
-}
@@ -0,0 +1,121 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// benchPrefixes is the number of prefixes per UPDATE in the benchmarks,
+// typical of a full-table transfer.
+const benchPrefixes = 200
+
+// benchAttrs builds the path attributes of a typical Internet route: a
+// 4-octet AS_PATH of 5 ASNs, MED, LOCAL_PREF, 4 communities, a route
+// target and a large community.
+func benchAttrs() []byte {
+	b := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	b = append(b, buildPathAttr(0x40, AttrTypeASPath, asSeg(4, ASPathSegmentSequence, 64496, 3356, 1299, 174, 65551))...)
+	b = append(b, buildPathAttr(0x80, AttrTypeMED, []byte{0, 0, 0, 10})...)
+	b = append(b, buildPathAttr(0x40, AttrTypeLocalPref, []byte{0, 0, 0, 100})...)
+	var comms []byte
+	for _, c := range []uint32{64496<<16 | 100, 64496<<16 | 200, 3356<<16 | 2, 0xFFFFFF01} {
+		comms = binary.BigEndian.AppendUint32(comms, c)
+	}
+	b = append(b, buildPathAttr(0xC0, AttrTypeCommunity, comms)...)
+	b = append(b, buildPathAttr(0xC0, AttrTypeExtCommunity, []byte{0x00, 0x02, 0xFB, 0xF0, 0, 0, 0, 1})...)
+	b = append(b, buildPathAttr(0xC0, AttrTypeLargeCommunity, []byte{0, 0, 0xFB, 0xF0, 0, 0, 0, 1, 0, 0, 0, 2})...)
+	return b
+}
+
+// benchIPv4Update builds an UPDATE announcing benchPrefixes IPv4 /24s.
+func benchIPv4Update() []byte {
+	attrs := append(benchAttrs(), buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	var nlri []byte
+	for i := range benchPrefixes {
+		nlri = append(nlri, 24, 10, byte(i>>8), byte(i))
+	}
+	return buildBGPUpdate(nil, attrs, nlri)
+}
+
+// benchIPv6Update builds an UPDATE announcing benchPrefixes IPv6 /48s in
+// MP_REACH_NLRI.
+func benchIPv6Update() []byte {
+	mpReach := []byte{0, 2, SAFIUnicast, 16, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0}
+	for i := range benchPrefixes {
+		mpReach = append(mpReach, 48, 0x20, 0x01, 0x0d, 0xb8, byte(i>>8), byte(i))
+	}
+	attrs := append(benchAttrs(), buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	return buildBGPUpdate(nil, attrs, nil)
+}
+
+var benchUpdates = []struct {
+	name string
+	msg  []byte
+}{
+	{"ipv4", benchIPv4Update()},
+	{"ipv6", benchIPv6Update()},
+}
+
+func BenchmarkParseUpdate(b *testing.B) {
+	for _, bm := range benchUpdates {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bm.msg)))
+			for b.Loop() {
+				events, err := ParseUpdate(bm.msg, false)
+				if err != nil || len(events) != benchPrefixes {
+					b.Fatalf("got %d events, err %v", len(events), err)
+				}
+			}
+			b.ReportMetric(float64(b.N*benchPrefixes)/b.Elapsed().Seconds(), "prefixes/s")
+		})
+	}
+}
+
+// BenchmarkDecoder decodes the same UPDATEs as BenchmarkParseUpdate and
+// reads every prefix and the AS_PATH, without building strings. It does
+// not allocate.
+func BenchmarkDecoder(b *testing.B) {
+	for _, bm := range benchUpdates {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bm.msg)))
+			var d Decoder
+			var asPath []byte
+			for b.Loop() {
+				if err := d.Decode(bm.msg); err != nil {
+					b.Fatal(err)
+				}
+				asPath = d.Attrs.AppendASPath(asPath[:0])
+				if n := countPrefixes(d.NLRI()) + countPrefixes(d.MPReachPrefixes()); n != benchPrefixes {
+					b.Fatalf("got %d prefixes", n)
+				}
+			}
+			b.ReportMetric(float64(b.N*benchPrefixes)/b.Elapsed().Seconds(), "prefixes/s")
+		})
+	}
+}
+
+// BenchmarkAppendRoutes decodes the same UPDATEs into Routes, as the ingest
+// pipelines do: the prefixes and attributes are rendered later, by the
+// writers. The routes of each UPDATE and the attributes they share are
+// allocated once.
+func BenchmarkAppendRoutes(b *testing.B) {
+	for _, bm := range benchUpdates {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bm.msg)))
+			var d Decoder
+			for b.Loop() {
+				if err := d.Decode(bm.msg); err != nil {
+					b.Fatal(err)
+				}
+				routes, err := d.AppendRoutes(nil)
+				if err != nil || len(routes) != benchPrefixes {
+					b.Fatalf("got %d routes, err %v", len(routes), err)
+				}
+			}
+			b.ReportMetric(float64(b.N*benchPrefixes)/b.Elapsed().Seconds(), "prefixes/s")
+		})
+	}
+}
@@ -0,0 +1,588 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+)
+
+// Decoder decodes BGP UPDATE messages in place. Path attributes are
+// validated (RFC 7606) and decoded into Attrs, whose variable-length
+// attributes refer to the message, and the NLRI are read as netip.Prefix
+// values with an NLRIReader. Decoding an UPDATE does not allocate once the
+// Decoder is warm; strings are only built by the caller. AppendRoutes
+// collects an UPDATE's routes from a Decoder, and RenderEvents and
+// UpdateAttrs.Render build the strings.
+//
+// The zero Decoder decodes UPDATEs of a session whose capabilities are
+// unknown, without Add-Path. A Decoder is meant to be reused; the results
+// of Decode are valid until the next call and while the message is not
+// modified.
+type Decoder struct {
+	// AddPath, MultiLabel and ExtendedNextHop describe the session. If
+	// nil, NLRI carry no Path Identifier, label stacks are read up to the
+	// bottom-of-stack bit and IPv6 next hops are accepted for IPv4 NLRI.
+	AddPath         AddPathFunc
+	MultiLabel      MultiLabelFunc
+	ExtendedNextHop ExtendedNextHopFunc
+	// ASNWidth is the AS number width of AS_PATH and AGGREGATOR.
+	ASNWidth ASNWidth
+
+	// Attrs are the path attributes of the last UPDATE decoded.
+	Attrs UpdateAttrs
+	// Warnings are the errors found in the path attributes and the
+	// action RFC 7606 prescribes for each. Errors in the NLRI fields are
+	// reported by the NLRIReaders.
+	Warnings []ParseWarning
+
+	withdrawn []byte
+	nlri      []byte
+}
+
+// NewSessionDecoder returns a Decoder for the UPDATEs of a BMP-monitored
+// session, using the Add-Path, Multiple Labels, Extended Next Hop and
+// 4-octet AS state negotiated in either direction.
+// adjRIBOut selects the router→peer direction (RFC 8671 Adj-RIB-Out);
+// otherwise the UPDATEs are those the router received from the peer.
+func NewSessionDecoder(s *Session, adjRIBOut bool) *Decoder {
+	families, labelFamilies, nexthopFamilies := s.AddPathRX, s.MultiLabelRX, s.ExtendedNextHopRX
+	if adjRIBOut {
+		families, labelFamilies, nexthopFamilies = s.AddPathTX, s.MultiLabelTX, s.ExtendedNextHopTX
+	}
+	asnWidth := ASNWidth4
+	if !s.FourOctetAS {
+		asnWidth = ASNWidth2
+	}
+	return &Decoder{
+		AddPath: func(afi uint16, safi uint8) bool {
+			return hasFamily(families, AFISAFI{AFI: afi, SAFI: safi})
+		},
+		MultiLabel: func(afi uint16, safi uint8) bool {
+			return hasFamily(labelFamilies, AFISAFI{AFI: afi, SAFI: safi})
+		},
+		ExtendedNextHop: func(afi uint16, safi uint8) bool {
+			return hasFamily(nexthopFamilies, AFISAFI{AFI: afi, SAFI: safi})
+		},
+		ASNWidth: asnWidth,
+	}
+}
+
+func (d *Decoder) addPath(afi uint16, safi uint8) bool {
+	return d.AddPath != nil && d.AddPath(afi, safi)
+}
+
+func (d *Decoder) multiLabel(afi uint16, safi uint8) bool {
+	return d.MultiLabel == nil || d.MultiLabel(afi, safi)
+}
+
+func (d *Decoder) extendedNextHop(afi uint16, safi uint8) bool {
+	return d.ExtendedNextHop == nil || d.ExtendedNextHop(afi, safi)
+}
+
+// Decode decodes a BGP UPDATE message, including its 19-byte header. It
+// fails only if the message cannot be split into its fields; malformed
+// path attributes are recorded in Warnings.
+func (d *Decoder) Decode(msg []byte) error {
+	if len(msg) < BGPHeaderSize {
+		return fmt.Errorf("bgp: update too short (%d bytes)", len(msg))
+	}
+	if msg[18] != BGPMsgTypeUpdate {
+		return fmt.Errorf("bgp: message type %d is not an UPDATE", msg[18])
+	}
+	return d.decodePayload(msg[BGPHeaderSize:])
+}
+
+func (d *Decoder) decodePayload(data []byte) error {
+	d.withdrawn, d.nlri = nil, nil
+	d.Warnings = d.Warnings[:0]
+	if len(data) < 4 {
+		return fmt.Errorf("bgp: update payload too short (%d bytes)", len(data))
+	}
+
+	offset := 0
+
+	// Withdrawn routes length.
+	withdrawnLen := int(binary.BigEndian.Uint16(data[offset : offset+2]))
+	offset += 2
+
+	if offset+withdrawnLen > len(data) {
+		return fmt.Errorf("bgp: withdrawn length %d exceeds data", withdrawnLen)
+	}
+	withdrawn := data[offset : offset+withdrawnLen]
+	offset += withdrawnLen
+
+	// Total path attribute length.
+	if offset+2 > len(data) {
+		return fmt.Errorf("bgp: no room for path attr length")
+	}
+	totalPathAttrLen := int(binary.BigEndian.Uint16(data[offset : offset+2]))
+	offset += 2
+
+	if offset+totalPathAttrLen > len(data) {
+		return fmt.Errorf("bgp: path attr length %d exceeds data", totalPathAttrLen)
+	}
+
+	d.withdrawn, d.nlri = withdrawn, data[offset+totalPathAttrLen:]
+	d.decodeAttrs(data[offset:offset+totalPathAttrLen], len(d.nlri) > 0)
+	return nil
+}
+
+// Withdrawn returns a reader of the IPv4 unicast Withdrawn Routes.
+func (d *Decoder) Withdrawn() NLRIReader {
+	return newNLRIReader(d.withdrawn, 4, d.addPath(AFIIPv4, SAFIUnicast), labelsNone, false)
+}
+
+// NLRI returns a reader of the IPv4 unicast NLRI, which the path
+// attributes apply to.
+func (d *Decoder) NLRI() NLRIReader {
+	return newNLRIReader(d.nlri, 4, d.addPath(AFIIPv4, SAFIUnicast), labelsNone, false)
+}
+
+// MPReachPrefixes returns a reader of the MP_REACH_NLRI routes of the IPv4
+// and IPv6 unicast, labeled unicast and VPN families. It reads nothing for
+// other families, whose NLRI are in Attrs.MPReach.
+func (d *Decoder) MPReachPrefixes() NLRIReader {
+	m := &d.Attrs.MPReach
+	if !d.Attrs.Has(AttrTypeMPReachNLRI) || !prefixFamily(m.AFI, m.SAFI) {
+		return NLRIReader{}
+	}
+	labels := labelsNone
+	if m.SAFI != SAFIUnicast {
+		labels = labelsSingle
+		if d.multiLabel(m.AFI, m.SAFI) {
+			labels = labelsStack
+		}
+	}
+	return newNLRIReader(m.NLRI, afiToVersion(m.AFI), d.addPath(m.AFI, m.SAFI), labels, m.SAFI == SAFIMPLSVPN)
+}
+
+// MPUnreachPrefixes is MPReachPrefixes for MP_UNREACH_NLRI.
+func (d *Decoder) MPUnreachPrefixes() NLRIReader {
+	m := &d.Attrs.MPUnreach
+	if !d.Attrs.Has(AttrTypeMPUnreachNLRI) || !prefixFamily(m.AFI, m.SAFI) {
+		return NLRIReader{}
+	}
+	// A labeled withdrawal carries a single label field whose value is
+	// ignored (RFC 8277 §2.4), whatever was negotiated.
+	labels := labelsNone
+	if m.SAFI != SAFIUnicast {
+		labels = labelsSingle
+	}
+	return newNLRIReader(m.NLRI, afiToVersion(m.AFI), d.addPath(m.AFI, m.SAFI), labels, m.SAFI == SAFIMPLSVPN)
+}
+
+// prefixFamily reports whether NLRI of the family are IP prefixes, read
+// with an NLRIReader.
+func prefixFamily(afi uint16, safi uint8) bool {
+	return afiToVersion(afi) != 0 && (safi == SAFIUnicast || safi == SAFILabeledUnicast || safi == SAFIMPLSVPN)
+}
+
+// UpdateAttrs are the path attributes of an UPDATE as decoded by a
+// Decoder. Fixed-size attributes are decoded; the others are their value
+// within the message. Attributes that are absent, or malformed and
+// discarded, leave their field zero and are not reported by Has.
+type UpdateAttrs struct {
+	Origin             uint8
+	ASPath             []byte // validated for the Decoder's ASNWidth
+	AS4Path            []byte
+	NextHop            netip.Addr
+	MED                uint32
+	LocalPref          uint32
+	Aggregator         []byte // 6 or 8 octets, for DecodeAggregator
+	AS4Aggregator      []byte
+	Communities        []byte // multiple of 4 octets
+	OriginatorID       netip.Addr
+	ClusterList        []byte // multiple of 4 octets
+	ExtCommunities     []byte // multiple of 8 octets
+	IPv6ExtCommunities []byte // multiple of 20 octets
+	LargeCommunities   []byte // multiple of 12 octets
+	OTC                uint32
+	LinkState          []byte // BGP-LS Attribute
+	PrefixSID          []byte
+	TunnelEncap        []byte
+	MPReach            MPReach
+	MPUnreach          MPUnreach
+
+	// Unknown are the other attributes, in message order.
+	Unknown []RawAttr
+
+	present  attrSet
+	asnWidth ASNWidth
+}
+
+// MPReach is a decoded MP_REACH_NLRI attribute (RFC 4760 §3). NLRI is
+// only set for the families decoded into route events.
+type MPReach struct {
+	AFI       uint16
+	SAFI      uint8
+	NextHop   netip.Addr // global next hop, or the link-local one if there is no global
+	NextHopLL netip.Addr // IPv6 link-local next hop (RFC 2545 §3), if any
+	NLRI      []byte
+}
+
+// MPUnreach is a decoded MP_UNREACH_NLRI attribute (RFC 4760 §4).
+type MPUnreach struct {
+	AFI  uint16
+	SAFI uint8
+	NLRI []byte
+}
+
+// RawAttr is a path attribute the Decoder does not decode.
+type RawAttr struct {
+	Flags uint8
+	Type  uint8
+	Value []byte
+}
+
+// Has reports whether the attribute of the given type is present and was
+// not discarded. A nil UpdateAttrs, that of a withdrawal, has none.
+func (a *UpdateAttrs) Has(typeCode uint8) bool {
+	return a != nil && a.present.has(typeCode)
+}
+
+// AppendASPath appends the AS_PATH to dst as rendered in
+// RouteEvent.ASPath: sequences as space-separated ASNs and sets as
+// "{a,b}", without confederation segments.
+func (a *UpdateAttrs) AppendASPath(dst []byte) []byte {
+	if !a.Has(AttrTypeASPath) {
+		return dst
+	}
+	width := a.asnWidth
+	if width == ASNWidthAuto {
+		width = detectASNWidth(a.ASPath, a.AS4Path != nil)
+	}
+	if width == ASNWidth2 && a.AS4Path != nil {
+		// Merging AS4_PATH is rare enough not to be worth doing in place.
+		return buildASPath(a.ASPath, a.AS4Path, a.Aggregator, width).AppendTo(dst)
+	}
+	asnLen := 4
+	if width == ASNWidth2 {
+		asnLen = 2
+	}
+
+	first := true
+	for data := a.ASPath; len(data) >= 2; {
+		segType, segLen := data[0], int(data[1])
+		data = data[2:]
+		if segLen*asnLen > len(data) {
+			break
+		}
+		if segType == ASPathSegmentSequence || segType == ASPathSegmentSet {
+			if !first {
+				dst = append(dst, ' ')
+			}
+			first = false
+			sep := byte(' ')
+			if segType == ASPathSegmentSet {
+				dst = append(dst, '{')
+				sep = ','
+			}
+			for i := range segLen {
+				if i > 0 {
+					dst = append(dst, sep)
+				}
+				var asn uint32
+				if asnLen == 2 {
+					asn = uint32(binary.BigEndian.Uint16(data[2*i:]))
+				} else {
+					asn = binary.BigEndian.Uint32(data[4*i:])
+				}
+				dst = strconv.AppendUint(dst, uint64(asn), 10)
+			}
+			if segType == ASPathSegmentSet {
+				dst = append(dst, '}')
+			}
+		}
+		data = data[segLen*asnLen:]
+	}
+	return dst
+}
+
+// ASPathSegments decodes the AS_PATH, merging in AS4_PATH for 2-octet
+// sessions (RFC 6793 §4.2.3). It returns nil if there is no AS_PATH.
+func (a *UpdateAttrs) ASPathSegments() ASPath {
+	if !a.Has(AttrTypeASPath) {
+		return nil
+	}
+	return buildASPath(a.ASPath, a.AS4Path, a.Aggregator, a.asnWidth)
+}
+
+// mandatoryAttrs are the well-known mandatory attributes of an UPDATE
+// announcing routes, whatever their family.
+var mandatoryAttrs = []uint8{AttrTypeOrigin, AttrTypeASPath}
+
+// attrSet is a set of path attribute type codes.
+type attrSet [8]uint32
+
+func (s *attrSet) add(typeCode uint8) {
+	s[typeCode>>5] |= 1 << (typeCode & 31)
+}
+
+func (s *attrSet) remove(typeCode uint8) {
+	s[typeCode>>5] &^= 1 << (typeCode & 31)
+}
+
+func (s *attrSet) has(typeCode uint8) bool {
+	return s[typeCode>>5]&(1<<(typeCode&31)) != 0
+}
+
+// decodeAttrs decodes the path attributes section of an UPDATE into
+// d.Attrs, recording malformed and missing attributes in d.Warnings.
+// hasNLRI reports whether the UPDATE's NLRI field is not empty.
+func (d *Decoder) decodeAttrs(data []byte, hasNLRI bool) {
+	d.Attrs = UpdateAttrs{Unknown: d.Attrs.Unknown[:0], asnWidth: d.ASNWidth}
+	d.Warnings = d.Warnings[:0]
+	a := &d.Attrs
+
+	var seen attrSet
+	offset, truncated := 0, false
+	for offset < len(data) {
+		// An attribute overrunning the path attributes leaves the rest
+		// unparseable (RFC 7606 §4).
+		if offset+2 > len(data) {
+			d.warn(TreatAsWithdraw, 0, "attribute header truncated at offset %d", offset)
+			truncated = true
+			break
+		}
+
+		flags := data[offset]
+		typeCode := data[offset+1]
+		offset += 2
+
+		// Attribute length: 1 byte or 2 bytes depending on Extended Length flag.
+		var attrLen int
+		if flags&0x10 != 0 { // Extended Length
+			if offset+2 > len(data) {
+				d.warn(TreatAsWithdraw, typeCode, "extended attribute length truncated")
+				truncated = true
+				break
+			}
+			attrLen = int(binary.BigEndian.Uint16(data[offset : offset+2]))
+			offset += 2
+		} else {
+			if offset+1 > len(data) {
+				d.warn(TreatAsWithdraw, typeCode, "attribute length truncated")
+				truncated = true
+				break
+			}
+			attrLen = int(data[offset])
+			offset++
+		}
+
+		if offset+attrLen > len(data) {
+			d.warn(TreatAsWithdraw, typeCode, "attribute data truncated (need %d, have %d)", attrLen, len(data)-offset)
+			truncated = true
+			break
+		}
+
+		attrData := data[offset : offset+attrLen]
+		offset += attrLen
+
+		// Repeated attributes other than MP_REACH_NLRI and
+		// MP_UNREACH_NLRI are discarded (RFC 7606 §3 g).
+		if seen.has(typeCode) {
+			if typeCode == AttrTypeMPReachNLRI || typeCode == AttrTypeMPUnreachNLRI {
+				d.warn(SessionReset, typeCode, "repeated attribute")
+			} else {
+				d.warn(AttributeDiscard, typeCode, "repeated attribute")
+			}
+			continue
+		}
+		seen.add(typeCode)
+
+		// An attribute with the wrong flags is discarded unless it must
+		// be decoded for its routes to be withdrawn.
+		if !d.checkAttrFlags(flags, typeCode) &&
+			typeCode != AttrTypeMPReachNLRI && typeCode != AttrTypeMPUnreachNLRI {
+			continue
+		}
+
+		if d.decodeAttr(flags, typeCode, attrData) {
+			a.present.add(typeCode)
+		}
+	}
+
+	// An UPDATE announcing routes without a well-known mandatory
+	// attribute has them withdrawn (RFC 7606 §3 d). NEXT_HOP is only
+	// mandatory for routes in the NLRI field (RFC 4760 §3). Attributes
+	// past a truncated one are unknown, and the routes withdrawn already.
+	if !truncated && (hasNLRI || seen.has(AttrTypeMPReachNLRI)) {
+		for _, typeCode := range mandatoryAttrs {
+			if !seen.has(typeCode) {
+				d.warn(TreatAsWithdraw, typeCode, "missing well-known mandatory attribute")
+			}
+		}
+		if hasNLRI && !seen.has(AttrTypeNextHop) {
+			d.warn(TreatAsWithdraw, AttrTypeNextHop, "missing well-known mandatory attribute")
+		}
+	}
+
+	if a.Has(AttrTypeASPath) && !validASPath(a.ASPath, d.ASNWidth) {
+		d.malformed(AttrTypeASPath, "segments do not fill the attribute")
+		a.ASPath = nil
+		a.present.remove(AttrTypeASPath)
+	}
+	if a.Has(AttrTypeAS4Path) && !validASPath(a.AS4Path, ASNWidth4) {
+		d.malformed(AttrTypeAS4Path, "segments do not fill the attribute")
+		a.AS4Path = nil
+		a.present.remove(AttrTypeAS4Path)
+	}
+}
+
+// decodeAttr decodes one path attribute into d.Attrs and reports whether
+// it is kept.
+func (d *Decoder) decodeAttr(flags, typeCode uint8, data []byte) bool {
+	a := &d.Attrs
+	switch typeCode {
+	case AttrTypeOrigin:
+		if !d.checkAttrLength(typeCode, data, 1, true) {
+			return false
+		}
+		a.Origin = data[0]
+		if _, ok := OriginValues[a.Origin]; !ok {
+			d.malformed(typeCode, "undefined value %d", a.Origin)
+		}
+	case AttrTypeASPath:
+		// Validated once all attributes are seen: the ASN width may have
+		// to be detected, and AS4_PATH may follow.
+		a.ASPath = data
+	case AttrTypeAS4Path:
+		a.AS4Path = data
+	case AttrTypeNextHop:
+		if !d.checkAttrLength(typeCode, data, 4, true) {
+			return false
+		}
+		a.NextHop = netip.AddrFrom4([4]byte(data))
+	case AttrTypeMED:
+		if !d.checkAttrLength(typeCode, data, 4, true) {
+			return false
+		}
+		a.MED = binary.BigEndian.Uint32(data)
+	case AttrTypeLocalPref:
+		if !d.checkAttrLength(typeCode, data, 4, true) {
+			return false
+		}
+		a.LocalPref = binary.BigEndian.Uint32(data)
+	case AttrTypeAtomicAggregate:
+		return d.checkAttrLength(typeCode, data, 0, true)
+	case AttrTypeAggregator:
+		if len(data) != 6 && len(data) != 8 {
+			d.malformed(typeCode, "length %d, want 6 or 8", len(data))
+			return false
+		}
+		a.Aggregator = data
+	case AttrTypeAS4Aggregator:
+		if !d.checkAttrLength(typeCode, data, 8, true) {
+			return false
+		}
+		a.AS4Aggregator = data
+	case AttrTypeCommunity:
+		if !d.checkAttrLength(typeCode, data, 4, false) {
+			return false
+		}
+		a.Communities = data
+	case AttrTypeOriginatorID:
+		if !d.checkAttrLength(typeCode, data, 4, true) {
+			return false
+		}
+		a.OriginatorID = netip.AddrFrom4([4]byte(data))
+	case AttrTypeClusterList:
+		if !d.checkAttrLength(typeCode, data, 4, false) {
+			return false
+		}
+		a.ClusterList = data
+	case AttrTypeMPReachNLRI:
+		return d.decodeMPReach(data)
+	case AttrTypeMPUnreachNLRI:
+		if len(data) < 3 {
+			d.malformed(typeCode, "length %d, want at least 3", len(data))
+			return false
+		}
+		a.MPUnreach = MPUnreach{AFI: binary.BigEndian.Uint16(data[0:2]), SAFI: data[2], NLRI: data[3:]}
+	case AttrTypeExtCommunity:
+		if !d.checkAttrLength(typeCode, data, 8, false) {
+			return false
+		}
+		a.ExtCommunities = data
+	case AttrTypeIPv6ExtCommunity:
+		if !d.checkAttrLength(typeCode, data, 20, false) {
+			return false
+		}
+		a.IPv6ExtCommunities = data
+	case AttrTypeLargeCommunity:
+		if !d.checkAttrLength(typeCode, data, 12, false) {
+			return false
+		}
+		a.LargeCommunities = data
+	case AttrTypeOTC:
+		if !d.checkAttrLength(typeCode, data, 4, true) {
+			return false
+		}
+		a.OTC = binary.BigEndian.Uint32(data)
+	case AttrTypeBGPLS:
+		a.LinkState = data
+	case AttrTypePrefixSID:
+		a.PrefixSID = data
+	case AttrTypeTunnelEncap:
+		a.TunnelEncap = data
+	default:
+		a.Unknown = append(a.Unknown, RawAttr{Flags: flags, Type: typeCode, Value: data})
+	}
+	return true
+}
+
+func (d *Decoder) decodeMPReach(data []byte) bool {
+	if len(data) < 5 {
+		d.malformed(AttrTypeMPReachNLRI, "length %d, want at least 5", len(data))
+		return false
+	}
+
+	m := &d.Attrs.MPReach
+	m.AFI = binary.BigEndian.Uint16(data[0:2])
+	m.SAFI = data[2]
+	if !supportedSAFI(m.SAFI) {
+		return true // other AFI/SAFIs are skipped silently
+	}
+	nhLen := int(data[3])
+	offset := 4
+
+	if offset+nhLen > len(data) {
+		d.malformed(AttrTypeMPReachNLRI, "next hop length %d overruns the attribute", nhLen)
+		return false
+	}
+
+	// The next hop applies to MP_REACH_NLRI only; NEXT_HOP stays with the
+	// IPv4 NLRI of the UPDATE. An IPv6 next hop for IPv4 NLRI (RFC 8950)
+	// is dropped unless Extended Next Hop was negotiated.
+	nh, ll, ipv6 := mpNexthop(data[offset:offset+nhLen], m.SAFI == SAFIMPLSVPN)
+	if !ipv6 || m.AFI != AFIIPv4 || d.extendedNextHop(m.AFI, m.SAFI) {
+		m.NextHop, m.NextHopLL = nh, ll
+	}
+	offset += nhLen
+
+	// Skip SNPA entries (RFC 4760: 1-byte count, then N x {1-byte len, len bytes}).
+	if offset >= len(data) {
+		d.malformed(AttrTypeMPReachNLRI, "reserved octet missing")
+		return false
+	}
+	snpaCount := int(data[offset])
+	offset++
+	for range snpaCount {
+		if offset >= len(data) {
+			d.malformed(AttrTypeMPReachNLRI, "SNPA truncated")
+			return false
+		}
+		// SNPA length is in semi-octets; byte length = (snpaLen + 1) / 2
+		snpaByteLen := (int(data[offset]) + 1) / 2
+		offset++
+		if offset+snpaByteLen > len(data) {
+			d.malformed(AttrTypeMPReachNLRI, "SNPA truncated")
+			return false
+		}
+		offset += snpaByteLen
+	}
+
+	m.NLRI = data[offset:]
+	return true
+}
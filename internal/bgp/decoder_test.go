@@ -0,0 +1,148 @@
+package bgp
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestDecoder_Attributes(t *testing.T) {
+	pathAttrs := buildPathAttr(0x40, AttrTypeOrigin, []byte{2})
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeASPath,
+		append(asSeg(4, ASPathSegmentSequence, 64496, 4200000000), asSeg(4, ASPathSegmentSet, 64497, 64498)...))...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMED, []byte{0, 0, 0, 50})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeCommunity, []byte{0xFB, 0xF0, 0, 100})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, 99, []byte{0xAB})...)
+
+	var d Decoder
+	if err := d.Decode(buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a := &d.Attrs
+	if !a.Has(AttrTypeOrigin) || a.Origin != 2 {
+		t.Errorf("expected origin 2, got %d", a.Origin)
+	}
+	if got := string(a.AppendASPath(nil)); got != "64496 4200000000 {64497,64498}" {
+		t.Errorf("unexpected AS path %q", got)
+	}
+	if a.NextHop != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("unexpected next hop %s", a.NextHop)
+	}
+	if !a.Has(AttrTypeMED) || a.MED != 50 {
+		t.Errorf("expected MED 50, got %d", a.MED)
+	}
+	if a.Has(AttrTypeLocalPref) {
+		t.Error("expected no LOCAL_PREF")
+	}
+	if len(a.Communities) != 4 {
+		t.Errorf("expected 1 community, got %x", a.Communities)
+	}
+	if len(a.Unknown) != 1 || a.Unknown[0].Type != 99 || a.Unknown[0].Flags != 0xC0 {
+		t.Errorf("unexpected unknown attributes %+v", a.Unknown)
+	}
+	if len(d.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", d.Warnings)
+	}
+
+	// A second UPDATE leaves nothing of the first.
+	if err := d.Decode(buildBGPUpdate([]byte{24, 10, 0, 0}, nil, nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.Has(AttrTypeMED) || a.Has(AttrTypeASPath) || len(a.Unknown) != 0 || a.NextHop.IsValid() {
+		t.Errorf("expected no attributes, got %+v", *a)
+	}
+	r := d.Withdrawn()
+	if !r.Next() || r.Prefix() != netip.MustParsePrefix("10.0.0.0/24") || r.Next() {
+		t.Errorf("expected withdrawal of 10.0.0.0/24")
+	}
+}
+
+func TestDecoder_Warnings(t *testing.T) {
+	pathAttrs := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2})
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeAtomicAggregate, []byte{1})...)
+
+	var d Decoder
+	if err := d.Decode(buildBGPUpdate(nil, pathAttrs, nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Attrs.Has(AttrTypeNextHop) || d.Attrs.Has(AttrTypeAtomicAggregate) {
+		t.Error("expected the malformed attributes to be dropped")
+	}
+	if len(d.Warnings) != 2 || d.Warnings[0].Action != TreatAsWithdraw || d.Warnings[1].Action != AttributeDiscard {
+		t.Errorf("unexpected warnings %v", d.Warnings)
+	}
+}
+
+func TestDecoder_NotUpdate(t *testing.T) {
+	msg := buildBGPUpdate(nil, nil, nil)
+	msg[18] = BGPMsgTypeNotification
+	var d Decoder
+	if err := d.Decode(msg); err == nil {
+		t.Error("expected an error for a NOTIFICATION")
+	}
+}
+
+func TestDecoder_MPReachPrefixes(t *testing.T) {
+	// VPN-IPv4 with Add-Path: path ID 7, label 100, RD 65000:1, 10.1.0.0/16.
+	mpReach := []byte{0, 1, SAFIMPLSVPN, 12, 0, 0, 0, 0, 0, 0, 0, 0, 192, 0, 2, 1, 0}
+	mpReach = append(mpReach, 0, 0, 0, 7, 24+64+16)
+	mpReach = append(mpReach, labelField(100, true)...)
+	mpReach = append(mpReach, 0, 0, 0xFD, 0xE8, 0, 0, 0, 1, 10, 1)
+	msg := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach), nil)
+
+	d := Decoder{AddPath: uniformAddPath(true)}
+	if err := d.Decode(msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m := d.Attrs.MPReach; m.AFI != AFIIPv4 || m.SAFI != SAFIMPLSVPN || m.NextHop != netip.MustParseAddr("192.0.2.1") {
+		t.Errorf("unexpected MP_REACH_NLRI %+v", m)
+	}
+	r := d.MPReachPrefixes()
+	if !r.Next() {
+		t.Fatalf("expected a prefix, got error %v", r.Err())
+	}
+	if r.Prefix() != netip.MustParsePrefix("10.1.0.0/16") || r.PathID() != 7 {
+		t.Errorf("unexpected prefix %s path ID %d", r.Prefix(), r.PathID())
+	}
+	if labels := r.AppendLabels(nil); !slices.Equal(labels, []uint32{100}) {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	if rd := FormatRD(r.RD()); rd != "65000:1" {
+		t.Errorf("unexpected RD %s", rd)
+	}
+	if r.Next() || r.Err() != nil {
+		t.Errorf("expected end of NLRI, got error %v", r.Err())
+	}
+}
+
+func TestNLRIReader_Truncated(t *testing.T) {
+	r := newNLRIReader([]byte{24, 10, 0, 0, 16, 10}, 4, false, labelsNone, false)
+	if !r.Next() || r.Prefix() != netip.MustParsePrefix("10.0.0.0/24") {
+		t.Fatal("expected the first prefix")
+	}
+	if r.Next() || r.Err() == nil {
+		t.Error("expected an error for the truncated prefix")
+	}
+	if r.Next() {
+		t.Error("expected no prefix after an error")
+	}
+}
+
+func TestDecoder_Allocs(t *testing.T) {
+	msg := benchIPv6Update()
+	var d Decoder
+	var asPath []byte
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := d.Decode(msg); err != nil {
+			t.Fatal(err)
+		}
+		asPath = d.Attrs.AppendASPath(asPath[:0])
+		if countPrefixes(d.MPReachPrefixes()) != benchPrefixes {
+			t.Fatal("unexpected prefix count")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
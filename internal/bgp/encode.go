@@ -0,0 +1,909 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Maximum BGP message sizes (RFC 4271 §4, RFC 8654).
+const (
+	MaxMessageLen         = 4096
+	MaxExtendedMessageLen = 65535
+)
+
+// attrFlagExtendedLength is the Extended Length bit of the attribute
+// flags: the attribute length is two octets.
+const attrFlagExtendedLength = 0x10
+
+// Encoder encodes RouteEvents into BGP UPDATE messages that ParseUpdate
+// decodes back into the same events. It is meant for tests, synthetic
+// load and export, not for speaking BGP.
+//
+// The zero Encoder encodes UPDATEs for a session with 4-octet AS and
+// without Add-Path or Extended Messages.
+type Encoder struct {
+	// AddPath reports whether NLRI of a family carry a Path Identifier.
+	// If nil, none do.
+	AddPath AddPathFunc
+	// ASNWidth is the AS number width of AS_PATH and AGGREGATOR. With
+	// ASNWidth2, 4-octet ASNs are replaced by AS_TRANS and carried in
+	// AS4_PATH and AS4_AGGREGATOR (RFC 6793 §4.2.2); otherwise 4-octet
+	// ASNs are encoded. A receiver ignores AS4_PATH when AGGREGATOR holds
+	// a 2-octet ASN (§4.2.3), so such a path is decoded with AS_TRANS.
+	ASNWidth ASNWidth
+	// ExtendedMessage allows UPDATEs of up to MaxExtendedMessageLen
+	// octets (RFC 8654).
+	ExtendedMessage bool
+}
+
+// NewSessionEncoder returns an Encoder for the UPDATEs of a BMP-monitored
+// session, the counterpart of NewSessionDecoder.
+func NewSessionEncoder(s *Session, adjRIBOut bool) *Encoder {
+	families := s.AddPathRX
+	if adjRIBOut {
+		families = s.AddPathTX
+	}
+	asnWidth := ASNWidth4
+	if !s.FourOctetAS {
+		asnWidth = ASNWidth2
+	}
+	return &Encoder{
+		AddPath: func(afi uint16, safi uint8) bool {
+			return hasFamily(families, AFISAFI{AFI: afi, SAFI: safi})
+		},
+		ASNWidth:        asnWidth,
+		ExtendedMessage: s.ExtendedMessage,
+	}
+}
+
+// EncodeUpdate encodes events into one UPDATE, with Path Identifiers on
+// every family if hasAddPath is set. See Encoder.AppendUpdate.
+func EncodeUpdate(events []*RouteEvent, hasAddPath bool) ([]byte, error) {
+	e := Encoder{AddPath: uniformAddPath(hasAddPath)}
+	return e.AppendUpdate(nil, events)
+}
+
+func (e *Encoder) addPath(afi uint16, safi uint8) bool {
+	return e.AddPath != nil && e.AddPath(afi, safi)
+}
+
+// AppendUpdate appends an UPDATE carrying events to dst. The announcements
+// share one set of path attributes, taken from the first of them, as the
+// events ParseUpdate returns for an UPDATE do. IPv4 unicast routes with an
+// IPv4 next hop go in the Withdrawn Routes and NLRI fields; the others in
+// MP_UNREACH_NLRI and MP_REACH_NLRI, which hold one family each.
+//
+// The candidate path of an SR Policy announcement goes in a Tunnel
+// Encapsulation attribute unless its Attrs already hold one. ParseWarnings
+// are ignored. On error dst is returned unchanged.
+func (e *Encoder) AppendUpdate(dst []byte, events []*RouteEvent) ([]byte, error) {
+	start := len(dst)
+	out, err := e.appendUpdate(dst, events)
+	if err != nil {
+		return dst[:start], err
+	}
+	return out, nil
+}
+
+func (e *Encoder) appendUpdate(dst []byte, events []*RouteEvent) ([]byte, error) {
+	var announce *RouteEvent
+	var nlri, mpReach, mpUnreach []*RouteEvent
+	var nlriNexthop string
+	var reachFamily, unreachFamily AFISAFI
+
+	start := len(dst)
+	dst = appendHeader(dst, BGPMsgTypeUpdate)
+
+	// Withdrawn Routes.
+	withdrawnStart := len(dst)
+	dst = append(dst, 0, 0)
+	for _, ev := range events {
+		f, err := eventFamily(ev)
+		if err != nil {
+			return dst, err
+		}
+		switch {
+		case ev.Action == "D" && f == (AFISAFI{AFIIPv4, SAFIUnicast}):
+			if dst, err = e.appendPrefix(dst, f, ev, false); err != nil {
+				return dst, err
+			}
+		case ev.Action == "D":
+			if mpUnreach != nil && f != unreachFamily {
+				return dst, fmt.Errorf("bgp: withdrawals of %s and %s cannot share an update", unreachFamily, f)
+			}
+			unreachFamily = f
+			mpUnreach = append(mpUnreach, ev)
+		case ev.Action == "A":
+			if announce == nil {
+				announce = ev
+			}
+			if f == (AFISAFI{AFIIPv4, SAFIUnicast}) && !strings.Contains(ev.Nexthop, ":") {
+				if nlri == nil {
+					nlriNexthop = ev.Nexthop
+				}
+				nlri = append(nlri, ev)
+				continue
+			}
+			if mpReach != nil && f != reachFamily {
+				return dst, fmt.Errorf("bgp: announcements of %s and %s cannot share an update", reachFamily, f)
+			}
+			reachFamily = f
+			mpReach = append(mpReach, ev)
+		default:
+			return dst, fmt.Errorf("bgp: unknown route event action %q", ev.Action)
+		}
+	}
+	binary.BigEndian.PutUint16(dst[withdrawnStart:], uint16(len(dst)-withdrawnStart-2))
+
+	// Path Attributes. An UPDATE without announcements only carries
+	// MP_UNREACH_NLRI.
+	mp := func(dst []byte) ([]byte, error) {
+		var err error
+		if mpReach != nil {
+			if dst, err = e.appendMPReach(dst, reachFamily, mpReach); err != nil {
+				return dst, err
+			}
+		}
+		if mpUnreach != nil {
+			dst, err = e.appendMPUnreach(dst, unreachFamily, mpUnreach)
+		}
+		return dst, err
+	}
+	attrsStart := len(dst)
+	dst = append(dst, 0, 0)
+	var err error
+	if announce != nil {
+		a := announce.pathAttributes()
+		a.Nexthop = nlriNexthop
+		if p := announce.SRPolicy; p != nil && p.hasCandidatePath() && !hasTunnelEncap(a.Attrs) {
+			if a.tunnelEncap, err = appendSRPolicyTunnel(nil, p); err != nil {
+				return dst, err
+			}
+		}
+		dst, err = e.appendPathAttributes(dst, a, mp)
+	} else {
+		dst, err = mp(dst)
+	}
+	if err != nil {
+		return dst, err
+	}
+	binary.BigEndian.PutUint16(dst[attrsStart:], uint16(len(dst)-attrsStart-2))
+
+	// NLRI.
+	for _, ev := range nlri {
+		if dst, err = e.appendPrefix(dst, AFISAFI{AFIIPv4, SAFIUnicast}, ev, true); err != nil {
+			return dst, err
+		}
+	}
+	return e.endMessage(dst, start)
+}
+
+// AppendEndOfRIB appends the End-of-RIB marker of a family (RFC 4724 §2):
+// an empty UPDATE for IPv4 unicast, otherwise an UPDATE with an empty
+// MP_UNREACH_NLRI.
+func AppendEndOfRIB(dst []byte, afi uint16, safi uint8) []byte {
+	start := len(dst)
+	dst = appendHeader(dst, BGPMsgTypeUpdate)
+	if afi == AFIIPv4 && safi == SAFIUnicast {
+		dst = append(dst, 0, 0, 0, 0)
+	} else {
+		dst = append(dst, 0, 0, 0, 6, attrFlagOptional, AttrTypeMPUnreachNLRI, 3)
+		dst = binary.BigEndian.AppendUint16(dst, afi)
+		dst = append(dst, safi)
+	}
+	binary.BigEndian.PutUint16(dst[start+16:], uint16(len(dst)-start))
+	return dst
+}
+
+// AppendPathAttributes appends the path attributes of a, the inverse of
+// ParsePathAttributes, to dst. MP_REACH_NLRI and MP_UNREACH_NLRI are left
+// out: their routes are encoded from RouteEvents by AppendUpdate. On error
+// dst is returned unchanged.
+func (e *Encoder) AppendPathAttributes(dst []byte, a *PathAttributes) ([]byte, error) {
+	start := len(dst)
+	out, err := e.appendPathAttributes(dst, a, nil)
+	if err != nil {
+		return dst[:start], err
+	}
+	return out, nil
+}
+
+// appendPathAttributes appends the path attributes of a in type code
+// order, calling mp, if set, to append MP_REACH_NLRI and MP_UNREACH_NLRI.
+// Unknown attributes from a.Attrs come last.
+func (e *Encoder) appendPathAttributes(dst []byte, a *PathAttributes, mp func([]byte) ([]byte, error)) ([]byte, error) {
+	if a.Origin != "" {
+		origin, err := originCode(a.Origin)
+		if err != nil {
+			return dst, err
+		}
+		dst = appendAttr(dst, AttrTypeOrigin, []byte{origin})
+	}
+
+	path := a.ASPathSegments
+	if path == nil && a.ASPath != "" {
+		var err error
+		if path, err = ParseASPath(a.ASPath); err != nil {
+			return dst, err
+		}
+	}
+	var as4Path []byte
+	var err error
+	dst, as4Path, err = e.appendASPath(dst, path)
+	if err != nil {
+		return dst, err
+	}
+
+	if a.Nexthop != "" {
+		nh, err := parseIPv4(a.Nexthop, "next hop")
+		if err != nil {
+			return dst, err
+		}
+		dst = appendAttr(dst, AttrTypeNextHop, nh[:])
+	}
+	if a.MED != nil {
+		dst = appendAttr(dst, AttrTypeMED, binary.BigEndian.AppendUint32(nil, *a.MED))
+	}
+	if a.LocalPref != nil {
+		dst = appendAttr(dst, AttrTypeLocalPref, binary.BigEndian.AppendUint32(nil, *a.LocalPref))
+	}
+	if a.AtomicAggregate {
+		dst = appendAttr(dst, AttrTypeAtomicAggregate, nil)
+	}
+
+	var as4Aggregator []byte
+	if a.AggregatorASN != nil {
+		var addr [4]byte
+		if a.AggregatorAddress != "" {
+			if addr, err = parseIPv4(a.AggregatorAddress, "aggregator address"); err != nil {
+				return dst, err
+			}
+		}
+		asn := *a.AggregatorASN
+		var v []byte
+		if e.ASNWidth == ASNWidth2 {
+			if asn > 0xFFFF {
+				as4Aggregator = binary.BigEndian.AppendUint32(nil, asn)
+				as4Aggregator = append(as4Aggregator, addr[:]...)
+				asn = ASTrans
+			}
+			v = binary.BigEndian.AppendUint16(nil, uint16(asn))
+		} else {
+			v = binary.BigEndian.AppendUint32(nil, asn)
+		}
+		dst = appendAttr(dst, AttrTypeAggregator, append(v, addr[:]...))
+	}
+
+	if a.CommStd != nil {
+		v := make([]byte, 0, 4*len(a.CommStd))
+		for _, c := range a.CommStd {
+			hi, lo, ok := strings.Cut(c, ":")
+			start := len(v)
+			v = append(v, 0, 0, 0, 0)
+			if !ok || putUint(v[start:start+2], hi) != nil || putUint(v[start+2:], lo) != nil {
+				return dst, fmt.Errorf("bgp: invalid community %q", c)
+			}
+		}
+		dst = appendAttr(dst, AttrTypeCommunity, v)
+	}
+	if a.OriginatorID != "" {
+		id, err := parseIPv4(a.OriginatorID, "originator ID")
+		if err != nil {
+			return dst, err
+		}
+		dst = appendAttr(dst, AttrTypeOriginatorID, id[:])
+	}
+	if a.ClusterList != nil {
+		v := make([]byte, 0, 4*len(a.ClusterList))
+		for _, c := range a.ClusterList {
+			id, err := parseIPv4(c, "cluster ID")
+			if err != nil {
+				return dst, err
+			}
+			v = append(v, id[:]...)
+		}
+		dst = appendAttr(dst, AttrTypeClusterList, v)
+	}
+
+	if mp != nil {
+		if dst, err = mp(dst); err != nil {
+			return dst, err
+		}
+	}
+
+	var ext, ipv6Ext []byte
+	for _, c := range a.CommExt {
+		b, err := encodeExtCommunity(c)
+		if err != nil {
+			return dst, err
+		}
+		if len(b) == 20 {
+			ipv6Ext = append(ipv6Ext, b...)
+		} else {
+			ext = append(ext, b...)
+		}
+	}
+	if ext != nil {
+		dst = appendAttr(dst, AttrTypeExtCommunity, ext)
+	}
+	if as4Path != nil {
+		dst = appendAttr(dst, AttrTypeAS4Path, as4Path)
+	}
+	if as4Aggregator != nil {
+		dst = appendAttr(dst, AttrTypeAS4Aggregator, as4Aggregator)
+	}
+	if a.tunnelEncap != nil && !hasTunnelEncap(a.Attrs) {
+		dst = appendAttr(dst, AttrTypeTunnelEncap, a.tunnelEncap)
+	}
+	if ipv6Ext != nil {
+		dst = appendAttr(dst, AttrTypeIPv6ExtCommunity, ipv6Ext)
+	}
+	if a.LinkState != nil {
+		var start int
+		dst, start = beginAttr(dst, AttrTypeBGPLS)
+		if dst, err = appendLSAttribute(dst, a.LinkState); err != nil {
+			return dst, err
+		}
+		dst = endAttr(dst, start)
+	}
+	if a.CommLarge != nil {
+		v := make([]byte, 0, 12*len(a.CommLarge))
+		for _, c := range a.CommLarge {
+			f := strings.Split(c, ":")
+			start := len(v)
+			v = append(v, make([]byte, 12)...)
+			if len(f) != 3 || putUint(v[start:start+4], f[0]) != nil ||
+				putUint(v[start+4:start+8], f[1]) != nil || putUint(v[start+8:], f[2]) != nil {
+				return dst, fmt.Errorf("bgp: invalid large community %q", c)
+			}
+		}
+		dst = appendAttr(dst, AttrTypeLargeCommunity, v)
+	}
+	if a.OTC != nil {
+		dst = appendAttr(dst, AttrTypeOTC, binary.BigEndian.AppendUint32(nil, *a.OTC))
+	}
+	if a.PrefixSID != nil {
+		var start int
+		dst, start = beginAttr(dst, AttrTypePrefixSID)
+		if dst, err = appendPrefixSID(dst, a.PrefixSID); err != nil {
+			return dst, err
+		}
+		dst = endAttr(dst, start)
+	}
+
+	codes := make([]int, 0, len(a.Attrs))
+	for k := range a.Attrs {
+		code, err := strconv.ParseUint(k, 10, 8)
+		if err != nil {
+			return dst, fmt.Errorf("bgp: invalid attribute type %q", k)
+		}
+		codes = append(codes, int(code))
+	}
+	slices.Sort(codes)
+	for _, code := range codes {
+		v, err := hex.DecodeString(a.Attrs[strconv.Itoa(code)])
+		if err != nil {
+			return dst, fmt.Errorf("bgp: invalid value of attribute %d: %w", code, err)
+		}
+		dst = appendAttr(dst, uint8(code), v)
+	}
+	return dst, nil
+}
+
+// appendASPath appends the AS_PATH attribute, which announcements always
+// carry. With 2-octet ASNs, it also returns the AS4_PATH value if the path
+// has 4-octet ASNs. Segments longer than 255 ASNs are split.
+func (e *Encoder) appendASPath(dst []byte, path ASPath) ([]byte, []byte, error) {
+	appendSegments := func(dst []byte, asnLen int) ([]byte, error) {
+		for _, seg := range path {
+			asns := seg.ASNs
+			for len(asns) > 0 {
+				n := min(len(asns), 255)
+				if n < len(asns) && seg.Type != ASPathSegmentSequence {
+					return dst, fmt.Errorf("bgp: AS_SET of %d ASNs is too long", len(asns))
+				}
+				dst = append(dst, seg.Type, byte(n))
+				for _, asn := range asns[:n] {
+					if asnLen == 2 {
+						if asn > 0xFFFF {
+							asn = ASTrans
+						}
+						dst = binary.BigEndian.AppendUint16(dst, uint16(asn))
+					} else {
+						dst = binary.BigEndian.AppendUint32(dst, asn)
+					}
+				}
+				asns = asns[n:]
+			}
+		}
+		return dst, nil
+	}
+
+	asnLen := 4
+	if e.ASNWidth == ASNWidth2 {
+		asnLen = 2
+	}
+	var start int
+	var err error
+	dst, start = beginAttr(dst, AttrTypeASPath)
+	if dst, err = appendSegments(dst, asnLen); err != nil {
+		return dst, nil, err
+	}
+	dst = endAttr(dst, start)
+
+	if asnLen == 4 || !slices.ContainsFunc(path, func(seg ASPathSegment) bool {
+		return slices.ContainsFunc(seg.ASNs, func(asn uint32) bool { return asn > 0xFFFF })
+	}) {
+		return dst, nil, nil
+	}
+	as4Path, _ := appendSegments(nil, 4)
+	return dst, as4Path, nil
+}
+
+// appendMPReach appends an MP_REACH_NLRI attribute with the routes of
+// events, whose next hop is that of the first.
+func (e *Encoder) appendMPReach(dst []byte, f AFISAFI, events []*RouteEvent) ([]byte, error) {
+	var start int
+	dst, start = beginAttr(dst, AttrTypeMPReachNLRI)
+	dst = binary.BigEndian.AppendUint16(dst, f.AFI)
+	dst = append(dst, f.SAFI)
+
+	var nh, ll netip.Addr
+	var err error
+	if events[0].Nexthop != "" {
+		if nh, err = netip.ParseAddr(events[0].Nexthop); err != nil {
+			return dst, fmt.Errorf("bgp: invalid next hop %q", events[0].Nexthop)
+		}
+	}
+	if events[0].NexthopLL != "" {
+		if ll, err = netip.ParseAddr(events[0].NexthopLL); err != nil {
+			return dst, fmt.Errorf("bgp: invalid link-local next hop %q", events[0].NexthopLL)
+		}
+	}
+	dst = appendMPNexthop(dst, f, nh, ll)
+	dst = append(dst, 0) // Reserved
+
+	for _, ev := range events {
+		if dst, err = e.appendNLRI(dst, f, ev, true); err != nil {
+			return dst, err
+		}
+	}
+	return endAttr(dst, start), nil
+}
+
+// appendMPNexthop appends the length and next hop of MP_REACH_NLRI, the
+// inverse of mpNexthop: an IPv4 next hop of an IPv6 route is IPv4-mapped
+// (RFC 4798), and a link-local next hop different from the global one
+// follows it (RFC 2545 §3).
+func appendMPNexthop(dst []byte, f AFISAFI, nh, ll netip.Addr) []byte {
+	var addrs []netip.Addr
+	switch {
+	case !nh.IsValid():
+	case nh.Is4() && f.AFI == AFIIPv6:
+		addrs = append(addrs, netip.AddrFrom16(nh.As16()))
+	case nh.Is6() && ll.IsValid() && ll != nh:
+		addrs = append(addrs, nh, ll)
+	default:
+		addrs = append(addrs, nh)
+	}
+
+	lenAt := len(dst)
+	dst = append(dst, 0)
+	for _, addr := range addrs {
+		if f.SAFI == SAFIMPLSVPN {
+			dst = append(dst, make([]byte, RDLen)...)
+		}
+		dst = append(dst, addr.AsSlice()...)
+	}
+	dst[lenAt] = byte(len(dst) - lenAt - 1)
+	return dst
+}
+
+// appendMPUnreach appends an MP_UNREACH_NLRI attribute withdrawing the
+// routes of events.
+func (e *Encoder) appendMPUnreach(dst []byte, f AFISAFI, events []*RouteEvent) ([]byte, error) {
+	var start int
+	dst, start = beginAttr(dst, AttrTypeMPUnreachNLRI)
+	dst = binary.BigEndian.AppendUint16(dst, f.AFI)
+	dst = append(dst, f.SAFI)
+	var err error
+	for _, ev := range events {
+		if dst, err = e.appendNLRI(dst, f, ev, false); err != nil {
+			return dst, err
+		}
+	}
+	return endAttr(dst, start), nil
+}
+
+// appendNLRI appends the NLRI of a route of family f: a prefix, or the
+// EVPN, BGP-LS, SR Policy or Flow Specification NLRI of the event.
+func (e *Encoder) appendNLRI(dst []byte, f AFISAFI, ev *RouteEvent, announce bool) ([]byte, error) {
+	if prefixFamily(f.AFI, f.SAFI) {
+		return e.appendPrefix(dst, f, ev, announce)
+	}
+	if e.addPath(f.AFI, f.SAFI) {
+		dst = binary.BigEndian.AppendUint32(dst, uint32(ev.PathID))
+	}
+	switch {
+	case f.AFI == AFIL2VPN:
+		return appendEVPNRoute(dst, ev.EVPN)
+	case f.AFI == AFIBGPLS:
+		return appendLSNLRI(dst, ev.LinkState)
+	case f.SAFI == SAFISRPolicy:
+		return appendSRPolicyNLRI(dst, ev.SRPolicy, f.AFI)
+	}
+	return appendFlowSpecRule(dst, ev.FlowSpec, afiToVersion(f.AFI), f.SAFI == SAFIFlowSpecVPN)
+}
+
+// appendPrefix appends the NLRI of a route: its Path Identifier, label
+// stack and Route Distinguisher as the family requires, then the prefix.
+// A withdrawn labeled route carries the label field 0x800000 (RFC 8277
+// §2.4).
+func (e *Encoder) appendPrefix(dst []byte, f AFISAFI, ev *RouteEvent, announce bool) ([]byte, error) {
+	prefix, err := netip.ParsePrefix(ev.Prefix)
+	if err != nil || prefix.Addr().Is4() != (f.AFI == AFIIPv4) {
+		return dst, fmt.Errorf("bgp: invalid %s prefix %q", f, ev.Prefix)
+	}
+	if e.addPath(f.AFI, f.SAFI) {
+		dst = binary.BigEndian.AppendUint32(dst, uint32(ev.PathID))
+	}
+
+	bits := prefix.Bits()
+	lenAt := len(dst)
+	dst = append(dst, 0)
+	switch {
+	case f.SAFI == SAFIUnicast:
+	case !announce:
+		dst = append(dst, 0x80, 0, 0)
+		bits += 24
+	case len(ev.Labels) == 0:
+		return dst, fmt.Errorf("bgp: labeled route %s has no label", ev.Prefix)
+	default:
+		for i, label := range ev.Labels {
+			v := label << 4
+			if i == len(ev.Labels)-1 {
+				v |= 0x01 // Bottom of Stack
+			}
+			dst = append(dst, byte(v>>16), byte(v>>8), byte(v))
+			bits += 24
+		}
+	}
+	if f.SAFI == SAFIMPLSVPN {
+		rd, err := ParseRD(ev.RD)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, rd[:]...)
+		bits += RDLen * 8
+	}
+	if bits > 255 {
+		return dst, fmt.Errorf("bgp: NLRI of %s is too long", ev.Prefix)
+	}
+	dst[lenAt] = byte(bits)
+	return append(dst, prefix.Addr().AsSlice()[:(prefix.Bits()+7)/8]...), nil
+}
+
+// eventFamily returns the AFI/SAFI of a route the Encoder supports, which
+// must carry the prefix or NLRI of its family.
+func eventFamily(ev *RouteEvent) (AFISAFI, error) {
+	f := AFISAFI{SAFI: ev.SAFI}
+	switch ev.AFI {
+	case 4:
+		f.AFI = AFIIPv4
+	case 6:
+		f.AFI = AFIIPv6
+	case int(AFIL2VPN), int(AFIBGPLS):
+		f.AFI = uint16(ev.AFI)
+	}
+	var ok bool
+	switch {
+	case f == (AFISAFI{AFIL2VPN, SAFIEVPN}):
+		ok = ev.EVPN != nil
+	case f == (AFISAFI{AFIBGPLS, SAFIBGPLS}):
+		ok = ev.LinkState != nil
+	case f.AFI != AFIIPv4 && f.AFI != AFIIPv6:
+	case f.SAFI == SAFISRPolicy:
+		ok = ev.SRPolicy != nil
+	case isFlowSpec(f.SAFI):
+		ok = ev.FlowSpec != nil
+	default:
+		ok = prefixFamily(f.AFI, f.SAFI) && ev.Prefix != ""
+	}
+	if !ok {
+		return f, fmt.Errorf("bgp: encoding routes of AFI %d SAFI %d is not supported", ev.AFI, ev.SAFI)
+	}
+	return f, nil
+}
+
+// hasTunnelEncap reports whether attrs, the unknown attributes of an
+// event, hold a Tunnel Encapsulation attribute.
+func hasTunnelEncap(attrs map[string]string) bool {
+	_, ok := attrs[strconv.Itoa(int(AttrTypeTunnelEncap))]
+	return ok
+}
+
+// pathAttributes returns the path attributes of an announcement, with the
+// BGP-LS Attribute of a BGP-LS route.
+func (ev *RouteEvent) pathAttributes() *PathAttributes {
+	a := &PathAttributes{
+		Origin:            ev.Origin,
+		ASPath:            ev.ASPath,
+		ASPathSegments:    ev.ASPathSegments,
+		MED:               ev.MED,
+		LocalPref:         ev.LocalPref,
+		CommStd:           ev.CommStd,
+		CommExt:           ev.CommExt,
+		CommLarge:         ev.CommLarge,
+		Attrs:             ev.Attrs,
+		OriginatorID:      ev.OriginatorID,
+		ClusterList:       ev.ClusterList,
+		AtomicAggregate:   ev.AtomicAggregate,
+		AggregatorASN:     ev.AggregatorASN,
+		AggregatorAddress: ev.AggregatorAddress,
+		OTC:               ev.OTC,
+		PrefixSID:         ev.PrefixSID,
+	}
+	if ev.LinkState != nil {
+		a.LinkState = ev.LinkState.Attr
+	}
+	return a
+}
+
+// originCode returns the ORIGIN value of a name in OriginValues, or of
+// "UNKNOWN(<n>)".
+func originCode(origin string) (uint8, error) {
+	for code, name := range OriginValues {
+		if name == origin {
+			return code, nil
+		}
+	}
+	if s, ok := strings.CutPrefix(origin, "UNKNOWN("); ok {
+		if n, err := strconv.ParseUint(strings.TrimSuffix(s, ")"), 10, 8); err == nil {
+			return uint8(n), nil
+		}
+	}
+	return 0, fmt.Errorf("bgp: invalid origin %q", origin)
+}
+
+// parseIPv4 parses the IPv4 address of an attribute.
+func parseIPv4(s, what string) ([4]byte, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is4() {
+		return [4]byte{}, fmt.Errorf("bgp: invalid %s %q", what, s)
+	}
+	return addr.As4(), nil
+}
+
+// appendAttr appends a path attribute with the flags of its category in
+// attrCategories, or optional transitive for unknown types.
+func appendAttr(dst []byte, typeCode uint8, value []byte) []byte {
+	var start int
+	dst, start = beginAttr(dst, typeCode)
+	dst = append(dst, value...)
+	return endAttr(dst, start)
+}
+
+// beginAttr appends the flags, type and a two-octet placeholder length of
+// a path attribute, and returns where its value starts for endAttr.
+func beginAttr(dst []byte, typeCode uint8) ([]byte, int) {
+	flags, ok := attrCategories[typeCode]
+	if !ok {
+		flags = attrFlagOptional | attrFlagTransitive
+	}
+	dst = append(dst, flags|attrFlagExtendedLength, typeCode, 0, 0)
+	return dst, len(dst)
+}
+
+// endAttr sets the length of the attribute whose value starts at start,
+// moving the value to a one-octet length if it fits.
+func endAttr(dst []byte, start int) []byte {
+	n := len(dst) - start
+	if n > 255 {
+		binary.BigEndian.PutUint16(dst[start-2:start], uint16(n))
+		return dst
+	}
+	dst[start-4] &^= attrFlagExtendedLength
+	dst[start-2] = byte(n)
+	copy(dst[start-1:], dst[start:])
+	return dst[:len(dst)-1]
+}
+
+// appendHeader appends the header of a BGP message with a placeholder
+// length, which endMessage sets.
+func appendHeader(dst []byte, msgType uint8) []byte {
+	for range 16 {
+		dst = append(dst, 0xFF)
+	}
+	return append(dst, 0, 0, msgType)
+}
+
+// endMessage sets the length of the message starting at start, which
+// must not exceed the Encoder's maximum.
+func (e *Encoder) endMessage(dst []byte, start int) ([]byte, error) {
+	maxLen := MaxMessageLen
+	if e.ExtendedMessage {
+		maxLen = MaxExtendedMessageLen
+	}
+	n := len(dst) - start
+	if n > maxLen {
+		return dst, fmt.Errorf("bgp: message of %d octets exceeds the maximum of %d", n, maxLen)
+	}
+	binary.BigEndian.PutUint16(dst[start+16:], uint16(n))
+	return dst, nil
+}
+
+// AppendOpen appends an OPEN message, the inverse of ParseOpen, to dst.
+// An ASN above 65535 is sent as AS_TRANS in My Autonomous System; it is
+// carried in the 4-octet AS capability if m.Capabilities has one. Only the
+// codes of the capabilities in Capabilities.Unknown are known, so they are
+// sent empty. Optional Parameters that do not fit 255 octets use the RFC
+// 9072 encoding. On error dst is returned unchanged.
+func AppendOpen(dst []byte, m *OpenMessage) ([]byte, error) {
+	id, err := parseIPv4(m.BGPID, "BGP identifier")
+	if err != nil {
+		return dst, err
+	}
+	caps, err := appendCapabilities(nil, &m.Capabilities)
+	if err != nil {
+		return dst, err
+	}
+
+	start := len(dst)
+	dst = appendHeader(dst, BGPMsgTypeOpen)
+	version := m.Version
+	if version == 0 {
+		version = 4
+	}
+	asn := m.ASN
+	if asn > 0xFFFF {
+		asn = ASTrans
+	}
+	dst = append(dst, version)
+	dst = binary.BigEndian.AppendUint16(dst, uint16(asn))
+	dst = binary.BigEndian.AppendUint16(dst, m.HoldTime)
+	dst = append(dst, id[:]...)
+
+	const paramCapabilities = 2
+	if len(caps) == 0 {
+		dst = append(dst, 0)
+	} else if len(caps)+2 <= 255 {
+		dst = append(dst, byte(len(caps)+2), paramCapabilities, byte(len(caps)))
+		dst = append(dst, caps...)
+	} else {
+		dst = append(dst, 255, 255)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(caps)+3))
+		dst = append(dst, paramCapabilities)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(caps)))
+		dst = append(dst, caps...)
+	}
+	if len(dst)-start > MaxMessageLen {
+		return dst[:start], fmt.Errorf("bgp: open of %d octets exceeds the maximum of %d", len(dst)-start, MaxMessageLen)
+	}
+	binary.BigEndian.PutUint16(dst[start+16:], uint16(len(dst)-start))
+	return dst, nil
+}
+
+// appendCapabilities appends the capabilities of c as parseCapabilities
+// reads them.
+func appendCapabilities(dst []byte, c *Capabilities) ([]byte, error) {
+	var err error
+	appendCap := func(code uint8, value []byte) {
+		if len(value) > 255 {
+			err = fmt.Errorf("bgp: capability %d of %d octets is too long", code, len(value))
+			return
+		}
+		dst = append(dst, code, byte(len(value)))
+		dst = append(dst, value...)
+	}
+	appendFamily := func(b []byte, f AFISAFI) []byte {
+		b = binary.BigEndian.AppendUint16(b, f.AFI)
+		return append(b, f.SAFI)
+	}
+
+	for _, f := range c.Multiprotocol {
+		appendCap(CapMultiprotocol, append(binary.BigEndian.AppendUint16(nil, f.AFI), 0, f.SAFI))
+	}
+	if c.RouteRefresh {
+		appendCap(CapRouteRefresh, nil)
+	}
+	if c.ExtendedNextHop != nil {
+		var v []byte
+		for _, f := range c.ExtendedNextHop {
+			v = binary.BigEndian.AppendUint16(v, f.Family.AFI)
+			v = binary.BigEndian.AppendUint16(v, uint16(f.Family.SAFI))
+			v = binary.BigEndian.AppendUint16(v, f.NexthopAFI)
+		}
+		appendCap(CapExtendedNextHop, v)
+	}
+	if c.ExtendedMessage {
+		appendCap(CapExtendedMessage, nil)
+	}
+	if c.MultipleLabels != nil {
+		var v []byte
+		for _, f := range c.MultipleLabels {
+			v = append(appendFamily(v, f.Family), f.Count)
+		}
+		appendCap(CapMultipleLabels, v)
+	}
+	if c.HasRole {
+		appendCap(CapRole, []byte{c.Role})
+	}
+	if gr := c.GracefulRestart; gr != nil {
+		hdr := gr.RestartTime & 0x0FFF
+		if gr.Restarting {
+			hdr |= 0x8000
+		}
+		if gr.Notification {
+			hdr |= 0x4000
+		}
+		v := binary.BigEndian.AppendUint16(nil, hdr)
+		for _, f := range gr.Families {
+			var flags uint8
+			if f.ForwardingPreserved {
+				flags = 0x80
+			}
+			v = append(appendFamily(v, f.Family), flags)
+		}
+		appendCap(CapGracefulRestart, v)
+	}
+	if c.FourOctetAS != 0 {
+		appendCap(CapFourOctetAS, binary.BigEndian.AppendUint32(nil, c.FourOctetAS))
+	}
+	if c.AddPath != nil {
+		var v []byte
+		for _, f := range c.AddPath {
+			v = append(appendFamily(v, f.Family), uint8(f.Mode))
+		}
+		appendCap(CapAddPath, v)
+	}
+	if c.EnhancedRouteRefresh {
+		appendCap(CapEnhancedRouteRefresh, nil)
+	}
+	if c.LLGR != nil {
+		var v []byte
+		for _, f := range c.LLGR {
+			var flags uint8
+			if f.ForwardingPreserved {
+				flags = 0x80
+			}
+			v = append(appendFamily(v, f.Family), flags, byte(f.StaleTime>>16), byte(f.StaleTime>>8), byte(f.StaleTime))
+		}
+		appendCap(CapLLGR, v)
+	}
+	if c.Hostname != "" || c.DomainName != "" {
+		if len(c.Hostname) > 255 || len(c.DomainName) > 255 {
+			return dst, fmt.Errorf("bgp: FQDN capability is too long")
+		}
+		v := append([]byte{byte(len(c.Hostname))}, c.Hostname...)
+		v = append(append(v, byte(len(c.DomainName))), c.DomainName...)
+		appendCap(CapFQDN, v)
+	}
+	for _, code := range c.Unknown {
+		appendCap(code, nil)
+	}
+	return dst, err
+}
+
+// AppendNotification appends a NOTIFICATION message, the inverse of
+// ParseNotification, to dst. If n has no Data, its ShutdownMessage, if
+// any, is sent as an RFC 9003 Shutdown Communication.
+func AppendNotification(dst []byte, n *Notification) []byte {
+	start := len(dst)
+	dst = appendHeader(dst, BGPMsgTypeNotification)
+	dst = append(dst, n.Code, n.Subcode)
+	switch {
+	case n.Data != nil:
+		dst = append(dst, n.Data...)
+	case n.ShutdownMessage != "":
+		msg := n.ShutdownMessage[:min(len(n.ShutdownMessage), 255)]
+		dst = append(dst, byte(len(msg)))
+		dst = append(dst, msg...)
+	}
+	binary.BigEndian.PutUint16(dst[start+16:], uint16(len(dst)-start))
+	return dst
+}
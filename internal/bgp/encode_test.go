@@ -0,0 +1,686 @@
+package bgp
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAnnounce returns an announcement with origin IGP and the AS path
+// parsed from asPath, as ParseUpdate returns it.
+func testAnnounce(t testing.TB, afi int, safi uint8, prefix, nexthop, asPath string) *RouteEvent {
+	t.Helper()
+	path, err := ParseASPath(asPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RouteEvent{
+		AFI: afi, SAFI: safi, Prefix: prefix, Action: "A", Nexthop: nexthop,
+		Origin: "IGP", ASPath: path.String(), ASPathSegments: path,
+	}
+}
+
+// checkRoundTrip compares the events decoded from msg with want.
+// Announcements decode with an empty Attrs map, compared as nil.
+func checkRoundTrip(t *testing.T, got, want []*RouteEvent) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(got))
+	}
+	for i := range want {
+		g := *got[i]
+		if len(g.Attrs) == 0 {
+			g.Attrs = nil
+		}
+		if !reflect.DeepEqual(&g, want[i]) {
+			t.Errorf("event %d:\nexpected %+v\ngot      %+v", i, *want[i], g)
+		}
+	}
+}
+
+func TestEncodeUpdate_RoundTrip(t *testing.T) {
+	u32 := func(v uint32) *uint32 { return &v }
+
+	full := testAnnounce(t, 4, SAFIUnicast, "10.0.0.0/24", "192.0.2.1", "64496 4200000000 {64497,64498}")
+	full.Origin = "EGP"
+	full.MED, full.LocalPref, full.OTC = u32(50), u32(200), u32(64496)
+	full.CommStd = []string{"64496:100", "65535:65281"}
+	full.CommExt = []string{"RT:64496:100", "SOO:192.0.2.1:7", "COLOR:00:100", "RT:2001:db8::1:100"}
+	full.CommLarge = []string{"4200000000:1:2"}
+	full.OriginatorID, full.ClusterList = "192.0.2.9", []string{"10.0.0.1", "10.0.0.2"}
+	full.AtomicAggregate, full.AggregatorASN, full.AggregatorAddress = true, u32(4200000000), "192.0.2.8"
+	full.Attrs = map[string]string{"99": "abcd", "23": strings.Repeat("00", 300)}
+	full.PrefixSID = &PrefixSID{LabelIndex: u32(101)}
+	second := *full
+	second.Prefix = "10.1.0.0/16"
+
+	ipv6 := testAnnounce(t, 6, SAFIUnicast, "2001:db8::/32", "2001:db8::1", "64496")
+	ipv6.NexthopLL = "fe80::1"
+
+	unnumbered := testAnnounce(t, 6, SAFIUnicast, "2001:db8:1::/48", "fe80::2", "64496")
+	unnumbered.NexthopLL = "fe80::2"
+
+	extNexthop := testAnnounce(t, 4, SAFIUnicast, "10.2.0.0/16", "2001:db8::1", "")
+
+	labeled := testAnnounce(t, 4, SAFILabeledUnicast, "192.0.2.1/32", "192.0.2.1", "64496")
+	labeled.PathID, labeled.Labels = 7, []uint32{16001, 24}
+	labeled.PrefixSID = &PrefixSID{LabelIndex: u32(1), SRGB: []LabelRange{{Start: 16000, Size: 8000}}}
+
+	vpn := testAnnounce(t, 6, SAFIMPLSVPN, "2001:db8:2::/48", "2001:db8::1", "64496 64497")
+	vpn.Labels, vpn.RD = []uint32{100}, "192.0.2.1:7"
+	vpn.PrefixSID = &PrefixSID{SRv6Services: []SRv6Service{
+		{Layer: 3, SID: "fc00:0:1::", Behavior: 0x13, Structure: &SRv6SIDStructure{LocatorBlockLen: 32, LocatorNodeLen: 16, FunctionLen: 16}},
+		{Layer: 2, SID: "fc00:0:2::", Flags: 1, Behavior: 0x15},
+	}}
+
+	// Routes of one UPDATE share its path attributes.
+	mpFull := *full
+	mpFull.AFI, mpFull.SAFI, mpFull.Prefix, mpFull.Nexthop = 6, SAFIMPLSVPN, "2001:db8:3::/48", "2001:db8::9"
+	mpFull.Labels, mpFull.RD = []uint32{200, 300}, "64496:1"
+
+	withdrawals := []*RouteEvent{
+		{AFI: 4, SAFI: SAFIUnicast, Prefix: "10.9.0.0/16", Action: "D"},
+		{AFI: 4, SAFI: SAFIMPLSVPN, Prefix: "10.8.0.0/16", RD: "4200000000:1", Action: "D"},
+	}
+
+	tests := []struct {
+		name    string
+		events  []*RouteEvent
+		addPath bool
+	}{
+		{name: "IPv4 unicast with all attributes", events: []*RouteEvent{full, &second}},
+		{name: "IPv6 with link-local next hop", events: []*RouteEvent{ipv6}},
+		{name: "unnumbered IPv6", events: []*RouteEvent{unnumbered}},
+		{name: "IPv4 with IPv6 next hop", events: []*RouteEvent{extNexthop}},
+		{name: "labeled unicast with Add-Path", events: []*RouteEvent{labeled}, addPath: true},
+		{name: "VPN with SRv6 services", events: []*RouteEvent{vpn}},
+		{name: "withdrawals", events: withdrawals},
+		{name: "announcements and withdrawals", events: []*RouteEvent{withdrawals[0], full, &mpFull, withdrawals[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := EncodeUpdate(tt.events, tt.addPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, err := ParseUpdate(msg, tt.addPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkRoundTrip(t, events, tt.events)
+		})
+	}
+}
+
+// TestEncodeUpdate_RoundTripFamilies decodes UPDATEs of the EVPN, Flow
+// Specification, BGP-LS and SR Policy families, then encodes the events
+// and decodes them again.
+func TestEncodeUpdate_RoundTripFamilies(t *testing.T) {
+	tag := []byte{0, 0, 0, 10}
+	mac := []byte{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	var evpn []byte
+	evpn = append(evpn, evpnNLRI(EVPNEthernetAD, testESI, tag, labelField(100, true))...)
+	evpn = append(evpn, evpnNLRI(EVPNMACIPAdvertisement, testESI, tag, []byte{48}, mac,
+		[]byte{32, 10, 1, 1, 5}, labelField(200, true), labelField(300, true))...)
+	evpn = append(evpn, evpnNLRI(EVPNInclusiveMulticast, tag, []byte{32, 192, 0, 2, 1})...)
+	evpn = append(evpn, evpnNLRI(EVPNEthernetSegment, testESI, []byte{32, 192, 0, 2, 1})...)
+	evpn = append(evpn, evpnNLRI(EVPNIPPrefix, testESI, tag, []byte{24, 10, 2, 3, 0}, []byte{0, 0, 0, 0}, labelField(400, true))...)
+	vxlan := evpnNLRI(EVPNMACIPAdvertisement, make([]byte, 10), []byte{0, 0, 0, 0}, []byte{48}, mac, []byte{0}, []byte{0x00, 0x27, 0x74})
+	encap := []byte{0x03, 0x0c, 0, 0, 0, 0, 0, 8}
+	evpnWithdrawal := append([]byte{0, 25, SAFIEVPN}, evpnNLRI(EVPNIPPrefix, testESI, []byte{0, 0, 0, 0},
+		[]byte{64, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, make([]byte, 16), labelField(0, true))...)
+
+	flowSpec := []byte{
+		FlowDstPrefix, 24, 192, 0, 2,
+		FlowSrcPrefix, 8, 10,
+		FlowProtocol, 0x81, 6,
+		FlowDstPort, 0x01, 80, 0x91, 0x01, 0xbb,
+		FlowSrcPort, 0x13, 0x04, 0x00, 0xd5, 0x08, 0x00,
+		FlowTCPFlags, 0x80, 0x02,
+		FlowPacketLength, 0x84, 100,
+		FlowDSCP, 0x81, 46,
+		FlowFragment, 0x83, 0x02,
+	}
+	rate := []byte{0x80, 0x06, 0xFD, 0xE8, 0, 0, 0, 0}
+	rt := []byte{0x00, 0x02, 0xFD, 0xE8, 0, 0, 0, 100}
+	flowSpecIPv6 := []byte{
+		FlowDstPrefix, 48, 0, 0x20, 0x01, 0x0d, 0xb8, 0, 0,
+		FlowSrcPrefix, 64, 32, 0, 0, 0, 1,
+		FlowProtocol, 0x81, 58,
+		FlowLabel, 0xa1, 0, 0x01, 0x23, 0x45,
+	}
+	var longFlowSpec []byte
+	for len(longFlowSpec) < 240 {
+		longFlowSpec = append(longFlowSpec, FlowDstPort, 0x81, 80)
+	}
+	longNLRI := append([]byte{0, 1, SAFIFlowSpec, 0, 0, 0xf0 | byte(len(longFlowSpec)>>8), byte(len(longFlowSpec))}, longFlowSpec...)
+	flowSpecWithdrawal := append([]byte{0, 1, SAFIFlowSpecVPN, 8 + 5}, testRD...)
+	flowSpecWithdrawal = append(flowSpecWithdrawal, FlowDstPrefix, 24, 192, 0, 2)
+
+	lsNodeMsg := lsUpdate(lsNLRI(LSNodeNLRI, lsNode(lsLocalNodeDesc, 1)),
+		lsTLV(lsNodeName, []byte("pe1")),
+		lsTLV(lsIPv4RouterID, []byte{10, 0, 0, 1}),
+		lsTLV(lsSRCapabilities, []byte{0x80, 0}, []byte{0, 0x1F, 0x40}, lsTLV(lsSIDLabel, []byte{0, 0x3E, 0x80})),
+		lsTLV(lsSRAlgorithm, []byte{0, 1}),
+	)
+	lsLinkMsg := lsUpdate(lsNLRI(LSLinkNLRI,
+		lsNode(lsLocalNodeDesc, 1),
+		lsNode(lsRemoteNodeDesc, 2),
+		lsTLV(lsLinkIDs, []byte{0, 0, 0, 1, 0, 0, 0, 2}),
+		lsTLV(lsIPv6Interface, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}),
+		lsTLV(lsIPv6Neighbor, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}),
+		lsTLV(lsMultiTopologyID, []byte{0, 2}),
+	),
+		lsTLV(lsIPv4RemoteRID, []byte{10, 0, 0, 2}),
+		lsTLV(lsIGPMetric, []byte{0, 0, 10}),
+		lsTLV(lsTEMetric, []byte{0, 0, 0, 20}),
+		lsTLV(lsMaxLinkBandwidth, []byte{0x4E, 0x6E, 0x6B, 0x28}),
+		lsTLV(lsLinkName, []byte("pe1-pe2")),
+		lsTLV(lsAdjSID, []byte{0x30, 0, 0, 0}, []byte{0, 0x5D, 0xC0}),
+		lsTLV(lsLANAdjSID, []byte{0x30, 0, 0, 0}, []byte{10, 0, 0, 2}, []byte{0, 0x5D, 0xC1}),
+	)
+	lsPrefixMsg := lsUpdate(lsNLRI(LSIPv4PrefixNLRI,
+		lsTLV(lsLocalNodeDesc,
+			lsTLV(lsASNumber, []byte{0, 0, 0xFD, 0xE8}),
+			lsTLV(lsBGPLSIdentifier, []byte{0, 0, 0, 7}),
+			lsTLV(lsOSPFAreaID, []byte{0, 0, 0, 1}),
+			lsTLV(lsIGPRouterID, []byte{10, 0, 0, 1, 10, 1, 1, 1}),
+		),
+		lsTLV(lsOSPFRouteType, []byte{1}),
+		lsTLV(lsIPReachability, []byte{24, 10, 9, 8}),
+	),
+		lsTLV(lsPrefixMetric, []byte{0, 0, 0, 5}),
+		lsTLV(lsPrefixSID, []byte{0x40, 0, 0, 0}, []byte{0, 0, 0, 101}),
+	)
+	lsWithdrawal := append([]byte{0x40, 0x04, SAFIBGPLS}, lsNLRI(LSIPv6PrefixNLRI,
+		lsNode(lsLocalNodeDesc, 1),
+		lsTLV(lsMultiTopologyID, []byte{0, 2}),
+		lsTLV(lsIPReachability, []byte{64, 0x20, 0x01, 0x0d, 0xb8, 0, 1, 0, 0}),
+	)...)
+
+	sid := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0}
+	var tunnel []byte
+	for _, sub := range [][]byte{
+		srSubTLV(srPreference, []byte{0, 0, 0, 0, 0, 200}),
+		srSubTLV(srBindingSID, []byte{0, 0}, srLabel(24000)),
+		srSubTLV(srSegmentList, []byte{0},
+			srSubTLV(srWeight, []byte{0, 0, 0, 0, 0, 2}),
+			srSubTLV(srSegmentTypeA, []byte{0, 0}, srLabel(16001)),
+			srSubTLV(srSegmentTypeB, []byte{0, 0}, sid),
+		),
+		srSubTLV(srPolicyName, []byte{0}, []byte("blue")),
+	} {
+		tunnel = append(tunnel, sub...)
+	}
+	srPolicy := append([]byte{0, 1, SAFISRPolicy, 4, 192, 0, 2, 1, 0}, srPolicyNLRI(1, 100, 192, 0, 2, 9)...)
+	tunnelEncap := append([]byte{0, tunnelTypeSRPolicy, byte(len(tunnel) >> 8), byte(len(tunnel))}, tunnel...)
+	srWithdrawal := []byte{0, 2, SAFISRPolicy, 192, 0, 0, 0, 7, 0, 0, 0, 200,
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+
+	withAttrs := func(attrs ...[]byte) []byte {
+		pathAttrs := wellKnownAttrs()
+		for _, a := range attrs {
+			pathAttrs = append(pathAttrs, a...)
+		}
+		return buildBGPUpdate(nil, pathAttrs, nil)
+	}
+	unreach := func(mpUnreach []byte) []byte {
+		return buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, mpUnreach), nil)
+	}
+
+	tests := []struct {
+		name    string
+		msg     []byte
+		addPath bool
+	}{
+		{name: "EVPN route types", msg: evpnUpdate(evpn)},
+		{name: "EVPN route types with Add-Path", msg: evpnUpdate(evpn), addPath: true},
+		{name: "EVPN VXLAN", msg: evpnUpdate(vxlan, encap)},
+		{name: "EVPN withdrawal", msg: unreach(evpnWithdrawal)},
+		{name: "FlowSpec IPv4", msg: flowSpecUpdate(AFIIPv4, SAFIFlowSpec, flowSpec, rate, rt)},
+		{name: "FlowSpec IPv6 with offset", msg: flowSpecUpdate(AFIIPv6, SAFIFlowSpec, flowSpecIPv6)},
+		{name: "FlowSpec long rule", msg: withAttrs(buildPathAttr(0x80, AttrTypeMPReachNLRI, longNLRI))},
+		{name: "FlowSpec VPN withdrawal", msg: unreach(flowSpecWithdrawal)},
+		{name: "BGP-LS node", msg: lsNodeMsg},
+		{name: "BGP-LS link", msg: lsLinkMsg, addPath: true},
+		{name: "BGP-LS prefix", msg: lsPrefixMsg},
+		{name: "BGP-LS withdrawal", msg: unreach(lsWithdrawal)},
+		{name: "SR Policy", msg: withAttrs(buildPathAttr(0x80, AttrTypeMPReachNLRI, srPolicy),
+			buildPathAttr(0xC0, AttrTypeTunnelEncap, tunnelEncap))},
+		{name: "SR Policy withdrawal", msg: unreach(srWithdrawal)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The captured UPDATEs carry no Path Identifiers; the events
+			// are given some before they are encoded with Add-Path.
+			want, err := ParseUpdate(tt.msg, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, ev := range want {
+				if len(ev.Attrs) == 0 {
+					ev.Attrs = nil
+				}
+				if tt.addPath {
+					ev.PathID = int64(i + 1)
+					setPathID(ev, ev.PathID)
+				}
+			}
+			msg, err := EncodeUpdate(want, tt.addPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := ParseUpdate(msg, tt.addPath)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkRoundTrip(t, got, want)
+		})
+	}
+}
+
+// setPathID sets the Path Identifier the NLRI of ev was decoded with.
+func setPathID(ev *RouteEvent, id int64) {
+	switch {
+	case ev.EVPN != nil:
+		ev.EVPN.pathID = id
+	case ev.FlowSpec != nil:
+		ev.FlowSpec.pathID = id
+	case ev.LinkState != nil:
+		ev.LinkState.pathID = id
+	case ev.SRPolicy != nil:
+		ev.SRPolicy.pathID = id
+	}
+}
+
+func TestEncodeUpdate_SRPolicyCandidatePath(t *testing.T) {
+	pref, weight, prio := uint32(100), uint32(3), uint8(5)
+	ev := testAnnounce(t, 6, SAFISRPolicy, "", "2001:db8::1", "64496")
+	ev.SRPolicy = &SRPolicy{
+		Distinguisher: 1, Color: 200, Endpoint: "2001:db8::9",
+		Preference: &pref, Priority: &prio, BindingSID: "fc00:0:1::",
+		CandidatePathName: "primary", PolicyName: "green",
+		SegmentLists: []SRSegmentList{{Weight: &weight, Segments: []string{"fc00:0:2::", "16002"}}, {Segments: []string{"16003"}}},
+	}
+
+	msg, err := EncodeUpdate([]*RouteEvent{ev}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, err := ParseUpdate(msg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events[0].SRPolicy, ev.SRPolicy) {
+		t.Errorf("expected %+v, got %+v", *ev.SRPolicy, *events[0].SRPolicy)
+	}
+
+	// A Tunnel Encapsulation attribute in Attrs is sent as it is.
+	ev.Attrs = events[0].Attrs
+	ev.SRPolicy.PolicyName = "red"
+	if msg2, err := EncodeUpdate([]*RouteEvent{ev}, false); err != nil || string(msg2) != string(msg) {
+		t.Errorf("expected the UPDATE to be encoded from Attrs, got %x (error %v)", msg2, err)
+	}
+}
+
+func TestEncodeUpdate_AS4Path(t *testing.T) {
+	asn := uint32(4200000001)
+	ev := testAnnounce(t, 4, SAFIUnicast, "10.0.0.0/24", "192.0.2.1", "65001 4200000000 {4200000001,65002}")
+	ev.AggregatorASN, ev.AggregatorAddress = &asn, "192.0.2.1"
+
+	s := &Session{}
+	msg, err := NewSessionEncoder(s, false).AppendUpdate(nil, []*RouteEvent{ev})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var d Decoder
+	if err := d.Decode(msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(d.Attrs.ASPath) != 2+2*2+2+2*2 || !d.Attrs.Has(AttrTypeAS4Path) || len(d.Attrs.Aggregator) != 6 {
+		t.Errorf("expected 2-octet AS_PATH and AGGREGATOR with AS4_PATH, got %+v", d.Attrs)
+	}
+	events, err := ParseUpdateSession(msg, s, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkRoundTrip(t, events, []*RouteEvent{ev})
+}
+
+// randomEvents returns the events of a random UPDATE: announcements of
+// one family, IPv4 unicast withdrawals and withdrawals of another family.
+func randomEvents(r *rand.Rand, asnWidth ASNWidth) []*RouteEvent {
+	families := []AFISAFI{
+		{AFIIPv4, SAFIUnicast}, {AFIIPv6, SAFIUnicast}, {AFIIPv4, SAFILabeledUnicast},
+		{AFIIPv6, SAFILabeledUnicast}, {AFIIPv4, SAFIMPLSVPN}, {AFIIPv6, SAFIMPLSVPN},
+	}
+	pick := func(s []string) []string {
+		var out []string
+		for _, x := range s {
+			if r.IntN(3) == 0 {
+				out = append(out, x)
+			}
+		}
+		return out
+	}
+	prefix := func(f AFISAFI) string {
+		var b [16]byte
+		for i := range b {
+			b[i] = byte(r.Uint32())
+		}
+		if f.AFI == AFIIPv4 {
+			return netip.PrefixFrom(netip.AddrFrom4([4]byte(b[:4])), r.IntN(33)).Masked().String()
+		}
+		// A labeled NLRI is limited to 255 bits: an RD and three labels
+		// leave 119 for the prefix.
+		bits := 128
+		if f.SAFI != SAFIUnicast {
+			bits = 119
+		}
+		return netip.PrefixFrom(netip.AddrFrom16(b), r.IntN(bits+1)).Masked().String()
+	}
+	asn := func() uint32 {
+		if r.IntN(2) == 0 {
+			return uint32(r.IntN(65535) + 1)
+		}
+		return r.Uint32()
+	}
+	route := func(f AFISAFI, action string) *RouteEvent {
+		ev := &RouteEvent{AFI: afiToVersion(f.AFI), SAFI: f.SAFI, Prefix: prefix(f), Action: action}
+		if f.SAFI == SAFIMPLSVPN {
+			ev.RD = fmt.Sprintf("%d:%d", r.IntN(65536), r.Uint32())
+		}
+		if f.SAFI != SAFIUnicast && action == "A" {
+			for range r.IntN(3) + 1 {
+				ev.Labels = append(ev.Labels, r.Uint32N(1<<20))
+			}
+		}
+		return ev
+	}
+
+	var events []*RouteEvent
+	for range r.IntN(3) {
+		events = append(events, route(AFISAFI{AFIIPv4, SAFIUnicast}, "D"))
+	}
+
+	f := families[r.IntN(len(families))]
+	var path ASPath
+	for range r.IntN(4) {
+		seg := ASPathSegment{Type: ASPathSegmentSequence}
+		if r.IntN(4) == 0 {
+			seg.Type = ASPathSegmentSet
+		}
+		for range r.IntN(5) + 1 {
+			seg.ASNs = append(seg.ASNs, asn())
+		}
+		path = append(path, seg)
+	}
+	a := RouteEvent{
+		Action:         "A",
+		Origin:         []string{"IGP", "EGP", "INCOMPLETE"}[r.IntN(3)],
+		ASPath:         path.String(),
+		ASPathSegments: path,
+		CommStd:        pick([]string{"64496:1", "65535:65281", "0:0"}),
+		CommExt:        pick([]string{"RT:64496:1", "RT:4200000000:2", "SOO:192.0.2.1:3", "ENCAP:MPLS", "RT:2001:db8::1:1"}),
+		CommLarge:      pick([]string{"4200000000:1:2", "0:0:0"}),
+		ClusterList:    pick([]string{"10.0.0.1", "10.0.0.2"}),
+	}
+	if r.IntN(2) == 0 {
+		v := r.Uint32()
+		a.MED = &v
+	}
+	if r.IntN(2) == 0 {
+		v := r.Uint32()
+		a.LocalPref = &v
+	}
+	if r.IntN(2) == 0 {
+		a.OriginatorID = "192.0.2.9"
+	}
+	if r.IntN(2) == 0 {
+		a.AtomicAggregate = true
+	}
+	if r.IntN(2) == 0 {
+		// A 2-octet AGGREGATOR would make AS4_PATH stale.
+		v := asn()
+		if asnWidth == ASNWidth2 {
+			v = ASTrans + 1<<16
+		}
+		a.AggregatorASN, a.AggregatorAddress = &v, "192.0.2.8"
+	}
+	if r.IntN(2) == 0 {
+		v := asn()
+		a.OTC = &v
+	}
+	if r.IntN(4) == 0 {
+		a.Attrs = map[string]string{"99": "0102"}
+	}
+
+	nexthop := "192.0.2.1"
+	var nexthopLL string
+	if f.AFI == AFIIPv6 || r.IntN(4) == 0 {
+		nexthop = "2001:db8::1"
+		if r.IntN(2) == 0 {
+			nexthopLL = "fe80::1"
+		}
+	}
+	for range r.IntN(4) + 1 {
+		ev, nlri := a, route(f, "A")
+		ev.AFI, ev.SAFI, ev.Prefix, ev.RD, ev.Labels = nlri.AFI, nlri.SAFI, nlri.Prefix, nlri.RD, nlri.Labels
+		ev.Nexthop, ev.NexthopLL = nexthop, nexthopLL
+		events = append(events, &ev)
+	}
+
+	g := families[r.IntN(len(families))]
+	if g != (AFISAFI{AFIIPv4, SAFIUnicast}) {
+		for range r.IntN(3) {
+			events = append(events, route(g, "D"))
+		}
+	}
+	return events
+}
+
+// TestEncodeUpdate_RandomRoundTrip checks that random UPDATEs decode into
+// the events they were encoded from.
+func TestEncodeUpdate_RandomRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range 500 {
+		addPath := r.IntN(2) == 0
+		families := []AFISAFI{{AFIIPv4, SAFIUnicast}, {AFIIPv6, SAFIUnicast}, {AFIIPv4, SAFILabeledUnicast},
+			{AFIIPv6, SAFILabeledUnicast}, {AFIIPv4, SAFIMPLSVPN}, {AFIIPv6, SAFIMPLSVPN}}
+		s := &Session{FourOctetAS: r.IntN(2) == 0, MultiLabelRX: families, ExtendedNextHopRX: families}
+		if addPath {
+			s.AddPathRX = families
+		}
+		e := NewSessionEncoder(s, false)
+		events := randomEvents(r, e.ASNWidth)
+		if addPath {
+			for _, ev := range events {
+				ev.PathID = int64(r.Uint32())
+			}
+		}
+
+		msg, err := e.AppendUpdate(nil, events)
+		if err != nil {
+			t.Fatalf("update %d: unexpected error: %v", i, err)
+		}
+		got, err := ParseUpdateSession(msg, s, false)
+		if err != nil {
+			t.Fatalf("update %d: unexpected error: %v", i, err)
+		}
+
+		// ParseUpdate returns the IPv4 withdrawals and announcements
+		// ahead of the MP_REACH_NLRI routes, then the MP_UNREACH_NLRI
+		// withdrawals.
+		var want []*RouteEvent
+		for _, pass := range []func(*RouteEvent) bool{
+			func(ev *RouteEvent) bool { return ev.Action == "D" && ev.AFI == 4 && ev.SAFI == SAFIUnicast },
+			func(ev *RouteEvent) bool {
+				return ev.Action == "A" && ev.AFI == 4 && ev.SAFI == SAFIUnicast && ev.Nexthop == "192.0.2.1"
+			},
+			func(ev *RouteEvent) bool {
+				return ev.Action == "A" && (ev.AFI != 4 || ev.SAFI != SAFIUnicast || ev.Nexthop != "192.0.2.1")
+			},
+			func(ev *RouteEvent) bool { return ev.Action == "D" && (ev.AFI != 4 || ev.SAFI != SAFIUnicast) },
+		} {
+			for _, ev := range events {
+				if pass(ev) {
+					want = append(want, ev)
+				}
+			}
+		}
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			checkRoundTrip(t, got, want)
+		})
+	}
+}
+
+func TestEncodeUpdate_Errors(t *testing.T) {
+	evpn := &RouteEvent{AFI: int(AFIL2VPN), SAFI: SAFIEVPN, EVPN: &EVPNRoute{}, Action: "A"}
+	v6 := testAnnounce(t, 6, SAFIUnicast, "2001:db8::/32", "2001:db8::1", "")
+	vpn := testAnnounce(t, 6, SAFIMPLSVPN, "2001:db8::/32", "2001:db8::1", "")
+	vpn.Labels, vpn.RD = []uint32{1}, "65000:1"
+	noLabel := testAnnounce(t, 4, SAFILabeledUnicast, "10.0.0.0/8", "192.0.2.1", "")
+	badComm := testAnnounce(t, 4, SAFIUnicast, "10.0.0.0/8", "192.0.2.1", "")
+	badComm.CommStd = []string{"65536:1"}
+	mismatch := testAnnounce(t, 4, SAFIUnicast, "2001:db8::/32", "192.0.2.1", "")
+
+	for name, events := range map[string][]*RouteEvent{
+		"EVPN route type 0":     {evpn},
+		"FlowSpec component":    {{AFI: 4, SAFI: SAFIFlowSpec, FlowSpec: &FlowSpecRule{Rule: "flow-label =1"}, Action: "A"}},
+		"SR Policy endpoint":    {{AFI: 4, SAFI: SAFISRPolicy, SRPolicy: &SRPolicy{Endpoint: "2001:db8::1"}, Action: "D"}},
+		"BGP-LS without NLRI":   {{AFI: int(AFIBGPLS), SAFI: SAFIBGPLS, Action: "D"}},
+		"two MP_REACH_NLRI":     {v6, vpn},
+		"labeled without label": {noLabel},
+		"invalid community":     {badComm},
+		"prefix of other AFI":   {mismatch},
+	} {
+		if msg, err := EncodeUpdate(events, false); err == nil {
+			t.Errorf("%s: expected an error, got %x", name, msg)
+		}
+	}
+
+	dst := []byte{1, 2, 3}
+	if out, err := (&Encoder{}).AppendUpdate(dst, []*RouteEvent{evpn}); err == nil || len(out) != 3 {
+		t.Errorf("expected dst unchanged on error, got %x", out)
+	}
+}
+
+func TestEncodeUpdate_MaxLength(t *testing.T) {
+	var events []*RouteEvent
+	for i := range 2000 {
+		events = append(events, testAnnounce(t, 4, SAFIUnicast, fmt.Sprintf("10.%d.%d.0/24", i/256, i%256), "192.0.2.1", ""))
+	}
+	if _, err := EncodeUpdate(events, false); err == nil {
+		t.Error("expected an error for an UPDATE over 4096 octets")
+	}
+	msg, err := (&Encoder{ExtendedMessage: true}).AppendUpdate(nil, events)
+	if err != nil {
+		t.Fatalf("unexpected error with Extended Messages: %v", err)
+	}
+	got, err := ParseUpdate(msg, false)
+	if err != nil || len(got) != len(events) {
+		t.Fatalf("expected %d events, got %d (error %v)", len(events), len(got), err)
+	}
+}
+
+func TestEncoder_AppendPathAttributes(t *testing.T) {
+	med := uint32(10)
+	a := &PathAttributes{
+		Origin: "INCOMPLETE", ASPath: "64496 64497", Nexthop: "192.0.2.1", MED: &med,
+		CommLarge: []string{"1:2:3"}, Attrs: map[string]string{"99": "ff"},
+	}
+	var e Encoder
+	b, err := e.AppendPathAttributes(nil, a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := ParsePathAttributes(b, false)
+	if got.Origin != a.Origin || got.ASPath != a.ASPath || got.Nexthop != a.Nexthop || *got.MED != med ||
+		!reflect.DeepEqual(got.CommLarge, a.CommLarge) || !reflect.DeepEqual(got.Attrs, a.Attrs) || len(got.Warnings) != 0 {
+		t.Errorf("unexpected attributes %+v", got)
+	}
+
+	if _, err := e.AppendPathAttributes(nil, &PathAttributes{Attrs: map[string]string{"x": ""}}); err == nil {
+		t.Error("expected an error for an invalid attribute type")
+	}
+}
+
+func TestAppendEndOfRIB(t *testing.T) {
+	for _, f := range []AFISAFI{{AFIIPv4, SAFIUnicast}, {AFIIPv6, SAFIUnicast}, {AFIIPv4, SAFIMPLSVPN}} {
+		msg := AppendEndOfRIB(nil, f.AFI, f.SAFI)
+		events, err := ParseUpdate(msg, false)
+		if err != nil || len(events) != 0 {
+			t.Errorf("%s: expected no events, got %d (error %v)", f, len(events), err)
+		}
+		if afi, safi := DetectEORFamily(msg); afi != afiToVersion(f.AFI) || safi != f.SAFI {
+			t.Errorf("%s: detected AFI %d SAFI %d", f, afi, safi)
+		}
+	}
+}
+
+func TestAppendOpen_RoundTrip(t *testing.T) {
+	m := &OpenMessage{
+		Version:  4,
+		ASN:      4200000000,
+		HoldTime: 90,
+		BGPID:    "192.0.2.1",
+		Capabilities: Capabilities{
+			Multiprotocol:        []AFISAFI{{AFIIPv4, SAFIUnicast}, {AFIIPv6, SAFIMPLSVPN}},
+			RouteRefresh:         true,
+			EnhancedRouteRefresh: true,
+			ExtendedMessage:      true,
+			ExtendedNextHop:      []ExtendedNextHopFamily{{Family: AFISAFI{AFIIPv4, SAFIUnicast}, NexthopAFI: AFIIPv6}},
+			MultipleLabels:       []MultipleLabelsFamily{{Family: AFISAFI{AFIIPv4, SAFILabeledUnicast}, Count: 3}},
+			FourOctetAS:          4200000000,
+			AddPath:              []AddPathFamily{{Family: AFISAFI{AFIIPv4, SAFIUnicast}, Mode: AddPathBoth}},
+			GracefulRestart: &GracefulRestart{Restarting: true, RestartTime: 120,
+				Families: []GracefulFamily{{Family: AFISAFI{AFIIPv4, SAFIUnicast}, ForwardingPreserved: true}}},
+			LLGR:       []LLGRFamily{{Family: AFISAFI{AFIIPv6, SAFIUnicast}, StaleTime: 86400}},
+			HasRole:    true,
+			Role:       RoleCustomer,
+			RoleName:   "customer",
+			Hostname:   "r1",
+			DomainName: "example.net",
+			Unknown:    []uint8{200},
+		},
+	}
+	msg, err := AppendOpen(nil, m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := ParseOpen(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("expected %+v\ngot      %+v", m, got)
+	}
+
+	// Capabilities beyond 255 octets use extended Optional Parameters.
+	for i := range 60 {
+		m.Capabilities.Multiprotocol = append(m.Capabilities.Multiprotocol, AFISAFI{AFI: uint16(100 + i), SAFI: 1})
+	}
+	if msg, err = AppendOpen(nil, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err = ParseOpen(msg); err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("extended Optional Parameters did not round-trip (error %v)", err)
+	}
+}
+
+func TestAppendNotification_RoundTrip(t *testing.T) {
+	msg := AppendNotification(nil, &Notification{Code: NotifCease, Subcode: CeaseAdministrativeShutdown, ShutdownMessage: "maintenance"})
+	n, err := ParseNotification(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n.Code != NotifCease || n.Subcode != CeaseAdministrativeShutdown || n.ShutdownMessage != "maintenance" {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
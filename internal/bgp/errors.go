@@ -0,0 +1,200 @@
+package bgp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ErrorAction is how an error found in an UPDATE is handled (RFC 7606 §2),
+// from least to most severe.
+type ErrorAction uint8
+
+const (
+	// AttributeDiscard ignores the malformed attribute; the routes are
+	// kept.
+	AttributeDiscard ErrorAction = iota + 1
+	// TreatAsWithdraw withdraws the routes the UPDATE announces.
+	TreatAsWithdraw
+	// SessionReset marks an UPDATE that cannot be parsed reliably. A BGP
+	// speaker resets the session; the ingester keeps the routes decoded
+	// before the error.
+	SessionReset
+)
+
+var errorActionNames = map[ErrorAction]string{
+	AttributeDiscard: "attribute-discard",
+	TreatAsWithdraw:  "treat-as-withdraw",
+	SessionReset:     "session-reset",
+}
+
+func (a ErrorAction) String() string {
+	if name, ok := errorActionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("action(%d)", uint8(a))
+}
+
+// MarshalText renders the action by name in JSON.
+func (a ErrorAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// ParseWarning is an error found in an UPDATE and the action taken for it.
+type ParseWarning struct {
+	Action ErrorAction `json:"action"`
+	Attr   uint8       `json:"attr,omitempty"` // path attribute type; 0 for the NLRI fields
+	Reason string      `json:"reason"`
+}
+
+func (w ParseWarning) String() string {
+	if w.Attr != 0 {
+		return fmt.Sprintf("%s: attribute %d: %s", w.Action, w.Attr, w.Reason)
+	}
+	return fmt.Sprintf("%s: %s", w.Action, w.Reason)
+}
+
+// AttrLabel names the warning's path attribute type for metrics: its type
+// code, or "nlri".
+func (w ParseWarning) AttrLabel() string {
+	if w.Attr == 0 {
+		return "nlri"
+	}
+	return strconv.Itoa(int(w.Attr))
+}
+
+// Attribute Flags (RFC 4271 §4.3).
+const (
+	attrFlagOptional   = 0x80
+	attrFlagTransitive = 0x40
+)
+
+// attrCategories are the Optional and Transitive flags the known path
+// attributes must carry (RFC 7606 §3 c).
+var attrCategories = map[uint8]uint8{
+	AttrTypeOrigin:           attrFlagTransitive,
+	AttrTypeASPath:           attrFlagTransitive,
+	AttrTypeNextHop:          attrFlagTransitive,
+	AttrTypeMED:              attrFlagOptional,
+	AttrTypeLocalPref:        attrFlagTransitive,
+	AttrTypeAtomicAggregate:  attrFlagTransitive,
+	AttrTypeAggregator:       attrFlagOptional | attrFlagTransitive,
+	AttrTypeCommunity:        attrFlagOptional | attrFlagTransitive,
+	AttrTypeOriginatorID:     attrFlagOptional,
+	AttrTypeClusterList:      attrFlagOptional,
+	AttrTypeMPReachNLRI:      attrFlagOptional,
+	AttrTypeMPUnreachNLRI:    attrFlagOptional,
+	AttrTypeExtCommunity:     attrFlagOptional | attrFlagTransitive,
+	AttrTypeAS4Path:          attrFlagOptional | attrFlagTransitive,
+	AttrTypeAS4Aggregator:    attrFlagOptional | attrFlagTransitive,
+	AttrTypeTunnelEncap:      attrFlagOptional | attrFlagTransitive,
+	AttrTypeIPv6ExtCommunity: attrFlagOptional | attrFlagTransitive,
+	AttrTypeBGPLS:            attrFlagOptional,
+	AttrTypeLargeCommunity:   attrFlagOptional | attrFlagTransitive,
+	AttrTypeOTC:              attrFlagOptional | attrFlagTransitive,
+	AttrTypePrefixSID:        attrFlagOptional | attrFlagTransitive,
+}
+
+// malformedActions overrides "treat-as-withdraw", the default action for a
+// malformed attribute: RFC 7606 §7.6-7.7 and §7.11, RFC 6793 §6, RFC 8669
+// §6 and RFC 9552 §8.2.2.
+var malformedActions = map[uint8]ErrorAction{
+	AttrTypeAtomicAggregate: AttributeDiscard,
+	AttrTypeAggregator:      AttributeDiscard,
+	AttrTypeAS4Path:         AttributeDiscard,
+	AttrTypeAS4Aggregator:   AttributeDiscard,
+	AttrTypeBGPLS:           AttributeDiscard,
+	AttrTypePrefixSID:       AttributeDiscard,
+	AttrTypeMPReachNLRI:     SessionReset,
+	AttrTypeMPUnreachNLRI:   SessionReset,
+}
+
+// malformed records a malformed attribute of the given type and returns
+// the action taken.
+func (d *Decoder) malformed(typeCode uint8, format string, args ...any) ErrorAction {
+	action, ok := malformedActions[typeCode]
+	if !ok {
+		action = TreatAsWithdraw
+	}
+	d.warn(action, typeCode, format, args...)
+	return action
+}
+
+func (d *Decoder) warn(action ErrorAction, typeCode uint8, format string, args ...any) {
+	d.Warnings = append(d.Warnings, ParseWarning{Action: action, Attr: typeCode, Reason: fmt.Sprintf(format, args...)})
+}
+
+// checkAttrFlags reports whether an attribute's Optional and Transitive
+// flags match its category. A mismatch makes the attribute malformed.
+func (d *Decoder) checkAttrFlags(flags, typeCode uint8) bool {
+	want, ok := attrCategories[typeCode]
+	if !ok || flags&(attrFlagOptional|attrFlagTransitive) == want {
+		return true
+	}
+	d.malformed(typeCode, "flags 0x%02x conflict with the attribute's category", flags)
+	return false
+}
+
+// checkAttrLength records a malformed attribute and returns false unless
+// the attribute is a non-empty multiple of size octets, or exactly size
+// octets if exact is set.
+func (d *Decoder) checkAttrLength(typeCode uint8, data []byte, size int, exact bool) bool {
+	switch {
+	case exact && len(data) != size:
+		d.malformed(typeCode, "length %d, want %d", len(data), size)
+		return false
+	case !exact && (len(data) == 0 || len(data)%size != 0):
+		d.malformed(typeCode, "length %d is not a non-zero multiple of %d", len(data), size)
+		return false
+	}
+	return true
+}
+
+// worstAction returns the most severe action of warnings, or 0 if there
+// are none.
+func worstAction(warnings []ParseWarning) ErrorAction {
+	var worst ErrorAction
+	for _, w := range warnings {
+		worst = max(worst, w.Action)
+	}
+	return worst
+}
+
+// hasAction reports whether any warning took the given action.
+func hasAction(warnings []ParseWarning, action ErrorAction) bool {
+	for _, w := range warnings {
+		if w.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// withdraw turns the announcement r into the withdrawal of its route, for
+// an UPDATE handled as "treat-as-withdraw".
+func (r *Route) withdraw() {
+	w := Route{
+		AFI:    r.AFI,
+		SAFI:   r.SAFI,
+		Prefix: r.Prefix,
+		RD:     r.RD,
+		PathID: r.PathID,
+		Action: "D",
+	}
+	if r.EVPN != nil {
+		e := *r.EVPN
+		e.Labels, e.VNIs = nil, nil
+		w.EVPN = &e
+	}
+	if r.FlowSpec != nil {
+		f := *r.FlowSpec
+		f.Actions = nil
+		w.FlowSpec = &f
+	}
+	if r.LinkState != nil {
+		w.LinkState = r.LinkState.withAttribute(nil)
+	}
+	if p := r.SRPolicy; p != nil {
+		w.SRPolicy = &SRPolicy{Distinguisher: p.Distinguisher, Color: p.Color, Endpoint: p.Endpoint}
+	}
+	*r = w
+}
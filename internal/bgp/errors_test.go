@@ -0,0 +1,222 @@
+package bgp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseUpdate_AttributeDiscard(t *testing.T) {
+	tests := []struct {
+		name string
+		attr []byte
+		code uint8
+	}{
+		{"atomic aggregate with data", buildPathAttr(0x40, AttrTypeAtomicAggregate, []byte{1}), AttrTypeAtomicAggregate},
+		{"short aggregator", buildPathAttr(0xC0, AttrTypeAggregator, []byte{0xFD, 0xE8, 10}), AttrTypeAggregator},
+		{"aggregator flags", buildPathAttr(0x40, AttrTypeAggregator, []byte{0xFD, 0xE8, 10, 0, 0, 1}), AttrTypeAggregator},
+		{"repeated origin", buildPathAttr(0x40, AttrTypeOrigin, []byte{2}), AttrTypeOrigin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathAttrs := append(wellKnownAttrs(), buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+			pathAttrs = append(pathAttrs, tt.attr...)
+			events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0}), false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			ev := events[0]
+			if ev.Action != "A" || ev.Origin != "IGP" {
+				t.Errorf("expected announcement with origin IGP, got %s %q", ev.Action, ev.Origin)
+			}
+			if ev.AtomicAggregate || ev.AggregatorASN != nil {
+				t.Error("expected the malformed attribute to be discarded")
+			}
+			if len(ev.ParseWarnings) != 1 {
+				t.Fatalf("expected 1 parse warning, got %v", ev.ParseWarnings)
+			}
+			if w := ev.ParseWarnings[0]; w.Action != AttributeDiscard || w.Attr != tt.code {
+				t.Errorf("unexpected warning %s", w)
+			}
+		})
+	}
+}
+
+func TestParseUpdate_TreatAsWithdraw(t *testing.T) {
+	tests := []struct {
+		name string
+		attr []byte
+		code uint8
+	}{
+		{"undefined origin", buildPathAttr(0x40, AttrTypeOrigin, []byte{3}), AttrTypeOrigin},
+		{"short next hop", buildPathAttr(0x40, AttrTypeNextHop, []byte{10, 0, 0}), AttrTypeNextHop},
+		{"transitive MED", buildPathAttr(0xC0, AttrTypeMED, []byte{0, 0, 0, 1}), AttrTypeMED},
+		{"optional local pref", buildPathAttr(0x80, AttrTypeLocalPref, []byte{0, 0, 0, 100}), AttrTypeLocalPref},
+		{"empty large community", buildPathAttr(0xC0, AttrTypeLargeCommunity, nil), AttrTypeLargeCommunity},
+		{"truncated as path", buildPathAttr(0x40, AttrTypeASPath, []byte{ASPathSegmentSequence, 3, 0, 0, 0xFD, 0xE8}), AttrTypeASPath},
+		{"undefined as path segment", buildPathAttr(0x40, AttrTypeASPath, asSeg(4, 7, 64496)), AttrTypeASPath},
+		{"missing origin", nil, AttrTypeOrigin},
+		{"missing as path", nil, AttrTypeASPath},
+		{"missing next hop", nil, AttrTypeNextHop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The well-known mandatory attributes other than the one
+			// tested are present and well-formed.
+			pathAttrs := tt.attr
+			for _, a := range [][]byte{
+				buildPathAttr(0x40, AttrTypeOrigin, []byte{0}),
+				buildPathAttr(0x40, AttrTypeASPath, nil),
+				buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1}),
+			} {
+				if a[1] != tt.code {
+					pathAttrs = append(pathAttrs, a...)
+				}
+			}
+			expectTreatAsWithdraw(t, buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0}), tt.code)
+		})
+	}
+}
+
+func TestParseUpdate_MissingAttrsMPReach(t *testing.T) {
+	// MP_REACH_NLRI routes need ORIGIN and AS_PATH, but no NEXT_HOP.
+	tests := []struct {
+		name     string
+		attrs    []byte
+		withdraw bool
+	}{
+		{"origin and as path", wellKnownAttrs(), false},
+		{"no as path", buildPathAttr(0x40, AttrTypeOrigin, []byte{0}), true},
+		{"no origin", buildPathAttr(0x40, AttrTypeASPath, nil), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathAttrs := append(tt.attrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, labeledMPReach(labelField(16, true)))...)
+			events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			w := events[0].ParseWarnings
+			if !tt.withdraw {
+				if events[0].Action != "A" || w != nil {
+					t.Errorf("expected announcement without warnings, got %s %v", events[0].Action, w)
+				}
+				return
+			}
+			if events[0].Action != "D" || len(w) != 1 || w[0].Action != TreatAsWithdraw {
+				t.Errorf("expected withdrawal for a missing attribute, got %s %v", events[0].Action, w)
+			}
+		})
+	}
+}
+
+func TestParseUpdate_MissingAttrsWithdrawalOnly(t *testing.T) {
+	// An UPDATE withdrawing routes needs no path attributes.
+	events, err := ParseUpdate(buildBGPUpdate([]byte{24, 10, 0, 0}, nil, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != "D" || events[0].ParseWarnings != nil {
+		t.Errorf("expected 1 withdrawal without warnings, got %+v", events)
+	}
+}
+
+func TestParseUpdate_TreatAsWithdrawMPReach(t *testing.T) {
+	// Labeled VPN routes are withdrawn by RD and prefix; MP_UNREACH_NLRI
+	// withdrawals of the same UPDATE are unaffected.
+	mpReach := []byte{0, 1, SAFIMPLSVPN, 12, 0, 0, 0, 0, 0, 0, 0, 0, 192, 0, 2, 1, 0}
+	mpReach = append(mpReach, 24+64+16)
+	mpReach = append(mpReach, labelField(100, true)...)
+	mpReach = append(mpReach, 0, 0, 0xFD, 0xE8, 0, 0, 0, 1, 10, 1)
+	pathAttrs := append(wellKnownAttrs(), buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, []byte{0, 2, SAFIUnicast, 32, 0x20, 0x01, 0x0d, 0xb8})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeMED, []byte{0, 0, 0, 1})...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "D" || ev.Prefix != "10.1.0.0/16" || ev.RD != "65000:1" {
+		t.Errorf("unexpected withdrawal %s %s rd %s", ev.Action, ev.Prefix, ev.RD)
+	}
+	if ev.Labels != nil || ev.Nexthop != "" || ev.MED != nil {
+		t.Errorf("expected no labels or attributes, got %v %q %v", ev.Labels, ev.Nexthop, ev.MED)
+	}
+	if events[1].Action != "D" || events[1].Prefix != "2001:db8::/32" {
+		t.Errorf("unexpected MP_UNREACH event %s %s", events[1].Action, events[1].Prefix)
+	}
+	for _, ev := range events {
+		if len(ev.ParseWarnings) != 1 || ev.ParseWarnings[0].Action != TreatAsWithdraw {
+			t.Errorf("unexpected parse warnings %v", ev.ParseWarnings)
+		}
+	}
+}
+
+func TestParseUpdate_SessionResetKeepsDecodedPrefixes(t *testing.T) {
+	// The second IPv4 prefix claims 33 bits.
+	nlri := []byte{24, 10, 0, 0, 33, 10, 0, 1, 0}
+	pathAttrs := append(wellKnownAttrs(), buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nlri), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Prefix != "10.0.0.0/24" || events[0].Action != "A" {
+		t.Fatalf("expected announcement of 10.0.0.0/24, got %d events", len(events))
+	}
+	if w := events[0].ParseWarnings; len(w) != 1 || w[0].Action != SessionReset || w[0].Attr != 0 {
+		t.Errorf("unexpected parse warnings %v", w)
+	}
+}
+
+func TestParseUpdate_RepeatedMPReach(t *testing.T) {
+	mpReach := buildPathAttr(0x80, AttrTypeMPReachNLRI, labeledMPReach(labelField(16, true)))
+	pathAttrs := append(wellKnownAttrs(), mpReach...)
+	pathAttrs = append(pathAttrs, mpReach...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != "A" {
+		t.Fatalf("expected 1 announcement, got %d events", len(events))
+	}
+	if w := events[0].ParseWarnings; len(w) != 1 || w[0].Action != SessionReset || w[0].Attr != AttrTypeMPReachNLRI {
+		t.Errorf("unexpected parse warnings %v", w)
+	}
+}
+
+func TestParseUpdate_NoWarnings(t *testing.T) {
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0}), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].ParseWarnings != nil {
+		t.Errorf("expected 1 event without parse warnings, got %+v", events)
+	}
+}
+
+func TestParseWarning_JSON(t *testing.T) {
+	b, err := json.Marshal([]ParseWarning{
+		{Action: TreatAsWithdraw, Attr: AttrTypeCommunity, Reason: "length 5 is not a non-zero multiple of 4"},
+		{Action: SessionReset, Reason: "nlri: truncated"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `[{"action":"treat-as-withdraw","attr":8,"reason":"length 5 is not a non-zero multiple of 4"},` +
+		`{"action":"session-reset","reason":"nlri: truncated"}]`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
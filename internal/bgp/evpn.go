@@ -0,0 +1,385 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// EVPN route types (RFC 7432 §7, RFC 9136 §3).
+const (
+	EVPNEthernetAD         uint8 = 1
+	EVPNMACIPAdvertisement uint8 = 2
+	EVPNInclusiveMulticast uint8 = 3
+	EVPNEthernetSegment    uint8 = 4
+	EVPNIPPrefix           uint8 = 5
+)
+
+// esiLen is the size of an Ethernet Segment Identifier.
+const esiLen = 10
+
+// EVPNRoute is a decoded EVPN NLRI (AFI 25, SAFI 70). Fields the route
+// type does not carry are left empty.
+type EVPNRoute struct {
+	RouteType   uint8
+	RD          string
+	ESI         string // Ethernet Segment Identifier as colon-separated hex (types 1, 2, 4, 5)
+	EthernetTag uint32 // types 1, 2, 3, 5
+	MAC         string // type 2
+	IP          string // type 2 IP address, or the originating router's IP (types 3, 4)
+	Prefix      string // type 5 IP prefix, CIDR notation
+	GatewayIP   string // type 5
+
+	// The label fields of types 1, 2 and 5 hold MPLS labels, or VNIs when
+	// the UPDATE advertises an NVO encapsulation (RFC 8365 §5.1.3).
+	// Withdrawals carry neither.
+	Labels []uint32
+	VNIs   []uint32
+
+	pathID int64
+	fields []uint32 // raw 3-octet label fields
+}
+
+// Key renders the fields that identify the route within its RD, following
+// the route key rules of RFC 7432 §7 and RFC 9136 §3.1: ESI and labels are
+// attributes of a MAC/IP route, ESI and gateway of an IP Prefix route.
+func (r *EVPNRoute) Key() string {
+	switch r.RouteType {
+	case EVPNEthernetAD:
+		return fmt.Sprintf("[1]:[%s]:[%d]", r.ESI, r.EthernetTag)
+	case EVPNMACIPAdvertisement:
+		return fmt.Sprintf("[2]:[%d]:[%s]:[%s]", r.EthernetTag, r.MAC, r.IP)
+	case EVPNInclusiveMulticast:
+		return fmt.Sprintf("[3]:[%d]:[%s]", r.EthernetTag, r.IP)
+	case EVPNEthernetSegment:
+		return fmt.Sprintf("[4]:[%s]:[%s]", r.ESI, r.IP)
+	case EVPNIPPrefix:
+		return fmt.Sprintf("[5]:[%d]:[%s]", r.EthernetTag, r.Prefix)
+	}
+	return fmt.Sprintf("[%d]", r.RouteType)
+}
+
+// nvoEncapsulations are the Encapsulation extended community values that
+// turn EVPN label fields into 24-bit VNIs (RFC 8365 §5.1.3).
+var nvoEncapsulations = []string{"ENCAP:VXLAN", "ENCAP:NVGRE", "ENCAP:VXLAN-GPE", "ENCAP:Geneve"}
+
+// withEncapsulation returns a copy of r with its label fields decoded as
+// VNIs when commExt advertises an NVO encapsulation, else as MPLS labels.
+func (r EVPNRoute) withEncapsulation(commExt []string) *EVPNRoute {
+	nvo := slices.ContainsFunc(commExt, func(c string) bool {
+		return slices.Contains(nvoEncapsulations, c)
+	})
+	for _, f := range r.fields {
+		if nvo {
+			r.VNIs = append(r.VNIs, f)
+		} else {
+			r.Labels = append(r.Labels, f>>4)
+		}
+	}
+	r.fields = nil
+	return &r
+}
+
+// parseEVPNNLRI decodes a sequence of EVPN NLRI: route type, length and a
+// type-specific body. Routes of unknown types are skipped. Label fields are
+// kept only when withLabels is set.
+func parseEVPNNLRI(data []byte, hasAddPath, withLabels bool) ([]EVPNRoute, error) {
+	var routes []EVPNRoute
+	offset := 0
+
+	for offset < len(data) {
+		var pathID int64
+		if hasAddPath {
+			if offset+4 > len(data) {
+				return routes, fmt.Errorf("bgp: evpn nlri truncated at offset %d", offset)
+			}
+			pathID = int64(binary.BigEndian.Uint32(data[offset : offset+4]))
+			offset += 4
+		}
+
+		if offset+2 > len(data) {
+			return routes, fmt.Errorf("bgp: evpn nlri truncated at offset %d", offset)
+		}
+		routeType, length := data[offset], int(data[offset+1])
+		offset += 2
+		if offset+length > len(data) {
+			return routes, fmt.Errorf("bgp: evpn nlri truncated at offset %d", offset)
+		}
+		body := data[offset : offset+length]
+		offset += length
+
+		r, known, err := decodeEVPNRoute(routeType, body)
+		if err != nil {
+			return routes, err
+		}
+		if !known {
+			continue
+		}
+		r.pathID = pathID
+		if !withLabels {
+			r.fields = nil
+		}
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
+
+func decodeEVPNRoute(routeType uint8, b []byte) (EVPNRoute, bool, error) {
+	r := EVPNRoute{RouteType: routeType}
+	malformed := fmt.Errorf("bgp: malformed evpn route type %d (%d bytes)", routeType, len(b))
+	if len(b) < RDLen {
+		if routeType >= EVPNEthernetAD && routeType <= EVPNIPPrefix {
+			return r, true, malformed
+		}
+		return r, false, nil
+	}
+	r.RD = FormatRD(b[:RDLen])
+	b = b[RDLen:]
+
+	switch routeType {
+	case EVPNEthernetAD:
+		// ESI(10) + Ethernet Tag(4) + Label(3)
+		if len(b) != esiLen+4+3 {
+			return r, true, malformed
+		}
+		r.ESI = formatESI(b[0:10])
+		r.EthernetTag = binary.BigEndian.Uint32(b[10:14])
+		r.fields = labelFields(b[14:])
+
+	case EVPNMACIPAdvertisement:
+		// ESI(10) + Ethernet Tag(4) + MAC len(1) + MAC(6) + IP len(1) +
+		// IP(0/4/16) + Label1(3) [+ Label2(3)]
+		if len(b) < esiLen+4+1+6+1+3 || b[14] != 48 {
+			return r, true, malformed
+		}
+		r.ESI = formatESI(b[0:10])
+		r.EthernetTag = binary.BigEndian.Uint32(b[10:14])
+		r.MAC = net.HardwareAddr(b[15:21]).String()
+		ip, rest, ok := evpnIP(b[21:])
+		if !ok || (len(rest) != 3 && len(rest) != 6) {
+			return r, true, malformed
+		}
+		r.IP = ip
+		r.fields = labelFields(rest)
+
+	case EVPNInclusiveMulticast:
+		// Ethernet Tag(4) + IP len(1) + Originating Router's IP(4/16)
+		if len(b) < 5 {
+			return r, true, malformed
+		}
+		r.EthernetTag = binary.BigEndian.Uint32(b[0:4])
+		ip, rest, ok := evpnIP(b[4:])
+		if !ok || ip == "" || len(rest) != 0 {
+			return r, true, malformed
+		}
+		r.IP = ip
+
+	case EVPNEthernetSegment:
+		// ESI(10) + IP len(1) + Originating Router's IP(4/16)
+		if len(b) < esiLen+1 {
+			return r, true, malformed
+		}
+		r.ESI = formatESI(b[0:10])
+		ip, rest, ok := evpnIP(b[10:])
+		if !ok || ip == "" || len(rest) != 0 {
+			return r, true, malformed
+		}
+		r.IP = ip
+
+	case EVPNIPPrefix:
+		// ESI(10) + Ethernet Tag(4) + Prefix len(1) + Prefix(4/16) +
+		// Gateway IP(4/16) + Label(3); the address family follows from
+		// the route length (RFC 9136 §3.1).
+		var addrLen int
+		switch len(b) {
+		case esiLen + 4 + 1 + 2*4 + 3:
+			addrLen = 4
+		case esiLen + 4 + 1 + 2*16 + 3:
+			addrLen = 16
+		default:
+			return r, true, malformed
+		}
+		prefixLen := int(b[14])
+		if prefixLen > addrLen*8 {
+			return r, true, malformed
+		}
+		r.ESI = formatESI(b[0:10])
+		r.EthernetTag = binary.BigEndian.Uint32(b[10:14])
+		prefix := net.IP(b[15 : 15+addrLen]).Mask(net.CIDRMask(prefixLen, addrLen*8))
+		r.Prefix = fmt.Sprintf("%s/%d", prefix, prefixLen)
+		r.GatewayIP = net.IP(b[15+addrLen : 15+2*addrLen]).String()
+		r.fields = labelFields(b[15+2*addrLen:])
+
+	default:
+		return r, false, nil
+	}
+
+	return r, true, nil
+}
+
+// evpnIP reads a length-prefixed IP address (length in bits: 0, 32 or
+// 128) and returns it with the remaining bytes.
+func evpnIP(b []byte) (ip string, rest []byte, ok bool) {
+	if len(b) < 1 {
+		return "", nil, false
+	}
+	n := int(b[0]) / 8
+	if (n != 0 && n != 4 && n != 16) || len(b) < 1+n {
+		return "", nil, false
+	}
+	if n > 0 {
+		ip = net.IP(b[1 : 1+n]).String()
+	}
+	return ip, b[1+n:], true
+}
+
+// labelFields splits b into 3-octet label fields.
+func labelFields(b []byte) []uint32 {
+	var fields []uint32
+	for ; len(b) >= 3; b = b[3:] {
+		fields = append(fields, uint32(b[0])<<16|uint32(b[1])<<8|uint32(b[2]))
+	}
+	return fields
+}
+
+func formatESI(b []byte) string {
+	return net.HardwareAddr(b).String()
+}
+
+// parseESI parses an Ethernet Segment Identifier rendered by formatESI. An
+// empty ESI is all zeros.
+func parseESI(s string) ([esiLen]byte, error) {
+	var esi [esiLen]byte
+	if s == "" {
+		return esi, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != esiLen {
+		return esi, fmt.Errorf("bgp: invalid ESI %q", s)
+	}
+	for i, part := range parts {
+		if len(part) != 2 {
+			return esi, fmt.Errorf("bgp: invalid ESI %q", s)
+		}
+		if _, err := hex.Decode(esi[i:i+1], []byte(part)); err != nil {
+			return esi, fmt.Errorf("bgp: invalid ESI %q", s)
+		}
+	}
+	return esi, nil
+}
+
+// appendEVPNRoute appends the NLRI of an EVPN route, the inverse of
+// decodeEVPNRoute. The label fields carry r's VNIs if it has any, else its
+// MPLS labels; a route without either, such as a withdrawal, carries a
+// zero label field where its type requires one.
+func appendEVPNRoute(dst []byte, r *EVPNRoute) ([]byte, error) {
+	rd, err := ParseRD(r.RD)
+	if err != nil {
+		return dst, err
+	}
+	esi, err := parseESI(r.ESI)
+	if err != nil {
+		return dst, err
+	}
+	fields := r.VNIs
+	if fields == nil {
+		for _, label := range r.Labels {
+			fields = append(fields, label<<4|0x01) // Bottom of Stack
+		}
+	}
+	appendFields := func(dst []byte, max int) ([]byte, error) {
+		if len(fields) > max {
+			return dst, fmt.Errorf("bgp: evpn route type %d carries at most %d labels, got %d", r.RouteType, max, len(fields))
+		}
+		if len(fields) == 0 {
+			return append(dst, 0, 0, 0), nil
+		}
+		for _, f := range fields {
+			dst = append(dst, byte(f>>16), byte(f>>8), byte(f))
+		}
+		return dst, nil
+	}
+
+	start := len(dst)
+	dst = append(dst, r.RouteType, 0)
+	dst = append(dst, rd[:]...)
+	switch r.RouteType {
+	case EVPNEthernetAD:
+		dst = append(dst, esi[:]...)
+		dst = binary.BigEndian.AppendUint32(dst, r.EthernetTag)
+		dst, err = appendFields(dst, 1)
+
+	case EVPNMACIPAdvertisement:
+		mac, _ := net.ParseMAC(r.MAC)
+		if len(mac) != 6 {
+			return dst, fmt.Errorf("bgp: invalid evpn MAC address %q", r.MAC)
+		}
+		dst = append(dst, esi[:]...)
+		dst = binary.BigEndian.AppendUint32(dst, r.EthernetTag)
+		dst = append(dst, 48)
+		dst = append(dst, mac...)
+		if dst, err = appendEVPNIP(dst, r.IP); err != nil {
+			return dst, err
+		}
+		dst, err = appendFields(dst, 2)
+
+	case EVPNInclusiveMulticast, EVPNEthernetSegment:
+		if r.IP == "" {
+			return dst, fmt.Errorf("bgp: evpn route type %d has no originating router's IP", r.RouteType)
+		}
+		if r.RouteType == EVPNInclusiveMulticast {
+			dst = binary.BigEndian.AppendUint32(dst, r.EthernetTag)
+		} else {
+			dst = append(dst, esi[:]...)
+		}
+		dst, err = appendEVPNIP(dst, r.IP)
+
+	case EVPNIPPrefix:
+		var prefix netip.Prefix
+		if prefix, err = netip.ParsePrefix(r.Prefix); err != nil {
+			return dst, fmt.Errorf("bgp: invalid evpn prefix %q", r.Prefix)
+		}
+		gw := netip.IPv4Unspecified()
+		if prefix.Addr().Is6() {
+			gw = netip.IPv6Unspecified()
+		}
+		if r.GatewayIP != "" {
+			if gw, err = netip.ParseAddr(r.GatewayIP); err != nil || gw.Is4() != prefix.Addr().Is4() {
+				return dst, fmt.Errorf("bgp: invalid evpn gateway IP %q", r.GatewayIP)
+			}
+		}
+		dst = append(dst, esi[:]...)
+		dst = binary.BigEndian.AppendUint32(dst, r.EthernetTag)
+		dst = append(dst, byte(prefix.Bits()))
+		dst = append(dst, prefix.Masked().Addr().AsSlice()...)
+		dst = append(dst, gw.AsSlice()...)
+		dst, err = appendFields(dst, 1)
+
+	default:
+		return dst, fmt.Errorf("bgp: encoding evpn route type %d is not supported", r.RouteType)
+	}
+	if err != nil {
+		return dst, err
+	}
+	dst[start+1] = byte(len(dst) - start - 2)
+	return dst, nil
+}
+
+// appendEVPNIP appends a length-prefixed IP address as evpnIP reads it. An
+// empty address has length 0.
+func appendEVPNIP(dst []byte, s string) ([]byte, error) {
+	if s == "" {
+		return append(dst, 0), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return dst, fmt.Errorf("bgp: invalid evpn IP address %q", s)
+	}
+	dst = append(dst, byte(addr.BitLen()))
+	return append(dst, addr.AsSlice()...), nil
+}
@@ -0,0 +1,180 @@
+package bgp
+
+import (
+	"slices"
+	"testing"
+)
+
+var (
+	testRD  = []byte{0, 1, 10, 0, 0, 1, 0, 100} // 10.0.0.1:100
+	testESI = []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99}
+)
+
+// evpnNLRI builds one EVPN NLRI of the given route type: RD followed by body.
+func evpnNLRI(routeType uint8, body ...[]byte) []byte {
+	b := append([]byte{}, testRD...)
+	for _, part := range body {
+		b = append(b, part...)
+	}
+	return append([]byte{routeType, byte(len(b))}, b...)
+}
+
+// evpnUpdate wraps EVPN NLRI in MP_REACH_NLRI with next hop 192.0.2.1 and
+// the given extended communities.
+func evpnUpdate(nlri []byte, extComms ...[]byte) []byte {
+	mpReach := []byte{0, 25, SAFIEVPN, 4, 192, 0, 2, 1, 0}
+	mpReach = append(mpReach, nlri...)
+	pathAttrs := wellKnownAttrs()
+	if len(extComms) > 0 {
+		var ec []byte
+		for _, c := range extComms {
+			ec = append(ec, c...)
+		}
+		pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeExtCommunity, ec)...)
+	}
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	return buildBGPUpdate(nil, pathAttrs, nil)
+}
+
+func TestParseUpdate_EVPNRouteTypes(t *testing.T) {
+	mac := []byte{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	tag := []byte{0, 0, 0, 10}
+	var nlri []byte
+	nlri = append(nlri, evpnNLRI(EVPNEthernetAD, testESI, tag, labelField(100, true))...)
+	nlri = append(nlri, evpnNLRI(EVPNMACIPAdvertisement, testESI, tag, []byte{48}, mac,
+		[]byte{32, 10, 1, 1, 5}, labelField(200, true), labelField(300, true))...)
+	nlri = append(nlri, evpnNLRI(EVPNInclusiveMulticast, tag, []byte{32, 192, 0, 2, 1})...)
+	nlri = append(nlri, evpnNLRI(EVPNEthernetSegment, testESI, []byte{32, 192, 0, 2, 1})...)
+	nlri = append(nlri, evpnNLRI(EVPNIPPrefix, testESI, tag, []byte{24, 10, 2, 3, 0}, []byte{0, 0, 0, 0}, labelField(400, true))...)
+
+	events, err := ParseUpdate(evpnUpdate(nlri), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(events))
+	}
+
+	wantKeys := []string{
+		"[1]:[00:11:22:33:44:55:66:77:88:99]:[10]",
+		"[2]:[10]:[00:aa:bb:cc:dd:ee]:[10.1.1.5]",
+		"[3]:[10]:[192.0.2.1]",
+		"[4]:[00:11:22:33:44:55:66:77:88:99]:[192.0.2.1]",
+		"[5]:[10]:[10.2.3.0/24]",
+	}
+	for i, ev := range events {
+		if ev.EVPN == nil {
+			t.Fatalf("event %d: expected EVPN route", i)
+		}
+		if ev.AFI != int(AFIL2VPN) || ev.SAFI != SAFIEVPN || ev.Action != "A" || ev.Prefix != "" {
+			t.Errorf("event %d: unexpected %d/%d %s %q", i, ev.AFI, ev.SAFI, ev.Action, ev.Prefix)
+		}
+		if ev.EVPN.RouteType != uint8(i+1) || ev.EVPN.RD != "10.0.0.1:100" {
+			t.Errorf("event %d: unexpected type %d rd %s", i, ev.EVPN.RouteType, ev.EVPN.RD)
+		}
+		if got := ev.EVPN.Key(); got != wantKeys[i] {
+			t.Errorf("event %d: key = %s, want %s", i, got, wantKeys[i])
+		}
+		if ev.Nexthop != "192.0.2.1" {
+			t.Errorf("event %d: expected nexthop 192.0.2.1, got %s", i, ev.Nexthop)
+		}
+	}
+
+	macIP := events[1].EVPN
+	if macIP.ESI != "00:11:22:33:44:55:66:77:88:99" || macIP.MAC != "00:aa:bb:cc:dd:ee" || macIP.IP != "10.1.1.5" {
+		t.Errorf("unexpected MAC/IP route %+v", macIP)
+	}
+	if !slices.Equal(macIP.Labels, []uint32{200, 300}) || macIP.VNIs != nil {
+		t.Errorf("expected MPLS labels [200 300], got %v / VNIs %v", macIP.Labels, macIP.VNIs)
+	}
+	if !slices.Equal(events[0].EVPN.Labels, []uint32{100}) {
+		t.Errorf("expected A-D label 100, got %v", events[0].EVPN.Labels)
+	}
+	if events[2].EVPN.Labels != nil {
+		t.Errorf("expected no labels on IMET route, got %v", events[2].EVPN.Labels)
+	}
+	prefix := events[4].EVPN
+	if prefix.Prefix != "10.2.3.0/24" || prefix.GatewayIP != "0.0.0.0" || !slices.Equal(prefix.Labels, []uint32{400}) {
+		t.Errorf("unexpected IP Prefix route %+v", prefix)
+	}
+}
+
+func TestParseUpdate_EVPNVXLAN(t *testing.T) {
+	// MAC-only route with VNI 10100 in the label field and the VXLAN
+	// encapsulation community.
+	vni := []byte{0x00, 0x27, 0x74}
+	nlri := evpnNLRI(EVPNMACIPAdvertisement, make([]byte, 10), []byte{0, 0, 0, 0}, []byte{48},
+		[]byte{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}, []byte{0}, vni)
+	encap := []byte{0x03, 0x0c, 0, 0, 0, 0, 0, 8}
+
+	events, err := ParseUpdate(evpnUpdate(nlri, encap), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	r := events[0].EVPN
+	if !slices.Equal(r.VNIs, []uint32{10100}) || r.Labels != nil {
+		t.Errorf("expected VNI 10100, got VNIs %v labels %v", r.VNIs, r.Labels)
+	}
+	if r.IP != "" || r.Key() != "[2]:[0]:[00:aa:bb:cc:dd:ee]:[]" {
+		t.Errorf("unexpected MAC-only route %+v key %s", r, r.Key())
+	}
+}
+
+func TestParseUpdate_EVPNWithdrawal(t *testing.T) {
+	nlri := evpnNLRI(EVPNIPPrefix, testESI, []byte{0, 0, 0, 0},
+		[]byte{64, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}, make([]byte, 16), labelField(0, true))
+	mpUnreach := append([]byte{0, 25, SAFIEVPN}, nlri...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, mpUnreach), nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "D" || ev.EVPN == nil || ev.EVPN.Prefix != "2001:db8:0:1::/64" {
+		t.Fatalf("unexpected withdrawal %+v", ev)
+	}
+	if ev.EVPN.Labels != nil || ev.EVPN.VNIs != nil {
+		t.Errorf("expected withdrawal without labels, got %v / %v", ev.EVPN.Labels, ev.EVPN.VNIs)
+	}
+}
+
+func TestParseEVPNNLRI_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		nlri []byte
+	}{
+		{"short A-D", evpnNLRI(EVPNEthernetAD, testESI)},
+		{"bad MAC length", evpnNLRI(EVPNMACIPAdvertisement, testESI, []byte{0, 0, 0, 0}, []byte{32},
+			[]byte{1, 2, 3, 4, 5, 6}, []byte{0}, labelField(1, true))},
+		{"bad IP length", evpnNLRI(EVPNInclusiveMulticast, []byte{0, 0, 0, 0}, []byte{24, 1, 2, 3})},
+		{"IP prefix length", evpnNLRI(EVPNIPPrefix, testESI, []byte{0, 0, 0, 0}, []byte{33, 10, 0, 0, 0}, []byte{0, 0, 0, 0}, labelField(0, true))},
+		{"truncated", []byte{EVPNEthernetAD, 25, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseEVPNNLRI(tt.nlri, false, true); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	// Unknown route types are skipped.
+	routes, err := parseEVPNNLRI(append([]byte{9, 2, 0, 0}, evpnNLRI(EVPNInclusiveMulticast, []byte{0, 0, 0, 0}, []byte{32, 192, 0, 2, 1})...), false, true)
+	if err != nil || len(routes) != 1 || routes[0].RouteType != EVPNInclusiveMulticast {
+		t.Errorf("expected the IMET route after an unknown type, got %+v, %v", routes, err)
+	}
+}
+
+func TestDetectEORFamily_EVPN(t *testing.T) {
+	data := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, []byte{0, 25, SAFIEVPN}), nil)
+	afi, safi := DetectEORFamily(data)
+	if afi != int(AFIL2VPN) || safi != SAFIEVPN {
+		t.Errorf("expected 25/70, got %d/%d", afi, safi)
+	}
+}
@@ -0,0 +1,433 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// extCommType identifies an extended community by its type high octet,
+// with the transitive bit (0x40) cleared, and its sub-type.
+type extCommType struct {
+	high, low uint8
+}
+
+// extCommDecoders render the 6-byte value of an extended community
+// (RFC 4360). Types not listed fall back to hex.
+var extCommDecoders = map[extCommType]func(v []byte) string{
+	// 2-Octet AS Specific
+	{0x00, 0x02}: as2Specific("RT"),
+	{0x00, 0x03}: as2Specific("SOO"),
+	{0x00, 0x04}: linkBandwidth,
+	{0x00, 0x05}: as2Specific("OSPF-DOMAIN"),
+
+	// IPv4 Address Specific
+	{0x01, 0x02}: ipv4Specific("RT"),
+	{0x01, 0x03}: ipv4Specific("SOO"),
+	{0x01, 0x05}: ipv4Specific("OSPF-DOMAIN"),
+	{0x01, 0x07}: ospfRouterID,
+	{0x01, 0x0b}: ipv4Specific("RT-IMPORT"),
+
+	// 4-Octet AS Specific
+	{0x02, 0x02}: as4Specific("RT"),
+	{0x02, 0x03}: as4Specific("SOO"),
+	{0x02, 0x05}: as4Specific("OSPF-DOMAIN"),
+
+	// Opaque
+	{0x03, 0x06}: ospfRouteType,
+	{0x03, 0x0b}: color,
+	{0x03, 0x0c}: encapsulation,
+	{0x03, 0x0d}: func([]byte) string { return "DEFAULT-GATEWAY" },
+
+	// EVPN (RFC 7432, RFC 9135)
+	{0x06, 0x00}: macMobility,
+	{0x06, 0x01}: esiLabel,
+	{0x06, 0x02}: func(v []byte) string { return "ES-IMPORT:" + net.HardwareAddr(v).String() },
+	{0x06, 0x03}: func(v []byte) string { return "ROUTER-MAC:" + net.HardwareAddr(v).String() },
+
+	// Flow Specification traffic actions (RFC 8955 §7)
+	{0x80, 0x06}: trafficRate("RATE"),
+	{0x80, 0x07}: trafficAction,
+	{0x80, 0x08}: as2Specific("REDIRECT"),
+	{0x80, 0x09}: func(v []byte) string { return fmt.Sprintf("MARK:%d", v[5]&0x3F) },
+	{0x80, 0x0c}: trafficRate("RATE-PACKETS"),
+	{0x81, 0x08}: ipv4Specific("REDIRECT"),
+	{0x82, 0x08}: as4Specific("REDIRECT"),
+}
+
+// decodeExtCommunity decodes a single 8-byte extended community into a
+// human-readable "NAME:value" string using extCommDecoders. Unknown opaque
+// sub-types render as "OPAQUE:<subtype>:<hex value>"; anything else falls
+// back to hex of the whole community.
+func decodeExtCommunity(data []byte) string {
+	key := extCommType{high: data[0] &^ 0x40, low: data[1]}
+	if decode, ok := extCommDecoders[key]; ok {
+		return decode(data[2:8])
+	}
+	if key.high == 0x03 {
+		return fmt.Sprintf("OPAQUE:%02x:%s", key.low, hex.EncodeToString(data[2:8]))
+	}
+	return hex.EncodeToString(data)
+}
+
+// decodeIPv6ExtCommunity decodes a single 20-byte IPv6 Address Specific
+// extended community (RFC 5701). Falls back to hex for unknown sub-types.
+func decodeIPv6ExtCommunity(data []byte) string {
+	ip := net.IP(data[2:18]).String()
+	val := binary.BigEndian.Uint16(data[18:20])
+	if data[0]&^0x40 == 0x00 {
+		switch data[1] {
+		case 0x02:
+			return fmt.Sprintf("RT:%s:%d", ip, val)
+		case 0x03:
+			return fmt.Sprintf("SOO:%s:%d", ip, val)
+		case 0x0b:
+			return fmt.Sprintf("RT-IMPORT:%s:%d", ip, val)
+		}
+	}
+	return hex.EncodeToString(data)
+}
+
+func as2Specific(name string) func(v []byte) string {
+	return func(v []byte) string {
+		return fmt.Sprintf("%s:%d:%d", name, binary.BigEndian.Uint16(v[0:2]), binary.BigEndian.Uint32(v[2:6]))
+	}
+}
+
+func ipv4Specific(name string) func(v []byte) string {
+	return func(v []byte) string {
+		return fmt.Sprintf("%s:%s:%d", name, net.IP(v[0:4]), binary.BigEndian.Uint16(v[4:6]))
+	}
+}
+
+func as4Specific(name string) func(v []byte) string {
+	return func(v []byte) string {
+		return fmt.Sprintf("%s:%d:%d", name, binary.BigEndian.Uint32(v[0:4]), binary.BigEndian.Uint16(v[4:6]))
+	}
+}
+
+// formatFloat32 renders an IEEE 754 single-precision value without an
+// exponent, e.g. bandwidth in bytes per second.
+func formatFloat32(b []byte) string {
+	return strconv.FormatFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(b))), 'f', -1, 32)
+}
+
+// linkBandwidth renders "LB:<ASN>:<bytes per second>".
+func linkBandwidth(v []byte) string {
+	return fmt.Sprintf("LB:%d:%s", binary.BigEndian.Uint16(v[0:2]), formatFloat32(v[2:6]))
+}
+
+// trafficRate renders "<name>:<ASN>:<rate>"; a rate of 0 discards traffic.
+func trafficRate(name string) func(v []byte) string {
+	return func(v []byte) string {
+		return fmt.Sprintf("%s:%d:%s", name, binary.BigEndian.Uint16(v[0:2]), formatFloat32(v[2:6]))
+	}
+}
+
+// trafficAction renders the Sample and Terminal Action flags, e.g.
+// "TRAFFIC-ACTION:sample,terminal".
+func trafficAction(v []byte) string {
+	var flags []string
+	if v[5]&0x02 != 0 {
+		flags = append(flags, "sample")
+	}
+	if v[5]&0x01 != 0 {
+		flags = append(flags, "terminal")
+	}
+	if len(flags) == 0 {
+		return "TRAFFIC-ACTION:none"
+	}
+	return "TRAFFIC-ACTION:" + strings.Join(flags, ",")
+}
+
+func ospfRouterID(v []byte) string {
+	return "OSPF-ROUTER-ID:" + net.IP(v[0:4]).String()
+}
+
+// ospfRouteType renders "OSPF-RT:<area>:<route type>:<options>" (RFC 4577).
+func ospfRouteType(v []byte) string {
+	return fmt.Sprintf("OSPF-RT:%s:%d:%d", net.IP(v[0:4]), v[4], v[5])
+}
+
+// color renders "COLOR:<CO bits>:<color>" (RFC 9012 §4.3, RFC 9256
+// §8.8), the CO bits in binary as in "COLOR:00:100".
+func color(v []byte) string {
+	return fmt.Sprintf("COLOR:%02b:%d", v[0]>>6, binary.BigEndian.Uint32(v[2:6]))
+}
+
+// tunnelTypes names BGP Tunnel Encapsulation types (RFC 9012 §14.3).
+var tunnelTypes = map[uint16]string{
+	1:  "L2TPv3",
+	2:  "GRE",
+	7:  "IP-in-IP",
+	8:  "VXLAN",
+	9:  "NVGRE",
+	10: "MPLS",
+	11: "MPLS-in-GRE",
+	12: "VXLAN-GPE",
+	13: "MPLS-in-UDP",
+	15: "SR-Policy",
+	19: "Geneve",
+}
+
+func encapsulation(v []byte) string {
+	t := binary.BigEndian.Uint16(v[4:6])
+	if name, ok := tunnelTypes[t]; ok {
+		return "ENCAP:" + name
+	}
+	return fmt.Sprintf("ENCAP:%d", t)
+}
+
+// macMobility renders "MAC-MOBILITY:<sequence>", with ":sticky" for
+// static MACs (RFC 7432 §7.7).
+func macMobility(v []byte) string {
+	s := fmt.Sprintf("MAC-MOBILITY:%d", binary.BigEndian.Uint32(v[2:6]))
+	if v[0]&0x01 != 0 {
+		s += ":sticky"
+	}
+	return s
+}
+
+// esiLabel renders "ESI-LABEL:<label>", with ":single-active" when the
+// Ethernet Segment is not all-active (RFC 7432 §7.5).
+func esiLabel(v []byte) string {
+	label := (uint32(v[3])<<16 | uint32(v[4])<<8 | uint32(v[5])) >> 4
+	s := fmt.Sprintf("ESI-LABEL:%d", label)
+	if v[0]&0x01 != 0 {
+		s += ":single-active"
+	}
+	return s
+}
+
+// encodeExtCommunity encodes an extended community rendered by
+// decodeExtCommunity or decodeIPv6ExtCommunity: 8 octets, or 20 for an
+// IPv6 Address Specific one. Types whose rendering drops the transitive
+// bit are encoded with their usual value.
+func encodeExtCommunity(s string) ([]byte, error) {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		if s == "DEFAULT-GATEWAY" {
+			return []byte{0x03, 0x0d, 0, 0, 0, 0, 0, 0}, nil
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil || (len(b) != 8 && len(b) != 20) {
+			return nil, fmt.Errorf("bgp: invalid extended community %q", s)
+		}
+		return b, nil
+	}
+
+	b := make([]byte, 8)
+	var err error
+	switch name {
+	case "RT", "SOO", "OSPF-DOMAIN", "RT-IMPORT", "REDIRECT":
+		return parseAddrSpecificExtCommunity(name, value)
+	case "LB", "RATE", "RATE-PACKETS":
+		// Link Bandwidth is non-transitive.
+		t := rateExtCommTypes[name]
+		b[0], b[1] = t.high, t.low
+		asn, rate, _ := strings.Cut(value, ":")
+		var f float64
+		if err = putUint(b[2:4], asn); err == nil {
+			f, err = strconv.ParseFloat(rate, 32)
+			binary.BigEndian.PutUint32(b[4:8], math.Float32bits(float32(f)))
+		}
+	case "TRAFFIC-ACTION":
+		b[0], b[1] = 0x80, 0x07
+		if value != "none" {
+			for _, flag := range strings.Split(value, ",") {
+				switch flag {
+				case "sample":
+					b[7] |= 0x02
+				case "terminal":
+					b[7] |= 0x01
+				default:
+					err = fmt.Errorf("unknown flag %q", flag)
+				}
+			}
+		}
+	case "MARK":
+		b[0], b[1] = 0x80, 0x09
+		var dscp uint64
+		if dscp, err = strconv.ParseUint(value, 10, 6); err == nil {
+			b[7] = uint8(dscp)
+		}
+	case "OSPF-ROUTER-ID":
+		b[0], b[1] = 0x01, 0x07
+		err = putIPv4(b[2:6], value)
+	case "OSPF-RT":
+		b[0], b[1] = 0x03, 0x06
+		f := strings.Split(value, ":")
+		if len(f) != 3 {
+			err = fmt.Errorf("want area:type:options")
+		} else if err = putIPv4(b[2:6], f[0]); err == nil {
+			if err = putUint(b[6:7], f[1]); err == nil {
+				err = putUint(b[7:8], f[2])
+			}
+		}
+	case "COLOR":
+		b[0], b[1] = 0x03, 0x0b
+		co, c, _ := strings.Cut(value, ":")
+		var bits uint64
+		if bits, err = strconv.ParseUint(co, 2, 2); err == nil {
+			b[2] = uint8(bits) << 6
+			err = putUint(b[4:8], c)
+		}
+	case "ENCAP":
+		b[0], b[1] = 0x03, 0x0c
+		err = putUint(b[6:8], value)
+		for t, n := range tunnelTypes {
+			if n == value {
+				binary.BigEndian.PutUint16(b[6:8], t)
+				err = nil
+			}
+		}
+	case "MAC-MOBILITY":
+		b[0], b[1] = 0x06, 0x00
+		seq, flag, _ := strings.Cut(value, ":")
+		err = putUint(b[4:8], seq)
+		if flag == "sticky" {
+			b[2] = 0x01
+		} else if flag != "" {
+			err = fmt.Errorf("unknown flag %q", flag)
+		}
+	case "ESI-LABEL":
+		b[0], b[1] = 0x06, 0x01
+		label, flag, _ := strings.Cut(value, ":")
+		var l uint64
+		if l, err = strconv.ParseUint(label, 10, 20); err == nil {
+			l <<= 4
+			b[5], b[6], b[7] = byte(l>>16), byte(l>>8), byte(l)
+		}
+		if flag == "single-active" {
+			b[2] = 0x01
+		} else if flag != "" {
+			err = fmt.Errorf("unknown flag %q", flag)
+		}
+	case "ES-IMPORT", "ROUTER-MAC":
+		b[0], b[1] = 0x06, 0x02
+		if name == "ROUTER-MAC" {
+			b[1] = 0x03
+		}
+		var mac net.HardwareAddr
+		if mac, err = net.ParseMAC(value); err == nil && len(mac) != 6 {
+			err = fmt.Errorf("not a 6-octet MAC address")
+		}
+		copy(b[2:8], mac)
+	case "OPAQUE":
+		sub, v, _ := strings.Cut(value, ":")
+		b[0] = 0x03
+		if len(sub) != 2 || len(v) != 12 {
+			err = fmt.Errorf("want <sub-type>:<6-octet value>")
+		} else if _, err = hex.Decode(b[1:2], []byte(sub)); err == nil {
+			_, err = hex.Decode(b[2:8], []byte(v))
+		}
+	default:
+		err = fmt.Errorf("unknown type")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bgp: invalid extended community %q: %w", s, err)
+	}
+	return b, nil
+}
+
+// rateExtCommTypes are the types of the extended communities rendered as
+// "<name>:<ASN>:<rate>".
+var rateExtCommTypes = map[string]extCommType{
+	"LB":           {0x40, 0x04},
+	"RATE":         {0x80, 0x06},
+	"RATE-PACKETS": {0x80, 0x0c},
+}
+
+// addrSpecificSubTypes are the sub-types of the extended communities
+// rendered as "<name>:<administrator>:<number>".
+var addrSpecificSubTypes = map[string]uint8{
+	"RT":          0x02,
+	"SOO":         0x03,
+	"OSPF-DOMAIN": 0x05,
+	"REDIRECT":    0x08,
+	"RT-IMPORT":   0x0b,
+}
+
+// parseAddrSpecificExtCommunity encodes "<name>:<admin>:<assigned>",
+// choosing the 2-octet AS, IPv4, 4-octet AS or IPv6 Address Specific type
+// the administrator field and number fit.
+func parseAddrSpecificExtCommunity(name, value string) ([]byte, error) {
+	sub := addrSpecificSubTypes[name]
+	high := uint8(0x00)
+	if name == "REDIRECT" {
+		high = 0x80
+	}
+	fail := func() ([]byte, error) {
+		return nil, fmt.Errorf("bgp: invalid extended community %q", name+":"+value)
+	}
+
+	i := strings.LastIndexByte(value, ':')
+	if i < 0 {
+		return fail()
+	}
+	admin, assigned := value[:i], value[i+1:]
+	if addr, err := netip.ParseAddr(admin); err == nil {
+		n, err := strconv.ParseUint(assigned, 10, 16)
+		switch {
+		case err != nil:
+			return fail()
+		case addr.Is4():
+			b := []byte{high | 0x01, sub}
+			b = append(b, addr.AsSlice()...)
+			return binary.BigEndian.AppendUint16(b, uint16(n)), nil
+		case name == "RT" || name == "SOO" || name == "RT-IMPORT":
+			b := []byte{0x00, sub}
+			b = append(b, addr.AsSlice()...)
+			return binary.BigEndian.AppendUint16(b, uint16(n)), nil
+		}
+		return fail()
+	}
+	if name == "RT-IMPORT" {
+		return fail()
+	}
+
+	asn, err1 := strconv.ParseUint(admin, 10, 32)
+	n, err2 := strconv.ParseUint(assigned, 10, 32)
+	switch {
+	case err1 != nil || err2 != nil:
+		return fail()
+	case asn <= 0xFFFF:
+		b := []byte{high, sub}
+		b = binary.BigEndian.AppendUint16(b, uint16(asn))
+		return binary.BigEndian.AppendUint32(b, uint32(n)), nil
+	case n <= 0xFFFF:
+		b := []byte{high | 0x02, sub}
+		b = binary.BigEndian.AppendUint32(b, uint32(asn))
+		return binary.BigEndian.AppendUint16(b, uint16(n)), nil
+	}
+	return fail()
+}
+
+// putUint parses s as a decimal number that fits in len(b) octets and
+// stores it in b, big-endian.
+func putUint(b []byte, s string) error {
+	v, err := strconv.ParseUint(s, 10, 8*len(b))
+	if err != nil {
+		return err
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return nil
+}
+
+// putIPv4 parses s as an IPv4 address and stores it in b.
+func putIPv4(b []byte, s string) error {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is4() {
+		return fmt.Errorf("invalid IPv4 address %q", s)
+	}
+	copy(b, addr.AsSlice())
+	return nil
+}
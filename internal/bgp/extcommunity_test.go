@@ -0,0 +1,113 @@
+package bgp
+
+import "testing"
+
+func TestDecodeExtCommunity_Table(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"link bandwidth", []byte{0x40, 0x04, 0xFD, 0xE9, 0x4C, 0xEE, 0x6B, 0x28}, "LB:65001:125000000"},
+		{"OSPF domain ID", []byte{0x01, 0x05, 10, 0, 0, 1, 0, 0}, "OSPF-DOMAIN:10.0.0.1:0"},
+		{"OSPF route type", []byte{0x43, 0x06, 0, 0, 0, 0, 5, 1}, "OSPF-RT:0.0.0.0:5:1"},
+		{"OSPF router ID", []byte{0x41, 0x07, 10, 0, 0, 2, 0, 0}, "OSPF-ROUTER-ID:10.0.0.2"},
+		{"VRF route import", []byte{0x01, 0x0b, 10, 0, 0, 1, 0, 7}, "RT-IMPORT:10.0.0.1:7"},
+		{"color", []byte{0x03, 0x0b, 0, 0, 0, 0, 0, 100}, "COLOR:00:100"},
+		{"color with CO bits", []byte{0x03, 0x0b, 0x40, 0, 0, 0, 0, 100}, "COLOR:01:100"},
+		{"encapsulation VXLAN", []byte{0x03, 0x0c, 0, 0, 0, 0, 0, 8}, "ENCAP:VXLAN"},
+		{"encapsulation unknown", []byte{0x03, 0x0c, 0, 0, 0, 0, 0, 99}, "ENCAP:99"},
+		{"default gateway", []byte{0x03, 0x0d, 0, 0, 0, 0, 0, 0}, "DEFAULT-GATEWAY"},
+		{"opaque unknown", []byte{0x43, 0x99, 1, 2, 3, 4, 5, 6}, "OPAQUE:99:010203040506"},
+		{"MAC mobility", []byte{0x06, 0x00, 0, 0, 0, 0, 0, 3}, "MAC-MOBILITY:3"},
+		{"MAC mobility sticky", []byte{0x06, 0x00, 1, 0, 0, 0, 0, 0}, "MAC-MOBILITY:0:sticky"},
+		{"ESI label", []byte{0x06, 0x01, 1, 0, 0, 0x00, 0x3E, 0x80}, "ESI-LABEL:1000:single-active"},
+		{"ES-import", []byte{0x06, 0x02, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, "ES-IMPORT:00:11:22:33:44:55"},
+		{"router MAC", []byte{0x06, 0x03, 0x00, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE}, "ROUTER-MAC:00:aa:bb:cc:dd:ee"},
+		{"flowspec discard", []byte{0x80, 0x06, 0, 0, 0, 0, 0, 0}, "RATE:0:0"},
+		{"flowspec rate", []byte{0x80, 0x06, 0xFD, 0xE9, 0x4C, 0xEE, 0x6B, 0x28}, "RATE:65001:125000000"},
+		{"flowspec action", []byte{0x80, 0x07, 0, 0, 0, 0, 0, 0x03}, "TRAFFIC-ACTION:sample,terminal"},
+		{"flowspec redirect AS2", []byte{0x80, 0x08, 0xFD, 0xE9, 0, 0, 0, 10}, "REDIRECT:65001:10"},
+		{"flowspec redirect IPv4", []byte{0x81, 0x08, 192, 0, 2, 1, 0, 10}, "REDIRECT:192.0.2.1:10"},
+		{"flowspec redirect AS4", []byte{0x82, 0x08, 0xFA, 0x56, 0xEA, 0x01, 0, 10}, "REDIRECT:4200000001:10"},
+		{"flowspec marking", []byte{0x80, 0x09, 0, 0, 0, 0, 0, 46}, "MARK:46"},
+		{"IANA authority bit is not masked", []byte{0x80, 0x02, 0xFB, 0xF0, 0, 0, 0, 100}, "8002fbf000000064"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeExtCommunity(tt.data); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseUpdate_IPv6ExtCommunities(t *testing.T) {
+	rt := []byte{0x00, 0x02, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 100}
+	unknown := []byte{0x00, 0x99, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeExtCommunity, []byte{0x00, 0x02, 0xFB, 0xF0, 0, 0, 0, 100})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeIPv6ExtCommunity, append(rt, unknown...))...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0}), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	want := []string{"RT:64496:100", "RT:2001:db8::1:100", "0099000000000000000000000000000000000001"}
+	if len(events[0].CommExt) != len(want) {
+		t.Fatalf("expected %v, got %v", want, events[0].CommExt)
+	}
+	for i, w := range want {
+		if events[0].CommExt[i] != w {
+			t.Errorf("CommExt[%d]: expected %q, got %q", i, w, events[0].CommExt[i])
+		}
+	}
+	if _, ok := events[0].Attrs["25"]; ok {
+		t.Error("expected attribute 25 to be consumed, found it in Attrs")
+	}
+}
+
+func TestEncodeExtCommunity_RoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"RT:64496:100", "RT:4200000001:7", "RT:192.0.2.1:7", "SOO:65001:4294967295",
+		"OSPF-DOMAIN:10.0.0.1:0", "RT-IMPORT:10.0.0.1:7", "LB:65001:125000000", "LB:1:0.5",
+		"OSPF-RT:0.0.0.0:5:1", "OSPF-ROUTER-ID:10.0.0.2", "COLOR:01:100", "ENCAP:VXLAN", "ENCAP:99",
+		"DEFAULT-GATEWAY", "OPAQUE:99:010203040506", "MAC-MOBILITY:3", "MAC-MOBILITY:0:sticky",
+		"ESI-LABEL:1000:single-active", "ESI-LABEL:16", "ES-IMPORT:00:11:22:33:44:55",
+		"ROUTER-MAC:00:aa:bb:cc:dd:ee", "RATE:0:0", "RATE-PACKETS:65001:1000", "TRAFFIC-ACTION:none",
+		"TRAFFIC-ACTION:sample,terminal", "REDIRECT:65001:10", "REDIRECT:192.0.2.1:10",
+		"REDIRECT:4200000001:10", "MARK:46", "8002fbf000000064",
+		"RT:2001:db8::1:100", "SOO:2001:db8::2:1", "0099000000000000000000000000000000000001",
+	} {
+		b, err := encodeExtCommunity(s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", s, err)
+			continue
+		}
+		var got string
+		if len(b) == 20 {
+			got = decodeIPv6ExtCommunity(b)
+		} else {
+			got = decodeExtCommunity(b)
+		}
+		if got != s {
+			t.Errorf("expected %q, got %q (%x)", s, got, b)
+		}
+	}
+}
+
+func TestEncodeExtCommunity_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"", "RT", "RT:65001", "RT:x:1", "RT:4200000001:70000", "RT:192.0.2.1:70000", "RT-IMPORT:65001:1",
+		"OSPF-DOMAIN:2001:db8::1:1", "MARK:64", "COLOR:3:1", "ENCAP:nope", "NOPE:1", "0102", "MAC-MOBILITY:1:x",
+	} {
+		if b, err := encodeExtCommunity(s); err == nil {
+			t.Errorf("expected an error for %q, got %x", s, b)
+		}
+	}
+}
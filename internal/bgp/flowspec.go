@@ -0,0 +1,531 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FlowSpec component types (RFC 8955 §4.2.2, RFC 8956 §3).
+const (
+	FlowDstPrefix    uint8 = 1
+	FlowSrcPrefix    uint8 = 2
+	FlowProtocol     uint8 = 3 // Next Header for IPv6
+	FlowPort         uint8 = 4
+	FlowDstPort      uint8 = 5
+	FlowSrcPort      uint8 = 6
+	FlowICMPType     uint8 = 7
+	FlowICMPCode     uint8 = 8
+	FlowTCPFlags     uint8 = 9
+	FlowPacketLength uint8 = 10
+	FlowDSCP         uint8 = 11
+	FlowFragment     uint8 = 12
+	FlowLabel        uint8 = 13 // IPv6 only
+)
+
+// flowComponentNames name each component in a rule string.
+var flowComponentNames = map[uint8]string{
+	FlowDstPrefix:    "dst",
+	FlowSrcPrefix:    "src",
+	FlowProtocol:     "proto",
+	FlowPort:         "port",
+	FlowDstPort:      "dport",
+	FlowSrcPort:      "sport",
+	FlowICMPType:     "icmp-type",
+	FlowICMPCode:     "icmp-code",
+	FlowTCPFlags:     "tcp-flags",
+	FlowPacketLength: "length",
+	FlowDSCP:         "dscp",
+	FlowFragment:     "fragment",
+	FlowLabel:        "flow-label",
+}
+
+// FlowSpecRule is a decoded Flow Specification NLRI (SAFI 133, or 134 with
+// a Route Distinguisher). Each component field holds the component's value
+// as rendered in Rule; components the rule does not match on are empty.
+//
+// Numeric components render as operator/value items such as ">=1024",
+// joined by "&" (AND) or "," (OR): "=80,>=1024&<=2048". Bitmask components
+// (TCP flags, fragment) render the bit names joined by "+", prefixed by "="
+// when all bits must match and by "!" when negated: "=syn+ack", "!rst".
+type FlowSpecRule struct {
+	RD            string // SAFI 134
+	Rule          string // all components, e.g. "dst 10.0.0.0/24 proto =6 dport =80"
+	DstPrefix     string
+	SrcPrefix     string
+	Protocols     string
+	Ports         string
+	DstPorts      string
+	SrcPorts      string
+	ICMPTypes     string
+	ICMPCodes     string
+	TCPFlags      string
+	PacketLengths string
+	DSCP          string
+	Fragment      string
+	FlowLabel     string
+
+	// Actions are the traffic filtering action extended communities of
+	// the UPDATE (RFC 8955 §7), as rendered in RouteEvent.CommExt.
+	Actions []string
+
+	pathID int64
+}
+
+// flowSpecActionPrefixes select the extended communities that are traffic
+// filtering actions.
+var flowSpecActionPrefixes = []string{"RATE:", "RATE-PACKETS:", "TRAFFIC-ACTION:", "REDIRECT:", "MARK:"}
+
+// withActions returns a copy of r carrying the traffic filtering actions
+// found in commExt.
+func (r FlowSpecRule) withActions(commExt []string) *FlowSpecRule {
+	for _, c := range commExt {
+		for _, p := range flowSpecActionPrefixes {
+			if strings.HasPrefix(c, p) {
+				r.Actions = append(r.Actions, c)
+				break
+			}
+		}
+	}
+	return &r
+}
+
+// isFlowSpec reports whether safi carries Flow Specification NLRI.
+func isFlowSpec(safi uint8) bool {
+	return safi == SAFIFlowSpec || safi == SAFIFlowSpecVPN
+}
+
+// parseFlowSpecNLRI decodes a sequence of Flow Specification NLRI of the
+// given IP version. Each NLRI is a length (1 or 2 octets) followed by an
+// optional RD and the components of one rule. A rule with an unknown
+// component type cannot be skipped and ends decoding with an error.
+func parseFlowSpecNLRI(data []byte, ipVersion int, hasAddPath, hasRD bool) ([]FlowSpecRule, error) {
+	var rules []FlowSpecRule
+	offset := 0
+
+	for offset < len(data) {
+		var pathID int64
+		if hasAddPath {
+			if offset+4 > len(data) {
+				return rules, fmt.Errorf("bgp: flowspec nlri truncated at offset %d", offset)
+			}
+			pathID = int64(binary.BigEndian.Uint32(data[offset : offset+4]))
+			offset += 4
+		}
+
+		if offset >= len(data) {
+			return rules, fmt.Errorf("bgp: flowspec nlri truncated at offset %d", offset)
+		}
+		// Lengths of 240 and above take two octets (RFC 8955 §4.1).
+		length := int(data[offset])
+		offset++
+		if length >= 0xf0 {
+			if offset >= len(data) {
+				return rules, fmt.Errorf("bgp: flowspec nlri truncated at offset %d", offset)
+			}
+			length = (length&0x0f)<<8 | int(data[offset])
+			offset++
+		}
+		if offset+length > len(data) {
+			return rules, fmt.Errorf("bgp: flowspec nlri truncated at offset %d", offset)
+		}
+		body := data[offset : offset+length]
+		offset += length
+
+		var r FlowSpecRule
+		if hasRD {
+			if len(body) < RDLen {
+				return rules, fmt.Errorf("bgp: flowspec nlri too short for rd (%d bytes)", len(body))
+			}
+			r.RD = FormatRD(body[:RDLen])
+			body = body[RDLen:]
+		}
+		if err := r.decodeComponents(body, ipVersion); err != nil {
+			return rules, err
+		}
+		r.pathID = pathID
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+func (r *FlowSpecRule) decodeComponents(b []byte, ipVersion int) error {
+	var parts []string
+	for len(b) > 0 {
+		typ := b[0]
+		name, ok := flowComponentNames[typ]
+		if !ok || (typ == FlowLabel && ipVersion != 6) {
+			return fmt.Errorf("bgp: unknown flowspec component type %d", typ)
+		}
+		b = b[1:]
+
+		var value string
+		var n int
+		var err error
+		switch typ {
+		case FlowDstPrefix, FlowSrcPrefix:
+			var prefix string
+			value, prefix, n, err = flowPrefix(b, ipVersion)
+			if typ == FlowDstPrefix {
+				r.DstPrefix = prefix
+			} else {
+				r.SrcPrefix = prefix
+			}
+		case FlowTCPFlags:
+			value, n, err = flowOperators(b, bitmaskItem(tcpFlagNames))
+			r.TCPFlags = value
+		case FlowFragment:
+			value, n, err = flowOperators(b, bitmaskItem(fragmentNames))
+			r.Fragment = value
+		default:
+			value, n, err = flowOperators(b, numericItem)
+			*r.numericField(typ) = value
+		}
+		if err != nil {
+			return fmt.Errorf("bgp: flowspec component %s: %w", name, err)
+		}
+		b = b[n:]
+		parts = append(parts, name+" "+value)
+	}
+	r.Rule = strings.Join(parts, " ")
+	return nil
+}
+
+func (r *FlowSpecRule) numericField(typ uint8) *string {
+	switch typ {
+	case FlowProtocol:
+		return &r.Protocols
+	case FlowPort:
+		return &r.Ports
+	case FlowDstPort:
+		return &r.DstPorts
+	case FlowSrcPort:
+		return &r.SrcPorts
+	case FlowICMPType:
+		return &r.ICMPTypes
+	case FlowICMPCode:
+		return &r.ICMPCodes
+	case FlowPacketLength:
+		return &r.PacketLengths
+	case FlowDSCP:
+		return &r.DSCP
+	}
+	return &r.FlowLabel
+}
+
+// flowPrefix decodes a prefix component and returns its rule text, the
+// prefix in CIDR notation, and the number of bytes read. IPv6 prefixes
+// carry a pattern offset (RFC 8956 §3.1); a prefix with a non-zero offset
+// matches bits in the middle of the address and has no CIDR form.
+func flowPrefix(b []byte, ipVersion int) (text, prefix string, n int, err error) {
+	if len(b) < 1 {
+		return "", "", 0, fmt.Errorf("truncated")
+	}
+	bits := int(b[0])
+	n = 1
+	offset := 0
+	addrLen := 4
+	if ipVersion == 6 {
+		addrLen = 16
+		if len(b) < 2 {
+			return "", "", 0, fmt.Errorf("truncated")
+		}
+		offset = int(b[1])
+		n = 2
+	}
+	if bits > addrLen*8 || offset > bits {
+		return "", "", 0, fmt.Errorf("invalid prefix length %d offset %d", bits, offset)
+	}
+	patternLen := (bits - offset + 7) / 8
+	if len(b) < n+patternLen {
+		return "", "", 0, fmt.Errorf("truncated")
+	}
+	pattern := b[n : n+patternLen]
+	n += patternLen
+
+	// Place the pattern at its bit offset.
+	addr := make(net.IP, addrLen)
+	for i := 0; i < bits-offset; i++ {
+		if pattern[i/8]&(0x80>>(i%8)) != 0 {
+			pos := offset + i
+			addr[pos/8] |= 0x80 >> (pos % 8)
+		}
+	}
+	cidr := fmt.Sprintf("%s/%d", addr, bits)
+	if offset != 0 {
+		return fmt.Sprintf("%s offset %d", cidr, offset), "", n, nil
+	}
+	return cidr, cidr, n, nil
+}
+
+// flowOperators decodes an operator/value list (RFC 8955 §4.2.1) using
+// item to render each operator byte and its value. It returns the rendered
+// list and the number of bytes read.
+func flowOperators(b []byte, item func(op byte, v uint64) string) (string, int, error) {
+	var sb strings.Builder
+	n := 0
+	for {
+		if n >= len(b) {
+			return "", 0, fmt.Errorf("truncated")
+		}
+		op := b[n]
+		valueLen := 1 << ((op >> 4) & 0x03)
+		if n+1+valueLen > len(b) {
+			return "", 0, fmt.Errorf("truncated")
+		}
+		var v uint64
+		for _, c := range b[n+1 : n+1+valueLen] {
+			v = v<<8 | uint64(c)
+		}
+		if n > 0 {
+			if op&0x40 != 0 {
+				sb.WriteByte('&')
+			} else {
+				sb.WriteByte(',')
+			}
+		}
+		sb.WriteString(item(op, v))
+		n += 1 + valueLen
+		if op&0x80 != 0 { // end of list
+			return sb.String(), n, nil
+		}
+	}
+}
+
+// numericOps renders the lt, gt and eq bits of a numeric operator.
+var numericOps = [8]string{"false", "=", ">", ">=", "<", "<=", "!=", "true"}
+
+func numericItem(op byte, v uint64) string {
+	cmp := op & 0x07
+	if cmp == 0 || cmp == 7 {
+		return numericOps[cmp]
+	}
+	return fmt.Sprintf("%s%d", numericOps[cmp], v)
+}
+
+var tcpFlagNames = []string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr"}
+
+var fragmentNames = []string{"dont-fragment", "is-fragment", "first-fragment", "last-fragment"}
+
+// bitmaskItem renders a bitmask operator and its value using names for
+// the value's bits, least significant first. Bits without a name render
+// as a hex remainder.
+func bitmaskItem(names []string) func(op byte, v uint64) string {
+	return func(op byte, v uint64) string {
+		var s string
+		if op&0x02 != 0 {
+			s = "!"
+		}
+		if op&0x01 != 0 {
+			s += "="
+		}
+		var bits []string
+		for i, name := range names {
+			if v&(1<<i) != 0 {
+				bits = append(bits, name)
+				v &^= 1 << i
+			}
+		}
+		if v != 0 {
+			bits = append(bits, fmt.Sprintf("0x%x", v))
+		}
+		if len(bits) == 0 {
+			bits = append(bits, "0")
+		}
+		return s + strings.Join(bits, "+")
+	}
+}
+
+// appendFlowSpecRule appends the NLRI of a Flow Specification rule of the
+// given IP version, the inverse of parseFlowSpecNLRI: its length, the RD
+// if hasRD, then the components parsed back from r.Rule.
+func appendFlowSpecRule(dst []byte, r *FlowSpecRule, ipVersion int, hasRD bool) ([]byte, error) {
+	var body []byte
+	if hasRD {
+		rd, err := ParseRD(r.RD)
+		if err != nil {
+			return dst, err
+		}
+		body = append(body, rd[:]...)
+	}
+	body, err := appendFlowComponents(body, r.Rule, ipVersion)
+	if err != nil {
+		return dst, err
+	}
+	// Lengths of 240 and above take two octets (RFC 8955 §4.1).
+	switch n := len(body); {
+	case n < 0xf0:
+		dst = append(dst, byte(n))
+	case n <= 0xfff:
+		dst = append(dst, 0xf0|byte(n>>8), byte(n))
+	default:
+		return dst, fmt.Errorf("bgp: flowspec rule of %d octets is too long", n)
+	}
+	return append(dst, body...), nil
+}
+
+// appendFlowComponents appends the components of a rule rendered by
+// decodeComponents.
+func appendFlowComponents(dst []byte, rule string, ipVersion int) ([]byte, error) {
+	fields := strings.Fields(rule)
+	for len(fields) > 0 {
+		if len(fields) < 2 {
+			return dst, fmt.Errorf("bgp: invalid flowspec rule %q", rule)
+		}
+		name, value := fields[0], fields[1]
+		fields = fields[2:]
+		typ, ok := flowComponentType(name)
+		if !ok || (typ == FlowLabel && ipVersion != 6) {
+			return dst, fmt.Errorf("bgp: invalid flowspec component %q", name)
+		}
+		dst = append(dst, typ)
+
+		var err error
+		switch typ {
+		case FlowDstPrefix, FlowSrcPrefix:
+			offset := 0
+			if len(fields) >= 2 && fields[0] == "offset" {
+				if offset, err = strconv.Atoi(fields[1]); err != nil {
+					return dst, fmt.Errorf("bgp: flowspec component %s: invalid offset %q", name, fields[1])
+				}
+				fields = fields[2:]
+			}
+			dst, err = appendFlowPrefix(dst, value, offset, ipVersion)
+		case FlowTCPFlags:
+			dst, err = appendFlowOperators(dst, value, bitmaskOperator(tcpFlagNames))
+		case FlowFragment:
+			dst, err = appendFlowOperators(dst, value, bitmaskOperator(fragmentNames))
+		default:
+			dst, err = appendFlowOperators(dst, value, numericOperator)
+		}
+		if err != nil {
+			return dst, fmt.Errorf("bgp: flowspec component %s: %w", name, err)
+		}
+	}
+	return dst, nil
+}
+
+// flowComponentType returns the component type named name in
+// flowComponentNames.
+func flowComponentType(name string) (uint8, bool) {
+	for typ, n := range flowComponentNames {
+		if n == name {
+			return typ, true
+		}
+	}
+	return 0, false
+}
+
+// appendFlowPrefix appends a prefix component, the inverse of flowPrefix:
+// the bits of the prefix from offset on are the pattern.
+func appendFlowPrefix(dst []byte, s string, offset, ipVersion int) ([]byte, error) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil || prefix.Addr().Is4() != (ipVersion == 4) || offset > prefix.Bits() || (ipVersion == 4 && offset != 0) {
+		return dst, fmt.Errorf("invalid prefix %q offset %d", s, offset)
+	}
+	bits := prefix.Bits()
+	dst = append(dst, byte(bits))
+	if ipVersion == 6 {
+		dst = append(dst, byte(offset))
+	}
+	addr := prefix.Addr().AsSlice()
+	pattern := make([]byte, (bits-offset+7)/8)
+	for i := 0; i < bits-offset; i++ {
+		pos := offset + i
+		if addr[pos/8]&(0x80>>(pos%8)) != 0 {
+			pattern[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return append(dst, pattern...), nil
+}
+
+// appendFlowOperators appends an operator/value list rendered by
+// flowOperators, using item to parse each operator and its value. Values
+// take the fewest octets that hold them.
+func appendFlowOperators(dst []byte, list string, item func(string) (byte, uint64, error)) ([]byte, error) {
+	var and bool
+	for {
+		end := strings.IndexAny(list, "&,")
+		s := list
+		if end >= 0 {
+			s = list[:end]
+		}
+		op, v, err := item(s)
+		if err != nil {
+			return dst, err
+		}
+		if and {
+			op |= 0x40
+		}
+		if end < 0 {
+			op |= 0x80 // end of list
+		}
+		var lenCode byte
+		for lenCode < 3 && v>>(8<<lenCode) != 0 {
+			lenCode++
+		}
+		dst = append(dst, op|lenCode<<4)
+		for i := 1<<lenCode - 1; i >= 0; i-- {
+			dst = append(dst, byte(v>>(8*i)))
+		}
+		if end < 0 {
+			return dst, nil
+		}
+		and = list[end] == '&'
+		list = list[end+1:]
+	}
+}
+
+// numericOperator parses an item rendered by numericItem.
+func numericOperator(s string) (byte, uint64, error) {
+	switch s {
+	case numericOps[0]:
+		return 0, 0, nil
+	case numericOps[7]:
+		return 7, 0, nil
+	}
+	// Two-character operators are tried before their prefixes.
+	for cmp := 6; cmp >= 1; cmp-- {
+		if rest, ok := strings.CutPrefix(s, numericOps[cmp]); ok {
+			v, err := strconv.ParseUint(rest, 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid value %q", s)
+			}
+			return byte(cmp), v, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid operator %q", s)
+}
+
+// bitmaskOperator returns the parser of the items bitmaskItem(names)
+// renders.
+func bitmaskOperator(names []string) func(string) (byte, uint64, error) {
+	return func(s string) (byte, uint64, error) {
+		var op byte
+		bitNames := s
+		if rest, ok := strings.CutPrefix(bitNames, "!"); ok {
+			op, bitNames = op|0x02, rest
+		}
+		if rest, ok := strings.CutPrefix(bitNames, "="); ok {
+			op, bitNames = op|0x01, rest
+		}
+		var v uint64
+		for _, name := range strings.Split(bitNames, "+") {
+			if i := slices.Index(names, name); i >= 0 {
+				v |= 1 << i
+				continue
+			}
+			n, err := strconv.ParseUint(name, 0, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid bitmask %q", s)
+			}
+			v |= n
+		}
+		return op, v, nil
+	}
+}
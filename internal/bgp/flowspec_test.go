@@ -0,0 +1,194 @@
+package bgp
+
+import (
+	"slices"
+	"testing"
+)
+
+// flowSpecUpdate wraps one FlowSpec NLRI body in MP_REACH_NLRI (no next
+// hop) with the given extended communities.
+func flowSpecUpdate(afi uint16, safi uint8, body []byte, extComms ...[]byte) []byte {
+	mpReach := []byte{byte(afi >> 8), byte(afi), safi, 0, 0, byte(len(body))}
+	mpReach = append(mpReach, body...)
+	pathAttrs := wellKnownAttrs()
+	if len(extComms) > 0 {
+		var ec []byte
+		for _, c := range extComms {
+			ec = append(ec, c...)
+		}
+		pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeExtCommunity, ec)...)
+	}
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	return buildBGPUpdate(nil, pathAttrs, nil)
+}
+
+func TestParseUpdate_FlowSpecIPv4(t *testing.T) {
+	body := []byte{
+		FlowDstPrefix, 24, 192, 0, 2,
+		FlowSrcPrefix, 8, 10,
+		FlowProtocol, 0x81, 6, // =6, end
+		FlowDstPort, 0x01, 80, 0x91, 0x01, 0xbb, // =80 or =443 (2-byte value), end
+		FlowSrcPort, 0x13, 0x04, 0x00, 0xd5, 0x08, 0x00, // >=1024 and <=2048, end
+		FlowTCPFlags, 0x80, 0x02, // any of syn, end
+		FlowPacketLength, 0x84, 100, // <100, end
+		FlowDSCP, 0x81, 46,
+		FlowFragment, 0x83, 0x02, // not, match is-fragment
+	}
+	rate := []byte{0x80, 0x06, 0xFD, 0xE8, 0, 0, 0, 0} // discard
+	rt := []byte{0x00, 0x02, 0xFD, 0xE8, 0, 0, 0, 100}
+
+	events, err := ParseUpdate(flowSpecUpdate(AFIIPv4, SAFIFlowSpec, body, rate, rt), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.FlowSpec == nil {
+		t.Fatal("expected FlowSpec rule")
+	}
+	if ev.AFI != 4 || ev.SAFI != SAFIFlowSpec || ev.Action != "A" || ev.Prefix != "" || ev.RD != "" {
+		t.Errorf("unexpected %d/%d %s prefix %q rd %q", ev.AFI, ev.SAFI, ev.Action, ev.Prefix, ev.RD)
+	}
+
+	fs := ev.FlowSpec
+	wantRule := "dst 192.0.2.0/24 src 10.0.0.0/8 proto =6 dport =80,=443 sport >=1024&<=2048 " +
+		"tcp-flags syn length <100 dscp =46 fragment !=is-fragment"
+	if fs.Rule != wantRule {
+		t.Errorf("rule = %q\nwant   %q", fs.Rule, wantRule)
+	}
+	for name, got := range map[string][2]string{
+		"dst":       {fs.DstPrefix, "192.0.2.0/24"},
+		"src":       {fs.SrcPrefix, "10.0.0.0/8"},
+		"proto":     {fs.Protocols, "=6"},
+		"dport":     {fs.DstPorts, "=80,=443"},
+		"sport":     {fs.SrcPorts, ">=1024&<=2048"},
+		"tcp-flags": {fs.TCPFlags, "syn"},
+		"length":    {fs.PacketLengths, "<100"},
+		"dscp":      {fs.DSCP, "=46"},
+		"fragment":  {fs.Fragment, "!=is-fragment"},
+		"port":      {fs.Ports, ""},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("%s = %q, want %q", name, got[0], got[1])
+		}
+	}
+	if want := []string{"RATE:65000:0"}; !slices.Equal(fs.Actions, want) {
+		t.Errorf("actions = %v, want %v", fs.Actions, want)
+	}
+}
+
+func TestParseUpdate_FlowSpecIPv6Offset(t *testing.T) {
+	body := []byte{
+		FlowDstPrefix, 48, 0, 0x20, 0x01, 0x0d, 0xb8, 0, 0, // 2001:db8::/48
+		FlowSrcPrefix, 64, 32, 0, 0, 0, 1, // bits 32-63 = 0x00000001
+		FlowProtocol, 0x81, 58,
+		FlowLabel, 0xa1, 0, 0x01, 0x23, 0x45, // =0x12345 (4-byte value), end
+	}
+
+	events, err := ParseUpdate(flowSpecUpdate(AFIIPv6, SAFIFlowSpec, body), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].FlowSpec == nil {
+		t.Fatalf("expected 1 FlowSpec event, got %d", len(events))
+	}
+	fs := events[0].FlowSpec
+	if events[0].AFI != 6 {
+		t.Errorf("expected AFI 6, got %d", events[0].AFI)
+	}
+	if fs.DstPrefix != "2001:db8::/48" {
+		t.Errorf("dst = %q", fs.DstPrefix)
+	}
+	// An offset pattern has no CIDR form.
+	if fs.SrcPrefix != "" {
+		t.Errorf("expected empty src prefix, got %q", fs.SrcPrefix)
+	}
+	want := "dst 2001:db8::/48 src 0:0:0:1::/64 offset 32 proto =58 flow-label =74565"
+	if fs.Rule != want {
+		t.Errorf("rule = %q\nwant   %q", fs.Rule, want)
+	}
+}
+
+func TestParseUpdate_FlowSpecVPNWithdrawal(t *testing.T) {
+	nlri := append([]byte{8 + 5}, testRD...)
+	nlri = append(nlri, FlowDstPrefix, 24, 192, 0, 2)
+	mpUnreach := append([]byte{0, 1, SAFIFlowSpecVPN}, nlri...)
+	update := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, mpUnreach), nil)
+
+	events, err := ParseUpdate(update, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].FlowSpec == nil {
+		t.Fatalf("expected 1 FlowSpec event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "D" || ev.SAFI != SAFIFlowSpecVPN {
+		t.Errorf("unexpected action %s safi %d", ev.Action, ev.SAFI)
+	}
+	if ev.RD != "10.0.0.1:100" || ev.FlowSpec.RD != "10.0.0.1:100" {
+		t.Errorf("expected RD 10.0.0.1:100, got %q and %q", ev.RD, ev.FlowSpec.RD)
+	}
+	if ev.FlowSpec.Rule != "dst 192.0.2.0/24" {
+		t.Errorf("rule = %q", ev.FlowSpec.Rule)
+	}
+}
+
+func TestParseFlowSpecNLRI_LongLength(t *testing.T) {
+	// 240 bytes of components need the 2-octet length encoding.
+	var body []byte
+	for len(body) < 240 {
+		body = append(body, FlowDstPort, 0x81, 80)
+	}
+	data := append([]byte{0xf0 | byte(len(body)>>8), byte(len(body))}, body...)
+
+	rules, err := parseFlowSpecNLRI(data, 4, false, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].DstPorts != "=80" {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+}
+
+func TestParseFlowSpecNLRI_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated length", []byte{5, FlowDstPrefix, 24}},
+		{"unknown component", []byte{2, 99, 0}},
+		{"flow label on IPv4", []byte{3, FlowLabel, 0x81, 1}},
+		{"operator list without end", []byte{3, FlowDstPort, 0x01, 80}},
+		{"prefix too long", []byte{3, FlowDstPrefix, 33, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseFlowSpecNLRI(tt.data, 4, false, false); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestBitmaskItem(t *testing.T) {
+	item := bitmaskItem(tcpFlagNames)
+	tests := []struct {
+		op   byte
+		v    uint64
+		want string
+	}{
+		{0x00, 0x12, "syn+ack"},
+		{0x01, 0x12, "=syn+ack"},
+		{0x02, 0x04, "!rst"},
+		{0x10, 0x0102, "syn+0x100"},
+		{0x00, 0, "0"},
+	}
+	for _, tt := range tests {
+		if got := item(tt.op, tt.v); got != tt.want {
+			t.Errorf("bitmaskItem(%#x, %#x) = %q, want %q", tt.op, tt.v, got, tt.want)
+		}
+	}
+}
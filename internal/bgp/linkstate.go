@@ -0,0 +1,645 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// BGP-LS NLRI types (RFC 9552 §5.2).
+const (
+	LSNodeNLRI       uint16 = 1
+	LSLinkNLRI       uint16 = 2
+	LSIPv4PrefixNLRI uint16 = 3
+	LSIPv6PrefixNLRI uint16 = 4
+)
+
+// BGP-LS NLRI descriptor TLVs (RFC 9552 §5.2.1-3).
+const (
+	lsLocalNodeDesc    = 256
+	lsRemoteNodeDesc   = 257
+	lsLinkIDs          = 258
+	lsIPv4Interface    = 259
+	lsIPv4Neighbor     = 260
+	lsIPv6Interface    = 261
+	lsIPv6Neighbor     = 262
+	lsMultiTopologyID  = 263
+	lsOSPFRouteType    = 264
+	lsIPReachability   = 265
+	lsASNumber         = 512
+	lsBGPLSIdentifier  = 513
+	lsOSPFAreaID       = 514
+	lsIGPRouterID      = 515
+	lsNodeName         = 1026
+	lsIPv4RouterID     = 1028
+	lsIPv6RouterID     = 1029
+	lsIPv4RemoteRID    = 1030
+	lsIPv6RemoteRID    = 1031
+	lsSRCapabilities   = 1034
+	lsSRAlgorithm      = 1035
+	lsMaxLinkBandwidth = 1089
+	lsTEMetric         = 1092
+	lsIGPMetric        = 1095
+	lsLinkName         = 1098
+	lsAdjSID           = 1099
+	lsLANAdjSID        = 1100
+	lsPrefixMetric     = 1155
+	lsPrefixSID        = 1158
+	lsSIDLabel         = 1161
+)
+
+// LSNodeDescriptor identifies a node of the IGP topology.
+type LSNodeDescriptor struct {
+	ASN         uint32
+	BGPLSID     uint32
+	OSPFAreaID  string // dotted quad; empty for IS-IS
+	IGPRouterID string // IS-IS system ID ("0000.0000.0001", ".01" for a pseudonode) or OSPF router ID
+}
+
+func (d LSNodeDescriptor) String() string {
+	return fmt.Sprintf("%d:%d:%s:%s", d.ASN, d.BGPLSID, d.OSPFAreaID, d.IGPRouterID)
+}
+
+// LSRoute is a decoded BGP-LS NLRI (AFI 16388, SAFI 71) and, for
+// announcements, its BGP-LS Attribute.
+type LSRoute struct {
+	Type       uint16 // LSNodeNLRI, LSLinkNLRI, LSIPv4PrefixNLRI or LSIPv6PrefixNLRI
+	ProtocolID uint8  // 1 IS-IS L1, 2 IS-IS L2, 3 OSPFv2, 4 Direct, 5 Static, 6 OSPFv3
+	Identifier uint64
+	LocalNode  LSNodeDescriptor
+
+	// Link descriptors.
+	RemoteNode    LSNodeDescriptor
+	LocalLinkID   uint32
+	RemoteLinkID  uint32
+	InterfaceAddr string
+	NeighborAddr  string
+
+	// Prefix descriptors.
+	Prefix        string
+	OSPFRouteType uint8
+
+	MTID uint16 // Multi-Topology ID of a link or prefix
+
+	Attr *LSAttribute // nil for withdrawals
+
+	pathID int64
+}
+
+// Key renders the descriptors that identify the NLRI, e.g.
+// "[L][2][0][65000:0::0000.0000.0001][65000:0::0000.0000.0002][0:0:10.0.0.1:10.0.0.2:0]".
+func (r *LSRoute) Key() string {
+	head := fmt.Sprintf("[%d][%d][%s]", r.ProtocolID, r.Identifier, r.LocalNode)
+	switch r.Type {
+	case LSNodeNLRI:
+		return "[N]" + head
+	case LSLinkNLRI:
+		return fmt.Sprintf("[L]%s[%s][%d:%d:%s:%s:%d]", head, r.RemoteNode,
+			r.LocalLinkID, r.RemoteLinkID, r.InterfaceAddr, r.NeighborAddr, r.MTID)
+	}
+	return fmt.Sprintf("[P]%s[%s:%d:%d]", head, r.Prefix, r.MTID, r.OSPFRouteType)
+}
+
+// withAttribute returns a copy of r carrying attr.
+func (r LSRoute) withAttribute(attr *LSAttribute) *LSRoute {
+	r.Attr = attr
+	return &r
+}
+
+// LSAttribute holds the decoded TLVs of a BGP-LS Attribute. Which fields
+// are set depends on the NLRI type the attribute accompanies.
+type LSAttribute struct {
+	// Node attributes
+	NodeName       string
+	LocalRouterIDs []string     // IPv4/IPv6 Router-IDs of the local node
+	SRGB           []LabelRange // SR Capabilities (RFC 9085 §2.1.2)
+	SRAlgorithms   []uint8
+
+	// Link attributes
+	RemoteRouterIDs  []string
+	IGPMetric        *uint32
+	TEMetric         *uint32
+	MaxLinkBandwidth *float32 // bytes per second
+	LinkName         string
+	AdjSIDs          []LSSID // Adjacency and LAN Adjacency SIDs (RFC 9085 §2.2.1-2)
+
+	// Prefix attributes
+	PrefixMetric *uint32
+	PrefixSIDs   []LSSID // RFC 9085 §2.3.1
+}
+
+// LabelRange is a label block such as the SRGB.
+type LabelRange struct {
+	Start uint32 `json:"start"`
+	Size  uint32 `json:"size"`
+}
+
+// LSSID is an SR Adjacency or Prefix SID. A 3-octet SID is an MPLS label,
+// a 4-octet SID an index into the SRGB.
+type LSSID struct {
+	Flags     uint8  `json:"flags"`
+	Weight    uint8  `json:"weight,omitempty"`    // Adjacency SIDs
+	Algorithm uint8  `json:"algorithm,omitempty"` // Prefix SIDs
+	SID       uint32 `json:"sid"`
+	IsIndex   bool   `json:"is_index"`
+}
+
+// forEachTLV calls fn for each 2-octet type, 2-octet length TLV in b.
+func forEachTLV(b []byte, fn func(typ uint16, v []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return fmt.Errorf("bgp: bgp-ls tlv header truncated")
+		}
+		typ, length := binary.BigEndian.Uint16(b[0:2]), int(binary.BigEndian.Uint16(b[2:4]))
+		if 4+length > len(b) {
+			return fmt.Errorf("bgp: bgp-ls tlv %d truncated", typ)
+		}
+		if err := fn(typ, b[4:4+length]); err != nil {
+			return err
+		}
+		b = b[4+length:]
+	}
+	return nil
+}
+
+// parseLSNLRI decodes a sequence of BGP-LS NLRI. NLRI of unknown types are
+// skipped.
+func parseLSNLRI(data []byte, hasAddPath bool) ([]LSRoute, error) {
+	var routes []LSRoute
+	offset := 0
+
+	for offset < len(data) {
+		var pathID int64
+		if hasAddPath {
+			if offset+4 > len(data) {
+				return routes, fmt.Errorf("bgp: bgp-ls nlri truncated at offset %d", offset)
+			}
+			pathID = int64(binary.BigEndian.Uint32(data[offset : offset+4]))
+			offset += 4
+		}
+
+		if offset+4 > len(data) {
+			return routes, fmt.Errorf("bgp: bgp-ls nlri truncated at offset %d", offset)
+		}
+		nlriType := binary.BigEndian.Uint16(data[offset : offset+2])
+		length := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		offset += 4
+		if offset+length > len(data) {
+			return routes, fmt.Errorf("bgp: bgp-ls nlri truncated at offset %d", offset)
+		}
+		body := data[offset : offset+length]
+		offset += length
+
+		if nlriType < LSNodeNLRI || nlriType > LSIPv6PrefixNLRI {
+			continue
+		}
+		r, err := decodeLSNLRI(nlriType, body)
+		if err != nil {
+			return routes, err
+		}
+		r.pathID = pathID
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
+
+func decodeLSNLRI(nlriType uint16, b []byte) (LSRoute, error) {
+	r := LSRoute{Type: nlriType}
+	if len(b) < 9 {
+		return r, fmt.Errorf("bgp: bgp-ls nlri type %d too short (%d bytes)", nlriType, len(b))
+	}
+	r.ProtocolID = b[0]
+	r.Identifier = binary.BigEndian.Uint64(b[1:9])
+
+	err := forEachTLV(b[9:], func(typ uint16, v []byte) error {
+		switch typ {
+		case lsLocalNodeDesc:
+			return decodeLSNodeDescriptor(v, &r.LocalNode)
+		case lsRemoteNodeDesc:
+			return decodeLSNodeDescriptor(v, &r.RemoteNode)
+		case lsLinkIDs:
+			if len(v) != 8 {
+				return fmt.Errorf("bgp: bgp-ls link identifiers length %d", len(v))
+			}
+			r.LocalLinkID = binary.BigEndian.Uint32(v[0:4])
+			r.RemoteLinkID = binary.BigEndian.Uint32(v[4:8])
+		case lsIPv4Interface, lsIPv6Interface:
+			r.InterfaceAddr = lsIP(v)
+		case lsIPv4Neighbor, lsIPv6Neighbor:
+			r.NeighborAddr = lsIP(v)
+		case lsMultiTopologyID:
+			if len(v) >= 2 {
+				r.MTID = binary.BigEndian.Uint16(v[0:2]) & 0x0fff
+			}
+		case lsOSPFRouteType:
+			if len(v) == 1 {
+				r.OSPFRouteType = v[0]
+			}
+		case lsIPReachability:
+			prefix, err := lsPrefix(v, nlriType == LSIPv6PrefixNLRI)
+			if err != nil {
+				return err
+			}
+			r.Prefix = prefix
+		}
+		return nil
+	})
+	if err != nil {
+		return r, err
+	}
+	if (nlriType == LSIPv4PrefixNLRI || nlriType == LSIPv6PrefixNLRI) && r.Prefix == "" {
+		return r, fmt.Errorf("bgp: bgp-ls prefix nlri without ip reachability")
+	}
+	return r, nil
+}
+
+func decodeLSNodeDescriptor(b []byte, d *LSNodeDescriptor) error {
+	return forEachTLV(b, func(typ uint16, v []byte) error {
+		switch typ {
+		case lsASNumber, lsBGPLSIdentifier:
+			if len(v) != 4 {
+				return fmt.Errorf("bgp: bgp-ls node descriptor %d length %d", typ, len(v))
+			}
+			if typ == lsASNumber {
+				d.ASN = binary.BigEndian.Uint32(v)
+			} else {
+				d.BGPLSID = binary.BigEndian.Uint32(v)
+			}
+		case lsOSPFAreaID:
+			if len(v) != 4 {
+				return fmt.Errorf("bgp: bgp-ls ospf area id length %d", len(v))
+			}
+			d.OSPFAreaID = net.IP(v).String()
+		case lsIGPRouterID:
+			d.IGPRouterID = formatIGPRouterID(v)
+		}
+		return nil
+	})
+}
+
+// formatIGPRouterID renders an IGP Router-ID (RFC 9552 §5.2.1.4): an IS-IS
+// system ID with an optional pseudonode ID, an OSPF router ID, or an OSPF
+// pseudonode as "DR router ID:interface address".
+func formatIGPRouterID(v []byte) string {
+	switch len(v) {
+	case 4:
+		return net.IP(v).String()
+	case 6, 7:
+		s := fmt.Sprintf("%02x%02x.%02x%02x.%02x%02x", v[0], v[1], v[2], v[3], v[4], v[5])
+		if len(v) == 7 {
+			s += fmt.Sprintf(".%02x", v[6])
+		}
+		return s
+	case 8:
+		return net.IP(v[0:4]).String() + ":" + net.IP(v[4:8]).String()
+	}
+	return hex.EncodeToString(v)
+}
+
+func lsIP(v []byte) string {
+	if len(v) != 4 && len(v) != 16 {
+		return hex.EncodeToString(v)
+	}
+	return net.IP(v).String()
+}
+
+// lsPrefix decodes the IP Reachability Information TLV: a prefix length
+// followed by the significant prefix octets.
+func lsPrefix(v []byte, ipv6 bool) (string, error) {
+	addrLen := 4
+	if ipv6 {
+		addrLen = 16
+	}
+	if len(v) < 1 || int(v[0]) > addrLen*8 || len(v) != 1+(int(v[0])+7)/8 {
+		return "", fmt.Errorf("bgp: bgp-ls malformed ip reachability")
+	}
+	addr := make(net.IP, addrLen)
+	copy(addr, v[1:])
+	return fmt.Sprintf("%s/%d", addr.Mask(net.CIDRMask(int(v[0]), addrLen*8)), v[0]), nil
+}
+
+// parseLSAttribute decodes the TLVs of a BGP-LS Attribute. Unknown and
+// malformed TLVs are skipped.
+func parseLSAttribute(data []byte) *LSAttribute {
+	a := &LSAttribute{}
+	_ = forEachTLV(data, func(typ uint16, v []byte) error {
+		switch typ {
+		case lsNodeName:
+			a.NodeName = string(v)
+		case lsIPv4RouterID, lsIPv6RouterID:
+			a.LocalRouterIDs = append(a.LocalRouterIDs, lsIP(v))
+		case lsIPv4RemoteRID, lsIPv6RemoteRID:
+			a.RemoteRouterIDs = append(a.RemoteRouterIDs, lsIP(v))
+		case lsSRCapabilities:
+			a.SRGB = append(a.SRGB, lsLabelRanges(v)...)
+		case lsSRAlgorithm:
+			a.SRAlgorithms = append(a.SRAlgorithms, v...)
+		case lsIGPMetric:
+			a.IGPMetric = lsUint(v, 3)
+		case lsTEMetric:
+			a.TEMetric = lsUint(v, 4)
+		case lsMaxLinkBandwidth:
+			if len(v) == 4 {
+				bw := math.Float32frombits(binary.BigEndian.Uint32(v))
+				a.MaxLinkBandwidth = &bw
+			}
+		case lsLinkName:
+			a.LinkName = string(v)
+		case lsAdjSID, lsLANAdjSID:
+			// Flags(1) + Weight(1) + Reserved(2) [+ Neighbor ID(4/6)] + SID(3/4)
+			if len(v) < 7 {
+				return nil
+			}
+			sid := v[len(v)-4:]
+			if len(v) == 7 || len(v) == 11 || len(v) == 13 {
+				sid = v[len(v)-3:]
+			}
+			if s, ok := lsSID(sid); ok {
+				s.Flags, s.Weight = v[0], v[1]
+				a.AdjSIDs = append(a.AdjSIDs, s)
+			}
+		case lsPrefixMetric:
+			a.PrefixMetric = lsUint(v, 4)
+		case lsPrefixSID:
+			// Flags(1) + Algorithm(1) + Reserved(2) + SID(3/4)
+			if len(v) < 7 {
+				return nil
+			}
+			if s, ok := lsSID(v[4:]); ok {
+				s.Flags, s.Algorithm = v[0], v[1]
+				a.PrefixSIDs = append(a.PrefixSIDs, s)
+			}
+		}
+		return nil
+	})
+	return a
+}
+
+// lsUint decodes a big-endian value of 1 to max octets.
+func lsUint(v []byte, max int) *uint32 {
+	if len(v) < 1 || len(v) > max {
+		return nil
+	}
+	var n uint32
+	for _, c := range v {
+		n = n<<8 | uint32(c)
+	}
+	return &n
+}
+
+// lsSID decodes a 3-octet label (low 20 bits) or a 4-octet index.
+func lsSID(v []byte) (LSSID, bool) {
+	switch len(v) {
+	case 3:
+		return LSSID{SID: (uint32(v[0])<<16 | uint32(v[1])<<8 | uint32(v[2])) & 0xfffff}, true
+	case 4:
+		return LSSID{SID: binary.BigEndian.Uint32(v), IsIndex: true}, true
+	}
+	return LSSID{}, false
+}
+
+// lsLabelRanges decodes the ranges of an SR Capabilities TLV: Flags(1) +
+// Reserved(1), then Range Size(3) + SID/Label sub-TLV per range.
+func lsLabelRanges(v []byte) []LabelRange {
+	if len(v) < 2 {
+		return nil
+	}
+	var ranges []LabelRange
+	b := v[2:]
+	for len(b) >= 3 {
+		size := uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+		b = b[3:]
+		if len(b) < 4 || binary.BigEndian.Uint16(b[0:2]) != lsSIDLabel {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(b[2:4]))
+		if 4+length > len(b) {
+			break
+		}
+		if s, ok := lsSID(b[4 : 4+length]); ok {
+			ranges = append(ranges, LabelRange{Start: s.SID, Size: size})
+		}
+		b = b[4+length:]
+	}
+	return ranges
+}
+
+// appendLSNLRI appends a BGP-LS NLRI, the inverse of decodeLSNLRI.
+// Descriptors with a zero value are left out.
+func appendLSNLRI(dst []byte, r *LSRoute) ([]byte, error) {
+	if r.Type < LSNodeNLRI || r.Type > LSIPv6PrefixNLRI {
+		return dst, fmt.Errorf("bgp: encoding bgp-ls nlri type %d is not supported", r.Type)
+	}
+	var start int
+	dst, start = beginLSTLV(dst, r.Type)
+	dst = append(dst, r.ProtocolID)
+	dst = binary.BigEndian.AppendUint64(dst, r.Identifier)
+	var err error
+	if dst, err = appendLSNodeDescriptor(dst, lsLocalNodeDesc, &r.LocalNode); err != nil {
+		return dst, err
+	}
+	mtid := func(dst []byte) []byte {
+		if r.MTID == 0 {
+			return dst
+		}
+		return appendLSTLV(dst, lsMultiTopologyID, binary.BigEndian.AppendUint16(nil, r.MTID))
+	}
+
+	switch r.Type {
+	case LSLinkNLRI:
+		if dst, err = appendLSNodeDescriptor(dst, lsRemoteNodeDesc, &r.RemoteNode); err != nil {
+			return dst, err
+		}
+		if r.LocalLinkID != 0 || r.RemoteLinkID != 0 {
+			v := binary.BigEndian.AppendUint32(nil, r.LocalLinkID)
+			dst = appendLSTLV(dst, lsLinkIDs, binary.BigEndian.AppendUint32(v, r.RemoteLinkID))
+		}
+		if r.InterfaceAddr != "" {
+			if dst, err = appendLSAddr(dst, lsIPv4Interface, lsIPv6Interface, r.InterfaceAddr); err != nil {
+				return dst, err
+			}
+		}
+		if r.NeighborAddr != "" {
+			if dst, err = appendLSAddr(dst, lsIPv4Neighbor, lsIPv6Neighbor, r.NeighborAddr); err != nil {
+				return dst, err
+			}
+		}
+		dst = mtid(dst)
+
+	case LSIPv4PrefixNLRI, LSIPv6PrefixNLRI:
+		prefix, err := netip.ParsePrefix(r.Prefix)
+		if err != nil || prefix.Addr().Is6() != (r.Type == LSIPv6PrefixNLRI) {
+			return dst, fmt.Errorf("bgp: invalid bgp-ls prefix %q", r.Prefix)
+		}
+		dst = mtid(dst)
+		if r.OSPFRouteType != 0 {
+			dst = appendLSTLV(dst, lsOSPFRouteType, []byte{r.OSPFRouteType})
+		}
+		v := append([]byte{byte(prefix.Bits())}, prefix.Masked().Addr().AsSlice()[:(prefix.Bits()+7)/8]...)
+		dst = appendLSTLV(dst, lsIPReachability, v)
+	}
+	return endLSTLV(dst, start), nil
+}
+
+// appendLSNodeDescriptor appends a node descriptor TLV of type typ, the
+// inverse of decodeLSNodeDescriptor.
+func appendLSNodeDescriptor(dst []byte, typ uint16, d *LSNodeDescriptor) ([]byte, error) {
+	var start int
+	dst, start = beginLSTLV(dst, typ)
+	if d.ASN != 0 {
+		dst = appendLSTLV(dst, lsASNumber, binary.BigEndian.AppendUint32(nil, d.ASN))
+	}
+	if d.BGPLSID != 0 {
+		dst = appendLSTLV(dst, lsBGPLSIdentifier, binary.BigEndian.AppendUint32(nil, d.BGPLSID))
+	}
+	if d.OSPFAreaID != "" {
+		id, err := parseIPv4(d.OSPFAreaID, "OSPF area ID")
+		if err != nil {
+			return dst, err
+		}
+		dst = appendLSTLV(dst, lsOSPFAreaID, id[:])
+	}
+	if d.IGPRouterID != "" {
+		id, err := parseIGPRouterID(d.IGPRouterID)
+		if err != nil {
+			return dst, err
+		}
+		dst = appendLSTLV(dst, lsIGPRouterID, id)
+	}
+	return endLSTLV(dst, start), nil
+}
+
+// parseIGPRouterID parses an IGP Router-ID rendered by formatIGPRouterID.
+func parseIGPRouterID(s string) ([]byte, error) {
+	if dr, iface, ok := strings.Cut(s, ":"); ok {
+		drID, err1 := parseIPv4(dr, "IGP router ID")
+		addr, err2 := parseIPv4(iface, "IGP router ID")
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("bgp: invalid IGP router ID %q", s)
+		}
+		return append(drID[:], addr[:]...), nil
+	}
+	if id, err := parseIPv4(s, "IGP router ID"); err == nil {
+		return id[:], nil
+	}
+	if len(s) == len("0000.0000.0000") || len(s) == len("0000.0000.0000.00") {
+		if id, err := hex.DecodeString(strings.ReplaceAll(s, ".", "")); err == nil {
+			return id, nil
+		}
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("bgp: invalid IGP router ID %q", s)
+	}
+	return id, nil
+}
+
+// appendLSAttribute appends the TLVs of a BGP-LS Attribute, the inverse
+// of parseLSAttribute. The IGP metric takes three octets, the IS-IS wide
+// metric; SR Capabilities carry no flags, and Adjacency SIDs go in
+// Adjacency SID TLVs, as the LAN neighbor is not kept.
+func appendLSAttribute(dst []byte, a *LSAttribute) ([]byte, error) {
+	var err error
+	if a.NodeName != "" {
+		dst = appendLSTLV(dst, lsNodeName, []byte(a.NodeName))
+	}
+	for _, id := range a.LocalRouterIDs {
+		if dst, err = appendLSAddr(dst, lsIPv4RouterID, lsIPv6RouterID, id); err != nil {
+			return dst, err
+		}
+	}
+	for _, id := range a.RemoteRouterIDs {
+		if dst, err = appendLSAddr(dst, lsIPv4RemoteRID, lsIPv6RemoteRID, id); err != nil {
+			return dst, err
+		}
+	}
+	if a.SRGB != nil {
+		var start int
+		dst, start = beginLSTLV(dst, lsSRCapabilities)
+		dst = append(dst, 0, 0) // Flags, Reserved
+		for _, r := range a.SRGB {
+			dst = append(dst, byte(r.Size>>16), byte(r.Size>>8), byte(r.Size))
+			dst = appendLSTLV(dst, lsSIDLabel, appendLSSID(nil, r.Start, r.Start > 0xfffff))
+		}
+		dst = endLSTLV(dst, start)
+	}
+	if a.SRAlgorithms != nil {
+		dst = appendLSTLV(dst, lsSRAlgorithm, a.SRAlgorithms)
+	}
+	if a.MaxLinkBandwidth != nil {
+		dst = appendLSTLV(dst, lsMaxLinkBandwidth, binary.BigEndian.AppendUint32(nil, math.Float32bits(*a.MaxLinkBandwidth)))
+	}
+	if a.TEMetric != nil {
+		dst = appendLSTLV(dst, lsTEMetric, binary.BigEndian.AppendUint32(nil, *a.TEMetric))
+	}
+	if m := a.IGPMetric; m != nil {
+		if *m > 0xffffff {
+			return dst, fmt.Errorf("bgp: bgp-ls igp metric %d is too large", *m)
+		}
+		dst = appendLSTLV(dst, lsIGPMetric, []byte{byte(*m >> 16), byte(*m >> 8), byte(*m)})
+	}
+	if a.LinkName != "" {
+		dst = appendLSTLV(dst, lsLinkName, []byte(a.LinkName))
+	}
+	for _, s := range a.AdjSIDs {
+		dst = appendLSTLV(dst, lsAdjSID, appendLSSID([]byte{s.Flags, s.Weight, 0, 0}, s.SID, s.IsIndex))
+	}
+	if a.PrefixMetric != nil {
+		dst = appendLSTLV(dst, lsPrefixMetric, binary.BigEndian.AppendUint32(nil, *a.PrefixMetric))
+	}
+	for _, s := range a.PrefixSIDs {
+		dst = appendLSTLV(dst, lsPrefixSID, appendLSSID([]byte{s.Flags, s.Algorithm, 0, 0}, s.SID, s.IsIndex))
+	}
+	return dst, nil
+}
+
+// appendLSSID appends a SID as lsSID reads it: a 4-octet index, or a
+// 3-octet label.
+func appendLSSID(dst []byte, sid uint32, isIndex bool) []byte {
+	if isIndex {
+		return binary.BigEndian.AppendUint32(dst, sid)
+	}
+	sid &= 0xfffff
+	return append(dst, byte(sid>>16), byte(sid>>8), byte(sid))
+}
+
+// appendLSAddr appends an address TLV, of type typ4 or typ6 by the
+// address family.
+func appendLSAddr(dst []byte, typ4, typ6 uint16, s string) ([]byte, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return dst, fmt.Errorf("bgp: invalid bgp-ls address %q", s)
+	}
+	typ := typ4
+	if addr.Is6() {
+		typ = typ6
+	}
+	return appendLSTLV(dst, typ, addr.AsSlice()), nil
+}
+
+// appendLSTLV appends a TLV as forEachTLV reads it.
+func appendLSTLV(dst []byte, typ uint16, v []byte) []byte {
+	var start int
+	dst, start = beginLSTLV(dst, typ)
+	dst = append(dst, v...)
+	return endLSTLV(dst, start)
+}
+
+// beginLSTLV appends the type and a placeholder length of a TLV, and
+// returns where its value starts for endLSTLV.
+func beginLSTLV(dst []byte, typ uint16) ([]byte, int) {
+	dst = binary.BigEndian.AppendUint16(dst, typ)
+	dst = append(dst, 0, 0)
+	return dst, len(dst)
+}
+
+// endLSTLV sets the length of the TLV whose value starts at start.
+func endLSTLV(dst []byte, start int) []byte {
+	binary.BigEndian.PutUint16(dst[start-2:start], uint16(len(dst)-start))
+	return dst
+}
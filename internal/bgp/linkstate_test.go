@@ -0,0 +1,230 @@
+package bgp
+
+import (
+	"slices"
+	"testing"
+)
+
+// lsTLV builds a BGP-LS TLV from the concatenated parts.
+func lsTLV(typ uint16, parts ...[]byte) []byte {
+	var v []byte
+	for _, p := range parts {
+		v = append(v, p...)
+	}
+	return append([]byte{byte(typ >> 8), byte(typ), byte(len(v) >> 8), byte(len(v))}, v...)
+}
+
+// lsNLRI builds a BGP-LS NLRI for IS-IS L2 (protocol 2), identifier 0.
+func lsNLRI(nlriType uint16, tlvs ...[]byte) []byte {
+	body := []byte{2, 0, 0, 0, 0, 0, 0, 0, 0}
+	for _, t := range tlvs {
+		body = append(body, t...)
+	}
+	return append([]byte{byte(nlriType >> 8), byte(nlriType), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// lsNode builds a node descriptor TLV for AS 65000 and an IS-IS system ID
+// ending in id.
+func lsNode(typ uint16, id byte) []byte {
+	return lsTLV(typ,
+		lsTLV(lsASNumber, []byte{0, 0, 0xFD, 0xE8}),
+		lsTLV(lsIGPRouterID, []byte{0, 0, 0, 0, 0, id}),
+	)
+}
+
+// lsUpdate wraps BGP-LS NLRI in MP_REACH_NLRI with next hop 192.0.2.1 and
+// the given BGP-LS Attribute TLVs.
+func lsUpdate(nlri []byte, attrTLVs ...[]byte) []byte {
+	mpReach := []byte{0x40, 0x04, SAFIBGPLS, 4, 192, 0, 2, 1, 0}
+	mpReach = append(mpReach, nlri...)
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	if len(attrTLVs) > 0 {
+		var v []byte
+		for _, t := range attrTLVs {
+			v = append(v, t...)
+		}
+		pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeBGPLS, v)...)
+	}
+	return buildBGPUpdate(nil, pathAttrs, nil)
+}
+
+func TestParseUpdate_LSNode(t *testing.T) {
+	nlri := lsNLRI(LSNodeNLRI, lsNode(lsLocalNodeDesc, 1))
+	srCaps := lsTLV(lsSRCapabilities, []byte{0x80, 0},
+		[]byte{0, 0x1F, 0x40}, lsTLV(lsSIDLabel, []byte{0, 0x3E, 0x80})) // 8000 labels from 16000
+	update := lsUpdate(nlri,
+		lsTLV(lsNodeName, []byte("pe1")),
+		lsTLV(lsIPv4RouterID, []byte{10, 0, 0, 1}),
+		srCaps,
+		lsTLV(lsSRAlgorithm, []byte{0, 1}),
+	)
+
+	events, err := ParseUpdate(update, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].LinkState == nil {
+		t.Fatalf("expected 1 BGP-LS event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.AFI != int(AFIBGPLS) || ev.SAFI != SAFIBGPLS || ev.Action != "A" || ev.Nexthop != "192.0.2.1" {
+		t.Errorf("unexpected %d/%d %s nexthop %s", ev.AFI, ev.SAFI, ev.Action, ev.Nexthop)
+	}
+	ls := ev.LinkState
+	if ls.Type != LSNodeNLRI || ls.ProtocolID != 2 {
+		t.Errorf("unexpected type %d protocol %d", ls.Type, ls.ProtocolID)
+	}
+	if ls.LocalNode.ASN != 65000 || ls.LocalNode.IGPRouterID != "0000.0000.0001" {
+		t.Errorf("unexpected local node %+v", ls.LocalNode)
+	}
+	if got, want := ls.Key(), "[N][2][0][65000:0::0000.0000.0001]"; got != want {
+		t.Errorf("key = %s, want %s", got, want)
+	}
+	a := ls.Attr
+	if a == nil {
+		t.Fatal("expected BGP-LS attribute")
+	}
+	if a.NodeName != "pe1" || !slices.Equal(a.LocalRouterIDs, []string{"10.0.0.1"}) {
+		t.Errorf("unexpected name %q router IDs %v", a.NodeName, a.LocalRouterIDs)
+	}
+	if want := []LabelRange{{Start: 16000, Size: 8000}}; !slices.Equal(a.SRGB, want) {
+		t.Errorf("SRGB = %v, want %v", a.SRGB, want)
+	}
+	if !slices.Equal(a.SRAlgorithms, []uint8{0, 1}) {
+		t.Errorf("SR algorithms = %v", a.SRAlgorithms)
+	}
+	if _, ok := ev.Attrs["29"]; ok {
+		t.Error("BGP-LS attribute should not be kept in Attrs")
+	}
+}
+
+func TestParseUpdate_LSLink(t *testing.T) {
+	nlri := lsNLRI(LSLinkNLRI,
+		lsNode(lsLocalNodeDesc, 1),
+		lsNode(lsRemoteNodeDesc, 2),
+		lsTLV(lsIPv4Interface, []byte{10, 1, 1, 1}),
+		lsTLV(lsIPv4Neighbor, []byte{10, 1, 1, 2}),
+	)
+	update := lsUpdate(nlri,
+		lsTLV(lsIGPMetric, []byte{0, 0, 10}),
+		lsTLV(lsTEMetric, []byte{0, 0, 0, 20}),
+		lsTLV(lsMaxLinkBandwidth, []byte{0x4E, 0x6E, 0x6B, 0x28}),                             // 1e9 bytes/s
+		lsTLV(lsAdjSID, []byte{0x30, 0, 0, 0}, []byte{0, 0x5D, 0xC0}),                         // label 24000
+		lsTLV(lsLANAdjSID, []byte{0x30, 0, 0, 0}, []byte{10, 0, 0, 2}, []byte{0, 0x5D, 0xC1}), // OSPF neighbor
+	)
+
+	events, err := ParseUpdate(update, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].LinkState == nil {
+		t.Fatalf("expected 1 BGP-LS event, got %d", len(events))
+	}
+	ls := events[0].LinkState
+	if ls.RemoteNode.IGPRouterID != "0000.0000.0002" || ls.InterfaceAddr != "10.1.1.1" || ls.NeighborAddr != "10.1.1.2" {
+		t.Errorf("unexpected link descriptors %+v", ls)
+	}
+	want := "[L][2][0][65000:0::0000.0000.0001][65000:0::0000.0000.0002][0:0:10.1.1.1:10.1.1.2:0]"
+	if got := ls.Key(); got != want {
+		t.Errorf("key = %s, want %s", got, want)
+	}
+	a := ls.Attr
+	if a.IGPMetric == nil || *a.IGPMetric != 10 || a.TEMetric == nil || *a.TEMetric != 20 {
+		t.Errorf("unexpected metrics %v %v", a.IGPMetric, a.TEMetric)
+	}
+	if a.MaxLinkBandwidth == nil || *a.MaxLinkBandwidth != 1e9 {
+		t.Errorf("unexpected bandwidth %v", a.MaxLinkBandwidth)
+	}
+	wantSIDs := []LSSID{{Flags: 0x30, SID: 24000}, {Flags: 0x30, SID: 24001}}
+	if !slices.Equal(a.AdjSIDs, wantSIDs) {
+		t.Errorf("adj SIDs = %+v, want %+v", a.AdjSIDs, wantSIDs)
+	}
+}
+
+func TestParseUpdate_LSPrefixWithdrawal(t *testing.T) {
+	nlri := lsNLRI(LSIPv6PrefixNLRI,
+		lsNode(lsLocalNodeDesc, 1),
+		lsTLV(lsMultiTopologyID, []byte{0, 2}),
+		lsTLV(lsIPReachability, []byte{64, 0x20, 0x01, 0x0d, 0xb8, 0, 1, 0, 0}),
+	)
+	mpUnreach := append([]byte{0x40, 0x04, SAFIBGPLS}, nlri...)
+	update := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, mpUnreach), nil)
+
+	events, err := ParseUpdate(update, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].LinkState == nil {
+		t.Fatalf("expected 1 BGP-LS event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "D" || ev.LinkState.Attr != nil {
+		t.Errorf("expected withdrawal without attribute, got %s %+v", ev.Action, ev.LinkState.Attr)
+	}
+	if ev.LinkState.Prefix != "2001:db8:1::/64" || ev.LinkState.MTID != 2 {
+		t.Errorf("unexpected prefix %s mt %d", ev.LinkState.Prefix, ev.LinkState.MTID)
+	}
+	if got, want := ev.LinkState.Key(), "[P][2][0][65000:0::0000.0000.0001][2001:db8:1::/64:2:0]"; got != want {
+		t.Errorf("key = %s, want %s", got, want)
+	}
+}
+
+func TestParseLSAttribute_PrefixSID(t *testing.T) {
+	a := parseLSAttribute(append(
+		lsTLV(lsPrefixMetric, []byte{0, 0, 0, 100}),
+		lsTLV(lsPrefixSID, []byte{0x40, 0, 0, 0}, []byte{0, 0, 0, 1})...,
+	))
+	if a.PrefixMetric == nil || *a.PrefixMetric != 100 {
+		t.Errorf("unexpected prefix metric %v", a.PrefixMetric)
+	}
+	want := []LSSID{{Flags: 0x40, SID: 1, IsIndex: true}}
+	if !slices.Equal(a.PrefixSIDs, want) {
+		t.Errorf("prefix SIDs = %+v, want %+v", a.PrefixSIDs, want)
+	}
+}
+
+func TestFormatIGPRouterID(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte{10, 0, 0, 1}, "10.0.0.1"},
+		{[]byte{0x19, 0x21, 0x68, 0x00, 0x10, 0x01}, "1921.6800.1001"},
+		{[]byte{0x19, 0x21, 0x68, 0x00, 0x10, 0x01, 0x02}, "1921.6800.1001.02"},
+		{[]byte{10, 0, 0, 1, 10, 1, 1, 1}, "10.0.0.1:10.1.1.1"},
+		{[]byte{1, 2}, "0102"},
+	}
+	for _, tt := range tests {
+		if got := formatIGPRouterID(tt.in); got != tt.want {
+			t.Errorf("formatIGPRouterID(%x) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseLSNLRI_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", []byte{0, 1, 0}},
+		{"short body", []byte{0, 1, 0, 2, 2, 0}},
+		{"truncated tlv", lsNLRI(LSNodeNLRI, []byte{1, 0, 0, 9})},
+		{"prefix without reachability", lsNLRI(LSIPv4PrefixNLRI, lsNode(lsLocalNodeDesc, 1))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseLSNLRI(tt.data, false); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestDetectEORFamily_BGPLS(t *testing.T) {
+	update := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, []byte{0x40, 0x04, SAFIBGPLS}), nil)
+	afi, safi := DetectEORFamily(update)
+	if afi != int(AFIBGPLS) || safi != SAFIBGPLS {
+		t.Errorf("expected 16388/71, got %d/%d", afi, safi)
+	}
+}
@@ -0,0 +1,169 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+// labelMode selects how the label stack ahead of a labeled NLRI prefix
+// (RFC 8277 §2) is decoded.
+type labelMode uint8
+
+const (
+	labelsNone   labelMode = iota // unlabeled NLRI
+	labelsSingle                  // exactly one label field
+	labelsStack                   // label fields up to the bottom-of-stack bit
+)
+
+// NLRIReader reads a sequence of (optionally Add-Path and labeled) NLRI
+// prefixes in place. For labeled NLRI the length octet covers the 24-bit
+// label fields as well as the prefix; each label field holds a 20-bit
+// label, 3 bits of Traffic Class and the bottom-of-stack bit. VPN NLRI
+// carry a Route Distinguisher between the labels and the prefix
+// (RFC 4364 §4.3.4).
+//
+// The zero NLRIReader reads nothing. Use it as:
+//
+//	for r.Next() {
+//		p := r.Prefix()
+//		...
+//	}
+//	if err := r.Err(); err != nil {
+//		...
+//	}
+type NLRIReader struct {
+	data    []byte
+	off     int
+	ipv6    bool
+	addPath bool
+	labels  labelMode
+	hasRD   bool
+	err     error
+
+	prefix netip.Prefix
+	pathID uint32
+	stack  []byte
+	rd     []byte
+}
+
+func newNLRIReader(data []byte, ipVersion int, addPath bool, labels labelMode, hasRD bool) NLRIReader {
+	return NLRIReader{data: data, ipv6: ipVersion == 6, addPath: addPath, labels: labels, hasRD: hasRD}
+}
+
+// Next advances to the next prefix. It returns false at the end of the
+// data or at a malformed prefix, which Err then reports; the prefixes read
+// before it are valid.
+func (r *NLRIReader) Next() bool {
+	if r.err != nil || r.off >= len(r.data) {
+		return false
+	}
+	data, offset := r.data, r.off
+
+	r.pathID = 0
+	if r.addPath {
+		if offset+4 > len(data) {
+			return r.fail("prefix data", offset)
+		}
+		r.pathID = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+
+	if offset >= len(data) {
+		return r.fail("prefix data", offset)
+	}
+	prefixLen := int(data[offset])
+	offset++
+
+	start := offset
+	for r.labels != labelsNone {
+		if prefixLen < 24 || offset+3 > len(data) {
+			return r.fail("label stack", offset)
+		}
+		bottom := data[offset+2]&0x01 != 0
+		offset += 3
+		prefixLen -= 24
+		if r.labels == labelsSingle || bottom {
+			break
+		}
+	}
+	r.stack = data[start:offset]
+
+	r.rd = nil
+	if r.hasRD {
+		if prefixLen < RDLen*8 || offset+RDLen > len(data) {
+			return r.fail("route distinguisher", offset)
+		}
+		r.rd = data[offset : offset+RDLen]
+		offset += RDLen
+		prefixLen -= RDLen * 8
+	}
+
+	// Reject prefix lengths that exceed the AFI maximum.
+	maxBits := 32
+	if r.ipv6 {
+		maxBits = 128
+	}
+	if prefixLen > maxBits {
+		return r.fail("prefix data", offset)
+	}
+
+	// Number of bytes needed for the prefix.
+	byteLen := (prefixLen + 7) / 8
+	if offset+byteLen > len(data) {
+		return r.fail("prefix data", offset)
+	}
+
+	var b [16]byte
+	copy(b[:], data[offset:offset+byteLen])
+	addr := netip.AddrFrom16(b)
+	if !r.ipv6 {
+		addr = netip.AddrFrom4([4]byte(b[:4]))
+	}
+	r.prefix = netip.PrefixFrom(addr, prefixLen)
+	r.off = offset + byteLen
+	return true
+}
+
+func (r *NLRIReader) fail(field string, offset int) bool {
+	r.err = fmt.Errorf("bgp: %s truncated at offset %d", field, offset)
+	return false
+}
+
+// Err returns the error that stopped Next, if any.
+func (r *NLRIReader) Err() error {
+	return r.err
+}
+
+// Prefix returns the current prefix. Host bits are kept as sent.
+func (r *NLRIReader) Prefix() netip.Prefix {
+	return r.prefix
+}
+
+// PathID returns the Add-Path Path Identifier of the current prefix, or 0.
+func (r *NLRIReader) PathID() uint32 {
+	return r.pathID
+}
+
+// RD returns the Route Distinguisher of the current VPN prefix, for
+// FormatRD, or nil.
+func (r *NLRIReader) RD() []byte {
+	return r.rd
+}
+
+// AppendLabels appends the labels of the current prefix to dst, bottom of
+// stack last.
+func (r *NLRIReader) AppendLabels(dst []uint32) []uint32 {
+	for i := 0; i+3 <= len(r.stack); i += 3 {
+		dst = append(dst, (uint32(r.stack[i])<<16|uint32(r.stack[i+1])<<8|uint32(r.stack[i+2]))>>4)
+	}
+	return dst
+}
+
+// labelStack returns the labels of the current prefix, or nil.
+func (r *NLRIReader) labelStack() []uint32 {
+	if len(r.stack) == 0 {
+		return nil
+	}
+	return r.AppendLabels(make([]uint32, 0, len(r.stack)/3))
+}
@@ -0,0 +1,169 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// NOTIFICATION error codes (RFC 4271 §4.5).
+const (
+	NotifMessageHeaderError     uint8 = 1
+	NotifOpenMessageError       uint8 = 2
+	NotifUpdateMessageError     uint8 = 3
+	NotifHoldTimerExpired       uint8 = 4
+	NotifFSMError               uint8 = 5
+	NotifCease                  uint8 = 6
+	NotifRouteRefreshMessageErr uint8 = 7 // RFC 7313
+)
+
+// Cease subcodes that carry a Shutdown Communication (RFC 9003 §2).
+const (
+	CeaseAdministrativeShutdown uint8 = 2
+	CeaseAdministrativeReset    uint8 = 4
+)
+
+// NotifCodeNames maps NOTIFICATION error codes to names.
+var NotifCodeNames = map[uint8]string{
+	NotifMessageHeaderError:     "message_header_error",
+	NotifOpenMessageError:       "open_message_error",
+	NotifUpdateMessageError:     "update_message_error",
+	NotifHoldTimerExpired:       "hold_timer_expired",
+	NotifFSMError:               "fsm_error",
+	NotifCease:                  "cease",
+	NotifRouteRefreshMessageErr: "route_refresh_message_error",
+}
+
+// NotifSubcodeNames maps NOTIFICATION error codes to the names of their
+// subcodes (RFC 4271 §4.5, RFC 4486, RFC 6608, RFC 7313, RFC 8538,
+// RFC 9234, RFC 9384).
+var NotifSubcodeNames = map[uint8]map[uint8]string{
+	NotifMessageHeaderError: {
+		1: "connection_not_synchronized",
+		2: "bad_message_length",
+		3: "bad_message_type",
+	},
+	NotifOpenMessageError: {
+		1:  "unsupported_version_number",
+		2:  "bad_peer_as",
+		3:  "bad_bgp_identifier",
+		4:  "unsupported_optional_parameter",
+		6:  "unacceptable_hold_time",
+		7:  "unsupported_capability",
+		11: "role_mismatch",
+	},
+	NotifUpdateMessageError: {
+		1:  "malformed_attribute_list",
+		2:  "unrecognized_well_known_attribute",
+		3:  "missing_well_known_attribute",
+		4:  "attribute_flags_error",
+		5:  "attribute_length_error",
+		6:  "invalid_origin_attribute",
+		8:  "invalid_next_hop_attribute",
+		9:  "optional_attribute_error",
+		10: "invalid_network_field",
+		11: "malformed_as_path",
+	},
+	NotifFSMError: {
+		1: "unexpected_message_in_opensent",
+		2: "unexpected_message_in_openconfirm",
+		3: "unexpected_message_in_established",
+	},
+	NotifCease: {
+		1:  "maximum_prefixes_reached",
+		2:  "administrative_shutdown",
+		3:  "peer_deconfigured",
+		4:  "administrative_reset",
+		5:  "connection_rejected",
+		6:  "other_configuration_change",
+		7:  "connection_collision_resolution",
+		8:  "out_of_resources",
+		9:  "hard_reset",
+		10: "bfd_down",
+	},
+	NotifRouteRefreshMessageErr: {
+		1: "invalid_message_length",
+	},
+}
+
+// Notification is a decoded BGP NOTIFICATION message.
+type Notification struct {
+	Code    uint8
+	Subcode uint8
+	Data    []byte // raw Data field, including any Shutdown Communication
+	// ShutdownMessage is the operator's text from an Administrative
+	// Shutdown or Reset (RFC 9003). Empty if absent or not valid UTF-8.
+	ShutdownMessage string
+}
+
+// CodeName returns the error code name, or "code_N" for unknown codes.
+func (n *Notification) CodeName() string {
+	if name, ok := NotifCodeNames[n.Code]; ok {
+		return name
+	}
+	return fmt.Sprintf("code_%d", n.Code)
+}
+
+// SubcodeName returns the error subcode name, "unspecific" for subcode 0,
+// or "subcode_N" for unknown subcodes.
+func (n *Notification) SubcodeName() string {
+	if n.Subcode == 0 {
+		return "unspecific"
+	}
+	if name, ok := NotifSubcodeNames[n.Code][n.Subcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("subcode_%d", n.Subcode)
+}
+
+// ParseNotification decodes a BGP NOTIFICATION message, including its
+// 19-byte header. data may extend past the message; the header length is
+// authoritative.
+func ParseNotification(data []byte) (*Notification, error) {
+	const minNotifLen = BGPHeaderSize + 2
+	if len(data) < minNotifLen {
+		return nil, fmt.Errorf("bgp: notification too short (%d bytes)", len(data))
+	}
+	for i := 0; i < 16; i++ {
+		if data[i] != 0xFF {
+			return nil, fmt.Errorf("bgp: invalid notification marker at byte %d", i)
+		}
+	}
+	if data[18] != BGPMsgTypeNotification {
+		return nil, fmt.Errorf("bgp: message type %d is not NOTIFICATION", data[18])
+	}
+	msgLen := int(binary.BigEndian.Uint16(data[16:18]))
+	if msgLen < minNotifLen || msgLen > len(data) {
+		return nil, fmt.Errorf("bgp: invalid notification length %d (have %d bytes)", msgLen, len(data))
+	}
+
+	n := &Notification{
+		Code:    data[19],
+		Subcode: data[20],
+	}
+	if msgLen > minNotifLen {
+		n.Data = data[minNotifLen:msgLen]
+	}
+
+	if n.Code == NotifCease && (n.Subcode == CeaseAdministrativeShutdown || n.Subcode == CeaseAdministrativeReset) {
+		n.ShutdownMessage = shutdownCommunication(n.Data)
+	}
+	return n, nil
+}
+
+// shutdownCommunication extracts the length-prefixed UTF-8 text of an RFC
+// 9003 Shutdown Communication. Malformed data yields "".
+func shutdownCommunication(data []byte) string {
+	if len(data) < 1 {
+		return ""
+	}
+	msgLen := int(data[0])
+	if msgLen == 0 || 1+msgLen > len(data) {
+		return ""
+	}
+	text := data[1 : 1+msgLen]
+	if !utf8.Valid(text) {
+		return ""
+	}
+	return string(text)
+}
@@ -0,0 +1,127 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// buildNotification constructs a BGP NOTIFICATION with the given data field.
+func buildNotification(code, subcode uint8, data []byte) []byte {
+	msg := make([]byte, 21+len(data))
+	for i := 0; i < 16; i++ {
+		msg[i] = 0xFF
+	}
+	binary.BigEndian.PutUint16(msg[16:18], uint16(len(msg)))
+	msg[18] = BGPMsgTypeNotification
+	msg[19] = code
+	msg[20] = subcode
+	copy(msg[21:], data)
+	return msg
+}
+
+func TestParseNotification(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      []byte
+		code     string
+		subcode  string
+		shutdown string
+	}{
+		{
+			name:    "hold timer expired",
+			msg:     buildNotification(NotifHoldTimerExpired, 0, nil),
+			code:    "hold_timer_expired",
+			subcode: "unspecific",
+		},
+		{
+			name:    "bad peer AS",
+			msg:     buildNotification(NotifOpenMessageError, 2, []byte{0xFD, 0xE9}),
+			code:    "open_message_error",
+			subcode: "bad_peer_as",
+		},
+		{
+			name:     "administrative shutdown with communication",
+			msg:      buildNotification(NotifCease, CeaseAdministrativeShutdown, append([]byte{14}, "maintenance #7"...)),
+			code:     "cease",
+			subcode:  "administrative_shutdown",
+			shutdown: "maintenance #7",
+		},
+		{
+			name:    "shutdown communication overruns data",
+			msg:     buildNotification(NotifCease, CeaseAdministrativeReset, append([]byte{40}, "short"...)),
+			code:    "cease",
+			subcode: "administrative_reset",
+		},
+		{
+			name:    "shutdown communication not UTF-8",
+			msg:     buildNotification(NotifCease, CeaseAdministrativeShutdown, []byte{2, 0xC3, 0x28}),
+			code:    "cease",
+			subcode: "administrative_shutdown",
+		},
+		{
+			name:    "unknown code and subcode",
+			msg:     buildNotification(42, 9, nil),
+			code:    "code_42",
+			subcode: "subcode_9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := ParseNotification(tt.msg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if n.CodeName() != tt.code {
+				t.Errorf("expected code %q, got %q", tt.code, n.CodeName())
+			}
+			if n.SubcodeName() != tt.subcode {
+				t.Errorf("expected subcode %q, got %q", tt.subcode, n.SubcodeName())
+			}
+			if n.ShutdownMessage != tt.shutdown {
+				t.Errorf("expected shutdown message %q, got %q", tt.shutdown, n.ShutdownMessage)
+			}
+		})
+	}
+}
+
+func TestParseNotification_DataBoundedByLength(t *testing.T) {
+	msg := buildNotification(NotifCease, 1, []byte{0, 1, 0, 0, 0, 100})
+	msg = append(msg, 0xAA, 0xBB) // trailing bytes of the next message
+
+	n, err := ParseNotification(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(n.Data) != 6 {
+		t.Errorf("expected 6 data bytes, got %d", len(n.Data))
+	}
+}
+
+func TestParseNotification_Malformed(t *testing.T) {
+	valid := buildNotification(NotifCease, 2, nil)
+
+	badMarker := append([]byte(nil), valid...)
+	badMarker[3] = 0
+	wrongType := append([]byte(nil), valid...)
+	wrongType[18] = BGPMsgTypeOpen
+	badLength := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint16(badLength[16:18], 64)
+
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"truncated", valid[:20]},
+		{"bad marker", badMarker},
+		{"wrong type", wrongType},
+		{"length exceeds data", badLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseNotification(tt.msg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
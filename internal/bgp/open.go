@@ -0,0 +1,502 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Capability codes (RFC 5492 registry).
+const (
+	CapMultiprotocol        uint8 = 1
+	CapRouteRefresh         uint8 = 2
+	CapExtendedNextHop      uint8 = 5
+	CapExtendedMessage      uint8 = 6
+	CapMultipleLabels       uint8 = 8
+	CapRole                 uint8 = 9
+	CapGracefulRestart      uint8 = 64
+	CapFourOctetAS          uint8 = 65
+	CapAddPath              uint8 = 69
+	CapEnhancedRouteRefresh uint8 = 70
+	CapLLGR                 uint8 = 71
+	CapFQDN                 uint8 = 73
+	CapRouteRefreshCisco    uint8 = 128
+)
+
+// AFISAFI identifies an address family.
+type AFISAFI struct {
+	AFI  uint16
+	SAFI uint8
+}
+
+var afiNames = map[uint16]string{
+	AFIIPv4:  "ipv4",
+	AFIIPv6:  "ipv6",
+	AFIL2VPN: "l2vpn",
+	AFIBGPLS: "bgp-ls",
+}
+
+var safiNames = map[uint8]string{
+	SAFIUnicast:        "unicast",
+	SAFIMulticast:      "multicast",
+	SAFILabeledUnicast: "labeled-unicast",
+	SAFIEVPN:           "evpn",
+	SAFIBGPLS:          "bgp-ls",
+	SAFISRPolicy:       "sr-policy",
+	SAFIMPLSVPN:        "mpls-vpn",
+	SAFIFlowSpec:       "flowspec",
+	SAFIFlowSpecVPN:    "flowspec-vpn",
+}
+
+// String returns the family as e.g. "ipv4-unicast", or "afi<N>-safi<N>" for
+// unknown codes.
+func (f AFISAFI) String() string {
+	afi, ok := afiNames[f.AFI]
+	if !ok {
+		afi = fmt.Sprintf("afi%d", f.AFI)
+	}
+	safi, ok := safiNames[f.SAFI]
+	if !ok {
+		safi = fmt.Sprintf("safi%d", f.SAFI)
+	}
+	return afi + "-" + safi
+}
+
+func (f AFISAFI) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// AddPathMode is the Send/Receive field of the Add-Path capability (RFC 7911 §4).
+type AddPathMode uint8
+
+const (
+	AddPathReceive AddPathMode = 1
+	AddPathSend    AddPathMode = 2
+	AddPathBoth    AddPathMode = 3
+)
+
+func (m AddPathMode) String() string {
+	switch m {
+	case AddPathReceive:
+		return "receive"
+	case AddPathSend:
+		return "send"
+	case AddPathBoth:
+		return "both"
+	}
+	return fmt.Sprintf("mode%d", uint8(m))
+}
+
+func (m AddPathMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m AddPathMode) canSend() bool    { return m&AddPathSend != 0 }
+func (m AddPathMode) canReceive() bool { return m&AddPathReceive != 0 }
+
+// BGP Role capability values (RFC 9234 §4.1).
+const (
+	RoleProvider uint8 = 0
+	RoleRS       uint8 = 1
+	RoleRSClient uint8 = 2
+	RoleCustomer uint8 = 3
+	RolePeer     uint8 = 4
+)
+
+// RoleNames maps BGP Role capability values (RFC 9234 §4.1) to names.
+var RoleNames = map[uint8]string{
+	0: "provider",
+	1: "rs",
+	2: "rs-client",
+	3: "customer",
+	4: "peer",
+}
+
+// AddPathFamily is one AFI/SAFI entry of the Add-Path capability.
+type AddPathFamily struct {
+	Family AFISAFI     `json:"family"`
+	Mode   AddPathMode `json:"mode"`
+}
+
+// ExtendedNextHopFamily is one entry of the Extended Next Hop capability
+// (RFC 8950): NLRI of Family may carry a next hop of NexthopAFI.
+type ExtendedNextHopFamily struct {
+	Family     AFISAFI `json:"family"`
+	NexthopAFI uint16  `json:"nexthop_afi"`
+}
+
+// MultipleLabelsFamily is one entry of the Multiple Labels capability
+// (RFC 8277 §2.1): the speaker can receive up to Count labels in NLRI of
+// Family.
+type MultipleLabelsFamily struct {
+	Family AFISAFI `json:"family"`
+	Count  uint8   `json:"count"`
+}
+
+// GracefulRestart is the Graceful Restart capability (RFC 4724 §3).
+type GracefulRestart struct {
+	Restarting   bool             `json:"restarting"`   // R bit
+	Notification bool             `json:"notification"` // N bit (RFC 8538)
+	RestartTime  uint16           `json:"restart_time"` // seconds
+	Families     []GracefulFamily `json:"families,omitempty"`
+}
+
+// GracefulFamily is one AFI/SAFI entry of the Graceful Restart capability.
+type GracefulFamily struct {
+	Family              AFISAFI `json:"family"`
+	ForwardingPreserved bool    `json:"forwarding_preserved"`
+}
+
+// LLGRFamily is one AFI/SAFI entry of the Long-Lived Graceful Restart
+// capability (RFC 9494).
+type LLGRFamily struct {
+	Family              AFISAFI `json:"family"`
+	ForwardingPreserved bool    `json:"forwarding_preserved"`
+	StaleTime           uint32  `json:"stale_time"` // seconds (24-bit)
+}
+
+// Capabilities holds the decoded capabilities of one OPEN message.
+// Capabilities that were not advertised are left at their zero value.
+type Capabilities struct {
+	Multiprotocol        []AFISAFI               `json:"multiprotocol,omitempty"`
+	RouteRefresh         bool                    `json:"route_refresh"`
+	EnhancedRouteRefresh bool                    `json:"enhanced_route_refresh"`
+	ExtendedMessage      bool                    `json:"extended_message"`
+	ExtendedNextHop      []ExtendedNextHopFamily `json:"extended_nexthop,omitempty"`
+	MultipleLabels       []MultipleLabelsFamily  `json:"multiple_labels,omitempty"`
+	FourOctetAS          uint32                  `json:"four_octet_as,omitempty"`
+	AddPath              []AddPathFamily         `json:"add_path,omitempty"`
+	GracefulRestart      *GracefulRestart        `json:"graceful_restart,omitempty"`
+	LLGR                 []LLGRFamily            `json:"llgr,omitempty"`
+	HasRole              bool                    `json:"-"`
+	Role                 uint8                   `json:"-"`
+	RoleName             string                  `json:"role,omitempty"`
+	Hostname             string                  `json:"hostname,omitempty"`
+	DomainName           string                  `json:"domain_name,omitempty"`
+	Unknown              []uint8                 `json:"unknown,omitempty"` // codes of capabilities not decoded above
+}
+
+// OpenMessage is a decoded BGP OPEN (RFC 4271 §4.2).
+type OpenMessage struct {
+	Version      uint8        `json:"version"`
+	ASN          uint32       `json:"asn"` // 4-octet AS capability if advertised, else My Autonomous System
+	HoldTime     uint16       `json:"hold_time"`
+	BGPID        string       `json:"bgp_id"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// ParseOpen decodes a BGP OPEN message, starting at the 16-byte marker.
+// The fixed fields must be well-formed; optional parameters and
+// capabilities are decoded on a best-effort basis and decoding stops at the
+// first truncated entry.
+//
+//	Offset  0: Marker (16 bytes)
+//	Offset 16: Length (2 bytes)
+//	Offset 18: Type (1 byte, must be 1 for OPEN)
+//	Offset 19: Version (1 byte)
+//	Offset 20: My Autonomous System (2 bytes)
+//	Offset 22: Hold Time (2 bytes)
+//	Offset 24: BGP Identifier (4 bytes)
+//	Offset 28: Opt Parm Len (1 byte)
+//	Offset 29: Optional Parameters (variable)
+func ParseOpen(data []byte) (*OpenMessage, error) {
+	const minOpenLen = 29
+	if len(data) < minOpenLen {
+		return nil, fmt.Errorf("bgp: open too short (%d bytes)", len(data))
+	}
+	for i := 0; i < 16; i++ {
+		if data[i] != 0xFF {
+			return nil, fmt.Errorf("bgp: invalid open marker at byte %d", i)
+		}
+	}
+	if data[18] != BGPMsgTypeOpen {
+		return nil, fmt.Errorf("bgp: message type %d is not OPEN", data[18])
+	}
+	msgLen := int(binary.BigEndian.Uint16(data[16:18]))
+	if msgLen < minOpenLen || msgLen > len(data) {
+		return nil, fmt.Errorf("bgp: invalid open length %d (have %d bytes)", msgLen, len(data))
+	}
+	data = data[:msgLen]
+
+	msg := &OpenMessage{
+		Version:  data[19],
+		ASN:      uint32(binary.BigEndian.Uint16(data[20:22])),
+		HoldTime: binary.BigEndian.Uint16(data[22:24]),
+		BGPID:    net.IP(data[24:28]).String(),
+	}
+
+	parseOptionalParams(data[28:], &msg.Capabilities)
+
+	if msg.Capabilities.FourOctetAS != 0 {
+		msg.ASN = msg.Capabilities.FourOctetAS
+	}
+	return msg, nil
+}
+
+// parseOptionalParams walks the Optional Parameters starting at the Opt
+// Parm Len byte, including the RFC 9072 extended encoding (Opt Parm Len and
+// Non-Ext OP Type both 255, followed by a 2-byte length and 2-byte
+// per-parameter lengths).
+func parseOptionalParams(data []byte, caps *Capabilities) {
+	paramsLen := int(data[0])
+	params := data[1:]
+	extended := false
+	if paramsLen == 255 && len(params) >= 3 && params[0] == 255 {
+		extended = true
+		paramsLen = int(binary.BigEndian.Uint16(params[1:3]))
+		params = params[3:]
+	}
+	if paramsLen > len(params) {
+		paramsLen = len(params)
+	}
+	params = params[:paramsLen]
+
+	offset := 0
+	for offset < len(params) {
+		paramType := params[offset]
+		var paramLen int
+		if extended {
+			if offset+3 > len(params) {
+				return
+			}
+			paramLen = int(binary.BigEndian.Uint16(params[offset+1 : offset+3]))
+			offset += 3
+		} else {
+			if offset+2 > len(params) {
+				return
+			}
+			paramLen = int(params[offset+1])
+			offset += 2
+		}
+		if offset+paramLen > len(params) {
+			return
+		}
+		if paramType == 2 { // Capabilities (RFC 5492)
+			parseCapabilities(params[offset:offset+paramLen], caps)
+		}
+		offset += paramLen
+	}
+}
+
+func parseCapabilities(data []byte, caps *Capabilities) {
+	offset := 0
+	for offset+2 <= len(data) {
+		code := data[offset]
+		capLen := int(data[offset+1])
+		offset += 2
+		if offset+capLen > len(data) {
+			return
+		}
+		value := data[offset : offset+capLen]
+		offset += capLen
+
+		switch code {
+		case CapMultiprotocol:
+			if len(value) == 4 {
+				caps.Multiprotocol = append(caps.Multiprotocol, AFISAFI{
+					AFI:  binary.BigEndian.Uint16(value[0:2]),
+					SAFI: value[3],
+				})
+			}
+		case CapRouteRefresh, CapRouteRefreshCisco:
+			caps.RouteRefresh = true
+		case CapEnhancedRouteRefresh:
+			caps.EnhancedRouteRefresh = true
+		case CapExtendedMessage:
+			caps.ExtendedMessage = true
+		case CapExtendedNextHop:
+			for i := 0; i+6 <= len(value); i += 6 {
+				caps.ExtendedNextHop = append(caps.ExtendedNextHop, ExtendedNextHopFamily{
+					Family: AFISAFI{
+						AFI:  binary.BigEndian.Uint16(value[i : i+2]),
+						SAFI: uint8(binary.BigEndian.Uint16(value[i+2 : i+4])),
+					},
+					NexthopAFI: binary.BigEndian.Uint16(value[i+4 : i+6]),
+				})
+			}
+		case CapMultipleLabels:
+			for i := 0; i+4 <= len(value); i += 4 {
+				caps.MultipleLabels = append(caps.MultipleLabels, MultipleLabelsFamily{
+					Family: AFISAFI{AFI: binary.BigEndian.Uint16(value[i : i+2]), SAFI: value[i+2]},
+					Count:  value[i+3],
+				})
+			}
+		case CapRole:
+			if len(value) == 1 {
+				caps.HasRole = true
+				caps.Role = value[0]
+				caps.RoleName = RoleNames[value[0]]
+				if caps.RoleName == "" {
+					caps.RoleName = fmt.Sprintf("role%d", value[0])
+				}
+			}
+		case CapGracefulRestart:
+			if len(value) >= 2 {
+				hdr := binary.BigEndian.Uint16(value[0:2])
+				gr := &GracefulRestart{
+					Restarting:   hdr&0x8000 != 0,
+					Notification: hdr&0x4000 != 0,
+					RestartTime:  hdr & 0x0FFF,
+				}
+				for i := 2; i+4 <= len(value); i += 4 {
+					gr.Families = append(gr.Families, GracefulFamily{
+						Family:              AFISAFI{AFI: binary.BigEndian.Uint16(value[i : i+2]), SAFI: value[i+2]},
+						ForwardingPreserved: value[i+3]&0x80 != 0,
+					})
+				}
+				caps.GracefulRestart = gr
+			}
+		case CapFourOctetAS:
+			if len(value) == 4 {
+				caps.FourOctetAS = binary.BigEndian.Uint32(value)
+			}
+		case CapAddPath:
+			for i := 0; i+4 <= len(value); i += 4 {
+				caps.AddPath = append(caps.AddPath, AddPathFamily{
+					Family: AFISAFI{AFI: binary.BigEndian.Uint16(value[i : i+2]), SAFI: value[i+2]},
+					Mode:   AddPathMode(value[i+3]),
+				})
+			}
+		case CapLLGR:
+			for i := 0; i+7 <= len(value); i += 7 {
+				caps.LLGR = append(caps.LLGR, LLGRFamily{
+					Family:              AFISAFI{AFI: binary.BigEndian.Uint16(value[i : i+2]), SAFI: value[i+2]},
+					ForwardingPreserved: value[i+3]&0x80 != 0,
+					StaleTime:           uint32(value[i+4])<<16 | uint32(value[i+5])<<8 | uint32(value[i+6]),
+				})
+			}
+		case CapFQDN:
+			// draft-walton-bgp-hostname: hostname len(1) + hostname +
+			// domain len(1) + domain.
+			if len(value) >= 1 {
+				n := int(value[0])
+				if 1+n <= len(value) {
+					caps.Hostname = string(value[1 : 1+n])
+					rest := value[1+n:]
+					if len(rest) >= 1 && 1+int(rest[0]) <= len(rest) {
+						caps.DomainName = string(rest[1 : 1+int(rest[0])])
+					}
+				}
+			}
+		default:
+			caps.Unknown = append(caps.Unknown, code)
+		}
+	}
+}
+
+// addPathMode returns the Add-Path mode advertised for f, or 0.
+func (c *Capabilities) addPathMode(f AFISAFI) AddPathMode {
+	for _, ap := range c.AddPath {
+		if ap.Family == f {
+			return ap.Mode
+		}
+	}
+	return 0
+}
+
+// families returns the advertised multiprotocol families. An OPEN without
+// the Multiprotocol capability implies IPv4 unicast only (RFC 4760 §8).
+func (c *Capabilities) families() []AFISAFI {
+	if len(c.Multiprotocol) == 0 {
+		return []AFISAFI{{AFI: AFIIPv4, SAFI: SAFIUnicast}}
+	}
+	return c.Multiprotocol
+}
+
+// Session is what a BGP session negotiated, from the point of view of the
+// BMP-monitored router: "sent" is the router's OPEN, "received" the peer's.
+type Session struct {
+	HoldTime             uint16
+	FourOctetAS          bool
+	ExtendedMessage      bool
+	RouteRefresh         bool
+	EnhancedRouteRefresh bool
+	Families             []AFISAFI
+	// AddPathRX lists families whose UPDATEs from the peer carry Path
+	// Identifiers: the peer advertised send and the router receive.
+	AddPathRX []AFISAFI
+	// AddPathTX lists families whose UPDATEs to the peer carry Path
+	// Identifiers: the router advertised send and the peer receive.
+	AddPathTX []AFISAFI
+	// MultiLabelRX lists labeled families whose UPDATEs from the peer may
+	// carry more than one label: the router advertised Multiple Labels
+	// with a count above one (RFC 8277 §2.1).
+	MultiLabelRX []AFISAFI
+	// MultiLabelTX lists labeled families whose UPDATEs to the peer may
+	// carry more than one label: the peer advertised Multiple Labels.
+	MultiLabelTX []AFISAFI
+	// ExtendedNextHopRX lists IPv4 families whose UPDATEs from the peer may
+	// carry an IPv6 next hop: the router advertised Extended Next Hop for
+	// them (RFC 8950 §4).
+	ExtendedNextHopRX []AFISAFI
+	// ExtendedNextHopTX lists IPv4 families whose UPDATEs to the peer may
+	// carry an IPv6 next hop: the peer advertised Extended Next Hop.
+	ExtendedNextHopTX []AFISAFI
+	// HasRole reports whether the router advertised a BGP Role; Role is
+	// the router's own role on the session (RFC 9234).
+	HasRole bool
+	Role    uint8
+}
+
+// Negotiate derives the session parameters from the OPEN the router sent
+// and the OPEN it received.
+func Negotiate(sent, received *OpenMessage) *Session {
+	s := &Session{
+		HoldTime:             min(sent.HoldTime, received.HoldTime),
+		FourOctetAS:          sent.Capabilities.FourOctetAS != 0 && received.Capabilities.FourOctetAS != 0,
+		ExtendedMessage:      sent.Capabilities.ExtendedMessage && received.Capabilities.ExtendedMessage,
+		RouteRefresh:         sent.Capabilities.RouteRefresh && received.Capabilities.RouteRefresh,
+		EnhancedRouteRefresh: sent.Capabilities.EnhancedRouteRefresh && received.Capabilities.EnhancedRouteRefresh,
+		HasRole:              sent.Capabilities.HasRole,
+		Role:                 sent.Capabilities.Role,
+	}
+
+	receivedFamilies := received.Capabilities.families()
+	for _, f := range sent.Capabilities.families() {
+		if hasFamily(receivedFamilies, f) {
+			s.Families = append(s.Families, f)
+		}
+	}
+
+	for _, ap := range sent.Capabilities.AddPath {
+		peerMode := received.Capabilities.addPathMode(ap.Family)
+		if ap.Mode.canReceive() && peerMode.canSend() {
+			s.AddPathRX = append(s.AddPathRX, ap.Family)
+		}
+		if ap.Mode.canSend() && peerMode.canReceive() {
+			s.AddPathTX = append(s.AddPathTX, ap.Family)
+		}
+	}
+
+	for _, ml := range sent.Capabilities.MultipleLabels {
+		if ml.Count > 1 {
+			s.MultiLabelRX = append(s.MultiLabelRX, ml.Family)
+		}
+	}
+	for _, ml := range received.Capabilities.MultipleLabels {
+		if ml.Count > 1 {
+			s.MultiLabelTX = append(s.MultiLabelTX, ml.Family)
+		}
+	}
+
+	for _, nh := range sent.Capabilities.ExtendedNextHop {
+		if nh.NexthopAFI == AFIIPv6 {
+			s.ExtendedNextHopRX = append(s.ExtendedNextHopRX, nh.Family)
+		}
+	}
+	for _, nh := range received.Capabilities.ExtendedNextHop {
+		if nh.NexthopAFI == AFIIPv6 {
+			s.ExtendedNextHopTX = append(s.ExtendedNextHopTX, nh.Family)
+		}
+	}
+	return s
+}
+
+func hasFamily(families []AFISAFI, f AFISAFI) bool {
+	for _, x := range families {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
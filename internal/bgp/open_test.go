@@ -0,0 +1,333 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// buildCap constructs a single capability TLV.
+func buildCap(code byte, value []byte) []byte {
+	return append([]byte{code, byte(len(value))}, value...)
+}
+
+// buildOpen constructs a BGP OPEN carrying caps in one Capabilities
+// optional parameter.
+func buildOpen(myAS uint16, holdTime uint16, bgpID [4]byte, caps ...[]byte) []byte {
+	var capData []byte
+	for _, c := range caps {
+		capData = append(capData, c...)
+	}
+	var optParams []byte
+	if len(capData) > 0 {
+		optParams = append([]byte{2, byte(len(capData))}, capData...)
+	}
+
+	msg := make([]byte, 29+len(optParams))
+	for i := 0; i < 16; i++ {
+		msg[i] = 0xFF
+	}
+	binary.BigEndian.PutUint16(msg[16:18], uint16(len(msg)))
+	msg[18] = BGPMsgTypeOpen
+	msg[19] = 4
+	binary.BigEndian.PutUint16(msg[20:22], myAS)
+	binary.BigEndian.PutUint16(msg[22:24], holdTime)
+	copy(msg[24:28], bgpID[:])
+	msg[28] = byte(len(optParams))
+	copy(msg[29:], optParams)
+	return msg
+}
+
+func mpCap(afi uint16, safi uint8) []byte {
+	return buildCap(CapMultiprotocol, []byte{byte(afi >> 8), byte(afi), 0, safi})
+}
+
+func addPathCap(entries ...[]byte) []byte {
+	var v []byte
+	for _, e := range entries {
+		v = append(v, e...)
+	}
+	return buildCap(CapAddPath, v)
+}
+
+func addPathEntry(afi uint16, safi uint8, mode AddPathMode) []byte {
+	return []byte{byte(afi >> 8), byte(afi), safi, byte(mode)}
+}
+
+func TestParseOpen_AllCapabilities(t *testing.T) {
+	msg := buildOpen(23456, 90, [4]byte{10, 0, 0, 1},
+		mpCap(AFIIPv4, SAFIUnicast),
+		mpCap(AFIIPv6, SAFIUnicast),
+		buildCap(CapRouteRefresh, nil),
+		buildCap(CapEnhancedRouteRefresh, nil),
+		buildCap(CapExtendedMessage, nil),
+		buildCap(CapExtendedNextHop, []byte{0, 1, 0, 1, 0, 2}),
+		buildCap(CapRole, []byte{3}),
+		buildCap(CapGracefulRestart, []byte{0x80 | 0x40, 120, 0, 1, 1, 0x80}),
+		buildCap(CapFourOctetAS, []byte{0, 0x03, 0x0D, 0x40}), // AS 200000
+		addPathCap(addPathEntry(AFIIPv4, SAFIUnicast, AddPathBoth)),
+		buildCap(CapLLGR, []byte{0, 2, 1, 0x80, 0x01, 0x51, 0x80}), // 86400s
+		buildCap(CapFQDN, []byte{3, 'r', 't', 'r', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e'}),
+		buildCap(200, []byte{1, 2}),
+	)
+
+	open, err := ParseOpen(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if open.ASN != 200000 {
+		t.Errorf("expected ASN 200000, got %d", open.ASN)
+	}
+	if open.HoldTime != 90 || open.BGPID != "10.0.0.1" || open.Version != 4 {
+		t.Errorf("unexpected fixed fields: %+v", open)
+	}
+
+	c := open.Capabilities
+	if len(c.Multiprotocol) != 2 || c.Multiprotocol[1] != (AFISAFI{AFIIPv6, SAFIUnicast}) {
+		t.Errorf("unexpected multiprotocol: %v", c.Multiprotocol)
+	}
+	if !c.RouteRefresh || !c.EnhancedRouteRefresh || !c.ExtendedMessage {
+		t.Errorf("expected route refresh, enhanced route refresh and extended message")
+	}
+	if len(c.ExtendedNextHop) != 1 || c.ExtendedNextHop[0].NexthopAFI != AFIIPv6 {
+		t.Errorf("unexpected extended next hop: %+v", c.ExtendedNextHop)
+	}
+	if !c.HasRole || c.RoleName != "customer" {
+		t.Errorf("expected role customer, got %q (present=%v)", c.RoleName, c.HasRole)
+	}
+	gr := c.GracefulRestart
+	if gr == nil || !gr.Restarting || !gr.Notification || gr.RestartTime != 120 ||
+		len(gr.Families) != 1 || !gr.Families[0].ForwardingPreserved {
+		t.Errorf("unexpected graceful restart: %+v", gr)
+	}
+	if len(c.AddPath) != 1 || c.AddPath[0].Mode != AddPathBoth {
+		t.Errorf("unexpected add-path: %+v", c.AddPath)
+	}
+	if len(c.LLGR) != 1 || c.LLGR[0].StaleTime != 86400 || c.LLGR[0].Family.AFI != AFIIPv6 {
+		t.Errorf("unexpected llgr: %+v", c.LLGR)
+	}
+	if c.Hostname != "rtr" || c.DomainName != "example" {
+		t.Errorf("expected hostname rtr.example, got %q / %q", c.Hostname, c.DomainName)
+	}
+	if len(c.Unknown) != 1 || c.Unknown[0] != 200 {
+		t.Errorf("expected unknown capability 200, got %v", c.Unknown)
+	}
+}
+
+func TestParseOpen_ExtendedOptionalParameters(t *testing.T) {
+	// RFC 9072: Opt Parm Len = 255, Non-Ext OP Type = 255, 2-byte lengths.
+	caps := append(mpCap(AFIIPv6, SAFIUnicast), buildCap(CapFourOctetAS, []byte{0, 0, 0xFD, 0xE9})...)
+	param := append([]byte{2, 0, byte(len(caps))}, caps...)
+	ext := append([]byte{255, 0, byte(len(param))}, param...)
+
+	base := buildOpen(65001, 180, [4]byte{192, 0, 2, 1})
+	msg := append(base[:28], 255)
+	msg = append(msg, ext...)
+	binary.BigEndian.PutUint16(msg[16:18], uint16(len(msg)))
+
+	open, err := ParseOpen(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if open.ASN != 65001 {
+		t.Errorf("expected ASN 65001, got %d", open.ASN)
+	}
+	if len(open.Capabilities.Multiprotocol) != 1 || open.Capabilities.Multiprotocol[0].AFI != AFIIPv6 {
+		t.Errorf("unexpected multiprotocol: %v", open.Capabilities.Multiprotocol)
+	}
+}
+
+func TestParseOpen_Malformed(t *testing.T) {
+	good := buildOpen(65001, 90, [4]byte{10, 0, 0, 1})
+
+	badMarker := append([]byte(nil), good...)
+	badMarker[3] = 0
+	notOpen := append([]byte(nil), good...)
+	notOpen[18] = BGPMsgTypeUpdate
+	badLen := append([]byte(nil), good...)
+	binary.BigEndian.PutUint16(badLen[16:18], uint16(len(good)+1))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", good[:20]},
+		{"bad marker", badMarker},
+		{"not an open", notOpen},
+		{"length exceeds data", badLen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseOpen(tt.data); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestParseOpen_TruncatedCapabilityKeepsEarlierOnes(t *testing.T) {
+	msg := buildOpen(65001, 90, [4]byte{10, 0, 0, 1},
+		buildCap(CapRouteRefresh, nil),
+		[]byte{CapFourOctetAS, 4, 0, 0}, // claims 4 bytes, has 2
+	)
+
+	open, err := ParseOpen(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !open.Capabilities.RouteRefresh {
+		t.Error("expected route refresh decoded before the truncated capability")
+	}
+	if open.ASN != 65001 {
+		t.Errorf("expected 2-octet ASN 65001, got %d", open.ASN)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	ipv4 := AFISAFI{AFIIPv4, SAFIUnicast}
+	ipv6 := AFISAFI{AFIIPv6, SAFIUnicast}
+
+	sent, err := ParseOpen(buildOpen(65001, 90, [4]byte{10, 0, 0, 1},
+		mpCap(AFIIPv4, SAFIUnicast), mpCap(AFIIPv6, SAFIUnicast),
+		buildCap(CapFourOctetAS, []byte{0, 0, 0xFD, 0xE9}),
+		buildCap(CapRouteRefresh, nil),
+		addPathCap(
+			addPathEntry(AFIIPv4, SAFIUnicast, AddPathReceive),
+			addPathEntry(AFIIPv6, SAFIUnicast, AddPathSend),
+		),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := ParseOpen(buildOpen(65002, 30, [4]byte{10, 0, 0, 2},
+		mpCap(AFIIPv4, SAFIUnicast),
+		buildCap(CapFourOctetAS, []byte{0, 0, 0xFD, 0xEA}),
+		addPathCap(
+			addPathEntry(AFIIPv4, SAFIUnicast, AddPathBoth),
+			addPathEntry(AFIIPv6, SAFIUnicast, AddPathBoth),
+		),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Negotiate(sent, received)
+	if s.HoldTime != 30 {
+		t.Errorf("expected hold time 30, got %d", s.HoldTime)
+	}
+	if !s.FourOctetAS {
+		t.Error("expected 4-octet AS negotiated")
+	}
+	if s.RouteRefresh {
+		t.Error("route refresh advertised by one side only must not be negotiated")
+	}
+	if len(s.Families) != 1 || s.Families[0] != ipv4 {
+		t.Errorf("expected families [ipv4-unicast], got %v", s.Families)
+	}
+	if len(s.AddPathRX) != 1 || s.AddPathRX[0] != ipv4 {
+		t.Errorf("expected AddPathRX [ipv4-unicast], got %v", s.AddPathRX)
+	}
+	if len(s.AddPathTX) != 1 || s.AddPathTX[0] != ipv6 {
+		t.Errorf("expected AddPathTX [ipv6-unicast], got %v", s.AddPathTX)
+	}
+}
+
+func TestNegotiate_NoMultiprotocolImpliesIPv4Unicast(t *testing.T) {
+	sent, _ := ParseOpen(buildOpen(65001, 90, [4]byte{10, 0, 0, 1}))
+	received, _ := ParseOpen(buildOpen(65002, 90, [4]byte{10, 0, 0, 2}, mpCap(AFIIPv4, SAFIUnicast), mpCap(AFIIPv6, SAFIUnicast)))
+
+	s := Negotiate(sent, received)
+	if len(s.Families) != 1 || s.Families[0] != (AFISAFI{AFIIPv4, SAFIUnicast}) {
+		t.Errorf("expected families [ipv4-unicast], got %v", s.Families)
+	}
+}
+
+func TestParseUpdateSession_PerFamilyAddPath(t *testing.T) {
+	// IPv4 NLRI with a Path ID; IPv6 MP_REACH without one. A single
+	// hasAddPath flag cannot decode both.
+	nlri := []byte{0, 0, 0, 5, 24, 10, 0, 0}
+	nh := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	mpReach := []byte{0, 2, 1, 16}
+	mpReach = append(mpReach, nh...)
+	mpReach = append(mpReach, 0, 32, 0x20, 0x01, 0x0d, 0xb8)
+
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	msg := buildBGPUpdate(nil, pathAttrs, nlri)
+
+	s := &Session{AddPathRX: []AFISAFI{{AFIIPv4, SAFIUnicast}}}
+	events, err := ParseUpdateSession(msg, s, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Prefix != "10.0.0.0/24" || events[0].PathID != 5 {
+		t.Errorf("unexpected IPv4 event: %s path_id=%d", events[0].Prefix, events[0].PathID)
+	}
+	if events[1].Prefix != "2001:db8::/32" || events[1].PathID != 0 {
+		t.Errorf("unexpected IPv6 event: %s path_id=%d", events[1].Prefix, events[1].PathID)
+	}
+}
+
+func TestNegotiate_MultipleLabels(t *testing.T) {
+	lu4 := AFISAFI{AFIIPv4, SAFILabeledUnicast}
+	lu6 := AFISAFI{AFIIPv6, SAFILabeledUnicast}
+
+	sent, err := ParseOpen(buildOpen(65001, 90, [4]byte{10, 0, 0, 1},
+		mpCap(AFIIPv4, SAFILabeledUnicast), mpCap(AFIIPv6, SAFILabeledUnicast),
+		buildCap(CapMultipleLabels, []byte{0, 1, SAFILabeledUnicast, 3, 0, 2, SAFILabeledUnicast, 1}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := ParseOpen(buildOpen(65002, 90, [4]byte{10, 0, 0, 2},
+		mpCap(AFIIPv4, SAFILabeledUnicast), mpCap(AFIIPv6, SAFILabeledUnicast),
+		buildCap(CapMultipleLabels, []byte{0, 2, SAFILabeledUnicast, 2}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ml := sent.Capabilities.MultipleLabels
+	if len(ml) != 2 || ml[0].Family != lu4 || ml[0].Count != 3 || ml[1].Family != lu6 || ml[1].Count != 1 {
+		t.Fatalf("unexpected MultipleLabels: %+v", ml)
+	}
+
+	// A count of 1 allows no more labels than without the capability.
+	s := Negotiate(sent, received)
+	if len(s.MultiLabelRX) != 1 || s.MultiLabelRX[0] != lu4 {
+		t.Errorf("expected MultiLabelRX [ipv4-labeled-unicast], got %v", s.MultiLabelRX)
+	}
+	if len(s.MultiLabelTX) != 1 || s.MultiLabelTX[0] != lu6 {
+		t.Errorf("expected MultiLabelTX [ipv6-labeled-unicast], got %v", s.MultiLabelTX)
+	}
+}
+
+func TestNegotiate_ExtendedNextHop(t *testing.T) {
+	u4 := AFISAFI{AFIIPv4, SAFIUnicast}
+	vpn4 := AFISAFI{AFIIPv4, SAFIMPLSVPN}
+
+	// Extended Next Hop entries: NLRI AFI (2), NLRI SAFI (2), next hop AFI (2).
+	sent, err := ParseOpen(buildOpen(65001, 90, [4]byte{10, 0, 0, 1},
+		buildCap(CapExtendedNextHop, []byte{0, 1, 0, SAFIUnicast, 0, 2, 0, 1, 0, SAFIMPLSVPN, 0, 2}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := ParseOpen(buildOpen(65002, 90, [4]byte{10, 0, 0, 2},
+		buildCap(CapExtendedNextHop, []byte{0, 1, 0, SAFIUnicast, 0, 2}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Negotiate(sent, received)
+	if len(s.ExtendedNextHopRX) != 2 || s.ExtendedNextHopRX[0] != u4 || s.ExtendedNextHopRX[1] != vpn4 {
+		t.Errorf("expected ExtendedNextHopRX [ipv4-unicast ipv4-vpn], got %v", s.ExtendedNextHopRX)
+	}
+	if len(s.ExtendedNextHopTX) != 1 || s.ExtendedNextHopTX[0] != u4 {
+		t.Errorf("expected ExtendedNextHopTX [ipv4-unicast], got %v", s.ExtendedNextHopTX)
+	}
+}
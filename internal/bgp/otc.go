@@ -0,0 +1,19 @@
+package bgp
+
+// OTCLeak applies the RFC 9234 §5 ingress rules to a route the router
+// received on this session from a peer in AS peerAS. It reports a route
+// leak when the route carries OTC and was learned from a customer or
+// RS-client, or from a lateral peer whose AS differs from the OTC value.
+// Sessions without a BGP Role are never flagged.
+func (s *Session) OTCLeak(otc *uint32, peerAS uint32) bool {
+	if s == nil || !s.HasRole || otc == nil {
+		return false
+	}
+	switch s.Role {
+	case RoleProvider, RoleRS:
+		return true
+	case RolePeer:
+		return *otc != peerAS
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package bgp
+
+import "testing"
+
+func TestParseUpdate_OTC(t *testing.T) {
+	pathAttrs := append(wellKnownAttrs(), buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeOTC, []byte{0, 0, 0xFD, 0xE9})...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0}), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if events[0].OTC == nil || *events[0].OTC != 65001 {
+		t.Errorf("expected OTC 65001, got %v", events[0].OTC)
+	}
+	if _, ok := events[0].Attrs["35"]; ok {
+		t.Error("expected OTC to be consumed, found it in Attrs")
+	}
+}
+
+func TestNegotiate_Role(t *testing.T) {
+	sent, _ := ParseOpen(buildOpen(65001, 90, [4]byte{10, 0, 0, 1}, buildCap(CapRole, []byte{RoleProvider})))
+	received, _ := ParseOpen(buildOpen(65002, 90, [4]byte{10, 0, 0, 2}, buildCap(CapRole, []byte{RoleCustomer})))
+
+	s := Negotiate(sent, received)
+	if !s.HasRole || s.Role != RoleProvider {
+		t.Errorf("expected local role provider, got %d (present=%v)", s.Role, s.HasRole)
+	}
+}
+
+func TestSession_OTCLeak(t *testing.T) {
+	otc := func(asn uint32) *uint32 { return &asn }
+	const peerAS = 65002
+
+	tests := []struct {
+		name    string
+		session *Session
+		otc     *uint32
+		want    bool
+	}{
+		{"from customer with OTC", &Session{HasRole: true, Role: RoleProvider}, otc(65010), true},
+		{"from RS-client with OTC", &Session{HasRole: true, Role: RoleRS}, otc(65010), true},
+		{"from customer without OTC", &Session{HasRole: true, Role: RoleProvider}, nil, false},
+		{"from peer with its own OTC", &Session{HasRole: true, Role: RolePeer}, otc(peerAS), false},
+		{"from peer with foreign OTC", &Session{HasRole: true, Role: RolePeer}, otc(65010), true},
+		{"from provider with OTC", &Session{HasRole: true, Role: RoleCustomer}, otc(65010), false},
+		{"from RS with OTC", &Session{HasRole: true, Role: RoleRSClient}, otc(65010), false},
+		{"no role", &Session{}, otc(65010), false},
+		{"no session", nil, otc(65010), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.session.OTCLeak(tt.otc, peerAS); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// BGP Prefix-SID attribute TLV types (RFC 8669 §3, RFC 9252 §2).
+const (
+	prefixSIDLabelIndex     = 1
+	prefixSIDOriginatorSRGB = 3
+	prefixSIDSRv6L3Service  = 5
+	prefixSIDSRv6L2Service  = 6
+
+	srv6SIDInformation = 1 // SRv6 Service Sub-TLV
+	srv6SIDStructure   = 1 // SRv6 Service Data Sub-Sub-TLV
+)
+
+// PrefixSID is a decoded BGP Prefix-SID attribute (type 40): the SR-MPLS
+// label index and originator SRGB of labeled unicast routes (RFC 8669), or
+// the SRv6 service SIDs of VPN and EVPN routes (RFC 9252).
+type PrefixSID struct {
+	LabelIndex   *uint32       `json:"label_index,omitempty"`
+	SRGB         []LabelRange  `json:"srgb,omitempty"`
+	SRv6Services []SRv6Service `json:"srv6_services,omitempty"`
+}
+
+// SRv6Service is one SRv6 SID Information Sub-TLV of an SRv6 L3 or L2
+// Service TLV.
+type SRv6Service struct {
+	Layer     uint8             `json:"layer"` // 3 or 2
+	SID       string            `json:"sid"`
+	Flags     uint8             `json:"flags,omitempty"`
+	Behavior  uint16            `json:"behavior"` // SRv6 Endpoint Behavior (RFC 8986 §10.2)
+	Structure *SRv6SIDStructure `json:"structure,omitempty"`
+}
+
+// SRv6SIDStructure gives the bit lengths of the parts of an SRv6 SID and
+// where the part transposed into the NLRI's label field belongs (RFC 9252
+// §3.2.1).
+type SRv6SIDStructure struct {
+	LocatorBlockLen     uint8 `json:"locator_block_len"`
+	LocatorNodeLen      uint8 `json:"locator_node_len"`
+	FunctionLen         uint8 `json:"function_len"`
+	ArgumentLen         uint8 `json:"argument_len"`
+	TranspositionLen    uint8 `json:"transposition_len,omitempty"`
+	TranspositionOffset uint8 `json:"transposition_offset,omitempty"`
+}
+
+// parsePrefixSID decodes the TLVs of a Prefix-SID attribute. TLVs of
+// unknown types and malformed TLVs are skipped.
+func parsePrefixSID(data []byte) *PrefixSID {
+	p := &PrefixSID{}
+	forEachPrefixSIDTLV(data, func(typ uint8, v []byte) {
+		switch typ {
+		case prefixSIDLabelIndex:
+			// Reserved (1), Flags (2), Label Index (4)
+			if len(v) == 7 {
+				idx := binary.BigEndian.Uint32(v[3:7])
+				p.LabelIndex = &idx
+			}
+		case prefixSIDOriginatorSRGB:
+			// Flags (2), then SRGB entries of base (3) and range (3)
+			if len(v) < 2 {
+				return
+			}
+			for b := v[2:]; len(b) >= 6; b = b[6:] {
+				p.SRGB = append(p.SRGB, LabelRange{
+					Start: uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]),
+					Size:  uint32(b[3])<<16 | uint32(b[4])<<8 | uint32(b[5]),
+				})
+			}
+		case prefixSIDSRv6L3Service, prefixSIDSRv6L2Service:
+			layer := uint8(3)
+			if typ == prefixSIDSRv6L2Service {
+				layer = 2
+			}
+			// Reserved (1), then SRv6 Service Sub-TLVs
+			if len(v) < 1 {
+				return
+			}
+			forEachPrefixSIDTLV(v[1:], func(subType uint8, sv []byte) {
+				if s, ok := parseSRv6SIDInformation(subType, sv); ok {
+					s.Layer = layer
+					p.SRv6Services = append(p.SRv6Services, s)
+				}
+			})
+		}
+	})
+	if p.LabelIndex == nil && p.SRGB == nil && p.SRv6Services == nil {
+		return nil
+	}
+	return p
+}
+
+// parseSRv6SIDInformation decodes an SRv6 SID Information Sub-TLV.
+func parseSRv6SIDInformation(typ uint8, v []byte) (SRv6Service, bool) {
+	// Reserved (1), SID (16), Flags (1), Endpoint Behavior (2), Reserved (1)
+	if typ != srv6SIDInformation || len(v) < 21 {
+		return SRv6Service{}, false
+	}
+	s := SRv6Service{
+		SID:      net.IP(v[1:17]).String(),
+		Flags:    v[17],
+		Behavior: binary.BigEndian.Uint16(v[18:20]),
+	}
+	forEachPrefixSIDTLV(v[21:], func(subType uint8, sv []byte) {
+		if subType == srv6SIDStructure && len(sv) == 6 {
+			s.Structure = &SRv6SIDStructure{
+				LocatorBlockLen:     sv[0],
+				LocatorNodeLen:      sv[1],
+				FunctionLen:         sv[2],
+				ArgumentLen:         sv[3],
+				TranspositionLen:    sv[4],
+				TranspositionOffset: sv[5],
+			}
+		}
+	})
+	return s, true
+}
+
+// forEachPrefixSIDTLV calls fn for each 1-octet type, 2-octet length TLV
+// of b, which is how Prefix-SID TLVs and their SRv6 Sub-TLVs and
+// Sub-Sub-TLVs are encoded. It stops at the first truncated TLV.
+func forEachPrefixSIDTLV(b []byte, fn func(typ uint8, v []byte)) {
+	for len(b) >= 3 {
+		typ := b[0]
+		length := int(binary.BigEndian.Uint16(b[1:3]))
+		b = b[3:]
+		if length > len(b) {
+			return
+		}
+		fn(typ, b[:length])
+		b = b[length:]
+	}
+}
+
+// WithLabel returns p with the SRv6 SIDs completed by the bits transposed
+// into the label field of a route with the given label stack (RFC 9252
+// §4), or p itself if no SID is transposed. Labels hold the 20 high-order
+// bits of the label field, so at most 20 transposed bits are restored.
+func (p *PrefixSID) WithLabel(labels []uint32) *PrefixSID {
+	if p == nil || len(labels) == 0 {
+		return p
+	}
+	var services []SRv6Service
+	for i, s := range p.SRv6Services {
+		st := s.Structure
+		if st == nil || st.TranspositionLen == 0 || st.TranspositionLen > 20 ||
+			int(st.TranspositionOffset)+int(st.TranspositionLen) > 128 {
+			continue
+		}
+		sid := net.ParseIP(s.SID).To16()
+		if sid == nil {
+			continue
+		}
+		sid = append(net.IP(nil), sid...)
+		bits := labels[0] >> (20 - st.TranspositionLen)
+		for j := 0; j < int(st.TranspositionLen); j++ {
+			pos := int(st.TranspositionOffset) + j
+			mask := byte(0x80 >> (pos % 8))
+			if bits&(1<<(int(st.TranspositionLen)-1-j)) != 0 {
+				sid[pos/8] |= mask
+			} else {
+				sid[pos/8] &^= mask
+			}
+		}
+		if services == nil {
+			services = append([]SRv6Service(nil), p.SRv6Services...)
+		}
+		services[i].SID = sid.String()
+	}
+	if services == nil {
+		return p
+	}
+	c := *p
+	c.SRv6Services = services
+	return &c
+}
+
+// appendPrefixSID appends the TLVs of a Prefix-SID attribute, the inverse
+// of parsePrefixSID: the label index, the originator SRGB, then an SRv6
+// L3 Service TLV and an SRv6 L2 Service TLV holding the services of each
+// layer.
+func appendPrefixSID(dst []byte, p *PrefixSID) ([]byte, error) {
+	if p.LabelIndex != nil {
+		dst = append(dst, prefixSIDLabelIndex, 0, 7, 0, 0, 0)
+		dst = binary.BigEndian.AppendUint32(dst, *p.LabelIndex)
+	}
+	if p.SRGB != nil {
+		var start int
+		dst, start = beginPrefixSIDTLV(dst, prefixSIDOriginatorSRGB)
+		dst = append(dst, 0, 0)
+		for _, r := range p.SRGB {
+			dst = append(dst, byte(r.Start>>16), byte(r.Start>>8), byte(r.Start),
+				byte(r.Size>>16), byte(r.Size>>8), byte(r.Size))
+		}
+		dst = endPrefixSIDTLV(dst, start)
+	}
+	for _, layer := range []uint8{3, 2} {
+		typ := uint8(prefixSIDSRv6L3Service)
+		if layer == 2 {
+			typ = prefixSIDSRv6L2Service
+		}
+		var start int
+		for _, s := range p.SRv6Services {
+			if s.Layer != layer {
+				continue
+			}
+			sid, err := netip.ParseAddr(s.SID)
+			if err != nil {
+				return dst, fmt.Errorf("bgp: invalid SRv6 SID %q", s.SID)
+			}
+			if start == 0 {
+				dst, start = beginPrefixSIDTLV(dst, typ)
+				dst = append(dst, 0)
+			}
+			var subStart int
+			dst, subStart = beginPrefixSIDTLV(dst, srv6SIDInformation)
+			dst = append(dst, 0)
+			sid16 := sid.As16()
+			dst = append(dst, sid16[:]...)
+			dst = append(dst, s.Flags)
+			dst = binary.BigEndian.AppendUint16(dst, s.Behavior)
+			dst = append(dst, 0)
+			if st := s.Structure; st != nil {
+				dst = append(dst, srv6SIDStructure, 0, 6, st.LocatorBlockLen, st.LocatorNodeLen,
+					st.FunctionLen, st.ArgumentLen, st.TranspositionLen, st.TranspositionOffset)
+			}
+			dst = endPrefixSIDTLV(dst, subStart)
+		}
+		if start != 0 {
+			dst = endPrefixSIDTLV(dst, start)
+		}
+	}
+	return dst, nil
+}
+
+// beginPrefixSIDTLV appends the type and a placeholder length of a TLV
+// encoded as forEachPrefixSIDTLV reads them, and returns where its value
+// starts for endPrefixSIDTLV.
+func beginPrefixSIDTLV(dst []byte, typ uint8) ([]byte, int) {
+	dst = append(dst, typ, 0, 0)
+	return dst, len(dst)
+}
+
+// endPrefixSIDTLV sets the length of the TLV whose value starts at start.
+func endPrefixSIDTLV(dst []byte, start int) []byte {
+	binary.BigEndian.PutUint16(dst[start-2:start], uint16(len(dst)-start))
+	return dst
+}
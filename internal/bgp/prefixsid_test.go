@@ -0,0 +1,151 @@
+package bgp
+
+import (
+	"slices"
+	"testing"
+)
+
+// psTLV builds a Prefix-SID TLV (1-octet type, 2-octet length) from the
+// concatenated parts.
+func psTLV(typ uint8, parts ...[]byte) []byte {
+	var v []byte
+	for _, p := range parts {
+		v = append(v, p...)
+	}
+	return append([]byte{typ, byte(len(v) >> 8), byte(len(v))}, v...)
+}
+
+// srv6L3Service builds an SRv6 L3 Service TLV for sid with End.DT4
+// behavior and the given SID structure.
+func srv6L3Service(sid []byte, structure []byte) []byte {
+	info := psTLV(srv6SIDInformation,
+		[]byte{0}, sid, []byte{0, 0, 0x13, 0},
+		psTLV(srv6SIDStructure, structure))
+	return psTLV(prefixSIDSRv6L3Service, []byte{0}, info)
+}
+
+func TestParseUpdate_PrefixSIDLabelIndex(t *testing.T) {
+	prefixSID := append(
+		psTLV(prefixSIDLabelIndex, []byte{0, 0, 0, 0, 0, 0, 101}),
+		psTLV(prefixSIDOriginatorSRGB, []byte{0, 0}, []byte{0, 0x3E, 0x80, 0, 0x1F, 0x40})...) // 8000 labels from 16000
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI,
+		labeledMPReach(labelField(16101, true)))...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypePrefixSID, prefixSID)...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ps := events[0].PrefixSID
+	if ps == nil || ps.LabelIndex == nil || *ps.LabelIndex != 101 {
+		t.Fatalf("expected label index 101, got %+v", ps)
+	}
+	if want := []LabelRange{{Start: 16000, Size: 8000}}; !slices.Equal(ps.SRGB, want) {
+		t.Errorf("SRGB = %v, want %v", ps.SRGB, want)
+	}
+	if _, ok := events[0].Attrs["40"]; ok {
+		t.Error("Prefix-SID attribute should not be kept in Attrs")
+	}
+}
+
+func TestParseUpdate_PrefixSIDSRv6Transposition(t *testing.T) {
+	// VPNv4 route whose SRv6 L3 service SID 2001:db8:0:1:: (40-bit block,
+	// 24-bit node) has its 16-bit function 0xe001 transposed into the
+	// label field.
+	mpReach := []byte{0, 1, SAFIMPLSVPN, 12, 0, 0, 0, 0, 0, 0, 0, 0, 192, 0, 2, 1, 0}
+	mpReach = append(mpReach, 24+64+16)
+	mpReach = append(mpReach, labelField(0xE0010, true)...)
+	mpReach = append(mpReach, 0, 0, 0xFD, 0xE8, 0, 0, 0, 100, 10, 1)
+	sid := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypePrefixSID,
+		srv6L3Service(sid, []byte{40, 24, 16, 0, 16, 64}))...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ps := events[0].PrefixSID
+	if ps == nil || len(ps.SRv6Services) != 1 {
+		t.Fatalf("expected 1 SRv6 service, got %+v", ps)
+	}
+	s := ps.SRv6Services[0]
+	if s.Layer != 3 || s.Behavior != 0x13 || s.SID != "2001:db8:0:1:e001::" {
+		t.Errorf("unexpected service %+v", s)
+	}
+	want := SRv6SIDStructure{LocatorBlockLen: 40, LocatorNodeLen: 24, FunctionLen: 16, TranspositionLen: 16, TranspositionOffset: 64}
+	if s.Structure == nil || *s.Structure != want {
+		t.Errorf("structure = %+v, want %+v", s.Structure, want)
+	}
+}
+
+func TestParseUpdate_PrefixSIDSRv6TranspositionEVPN(t *testing.T) {
+	// EVPN IP Prefix route whose SRv6 L3 service SID has its function
+	// transposed into the route's label field (RFC 9252 §5).
+	nlri := evpnNLRI(EVPNIPPrefix, testESI, []byte{0, 0, 0, 0}, []byte{24, 10, 2, 3, 0}, []byte{0, 0, 0, 0}, labelField(0xE0010, true))
+	mpReach := append([]byte{0, 25, SAFIEVPN, 4, 192, 0, 2, 1, 0}, nlri...)
+	sid := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypePrefixSID,
+		srv6L3Service(sid, []byte{40, 24, 16, 0, 16, 64}))...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].EVPN == nil {
+		t.Fatalf("expected 1 EVPN event, got %d", len(events))
+	}
+	ps := events[0].PrefixSID
+	if ps == nil || len(ps.SRv6Services) != 1 {
+		t.Fatalf("expected 1 SRv6 service, got %+v", ps)
+	}
+	if got := ps.SRv6Services[0].SID; got != "2001:db8:0:1:e001::" {
+		t.Errorf("SID = %s, want 2001:db8:0:1:e001::", got)
+	}
+}
+
+func TestPrefixSIDWithLabel_SharedAcrossRoutes(t *testing.T) {
+	sid := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+	p := parsePrefixSID(srv6L3Service(sid, []byte{40, 24, 16, 0, 16, 64}))
+
+	a := p.WithLabel([]uint32{0xE0010})
+	b := p.WithLabel([]uint32{0xE0020})
+	if a.SRv6Services[0].SID != "2001:db8:0:1:e001::" || b.SRv6Services[0].SID != "2001:db8:0:1:e002::" {
+		t.Errorf("unexpected SIDs %s, %s", a.SRv6Services[0].SID, b.SRv6Services[0].SID)
+	}
+	if p.SRv6Services[0].SID != "2001:db8:0:1::" {
+		t.Errorf("WithLabel modified the attribute: %s", p.SRv6Services[0].SID)
+	}
+}
+
+func TestParsePrefixSID_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated tlv", []byte{prefixSIDLabelIndex, 0, 7, 0, 0}},
+		{"short label index", psTLV(prefixSIDLabelIndex, []byte{0, 0, 0, 1})},
+		{"short sid information", psTLV(prefixSIDSRv6L3Service, []byte{0}, psTLV(srv6SIDInformation, []byte{0, 0x20}))},
+		{"unknown tlv", psTLV(9, []byte{1, 2, 3})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p := parsePrefixSID(tt.data); p != nil {
+				t.Errorf("expected nil, got %+v", p)
+			}
+		})
+	}
+}
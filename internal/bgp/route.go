@@ -0,0 +1,280 @@
+package bgp
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// Route is a route of an UPDATE as read by a Decoder, before any string is
+// built: the prefix and next hops are netip values and the path
+// attributes are the Decoder's, referring to the message. A Route is valid
+// while the message is not modified. EVPN, FlowSpec, BGP-LS and SR Policy
+// NLRI are decoded in full. RenderEvents renders Routes as RouteEvents.
+type Route struct {
+	AFI       int           // 4 or 6; 25 (AFIL2VPN) for EVPN, 16388 (AFIBGPLS) for BGP-LS
+	SAFI      uint8         // SAFIUnicast, SAFILabeledUnicast, SAFIMPLSVPN, ...
+	Prefix    netip.Prefix  // host bits as sent; invalid for EVPN, FlowSpec, BGP-LS and SR Policy
+	EVPN      *EVPNRoute    // EVPN NLRI (AFI 25, SAFI 70)
+	FlowSpec  *FlowSpecRule // Flow Specification NLRI (SAFI 133, 134)
+	LinkState *LSRoute      // BGP-LS NLRI (AFI 16388, SAFI 71)
+	SRPolicy  *SRPolicy     // SR Policy NLRI (SAFI 73)
+	Labels    []uint32      // MPLS label stack, bottom of stack last (SAFI 4, 128)
+	RD        string        // Route Distinguisher (SAFI 128, 134)
+	PathID    int64         // 0 if no Add-Path
+	Action    string        // "A" or "D"
+	NextHop   netip.Addr    // global next hop, or the link-local one if there is no global
+	NextHopLL netip.Addr    // IPv6 link-local next hop (RFC 2545 §3), if any
+
+	// Attrs are the path attributes of an announcement, shared by the
+	// announcements of its UPDATE; nil for a withdrawal.
+	Attrs *UpdateAttrs
+
+	// Warnings are the errors found in the UPDATE (RFC 7606), shared by
+	// its routes. An announcement whose UPDATE is handled as
+	// "treat-as-withdraw" is turned into a withdrawal.
+	Warnings []ParseWarning
+}
+
+// AppendRoutes appends the routes of the UPDATE last decoded to dst, in
+// message order: IPv4 withdrawals and announcements, then MP_REACH_NLRI
+// and MP_UNREACH_NLRI. The announcements share a copy of d.Attrs, so
+// decoding the next UPDATE leaves them intact.
+//
+// Malformed NLRI fields are handled as "session reset" (RFC 7606 §5.3):
+// the prefixes decoded before the error are kept. An UPDATE with errors
+// but no routes would be taken for an End-of-RIB marker and is an error.
+func (d *Decoder) AppendRoutes(dst []Route) ([]Route, error) {
+	withdrawn, nlri := d.Withdrawn(), d.NLRI()
+	mpReach, mpUnreach := d.MPReachPrefixes(), d.MPUnreachPrefixes()
+	reach, unreach := d.mpReachRoutes(), d.mpUnreachRoutes()
+	start := len(dst)
+	dst = slices.Grow(dst, countPrefixes(withdrawn)+countPrefixes(nlri)+countPrefixes(mpReach)+
+		countPrefixes(mpUnreach)+reach.len()+unreach.len())
+
+	var attrs *UpdateAttrs
+	if len(d.nlri) > 0 || d.Attrs.Has(AttrTypeMPReachNLRI) {
+		attrs = new(UpdateAttrs)
+		*attrs = d.Attrs
+		attrs.Unknown = slices.Clone(d.Attrs.Unknown)
+	}
+
+	// IPv4 withdrawals and announcements.
+	for withdrawn.Next() {
+		dst = append(dst, Route{
+			AFI:    4,
+			SAFI:   SAFIUnicast,
+			Prefix: withdrawn.Prefix(),
+			PathID: int64(withdrawn.PathID()),
+			Action: "D",
+		})
+	}
+	for nlri.Next() {
+		dst = append(dst, Route{
+			AFI:     4,
+			SAFI:    SAFIUnicast,
+			Prefix:  nlri.Prefix(),
+			PathID:  int64(nlri.PathID()),
+			Action:  "A",
+			NextHop: d.Attrs.NextHop,
+			Attrs:   attrs,
+		})
+	}
+
+	// MP_REACH_NLRI announcements (IPv4/IPv6 unicast, labeled unicast and
+	// VPN).
+	m := &d.Attrs.MPReach
+	for mpReach.Next() {
+		dst = append(dst, Route{
+			AFI:       afiToVersion(m.AFI),
+			SAFI:      m.SAFI,
+			Prefix:    mpReach.Prefix(),
+			Labels:    mpReach.labelStack(),
+			RD:        FormatRD(mpReach.RD()),
+			PathID:    int64(mpReach.PathID()),
+			Action:    "A",
+			NextHop:   m.NextHop,
+			NextHopLL: m.NextHopLL,
+			Attrs:     attrs,
+		})
+	}
+	if err := mpReach.Err(); err != nil {
+		d.malformed(AttrTypeMPReachNLRI, "%v", err)
+	}
+
+	// MP_REACH_NLRI EVPN routes, Flow Specification rules, BGP-LS NLRI
+	// and SR Policy candidate paths, completed from the attributes.
+	var commExt []string
+	if len(reach.evpn) > 0 || len(reach.flowSpec) > 0 {
+		commExt = d.Attrs.extCommunities()
+	}
+	for _, r := range reach.evpn {
+		dst = append(dst, Route{AFI: int(AFIL2VPN), SAFI: SAFIEVPN, EVPN: r.withEncapsulation(commExt),
+			PathID: r.pathID, Action: "A", NextHop: m.NextHop, Attrs: attrs})
+	}
+	for _, r := range reach.flowSpec {
+		dst = append(dst, Route{AFI: afiToVersion(m.AFI), SAFI: m.SAFI, FlowSpec: r.withActions(commExt),
+			RD: r.RD, PathID: r.pathID, Action: "A", NextHop: m.NextHop, Attrs: attrs})
+	}
+	var lsAttr *LSAttribute
+	if len(reach.ls) > 0 && d.Attrs.Has(AttrTypeBGPLS) {
+		lsAttr = parseLSAttribute(d.Attrs.LinkState)
+	}
+	for _, r := range reach.ls {
+		dst = append(dst, Route{AFI: int(AFIBGPLS), SAFI: SAFIBGPLS, LinkState: r.withAttribute(lsAttr),
+			PathID: r.pathID, Action: "A", NextHop: m.NextHop, Attrs: attrs})
+	}
+	for _, p := range reach.srPolicy {
+		dst = append(dst, Route{AFI: afiToVersion(m.AFI), SAFI: SAFISRPolicy, SRPolicy: p.withCandidatePath(d.Attrs.TunnelEncap),
+			PathID: p.pathID, Action: "A", NextHop: m.NextHop, Attrs: attrs})
+	}
+
+	// MP_UNREACH_NLRI withdrawals. The withdrawn label field carries no
+	// information and is dropped.
+	u := &d.Attrs.MPUnreach
+	for mpUnreach.Next() {
+		dst = append(dst, Route{
+			AFI:    afiToVersion(u.AFI),
+			SAFI:   u.SAFI,
+			Prefix: mpUnreach.Prefix(),
+			RD:     FormatRD(mpUnreach.RD()),
+			PathID: int64(mpUnreach.PathID()),
+			Action: "D",
+		})
+	}
+	if err := mpUnreach.Err(); err != nil {
+		d.malformed(AttrTypeMPUnreachNLRI, "%v", err)
+	}
+	for _, r := range unreach.flowSpec {
+		dst = append(dst, Route{AFI: afiToVersion(u.AFI), SAFI: u.SAFI, FlowSpec: r.withActions(nil),
+			RD: r.RD, PathID: r.pathID, Action: "D"})
+	}
+	for _, p := range unreach.srPolicy {
+		dst = append(dst, Route{AFI: afiToVersion(u.AFI), SAFI: SAFISRPolicy, SRPolicy: p.withCandidatePath(nil),
+			PathID: p.pathID, Action: "D"})
+	}
+	for _, r := range unreach.ls {
+		dst = append(dst, Route{AFI: int(AFIBGPLS), SAFI: SAFIBGPLS, LinkState: r.withAttribute(nil),
+			PathID: r.pathID, Action: "D"})
+	}
+	for _, r := range unreach.evpn {
+		dst = append(dst, Route{AFI: int(AFIL2VPN), SAFI: SAFIEVPN, EVPN: r.withEncapsulation(nil),
+			PathID: r.pathID, Action: "D"})
+	}
+
+	var warnings []ParseWarning
+	if err := withdrawn.Err(); err != nil {
+		warnings = append(warnings, ParseWarning{Action: SessionReset, Reason: "withdrawn routes: " + err.Error()})
+	}
+	warnings = append(warnings, d.Warnings...)
+	if err := nlri.Err(); err != nil {
+		warnings = append(warnings, ParseWarning{Action: SessionReset, Reason: "nlri: " + err.Error()})
+	}
+	if len(warnings) == 0 {
+		return dst, nil
+	}
+	routes := dst[start:]
+	if len(routes) == 0 {
+		return dst, fmt.Errorf("bgp: malformed update: %s", warnings[0])
+	}
+	withdraw := hasAction(warnings, TreatAsWithdraw)
+	for i := range routes {
+		if withdraw && routes[i].Action == "A" {
+			routes[i].withdraw()
+		}
+		routes[i].Warnings = warnings
+	}
+	return dst, nil
+}
+
+// countPrefixes returns the number of prefixes r reads.
+func countPrefixes(r NLRIReader) int {
+	n := 0
+	for r.Next() {
+		n++
+	}
+	return n
+}
+
+// RenderEvents renders routes as RouteEvents. The path attributes the
+// routes of an UPDATE share are rendered once.
+func RenderEvents(routes []*Route) []*RouteEvent {
+	if len(routes) == 0 {
+		return nil
+	}
+	events := make([]RouteEvent, len(routes))
+	out := make([]*RouteEvent, len(routes))
+	var er eventRenderer
+	for i, r := range routes {
+		er.render(&events[i], r)
+		out[i] = &events[i]
+	}
+	return out
+}
+
+// eventRenderer renders Routes as RouteEvents, keeping the rendering of
+// the last path attributes and next hops for the routes that share them.
+type eventRenderer struct {
+	attrs *UpdateAttrs
+	text  *PathAttributes
+
+	nextHops     [2]netip.Addr
+	nextHopsText [2]string
+}
+
+// nextHop renders the next hop addr, of kind 0 (global) or 1 (link-local).
+func (er *eventRenderer) nextHop(addr netip.Addr, kind int) string {
+	if addr != er.nextHops[kind] {
+		er.nextHops[kind], er.nextHopsText[kind] = addr, addrString(addr)
+	}
+	return er.nextHopsText[kind]
+}
+
+func (er *eventRenderer) render(ev *RouteEvent, r *Route) {
+	*ev = RouteEvent{
+		AFI:           r.AFI,
+		SAFI:          r.SAFI,
+		EVPN:          r.EVPN,
+		FlowSpec:      r.FlowSpec,
+		LinkState:     r.LinkState,
+		SRPolicy:      r.SRPolicy,
+		Labels:        r.Labels,
+		RD:            r.RD,
+		PathID:        r.PathID,
+		Action:        r.Action,
+		Nexthop:       er.nextHop(r.NextHop, 0),
+		NexthopLL:     er.nextHop(r.NextHopLL, 1),
+		ParseWarnings: r.Warnings,
+	}
+	if r.Prefix.IsValid() {
+		ev.Prefix = r.Prefix.String()
+	}
+	if r.Attrs == nil {
+		return
+	}
+	if r.Attrs != er.attrs {
+		er.attrs, er.text = r.Attrs, r.Attrs.Render()
+	}
+	a := er.text
+	ev.ASPath = a.ASPath
+	ev.Origin = a.Origin
+	ev.LocalPref = a.LocalPref
+	ev.MED = a.MED
+	ev.CommStd = a.CommStd
+	ev.CommExt = a.CommExt
+	ev.CommLarge = a.CommLarge
+	ev.Attrs = a.Attrs
+	ev.OriginatorID = a.OriginatorID
+	ev.ClusterList = a.ClusterList
+	ev.AtomicAggregate = a.AtomicAggregate
+	ev.AggregatorASN = a.AggregatorASN
+	ev.AggregatorAddress = a.AggregatorAddress
+	ev.OTC = a.OTC
+	ev.ASPathSegments = a.ASPathSegments
+	switch {
+	case r.EVPN != nil:
+		ev.PrefixSID = a.PrefixSID.WithLabel(r.EVPN.Labels)
+	case r.Prefix.IsValid():
+		ev.PrefixSID = a.PrefixSID.WithLabel(r.Labels)
+	}
+}
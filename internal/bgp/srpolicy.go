@@ -0,0 +1,305 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Tunnel Encapsulation attribute (RFC 9012) tunnel type and sub-TLVs
+// describing an SR Policy candidate path (RFC 9830 §2.4).
+const (
+	tunnelTypeSRPolicy = 15
+
+	srPreference        = 12
+	srBindingSID        = 13
+	srPriority          = 15
+	srSRv6BindingSID    = 20
+	srSegmentList       = 128
+	srCandidatePathName = 129
+	srPolicyName        = 130
+
+	// Segment List sub-TLVs
+	srSegmentTypeA = 1 // SR-MPLS label
+	srWeight       = 9
+	srSegmentTypeB = 13 // SRv6 SID
+)
+
+// SRPolicy is a decoded SR Policy NLRI (SAFI 73) and, for announcements,
+// the candidate path carried in its Tunnel Encapsulation attribute.
+type SRPolicy struct {
+	Distinguisher uint32
+	Color         uint32
+	Endpoint      string
+
+	Preference        *uint32
+	Priority          *uint8
+	BindingSID        string // MPLS label or SRv6 SID
+	CandidatePathName string
+	PolicyName        string
+	SegmentLists      []SRSegmentList
+
+	pathID int64
+}
+
+// SRSegmentList is one Segment List of a candidate path. Segments are MPLS
+// labels ("16001") or SRv6 SIDs ("2001:db8::1"); segment types without a
+// decoder render as "type<N>".
+type SRSegmentList struct {
+	Weight   *uint32  `json:"weight,omitempty"`
+	Segments []string `json:"segments"`
+}
+
+// parseSRPolicyNLRI decodes a sequence of SR Policy NLRI: a length in bits
+// (96 for IPv4, 192 for IPv6), then a 4-octet Distinguisher, a 4-octet
+// Policy Color and the Endpoint (RFC 9830 §2.1).
+func parseSRPolicyNLRI(data []byte, hasAddPath bool) ([]SRPolicy, error) {
+	var policies []SRPolicy
+	offset := 0
+
+	for offset < len(data) {
+		var pathID int64
+		if hasAddPath {
+			if offset+4 > len(data) {
+				return policies, fmt.Errorf("bgp: sr policy nlri truncated at offset %d", offset)
+			}
+			pathID = int64(binary.BigEndian.Uint32(data[offset : offset+4]))
+			offset += 4
+		}
+
+		if offset >= len(data) {
+			return policies, fmt.Errorf("bgp: sr policy nlri truncated at offset %d", offset)
+		}
+		bits := int(data[offset])
+		offset++
+		if bits != 96 && bits != 192 {
+			return policies, fmt.Errorf("bgp: invalid sr policy nlri length %d", bits)
+		}
+		length := bits / 8
+		if offset+length > len(data) {
+			return policies, fmt.Errorf("bgp: sr policy nlri truncated at offset %d", offset)
+		}
+		b := data[offset : offset+length]
+		offset += length
+
+		policies = append(policies, SRPolicy{
+			Distinguisher: binary.BigEndian.Uint32(b[0:4]),
+			Color:         binary.BigEndian.Uint32(b[4:8]),
+			Endpoint:      net.IP(b[8:]).String(),
+			pathID:        pathID,
+		})
+	}
+
+	return policies, nil
+}
+
+// withCandidatePath returns a copy of p carrying the candidate path of the
+// first SR Policy tunnel in tunnelEncap, the Tunnel Encapsulation
+// attribute of the UPDATE.
+func (p SRPolicy) withCandidatePath(tunnelEncap []byte) *SRPolicy {
+	for b := tunnelEncap; len(b) >= 4; {
+		typ := binary.BigEndian.Uint16(b[0:2])
+		length := int(binary.BigEndian.Uint16(b[2:4]))
+		if 4+length > len(b) {
+			break
+		}
+		if typ == tunnelTypeSRPolicy {
+			p.decodeCandidatePath(b[4 : 4+length])
+			break
+		}
+		b = b[4+length:]
+	}
+	return &p
+}
+
+func (p *SRPolicy) decodeCandidatePath(b []byte) {
+	forEachTunnelSubTLV(b, func(typ uint8, v []byte) {
+		switch typ {
+		case srPreference:
+			// Flags (1), Reserved (1), Preference (4)
+			if len(v) == 6 {
+				pref := binary.BigEndian.Uint32(v[2:6])
+				p.Preference = &pref
+			}
+		case srPriority:
+			if len(v) == 2 {
+				prio := v[0]
+				p.Priority = &prio
+			}
+		case srBindingSID, srSRv6BindingSID:
+			// Flags (1), Reserved (1), BSID (0, 4 or 16 and more)
+			if len(v) >= 2 {
+				p.BindingSID = srSegment(v[2:])
+			}
+		case srCandidatePathName:
+			if len(v) >= 1 {
+				p.CandidatePathName = string(v[1:])
+			}
+		case srPolicyName:
+			if len(v) >= 1 {
+				p.PolicyName = string(v[1:])
+			}
+		case srSegmentList:
+			// Reserved (1), then sub-TLVs with 1-octet lengths
+			if len(v) < 1 {
+				return
+			}
+			var sl SRSegmentList
+			for s := v[1:]; len(s) >= 2; {
+				subType, subLen := s[0], int(s[1])
+				if 2+subLen > len(s) {
+					break
+				}
+				sv := s[2 : 2+subLen]
+				s = s[2+subLen:]
+				switch {
+				case subType == srWeight && len(sv) == 6:
+					w := binary.BigEndian.Uint32(sv[2:6])
+					sl.Weight = &w
+				case (subType == srSegmentTypeA || subType == srSegmentTypeB) && len(sv) >= 2:
+					sl.Segments = append(sl.Segments, srSegment(sv[2:]))
+				case subType != srWeight:
+					sl.Segments = append(sl.Segments, fmt.Sprintf("type%d", subType))
+				}
+			}
+			p.SegmentLists = append(p.SegmentLists, sl)
+		}
+	})
+}
+
+// srSegment renders a label field (4 octets: label, TC, S, TTL) as the
+// label, and an SRv6 SID (16 octets, optionally followed by its endpoint
+// behavior and structure) as an address.
+func srSegment(v []byte) string {
+	switch {
+	case len(v) == 4:
+		return strconv.FormatUint(uint64(binary.BigEndian.Uint32(v)>>12), 10)
+	case len(v) >= 16:
+		return net.IP(v[:16]).String()
+	}
+	return ""
+}
+
+// forEachTunnelSubTLV calls fn for each sub-TLV of a Tunnel Encapsulation
+// TLV. Sub-TLV types 0-127 have a 1-octet length, types 128-255 a 2-octet
+// length (RFC 9012 §2).
+func forEachTunnelSubTLV(b []byte, fn func(typ uint8, v []byte)) {
+	for len(b) >= 2 {
+		typ := b[0]
+		hdr, length := 2, int(b[1])
+		if typ >= 128 {
+			if len(b) < 3 {
+				return
+			}
+			hdr, length = 3, int(binary.BigEndian.Uint16(b[1:3]))
+		}
+		if hdr+length > len(b) {
+			return
+		}
+		fn(typ, b[hdr:hdr+length])
+		b = b[hdr+length:]
+	}
+}
+
+// appendSRPolicyNLRI appends an SR Policy NLRI of the given AFI, the
+// inverse of parseSRPolicyNLRI.
+func appendSRPolicyNLRI(dst []byte, p *SRPolicy, afi uint16) ([]byte, error) {
+	endpoint, err := netip.ParseAddr(p.Endpoint)
+	if err != nil || endpoint.Is4() != (afi == AFIIPv4) {
+		return dst, fmt.Errorf("bgp: invalid sr policy endpoint %q", p.Endpoint)
+	}
+	dst = append(dst, byte(64+endpoint.BitLen()))
+	dst = binary.BigEndian.AppendUint32(dst, p.Distinguisher)
+	dst = binary.BigEndian.AppendUint32(dst, p.Color)
+	return append(dst, endpoint.AsSlice()...), nil
+}
+
+// hasCandidatePath reports whether p carries any candidate path field.
+func (p *SRPolicy) hasCandidatePath() bool {
+	return p.Preference != nil || p.Priority != nil || p.BindingSID != "" ||
+		p.CandidatePathName != "" || p.PolicyName != "" || p.SegmentLists != nil
+}
+
+// appendSRPolicyTunnel appends the value of a Tunnel Encapsulation
+// attribute holding one SR Policy tunnel with the candidate path of p, the
+// inverse of withCandidatePath. Flags are zero.
+func appendSRPolicyTunnel(dst []byte, p *SRPolicy) ([]byte, error) {
+	dst = binary.BigEndian.AppendUint16(dst, tunnelTypeSRPolicy)
+	lenAt := len(dst)
+	dst = append(dst, 0, 0)
+
+	if p.Preference != nil {
+		dst = appendTunnelSubTLV(dst, srPreference, binary.BigEndian.AppendUint32([]byte{0, 0}, *p.Preference))
+	}
+	if p.BindingSID != "" {
+		typ := uint8(srBindingSID)
+		if strings.Contains(p.BindingSID, ":") {
+			typ = srSRv6BindingSID
+		}
+		v, err := appendSRSegment([]byte{0, 0}, p.BindingSID)
+		if err != nil {
+			return dst, err
+		}
+		dst = appendTunnelSubTLV(dst, typ, v)
+	}
+	if p.Priority != nil {
+		dst = appendTunnelSubTLV(dst, srPriority, []byte{*p.Priority, 0})
+	}
+	for _, sl := range p.SegmentLists {
+		v := []byte{0} // Reserved
+		if sl.Weight != nil {
+			v = append(v, srWeight, 6, 0, 0)
+			v = binary.BigEndian.AppendUint32(v, *sl.Weight)
+		}
+		for _, seg := range sl.Segments {
+			typ := uint8(srSegmentTypeA)
+			if strings.Contains(seg, ":") {
+				typ = srSegmentTypeB
+			}
+			sv, err := appendSRSegment([]byte{0, 0}, seg)
+			if err != nil {
+				return dst, err
+			}
+			v = append(v, typ, byte(len(sv)))
+			v = append(v, sv...)
+		}
+		dst = appendTunnelSubTLV(dst, srSegmentList, v)
+	}
+	if p.CandidatePathName != "" {
+		dst = appendTunnelSubTLV(dst, srCandidatePathName, append([]byte{0}, p.CandidatePathName...))
+	}
+	if p.PolicyName != "" {
+		dst = appendTunnelSubTLV(dst, srPolicyName, append([]byte{0}, p.PolicyName...))
+	}
+
+	binary.BigEndian.PutUint16(dst[lenAt:], uint16(len(dst)-lenAt-2))
+	return dst, nil
+}
+
+// appendSRSegment appends a segment rendered by srSegment: an MPLS label
+// as a label field, or an SRv6 SID.
+func appendSRSegment(dst []byte, s string) ([]byte, error) {
+	if label, err := strconv.ParseUint(s, 10, 20); err == nil {
+		return binary.BigEndian.AppendUint32(dst, uint32(label)<<12), nil
+	}
+	sid, err := netip.ParseAddr(s)
+	if err != nil || !sid.Is6() {
+		return dst, fmt.Errorf("bgp: invalid sr policy segment %q", s)
+	}
+	return append(dst, sid.AsSlice()...), nil
+}
+
+// appendTunnelSubTLV appends a Tunnel Encapsulation sub-TLV as
+// forEachTunnelSubTLV reads it.
+func appendTunnelSubTLV(dst []byte, typ uint8, v []byte) []byte {
+	if typ >= 128 {
+		dst = append(dst, typ)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(len(v)))
+	} else {
+		dst = append(dst, typ, byte(len(v)))
+	}
+	return append(dst, v...)
+}
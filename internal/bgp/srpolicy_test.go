@@ -0,0 +1,136 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// srSubTLV builds a Tunnel Encapsulation sub-TLV, with a 2-octet length
+// for types 128 and above.
+func srSubTLV(typ uint8, parts ...[]byte) []byte {
+	var v []byte
+	for _, p := range parts {
+		v = append(v, p...)
+	}
+	if typ >= 128 {
+		return append([]byte{typ, byte(len(v) >> 8), byte(len(v))}, v...)
+	}
+	return append([]byte{typ, byte(len(v))}, v...)
+}
+
+// srLabel builds a 4-octet label field (label, TC, S, TTL).
+func srLabel(label uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, label<<12)
+}
+
+// srPolicyNLRI builds an IPv4 SR Policy NLRI.
+func srPolicyNLRI(distinguisher, color uint32, endpoint ...byte) []byte {
+	b := []byte{96}
+	b = binary.BigEndian.AppendUint32(b, distinguisher)
+	b = binary.BigEndian.AppendUint32(b, color)
+	return append(b, endpoint...)
+}
+
+func TestParseUpdate_SRPolicy(t *testing.T) {
+	sid := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0}
+	segmentList := srSubTLV(srSegmentList, []byte{0},
+		srSubTLV(srWeight, []byte{0, 0, 0, 0, 0, 2}),
+		srSubTLV(srSegmentTypeA, []byte{0, 0}, srLabel(16001)),
+		srSubTLV(srSegmentTypeB, []byte{0, 0}, sid),
+	)
+	var tunnel []byte
+	for _, sub := range [][]byte{
+		srSubTLV(srPreference, []byte{0, 0, 0, 0, 0, 200}),
+		srSubTLV(srBindingSID, []byte{0, 0}, srLabel(24000)),
+		segmentList,
+		srSubTLV(srPolicyName, []byte{0}, []byte("blue")),
+	} {
+		tunnel = append(tunnel, sub...)
+	}
+	tunnelEncap := append([]byte{0, tunnelTypeSRPolicy, byte(len(tunnel) >> 8), byte(len(tunnel))}, tunnel...)
+
+	mpReach := []byte{0, 1, SAFISRPolicy, 4, 192, 0, 2, 1, 0}
+	mpReach = append(mpReach, srPolicyNLRI(1, 100, 192, 0, 2, 9)...)
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0xC0, AttrTypeTunnelEncap, tunnelEncap)...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].SRPolicy == nil {
+		t.Fatalf("expected 1 SR Policy event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.AFI != 4 || ev.SAFI != SAFISRPolicy || ev.Action != "A" || ev.Prefix != "" {
+		t.Errorf("unexpected %d/%d %s prefix %q", ev.AFI, ev.SAFI, ev.Action, ev.Prefix)
+	}
+	p := ev.SRPolicy
+	if p.Distinguisher != 1 || p.Color != 100 || p.Endpoint != "192.0.2.9" {
+		t.Errorf("unexpected policy %d/%d/%s", p.Distinguisher, p.Color, p.Endpoint)
+	}
+	if p.Preference == nil || *p.Preference != 200 {
+		t.Errorf("unexpected preference %v", p.Preference)
+	}
+	if p.BindingSID != "24000" || p.PolicyName != "blue" {
+		t.Errorf("unexpected binding SID %q name %q", p.BindingSID, p.PolicyName)
+	}
+	if len(p.SegmentLists) != 1 {
+		t.Fatalf("expected 1 segment list, got %d", len(p.SegmentLists))
+	}
+	sl := p.SegmentLists[0]
+	if sl.Weight == nil || *sl.Weight != 2 {
+		t.Errorf("unexpected weight %v", sl.Weight)
+	}
+	if want := []string{"16001", "2001:db8:0:2::"}; !slices.Equal(sl.Segments, want) {
+		t.Errorf("segments = %v, want %v", sl.Segments, want)
+	}
+	if _, ok := ev.Attrs["23"]; !ok {
+		t.Error("expected Tunnel Encapsulation attribute in Attrs")
+	}
+}
+
+func TestParseUpdate_SRPolicyWithdrawal(t *testing.T) {
+	nlri := []byte{192}
+	nlri = binary.BigEndian.AppendUint32(nlri, 7)
+	nlri = binary.BigEndian.AppendUint32(nlri, 200)
+	nlri = append(nlri, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1)
+	mpUnreach := append([]byte{0, 2, SAFISRPolicy}, nlri...)
+	update := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, mpUnreach), nil)
+
+	events, err := ParseUpdate(update, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].SRPolicy == nil {
+		t.Fatalf("expected 1 SR Policy event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.AFI != 6 || ev.Action != "D" {
+		t.Errorf("unexpected AFI %d action %s", ev.AFI, ev.Action)
+	}
+	if p := ev.SRPolicy; p.Distinguisher != 7 || p.Color != 200 || p.Endpoint != "2001:db8::1" || p.SegmentLists != nil {
+		t.Errorf("unexpected policy %+v", p)
+	}
+}
+
+func TestParseSRPolicyNLRI_Malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		addPath bool
+	}{
+		{"bad length", []byte{64, 0, 0, 0, 1, 0, 0, 0, 1}, false},
+		{"truncated", srPolicyNLRI(1, 100, 192, 0), false},
+		{"truncated path id", []byte{0, 0}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSRPolicyNLRI(tt.data, tt.addPath); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -2,27 +2,48 @@ package bgp
 
 // BGP path attribute type codes.
 const (
-	AttrTypeOrigin          uint8 = 1
-	AttrTypeASPath          uint8 = 2
-	AttrTypeNextHop         uint8 = 3
-	AttrTypeMED             uint8 = 4
-	AttrTypeLocalPref       uint8 = 5
-	AttrTypeCommunity       uint8 = 8
-	AttrTypeMPReachNLRI     uint8 = 14
-	AttrTypeMPUnreachNLRI   uint8 = 15
-	AttrTypeExtCommunity    uint8 = 16
-	AttrTypeLargeCommunity  uint8 = 32
+	AttrTypeOrigin           uint8 = 1
+	AttrTypeASPath           uint8 = 2
+	AttrTypeNextHop          uint8 = 3
+	AttrTypeMED              uint8 = 4
+	AttrTypeLocalPref        uint8 = 5
+	AttrTypeAtomicAggregate  uint8 = 6
+	AttrTypeAggregator       uint8 = 7
+	AttrTypeCommunity        uint8 = 8
+	AttrTypeOriginatorID     uint8 = 9
+	AttrTypeClusterList      uint8 = 10
+	AttrTypeMPReachNLRI      uint8 = 14
+	AttrTypeMPUnreachNLRI    uint8 = 15
+	AttrTypeExtCommunity     uint8 = 16
+	AttrTypeAS4Path          uint8 = 17
+	AttrTypeAS4Aggregator    uint8 = 18
+	AttrTypeTunnelEncap      uint8 = 23
+	AttrTypeIPv6ExtCommunity uint8 = 25
+	AttrTypeBGPLS            uint8 = 29
+	AttrTypeLargeCommunity   uint8 = 32
+	AttrTypeOTC              uint8 = 35
+	AttrTypePrefixSID        uint8 = 40
 )
 
 // AFI codes.
 const (
-	AFIIPv4 uint16 = 1
-	AFIIPv6 uint16 = 2
+	AFIIPv4  uint16 = 1
+	AFIIPv6  uint16 = 2
+	AFIL2VPN uint16 = 25
+	AFIBGPLS uint16 = 16388
 )
 
 // SAFI codes.
 const (
-	SAFIUnicast uint8 = 1
+	SAFIUnicast        uint8 = 1
+	SAFIMulticast      uint8 = 2
+	SAFILabeledUnicast uint8 = 4
+	SAFIEVPN           uint8 = 70
+	SAFIBGPLS          uint8 = 71
+	SAFISRPolicy       uint8 = 73
+	SAFIMPLSVPN        uint8 = 128
+	SAFIFlowSpec       uint8 = 133
+	SAFIFlowSpecVPN    uint8 = 134
 )
 
 // AS_PATH segment types.
@@ -31,6 +52,27 @@ const (
 	ASPathSegmentSequence uint8 = 2
 )
 
+// AS_PATH confederation segment types (RFC 5065).
+const (
+	ASPathSegmentConfedSequence uint8 = 3
+	ASPathSegmentConfedSet      uint8 = 4
+)
+
+// ASTrans is the 2-octet placeholder for a 4-octet ASN (RFC 6793 §9).
+const ASTrans uint32 = 23456
+
+// ASNWidth selects the size of the AS numbers in AS_PATH and AGGREGATOR,
+// which depends on whether the session negotiated 4-octet AS (RFC 6793).
+type ASNWidth uint8
+
+const (
+	// ASNWidthAuto decodes 4-octet ASNs unless the AS_PATH only parses
+	// with 2-octet ASNs, or parses both ways and AS4_PATH is present.
+	ASNWidthAuto ASNWidth = iota
+	ASNWidth4
+	ASNWidth2
+)
+
 // Origin values.
 var OriginValues = map[uint8]string{
 	0: "IGP",
@@ -40,7 +82,9 @@ var OriginValues = map[uint8]string{
 
 // BGP message types.
 const (
-	BGPMsgTypeUpdate uint8 = 2
+	BGPMsgTypeOpen         uint8 = 1
+	BGPMsgTypeUpdate       uint8 = 2
+	BGPMsgTypeNotification uint8 = 3
 )
 
 // BGP UPDATE header size: marker(16) + length(2) + type(1) = 19
@@ -48,11 +92,19 @@ const BGPHeaderSize = 19
 
 // RouteEvent represents a single route event extracted from a BGP UPDATE.
 type RouteEvent struct {
-	AFI       int    // 4 or 6
-	Prefix    string // CIDR notation
-	PathID    int64  // 0 if no Add-Path
-	Action    string // "A" or "D"
-	Nexthop   string
+	AFI       int           // 4 or 6; 25 (AFIL2VPN) for EVPN, 16388 (AFIBGPLS) for BGP-LS
+	SAFI      uint8         // SAFIUnicast or SAFILabeledUnicast
+	Prefix    string        // CIDR notation; empty for EVPN, FlowSpec, BGP-LS and SR Policy
+	EVPN      *EVPNRoute    // EVPN NLRI (AFI 25, SAFI 70)
+	FlowSpec  *FlowSpecRule // Flow Specification NLRI (SAFI 133, 134)
+	LinkState *LSRoute      // BGP-LS NLRI (AFI 16388, SAFI 71)
+	SRPolicy  *SRPolicy     // SR Policy NLRI (SAFI 73)
+	Labels    []uint32      // MPLS label stack, bottom of stack last (SAFI 4, 128)
+	RD        string        // Route Distinguisher (SAFI 128, 134)
+	PathID    int64         // 0 if no Add-Path
+	Action    string        // "A" or "D"
+	Nexthop   string        // global next hop, or the link-local one if there is no global
+	NexthopLL string        // IPv6 link-local next hop (RFC 2545 §3), if any
 	ASPath    string
 	Origin    string
 	LocalPref *uint32
@@ -60,5 +112,25 @@ type RouteEvent struct {
 	CommStd   []string
 	CommExt   []string
 	CommLarge []string
-	Attrs     map[string]string // Unknown attributes as hex strings
+
+	// Route reflection (RFC 4456) and aggregation (RFC 4271 §5.1.6-7).
+	OriginatorID      string
+	ClusterList       []string // Cluster IDs in dotted-quad, nearest reflector first
+	AtomicAggregate   bool
+	AggregatorASN     *uint32 // From AS4_AGGREGATOR when AGGREGATOR carries AS_TRANS
+	AggregatorAddress string
+
+	OTC *uint32 // Only-To-Customer ASN (RFC 9234)
+
+	// ASPathSegments holds the sequences and sets that ASPath renders.
+	ASPathSegments ASPath
+
+	PrefixSID *PrefixSID // BGP Prefix-SID (RFC 8669, RFC 9252)
+
+	Attrs map[string]string // Unknown attributes as hex strings
+
+	// ParseWarnings are the errors found in the UPDATE carrying the
+	// route (RFC 7606). An announcement whose UPDATE is handled as
+	// "treat-as-withdraw" is turned into a withdrawal.
+	ParseWarnings []ParseWarning
 }
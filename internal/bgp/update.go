@@ -3,176 +3,150 @@ package bgp
 import (
 	"encoding/binary"
 	"fmt"
-	"net"
 )
 
-// ParseUpdate parses a BGP UPDATE message (after the 19-byte BGP header).
-// Returns a list of route events, one per prefix found in the UPDATE.
-func ParseUpdate(data []byte, hasAddPath bool) ([]*RouteEvent, error) {
-	// Skip the 16-byte marker + 2-byte length + 1-byte type = 19 byte header.
-	if len(data) < BGPHeaderSize {
-		return nil, fmt.Errorf("bgp: update too short (%d bytes)", len(data))
-	}
+// AddPathFunc reports whether NLRI of the given AFI/SAFI carry an Add-Path
+// Path Identifier (RFC 7911).
+type AddPathFunc func(afi uint16, safi uint8) bool
 
-	msgType := data[18]
-	if msgType != BGPMsgTypeUpdate {
-		return nil, nil // Not an UPDATE message; skip.
-	}
-
-	payload := data[BGPHeaderSize:]
-	return parseUpdatePayload(payload, hasAddPath)
+func uniformAddPath(hasAddPath bool) AddPathFunc {
+	return func(uint16, uint8) bool { return hasAddPath }
 }
 
-func parseUpdatePayload(data []byte, hasAddPath bool) ([]*RouteEvent, error) {
-	if len(data) < 4 {
-		return nil, fmt.Errorf("bgp: update payload too short (%d bytes)", len(data))
-	}
-
-	offset := 0
+// MultiLabelFunc reports whether labeled NLRI of the given AFI/SAFI may
+// carry more than one label (RFC 8277 Multiple Labels capability).
+// Otherwise each announced prefix carries exactly one label.
+type MultiLabelFunc func(afi uint16, safi uint8) bool
 
-	// Withdrawn routes length.
-	withdrawnLen := int(binary.BigEndian.Uint16(data[offset : offset+2]))
-	offset += 2
+// ExtendedNextHopFunc reports whether IPv4 NLRI of the given AFI/SAFI may
+// carry an IPv6 next hop (RFC 8950 Extended Next Hop capability).
+type ExtendedNextHopFunc func(afi uint16, safi uint8) bool
 
-	if offset+withdrawnLen > len(data) {
-		return nil, fmt.Errorf("bgp: withdrawn length %d exceeds data", withdrawnLen)
-	}
-
-	// Parse IPv4 withdrawn routes → action 'D'.
-	withdrawnPrefixes, _ := parsePrefixes(data[offset:offset+withdrawnLen], 4, hasAddPath)
-	offset += withdrawnLen
+// ParseUpdate parses a BGP UPDATE message (after the 19-byte BGP header).
+// Returns a list of route events, one per prefix found in the UPDATE.
+// The AS number width is detected from the AS_PATH.
+func ParseUpdate(data []byte, hasAddPath bool) ([]*RouteEvent, error) {
+	return parseUpdate(data, &Decoder{AddPath: uniformAddPath(hasAddPath)})
+}
 
-	// Total path attribute length.
-	if offset+2 > len(data) {
-		return nil, fmt.Errorf("bgp: no room for path attr length")
-	}
-	totalPathAttrLen := int(binary.BigEndian.Uint16(data[offset : offset+2]))
-	offset += 2
+// ParseUpdateSession parses a BGP UPDATE using the Add-Path, Multiple
+// Labels, Extended Next Hop and 4-octet AS state negotiated for the
+// BMP-monitored session.
+// adjRIBOut selects the router→peer direction (RFC 8671 Adj-RIB-Out);
+// otherwise the UPDATE is one the router received from the peer.
+func ParseUpdateSession(data []byte, s *Session, adjRIBOut bool) ([]*RouteEvent, error) {
+	return parseUpdate(data, NewSessionDecoder(s, adjRIBOut))
+}
 
-	if offset+totalPathAttrLen > len(data) {
-		return nil, fmt.Errorf("bgp: path attr length %d exceeds data", totalPathAttrLen)
-	}
+// DecodeUpdateSession is ParseUpdateSession returning the routes a Decoder
+// reads, without rendering them as route events.
+func DecodeUpdateSession(data []byte, s *Session, adjRIBOut bool) ([]Route, error) {
+	return decodeRoutes(data, NewSessionDecoder(s, adjRIBOut))
+}
 
-	// Parse path attributes.
-	attrs, err := ParsePathAttributes(data[offset:offset+totalPathAttrLen], hasAddPath)
+func parseUpdate(data []byte, d *Decoder) ([]*RouteEvent, error) {
+	routes, err := decodeRoutes(data, d)
 	if err != nil {
-		return nil, fmt.Errorf("bgp: parse path attrs: %w", err)
+		return nil, err
 	}
-	offset += totalPathAttrLen
-
-	// Parse IPv4 NLRI → action 'A'.
-	nlriPrefixes, _ := parsePrefixes(data[offset:], 4, hasAddPath)
-
-	var events []*RouteEvent
+	return renderEvents(routes), nil
+}
 
-	// Build withdrawal events.
-	for _, p := range withdrawnPrefixes {
-		events = append(events, &RouteEvent{
-			AFI:    4,
-			Prefix: p.Prefix,
-			PathID: p.PathID,
-			Action: "D",
-		})
+// decodeRoutes decodes a BGP UPDATE message, including its header, with d
+// and returns its routes. Other message types have none.
+func decodeRoutes(data []byte, d *Decoder) ([]Route, error) {
+	// Skip the 16-byte marker + 2-byte length + 1-byte type = 19 byte header.
+	if len(data) < BGPHeaderSize {
+		return nil, fmt.Errorf("bgp: update too short (%d bytes)", len(data))
 	}
 
-	// Build announcement events with attributes.
-	for _, p := range nlriPrefixes {
-		events = append(events, &RouteEvent{
-			AFI:       4,
-			Prefix:    p.Prefix,
-			PathID:    p.PathID,
-			Action:    "A",
-			Nexthop:   attrs.Nexthop,
-			ASPath:    attrs.ASPath,
-			Origin:    attrs.Origin,
-			LocalPref: attrs.LocalPref,
-			MED:       attrs.MED,
-			CommStd:   attrs.CommStd,
-			CommExt:   attrs.CommExt,
-			CommLarge: attrs.CommLarge,
-			Attrs:     attrs.Attrs,
-		})
+	msgType := data[18]
+	if msgType != BGPMsgTypeUpdate {
+		return nil, nil // Not an UPDATE message; skip.
 	}
 
-	// MP_REACH_NLRI announcements (IPv4/IPv6).
-	if afi := afiToVersion(attrs.MPReachAFI); afi != 0 {
-		for _, p := range attrs.MPReachNLRI {
-			events = append(events, &RouteEvent{
-				AFI:       afi,
-				Prefix:    p.Prefix,
-				PathID:    p.PathID,
-				Action:    "A",
-				Nexthop:   attrs.MPReachNexthop,
-				ASPath:    attrs.ASPath,
-				Origin:    attrs.Origin,
-				LocalPref: attrs.LocalPref,
-				MED:       attrs.MED,
-				CommStd:   attrs.CommStd,
-				CommExt:   attrs.CommExt,
-				CommLarge: attrs.CommLarge,
-				Attrs:     attrs.Attrs,
-			})
-		}
+	if err := d.decodePayload(data[BGPHeaderSize:]); err != nil {
+		return nil, err
 	}
+	return d.AppendRoutes(nil)
+}
 
-	// MP_UNREACH_NLRI withdrawals (IPv4/IPv6).
-	if afi := afiToVersion(attrs.MPUnreachAFI); afi != 0 {
-		for _, p := range attrs.MPUnreachNLRI {
-			events = append(events, &RouteEvent{
-				AFI:    afi,
-				Prefix: p.Prefix,
-				PathID: p.PathID,
-				Action: "D",
-			})
-		}
+// renderEvents renders routes as route events, allocated together.
+func renderEvents(routes []Route) []*RouteEvent {
+	if len(routes) == 0 {
+		return nil
 	}
-
-	return events, nil
+	events := make([]RouteEvent, len(routes))
+	out := make([]*RouteEvent, len(routes))
+	var er eventRenderer
+	for i := range routes {
+		er.render(&events[i], &routes[i])
+		out[i] = &events[i]
+	}
+	return out
 }
 
 // ParseUpdateAutoDetect parses a BGP UPDATE, retrying with Add-Path
 // encoding if the initial parse yields suspicious results (all default
-// routes or any invalid CIDRs with host bits set). This handles routers
+// routes, any invalid CIDRs with host bits set or malformed NLRI). This handles routers
 // that send Add-Path encoded NLRI without setting the F-bit in the BMP
 // per-peer header, which is non-compliant with RFC 9069 Section 4.2.
 //
 // Returns the parsed events, the actual hasAddPath value used, and any error.
 func ParseUpdateAutoDetect(data []byte, hasAddPath bool) ([]*RouteEvent, bool, error) {
-	events, err := ParseUpdate(data, hasAddPath)
+	return ParseUpdateAutoDetectASN(data, hasAddPath, ASNWidthAuto)
+}
+
+// ParseUpdateAutoDetectASN is ParseUpdateAutoDetect for callers that know
+// the AS number width, e.g. from the BMP per-peer header A flag.
+func ParseUpdateAutoDetectASN(data []byte, hasAddPath bool, asnWidth ASNWidth) ([]*RouteEvent, bool, error) {
+	routes, hasAddPath, err := DecodeUpdateAutoDetect(data, hasAddPath, asnWidth)
 	if err != nil {
-		return events, hasAddPath, err
+		return nil, hasAddPath, err
 	}
+	return renderEvents(routes), hasAddPath, nil
+}
 
-	if !hasAddPath && len(events) > 0 && (allDefaultRoutes(events) || hasInvalidPrefixes(events)) {
-		retryEvents, retryErr := ParseUpdate(data, true)
-		if retryErr == nil && len(retryEvents) > 0 && !allDefaultRoutes(retryEvents) && !hasInvalidPrefixes(retryEvents) {
-			return retryEvents, true, nil
+// DecodeUpdateAutoDetect is ParseUpdateAutoDetectASN returning the routes
+// a Decoder reads, without rendering them as route events.
+func DecodeUpdateAutoDetect(data []byte, hasAddPath bool, asnWidth ASNWidth) ([]Route, bool, error) {
+	routes, err := decodeRoutes(data, &Decoder{AddPath: uniformAddPath(hasAddPath), ASNWidth: asnWidth})
+	if err != nil {
+		return nil, hasAddPath, err
+	}
+
+	if !hasAddPath && len(routes) > 0 && (allDefaultRoutes(routes) || hasInvalidPrefixes(routes) || worstAction(routes[0].Warnings) == SessionReset) {
+		retryRoutes, retryErr := decodeRoutes(data, &Decoder{AddPath: uniformAddPath(true), ASNWidth: asnWidth})
+		if retryErr == nil && len(retryRoutes) > 0 && !allDefaultRoutes(retryRoutes) && !hasInvalidPrefixes(retryRoutes) &&
+			worstAction(retryRoutes[0].Warnings) != SessionReset {
+			return retryRoutes, true, nil
 		}
 	}
 
-	return events, hasAddPath, nil
+	return routes, hasAddPath, nil
 }
 
-// allDefaultRoutes returns true if every event has a default-route prefix.
-func allDefaultRoutes(events []*RouteEvent) bool {
-	for _, ev := range events {
-		if ev.Prefix != "0.0.0.0/0" && ev.Prefix != "::/0" {
+// allDefaultRoutes returns true if every route has a default-route prefix.
+func allDefaultRoutes(routes []Route) bool {
+	for _, r := range routes {
+		if !r.Prefix.IsValid() || r.Prefix.Bits() != 0 || !r.Prefix.Addr().IsUnspecified() {
 			return false
 		}
 	}
 	return true
 }
 
-// hasInvalidPrefixes returns true if any event has a prefix with host bits
+// hasInvalidPrefixes returns true if any route has a prefix with host bits
 // set beyond the network mask (e.g. 100.2.0.0/10). This indicates garbled
 // parsing, typically from Add-Path encoded data parsed without Add-Path.
-func hasInvalidPrefixes(events []*RouteEvent) bool {
-	for _, ev := range events {
-		ip, ipNet, err := net.ParseCIDR(ev.Prefix)
-		if err != nil {
-			return true
+// EVPN, FlowSpec, BGP-LS and SR Policy routes carry no prefix and are
+// skipped.
+func hasInvalidPrefixes(routes []Route) bool {
+	for _, r := range routes {
+		if r.EVPN != nil || r.FlowSpec != nil || r.LinkState != nil || r.SRPolicy != nil {
+			continue
 		}
-		if !ip.Equal(ipNet.IP) {
+		if !r.Prefix.IsValid() || r.Prefix != r.Prefix.Masked() {
 			return true
 		}
 	}
@@ -182,12 +156,21 @@ func hasInvalidPrefixes(events []*RouteEvent) bool {
 // DetectEORAFI determines the address family for an End-of-RIB marker.
 // It scans the BGP UPDATE's path attributes for MP_UNREACH_NLRI.
 // If found with AFI=2 (IPv6), returns 6. Otherwise returns 4 (IPv4).
-// Only IPv4 (AFI=1) and IPv6 (AFI=2) unicast are supported. IPv4 EOR
+// Only IPv4 (AFI=1) and IPv6 (AFI=2) are supported. IPv4 unicast EOR
 // is an empty UPDATE (no MP_UNREACH), so the default return of 4 is correct.
 // Only call this when ParseUpdate returned 0 events and no error.
 func DetectEORAFI(data []byte) int {
+	afi, _ := DetectEORFamily(data)
+	return afi
+}
+
+// DetectEORFamily is DetectEORAFI that also returns the SAFI of the
+// End-of-RIB marker: the MP_UNREACH_NLRI SAFI, or SAFIUnicast for an
+// empty UPDATE. An L2VPN marker (EVPN) returns AFI 25 and a BGP-LS marker
+// AFI 16388.
+func DetectEORFamily(data []byte) (int, uint8) {
 	if len(data) < BGPHeaderSize+4 {
-		return 4
+		return 4, SAFIUnicast
 	}
 
 	payload := data[BGPHeaderSize:]
@@ -195,23 +178,23 @@ func DetectEORAFI(data []byte) int {
 
 	// Skip withdrawn routes.
 	if offset+2 > len(payload) {
-		return 4
+		return 4, SAFIUnicast
 	}
 	withdrawnLen := int(binary.BigEndian.Uint16(payload[offset : offset+2]))
 	offset += 2
 	if offset+withdrawnLen > len(payload) {
-		return 4
+		return 4, SAFIUnicast
 	}
 	offset += withdrawnLen
 
 	// Read path attributes length.
 	if offset+2 > len(payload) {
-		return 4
+		return 4, SAFIUnicast
 	}
 	pathAttrLen := int(binary.BigEndian.Uint16(payload[offset : offset+2]))
 	offset += 2
 	if offset+pathAttrLen > len(payload) {
-		return 4
+		return 4, SAFIUnicast
 	}
 
 	// Scan path attributes for MP_UNREACH_NLRI (type 15).
@@ -245,13 +228,18 @@ func DetectEORAFI(data []byte) int {
 
 		if typeCode == AttrTypeMPUnreachNLRI && attrLen >= 3 {
 			afi := binary.BigEndian.Uint16(payload[offset : offset+2])
-			if afi == AFIIPv6 {
-				return 6
+			safi := payload[offset+2]
+			switch afi {
+			case AFIIPv6:
+				return 6, safi
+			case AFIL2VPN, AFIBGPLS:
+				return int(afi), safi
 			}
+			return 4, safi
 		}
 
 		offset += attrLen
 	}
 
-	return 4
+	return 4, SAFIUnicast
 }
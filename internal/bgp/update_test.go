@@ -52,14 +52,21 @@ func buildPathAttr(flags byte, typeCode byte, data []byte) []byte {
 	return attr
 }
 
+// wellKnownAttrs returns ORIGIN IGP and an empty AS_PATH, the well-known
+// mandatory attributes of an UPDATE announcing routes. Routes in the NLRI
+// field need a NEXT_HOP as well.
+func wellKnownAttrs() []byte {
+	return append(buildPathAttr(0x40, AttrTypeOrigin, []byte{0}), buildPathAttr(0x40, AttrTypeASPath, nil)...)
+}
+
 func TestParseUpdate_IPv4Announcement(t *testing.T) {
 	// NLRI: 10.0.0.0/24
 	nlri := []byte{24, 10, 0, 0} // prefixLen=24, 3 bytes of prefix
 
 	// Path attributes: ORIGIN=IGP, NEXT_HOP=192.168.1.1
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0}) // IGP
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -151,9 +158,9 @@ func TestParseUpdate_StandardCommunities(t *testing.T) {
 	commAttr := buildPathAttr(0xC0, AttrTypeCommunity, commData)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(commAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(commAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -187,9 +194,9 @@ func TestParseUpdate_LargeCommunities(t *testing.T) {
 	lcAttr := buildPathAttr(0xC0, AttrTypeLargeCommunity, lcData)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(lcAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(lcAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -215,9 +222,9 @@ func TestParseUpdate_AddPath(t *testing.T) {
 		24, 10, 0, 0, // prefixLen=24, 3 bytes
 	}
 
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -247,8 +254,8 @@ func TestParseUpdate_IPv6MPReach(t *testing.T) {
 	mpReach = append(mpReach, 0x20, 0x01, 0x0d, 0xb8) // 4 bytes of prefix
 
 	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nil)
 
@@ -309,7 +316,7 @@ func TestParseUpdate_IPv6MPUnreach(t *testing.T) {
 
 func TestParseUpdate_MEDAndLocalPref(t *testing.T) {
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
 
 	medData := make([]byte, 4)
@@ -320,7 +327,7 @@ func TestParseUpdate_MEDAndLocalPref(t *testing.T) {
 	binary.BigEndian.PutUint32(lpData, 200)
 	lpAttr := buildPathAttr(0x40, AttrTypeLocalPref, lpData)
 
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	pathAttrs = append(pathAttrs, medAttr...)
 	pathAttrs = append(pathAttrs, lpAttr...)
 
@@ -345,10 +352,10 @@ func TestParseUpdate_MEDAndLocalPref(t *testing.T) {
 
 func TestParseUpdate_UnknownAttribute(t *testing.T) {
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
 	unknownAttr := buildPathAttr(0xC0, 99, []byte{0xDE, 0xAD})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	pathAttrs = append(pathAttrs, unknownAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
@@ -368,40 +375,48 @@ func TestParseUpdate_UnknownAttribute(t *testing.T) {
 	}
 }
 
+// expectTreatAsWithdraw checks that an UPDATE announcing 10.0.0.0/24 was
+// turned into its withdrawal for a malformed attribute of type attr.
+func expectTreatAsWithdraw(t *testing.T, msg []byte, attr uint8) {
+	t.Helper()
+	events, err := ParseUpdate(msg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "D" || ev.Prefix != "10.0.0.0/24" || ev.Origin != "" {
+		t.Errorf("expected withdrawal of 10.0.0.0/24, got %s %s origin %q", ev.Action, ev.Prefix, ev.Origin)
+	}
+	if len(ev.ParseWarnings) != 1 {
+		t.Fatalf("expected 1 parse warning, got %v", ev.ParseWarnings)
+	}
+	if w := ev.ParseWarnings[0]; w.Action != TreatAsWithdraw || w.Attr != attr {
+		t.Errorf("unexpected warning %s", w)
+	}
+}
+
 func TestParseUpdate_TruncatedAttrHeader(t *testing.T) {
 	// Path attributes with only 1 byte (need at least 2 for flags+type).
 	pathAttrs := []byte{0x40} // truncated: only flags, no type code
 	nlri := []byte{24, 10, 0, 0}
-	msg := buildBGPUpdate(nil, pathAttrs, nlri)
-
-	_, err := ParseUpdate(msg, false)
-	if err == nil {
-		t.Fatal("expected error for truncated attr header")
-	}
+	expectTreatAsWithdraw(t, buildBGPUpdate(nil, pathAttrs, nlri), 0)
 }
 
 func TestParseUpdate_TruncatedAttrLength(t *testing.T) {
 	// Path attribute with extended length flag but missing length bytes.
 	pathAttrs := []byte{0x50, AttrTypeOrigin} // 0x50 = 0x40|0x10 (transitive + extended), but no length bytes
 	nlri := []byte{24, 10, 0, 0}
-	msg := buildBGPUpdate(nil, pathAttrs, nlri)
-
-	_, err := ParseUpdate(msg, false)
-	if err == nil {
-		t.Fatal("expected error for truncated extended attr length")
-	}
+	expectTreatAsWithdraw(t, buildBGPUpdate(nil, pathAttrs, nlri), AttrTypeOrigin)
 }
 
 func TestParseUpdate_AttrDataTruncated(t *testing.T) {
 	// Path attribute that claims 4 bytes of data but only has 2.
 	pathAttrs := []byte{0x40, AttrTypeOrigin, 4, 0x00, 0x00} // length=4 but only 2 bytes of data
 	nlri := []byte{24, 10, 0, 0}
-	msg := buildBGPUpdate(nil, pathAttrs, nlri)
-
-	_, err := ParseUpdate(msg, false)
-	if err == nil {
-		t.Fatal("expected error for truncated attr data")
-	}
+	expectTreatAsWithdraw(t, buildBGPUpdate(nil, pathAttrs, nlri), AttrTypeOrigin)
 }
 
 func TestParseUpdate_UnsupportedAFI_MPReach(t *testing.T) {
@@ -415,8 +430,8 @@ func TestParseUpdate_UnsupportedAFI_MPReach(t *testing.T) {
 	mpReach = append(mpReach, 24, 10, 0, 0)   // prefix /24
 
 	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nil)
 
@@ -465,8 +480,8 @@ func TestParseUpdate_MPReachWithNonZeroSNPA(t *testing.T) {
 	mpReach = append(mpReach, 0x20, 0x01, 0x0d, 0xb8) // 4 bytes of prefix
 
 	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nil)
 
@@ -501,8 +516,8 @@ func TestParseUpdate_IPv6MPReach_AddPath(t *testing.T) {
 	mpReach = append(mpReach, 0x20, 0x01, 0x0d, 0xb8) // 4 bytes of prefix
 
 	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nil)
 
@@ -634,9 +649,9 @@ func TestParseUpdateAutoDetect_AddPathWithoutFBit(t *testing.T) {
 		24, 10, 100, 193, // 10.100.193.0/24
 	}
 
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{10, 0, 0, 2})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -676,9 +691,9 @@ func TestParseUpdateAutoDetect_AddPathECMP(t *testing.T) {
 		24, 10, 100, 0, // 10.100.0.0/24
 	}
 
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{172, 30, 0, 30})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -707,9 +722,9 @@ func TestParseUpdateAutoDetect_NoFalsePositive(t *testing.T) {
 	// Normal NLRI without Add-Path should not trigger auto-detection.
 	nlri := []byte{24, 10, 0, 0} // 10.0.0.0/24
 
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -732,9 +747,9 @@ func TestParseUpdateAutoDetect_RealDefaultRoute(t *testing.T) {
 	// A real 0.0.0.0/0 default route without Add-Path should not trigger detection.
 	nlri := []byte{0} // prefix_len=0 → 0.0.0.0/0
 
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -914,9 +929,9 @@ func TestParseExtCommunities(t *testing.T) {
 	extCommAttr := buildPathAttr(0xC0, AttrTypeExtCommunity, extCommData)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(extCommAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(extCommAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -958,8 +973,8 @@ func TestMPReachNLRI_DualNexthop(t *testing.T) {
 	mpReach = append(mpReach, 0x20, 0x01, 0x0d, 0xb8) // 4 bytes of prefix
 
 	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nil)
 
@@ -975,6 +990,9 @@ func TestMPReachNLRI_DualNexthop(t *testing.T) {
 	if events[0].Nexthop != "2001:db8::1" {
 		t.Errorf("expected nexthop '2001:db8::1', got '%s'", events[0].Nexthop)
 	}
+	if events[0].NexthopLL != "fe80::1" {
+		t.Errorf("expected link-local nexthop 'fe80::1', got '%s'", events[0].NexthopLL)
+	}
 }
 
 func TestMPReachNLRI_IPv4Nexthop(t *testing.T) {
@@ -988,8 +1006,8 @@ func TestMPReachNLRI_IPv4Nexthop(t *testing.T) {
 	mpReach = append(mpReach, 24, 10, 1, 0)  // 10.1.0.0/24
 
 	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nil)
 
@@ -1045,7 +1063,8 @@ func TestParseASPath_TruncatedSegment(t *testing.T) {
 func TestParseOrigin_EGP(t *testing.T) {
 	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{1}) // EGP
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(originAttr, buildPathAttr(0x40, AttrTypeASPath, nil)...)
+	pathAttrs = append(pathAttrs, nexthopAttr...)
 	nlri := []byte{24, 10, 0, 0}
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
@@ -1065,7 +1084,8 @@ func TestParseOrigin_EGP(t *testing.T) {
 func TestParseOrigin_INCOMPLETE(t *testing.T) {
 	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{2}) // INCOMPLETE
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(originAttr, buildPathAttr(0x40, AttrTypeASPath, nil)...)
+	pathAttrs = append(pathAttrs, nexthopAttr...)
 	nlri := []byte{24, 10, 0, 0}
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
@@ -1092,9 +1112,9 @@ func TestParseCommunity_NonMultipleOf4(t *testing.T) {
 	commAttr := buildPathAttr(0xC0, AttrTypeCommunity, commData)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(commAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(commAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1106,12 +1126,14 @@ func TestParseCommunity_NonMultipleOf4(t *testing.T) {
 		t.Fatalf("expected 1 event, got %d", len(events))
 	}
 
+	// A COMMUNITIES length that is not a multiple of 4 is handled as
+	// "treat-as-withdraw" (RFC 7606 §7.8).
 	ev := events[0]
-	if len(ev.CommStd) != 1 {
-		t.Fatalf("expected 1 community (ignoring incomplete trailing bytes), got %d", len(ev.CommStd))
+	if ev.Action != "D" || ev.CommStd != nil {
+		t.Errorf("expected withdrawal without communities, got %s %v", ev.Action, ev.CommStd)
 	}
-	if ev.CommStd[0] != "64496:100" {
-		t.Errorf("expected '64496:100', got '%s'", ev.CommStd[0])
+	if len(ev.ParseWarnings) != 1 || ev.ParseWarnings[0].Attr != AttrTypeCommunity {
+		t.Errorf("unexpected parse warnings %v", ev.ParseWarnings)
 	}
 }
 
@@ -1128,8 +1150,8 @@ func TestParseMPReachNLRI_NonUnicastSAFI(t *testing.T) {
 	mpReach = append(mpReach, 32, 0x20, 0x01, 0x0d, 0xb8) // prefix /32
 
 	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nil)
 
@@ -1143,10 +1165,10 @@ func TestParseMPReachNLRI_NonUnicastSAFI(t *testing.T) {
 }
 
 func TestParseMPUnreachNLRI_NonUnicastSAFI(t *testing.T) {
-	// MP_UNREACH_NLRI with SAFI=4 (MPLS-labeled) should produce no events.
+	// MP_UNREACH_NLRI with SAFI=2 (multicast) should produce no events.
 	mpUnreach := []byte{
 		0, 2, // AFI=2
-		4,    // SAFI=4 (MPLS-labeled) — NOT unicast
+		2,    // SAFI=2 (multicast) — NOT unicast
 		48,   // prefix len
 		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x01, // 6 bytes of prefix
 	}
@@ -1172,9 +1194,9 @@ func TestParsePrefixes_PartialError(t *testing.T) {
 		24, 10, // truncated: prefix_len=24 needs 3 bytes, only 1 provided
 	}
 
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1198,9 +1220,9 @@ func TestParseUpdateAutoDetect_RetryAlsoFails(t *testing.T) {
 	// Both initial parse and Add-Path retry should handle gracefully.
 	nlri := []byte{33, 10, 0, 0, 0, 1} // prefix_len=33 > max 32 for IPv4
 
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1212,8 +1234,17 @@ func TestParseUpdateAutoDetect_RetryAlsoFails(t *testing.T) {
 
 // --- OriginASN tests ---
 
+func mustParseASPath(t *testing.T, s string) ASPath {
+	t.Helper()
+	path, err := ParseASPath(s)
+	if err != nil {
+		t.Fatalf("ParseASPath(%q): %v", s, err)
+	}
+	return path
+}
+
 func TestOriginASN_SimpleSequence(t *testing.T) {
-	asn := OriginASN("64496 64497 64498")
+	asn := OriginASN(mustParseASPath(t, "64496 64497 64498"))
 	if asn == nil {
 		t.Fatal("expected non-nil origin ASN")
 	}
@@ -1223,7 +1254,7 @@ func TestOriginASN_SimpleSequence(t *testing.T) {
 }
 
 func TestOriginASN_SingleASN(t *testing.T) {
-	asn := OriginASN("64496")
+	asn := OriginASN(mustParseASPath(t, "64496"))
 	if asn == nil {
 		t.Fatal("expected non-nil origin ASN")
 	}
@@ -1233,21 +1264,21 @@ func TestOriginASN_SingleASN(t *testing.T) {
 }
 
 func TestOriginASN_Empty(t *testing.T) {
-	asn := OriginASN("")
+	asn := OriginASN(mustParseASPath(t, ""))
 	if asn != nil {
 		t.Errorf("expected nil for empty as_path, got %d", *asn)
 	}
 }
 
 func TestOriginASN_ASSetAtEnd(t *testing.T) {
-	asn := OriginASN("64496 {64497,64498}")
+	asn := OriginASN(mustParseASPath(t, "64496 {64497,64498}"))
 	if asn != nil {
 		t.Errorf("expected nil for AS_SET origin, got %d", *asn)
 	}
 }
 
 func TestOriginASN_Whitespace(t *testing.T) {
-	asn := OriginASN("  64496  64497  ")
+	asn := OriginASN(mustParseASPath(t, "  64496  64497  "))
 	if asn == nil {
 		t.Fatal("expected non-nil origin ASN")
 	}
@@ -1265,9 +1296,9 @@ func TestDecodeExtCommunity_IPv4RT(t *testing.T) {
 	extCommAttr := buildPathAttr(0xC0, AttrTypeExtCommunity, data)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(extCommAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(extCommAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1293,9 +1324,9 @@ func TestDecodeExtCommunity_4OctetASRT(t *testing.T) {
 	extCommAttr := buildPathAttr(0xC0, AttrTypeExtCommunity, data)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(extCommAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(extCommAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1318,9 +1349,9 @@ func TestDecodeExtCommunity_SOO(t *testing.T) {
 	extCommAttr := buildPathAttr(0xC0, AttrTypeExtCommunity, data)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(extCommAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(extCommAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1335,14 +1366,14 @@ func TestDecodeExtCommunity_SOO(t *testing.T) {
 
 func TestDecodeExtCommunity_TransitiveBit(t *testing.T) {
 	// Transitive 2-Octet AS Route Target: type 0x40, subtype 0x02
-	// (bit 6 set = non-transitive, but we mask with 0x3F)
+	// (bit 6 set = non-transitive, masked off for matching)
 	data := []byte{0x40, 0x02, 0xFB, 0xF0, 0x00, 0x00, 0x00, 0x64}
 	extCommAttr := buildPathAttr(0xC0, AttrTypeExtCommunity, data)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(extCommAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(extCommAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1361,9 +1392,9 @@ func TestDecodeExtCommunity_UnknownType(t *testing.T) {
 	extCommAttr := buildPathAttr(0xC0, AttrTypeExtCommunity, data)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, append(extCommAttr, nexthopAttr...)...)
+	pathAttrs := append(wellKnown, append(extCommAttr, nexthopAttr...)...)
 
 	msg := buildBGPUpdate(nil, pathAttrs, nlri)
 
@@ -1375,3 +1406,473 @@ func TestDecodeExtCommunity_UnknownType(t *testing.T) {
 		t.Errorf("expected hex fallback '0699010203040506', got '%s'", events[0].CommExt[0])
 	}
 }
+
+// asSeg encodes one AS_PATH segment with asnLen-byte ASNs.
+func asSeg(asnLen int, segType uint8, asns ...uint32) []byte {
+	b := []byte{segType, byte(len(asns))}
+	for _, asn := range asns {
+		if asnLen == 2 {
+			b = binary.BigEndian.AppendUint16(b, uint16(asn))
+		} else {
+			b = binary.BigEndian.AppendUint32(b, asn)
+		}
+	}
+	return b
+}
+
+func TestParseUpdate_ASNWidthAndAS4Path(t *testing.T) {
+	join := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+	aggregator := func(asn uint16) []byte {
+		return buildPathAttr(0xC0, AttrTypeAggregator, []byte{byte(asn >> 8), byte(asn), 192, 0, 2, 1})
+	}
+	// Parses exactly with both widths: 2-octet {65001 65002} {65003} or
+	// 4-octet {4259970538 ...}.
+	ambiguous := join(asSeg(2, ASPathSegmentSequence, 65001, 65002), asSeg(2, ASPathSegmentSet, 65003))
+
+	tests := []struct {
+		name    string
+		asPath  []byte
+		extra   []byte // attributes after AS_PATH
+		session *Session
+		want    string
+	}{
+		{
+			name:   "2-octet path detected and merged",
+			asPath: asSeg(2, ASPathSegmentSequence, 65001, ASTrans),
+			extra:  buildPathAttr(0xC0, AttrTypeAS4Path, asSeg(4, ASPathSegmentSequence, 4200000001)),
+			want:   "65001 4200000001",
+		},
+		{
+			name:   "4-octet path unchanged",
+			asPath: asSeg(4, ASPathSegmentSequence, 65001, 4200000001),
+			want:   "65001 4200000001",
+		},
+		{
+			name:   "AS4_PATH longer than AS_PATH is ignored",
+			asPath: asSeg(2, ASPathSegmentSequence, ASTrans),
+			extra:  buildPathAttr(0xC0, AttrTypeAS4Path, asSeg(4, ASPathSegmentSequence, 4200000001, 4200000002)),
+			want:   "23456",
+		},
+		{
+			name:   "non-AS_TRANS aggregator makes AS4_PATH stale",
+			asPath: asSeg(2, ASPathSegmentSequence, 65001, ASTrans),
+			extra: join(aggregator(65010),
+				buildPathAttr(0xC0, AttrTypeAS4Path, asSeg(4, ASPathSegmentSequence, 4200000001))),
+			want: "65001 23456",
+		},
+		{
+			name:   "AS_TRANS aggregator allows merge",
+			asPath: asSeg(2, ASPathSegmentSequence, 65001, ASTrans),
+			extra: join(aggregator(uint16(ASTrans)),
+				buildPathAttr(0xC0, AttrTypeAS4Path, asSeg(4, ASPathSegmentSequence, 4200000001))),
+			want: "65001 4200000001",
+		},
+		{
+			name: "merge keeps leading AS_PATH and AS4_PATH sets",
+			asPath: join(asSeg(2, ASPathSegmentSequence, 65001, ASTrans),
+				asSeg(2, ASPathSegmentSet, ASTrans, 65005)),
+			extra: buildPathAttr(0xC0, AttrTypeAS4Path, join(
+				asSeg(4, ASPathSegmentSequence, 4200000001),
+				asSeg(4, ASPathSegmentSet, 4200000002, 65005))),
+			want: "65001 4200000001 {4200000002,65005}",
+		},
+		{
+			name:    "2-octet session resolves ambiguous path",
+			asPath:  ambiguous,
+			session: &Session{},
+			want:    "65001 65002 {65003}",
+		},
+		{
+			name:   "ambiguous path with AS4_PATH detected as 2-octet",
+			asPath: ambiguous,
+			extra:  buildPathAttr(0xC0, AttrTypeAS4Path, asSeg(4, ASPathSegmentSet, 65003)),
+			want:   "65001 65002 {65003}",
+		},
+		{
+			name:    "4-octet session ignores AS4_PATH",
+			asPath:  asSeg(4, ASPathSegmentSequence, 65001, ASTrans),
+			extra:   buildPathAttr(0xC0, AttrTypeAS4Path, asSeg(4, ASPathSegmentSequence, 4200000001)),
+			session: &Session{FourOctetAS: true},
+			want:    "65001 23456",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathAttrs := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+			pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeASPath, tt.asPath)...)
+			pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+			pathAttrs = append(pathAttrs, tt.extra...)
+			msg := buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0})
+
+			var events []*RouteEvent
+			var err error
+			if tt.session != nil {
+				events, err = ParseUpdateSession(msg, tt.session, false)
+			} else {
+				events, err = ParseUpdate(msg, false)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			if events[0].ASPath != tt.want {
+				t.Errorf("expected AS path %q, got %q", tt.want, events[0].ASPath)
+			}
+			if _, ok := events[0].Attrs["17"]; ok {
+				t.Error("expected AS4_PATH to be consumed, found it in Attrs")
+			}
+		})
+	}
+}
+
+func TestParseUpdateAutoDetectASN_LegacyWidth(t *testing.T) {
+	asPath := append(asSeg(2, ASPathSegmentSequence, 65001, 65002), asSeg(2, ASPathSegmentSet, 65003)...)
+	pathAttrs := buildPathAttr(0x40, AttrTypeOrigin, []byte{0})
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeASPath, asPath)...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+	msg := buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0})
+
+	events, _, err := ParseUpdateAutoDetectASN(msg, false, ASNWidth2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].ASPath != "65001 65002 {65003}" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if asn := OriginASN(events[0].ASPathSegments); asn != nil {
+		t.Errorf("expected no origin ASN for a trailing AS_SET, got %d", *asn)
+	}
+}
+
+func TestParseUpdate_RouteReflectionAttrs(t *testing.T) {
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 168, 1, 1})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeOriginatorID, []byte{10, 0, 0, 5})...)
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeClusterList, []byte{10, 0, 0, 1, 10, 0, 0, 2})...)
+
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0}), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.OriginatorID != "10.0.0.5" {
+		t.Errorf("expected originator 10.0.0.5, got %q", ev.OriginatorID)
+	}
+	if len(ev.ClusterList) != 2 || ev.ClusterList[0] != "10.0.0.1" || ev.ClusterList[1] != "10.0.0.2" {
+		t.Errorf("expected cluster list [10.0.0.1 10.0.0.2], got %v", ev.ClusterList)
+	}
+	if len(ev.Attrs) != 0 {
+		t.Errorf("expected no hex attrs, got %v", ev.Attrs)
+	}
+}
+
+func TestParseUpdate_AggregationAttrs(t *testing.T) {
+	tests := []struct {
+		name     string
+		attrs    []byte
+		session  *Session
+		wantASN  uint32
+		wantAddr string
+	}{
+		{
+			name:     "4-octet aggregator",
+			attrs:    buildPathAttr(0xC0, AttrTypeAggregator, []byte{0xFA, 0x56, 0xEA, 0x01, 192, 0, 2, 1}),
+			session:  &Session{FourOctetAS: true},
+			wantASN:  4200000001,
+			wantAddr: "192.0.2.1",
+		},
+		{
+			name:     "2-octet aggregator",
+			attrs:    buildPathAttr(0xC0, AttrTypeAggregator, []byte{0xFD, 0xE9, 192, 0, 2, 1}),
+			session:  &Session{},
+			wantASN:  65001,
+			wantAddr: "192.0.2.1",
+		},
+		{
+			name: "AS_TRANS replaced by AS4_AGGREGATOR",
+			attrs: append(
+				buildPathAttr(0xC0, AttrTypeAggregator, []byte{0x5B, 0xA0, 192, 0, 2, 1}),
+				buildPathAttr(0xC0, AttrTypeAS4Aggregator, []byte{0xFA, 0x56, 0xEA, 0x01, 192, 0, 2, 9})...),
+			session:  &Session{},
+			wantASN:  4200000001,
+			wantAddr: "192.0.2.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathAttrs := wellKnownAttrs()
+			pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})...)
+			pathAttrs = append(pathAttrs, buildPathAttr(0x40, AttrTypeAtomicAggregate, nil)...)
+			pathAttrs = append(pathAttrs, tt.attrs...)
+			msg := buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 0, 0})
+
+			events, err := ParseUpdateSession(msg, tt.session, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			ev := events[0]
+			if !ev.AtomicAggregate {
+				t.Error("expected AtomicAggregate=true")
+			}
+			if ev.AggregatorASN == nil || *ev.AggregatorASN != tt.wantASN {
+				t.Errorf("expected aggregator ASN %d, got %v", tt.wantASN, ev.AggregatorASN)
+			}
+			if ev.AggregatorAddress != tt.wantAddr {
+				t.Errorf("expected aggregator address %s, got %q", tt.wantAddr, ev.AggregatorAddress)
+			}
+			if len(ev.Attrs) != 0 {
+				t.Errorf("expected no hex attrs, got %v", ev.Attrs)
+			}
+		})
+	}
+}
+
+// labelField encodes one RFC 8277 label field.
+func labelField(label uint32, bottom bool) []byte {
+	v := label << 4
+	if bottom {
+		v |= 1
+	}
+	return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// labeledMPReach builds an IPv4 labeled-unicast MP_REACH_NLRI for
+// 10.1.0.0/16 carrying labels.
+func labeledMPReach(labels ...[]byte) []byte {
+	mpReach := []byte{0, 1, SAFILabeledUnicast, 4, 192, 168, 1, 1, 0}
+	mpReach = append(mpReach, byte(16+24*len(labels)))
+	for _, l := range labels {
+		mpReach = append(mpReach, l...)
+	}
+	return append(mpReach, 10, 1)
+}
+
+func TestParseUpdate_LabeledUnicast(t *testing.T) {
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI,
+		labeledMPReach(labelField(24001, false), labelField(3, true)))...)
+	msg := buildBGPUpdate(nil, pathAttrs, nil)
+
+	events, err := ParseUpdate(msg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.AFI != 4 || ev.SAFI != SAFILabeledUnicast {
+		t.Errorf("expected AFI 4 SAFI 4, got %d/%d", ev.AFI, ev.SAFI)
+	}
+	if ev.Prefix != "10.1.0.0/16" {
+		t.Errorf("expected prefix 10.1.0.0/16, got %s", ev.Prefix)
+	}
+	if ev.Nexthop != "192.168.1.1" {
+		t.Errorf("expected nexthop 192.168.1.1, got %s", ev.Nexthop)
+	}
+	if len(ev.Labels) != 2 || ev.Labels[0] != 24001 || ev.Labels[1] != 3 {
+		t.Errorf("expected labels [24001 3], got %v", ev.Labels)
+	}
+}
+
+func TestParseUpdateSession_MultipleLabels(t *testing.T) {
+	lu := AFISAFI{AFIIPv4, SAFILabeledUnicast}
+
+	// Without the Multiple Labels capability a prefix carries one label,
+	// whatever its bottom-of-stack bit says.
+	pathAttrs := append(wellKnownAttrs(), buildPathAttr(0x80, AttrTypeMPReachNLRI, labeledMPReach(labelField(16, false)))...)
+	msg := buildBGPUpdate(nil, pathAttrs, nil)
+	events, err := ParseUpdateSession(msg, &Session{FourOctetAS: true}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Prefix != "10.1.0.0/16" || len(events[0].Labels) != 1 || events[0].Labels[0] != 16 {
+		t.Fatalf("expected 10.1.0.0/16 with label [16], got %+v", events)
+	}
+
+	pathAttrs = append(wellKnownAttrs(), buildPathAttr(0x80, AttrTypeMPReachNLRI,
+		labeledMPReach(labelField(100, false), labelField(200, false), labelField(300, true)))...)
+	msg = buildBGPUpdate(nil, pathAttrs, nil)
+
+	s := &Session{FourOctetAS: true, MultiLabelRX: []AFISAFI{lu}}
+	events, err = ParseUpdateSession(msg, s, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || len(events[0].Labels) != 3 || events[0].Labels[2] != 300 {
+		t.Fatalf("expected 3 labels, got %+v", events)
+	}
+
+	// MultiLabelRX does not apply to Adj-RIB-Out.
+	events, _ = ParseUpdateSession(msg, s, true)
+	if len(events) == 1 && len(events[0].Labels) == 3 {
+		t.Error("expected Adj-RIB-Out to use MultiLabelTX")
+	}
+}
+
+func TestParseUpdate_LabeledUnicastWithdrawal(t *testing.T) {
+	// RFC 8277 §2.4: one label field with the compatibility value 0x800000,
+	// which has no bottom-of-stack bit.
+	mpUnreach := []byte{0, 1, SAFILabeledUnicast, 16 + 24, 0x80, 0x00, 0x00, 10, 1}
+	msg := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, mpUnreach), nil)
+
+	events, err := ParseUpdate(msg, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "D" || ev.SAFI != SAFILabeledUnicast || ev.Prefix != "10.1.0.0/16" {
+		t.Errorf("unexpected withdrawal: action=%s safi=%d prefix=%s", ev.Action, ev.SAFI, ev.Prefix)
+	}
+	if ev.Labels != nil {
+		t.Errorf("expected no labels on withdrawal, got %v", ev.Labels)
+	}
+}
+
+func TestParseUpdate_LabeledUnicastTruncatedStack(t *testing.T) {
+	// The length covers only one label field but its bottom-of-stack bit
+	// is clear: the stack runs into the prefix and the NLRI is dropped.
+	// Left without routes, the UPDATE must not pass for an End-of-RIB.
+	mpReach := []byte{0, 1, SAFILabeledUnicast, 4, 192, 168, 1, 1, 0, 24}
+	mpReach = append(mpReach, labelField(16, false)...)
+	msg := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach), nil)
+
+	if events, err := ParseUpdate(msg, false); err == nil {
+		t.Errorf("expected error, got %d events", len(events))
+	}
+}
+
+func TestDetectEORFamily_LabeledUnicast(t *testing.T) {
+	msg := buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, []byte{0, 2, SAFILabeledUnicast}), nil)
+	afi, safi := DetectEORFamily(msg)
+	if afi != 6 || safi != SAFILabeledUnicast {
+		t.Errorf("expected 6/4, got %d/%d", afi, safi)
+	}
+
+	afi, safi = DetectEORFamily(buildBGPUpdate(nil, nil, nil))
+	if afi != 4 || safi != SAFIUnicast {
+		t.Errorf("expected 4/1 for empty UPDATE, got %d/%d", afi, safi)
+	}
+}
+
+// ipv4MPReach builds MP_REACH_NLRI for IPv4 unicast 10.1.0.0/24 with the
+// given next hop.
+func ipv4MPReach(nh []byte) []byte {
+	mpReach := append([]byte{0, 1, SAFIUnicast, byte(len(nh))}, nh...)
+	return append(mpReach, 0, 24, 10, 1, 0)
+}
+
+func TestParseUpdate_IPv4WithIPv6Nexthop(t *testing.T) {
+	global := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	linkLocal := []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	unspecified := make([]byte, 16)
+
+	tests := []struct {
+		name   string
+		nh     []byte
+		wantNH string
+		wantLL string
+	}{
+		{"global", global, "2001:db8::1", ""},
+		{"global and link-local", append(append([]byte{}, global...), linkLocal...), "2001:db8::1", "fe80::1"},
+		{"unnumbered", append(append([]byte{}, unspecified...), linkLocal...), "fe80::1", "fe80::1"},
+		{"link-local only", linkLocal, "fe80::1", "fe80::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathAttrs := append(wellKnownAttrs(), buildPathAttr(0x80, AttrTypeMPReachNLRI, ipv4MPReach(tt.nh))...)
+			msg := buildBGPUpdate(nil, pathAttrs, nil)
+			events, err := ParseUpdate(msg, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(events) != 1 || events[0].AFI != 4 || events[0].Prefix != "10.1.0.0/24" {
+				t.Fatalf("expected 10.1.0.0/24, got %+v", events)
+			}
+			if events[0].Nexthop != tt.wantNH || events[0].NexthopLL != tt.wantLL {
+				t.Errorf("nexthop = %q/%q, want %q/%q", events[0].Nexthop, events[0].NexthopLL, tt.wantNH, tt.wantLL)
+			}
+		})
+	}
+}
+
+func TestParseUpdateSession_ExtendedNextHop(t *testing.T) {
+	global := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	pathAttrs := append(wellKnownAttrs(), buildPathAttr(0x80, AttrTypeMPReachNLRI, ipv4MPReach(global))...)
+	msg := buildBGPUpdate(nil, pathAttrs, nil)
+
+	// Without the capability an IPv6 next hop for IPv4 NLRI is invalid.
+	events, err := ParseUpdateSession(msg, &Session{FourOctetAS: true}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Nexthop != "" {
+		t.Fatalf("expected route without next hop, got %+v", events)
+	}
+
+	s := &Session{FourOctetAS: true, ExtendedNextHopRX: []AFISAFI{{AFIIPv4, SAFIUnicast}}}
+	events, err = ParseUpdateSession(msg, s, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Nexthop != "2001:db8::1" {
+		t.Fatalf("expected next hop 2001:db8::1, got %+v", events)
+	}
+
+	// ExtendedNextHopRX does not apply to Adj-RIB-Out.
+	events, _ = ParseUpdateSession(msg, s, true)
+	if len(events) == 1 && events[0].Nexthop != "" {
+		t.Error("expected Adj-RIB-Out to use ExtendedNextHopTX")
+	}
+}
+
+func TestParseUpdate_NextHopNotOverwritten(t *testing.T) {
+	// IPv4 NLRI use NEXT_HOP and MP_REACH_NLRI its own next hop, whatever
+	// the attribute order.
+	v6 := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	mpReach := append([]byte{0, 2, SAFIUnicast, 16}, v6...)
+	mpReach = append(mpReach, 0, 32, 0x20, 0x01, 0x0d, 0xb8)
+	nextHop := buildPathAttr(0x40, AttrTypeNextHop, []byte{192, 0, 2, 1})
+	mpReachAttr := buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)
+
+	for _, pathAttrs := range [][]byte{
+		append(append(wellKnownAttrs(), nextHop...), mpReachAttr...),
+		append(append(wellKnownAttrs(), mpReachAttr...), nextHop...),
+	} {
+		events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, []byte{24, 10, 1, 0}), false)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(events))
+		}
+		for _, ev := range events {
+			want := "192.0.2.1"
+			if ev.AFI == 6 {
+				want = "2001:db8::1"
+			}
+			if ev.Nexthop != want {
+				t.Errorf("%s: nexthop = %s, want %s", ev.Prefix, ev.Nexthop, want)
+			}
+		}
+	}
+}
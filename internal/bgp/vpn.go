@@ -0,0 +1,92 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Route Distinguisher types (RFC 4364 §4.2).
+const (
+	RDTypeAS2  uint16 = 0 // 2-octet ASN : 4-octet number
+	RDTypeIPv4 uint16 = 1 // IPv4 address : 2-octet number
+	RDTypeAS4  uint16 = 2 // 4-octet ASN : 2-octet number
+)
+
+// RDLen is the size of an encoded Route Distinguisher.
+const RDLen = 8
+
+// FormatRD renders an 8-byte Route Distinguisher as "<admin>:<assigned>",
+// e.g. "65000:100" or "192.0.2.1:100". Unknown types render as
+// "<type>:<hex value>".
+func FormatRD(b []byte) string {
+	if len(b) < RDLen {
+		return ""
+	}
+	switch t := binary.BigEndian.Uint16(b[0:2]); t {
+	case RDTypeAS2:
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint16(b[2:4]), binary.BigEndian.Uint32(b[4:8]))
+	case RDTypeIPv4:
+		return fmt.Sprintf("%s:%d", net.IP(b[2:6]), binary.BigEndian.Uint16(b[6:8]))
+	case RDTypeAS4:
+		return fmt.Sprintf("%d:%d", binary.BigEndian.Uint32(b[2:6]), binary.BigEndian.Uint16(b[6:8]))
+	default:
+		return fmt.Sprintf("%d:%s", t, hex.EncodeToString(b[2:8]))
+	}
+}
+
+// ParseRD parses a Route Distinguisher rendered by FormatRD. An ASN that
+// fits in 2 octets is encoded as type 0, so a type 2 RD with a small ASN
+// comes back as the type 0 RD that FormatRD renders the same way.
+func ParseRD(s string) ([RDLen]byte, error) {
+	var rd [RDLen]byte
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return rd, fmt.Errorf("bgp: invalid route distinguisher %q", s)
+	}
+	admin, assigned := s[:i], s[i+1:]
+
+	// Unknown types: "<type>:<hex value>".
+	if len(assigned) == 2*(RDLen-2) {
+		t, err1 := strconv.ParseUint(admin, 10, 16)
+		_, err2 := hex.Decode(rd[2:], []byte(assigned))
+		if err1 != nil || err2 != nil || uint16(t) <= RDTypeAS4 {
+			return rd, fmt.Errorf("bgp: invalid route distinguisher %q", s)
+		}
+		binary.BigEndian.PutUint16(rd[0:2], uint16(t))
+		return rd, nil
+	}
+
+	if addr, err := netip.ParseAddr(admin); err == nil && addr.Is4() {
+		n, err := strconv.ParseUint(assigned, 10, 16)
+		if err != nil {
+			return rd, fmt.Errorf("bgp: invalid route distinguisher %q", s)
+		}
+		binary.BigEndian.PutUint16(rd[0:2], RDTypeIPv4)
+		copy(rd[2:6], addr.AsSlice())
+		binary.BigEndian.PutUint16(rd[6:8], uint16(n))
+		return rd, nil
+	}
+
+	asn, err1 := strconv.ParseUint(admin, 10, 32)
+	n, err2 := strconv.ParseUint(assigned, 10, 32)
+	switch {
+	case err1 != nil || err2 != nil:
+		return rd, fmt.Errorf("bgp: invalid route distinguisher %q", s)
+	case asn <= 0xFFFF:
+		binary.BigEndian.PutUint16(rd[0:2], RDTypeAS2)
+		binary.BigEndian.PutUint16(rd[2:4], uint16(asn))
+		binary.BigEndian.PutUint32(rd[4:8], uint32(n))
+	case n <= 0xFFFF:
+		binary.BigEndian.PutUint16(rd[0:2], RDTypeAS4)
+		binary.BigEndian.PutUint32(rd[2:6], uint32(asn))
+		binary.BigEndian.PutUint16(rd[6:8], uint16(n))
+	default:
+		return rd, fmt.Errorf("bgp: invalid route distinguisher %q", s)
+	}
+	return rd, nil
+}
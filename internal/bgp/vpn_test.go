@@ -0,0 +1,117 @@
+package bgp
+
+import "testing"
+
+func TestFormatRD(t *testing.T) {
+	tests := []struct {
+		name string
+		rd   []byte
+		want string
+	}{
+		{"type 0", []byte{0, 0, 0xFD, 0xE8, 0, 0, 0, 100}, "65000:100"},
+		{"type 1", []byte{0, 1, 192, 0, 2, 1, 0, 7}, "192.0.2.1:7"},
+		{"type 2", []byte{0, 2, 0xFA, 0x56, 0xEA, 0, 0, 1}, "4200000000:1"},
+		{"unknown", []byte{0, 9, 1, 2, 3, 4, 5, 6}, "9:010203040506"},
+		{"short", []byte{0, 0, 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatRD(tt.rd); got != tt.want {
+				t.Errorf("FormatRD() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRD(t *testing.T) {
+	for _, s := range []string{"65000:100", "0:4294967295", "192.0.2.1:7", "4200000000:1", "9:010203040506"} {
+		rd, err := ParseRD(s)
+		if err != nil {
+			t.Errorf("ParseRD(%q): unexpected error: %v", s, err)
+			continue
+		}
+		if got := FormatRD(rd[:]); got != s {
+			t.Errorf("ParseRD(%q) = %x, which formats as %q", s, rd, got)
+		}
+	}
+	for _, s := range []string{"", "65000", "x:1", "4200000000:70000", "192.0.2.1:70000", "2:010203040506", "9:01020304050g"} {
+		if _, err := ParseRD(s); err == nil {
+			t.Errorf("ParseRD(%q): expected an error", s)
+		}
+	}
+}
+
+func TestParseUpdate_VPNv4(t *testing.T) {
+	// VPNv4 next hop: zero RD + 192.0.2.1. NLRI: label 24001 (bottom),
+	// RD 65000:100, 10.1.0.0/16; then label 24002, RD 192.0.2.1:7, the
+	// same prefix.
+	mpReach := []byte{0, 1, SAFIMPLSVPN, 12, 0, 0, 0, 0, 0, 0, 0, 0, 192, 0, 2, 1, 0}
+	mpReach = append(mpReach, 24+64+16)
+	mpReach = append(mpReach, labelField(24001, true)...)
+	mpReach = append(mpReach, 0, 0, 0xFD, 0xE8, 0, 0, 0, 100, 10, 1)
+	mpReach = append(mpReach, 24+64+16)
+	mpReach = append(mpReach, labelField(24002, true)...)
+	mpReach = append(mpReach, 0, 1, 192, 0, 2, 1, 0, 7, 10, 1)
+
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x80, AttrTypeMPReachNLRI, mpReach)...)
+	events, err := ParseUpdate(buildBGPUpdate(nil, pathAttrs, nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	for i, want := range []struct {
+		rd    string
+		label uint32
+	}{{"65000:100", 24001}, {"192.0.2.1:7", 24002}} {
+		ev := events[i]
+		if ev.AFI != 4 || ev.SAFI != SAFIMPLSVPN || ev.Prefix != "10.1.0.0/16" {
+			t.Errorf("event %d: unexpected %d/%d %s", i, ev.AFI, ev.SAFI, ev.Prefix)
+		}
+		if ev.RD != want.rd {
+			t.Errorf("event %d: expected RD %s, got %s", i, want.rd, ev.RD)
+		}
+		if len(ev.Labels) != 1 || ev.Labels[0] != want.label {
+			t.Errorf("event %d: expected labels [%d], got %v", i, want.label, ev.Labels)
+		}
+		if ev.Nexthop != "192.0.2.1" {
+			t.Errorf("event %d: expected nexthop 192.0.2.1, got %s", i, ev.Nexthop)
+		}
+	}
+}
+
+func TestParseUpdate_VPNv6Withdrawal(t *testing.T) {
+	// Withdrawal label 0x800000, RD 65000:100, 2001:db8::/32.
+	mpUnreach := []byte{0, 2, SAFIMPLSVPN, 24 + 64 + 32, 0x80, 0, 0,
+		0, 0, 0xFD, 0xE8, 0, 0, 0, 100, 0x20, 0x01, 0x0d, 0xb8}
+	events, err := ParseUpdate(buildBGPUpdate(nil, buildPathAttr(0x80, AttrTypeMPUnreachNLRI, mpUnreach), nil), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	ev := events[0]
+	if ev.Action != "D" || ev.AFI != 6 || ev.RD != "65000:100" || ev.Prefix != "2001:db8::/32" {
+		t.Errorf("unexpected withdrawal: %s %d rd=%s %s", ev.Action, ev.AFI, ev.RD, ev.Prefix)
+	}
+}
+
+func TestVPNNexthop(t *testing.T) {
+	rd := make([]byte, RDLen)
+	v6 := []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	ll := []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+
+	if got, _, _ := mpNexthop(append(append([]byte{}, rd...), v6...), true); got.String() != "2001:db8::1" {
+		t.Errorf("expected 2001:db8::1, got %s", got)
+	}
+	pair := append(append(append(append([]byte{}, rd...), v6...), rd...), ll...)
+	if got, gotLL, _ := mpNexthop(pair, true); got.String() != "2001:db8::1" || gotLL.String() != "fe80::1" {
+		t.Errorf("expected global and link-local address from pair, got %s %s", got, gotLL)
+	}
+	if got, _, _ := mpNexthop([]byte{192, 0, 2, 1}, true); got.IsValid() {
+		t.Errorf("expected no next hop without RD, got %s", got)
+	}
+}
@@ -0,0 +1,177 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+// PeerHeader is the per-peer header of a BMP message (RFC 7854 §4.2).
+// For Loc-RIB (RFC 9069 §4.1) Address and AS are left unset and BGPID is
+// the router's own BGP Identifier.
+type PeerHeader struct {
+	Type      uint8
+	Flags     uint8
+	RD        string     // Peer Distinguisher of a PeerTypeRD peer
+	Address   netip.Addr // IPv4 addresses are sent in the low-order 4 bytes
+	AS        uint32
+	BGPID     netip.Addr
+	Timestamp time.Time // the zero time is sent as 0
+}
+
+// PeerUp holds the body of a Peer Up Notification (RFC 7854 §4.10).
+// Loc-RIB Peer Ups carry only TableName (RFC 9069 §5.2); the session
+// fields are not sent.
+type PeerUp struct {
+	LocalAddress netip.Addr
+	LocalPort    uint16
+	RemotePort   uint16
+	SentOpen     *bgp.OpenMessage
+	ReceivedOpen *bgp.OpenMessage
+	TableName    string
+}
+
+// AppendRouteMonitoring appends a Route Monitoring message carrying the
+// BGP UPDATE update to dst. A Loc-RIB message also carries tableName, if
+// set, in a Table Name TLV.
+func AppendRouteMonitoring(dst []byte, h *PeerHeader, update []byte, tableName string) ([]byte, error) {
+	b, start := beginMessage(dst, MsgTypeRouteMonitoring)
+	b, err := appendPeerHeader(b, h)
+	if err != nil {
+		return dst, err
+	}
+	b = append(b, update...)
+	if h.Type == PeerTypeLocRIB && tableName != "" {
+		b = appendTLV(b, TLVTypeTableName, tableName)
+	}
+	return endMessage(b, start), nil
+}
+
+// AppendPeerUp appends a Peer Up Notification to dst.
+func AppendPeerUp(dst []byte, h *PeerHeader, u *PeerUp) ([]byte, error) {
+	b, start := beginMessage(dst, MsgTypePeerUp)
+	b, err := appendPeerHeader(b, h)
+	if err != nil {
+		return dst, err
+	}
+	if h.Type == PeerTypeLocRIB {
+		if u.TableName != "" {
+			b = appendTLV(b, TLVTypeTableName, u.TableName)
+		}
+		return endMessage(b, start), nil
+	}
+
+	if u.SentOpen == nil || u.ReceivedOpen == nil {
+		return dst, fmt.Errorf("bmp: peer up without sent and received OPEN")
+	}
+	b = appendAddr16(b, u.LocalAddress)
+	b = binary.BigEndian.AppendUint16(b, u.LocalPort)
+	b = binary.BigEndian.AppendUint16(b, u.RemotePort)
+	if b, err = bgp.AppendOpen(b, u.SentOpen); err != nil {
+		return dst, err
+	}
+	if b, err = bgp.AppendOpen(b, u.ReceivedOpen); err != nil {
+		return dst, err
+	}
+	return endMessage(b, start), nil
+}
+
+// AppendPeerDown appends a Peer Down Notification to dst. data follows
+// the reason code as is: the NOTIFICATION for reasons 1 and 3 (see
+// bgp.AppendNotification), the FSM event code for reason 2, and nothing
+// or TLVs otherwise.
+func AppendPeerDown(dst []byte, h *PeerHeader, reason uint8, data []byte) ([]byte, error) {
+	b, start := beginMessage(dst, MsgTypePeerDown)
+	b, err := appendPeerHeader(b, h)
+	if err != nil {
+		return dst, err
+	}
+	b = append(b, reason)
+	b = append(b, data...)
+	return endMessage(b, start), nil
+}
+
+// AppendInitiation appends an Initiation message (RFC 7854 §4.3) with
+// sysName and sysDescr TLVs to dst.
+func AppendInitiation(dst []byte, sysName, sysDescr string) []byte {
+	b, start := beginMessage(dst, MsgTypeInitiation)
+	b = appendTLV(b, TLVTypeSysDescr, sysDescr)
+	b = appendTLV(b, TLVTypeSysName, sysName)
+	return endMessage(b, start)
+}
+
+// AppendTermination appends a Termination message (RFC 7854 §4.5) to dst,
+// with a String TLV if info is set.
+func AppendTermination(dst []byte, reason uint16, info string) []byte {
+	b, start := beginMessage(dst, MsgTypeTermination)
+	if info != "" {
+		b = appendTLV(b, TermTLVTypeString, info)
+	}
+	b = binary.BigEndian.AppendUint16(b, TermTLVTypeReason)
+	b = binary.BigEndian.AppendUint16(b, 2)
+	b = binary.BigEndian.AppendUint16(b, reason)
+	return endMessage(b, start)
+}
+
+// beginMessage appends a common header whose length endMessage fills in,
+// and returns the offset of the message.
+func beginMessage(dst []byte, msgType uint8) ([]byte, int) {
+	return append(dst, BMPVersion, 0, 0, 0, 0, msgType), len(dst)
+}
+
+func endMessage(b []byte, start int) []byte {
+	binary.BigEndian.PutUint32(b[start+1:start+5], uint32(len(b)-start))
+	return b
+}
+
+func appendPeerHeader(b []byte, h *PeerHeader) ([]byte, error) {
+	var rd [bgp.RDLen]byte
+	if h.RD != "" {
+		var err error
+		if rd, err = bgp.ParseRD(h.RD); err != nil {
+			return b, err
+		}
+	}
+	var bgpID [4]byte
+	if h.BGPID.IsValid() {
+		if !h.BGPID.Unmap().Is4() {
+			return b, fmt.Errorf("bmp: peer BGP ID %s is not IPv4", h.BGPID)
+		}
+		bgpID = h.BGPID.Unmap().As4()
+	}
+	var sec, usec uint32
+	if !h.Timestamp.IsZero() {
+		sec, usec = uint32(h.Timestamp.Unix()), uint32(h.Timestamp.Nanosecond()/1000)
+	}
+
+	b = append(b, h.Type, h.Flags)
+	b = append(b, rd[:]...)
+	b = appendAddr16(b, h.Address)
+	b = binary.BigEndian.AppendUint32(b, h.AS)
+	b = append(b, bgpID[:]...)
+	b = binary.BigEndian.AppendUint32(b, sec)
+	return binary.BigEndian.AppendUint32(b, usec), nil
+}
+
+// appendAddr16 appends a 16-byte BMP address field, which holds IPv4
+// addresses in the low-order 4 bytes. An invalid addr is sent as zeros.
+func appendAddr16(b []byte, addr netip.Addr) []byte {
+	var a [16]byte
+	switch addr = addr.Unmap(); {
+	case addr.Is4():
+		v4 := addr.As4()
+		copy(a[12:], v4[:])
+	case addr.Is6():
+		a = addr.As16()
+	}
+	return append(b, a[:]...)
+}
+
+func appendTLV(b []byte, tlvType uint16, value string) []byte {
+	b = binary.BigEndian.AppendUint16(b, tlvType)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
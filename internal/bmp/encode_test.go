@@ -0,0 +1,211 @@
+package bmp
+
+import (
+	"bytes"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+func testUpdate(t *testing.T) ([]byte, []*bgp.RouteEvent) {
+	t.Helper()
+	path, _ := bgp.ParseASPath("64496 64497")
+	events := []*bgp.RouteEvent{
+		{AFI: 4, SAFI: bgp.SAFIUnicast, Prefix: "10.0.0.0/24", Action: "A", Nexthop: "192.0.2.1",
+			Origin: "IGP", ASPath: path.String(), ASPathSegments: path},
+		{AFI: 6, SAFI: bgp.SAFIUnicast, Prefix: "2001:db8::/32", Action: "D"},
+	}
+	update, err := bgp.EncodeUpdate(events, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return update, events
+}
+
+func TestAppendRouteMonitoring_RoundTrip(t *testing.T) {
+	update, events := testUpdate(t)
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+	tests := []struct {
+		name      string
+		h         PeerHeader
+		tableName string
+		want      ParsedBMP
+	}{
+		{
+			name: "IPv4 post-policy peer",
+			h: PeerHeader{Type: PeerTypeGlobal, Flags: PeerFlagPostPolicy, Address: netip.MustParseAddr("192.0.2.2"),
+				AS: 4200000000, BGPID: netip.MustParseAddr("192.0.2.3"), Timestamp: ts},
+			want: ParsedBMP{PeerType: PeerTypeGlobal, PeerFlags: PeerFlagPostPolicy, PeerAddress: "192.0.2.2",
+				PeerAS: 4200000000, PeerBGPID: "192.0.2.3", IsPostPolicy: true, Timestamp: ts, TableName: "UNKNOWN"},
+		},
+		{
+			name: "RD instance peer",
+			h: PeerHeader{Type: PeerTypeRD, Flags: PeerFlagAdjRIBOut, RD: "64496:7", Address: netip.MustParseAddr("2001:db8::2"),
+				AS: 64496, BGPID: netip.MustParseAddr("192.0.2.3")},
+			want: ParsedBMP{PeerType: PeerTypeRD, PeerFlags: PeerFlagAdjRIBOut, PeerRD: "64496:7", PeerAddress: "2001:db8::2",
+				PeerAS: 64496, PeerBGPID: "192.0.2.3", IsAdjRIBOut: true, TableName: "UNKNOWN"},
+		},
+		{
+			name:      "Loc-RIB",
+			h:         PeerHeader{Type: PeerTypeLocRIB, BGPID: netip.MustParseAddr("192.0.2.1")},
+			tableName: "vrf-red",
+			want:      ParsedBMP{PeerType: PeerTypeLocRIB, IsLocRIB: true, TableName: "vrf-red"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := AppendRouteMonitoring(nil, &tt.h, update, tt.tableName)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			parsed, err := ParseAll(msg)
+			if err != nil || len(parsed) != 1 {
+				t.Fatalf("expected 1 message, got %d (error %v)", len(parsed), err)
+			}
+			got := *parsed[0]
+			if !bytes.Equal(got.BGPData, update) {
+				t.Errorf("expected BGP data %x, got %x", update, got.BGPData)
+			}
+			got.BGPData = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v\ngot      %+v", tt.want, got)
+			}
+
+			decoded, err := bgp.ParseUpdate(parsed[0].BGPData, got.HasAddPath)
+			if err != nil || len(decoded) != len(events) || decoded[0].Prefix != events[0].Prefix {
+				t.Errorf("UPDATE did not round-trip: %v (error %v)", decoded, err)
+			}
+		})
+	}
+}
+
+func TestAppendRouteMonitoring_InvalidRD(t *testing.T) {
+	h := &PeerHeader{Type: PeerTypeRD, RD: "x"}
+	if msg, err := AppendRouteMonitoring([]byte{1}, h, nil, ""); err == nil || len(msg) != 1 {
+		t.Errorf("expected an error and dst unchanged, got %x", msg)
+	}
+}
+
+func TestAppendPeerUp_RoundTrip(t *testing.T) {
+	sent := &bgp.OpenMessage{Version: 4, ASN: 4200000000, HoldTime: 90, BGPID: "192.0.2.1",
+		Capabilities: bgp.Capabilities{FourOctetAS: 4200000000,
+			AddPath: []bgp.AddPathFamily{{Family: bgp.AFISAFI{AFI: bgp.AFIIPv4, SAFI: bgp.SAFIUnicast}, Mode: bgp.AddPathBoth}}}}
+	received := &bgp.OpenMessage{Version: 4, ASN: 64497, HoldTime: 180, BGPID: "192.0.2.2",
+		Capabilities: bgp.Capabilities{RouteRefresh: true}}
+	h := &PeerHeader{Type: PeerTypeGlobal, Address: netip.MustParseAddr("192.0.2.2"), AS: 64497,
+		BGPID: netip.MustParseAddr("192.0.2.2")}
+
+	msg, err := AppendPeerUp(nil, h, &PeerUp{LocalAddress: netip.MustParseAddr("2001:db8::1"),
+		LocalPort: 179, RemotePort: 40000, SentOpen: sent, ReceivedOpen: received})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.MsgType != MsgTypePeerUp || got.LocalAddress != "2001:db8::1" || got.LocalPort != 179 || got.RemotePort != 40000 ||
+		got.LocalASN != 4200000000 || got.LocalBGPID != "192.0.2.1" || got.PeerAS != 64497 {
+		t.Errorf("unexpected peer up %+v", got)
+	}
+	if !reflect.DeepEqual(got.SentOpen, sent) || !reflect.DeepEqual(got.ReceivedOpen, received) {
+		t.Errorf("OPENs did not round-trip: %+v, %+v", got.SentOpen, got.ReceivedOpen)
+	}
+
+	if _, err := AppendPeerUp(nil, h, &PeerUp{SentOpen: sent}); err == nil {
+		t.Error("expected an error without a received OPEN")
+	}
+
+	locRIB := &PeerHeader{Type: PeerTypeLocRIB, BGPID: netip.MustParseAddr("192.0.2.1")}
+	if msg, err = AppendPeerUp(nil, locRIB, &PeerUp{TableName: "global"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err = Parse(msg); err != nil || got.TableName != "global" || got.LocalBGPID != "192.0.2.1" {
+		t.Errorf("unexpected Loc-RIB peer up %+v (error %v)", got, err)
+	}
+}
+
+func TestAppendPeerDown_RoundTrip(t *testing.T) {
+	h := &PeerHeader{Type: PeerTypeGlobal, Address: netip.MustParseAddr("192.0.2.2"), AS: 64497}
+	n := bgp.AppendNotification(nil, &bgp.Notification{Code: bgp.NotifCease, Subcode: bgp.CeaseAdministrativeShutdown,
+		ShutdownMessage: "bye"})
+	msg, err := AppendPeerDown(nil, h, PeerDownRemoteNotification, n)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.PeerDownReason != PeerDownRemoteNotification || got.Notification == nil ||
+		got.Notification.ShutdownMessage != "bye" || got.PeerAddress != "192.0.2.2" {
+		t.Errorf("unexpected peer down %+v", got)
+	}
+
+	if msg, err = AppendPeerDown(nil, h, PeerDownLocalNoNotification, []byte{0, 7}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, err = Parse(msg); err != nil || got.FSMEvent != 7 {
+		t.Errorf("expected FSM event 7, got %+v (error %v)", got, err)
+	}
+}
+
+func TestAppendInitiationTermination_RoundTrip(t *testing.T) {
+	msg := AppendInitiation(nil, "r1", "router one")
+	msg = AppendTermination(msg, TermReasonOutOfResources, "full")
+	parsed, err := ParseAll(msg)
+	if err != nil || len(parsed) != 2 {
+		t.Fatalf("expected 2 messages, got %d (error %v)", len(parsed), err)
+	}
+	if parsed[0].SysName != "r1" || parsed[0].SysDescr != "router one" {
+		t.Errorf("unexpected initiation %+v", parsed[0])
+	}
+	if parsed[1].TermReason != TermReasonOutOfResources || parsed[1].TermInfo != "full" {
+		t.Errorf("unexpected termination %+v", parsed[1])
+	}
+}
+
+func TestAppendOpenBMPV17_RoundTrip(t *testing.T) {
+	update, _ := testUpdate(t)
+	bmpMsg, err := AppendRouteMonitoring(nil, &PeerHeader{Type: PeerTypeGlobal, Address: netip.MustParseAddr("192.0.2.2")}, update, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ts := time.Date(2026, 5, 6, 7, 8, 9, 10000, time.UTC)
+
+	for _, routerIP := range []string{"198.51.100.1", "2001:db8::53"} {
+		h := &OpenBMPV17Header{
+			CollectorHash: [16]byte{1},
+			AdminID:       "collector-1",
+			RouterHash:    [16]byte{0xab, 15: 0xcd},
+			RouterIP:      netip.MustParseAddr(routerIP),
+			RouterGroup:   "edge",
+			Timestamp:     ts,
+		}
+		frame := AppendOpenBMPV17(nil, h, bmpMsg)
+
+		payload, err := DecodeOpenBMPFrame(frame, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !bytes.Equal(payload, bmpMsg) {
+			t.Errorf("expected payload %x, got %x", bmpMsg, payload)
+		}
+		if got := RouterIPFromOpenBMPV17(frame); got != routerIP {
+			t.Errorf("expected router IP %s, got %s", routerIP, got)
+		}
+		if got := RouterHashFromOpenBMPV17(frame); got != "ab0000000000000000000000000000cd" {
+			t.Errorf("unexpected router hash %s", got)
+		}
+		if got := TimestampFromOpenBMPV17(frame); !got.Equal(ts) {
+			t.Errorf("expected timestamp %v, got %v", ts, got)
+		}
+		if parsed, err := ParseAll(payload); err != nil || len(parsed) != 1 || !bytes.Equal(parsed[0].BGPData, update) {
+			t.Errorf("BMP message did not round-trip (error %v)", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// parseRouteMirroring handles BMP Route Mirroring messages (RFC 7854 §4.7).
+//
+// Layout after the common header:
+//
+//	Per-Peer Header (42 bytes)
+//	TLVs: Type (2) + Length (2) + Value (variable)
+//
+// Type 0 carries a verbatim BGP PDU and type 1 a 2-byte information code
+// (Errored PDU or Messages Lost). Either may repeat. A truncated TLV ends
+// the scan but keeps the TLVs decoded so far.
+func parseRouteMirroring(data []byte, result *ParsedBMP) (*ParsedBMP, error) {
+	if len(data) < PerPeerHeaderSize {
+		return nil, fmt.Errorf("bmp: route mirroring too short for per-peer header (%d bytes)", len(data))
+	}
+
+	parsePerPeerHeader(data, result)
+
+	offset := PerPeerHeaderSize
+	for offset+4 <= len(data) {
+		tlvType := binary.BigEndian.Uint16(data[offset : offset+2])
+		tlvLen := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		offset += 4
+
+		if offset+tlvLen > len(data) {
+			break
+		}
+		value := data[offset : offset+tlvLen]
+		offset += tlvLen
+
+		switch tlvType {
+		case MirrorTLVTypeBGPMessage:
+			if tlvLen > 0 {
+				result.MirroredPDUs = append(result.MirroredPDUs, value)
+			}
+		case MirrorTLVTypeInformation:
+			if tlvLen >= 2 {
+				result.MirrorInfo = append(result.MirrorInfo, binary.BigEndian.Uint16(value[0:2]))
+			}
+		}
+	}
+
+	return result, nil
+}
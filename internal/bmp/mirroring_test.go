@@ -0,0 +1,99 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// buildBMPRouteMirroring builds a Route Mirroring message with the given
+// TLVs and a global peer at 192.0.2.1 AS65001.
+func buildBMPRouteMirroring(tlvs ...[]byte) []byte {
+	var body []byte
+	for _, tlv := range tlvs {
+		body = append(body, tlv...)
+	}
+	totalLen := CommonHeaderSize + PerPeerHeaderSize + len(body)
+	msg := make([]byte, totalLen)
+	msg[0] = BMPVersion
+	binary.BigEndian.PutUint32(msg[1:5], uint32(totalLen))
+	msg[5] = MsgTypeRouteMirroring
+
+	pph := msg[CommonHeaderSize:]
+	pph[0] = PeerTypeGlobal
+	copy(pph[22:26], []byte{192, 0, 2, 1})
+	binary.BigEndian.PutUint32(pph[26:30], 65001)
+
+	copy(msg[CommonHeaderSize+PerPeerHeaderSize:], body)
+	return msg
+}
+
+func mirrorInfoTLV(code uint16) []byte {
+	v := make([]byte, 2)
+	binary.BigEndian.PutUint16(v, code)
+	return buildStatTLV(MirrorTLVTypeInformation, v)
+}
+
+func TestParseRouteMirroring_ErroredPDU(t *testing.T) {
+	pdu := buildMinimalBGPUpdate()
+	msg := buildBMPRouteMirroring(
+		mirrorInfoTLV(MirrorInfoErroredPDU),
+		buildStatTLV(MirrorTLVTypeBGPMessage, pdu),
+	)
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.MsgType != MsgTypeRouteMirroring {
+		t.Errorf("expected MsgType=%d, got %d", MsgTypeRouteMirroring, parsed.MsgType)
+	}
+	if parsed.PeerAddress != "192.0.2.1" || parsed.PeerAS != 65001 {
+		t.Errorf("unexpected peer %s AS%d", parsed.PeerAddress, parsed.PeerAS)
+	}
+	if len(parsed.MirrorInfo) != 1 || parsed.MirrorInfo[0] != MirrorInfoErroredPDU {
+		t.Errorf("expected errored PDU info, got %v", parsed.MirrorInfo)
+	}
+	if len(parsed.MirroredPDUs) != 1 || string(parsed.MirroredPDUs[0]) != string(pdu) {
+		t.Errorf("expected the mirrored PDU verbatim, got %x", parsed.MirroredPDUs)
+	}
+}
+
+func TestParseRouteMirroring_MessagesLostOnly(t *testing.T) {
+	parsed, err := Parse(buildBMPRouteMirroring(mirrorInfoTLV(MirrorInfoMessagesLost)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.MirroredPDUs) != 0 {
+		t.Errorf("expected no PDUs, got %d", len(parsed.MirroredPDUs))
+	}
+	if len(parsed.MirrorInfo) != 1 || parsed.MirrorInfo[0] != MirrorInfoMessagesLost {
+		t.Errorf("expected messages lost info, got %v", parsed.MirrorInfo)
+	}
+}
+
+func TestParseRouteMirroring_TruncatedTLVKeepsEarlierOnes(t *testing.T) {
+	truncated := buildStatTLV(MirrorTLVTypeBGPMessage, buildMinimalBGPUpdate())
+	msg := buildBMPRouteMirroring(mirrorInfoTLV(MirrorInfoErroredPDU), truncated[:10])
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.MirrorInfo) != 1 {
+		t.Errorf("expected 1 info code, got %d", len(parsed.MirrorInfo))
+	}
+	if len(parsed.MirroredPDUs) != 0 {
+		t.Errorf("expected truncated PDU to be dropped, got %d", len(parsed.MirroredPDUs))
+	}
+}
+
+func TestParseRouteMirroring_TooShort(t *testing.T) {
+	msg := make([]byte, CommonHeaderSize+10)
+	msg[0] = BMPVersion
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(msg)))
+	msg[5] = MsgTypeRouteMirroring
+
+	if _, err := Parse(msg); err == nil {
+		t.Error("expected error for truncated per-peer header")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"net/netip"
+	"time"
 )
 
 const (
@@ -14,6 +16,10 @@ const (
 	// OpenBMP v1.7 binary format (used by goBMP -bmp-raw=true)
 	openBMPV17Magic      = 0x4F424D50 // "OBMP"
 	openBMPV17MinHdrSize = 12         // magic(4) + ver(2) + hdr_len(2) + msg_len(4)
+
+	openBMPV17FlagRouterMessage = 0x80
+	openBMPV17FlagIPv6Router    = 0x40
+	openBMPV17TypeBMPRaw        = 12
 )
 
 // DecodeOpenBMPFrame decodes an OpenBMP frame and extracts the BMP payload.
@@ -121,6 +127,28 @@ func RouterHashFromOpenBMPV17(data []byte) string {
 	return fmt.Sprintf("%x", data[hashOffset:hashOffset+16])
 }
 
+// TimestampFromOpenBMPV17 extracts the collector timestamp (when the
+// collector received the BMP message) from an OpenBMP v1.7 header.
+// Returns the zero time.Time if the data is not v1.7, is too short, or the
+// timestamp is unset.
+//
+//	Offset 14: Timestamp seconds (4 bytes)
+//	Offset 18: Timestamp microseconds (4 bytes)
+func TimestampFromOpenBMPV17(data []byte) time.Time {
+	if len(data) < 22 {
+		return time.Time{}
+	}
+	if binary.BigEndian.Uint32(data[0:4]) != openBMPV17Magic {
+		return time.Time{}
+	}
+	sec := binary.BigEndian.Uint32(data[14:18])
+	usec := binary.BigEndian.Uint32(data[18:22])
+	if sec == 0 && usec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(sec), int64(usec)*int64(time.Microsecond)).UTC()
+}
+
 // RouterIPFromOpenBMPV17 extracts the router IP from an OpenBMP v1.7 header.
 // Returns empty string if the data is not v1.7 or is too short.
 //
@@ -169,3 +197,53 @@ func RouterIPFromOpenBMPV17(data []byte) string {
 	ip := net.IP(ipBytes)
 	return ip.String()
 }
+
+// OpenBMPV17Header holds the collector and router fields of an OpenBMP
+// v1.7 header.
+type OpenBMPV17Header struct {
+	CollectorHash [16]byte
+	AdminID       string // collector admin ID
+	RouterHash    [16]byte
+	RouterIP      netip.Addr
+	RouterGroup   string
+	Timestamp     time.Time // when the collector received the message
+}
+
+// AppendOpenBMPV17 appends an OpenBMP v1.7 BMP_RAW frame carrying the raw
+// BMP message msg to dst, in the layout goBMP produces with
+// -bmp-raw=true.
+func AppendOpenBMPV17(dst []byte, h *OpenBMPV17Header, msg []byte) []byte {
+	flags := uint8(openBMPV17FlagRouterMessage)
+	var routerIP [16]byte
+	switch ip := h.RouterIP.Unmap(); {
+	case ip.Is4():
+		// IPv4 goes in the first 4 bytes; see RouterIPFromOpenBMPV17.
+		v4 := ip.As4()
+		copy(routerIP[:], v4[:])
+	case ip.Is6():
+		flags |= openBMPV17FlagIPv6Router
+		routerIP = ip.As16()
+	}
+	var sec, usec uint32
+	if !h.Timestamp.IsZero() {
+		sec, usec = uint32(h.Timestamp.Unix()), uint32(h.Timestamp.Nanosecond()/1000)
+	}
+
+	start := len(dst)
+	b := binary.BigEndian.AppendUint32(dst, openBMPV17Magic)
+	b = append(b, 1, 7, 0, 0) // version 1.7, header length
+	b = binary.BigEndian.AppendUint32(b, uint32(len(msg)))
+	b = append(b, flags, openBMPV17TypeBMPRaw)
+	b = binary.BigEndian.AppendUint32(b, sec)
+	b = binary.BigEndian.AppendUint32(b, usec)
+	b = append(b, h.CollectorHash[:]...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(h.AdminID)))
+	b = append(b, h.AdminID...)
+	b = append(b, h.RouterHash[:]...)
+	b = append(b, routerIP[:]...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(h.RouterGroup)))
+	b = append(b, h.RouterGroup...)
+	b = binary.BigEndian.AppendUint32(b, 1) // row count
+	binary.BigEndian.PutUint16(b[start+6:start+8], uint16(len(b)-start))
+	return append(b, msg...)
+}
@@ -3,6 +3,7 @@ package bmp
 import (
 	"encoding/binary"
 	"testing"
+	"time"
 )
 
 func buildOpenBMPFrame(version uint16, collectorHash uint32, payload []byte) []byte {
@@ -234,3 +235,24 @@ func TestDecodeOpenBMPFrame_MultipleFrames(t *testing.T) {
 		t.Fatalf("frame 2: expected 2 bytes, got %d", len(bmp2))
 	}
 }
+
+func TestTimestampFromOpenBMPV17(t *testing.T) {
+	frame := buildOpenBMPV17Frame([]byte{0x03})
+	binary.BigEndian.PutUint32(frame[14:18], 1700000000)
+	binary.BigEndian.PutUint32(frame[18:22], 500)
+
+	want := time.Unix(1700000000, 500*int64(time.Microsecond))
+	if got := TimestampFromOpenBMPV17(frame); !got.Equal(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestTimestampFromOpenBMPV17_NotV17(t *testing.T) {
+	frame := buildOpenBMPFrame(2, 0, make([]byte, 32))
+	if got := TimestampFromOpenBMPV17(frame); !got.IsZero() {
+		t.Errorf("expected zero time for v2 frame, got %v", got)
+	}
+	if got := TimestampFromOpenBMPV17(buildOpenBMPV17Frame([]byte{0x03})); !got.IsZero() {
+		t.Errorf("expected zero time for unset timestamp, got %v", got)
+	}
+}
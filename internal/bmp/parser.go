@@ -4,6 +4,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
 )
 
 // ParseAll parses all concatenated BMP messages from raw bytes.
@@ -77,11 +80,13 @@ func Parse(data []byte) (*ParsedBMP, error) {
 		return parsePeerUp(data[CommonHeaderSize:msgLength], result)
 	case MsgTypeInitiation:
 		return parseInitiation(data[CommonHeaderSize:msgLength], result)
+	case MsgTypeStatisticsReport:
+		return parseStatisticsReport(data[CommonHeaderSize:msgLength], result)
 	case MsgTypeTermination:
-		result.MsgType = MsgTypeTermination
-		return result, nil
+		return parseTermination(data[CommonHeaderSize:msgLength], result)
+	case MsgTypeRouteMirroring:
+		return parseRouteMirroring(data[CommonHeaderSize:msgLength], result)
 	default:
-		// Statistics Report (1), Route Mirroring (6) — not needed for Loc-RIB ingestion.
 		return result, nil
 	}
 }
@@ -99,18 +104,7 @@ func parseRouteMonitoring(data []byte, result *ParsedBMP) (*ParsedBMP, error) {
 		return nil, fmt.Errorf("bmp: route monitoring too short for per-peer header (%d bytes)", len(data))
 	}
 
-	result.PeerType = data[0]
-	result.PeerFlags = data[1]
-	result.IsLocRIB = result.PeerType == PeerTypeLocRIB
-	result.HasAddPath = (result.PeerFlags & PeerFlagAddPath) != 0
-
-	// Extract peer identity for non-Loc-RIB peers (types 0/1/2).
-	if !result.IsLocRIB {
-		result.PeerAddress = PeerAddressFromPeerHeader(data)
-		result.PeerAS = PeerASFromPeerHeader(data)
-		result.PeerBGPID = PeerBGPIDFromPeerHeader(data)
-		result.IsPostPolicy = (result.PeerFlags & PeerFlagPostPolicy) != 0
-	}
+	parsePerPeerHeader(data, result)
 
 	// After per-peer header (42 bytes), the BGP message follows.
 	// But for Loc-RIB, we need to extract the BGP UPDATE first, then parse TLVs after.
@@ -157,30 +151,37 @@ func parsePeerDown(data []byte, result *ParsedBMP) (*ParsedBMP, error) {
 		return nil, fmt.Errorf("bmp: peer down too short for per-peer header (%d bytes)", len(data))
 	}
 
-	result.PeerType = data[0]
-	result.PeerFlags = data[1]
-	result.IsLocRIB = result.PeerType == PeerTypeLocRIB
-	result.HasAddPath = (result.PeerFlags & PeerFlagAddPath) != 0
+	parsePerPeerHeader(data, result)
 
-	// Extract peer identity for non-Loc-RIB peers (types 0/1/2).
-	if !result.IsLocRIB {
-		result.PeerAddress = PeerAddressFromPeerHeader(data)
-		result.PeerAS = PeerASFromPeerHeader(data)
-		result.PeerBGPID = PeerBGPIDFromPeerHeader(data)
-		result.IsPostPolicy = (result.PeerFlags & PeerFlagPostPolicy) != 0
+	if len(data) <= 42 {
+		return result, nil
 	}
-
-	if len(data) > 42 {
-		result.PeerDownReason = data[42]
+	result.PeerDownReason = data[42]
+	payload := data[43:]
+
+	// tlvs is what follows the reason-specific data.
+	tlvs := payload
+	switch result.PeerDownReason {
+	case PeerDownLocalNotification, PeerDownRemoteNotification:
+		if n, err := bgp.ParseNotification(payload); err == nil {
+			result.Notification = n
+			tlvs = payload[binary.BigEndian.Uint16(payload[16:18]):]
+		} else {
+			tlvs = nil
+		}
+	case PeerDownLocalNoNotification:
+		if len(payload) >= 2 {
+			result.FSMEvent = binary.BigEndian.Uint16(payload[0:2])
+			tlvs = payload[2:]
+		} else {
+			tlvs = nil
+		}
 	}
-
 	if result.IsLocRIB {
-		// RFC 9069 Section 5: Peer Down for Loc-RIB includes a reason code
-		// byte after the per-peer header, followed by optional TLVs.
-		if len(data) > 43 {
-			tlvData := data[43:]
-			parseTLVs(tlvData, result)
-		}
+		// RFC 9069 Section 5: Peer Down for Loc-RIB includes a reason
+		// code byte after the per-peer header, followed by optional TLVs,
+		// whatever the reason.
+		parseTLVs(tlvs, result)
 	}
 
 	return result, nil
@@ -190,18 +191,7 @@ func parsePeerUp(data []byte, result *ParsedBMP) (*ParsedBMP, error) {
 	if len(data) < PerPeerHeaderSize {
 		return nil, fmt.Errorf("bmp: peer up too short for per-peer header (%d bytes)", len(data))
 	}
-	result.PeerType = data[0]
-	result.PeerFlags = data[1]
-	result.IsLocRIB = result.PeerType == PeerTypeLocRIB
-	result.HasAddPath = (result.PeerFlags & PeerFlagAddPath) != 0
-
-	// Extract peer identity for non-Loc-RIB peers (types 0/1/2).
-	if !result.IsLocRIB {
-		result.PeerAddress = PeerAddressFromPeerHeader(data)
-		result.PeerAS = PeerASFromPeerHeader(data)
-		result.PeerBGPID = PeerBGPIDFromPeerHeader(data)
-		result.IsPostPolicy = (result.PeerFlags & PeerFlagPostPolicy) != 0
-	}
+	parsePerPeerHeader(data, result)
 
 	if result.IsLocRIB {
 		// RFC 9069 Section 4.4: For Loc-RIB Peer Up, the Sent Open and
@@ -212,16 +202,55 @@ func parsePeerUp(data []byte, result *ParsedBMP) (*ParsedBMP, error) {
 	} else {
 		// Non-Loc-RIB Peer Up (RFC 7854 §4.10):
 		//   Per-Peer Header (42) + Local Address (16) + Local Port (2) +
-		//   Remote Port (2) = 62 bytes before the Sent OPEN message.
+		//   Remote Port (2) = 62 bytes before the Sent OPEN message,
+		//   immediately followed by the Received OPEN.
 		const sentOpenOffset = PerPeerHeaderSize + 16 + 2 + 2 // 62
-		if len(data) >= sentOpenOffset+29 {
-			result.LocalASN = extractASNFromBGPOPEN(data[sentOpenOffset:])
-			result.LocalBGPID = extractBGPIDFromBGPOPEN(data[sentOpenOffset:])
+		if len(data) < sentOpenOffset {
+			return result, nil
+		}
+		result.LocalAddress = ipFrom16(data[PerPeerHeaderSize : PerPeerHeaderSize+16])
+		result.LocalPort = binary.BigEndian.Uint16(data[58:60])
+		result.RemotePort = binary.BigEndian.Uint16(data[60:62])
+
+		sent, err := bgp.ParseOpen(data[sentOpenOffset:])
+		if err != nil {
+			return result, nil
+		}
+		result.SentOpen = sent
+		result.LocalASN = sent.ASN
+		result.LocalBGPID = sent.BGPID
+
+		receivedOffset := sentOpenOffset + int(binary.BigEndian.Uint16(data[sentOpenOffset+16:sentOpenOffset+18]))
+		if received, err := bgp.ParseOpen(data[receivedOffset:]); err == nil {
+			result.ReceivedOpen = received
 		}
 	}
 	return result, nil
 }
 
+// parsePerPeerHeader populates the peer fields of result from a 42-byte
+// per-peer header (RFC 7854 §4.2). Callers must check the length first.
+func parsePerPeerHeader(data []byte, result *ParsedBMP) {
+	result.PeerType = data[0]
+	result.PeerFlags = data[1]
+	result.IsLocRIB = result.PeerType == PeerTypeLocRIB
+	result.HasAddPath = (result.PeerFlags & PeerFlagAddPath) != 0
+	result.Timestamp = TimestampFromPeerHeader(data)
+
+	// Extract peer identity for non-Loc-RIB peers (types 0/1/2).
+	if !result.IsLocRIB {
+		result.PeerAddress = PeerAddressFromPeerHeader(data)
+		if result.PeerType == PeerTypeRD {
+			result.PeerRD = bgp.FormatRD(data[2:10])
+		}
+		result.PeerAS = PeerASFromPeerHeader(data)
+		result.PeerBGPID = PeerBGPIDFromPeerHeader(data)
+		result.IsPostPolicy = (result.PeerFlags & PeerFlagPostPolicy) != 0
+		result.IsAdjRIBOut = (result.PeerFlags & PeerFlagAdjRIBOut) != 0
+		result.IsLegacyASPath = (result.PeerFlags & PeerFlagLegacyASPath) != 0
+	}
+}
+
 // bgpMessageLength reads the length field from a BGP message header.
 // BGP header: marker(16) + length(2) + type(1) = 19 bytes minimum.
 func bgpMessageLength(data []byte) (int, error) {
@@ -272,121 +301,20 @@ func parseTLVs(data []byte, result *ParsedBMP) {
 	}
 }
 
-// extractASNFromBGPOPEN parses a BGP OPEN message and returns the router's ASN.
-// Input: raw BGP OPEN bytes starting at the 16-byte marker.
-// Returns 0 if the data is malformed or too short.
-//
-// BGP OPEN layout (RFC 4271 §4.2):
-//
-//	Offset  0: Marker (16 bytes, all 0xFF)
-//	Offset 16: Length (2 bytes)
-//	Offset 18: Type (1 byte, must be 1 for OPEN)
-//	Offset 19: Version (1 byte)
-//	Offset 20: My Autonomous System (2 bytes)
-//	Offset 22: Hold Time (2 bytes)
-//	Offset 24: BGP Identifier (4 bytes)
-//	Offset 28: Opt Parm Len (1 byte)
-//	Offset 29: Optional Parameters (variable)
-func extractASNFromBGPOPEN(data []byte) uint32 {
-	// Need at least 29 bytes: marker(16) + length(2) + type(1) + version(1) +
-	// my_as(2) + hold_time(2) + bgp_id(4) + opt_parm_len(1)
-	if len(data) < 29 {
-		return 0
-	}
-	// Validate BGP marker (16 bytes of 0xFF).
-	for i := 0; i < 16; i++ {
-		if data[i] != 0xFF {
-			return 0
-		}
-	}
-	// Type must be 1 (OPEN).
-	if data[18] != 1 {
-		return 0
-	}
-
-	msgLen := int(binary.BigEndian.Uint16(data[16:18]))
-	if msgLen < 29 || msgLen > len(data) {
-		return 0
-	}
-
-	asn := uint32(binary.BigEndian.Uint16(data[20:22]))
-
-	// If 2-byte ASN is AS_TRANS (23456), look for 4-byte ASN capability.
-	if asn == 23456 {
-		optParmLen := int(data[28])
-		if optParmLen > 0 && 29+optParmLen <= msgLen {
-			if as4 := find4ByteASNCapability(data[29 : 29+optParmLen]); as4 != 0 {
-				return as4
-			}
-		}
-	}
-
-	return asn
-}
-
-// extractBGPIDFromBGPOPEN parses a BGP OPEN message and returns the BGP
-// Identifier as a dotted-quad string. This identifies the BMP speaker when
-// extracted from the Sent OPEN in a Peer Up message.
-// Returns empty string if the data is malformed or too short.
-func extractBGPIDFromBGPOPEN(data []byte) string {
-	if len(data) < 28 {
-		return ""
-	}
-	for i := 0; i < 16; i++ {
-		if data[i] != 0xFF {
-			return ""
+// ipFrom16 formats a 16-byte BMP address field, which holds IPv4
+// addresses in the low-order 4 bytes.
+func ipFrom16(addr []byte) string {
+	isV4 := true
+	for _, b := range addr[:12] {
+		if b != 0 {
+			isV4 = false
+			break
 		}
 	}
-	if data[18] != 1 {
-		return ""
-	}
-	return net.IP(data[24:28]).String()
-}
-
-// find4ByteASNCapability scans BGP Optional Parameters for the 4-byte ASN
-// capability (RFC 6793, Capability Code 65). Returns the 4-byte ASN value
-// or 0 if not found.
-//
-// Optional Parameters layout (RFC 5492):
-//
-//	Each parameter: Type(1) + Length(1) + Value(variable)
-//	Type 2 = Capabilities: Value contains one or more capabilities
-//	Each capability: Code(1) + Length(1) + Value(variable)
-//	Code 65, Length 4 = 4-byte ASN capability
-func find4ByteASNCapability(optParams []byte) uint32 {
-	offset := 0
-	for offset+2 <= len(optParams) {
-		paramType := optParams[offset]
-		paramLen := int(optParams[offset+1])
-		offset += 2
-
-		if offset+paramLen > len(optParams) {
-			return 0
-		}
-
-		if paramType == 2 { // Capabilities parameter
-			capData := optParams[offset : offset+paramLen]
-			capOffset := 0
-			for capOffset+2 <= len(capData) {
-				capCode := capData[capOffset]
-				capLen := int(capData[capOffset+1])
-				capOffset += 2
-
-				if capOffset+capLen > len(capData) {
-					break
-				}
-
-				if capCode == 65 && capLen == 4 {
-					return binary.BigEndian.Uint32(capData[capOffset : capOffset+4])
-				}
-
-				capOffset += capLen
-			}
-		}
-
-		offset += paramLen
+	if isV4 {
+		return net.IP(addr[12:16]).String()
 	}
-	return 0
+	return net.IP(addr).String()
 }
 
 // PeerAddressFromPeerHeader extracts the Peer Address from a BMP per-peer header.
@@ -447,6 +375,22 @@ func PeerBGPIDFromPeerHeader(data []byte) string {
 	return net.IP(bgpID).String()
 }
 
+// TimestampFromPeerHeader extracts the router's timestamp (seconds at offset
+// 34, microseconds at offset 38) from a BMP per-peer header. RFC 7854 §4.2
+// allows a zero timestamp when the router has none; that is returned as the
+// zero time.Time.
+func TimestampFromPeerHeader(data []byte) time.Time {
+	if len(data) < PerPeerHeaderSize {
+		return time.Time{}
+	}
+	sec := binary.BigEndian.Uint32(data[34:38])
+	usec := binary.BigEndian.Uint32(data[38:42])
+	if sec == 0 && usec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(sec), int64(usec)*int64(time.Microsecond)).UTC()
+}
+
 // RouterIDFromPeerHeader extracts the router identifier from a BMP per-peer header.
 //
 // Per-peer header layout (RFC 7854 Section 4.2):
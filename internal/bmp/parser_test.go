@@ -3,7 +3,11 @@ package bmp
 import (
 	"encoding/binary"
 	"net"
+	"net/netip"
 	"testing"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
 )
 
 // buildBMPRouteMonitoring builds a minimal BMP Route Monitoring message with the given peer type.
@@ -571,6 +575,39 @@ func TestParsePeerDown_LocRIB_TableNameTLV(t *testing.T) {
 	}
 }
 
+func TestParsePeerDown_LocRIB_TableNameTLVAfterReasonData(t *testing.T) {
+	// The TLVs of a Loc-RIB Peer Down follow the NOTIFICATION or FSM event
+	// code of reasons 1 to 3.
+	h := &PeerHeader{Type: PeerTypeLocRIB, BGPID: netip.MustParseAddr("192.0.2.1")}
+	tlv := appendTLV(nil, TLVTypeTableName, "vrf-red")
+	notif := bgp.AppendNotification(nil, &bgp.Notification{Code: bgp.NotifCease, Subcode: bgp.CeaseAdministrativeReset})
+
+	for _, tt := range []struct {
+		reason uint8
+		data   []byte
+	}{
+		{PeerDownLocalNotification, notif},
+		{PeerDownLocalNoNotification, []byte{0, 2}},
+		{PeerDownRemoteNotification, notif},
+		{PeerDownRemoteNoNotification, nil},
+	} {
+		msg, err := AppendPeerDown(nil, h, tt.reason, append(append([]byte{}, tt.data...), tlv...))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		parsed, err := Parse(msg)
+		if err != nil {
+			t.Fatalf("reason %d: unexpected error: %v", tt.reason, err)
+		}
+		if parsed.TableName != "vrf-red" {
+			t.Errorf("reason %d: expected TableName='vrf-red', got '%s'", tt.reason, parsed.TableName)
+		}
+		if len(tt.data) > 2 && (parsed.Notification == nil || parsed.Notification.Subcode != bgp.CeaseAdministrativeReset) {
+			t.Errorf("reason %d: expected the NOTIFICATION, got %+v", tt.reason, parsed.Notification)
+		}
+	}
+}
+
 // --- Stream 3: PeerUp tests ---
 
 func TestParsePeerUp_LocRIB(t *testing.T) {
@@ -836,6 +873,74 @@ func TestParsePeerDown_NoReasonByte(t *testing.T) {
 	}
 }
 
+// buildBMPPeerDown builds a Global-peer Peer Down with the given reason
+// code and reason-specific payload.
+func buildBMPPeerDown(reason uint8, payload []byte) []byte {
+	totalLen := CommonHeaderSize + PerPeerHeaderSize + 1 + len(payload)
+	msg := make([]byte, totalLen)
+	msg[0] = BMPVersion
+	binary.BigEndian.PutUint32(msg[1:5], uint32(totalLen))
+	msg[5] = MsgTypePeerDown
+	msg[6] = PeerTypeGlobal
+	msg[48] = reason
+	copy(msg[49:], payload)
+	return msg
+}
+
+func TestParsePeerDown_Notification(t *testing.T) {
+	text := "upgrading to 24.1"
+	notif := make([]byte, 21, 22+len(text))
+	for i := 0; i < 16; i++ {
+		notif[i] = 0xFF
+	}
+	notif[18] = 3 // NOTIFICATION
+	notif[19] = 6 // Cease
+	notif[20] = 2 // Administrative Shutdown
+	notif = append(notif, byte(len(text)))
+	notif = append(notif, text...)
+	binary.BigEndian.PutUint16(notif[16:18], uint16(len(notif)))
+
+	parsed, err := Parse(buildBMPPeerDown(PeerDownRemoteNotification, notif))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.Notification == nil {
+		t.Fatal("expected NOTIFICATION to be decoded")
+	}
+	if parsed.Notification.CodeName() != "cease" || parsed.Notification.SubcodeName() != "administrative_shutdown" {
+		t.Errorf("unexpected notification %s/%s", parsed.Notification.CodeName(), parsed.Notification.SubcodeName())
+	}
+	if parsed.Notification.ShutdownMessage != text {
+		t.Errorf("expected shutdown message %q, got %q", text, parsed.Notification.ShutdownMessage)
+	}
+}
+
+func TestParsePeerDown_MalformedNotification(t *testing.T) {
+	parsed, err := Parse(buildBMPPeerDown(PeerDownLocalNotification, []byte{0xFF, 0xFF}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.PeerDownReason != PeerDownLocalNotification {
+		t.Errorf("expected reason %d, got %d", PeerDownLocalNotification, parsed.PeerDownReason)
+	}
+	if parsed.Notification != nil {
+		t.Errorf("expected no notification, got %+v", parsed.Notification)
+	}
+}
+
+func TestParsePeerDown_FSMEvent(t *testing.T) {
+	parsed, err := Parse(buildBMPPeerDown(PeerDownLocalNoNotification, []byte{0x00, 0x12}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.FSMEvent != 18 {
+		t.Errorf("expected FSMEvent=18, got %d", parsed.FSMEvent)
+	}
+	if PeerDownReasonName(parsed.PeerDownReason) != "local_no_notification" {
+		t.Errorf("unexpected reason name %q", PeerDownReasonName(parsed.PeerDownReason))
+	}
+}
+
 // --- Peer Up ASN extraction tests ---
 
 // buildBGPOPEN constructs a valid BGP OPEN message with configurable ASN.
@@ -980,6 +1085,31 @@ func TestParsePeerUp_NonLocRIB_PreservesFields(t *testing.T) {
 	}
 }
 
+func TestParsePeerUp_NonLocRIB_SessionFields(t *testing.T) {
+	msg := buildBMPPeerUp(PeerTypeGlobal, 400000, true)
+	// Local Address 192.0.2.1 in the low-order 4 bytes.
+	localAddr := CommonHeaderSize + PerPeerHeaderSize
+	copy(msg[localAddr+12:localAddr+16], []byte{192, 0, 2, 1})
+	binary.BigEndian.PutUint16(msg[localAddr+18:localAddr+20], 50123) // remote port
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.LocalAddress != "192.0.2.1" {
+		t.Errorf("expected LocalAddress 192.0.2.1, got %q", parsed.LocalAddress)
+	}
+	if parsed.LocalPort != 179 || parsed.RemotePort != 50123 {
+		t.Errorf("expected ports 179/50123, got %d/%d", parsed.LocalPort, parsed.RemotePort)
+	}
+	if parsed.SentOpen == nil || parsed.SentOpen.ASN != 400000 || parsed.SentOpen.HoldTime != 180 {
+		t.Errorf("unexpected Sent OPEN: %+v", parsed.SentOpen)
+	}
+	if parsed.ReceivedOpen == nil || parsed.ReceivedOpen.ASN != 65002 {
+		t.Errorf("unexpected Received OPEN: %+v", parsed.ReceivedOpen)
+	}
+}
+
 func TestParsePeerUp_LocRIB_NoASN(t *testing.T) {
 	msg := buildBMPPeerUp(PeerTypeLocRIB, 0, false)
 
@@ -1172,6 +1302,42 @@ func TestPeerBGPIDFromPeerHeader_TooShort(t *testing.T) {
 	}
 }
 
+func TestTimestampFromPeerHeader(t *testing.T) {
+	hdr := make([]byte, PerPeerHeaderSize)
+	binary.BigEndian.PutUint32(hdr[34:38], 1700000000)
+	binary.BigEndian.PutUint32(hdr[38:42], 250000)
+
+	want := time.Unix(1700000000, 250000*int64(time.Microsecond))
+	if got := TimestampFromPeerHeader(hdr); !got.Equal(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestTimestampFromPeerHeader_ZeroAndTooShort(t *testing.T) {
+	if got := TimestampFromPeerHeader(make([]byte, PerPeerHeaderSize)); !got.IsZero() {
+		t.Errorf("expected zero time for zero timestamp, got %v", got)
+	}
+	if got := TimestampFromPeerHeader([]byte{0, 0, 0}); !got.IsZero() {
+		t.Errorf("expected zero time for short data, got %v", got)
+	}
+}
+
+func TestParse_RouteMonitoringTimestamp(t *testing.T) {
+	msg := buildBMPRouteMonitoring(PeerTypeLocRIB, buildMinimalBGPUpdate())
+	// Per-peer header timestamps at common header (6) + 34.
+	binary.BigEndian.PutUint32(msg[40:44], 1700000000)
+	binary.BigEndian.PutUint32(msg[44:48], 1)
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := time.Unix(1700000000, int64(time.Microsecond))
+	if !parsed.Timestamp.Equal(want) {
+		t.Errorf("expected Timestamp %v, got %v", want, parsed.Timestamp)
+	}
+}
+
 func TestIsPostPolicy_Flag(t *testing.T) {
 	bgp := buildMinimalBGPUpdate()
 
@@ -1197,6 +1363,33 @@ func TestIsPostPolicy_Flag(t *testing.T) {
 	}
 }
 
+func TestIsAdjRIBOut_Flag(t *testing.T) {
+	bgp := buildMinimalBGPUpdate()
+
+	// Adj-RIB-In (O=0)
+	parsedIn, err := Parse(buildBMPRouteMonitoring(PeerTypeGlobal, bgp))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsedIn.IsAdjRIBOut {
+		t.Error("expected IsAdjRIBOut=false when O flag not set")
+	}
+
+	// Post-policy Adj-RIB-Out (O=1, L=1)
+	bmpOut := buildBMPRouteMonitoring(PeerTypeGlobal, bgp)
+	bmpOut[7] = PeerFlagAdjRIBOut | PeerFlagPostPolicy
+	parsedOut, err := Parse(bmpOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !parsedOut.IsAdjRIBOut {
+		t.Error("expected IsAdjRIBOut=true when O flag is set")
+	}
+	if !parsedOut.IsPostPolicy {
+		t.Error("expected IsPostPolicy=true alongside O flag")
+	}
+}
+
 func TestParse_NonLocRIB_PeerFieldsExtracted(t *testing.T) {
 	bgp := buildMinimalBGPUpdate()
 	bmpMsg := buildBMPRouteMonitoring(PeerTypeGlobal, bgp)
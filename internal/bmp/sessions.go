@@ -0,0 +1,104 @@
+package bmp
+
+import (
+	"strings"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+// PeerSessions remembers the BGP session negotiated in each monitored
+// peer's Peer Up, so later Route Monitoring messages for that peer can be
+// decoded with the Add-Path state actually in effect. Entries are keyed by
+// the speaker's router hash (OpenBMP header, or the listener connection),
+// the peer distinguisher of RD instance peers, whose addresses may repeat
+// across VRFs, and the peer address. Not safe for concurrent use.
+type PeerSessions map[string]*bgp.Session
+
+func peerSessionKey(routerHash string, parsed *ParsedBMP) string {
+	if parsed.PeerRD != "" {
+		return routerHash + "/" + parsed.PeerRD + "/" + parsed.PeerAddress
+	}
+	return routerHash + "/" + parsed.PeerAddress
+}
+
+// Learn records the session from a non-Loc-RIB Peer Up. Peer Ups without
+// both OPENs, or without a router hash to key on, are ignored.
+func (s PeerSessions) Learn(routerHash string, parsed *ParsedBMP) *bgp.Session {
+	if parsed.SentOpen == nil || parsed.ReceivedOpen == nil {
+		return nil
+	}
+	sess := bgp.Negotiate(parsed.SentOpen, parsed.ReceivedOpen)
+	if routerHash != "" {
+		s[peerSessionKey(routerHash, parsed)] = sess
+	}
+	return sess
+}
+
+// Forget drops the session of a peer that went down.
+func (s PeerSessions) Forget(routerHash string, parsed *ParsedBMP) {
+	delete(s, peerSessionKey(routerHash, parsed))
+}
+
+// ForgetRouter drops every session learned under routerHash, for a BMP
+// Termination.
+func (s PeerSessions) ForgetRouter(routerHash string) {
+	if routerHash == "" {
+		return
+	}
+	prefix := routerHash + "/"
+	for k := range s {
+		if strings.HasPrefix(k, prefix) {
+			delete(s, k)
+		}
+	}
+}
+
+// DecodeUpdate decodes the BGP UPDATE of a Route Monitoring message. Adj-RIB
+// messages use the Add-Path, Extended Next Hop and 4-octet AS state
+// negotiated in the peer's Peer Up. Without it (Loc-RIB, or the Peer Up was
+// never seen) ASN width comes from the A flag or is detected from the
+// AS_PATH, and DecodeUpdateAutoDetect covers routers that send Add-Path NLRI
+// without setting the F-bit (e.g. Arista cEOS). The returned bool is the Add-Path
+// setting auto-detection settled on, or parsed.HasAddPath when the
+// negotiated state was used. Routes of an RD instance peer, which belong
+// to its VRF, carry the peer distinguisher as their RD.
+func (s PeerSessions) DecodeUpdate(routerHash string, parsed *ParsedBMP) ([]bgp.Route, bool, error) {
+	routes, hasAddPath, err := s.decodeUpdate(routerHash, parsed)
+	if parsed.PeerRD != "" {
+		for i := range routes {
+			if routes[i].RD == "" {
+				routes[i].RD = parsed.PeerRD
+			}
+		}
+	}
+	return routes, hasAddPath, err
+}
+
+func (s PeerSessions) decodeUpdate(routerHash string, parsed *ParsedBMP) ([]bgp.Route, bool, error) {
+	if !parsed.IsLocRIB && routerHash != "" {
+		if sess, ok := s[peerSessionKey(routerHash, parsed)]; ok {
+			routes, err := bgp.DecodeUpdateSession(parsed.BGPData, sess, parsed.IsAdjRIBOut)
+			return routes, parsed.HasAddPath, err
+		}
+	}
+	asnWidth := bgp.ASNWidthAuto
+	if parsed.IsLegacyASPath {
+		asnWidth = bgp.ASNWidth2
+	}
+	return bgp.DecodeUpdateAutoDetect(parsed.BGPData, parsed.HasAddPath, asnWidth)
+}
+
+// LeakSuspected reports whether an Adj-RIB-In route violates the RFC 9234
+// OTC ingress rules for the peer's negotiated session. Loc-RIB and
+// Adj-RIB-Out routes, and peers whose Peer Up was not seen, are never
+// flagged.
+func (s PeerSessions) LeakSuspected(routerHash string, parsed *ParsedBMP, rt *bgp.Route) bool {
+	if parsed.IsLocRIB || parsed.IsAdjRIBOut || rt.Action != "A" {
+		return false
+	}
+	var otc *uint32
+	if rt.Attrs.Has(bgp.AttrTypeOTC) {
+		otc = &rt.Attrs.OTC
+	}
+	return s[peerSessionKey(routerHash, parsed)].OTCLeak(otc, parsed.PeerAS)
+}
@@ -0,0 +1,242 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+// buildIPv4NLRIUpdate builds a BGP UPDATE announcing 10.0.0.0/24 with no
+// Path Identifier and no path attributes.
+func buildIPv4NLRIUpdate() []byte {
+	nlri := []byte{24, 10, 0, 0}
+	msg := make([]byte, 23+len(nlri))
+	for i := 0; i < 16; i++ {
+		msg[i] = 0xFF
+	}
+	binary.BigEndian.PutUint16(msg[16:18], uint16(len(msg)))
+	msg[18] = 2 // UPDATE
+	copy(msg[23:], nlri)
+	return msg
+}
+
+func TestPeerSessions_DecodeUpdateUsesNegotiatedAddPath(t *testing.T) {
+	const routerHash = "abc"
+
+	peerUp, err := Parse(buildBMPPeerUp(PeerTypeGlobal, 65001, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The V flag (IPv6 peer) shares bit 0x80 with the Loc-RIB F-bit, so an
+	// IPv6 Adj-RIB-In peer looks like Add-Path to the per-peer header.
+	rmMsg := buildBMPRouteMonitoring(PeerTypeGlobal, buildIPv4NLRIUpdate())
+	rmMsg[CommonHeaderSize+1] = 0x80
+	rm, err := Parse(rmMsg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sessions := make(PeerSessions)
+	if sess := sessions.Learn(routerHash, peerUp); sess == nil {
+		t.Fatal("expected a negotiated session from Peer Up")
+	}
+
+	routes, _, err := sessions.DecodeUpdate(routerHash, rm)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(routes) != 1 || routes[0].Prefix.String() != "10.0.0.0/24" || routes[0].PathID != 0 {
+		t.Fatalf("expected 10.0.0.0/24 without path ID, got %+v", routes)
+	}
+
+	// Once the peer is gone the per-peer header is all there is.
+	sessions.Forget(routerHash, rm)
+	routes, _, _ = sessions.DecodeUpdate(routerHash, rm)
+	if len(routes) != 0 {
+		t.Errorf("expected the F-bit guess to yield no routes, got %d", len(routes))
+	}
+}
+
+func TestPeerSessions_LearnRequiresBothOpens(t *testing.T) {
+	msg := buildBMPPeerUp(PeerTypeGlobal, 65001, false)
+	msg = msg[:len(msg)-5] // truncate the Received OPEN
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(msg)))
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.SentOpen == nil {
+		t.Fatal("expected Sent OPEN to decode")
+	}
+	if parsed.ReceivedOpen != nil {
+		t.Fatal("expected truncated Received OPEN to be rejected")
+	}
+
+	sessions := make(PeerSessions)
+	if sess := sessions.Learn("abc", parsed); sess != nil || len(sessions) != 0 {
+		t.Errorf("expected no session without both OPENs, got %+v", sess)
+	}
+}
+
+func TestPeerSessions_ForgetRouter(t *testing.T) {
+	peerUp, err := Parse(buildBMPPeerUp(PeerTypeGlobal, 65001, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sessions := make(PeerSessions)
+	sessions.Learn("r1", peerUp)
+	sessions.Learn("r2", peerUp)
+	sessions.ForgetRouter("r1")
+
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 remaining session, got %d", len(sessions))
+	}
+	if _, ok := sessions[peerSessionKey("r2", peerUp)]; !ok {
+		t.Error("expected r2's session to survive")
+	}
+}
+
+func TestPeerSessions_DecodeUpdateLegacyASPathFlag(t *testing.T) {
+	// AS_PATH {65001 65002} {65003} in 2-octet form, which also parses
+	// exactly as a single 4-octet segment.
+	asPath := []byte{2, 2, 0xFD, 0xE9, 0xFD, 0xEA, 1, 1, 0xFD, 0xEB}
+	attr := []byte{0x40, 1, 1, 0} // ORIGIN IGP
+	attr = append(attr, 0x40, 2, byte(len(asPath)))
+	attr = append(attr, asPath...)
+	attr = append(attr, 0x40, 3, 4, 192, 0, 2, 1) // NEXT_HOP
+	nlri := []byte{24, 10, 0, 0}
+
+	update := make([]byte, 23, 23+len(attr)+len(nlri))
+	for i := 0; i < 16; i++ {
+		update[i] = 0xFF
+	}
+	update[18] = 2 // UPDATE
+	binary.BigEndian.PutUint16(update[21:23], uint16(len(attr)))
+	update = append(update, attr...)
+	update = append(update, nlri...)
+	binary.BigEndian.PutUint16(update[16:18], uint16(len(update)))
+
+	tests := []struct {
+		name  string
+		flags uint8
+		want  string
+	}{
+		{"A flag set", PeerFlagLegacyASPath, "65001 65002 {65003}"},
+		{"A flag clear", 0, "4259970538 16907755"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := buildBMPRouteMonitoring(PeerTypeGlobal, update)
+			msg[CommonHeaderSize+1] = tt.flags
+			parsed, err := Parse(msg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if parsed.IsLegacyASPath != (tt.flags != 0) {
+				t.Errorf("expected IsLegacyASPath=%v", tt.flags != 0)
+			}
+
+			routes, _, err := make(PeerSessions).DecodeUpdate("abc", parsed)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(routes) != 1 {
+				t.Fatalf("expected 1 route, got %d", len(routes))
+			}
+			if got := string(routes[0].Attrs.AppendASPath(nil)); got != tt.want {
+				t.Errorf("expected AS path %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPeerSessions_LeakSuspected(t *testing.T) {
+	const routerHash = "abc"
+	rt := &bgp.Route{Action: "A", Attrs: otcAttrs(t, 65010)}
+	parsed := &ParsedBMP{PeerAddress: "192.0.2.1", PeerAS: 65002}
+
+	sessions := make(PeerSessions)
+	if sessions.LeakSuspected(routerHash, parsed, rt) {
+		t.Error("expected no leak without a learned session")
+	}
+
+	sessions[peerSessionKey(routerHash, parsed)] = &bgp.Session{HasRole: true, Role: bgp.RoleProvider}
+	if !sessions.LeakSuspected(routerHash, parsed, rt) {
+		t.Error("expected OTC from a customer to be a leak")
+	}
+
+	out := *parsed
+	out.IsAdjRIBOut = true
+	if sessions.LeakSuspected(routerHash, &out, rt) {
+		t.Error("expected Adj-RIB-Out routes not to be evaluated")
+	}
+	if sessions.LeakSuspected(routerHash, parsed, &bgp.Route{Action: "D"}) {
+		t.Error("expected withdraws not to be evaluated")
+	}
+}
+
+func TestPeerSessions_RDInstancePeer(t *testing.T) {
+	const routerHash = "abc"
+	rd := []byte{0, 0, 0xFD, 0xE8, 0, 0, 0, 100} // type 0, 65000:100
+
+	peerUpMsg := buildBMPPeerUp(PeerTypeRD, 65001, false)
+	copy(peerUpMsg[CommonHeaderSize+2:], rd)
+	peerUp, err := Parse(peerUpMsg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peerUp.PeerRD != "65000:100" {
+		t.Fatalf("expected peer RD 65000:100, got %q", peerUp.PeerRD)
+	}
+
+	rmMsg := buildBMPRouteMonitoring(PeerTypeRD, buildIPv4NLRIUpdate())
+	copy(rmMsg[CommonHeaderSize+2:], rd)
+	rm, err := Parse(rmMsg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A global peer with the same address is a different session.
+	global, err := Parse(buildBMPPeerUp(PeerTypeGlobal, 65001, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sessions := make(PeerSessions)
+	sessions.Learn(routerHash, peerUp)
+	sessions.Learn(routerHash, global)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	routes, _, err := sessions.DecodeUpdate(routerHash, rm)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(routes) != 1 || routes[0].RD != "65000:100" {
+		t.Fatalf("expected 1 route in RD 65000:100, got %+v", routes)
+	}
+
+	sessions.Forget(routerHash, rm)
+	if _, ok := sessions[peerSessionKey(routerHash, global)]; !ok || len(sessions) != 1 {
+		t.Error("expected only the global peer's session to survive")
+	}
+}
+
+// otcAttrs returns the path attributes of an UPDATE carrying the OTC
+// attribute otc.
+func otcAttrs(t *testing.T, otc uint32) *bgp.UpdateAttrs {
+	t.Helper()
+	update, err := bgp.EncodeUpdate([]*bgp.RouteEvent{{AFI: 4, SAFI: bgp.SAFIUnicast, Prefix: "10.0.0.0/24",
+		Action: "A", Nexthop: "192.0.2.1", Origin: "IGP", OTC: &otc}}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var d bgp.Decoder
+	if err := d.Decode(update); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return &d.Attrs
+}
@@ -0,0 +1,58 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// parseStatisticsReport handles BMP Statistics Report messages (RFC 7854 §4.8).
+//
+// Layout after the common header:
+//
+//	Per-Peer Header (42 bytes)
+//	Stats Count (4 bytes)
+//	Stat TLVs: Type (2) + Length (2) + Value (variable)
+//
+// Values are decoded by length: 4 bytes is a 32-bit counter, 8 bytes is a
+// 64-bit gauge, and 11 bytes is AFI (2) + SAFI (1) + 64-bit gauge. TLVs with
+// any other length are skipped. A truncated TLV ends the scan but keeps the
+// stats decoded so far.
+func parseStatisticsReport(data []byte, result *ParsedBMP) (*ParsedBMP, error) {
+	if len(data) < PerPeerHeaderSize+4 {
+		return nil, fmt.Errorf("bmp: statistics report too short (%d bytes)", len(data))
+	}
+
+	parsePerPeerHeader(data, result)
+
+	count := binary.BigEndian.Uint32(data[PerPeerHeaderSize : PerPeerHeaderSize+4])
+	offset := PerPeerHeaderSize + 4
+
+	for i := uint32(0); i < count && offset+4 <= len(data); i++ {
+		statType := binary.BigEndian.Uint16(data[offset : offset+2])
+		statLen := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		offset += 4
+
+		if offset+statLen > len(data) {
+			break
+		}
+		value := data[offset : offset+statLen]
+		offset += statLen
+
+		stat := Stat{Type: statType}
+		switch statLen {
+		case 4:
+			stat.Value = uint64(binary.BigEndian.Uint32(value))
+		case 8:
+			stat.Value = binary.BigEndian.Uint64(value)
+		case 11:
+			stat.AFI = binary.BigEndian.Uint16(value[0:2])
+			stat.SAFI = value[2]
+			stat.Value = binary.BigEndian.Uint64(value[3:11])
+		default:
+			continue
+		}
+		result.Stats = append(result.Stats, stat)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,150 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// buildStatTLV builds a single Statistics Report TLV.
+func buildStatTLV(statType uint16, value []byte) []byte {
+	tlv := make([]byte, 4+len(value))
+	binary.BigEndian.PutUint16(tlv[0:2], statType)
+	binary.BigEndian.PutUint16(tlv[2:4], uint16(len(value)))
+	copy(tlv[4:], value)
+	return tlv
+}
+
+// buildBMPStatsReport builds a Statistics Report with the given TLVs and a
+// global peer at 192.0.2.1 AS65001.
+func buildBMPStatsReport(count uint32, tlvs ...[]byte) []byte {
+	var body []byte
+	for _, tlv := range tlvs {
+		body = append(body, tlv...)
+	}
+	totalLen := CommonHeaderSize + PerPeerHeaderSize + 4 + len(body)
+	msg := make([]byte, totalLen)
+	msg[0] = BMPVersion
+	binary.BigEndian.PutUint32(msg[1:5], uint32(totalLen))
+	msg[5] = MsgTypeStatisticsReport
+
+	pph := msg[CommonHeaderSize:]
+	pph[0] = PeerTypeGlobal
+	copy(pph[22:26], []byte{192, 0, 2, 1})
+	binary.BigEndian.PutUint32(pph[26:30], 65001)
+
+	off := CommonHeaderSize + PerPeerHeaderSize
+	binary.BigEndian.PutUint32(msg[off:off+4], count)
+	copy(msg[off+4:], body)
+	return msg
+}
+
+func TestParseStatisticsReport_CounterGaugeAndPerAFI(t *testing.T) {
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, 7)
+	gauge := make([]byte, 8)
+	binary.BigEndian.PutUint64(gauge, 1_000_000)
+	perAFI := make([]byte, 11)
+	binary.BigEndian.PutUint16(perAFI[0:2], 2) // AFI IPv6
+	perAFI[2] = 1                              // SAFI unicast
+	binary.BigEndian.PutUint64(perAFI[3:11], 42)
+
+	msg := buildBMPStatsReport(3,
+		buildStatTLV(StatTypeRejectedPrefixes, counter),
+		buildStatTLV(StatTypeAdjRibInRoutes, gauge),
+		buildStatTLV(StatTypeAdjRibInRoutesPerAFISAFI, perAFI),
+	)
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.MsgType != MsgTypeStatisticsReport {
+		t.Fatalf("expected MsgType=%d, got %d", MsgTypeStatisticsReport, parsed.MsgType)
+	}
+	if parsed.PeerAddress != "192.0.2.1" || parsed.PeerAS != 65001 {
+		t.Errorf("expected peer 192.0.2.1 AS65001, got %s AS%d", parsed.PeerAddress, parsed.PeerAS)
+	}
+	if len(parsed.Stats) != 3 {
+		t.Fatalf("expected 3 stats, got %d", len(parsed.Stats))
+	}
+
+	if s := parsed.Stats[0]; s.Type != StatTypeRejectedPrefixes || s.Value != 7 || s.Name() != "rejected_prefixes" {
+		t.Errorf("unexpected counter stat: %+v (%s)", s, s.Name())
+	}
+	if s := parsed.Stats[1]; s.Type != StatTypeAdjRibInRoutes || s.Value != 1_000_000 {
+		t.Errorf("unexpected gauge stat: %+v", s)
+	}
+	if s := parsed.Stats[2]; s.AFI != 2 || s.SAFI != 1 || s.Value != 42 {
+		t.Errorf("unexpected per-AFI/SAFI stat: %+v", s)
+	}
+}
+
+func TestParseStatisticsReport_AdjRibOutTypes(t *testing.T) {
+	gauge := make([]byte, 8)
+	binary.BigEndian.PutUint64(gauge, 12)
+	msg := buildBMPStatsReport(1, buildStatTLV(StatTypeAdjRibOutPostRoutes, gauge))
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.Stats) != 1 || parsed.Stats[0].Name() != "adj_rib_out_post_routes" {
+		t.Fatalf("expected adj_rib_out_post_routes stat, got %+v", parsed.Stats)
+	}
+}
+
+func TestParseStatisticsReport_UnknownTypeName(t *testing.T) {
+	counter := make([]byte, 4)
+	msg := buildBMPStatsReport(1, buildStatTLV(65000, counter))
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.Stats) != 1 || parsed.Stats[0].Name() != "type_65000" {
+		t.Fatalf("expected type_65000, got %+v", parsed.Stats)
+	}
+}
+
+func TestParseStatisticsReport_SkipsUnexpectedLength(t *testing.T) {
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, 3)
+	msg := buildBMPStatsReport(2,
+		buildStatTLV(StatTypeDuplicateWithdraws, []byte{1, 2}),
+		buildStatTLV(StatTypeDuplicatePrefixes, counter),
+	)
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.Stats) != 1 || parsed.Stats[0].Type != StatTypeDuplicatePrefixes {
+		t.Fatalf("expected only duplicate_prefixes stat, got %+v", parsed.Stats)
+	}
+}
+
+func TestParseStatisticsReport_TruncatedTLV(t *testing.T) {
+	counter := make([]byte, 4)
+	tlv := buildStatTLV(StatTypeRejectedPrefixes, counter)
+	msg := buildBMPStatsReport(2, tlv, tlv[:6])
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parsed.Stats) != 1 {
+		t.Fatalf("expected 1 stat before truncation, got %d", len(parsed.Stats))
+	}
+}
+
+func TestParseStatisticsReport_TooShort(t *testing.T) {
+	totalLen := CommonHeaderSize + PerPeerHeaderSize
+	msg := make([]byte, totalLen)
+	msg[0] = BMPVersion
+	binary.BigEndian.PutUint32(msg[1:5], uint32(totalLen))
+	msg[5] = MsgTypeStatisticsReport
+
+	if _, err := Parse(msg); err == nil {
+		t.Fatal("expected error for statistics report without stats count")
+	}
+}
@@ -0,0 +1,44 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// parseTermination handles BMP Termination messages (RFC 7854 §4.5).
+// Like Initiation, Termination has no per-peer header: Information TLVs
+// follow the common header directly. Type 0 is a free-form string (may
+// repeat) and type 1 is a 2-byte reason code. A message without a reason
+// TLV is reported as TermReasonUnspecified.
+func parseTermination(data []byte, result *ParsedBMP) (*ParsedBMP, error) {
+	result.TermReason = TermReasonUnspecified
+
+	var info []string
+	offset := 0
+	for offset+4 <= len(data) {
+		tlvType := binary.BigEndian.Uint16(data[offset : offset+2])
+		tlvLen := int(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		offset += 4
+
+		if offset+tlvLen > len(data) {
+			break
+		}
+
+		value := data[offset : offset+tlvLen]
+		switch tlvType {
+		case TermTLVTypeString:
+			if tlvLen > 0 {
+				info = append(info, string(value))
+			}
+		case TermTLVTypeReason:
+			if tlvLen >= 2 {
+				result.TermReason = binary.BigEndian.Uint16(value[0:2])
+			}
+		}
+
+		offset += tlvLen
+	}
+
+	result.TermInfo = strings.Join(info, "; ")
+	return result, nil
+}
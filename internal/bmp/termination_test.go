@@ -0,0 +1,109 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func buildTermTLV(tlvType uint16, value []byte) []byte {
+	tlv := make([]byte, 4+len(value))
+	binary.BigEndian.PutUint16(tlv[0:2], tlvType)
+	binary.BigEndian.PutUint16(tlv[2:4], uint16(len(value)))
+	copy(tlv[4:], value)
+	return tlv
+}
+
+func buildBMPTermination(tlvs ...[]byte) []byte {
+	var body []byte
+	for _, tlv := range tlvs {
+		body = append(body, tlv...)
+	}
+	totalLen := CommonHeaderSize + len(body)
+	msg := make([]byte, totalLen)
+	msg[0] = BMPVersion
+	binary.BigEndian.PutUint32(msg[1:5], uint32(totalLen))
+	msg[5] = MsgTypeTermination
+	copy(msg[CommonHeaderSize:], body)
+	return msg
+}
+
+func TestParseTermination_ReasonAndString(t *testing.T) {
+	reason := make([]byte, 2)
+	binary.BigEndian.PutUint16(reason, TermReasonOutOfResources)
+	msg := buildBMPTermination(
+		buildTermTLV(TermTLVTypeString, []byte("shutting down")),
+		buildTermTLV(TermTLVTypeReason, reason),
+	)
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.TermReason != TermReasonOutOfResources {
+		t.Errorf("expected reason %d, got %d", TermReasonOutOfResources, parsed.TermReason)
+	}
+	if parsed.TermInfo != "shutting down" {
+		t.Errorf("expected info %q, got %q", "shutting down", parsed.TermInfo)
+	}
+	if parsed.TableName != "UNKNOWN" {
+		t.Errorf("string TLV must not be treated as a table name, got %q", parsed.TableName)
+	}
+}
+
+func TestParseTermination_NoReasonDefaultsUnspecified(t *testing.T) {
+	parsed, err := Parse(buildBMPTermination())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.TermReason != TermReasonUnspecified {
+		t.Errorf("expected reason %d, got %d", TermReasonUnspecified, parsed.TermReason)
+	}
+	if parsed.TermInfo != "" {
+		t.Errorf("expected empty info, got %q", parsed.TermInfo)
+	}
+}
+
+func TestParseTermination_MultipleStringsJoined(t *testing.T) {
+	msg := buildBMPTermination(
+		buildTermTLV(TermTLVTypeString, []byte("maintenance")),
+		buildTermTLV(TermTLVTypeString, []byte("ticket 42")),
+	)
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.TermInfo != "maintenance; ticket 42" {
+		t.Errorf("unexpected info %q", parsed.TermInfo)
+	}
+}
+
+func TestParseTermination_TruncatedTLV(t *testing.T) {
+	reason := make([]byte, 2)
+	binary.BigEndian.PutUint16(reason, TermReasonAdminClose)
+	msg := buildBMPTermination(buildTermTLV(TermTLVTypeReason, reason))
+	// Append a TLV header that claims more bytes than remain.
+	trunc := []byte{0x00, 0x00, 0x00, 0x10, 'x'}
+	msg = append(msg, trunc...)
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(msg)))
+
+	parsed, err := Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.TermReason != TermReasonAdminClose {
+		t.Errorf("expected reason %d, got %d", TermReasonAdminClose, parsed.TermReason)
+	}
+	if parsed.TermInfo != "" {
+		t.Errorf("expected truncated string TLV to be ignored, got %q", parsed.TermInfo)
+	}
+}
+
+func TestTermReasonName(t *testing.T) {
+	if got := TermReasonName(TermReasonRedundantConnection); got != "redundant_connection" {
+		t.Errorf("unexpected name %q", got)
+	}
+	if got := TermReasonName(99); got != "reason_99" {
+		t.Errorf("unexpected fallback name %q", got)
+	}
+}
@@ -1,5 +1,12 @@
 package bmp
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
 // BMP message type codes (RFC 7854).
 const (
 	MsgTypeRouteMonitoring  uint8 = 0
@@ -32,12 +39,133 @@ const (
 	TLVTypeSysName   uint16 = 2
 )
 
+// Termination TLV type codes (RFC 7854 §4.5).
+const (
+	TermTLVTypeString uint16 = 0
+	TermTLVTypeReason uint16 = 1
+)
+
+// Termination reason codes (RFC 7854 §4.5).
+const (
+	TermReasonAdminClose          uint16 = 0
+	TermReasonUnspecified         uint16 = 1
+	TermReasonOutOfResources      uint16 = 2
+	TermReasonRedundantConnection uint16 = 3
+	TermReasonPermAdminClose      uint16 = 4
+)
+
+// TermReasonNames maps Termination reason codes to the names stored in the
+// bmp_session_log table.
+var TermReasonNames = map[uint16]string{
+	TermReasonAdminClose:          "admin_close",
+	TermReasonUnspecified:         "unspecified",
+	TermReasonOutOfResources:      "out_of_resources",
+	TermReasonRedundantConnection: "redundant_connection",
+	TermReasonPermAdminClose:      "permanently_admin_close",
+}
+
+// TermReasonName returns the name of a Termination reason code, or
+// "reason_N" for codes not in TermReasonNames.
+func TermReasonName(code uint16) string {
+	if name, ok := TermReasonNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("reason_%d", code)
+}
+
+// Route Mirroring TLV types (RFC 7854 §4.7).
+const (
+	MirrorTLVTypeBGPMessage  uint16 = 0
+	MirrorTLVTypeInformation uint16 = 1
+)
+
+// Route Mirroring information codes (RFC 7854 §4.7).
+const (
+	MirrorInfoErroredPDU   uint16 = 0
+	MirrorInfoMessagesLost uint16 = 1
+)
+
+// Peer Down reason codes (RFC 7854 §4.9, RFC 9069 §5.3).
+const (
+	PeerDownLocalNotification    uint8 = 1 // BGP NOTIFICATION sent follows
+	PeerDownLocalNoNotification  uint8 = 2 // 2-byte FSM event code follows
+	PeerDownRemoteNotification   uint8 = 3 // BGP NOTIFICATION received follows
+	PeerDownRemoteNoNotification uint8 = 4
+	PeerDownDeconfigured         uint8 = 5
+	PeerDownLocalTLV             uint8 = 6 // TLVs follow (RFC 9069)
+)
+
+// PeerDownReasonNames maps Peer Down reason codes to the names stored in
+// the peer_session_events table.
+var PeerDownReasonNames = map[uint8]string{
+	PeerDownLocalNotification:    "local_notification",
+	PeerDownLocalNoNotification:  "local_no_notification",
+	PeerDownRemoteNotification:   "remote_notification",
+	PeerDownRemoteNoNotification: "remote_no_notification",
+	PeerDownDeconfigured:         "peer_deconfigured",
+	PeerDownLocalTLV:             "local_tlv",
+}
+
+// PeerDownReasonName returns the name of a Peer Down reason code, or
+// "reason_N" for codes not in PeerDownReasonNames.
+func PeerDownReasonName(code uint8) string {
+	if name, ok := PeerDownReasonNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("reason_%d", code)
+}
+
+// Statistics Report stat types (RFC 7854 §4.8, RFC 8671 §5).
+const (
+	StatTypeRejectedPrefixes         uint16 = 0
+	StatTypeDuplicatePrefixes        uint16 = 1
+	StatTypeDuplicateWithdraws       uint16 = 2
+	StatTypeClusterListLoop          uint16 = 3
+	StatTypeASPathLoop               uint16 = 4
+	StatTypeOriginatorIDLoop         uint16 = 5
+	StatTypeASConfedLoop             uint16 = 6
+	StatTypeAdjRibInRoutes           uint16 = 7
+	StatTypeLocRibRoutes             uint16 = 8
+	StatTypeAdjRibInRoutesPerAFISAFI uint16 = 9
+	StatTypeLocRibRoutesPerAFISAFI   uint16 = 10
+	StatTypeUpdatesTreatAsWithdraw   uint16 = 11
+	StatTypePrefixesTreatAsWithdraw  uint16 = 12
+	StatTypeDuplicateUpdates         uint16 = 13
+	StatTypeAdjRibOutPreRoutes       uint16 = 14
+	StatTypeAdjRibOutPostRoutes      uint16 = 15
+	StatTypeAdjRibOutPrePerAFISAFI   uint16 = 16
+	StatTypeAdjRibOutPostPerAFISAFI  uint16 = 17
+)
+
+// StatTypeNames maps stat types to the names used in the bmp_stats table
+// and the ribingester_bmp_stat_value metric.
+var StatTypeNames = map[uint16]string{
+	StatTypeRejectedPrefixes:         "rejected_prefixes",
+	StatTypeDuplicatePrefixes:        "duplicate_prefixes",
+	StatTypeDuplicateWithdraws:       "duplicate_withdraws",
+	StatTypeClusterListLoop:          "cluster_list_loop",
+	StatTypeASPathLoop:               "as_path_loop",
+	StatTypeOriginatorIDLoop:         "originator_id_loop",
+	StatTypeASConfedLoop:             "as_confed_loop",
+	StatTypeAdjRibInRoutes:           "adj_rib_in_routes",
+	StatTypeLocRibRoutes:             "loc_rib_routes",
+	StatTypeAdjRibInRoutesPerAFISAFI: "adj_rib_in_routes_per_afi_safi",
+	StatTypeLocRibRoutesPerAFISAFI:   "loc_rib_routes_per_afi_safi",
+	StatTypeUpdatesTreatAsWithdraw:   "updates_treat_as_withdraw",
+	StatTypePrefixesTreatAsWithdraw:  "prefixes_treat_as_withdraw",
+	StatTypeDuplicateUpdates:         "duplicate_updates",
+	StatTypeAdjRibOutPreRoutes:       "adj_rib_out_pre_routes",
+	StatTypeAdjRibOutPostRoutes:      "adj_rib_out_post_routes",
+	StatTypeAdjRibOutPrePerAFISAFI:   "adj_rib_out_pre_routes_per_afi_safi",
+	StatTypeAdjRibOutPostPerAFISAFI:  "adj_rib_out_post_routes_per_afi_safi",
+}
+
 // BMPVersion is the expected BMP protocol version.
 const BMPVersion uint8 = 3
 
 // PeerFlagAddPath is the F-bit in peer_flags (RFC 9069 Section 4.2).
 // Per RFC 9069, this is bit 7 (MSB, 0x80) of the single-octet flags field.
-// ParseUpdateAutoDetect provides a safety net for routers that do not set
+// bgp.DecodeUpdateAutoDetect provides a safety net for routers that do not set
 // this bit despite sending Add-Path encoded NLRI.
 const PeerFlagAddPath uint8 = 0x80
 
@@ -45,6 +173,15 @@ const PeerFlagAddPath uint8 = 0x80
 // L=0 means pre-policy Adj-RIB-In, L=1 means post-policy.
 const PeerFlagPostPolicy uint8 = 0x40
 
+// PeerFlagLegacyASPath is the A-bit (bit 5, 0x20) of BMP peer flags
+// (RFC 7854 §4.2). A=1 means AS_PATH uses the legacy 2-octet ASN format.
+const PeerFlagLegacyASPath uint8 = 0x20
+
+// PeerFlagAdjRIBOut is the O-bit (bit 3, 0x10) of BMP peer flags (RFC 8671).
+// O=0 means the Route Monitoring carries Adj-RIB-In, O=1 means Adj-RIB-Out.
+// The L-bit then selects pre- or post-policy Adj-RIB-Out.
+const PeerFlagAdjRIBOut uint8 = 0x10
+
 // ParsedBMP represents a parsed BMP message.
 type ParsedBMP struct {
 	MsgType        uint8
@@ -53,15 +190,48 @@ type ParsedBMP struct {
 	IsLocRIB       bool
 	HasAddPath     bool
 	TableName      string
-	BGPData        []byte // The encapsulated BGP message bytes
-	Offset         int    // Byte offset of this message within the raw payload (set by ParseAll)
-	SysName        string // From Initiation TLV type 2
-	SysDescr       string // From Initiation TLV type 1
-	PeerDownReason uint8  // Reason code from Peer Down (offset 42)
-	LocalASN       uint32 // Router's own ASN from Sent OPEN in non-Loc-RIB Peer Up
-	LocalBGPID     string // Router's own BGP Identifier from Sent OPEN in non-Loc-RIB Peer Up
-	PeerAddress    string // Peer's IP address from per-peer header (non-Loc-RIB only)
-	PeerAS         uint32 // Peer's ASN from per-peer header (non-Loc-RIB only)
-	PeerBGPID      string // Peer's BGP Identifier from per-peer header (non-Loc-RIB only)
-	IsPostPolicy   bool   // L-flag: false=pre-policy (L=0), true=post-policy (L=1)
+	BGPData        []byte            // The encapsulated BGP message bytes
+	Offset         int               // Byte offset of this message within the raw payload (set by ParseAll)
+	SysName        string            // From Initiation TLV type 2
+	SysDescr       string            // From Initiation TLV type 1
+	PeerDownReason uint8             // Reason code from Peer Down (offset 42)
+	Notification   *bgp.Notification // NOTIFICATION from Peer Down reasons 1 and 3 (nil if absent or malformed)
+	FSMEvent       uint16            // FSM event code from Peer Down reason 2 (RFC 4271 §8.1)
+	LocalASN       uint32            // Router's own ASN from Sent OPEN in non-Loc-RIB Peer Up
+	LocalBGPID     string            // Router's own BGP Identifier from Sent OPEN in non-Loc-RIB Peer Up
+	LocalAddress   string            // Router's session address from non-Loc-RIB Peer Up
+	LocalPort      uint16            // Router's session TCP port from non-Loc-RIB Peer Up
+	RemotePort     uint16            // Peer's session TCP port from non-Loc-RIB Peer Up
+	SentOpen       *bgp.OpenMessage  // OPEN the router sent, from non-Loc-RIB Peer Up (nil if malformed)
+	ReceivedOpen   *bgp.OpenMessage  // OPEN the router received, from non-Loc-RIB Peer Up (nil if malformed)
+	PeerAddress    string            // Peer's IP address from per-peer header (non-Loc-RIB only)
+	PeerRD         string            // Peer Distinguisher of an RD instance peer (PeerTypeRD only): the RD of its VRF
+	PeerAS         uint32            // Peer's ASN from per-peer header (non-Loc-RIB only)
+	PeerBGPID      string            // Peer's BGP Identifier from per-peer header (non-Loc-RIB only)
+	IsPostPolicy   bool              // L-flag: false=pre-policy (L=0), true=post-policy (L=1)
+	IsAdjRIBOut    bool              // O-flag: false=Adj-RIB-In (O=0), true=Adj-RIB-Out (O=1, RFC 8671)
+	IsLegacyASPath bool              // A-flag: AS_PATH carries 2-octet ASNs (non-Loc-RIB only)
+	Timestamp      time.Time         // Per-peer header ts_sec/ts_usec (zero if the router sent none)
+	Stats          []Stat            // Decoded counters from a Statistics Report
+	TermReason     uint16            // Reason code from Termination TLV type 1 (TermReasonUnspecified if absent)
+	TermInfo       string            // Free-form text from Termination TLV type 0 (multiple TLVs joined by "; ")
+	MirroredPDUs   [][]byte          // BGP PDUs from Route Mirroring TLV type 0
+	MirrorInfo     []uint16          // Information codes from Route Mirroring TLV type 1
+}
+
+// Stat is a single decoded Statistics Report TLV. AFI and SAFI are only
+// set for the per-AFI/SAFI gauge types (9, 10, 16, 17).
+type Stat struct {
+	Type  uint16
+	AFI   uint16
+	SAFI  uint8
+	Value uint64
+}
+
+// Name returns the stat's name, or "type_N" for types not in StatTypeNames.
+func (s Stat) Name() string {
+	if name, ok := StatTypeNames[s.Type]; ok {
+		return name
+	}
+	return fmt.Sprintf("type_%d", s.Type)
 }
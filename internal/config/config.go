@@ -17,12 +17,13 @@ import (
 )
 
 type Config struct {
-	Service   ServiceConfig          `koanf:"service"`
-	Kafka     KafkaConfig            `koanf:"kafka"`
-	Postgres  PostgresConfig         `koanf:"postgres"`
-	Ingest    IngestConfig           `koanf:"ingest"`
-	Retention RetentionConfig        `koanf:"retention"`
-	Routers   map[string]RouterMeta  `koanf:"routers"`
+	Service     ServiceConfig         `koanf:"service"`
+	Kafka       KafkaConfig           `koanf:"kafka"`
+	Postgres    PostgresConfig        `koanf:"postgres"`
+	Ingest      IngestConfig          `koanf:"ingest"`
+	Retention   RetentionConfig       `koanf:"retention"`
+	BMPListener BMPListenerConfig     `koanf:"bmp_listener"`
+	Routers     map[string]RouterMeta `koanf:"routers"`
 }
 
 type RouterMeta struct {
@@ -69,6 +70,13 @@ type ConsumerConfig struct {
 	RawMode bool `koanf:"raw_mode"`
 }
 
+// BMPListenerConfig configures the native BMP TCP listener. When enabled
+// without kafka.brokers, the service ingests only from the listener.
+type BMPListenerConfig struct {
+	Enabled bool   `koanf:"enabled"`
+	Listen  string `koanf:"listen"`
+}
+
 type PostgresConfig struct {
 	DSN      string `koanf:"dsn"`
 	MaxConns int32  `koanf:"max_conns"`
@@ -87,8 +95,17 @@ type IngestConfig struct {
 type RetentionConfig struct {
 	Days     int    `koanf:"days"`
 	Timezone string `koanf:"timezone"`
+	// TimeAxis selects the time the event tables are partitioned, and so
+	// retained, by: TimeAxisIngest or TimeAxisEvent.
+	TimeAxis string `koanf:"time_axis"`
 }
 
+// Time axes of retention.time_axis.
+const (
+	TimeAxisIngest = "ingest_time" // when the ingester wrote the event
+	TimeAxisEvent  = "event_time"  // when the route changed on the router
+)
+
 func Load(path string) (*Config, error) {
 	k := koanf.New(".")
 
@@ -140,6 +157,10 @@ func Load(path string) (*Config, error) {
 		Retention: RetentionConfig{
 			Days:     30,
 			Timezone: "UTC",
+			TimeAxis: TimeAxisIngest,
+		},
+		BMPListener: BMPListenerConfig{
+			Listen: ":5000",
 		},
 	}
 
@@ -165,25 +186,37 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// KafkaEnabled reports whether the Kafka consumers should run. Kafka is
+// required unless the BMP listener is enabled, in which case it is used only
+// if brokers are configured.
+func (c *Config) KafkaEnabled() bool {
+	return !c.BMPListener.Enabled || len(c.Kafka.Brokers) > 0
+}
+
 func (c *Config) Validate() error {
-	if len(c.Kafka.Brokers) == 0 {
-		return fmt.Errorf("config: kafka.brokers is required")
+	if c.KafkaEnabled() {
+		if len(c.Kafka.Brokers) == 0 {
+			return fmt.Errorf("config: kafka.brokers is required")
+		}
+		if c.Kafka.State.GroupID == "" {
+			return fmt.Errorf("config: kafka.state.group_id is required")
+		}
+		if len(c.Kafka.State.Topics) == 0 {
+			return fmt.Errorf("config: kafka.state.topics is required")
+		}
+		if c.Kafka.History.GroupID == "" {
+			return fmt.Errorf("config: kafka.history.group_id is required")
+		}
+		if len(c.Kafka.History.Topics) == 0 {
+			return fmt.Errorf("config: kafka.history.topics is required")
+		}
+	}
+	if c.BMPListener.Enabled && c.BMPListener.Listen == "" {
+		return fmt.Errorf("config: bmp_listener.listen is required when bmp_listener.enabled is true")
 	}
 	if c.Postgres.DSN == "" {
 		return fmt.Errorf("config: postgres.dsn is required")
 	}
-	if c.Kafka.State.GroupID == "" {
-		return fmt.Errorf("config: kafka.state.group_id is required")
-	}
-	if len(c.Kafka.State.Topics) == 0 {
-		return fmt.Errorf("config: kafka.state.topics is required")
-	}
-	if c.Kafka.History.GroupID == "" {
-		return fmt.Errorf("config: kafka.history.group_id is required")
-	}
-	if len(c.Kafka.History.Topics) == 0 {
-		return fmt.Errorf("config: kafka.history.topics is required")
-	}
 	if c.Ingest.FlushIntervalMs <= 0 {
 		return fmt.Errorf("config: ingest.flush_interval_ms must be > 0 (got %d)", c.Ingest.FlushIntervalMs)
 	}
@@ -199,7 +232,7 @@ func (c *Config) Validate() error {
 	if c.Ingest.MaxPayloadBytes <= 0 {
 		return fmt.Errorf("config: ingest.max_payload_bytes must be > 0 (got %d)", c.Ingest.MaxPayloadBytes)
 	}
-	if c.Kafka.FetchMaxBytes <= 0 {
+	if c.KafkaEnabled() && c.Kafka.FetchMaxBytes <= 0 {
 		return fmt.Errorf("config: kafka.fetch_max_bytes must be > 0 (got %d)", c.Kafka.FetchMaxBytes)
 	}
 	if c.Postgres.MaxConns <= 0 {
@@ -214,7 +247,10 @@ func (c *Config) Validate() error {
 	if _, err := time.LoadLocation(c.Retention.Timezone); err != nil {
 		return fmt.Errorf("config: retention.timezone is invalid: %w", err)
 	}
-	if int32(c.Ingest.MaxPayloadBytes) > c.Kafka.FetchMaxBytes {
+	if c.Retention.TimeAxis != TimeAxisIngest && c.Retention.TimeAxis != TimeAxisEvent {
+		return fmt.Errorf("config: retention.time_axis must be %q or %q (got %q)", TimeAxisIngest, TimeAxisEvent, c.Retention.TimeAxis)
+	}
+	if c.KafkaEnabled() && int32(c.Ingest.MaxPayloadBytes) > c.Kafka.FetchMaxBytes {
 		return fmt.Errorf("config: ingest.max_payload_bytes (%d) exceeds kafka.fetch_max_bytes (%d); messages larger than fetch_max_bytes will be dropped by the broker",
 			c.Ingest.MaxPayloadBytes, c.Kafka.FetchMaxBytes)
 	}
@@ -34,6 +34,7 @@ func validConfig() *Config {
 		Retention: RetentionConfig{
 			Days:     30,
 			Timezone: "UTC",
+			TimeAxis: TimeAxisIngest,
 		},
 	}
 }
@@ -53,6 +54,35 @@ func TestValidate_NoBrokers(t *testing.T) {
 	}
 }
 
+func TestValidate_ListenerOnlyNoKafka(t *testing.T) {
+	cfg := validConfig()
+	cfg.Kafka = KafkaConfig{}
+	cfg.BMPListener = BMPListenerConfig{Enabled: true, Listen: ":5000"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected listener-only config to be valid, got: %v", err)
+	}
+	if cfg.KafkaEnabled() {
+		t.Error("expected Kafka disabled without brokers when the listener is enabled")
+	}
+}
+
+func TestValidate_ListenerWithKafkaStillValidatesKafka(t *testing.T) {
+	cfg := validConfig()
+	cfg.BMPListener = BMPListenerConfig{Enabled: true, Listen: ":5000"}
+	cfg.Kafka.State.Topics = nil
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for empty state topics when brokers are configured")
+	}
+}
+
+func TestValidate_ListenerNoListenAddr(t *testing.T) {
+	cfg := validConfig()
+	cfg.BMPListener = BMPListenerConfig{Enabled: true}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for empty bmp_listener.listen")
+	}
+}
+
 func TestValidate_NoDSN(t *testing.T) {
 	cfg := validConfig()
 	cfg.Postgres.DSN = ""
@@ -157,6 +187,22 @@ func TestValidate_ValidTimezone(t *testing.T) {
 	}
 }
 
+func TestValidate_TimeAxis(t *testing.T) {
+	for _, axis := range []string{TimeAxisIngest, TimeAxisEvent} {
+		cfg := validConfig()
+		cfg.Retention.TimeAxis = axis
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("expected valid config for %q, got error: %v", axis, err)
+		}
+	}
+
+	cfg := validConfig()
+	cfg.Retention.TimeAxis = "collector_time"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for unknown time axis")
+	}
+}
+
 func TestLoad_RoutersMapParsed(t *testing.T) {
 	dir := t.TempDir()
 	p := filepath.Join(dir, "config.yaml")
@@ -0,0 +1,72 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+)
+
+// MirroringRow represents one mirrored BGP PDU for route_mirroring_events.
+type MirroringRow struct {
+	RouterID     string
+	PeerAddress  string // Empty for Loc-RIB
+	PeerAS       uint32
+	PeerBGPID    string
+	IsLocRIB     bool
+	EventTime    time.Time
+	ErroredPDU   bool
+	MessagesLost bool
+	PDU          []byte // Verbatim BGP PDU; nil for a Messages Lost notice
+}
+
+const insertMirroringSQL = `
+INSERT INTO route_mirroring_events (router_id, peer_address, peer_asn, peer_bgp_id,
+    event_time, errored_pdu, messages_lost, bgp_msg_type, bgp_pdu, bgp_pdu_length, logged_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now())`
+
+// InsertMirroring writes the PDUs of one or more Route Mirroring messages to
+// route_mirroring_events. PDUs are always zstd-compressed: they are only
+// read back for forensics, and errored UPDATEs tend to be large.
+func (w *Writer) InsertMirroring(ctx context.Context, rows []*MirroringRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	batch := &pgx.Batch{}
+	for _, row := range rows {
+		var peerAddr, peerASN, peerBGPID any
+		if !row.IsLocRIB && row.PeerAddress != "" {
+			peerAddr = row.PeerAddress
+			peerASN = int64(row.PeerAS)
+			peerBGPID = nilIfEmpty(row.PeerBGPID)
+		}
+		var msgType, pdu, pduLen any
+		if len(row.PDU) > 0 {
+			if len(row.PDU) > 18 {
+				msgType = int16(row.PDU[18])
+			}
+			pdu = zstdEncoder.EncodeAll(row.PDU, nil)
+			pduLen = int32(len(row.PDU))
+		}
+
+		batch.Queue(insertMirroringSQL,
+			row.RouterID, peerAddr, peerASN, peerBGPID,
+			row.EventTime, row.ErroredPDU, row.MessagesLost, msgType, pdu, pduLen,
+		)
+	}
+
+	if err := w.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("insert route_mirroring_events: %w", err)
+	}
+
+	dur := time.Since(start).Seconds()
+	metrics.DBWriteDuration.WithLabelValues("history", "mirroring").Observe(dur)
+	metrics.DBRowsAffectedTotal.WithLabelValues("history", "route_mirroring_events", "insert").Add(float64(len(rows)))
+
+	return nil
+}
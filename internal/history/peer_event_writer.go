@@ -0,0 +1,74 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+	"github.com/route-beacon/rib-ingester/internal/bmp"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+)
+
+// PeerEventRow represents a BGP peer Up or Down for peer_session_events.
+type PeerEventRow struct {
+	RouterID     string
+	PeerAddress  string
+	PeerAS       uint32
+	PeerBGPID    string
+	IsLocRIB     bool
+	TableName    string
+	Event        string // "up" or "down"
+	EventTime    time.Time
+	ReasonCode   uint8 // Peer Down only; 0 for Peer Up
+	Notification *bgp.Notification
+	FSMEvent     uint16
+}
+
+// InsertPeerEvent appends a peer Up or Down to peer_session_events.
+func (w *Writer) InsertPeerEvent(ctx context.Context, row *PeerEventRow) error {
+	start := time.Now()
+
+	var peerAddr, peerASN, peerBGPID any
+	if !row.IsLocRIB && row.PeerAddress != "" {
+		peerAddr = row.PeerAddress
+		peerASN = int64(row.PeerAS)
+		peerBGPID = nilIfEmpty(row.PeerBGPID)
+	}
+	var reasonCode, reason, fsmEvent any
+	if row.Event == "down" {
+		reasonCode = int16(row.ReasonCode)
+		reason = bmp.PeerDownReasonName(row.ReasonCode)
+		if row.ReasonCode == bmp.PeerDownLocalNoNotification {
+			fsmEvent = int32(row.FSMEvent)
+		}
+	}
+	var code, codeName, subcode, subcodeName, shutdownMsg, data any
+	if n := row.Notification; n != nil {
+		code, codeName = int16(n.Code), n.CodeName()
+		subcode, subcodeName = int16(n.Subcode), n.SubcodeName()
+		shutdownMsg = nilIfEmpty(n.ShutdownMessage)
+		if len(n.Data) > 0 {
+			data = n.Data
+		}
+	}
+
+	_, err := w.pool.Exec(ctx, `
+		INSERT INTO peer_session_events (router_id, peer_address, peer_asn, peer_bgp_id,
+			is_loc_rib, table_name, event, event_time, reason_code, reason,
+			notification_code, notification_code_name, notification_subcode, notification_subcode_name,
+			shutdown_message, notification_data, fsm_event, logged_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, now())`,
+		row.RouterID, peerAddr, peerASN, peerBGPID,
+		row.IsLocRIB, nilIfEmpty(row.TableName), row.Event, row.EventTime, reasonCode, reason,
+		code, codeName, subcode, subcodeName,
+		shutdownMsg, data, fsmEvent,
+	)
+	if err != nil {
+		return fmt.Errorf("insert peer_session_events: %w", err)
+	}
+
+	metrics.DBWriteDuration.WithLabelValues("history", "peer_event").Observe(time.Since(start).Seconds())
+	metrics.DBRowsAffectedTotal.WithLabelValues("history", "peer_session_events", "insert").Inc()
+	return nil
+}
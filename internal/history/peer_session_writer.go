@@ -0,0 +1,115 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+)
+
+// PeerSessionRow represents one monitored BGP session for bmp_peer_sessions,
+// built from a non-Loc-RIB Peer Up.
+type PeerSessionRow struct {
+	RouterID      string
+	PeerAddress   string
+	PeerAS        uint32
+	PeerBGPID     string
+	LocalAddress  string
+	LocalPort     uint16
+	RemotePort    uint16
+	SentOpen      *bgp.OpenMessage
+	ReceivedOpen  *bgp.OpenMessage
+	Session       *bgp.Session
+	EstablishedAt time.Time // Peer Up per-peer header timestamp; zero if unknown
+}
+
+// UpsertPeerSession records the capabilities negotiated for a BGP session.
+// A new Peer Up for the same router and peer replaces the previous row.
+func (w *Writer) UpsertPeerSession(ctx context.Context, row *PeerSessionRow) error {
+	start := time.Now()
+
+	sentJSON, err := json.Marshal(row.SentOpen)
+	if err != nil {
+		return fmt.Errorf("marshal sent open: %w", err)
+	}
+	receivedJSON, err := json.Marshal(row.ReceivedOpen)
+	if err != nil {
+		return fmt.Errorf("marshal received open: %w", err)
+	}
+
+	sent, received := &row.SentOpen.Capabilities, &row.ReceivedOpen.Capabilities
+
+	var grTime any
+	if received.GracefulRestart != nil {
+		grTime = int32(received.GracefulRestart.RestartTime)
+	}
+	var localRole, peerRole any
+	if sent.HasRole {
+		localRole = sent.RoleName
+	}
+	if received.HasRole {
+		peerRole = received.RoleName
+	}
+
+	_, err = w.pool.Exec(ctx, `
+		INSERT INTO bmp_peer_sessions (router_id, peer_address, peer_asn, peer_bgp_id,
+			local_address, local_port, remote_port, local_asn, local_bgp_id,
+			hold_time, four_octet_as, extended_message, route_refresh, enhanced_route_refresh,
+			families, add_path_rx, add_path_tx, graceful_restart_time, local_role, peer_role,
+			peer_hostname, peer_domain, sent_open, received_open, established_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+			$21, $22, $23, $24, $25, now())
+		ON CONFLICT (router_id, peer_address) DO UPDATE SET
+			peer_asn               = EXCLUDED.peer_asn,
+			peer_bgp_id            = EXCLUDED.peer_bgp_id,
+			local_address          = EXCLUDED.local_address,
+			local_port             = EXCLUDED.local_port,
+			remote_port            = EXCLUDED.remote_port,
+			local_asn              = EXCLUDED.local_asn,
+			local_bgp_id           = EXCLUDED.local_bgp_id,
+			hold_time              = EXCLUDED.hold_time,
+			four_octet_as          = EXCLUDED.four_octet_as,
+			extended_message       = EXCLUDED.extended_message,
+			route_refresh          = EXCLUDED.route_refresh,
+			enhanced_route_refresh = EXCLUDED.enhanced_route_refresh,
+			families               = EXCLUDED.families,
+			add_path_rx            = EXCLUDED.add_path_rx,
+			add_path_tx            = EXCLUDED.add_path_tx,
+			graceful_restart_time  = EXCLUDED.graceful_restart_time,
+			local_role             = EXCLUDED.local_role,
+			peer_role              = EXCLUDED.peer_role,
+			peer_hostname          = EXCLUDED.peer_hostname,
+			peer_domain            = EXCLUDED.peer_domain,
+			sent_open              = EXCLUDED.sent_open,
+			received_open          = EXCLUDED.received_open,
+			established_at         = EXCLUDED.established_at,
+			updated_at             = now()`,
+		row.RouterID, row.PeerAddress, int64(row.PeerAS), nilIfEmpty(row.PeerBGPID),
+		nilIfEmpty(row.LocalAddress), int32(row.LocalPort), int32(row.RemotePort),
+		int64(row.SentOpen.ASN), row.SentOpen.BGPID,
+		int32(row.Session.HoldTime), row.Session.FourOctetAS, row.Session.ExtendedMessage,
+		row.Session.RouteRefresh, row.Session.EnhancedRouteRefresh,
+		familyNames(row.Session.Families), familyNames(row.Session.AddPathRX), familyNames(row.Session.AddPathTX),
+		grTime, localRole, peerRole,
+		nilIfEmpty(received.Hostname), nilIfEmpty(received.DomainName),
+		sentJSON, receivedJSON, nilIfZeroTime(row.EstablishedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("upsert bmp_peer_sessions: %w", err)
+	}
+
+	metrics.DBWriteDuration.WithLabelValues("history", "peer_session").Observe(time.Since(start).Seconds())
+	metrics.DBRowsAffectedTotal.WithLabelValues("history", "bmp_peer_sessions", "upsert").Inc()
+	return nil
+}
+
+func familyNames(families []bgp.AFISAFI) []string {
+	names := make([]string, len(families))
+	for i, f := range families {
+		names[i] = f.String()
+	}
+	return names
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/route-beacon/rib-ingester/internal/bmp"
 	"github.com/route-beacon/rib-ingester/internal/config"
 	"github.com/route-beacon/rib-ingester/internal/metrics"
-	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/route-beacon/rib-ingester/internal/source"
 	"go.uber.org/zap"
 )
 
@@ -25,7 +25,15 @@ type Pipeline struct {
 	// routerIDCache maps OBMP router hash → real router BGP ID (from Peer Up
 	// Sent OPEN). goBMP generates a unique router hash per (router, peer)
 	// combination, making it a reliable correlation key across message types.
+	// Entries are dropped when the BMP session ends.
 	routerIDCache map[string]string
+	// speakerRouterIDs maps OBMP router IP → Loc-RIB router ID. Termination
+	// has no per-peer header, so this is how it is attributed to the same
+	// router_id the speaker's routes were stored under.
+	speakerRouterIDs map[string]string
+	// peerSessions holds the session negotiated in each peer's Peer Up,
+	// used to decode Add-Path NLRI.
+	peerSessions bmp.PeerSessions
 }
 
 func NewPipeline(writer *Writer, batchSize, flushIntervalMs, maxPayloadBytes int, logger *zap.Logger, routerMeta map[string]config.RouterMeta) *Pipeline {
@@ -33,21 +41,23 @@ func NewPipeline(writer *Writer, batchSize, flushIntervalMs, maxPayloadBytes int
 		routerMeta = make(map[string]config.RouterMeta)
 	}
 	return &Pipeline{
-		writer:          writer,
-		batchSize:       batchSize,
-		flushInterval:   time.Duration(flushIntervalMs) * time.Millisecond,
-		maxPayloadBytes: maxPayloadBytes,
-		logger:          logger,
-		asnCache:        make(map[string]uint32),
-		routerMeta:      routerMeta,
-		routerIDCache:   make(map[string]string),
+		writer:           writer,
+		batchSize:        batchSize,
+		flushInterval:    time.Duration(flushIntervalMs) * time.Millisecond,
+		maxPayloadBytes:  maxPayloadBytes,
+		logger:           logger,
+		asnCache:         make(map[string]uint32),
+		routerMeta:       routerMeta,
+		routerIDCache:    make(map[string]string),
+		speakerRouterIDs: make(map[string]string),
+		peerSessions:     make(bmp.PeerSessions),
 	}
 }
 
 // Run processes records from the channel until context is cancelled.
-func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushed chan<- []*kgo.Record) {
+func (p *Pipeline) Run(ctx context.Context, records <-chan []*source.Record, flushed chan<- []*source.Record) {
 	var batch []*HistoryRow
-	var batchRecords []*kgo.Record
+	var batchRecords []*source.Record
 	ticker := time.NewTicker(p.flushInterval)
 	defer ticker.Stop()
 
@@ -111,9 +121,14 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 	}
 }
 
-func (p *Pipeline) processRecord(ctx context.Context, rec *kgo.Record) []*HistoryRow {
-	// Step 1: Decode OpenBMP frame.
-	bmpBytes, err := bmp.DecodeOpenBMPFrame(rec.Value, p.maxPayloadBytes)
+func (p *Pipeline) processRecord(ctx context.Context, rec *source.Record) []*HistoryRow {
+	if rec.EndOfSession {
+		p.processEndOfSession(ctx, rec)
+		return nil
+	}
+
+	// Step 1: Decode OpenBMP frame (Kafka) or take the bare BMP bytes (listener).
+	bmpBytes, obmpRouterIP, obmpRouterHash, err := rec.BMP(p.maxPayloadBytes)
 	if err != nil {
 		metrics.ParseErrorsTotal.WithLabelValues("openbmp", "decode").Inc()
 		p.logger.Warn("failed to decode OpenBMP frame",
@@ -135,17 +150,52 @@ func (p *Pipeline) processRecord(ctx context.Context, rec *kgo.Record) []*Histor
 		return nil
 	}
 
-	obmpRouterIP := bmp.RouterIPFromOpenBMPV17(rec.Value)
-	obmpRouterHash := bmp.RouterHashFromOpenBMPV17(rec.Value)
+	// Fallback event time for messages whose per-peer header carries no
+	// timestamp (RFC 7854 §4.2 allows zero).
+	collectorTime := rec.CollectorTime()
 
 	var rows []*HistoryRow
 	for _, parsed := range msgs {
+		if parsed.IsLocRIB && obmpRouterIP != "" {
+			p.speakerRouterIDs[obmpRouterIP] = p.resolveRouterID(parsed, bmpBytes, obmpRouterIP, obmpRouterHash)
+		}
+		if parsed.MsgType == bmp.MsgTypeTermination {
+			p.processTermination(ctx, rec, parsed, obmpRouterIP)
+			p.forgetSession(obmpRouterHash)
+			continue
+		}
 		if parsed.MsgType == bmp.MsgTypePeerUp {
+			routerID := p.resolveRouterID(parsed, bmpBytes, obmpRouterIP, obmpRouterHash)
 			if parsed.IsLocRIB && parsed.LocalBGPID != "" {
 				p.processLocRIBPeerUp(ctx, rec, parsed)
-			} else if !parsed.IsLocRIB && parsed.LocalASN > 0 {
-				p.processPeerUpASN(ctx, rec, parsed, obmpRouterIP, obmpRouterHash)
+			} else if !parsed.IsLocRIB {
+				if parsed.LocalASN > 0 {
+					p.processPeerUpASN(ctx, rec, parsed, obmpRouterIP, obmpRouterHash)
+				}
+				p.processPeerSession(ctx, parsed, obmpRouterIP, obmpRouterHash)
+				if parsed.LocalBGPID != "" {
+					routerID = parsed.LocalBGPID
+				}
 			}
+			p.processPeerEvent(ctx, newPeerEventRow(parsed, routerID, collectorTime))
+			continue
+		}
+		if parsed.MsgType == bmp.MsgTypePeerDown {
+			routerID := p.resolveRouterID(parsed, bmpBytes, obmpRouterIP, obmpRouterHash)
+			if !parsed.IsLocRIB {
+				p.peerSessions.Forget(obmpRouterHash, parsed)
+			}
+			p.processPeerEvent(ctx, newPeerEventRow(parsed, routerID, collectorTime))
+			continue
+		}
+		if parsed.MsgType == bmp.MsgTypeRouteMirroring {
+			routerID := p.resolveRouterID(parsed, bmpBytes, obmpRouterIP, obmpRouterHash)
+			p.processRouteMirroring(ctx, rec, parsed, newMirroringRows(parsed, routerID, collectorTime))
+			continue
+		}
+		if parsed.MsgType == bmp.MsgTypeStatisticsReport {
+			routerID := p.resolveRouterID(parsed, bmpBytes, obmpRouterIP, obmpRouterHash)
+			p.processStatsReport(ctx, rec, parsed, routerID)
 			continue
 		}
 		if parsed.MsgType != bmp.MsgTypeRouteMonitoring || parsed.BGPData == nil {
@@ -163,9 +213,7 @@ func (p *Pipeline) processRecord(ctx context.Context, rec *kgo.Record) []*Histor
 		}
 		bmpMsgBytes := bmpBytes[parsed.Offset : parsed.Offset+msgLen]
 
-		// ParseUpdateAutoDetect handles routers that send Add-Path
-		// encoded NLRI without setting the F-bit (e.g. Arista cEOS).
-		events, _, err := bgp.ParseUpdateAutoDetect(parsed.BGPData, parsed.HasAddPath)
+		routes, _, err := p.peerSessions.DecodeUpdate(obmpRouterHash, parsed)
 		if err != nil {
 			metrics.ParseErrorsTotal.WithLabelValues("bgp", "parse").Inc()
 			p.logger.Warn("failed to parse BGP UPDATE",
@@ -174,65 +222,85 @@ func (p *Pipeline) processRecord(ctx context.Context, rec *kgo.Record) []*Histor
 			)
 			continue
 		}
-		if len(events) == 0 {
+		if len(routes) == 0 {
 			continue
 		}
-
-		// Router ID: For Loc-RIB, use per-peer header BGP ID. For
-		// non-Loc-RIB, use OBMP header router IP (the BMP speaker).
-		var routerID string
-		if parsed.IsLocRIB {
-			peerHdrOffset := parsed.Offset + bmp.CommonHeaderSize
-			routerID = bmp.RouterIDFromPeerHeader(bmpBytes[peerHdrOffset:])
-			if routerID == "" || routerID == "::" || routerID == "0.0.0.0" {
-				if obmpRouterIP != "" {
-					routerID = obmpRouterIP
-				}
-			}
-		} else {
-			routerID = obmpRouterIP
-			if obmpRouterHash != "" {
-				if cached, ok := p.routerIDCache[obmpRouterHash]; ok {
-					routerID = cached
-				}
-			}
+		for _, w := range routes[0].Warnings {
+			metrics.UpdateErrorsTotal.WithLabelValues("history", w.Action.String(), w.AttrLabel()).Inc()
 		}
 
+		routerID := p.resolveRouterID(parsed, bmpBytes, obmpRouterIP, obmpRouterHash)
+
 		tableName := parsed.TableName
 		if !parsed.IsLocRIB && tableName == "UNKNOWN" {
 			tableName = ""
 		}
 
-		for _, ev := range events {
+		eventTime := parsed.Timestamp
+		if eventTime.IsZero() {
+			eventTime = collectorTime
+		}
+
+		for i := range routes {
+			rt := &routes[i]
+			// BGP-LS topology and SR Policies are kept as state only
+			// (ls_nodes, ls_links, ls_prefixes, sr_policies); they have
+			// no history table.
+			if rt.LinkState != nil || rt.SRPolicy != nil {
+				continue
+			}
 			// Per-prefix event_id: hash BMP msg bytes + suffix.
 			// For non-Loc-RIB, include peer_address in the hash to
 			// distinguish the same prefix from different peers.
 			var suffix []byte
 			if !parsed.IsLocRIB {
-				suffix = []byte(parsed.PeerAddress + "/" + ev.Prefix + "/" + ev.Action)
-			} else {
-				suffix = []byte(ev.Prefix + "/" + ev.Action)
+				suffix = append(suffix, parsed.PeerAddress+"/"...)
+			}
+			if rt.Prefix.IsValid() {
+				suffix = rt.Prefix.AppendTo(suffix)
+			}
+			suffix = append(suffix, "/"+rt.Action...)
+			// Labeled unicast may repeat a unicast prefix in the same
+			// UPDATE. Unicast IDs keep their pre-SAFI form.
+			if rt.SAFI != bgp.SAFIUnicast {
+				suffix = fmt.Appendf(suffix, "/%d", rt.SAFI)
+			}
+			// VPN routes repeat a prefix under different RDs.
+			if rt.RD != "" {
+				suffix = append(suffix, "/"+rt.RD...)
+			}
+			// EVPN routes have no prefix; their key identifies them.
+			if rt.EVPN != nil {
+				suffix = append(suffix, "/"+rt.EVPN.RD+"/"+rt.EVPN.Key()...)
+			}
+			// Nor do FlowSpec rules; the rule string identifies them.
+			if rt.FlowSpec != nil {
+				suffix = append(suffix, "/"+rt.FlowSpec.Rule...)
 			}
 			perPrefixData := make([]byte, len(bmpMsgBytes)+len(suffix))
 			copy(perPrefixData, bmpMsgBytes)
 			copy(perPrefixData[len(bmpMsgBytes):], suffix)
 			rowEventID := ComputeEventID(perPrefixData)
 
-			afiStr := fmt.Sprintf("%d", ev.AFI)
-			metrics.KafkaMessagesTotal.WithLabelValues("history", rec.Topic, afiStr, ev.Action).Inc()
+			afiStr := fmt.Sprintf("%d", rt.AFI)
+			metrics.KafkaMessagesTotal.WithLabelValues("history", rec.Topic, afiStr, rt.Action).Inc()
 
 			rows = append(rows, &HistoryRow{
 				EventID:      rowEventID,
 				RouterID:     routerID,
 				TableName:    tableName,
-				Event:        ev,
+				EventTime:    eventTime,
+				Route:        rt,
 				BMPRaw:       bmpMsgBytes,
 				Topic:        rec.Topic,
 				PeerAddress:  parsed.PeerAddress,
 				PeerAS:       parsed.PeerAS,
 				PeerBGPID:    parsed.PeerBGPID,
 				IsPostPolicy: parsed.IsPostPolicy,
+				IsAdjRIBOut:  parsed.IsAdjRIBOut,
 				IsLocRIB:     parsed.IsLocRIB,
+
+				LeakSuspected: p.peerSessions.LeakSuspected(obmpRouterHash, parsed, rt),
 			})
 		}
 	}
@@ -240,7 +308,332 @@ func (p *Pipeline) processRecord(ctx context.Context, rec *kgo.Record) []*Histor
 	return rows
 }
 
-func (p *Pipeline) processLocRIBPeerUp(ctx context.Context, rec *kgo.Record, parsed *bmp.ParsedBMP) {
+// resolveRouterID returns the BMP speaker's identity for a per-peer message.
+// For Loc-RIB, use the per-peer header BGP ID. For non-Loc-RIB, use the
+// router ID cached from Peer Up, falling back to the OBMP header router IP.
+func (p *Pipeline) resolveRouterID(parsed *bmp.ParsedBMP, bmpBytes []byte, obmpRouterIP, obmpRouterHash string) string {
+	if parsed.IsLocRIB {
+		peerHdrOffset := parsed.Offset + bmp.CommonHeaderSize
+		routerID := bmp.RouterIDFromPeerHeader(bmpBytes[peerHdrOffset:])
+		if routerID == "" || routerID == "::" || routerID == "0.0.0.0" {
+			if obmpRouterIP != "" {
+				routerID = obmpRouterIP
+			}
+		}
+		return routerID
+	}
+
+	routerID := obmpRouterIP
+	if obmpRouterHash != "" {
+		if cached, ok := p.routerIDCache[obmpRouterHash]; ok {
+			routerID = cached
+		}
+	}
+	return routerID
+}
+
+// processPeerSession caches the capabilities negotiated in a non-Loc-RIB
+// Peer Up and records them in bmp_peer_sessions.
+func (p *Pipeline) processPeerSession(ctx context.Context, parsed *bmp.ParsedBMP, obmpRouterIP, obmpRouterHash string) {
+	sess := p.peerSessions.Learn(obmpRouterHash, parsed)
+	if sess == nil {
+		return
+	}
+
+	routerID := parsed.LocalBGPID
+	if routerID == "" {
+		routerID = obmpRouterIP
+	}
+	if routerID == "" || parsed.PeerAddress == "" {
+		return
+	}
+	if p.writer == nil || p.writer.pool == nil {
+		return
+	}
+	row := &PeerSessionRow{
+		RouterID:      routerID,
+		PeerAddress:   parsed.PeerAddress,
+		PeerAS:        parsed.PeerAS,
+		PeerBGPID:     parsed.PeerBGPID,
+		LocalAddress:  parsed.LocalAddress,
+		LocalPort:     parsed.LocalPort,
+		RemotePort:    parsed.RemotePort,
+		SentOpen:      parsed.SentOpen,
+		ReceivedOpen:  parsed.ReceivedOpen,
+		Session:       sess,
+		EstablishedAt: parsed.Timestamp,
+	}
+	if err := p.writer.UpsertPeerSession(ctx, row); err != nil {
+		p.logger.Warn("failed to upsert BMP peer session",
+			zap.String("router_id", routerID),
+			zap.String("peer_address", parsed.PeerAddress),
+			zap.Error(err),
+		)
+	}
+}
+
+// newPeerEventRow builds the peer_session_events row for a Peer Up or Peer
+// Down. The router's per-peer header timestamp is preferred over
+// collectorTime so flap timelines are not skewed by ingest lag.
+func newPeerEventRow(parsed *bmp.ParsedBMP, routerID string, collectorTime time.Time) *PeerEventRow {
+	row := &PeerEventRow{
+		RouterID:    routerID,
+		PeerAddress: parsed.PeerAddress,
+		PeerAS:      parsed.PeerAS,
+		PeerBGPID:   parsed.PeerBGPID,
+		IsLocRIB:    parsed.IsLocRIB,
+		TableName:   parsed.TableName,
+		Event:       "up",
+		EventTime:   parsed.Timestamp,
+	}
+	if !parsed.IsLocRIB && row.TableName == "UNKNOWN" {
+		row.TableName = ""
+	}
+	if row.EventTime.IsZero() {
+		row.EventTime = collectorTime
+	}
+	if parsed.MsgType == bmp.MsgTypePeerDown {
+		row.Event = "down"
+		row.ReasonCode = parsed.PeerDownReason
+		row.Notification = parsed.Notification
+		row.FSMEvent = parsed.FSMEvent
+	}
+	return row
+}
+
+// processPeerEvent logs a Peer Up or Peer Down and appends it to
+// peer_session_events.
+func (p *Pipeline) processPeerEvent(ctx context.Context, row *PeerEventRow) {
+	if row.RouterID == "" {
+		return
+	}
+
+	if row.Event == "down" {
+		fields := []zap.Field{
+			zap.String("router_id", row.RouterID),
+			zap.String("peer_address", row.PeerAddress),
+			zap.String("reason", bmp.PeerDownReasonName(row.ReasonCode)),
+		}
+		if n := row.Notification; n != nil {
+			fields = append(fields,
+				zap.String("notification", n.CodeName()+"/"+n.SubcodeName()),
+				zap.String("shutdown_message", n.ShutdownMessage),
+			)
+		}
+		p.logger.Info("BGP peer down", fields...)
+	}
+
+	if p.writer == nil || p.writer.pool == nil {
+		return
+	}
+	if err := p.writer.InsertPeerEvent(ctx, row); err != nil {
+		p.logger.Warn("failed to record peer session event",
+			zap.String("router_id", row.RouterID),
+			zap.String("peer_address", row.PeerAddress),
+			zap.String("event", row.Event),
+			zap.Error(err),
+		)
+	}
+}
+
+// processStatsReport exports the counters of a Statistics Report as gauges
+// and appends them to bmp_stats. Stats are low-volume (one report per peer
+// every stats interval), so they are written directly rather than batched.
+func (p *Pipeline) processStatsReport(ctx context.Context, rec *source.Record, parsed *bmp.ParsedBMP, routerID string) {
+	metrics.KafkaMessagesTotal.WithLabelValues("history", rec.Topic, "", "stats_report").Inc()
+
+	if routerID == "" || len(parsed.Stats) == 0 {
+		return
+	}
+
+	rows := make([]*StatsRow, 0, len(parsed.Stats))
+	for _, st := range parsed.Stats {
+		var afiStr, safiStr string
+		if st.AFI != 0 {
+			afiStr = fmt.Sprintf("%d", st.AFI)
+			safiStr = fmt.Sprintf("%d", st.SAFI)
+		}
+		metrics.BMPStatValue.WithLabelValues(routerID, parsed.PeerAddress, st.Name(), afiStr, safiStr).Set(float64(st.Value))
+
+		rows = append(rows, &StatsRow{
+			RouterID:    routerID,
+			PeerAddress: parsed.PeerAddress,
+			PeerAS:      parsed.PeerAS,
+			PeerBGPID:   parsed.PeerBGPID,
+			IsLocRIB:    parsed.IsLocRIB,
+			Stat:        st,
+		})
+	}
+
+	if p.writer == nil || p.writer.pool == nil {
+		return
+	}
+	if err := p.writer.InsertStats(ctx, rows); err != nil {
+		p.logger.Warn("failed to insert BMP statistics",
+			zap.String("router_id", routerID),
+			zap.String("peer_address", parsed.PeerAddress),
+			zap.Error(err),
+		)
+	}
+}
+
+// newMirroringRows builds one route_mirroring_events row per mirrored PDU,
+// or a single PDU-less row when the message only reports lost messages.
+func newMirroringRows(parsed *bmp.ParsedBMP, routerID string, collectorTime time.Time) []*MirroringRow {
+	base := MirroringRow{
+		RouterID:    routerID,
+		PeerAddress: parsed.PeerAddress,
+		PeerAS:      parsed.PeerAS,
+		PeerBGPID:   parsed.PeerBGPID,
+		IsLocRIB:    parsed.IsLocRIB,
+		EventTime:   parsed.Timestamp,
+	}
+	if base.EventTime.IsZero() {
+		base.EventTime = collectorTime
+	}
+	for _, code := range parsed.MirrorInfo {
+		switch code {
+		case bmp.MirrorInfoErroredPDU:
+			base.ErroredPDU = true
+		case bmp.MirrorInfoMessagesLost:
+			base.MessagesLost = true
+		}
+	}
+
+	if len(parsed.MirroredPDUs) == 0 {
+		if !base.MessagesLost {
+			return nil
+		}
+		return []*MirroringRow{&base}
+	}
+	rows := make([]*MirroringRow, 0, len(parsed.MirroredPDUs))
+	for _, pdu := range parsed.MirroredPDUs {
+		row := base
+		row.PDU = pdu
+		rows = append(rows, &row)
+	}
+	return rows
+}
+
+// processRouteMirroring counts a Route Mirroring message and appends its
+// PDUs to route_mirroring_events. Mirroring is rare (typically errored
+// UPDATEs a router treated as withdraw), so rows are written directly.
+func (p *Pipeline) processRouteMirroring(ctx context.Context, rec *source.Record, parsed *bmp.ParsedBMP, rows []*MirroringRow) {
+	metrics.KafkaMessagesTotal.WithLabelValues("history", rec.Topic, "", "route_mirroring").Inc()
+
+	info := "none"
+	for _, code := range parsed.MirrorInfo {
+		switch code {
+		case bmp.MirrorInfoErroredPDU:
+			info = "errored_pdu"
+		case bmp.MirrorInfoMessagesLost:
+			if info == "none" {
+				info = "messages_lost"
+			}
+		}
+	}
+	metrics.BMPRouteMirroringTotal.WithLabelValues(info).Inc()
+
+	if len(rows) == 0 || rows[0].RouterID == "" {
+		return
+	}
+	if info == "errored_pdu" {
+		p.logger.Warn("BMP Route Mirroring: errored PDU",
+			zap.String("router_id", rows[0].RouterID),
+			zap.String("peer_address", parsed.PeerAddress),
+			zap.Int("pdus", len(parsed.MirroredPDUs)),
+		)
+	}
+
+	if p.writer == nil || p.writer.pool == nil {
+		return
+	}
+	if err := p.writer.InsertMirroring(ctx, rows); err != nil {
+		p.logger.Warn("failed to insert BMP Route Mirroring",
+			zap.String("router_id", rows[0].RouterID),
+			zap.String("peer_address", parsed.PeerAddress),
+			zap.Error(err),
+		)
+	}
+}
+
+// processTermination records a BMP Termination in bmp_session_log. Route
+// state is purged by the state pipeline; this only keeps the audit trail.
+func (p *Pipeline) processTermination(ctx context.Context, rec *source.Record, parsed *bmp.ParsedBMP, obmpRouterIP string) {
+	metrics.KafkaMessagesTotal.WithLabelValues("history", rec.Topic, "", "termination").Inc()
+
+	routerID := obmpRouterIP
+	if cached, ok := p.speakerRouterIDs[obmpRouterIP]; ok {
+		routerID = cached
+	}
+	if routerID == "" {
+		return
+	}
+
+	p.logger.Info("BMP Termination received",
+		zap.String("router_id", routerID),
+		zap.Uint16("reason_code", parsed.TermReason),
+		zap.String("reason", bmp.TermReasonName(parsed.TermReason)),
+		zap.String("info", parsed.TermInfo),
+	)
+
+	if p.writer == nil || p.writer.pool == nil {
+		return
+	}
+	row := &SessionLogRow{
+		RouterID:   routerID,
+		RouterIP:   obmpRouterIP,
+		Event:      "termination",
+		ReasonCode: parsed.TermReason,
+		Reason:     bmp.TermReasonName(parsed.TermReason),
+		Info:       parsed.TermInfo,
+	}
+	if err := p.writer.InsertSessionLog(ctx, row); err != nil {
+		p.logger.Warn("failed to record BMP Termination",
+			zap.String("router_id", routerID),
+			zap.Error(err),
+		)
+	}
+}
+
+// processEndOfSession records a listener session that closed without a BMP
+// Termination in bmp_session_log and forgets its per-session state, as a
+// Termination does (see source.Record.EndOfSession).
+func (p *Pipeline) processEndOfSession(ctx context.Context, rec *source.Record) {
+	p.forgetSession(rec.RouterHash)
+	metrics.KafkaMessagesTotal.WithLabelValues("history", rec.Topic, "", "session_closed").Inc()
+
+	routerID := rec.RouterIP
+	if cached, ok := p.speakerRouterIDs[rec.RouterIP]; ok {
+		routerID = cached
+	}
+	if routerID == "" || p.writer == nil || p.writer.pool == nil {
+		return
+	}
+	row := &SessionLogRow{
+		RouterID: routerID,
+		RouterIP: rec.RouterIP,
+		Event:    "closed",
+	}
+	if rec.SessionReplaced {
+		row.Info = "replaced by a newer session"
+	}
+	if err := p.writer.InsertSessionLog(ctx, row); err != nil {
+		p.logger.Warn("failed to record BMP session close",
+			zap.String("router_id", routerID),
+			zap.Error(err),
+		)
+	}
+}
+
+// forgetSession drops the per-session state of the BMP session
+// obmpRouterHash.
+func (p *Pipeline) forgetSession(obmpRouterHash string) {
+	p.peerSessions.ForgetRouter(obmpRouterHash)
+	delete(p.routerIDCache, obmpRouterHash)
+}
+
+func (p *Pipeline) processLocRIBPeerUp(ctx context.Context, rec *source.Record, parsed *bmp.ParsedBMP) {
 	metrics.KafkaMessagesTotal.WithLabelValues("history", rec.Topic, "", "peer_up_locrib").Inc()
 
 	routerID := parsed.LocalBGPID
@@ -266,7 +659,7 @@ func (p *Pipeline) processLocRIBPeerUp(ctx context.Context, rec *kgo.Record, par
 	)
 }
 
-func (p *Pipeline) processPeerUpASN(ctx context.Context, rec *kgo.Record, parsed *bmp.ParsedBMP, obmpRouterIP, obmpRouterHash string) {
+func (p *Pipeline) processPeerUpASN(ctx context.Context, rec *source.Record, parsed *bmp.ParsedBMP, obmpRouterIP, obmpRouterHash string) {
 	// Use the BGP Identifier from the Sent OPEN as the router ID.
 	// The OBMP header's router IP is unreliable for Peer Up messages:
 	// goBMP populates it with the monitored peer's address, not the
@@ -317,7 +710,7 @@ func (p *Pipeline) processPeerUpASN(ctx context.Context, rec *kgo.Record, parsed
 	)
 }
 
-func (p *Pipeline) flush(ctx context.Context, batch []*HistoryRow, records []*kgo.Record, flushed chan<- []*kgo.Record) bool {
+func (p *Pipeline) flush(ctx context.Context, batch []*HistoryRow, records []*source.Record, flushed chan<- []*source.Record) bool {
 	inserted, err := p.writer.FlushBatch(ctx, batch)
 	if err != nil {
 		p.logger.Error("history batch flush failed", zap.Error(err))
@@ -330,7 +723,7 @@ func (p *Pipeline) flush(ctx context.Context, batch []*HistoryRow, records []*kg
 		zap.Int64("deduped", int64(len(batch))-inserted),
 	)
 
-	// Update rib_sync_status.last_raw_msg_time for each router/table/afi seen.
+	// Update rib_sync_status.last_raw_msg_time for each router/table/afi/safi seen.
 	p.updateSyncStatus(ctx, batch)
 
 	// Signal successful flush for offset commit.
@@ -342,29 +735,41 @@ func (p *Pipeline) flush(ctx context.Context, batch []*HistoryRow, records []*kg
 	return true
 }
 
-// updateSyncStatus updates last_raw_msg_time for each unique router/table/afi in the batch.
+// updateSyncStatus updates last_raw_msg_time for each unique router/table/afi/safi in the batch,
+// to the latest event time of its rows.
 func (p *Pipeline) updateSyncStatus(ctx context.Context, batch []*HistoryRow) {
-	type key struct{ r, t string; a int }
-	seen := make(map[key]bool)
+	type key struct {
+		r, t string
+		a    int
+		s    uint8
+	}
+	latest := make(map[key]time.Time)
+	var keys []key
 
 	for _, row := range batch {
 		if !row.IsLocRIB {
 			continue
 		}
-		k := key{row.RouterID, row.TableName, row.Event.AFI}
-		if seen[k] {
-			continue
+		k := key{row.RouterID, row.TableName, row.Route.AFI, row.Route.SAFI}
+		t, seen := latest[k]
+		if !seen {
+			keys = append(keys, k)
 		}
-		seen[k] = true
+		if row.EventTime.After(t) {
+			t = row.EventTime
+		}
+		latest[k] = t
+	}
 
-		if err := p.writer.UpdateSyncStatus(ctx, row.RouterID, row.TableName, row.Event.AFI); err != nil {
+	for _, k := range keys {
+		if err := p.writer.UpdateSyncStatus(ctx, k.r, k.t, k.a, k.s, latest[k]); err != nil {
 			p.logger.Warn("failed to update sync status for raw msg",
-				zap.String("router_id", row.RouterID),
+				zap.String("router_id", k.r),
 				zap.Error(err),
 			)
 		}
 
-		afiStr := fmt.Sprintf("%d", row.Event.AFI)
-		metrics.LastMsgTimestamp.WithLabelValues("history", row.RouterID, row.TableName, afiStr).SetToCurrentTime()
+		afiStr := fmt.Sprintf("%d", k.a)
+		metrics.LastMsgTimestamp.WithLabelValues("history", k.r, k.t, afiStr).SetToCurrentTime()
 	}
 }
@@ -5,16 +5,24 @@ import (
 	"context"
 	"encoding/binary"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/route-beacon/rib-ingester/internal/bgp"
 	"github.com/route-beacon/rib-ingester/internal/bmp"
 	"github.com/route-beacon/rib-ingester/internal/config"
-	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+	"github.com/route-beacon/rib-ingester/internal/source"
 	"go.uber.org/zap"
 )
 
 // --- Test helpers for building OpenBMP / BMP / BGP frames ---
 
+// rowEvent renders the route of a history row as FlushBatch does.
+func rowEvent(row *HistoryRow) *bgp.RouteEvent {
+	return bgp.RenderEvents([]*bgp.Route{row.Route})[0]
+}
+
 // buildBGPUpdate constructs a BGP UPDATE message with the given components.
 func buildBGPUpdate(withdrawn []byte, pathAttrs []byte, nlri []byte) []byte {
 	bodyLen := 2 + len(withdrawn) + 2 + len(pathAttrs) + len(nlri)
@@ -60,6 +68,12 @@ func buildPathAttr(flags byte, typeCode byte, data []byte) []byte {
 	return attr
 }
 
+// wellKnownAttrs returns ORIGIN IGP and an empty AS_PATH, the well-known
+// mandatory attributes of an UPDATE announcing routes.
+func wellKnownAttrs() []byte {
+	return append(buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0}), buildPathAttr(0x40, bgp.AttrTypeASPath, nil)...)
+}
+
 // buildPerPeerHeader constructs a 42-byte BMP per-peer header.
 // peerType: 0=Global, 1=RD, 2=Local, 3=LocRIB
 // peerAddr: 4-byte IPv4 address (12 zero bytes + 4 IPv4, per BMP spec).
@@ -229,30 +243,31 @@ func TestHistoryProcessRecord_BasicRoute(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	if len(rows) != 1 {
 		t.Fatalf("expected 1 HistoryRow, got %d", len(rows))
 	}
 	row := rows[0]
-	if row.Event.Prefix != "10.0.0.0/24" {
-		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", row.Event.Prefix)
+	ev := rowEvent(row)
+	if ev.Prefix != "10.0.0.0/24" {
+		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", ev.Prefix)
 	}
-	if row.Event.AFI != 4 {
-		t.Errorf("expected AFI 4, got %d", row.Event.AFI)
+	if ev.AFI != 4 {
+		t.Errorf("expected AFI 4, got %d", ev.AFI)
 	}
-	if row.Event.Action != "A" {
-		t.Errorf("expected action 'A', got '%s'", row.Event.Action)
+	if ev.Action != "A" {
+		t.Errorf("expected action 'A', got '%s'", ev.Action)
 	}
-	if row.Event.Nexthop != "192.168.1.1" {
-		t.Errorf("expected nexthop '192.168.1.1', got '%s'", row.Event.Nexthop)
+	if ev.Nexthop != "192.168.1.1" {
+		t.Errorf("expected nexthop '192.168.1.1', got '%s'", ev.Nexthop)
 	}
-	if row.Event.ASPath != "65001 65002" {
-		t.Errorf("expected as_path '65001 65002', got '%s'", row.Event.ASPath)
+	if ev.ASPath != "65001 65002" {
+		t.Errorf("expected as_path '65001 65002', got '%s'", ev.ASPath)
 	}
-	if row.Event.Origin != "IGP" {
-		t.Errorf("expected origin 'IGP', got '%s'", row.Event.Origin)
+	if ev.Origin != "IGP" {
+		t.Errorf("expected origin 'IGP', got '%s'", ev.Origin)
 	}
 	if row.TableName != "locrib" {
 		t.Errorf("expected TableName 'locrib', got '%s'", row.TableName)
@@ -273,9 +288,9 @@ func TestHistoryProcessRecord_NonLocRIBPeerFields(t *testing.T) {
 
 	// Build with peer_type=0 (Global). Non-Loc-RIB is now processed for history.
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	// Non-Loc-RIB Route Monitoring with post-policy flag (L-bit).
@@ -285,7 +300,7 @@ func TestHistoryProcessRecord_NonLocRIBPeerFields(t *testing.T) {
 	bmpMsg[36] = 10; bmpMsg[37] = 0; bmpMsg[38] = 0; bmpMsg[39] = 1
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	if len(rows) != 1 {
@@ -307,11 +322,11 @@ func TestHistoryProcessRecord_NonLocRIBPeerFields(t *testing.T) {
 	if !row.IsPostPolicy {
 		t.Error("expected IsPostPolicy=true for L-flag=1 peer")
 	}
-	if row.Event.Prefix != "10.0.0.0/24" {
-		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", row.Event.Prefix)
+	if row.Route.Prefix.String() != "10.0.0.0/24" {
+		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", row.Route.Prefix.String())
 	}
-	if row.Event.Action != "A" {
-		t.Errorf("expected action 'A', got '%s'", row.Event.Action)
+	if row.Route.Action != "A" {
+		t.Errorf("expected action 'A', got '%s'", row.Route.Action)
 	}
 }
 
@@ -324,7 +339,7 @@ func TestHistoryProcessRecord_SkipEOR(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	if len(rows) != 0 {
@@ -341,15 +356,15 @@ func TestHistoryProcessRecord_MultiPrefix(t *testing.T) {
 		24, 10, 0, 1, // 10.0.1.0/24
 		24, 10, 0, 2, // 10.0.2.0/24
 	}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	if len(rows) != 3 {
@@ -359,7 +374,7 @@ func TestHistoryProcessRecord_MultiPrefix(t *testing.T) {
 	// Verify all 3 prefixes are present.
 	prefixes := make(map[string]bool)
 	for _, row := range rows {
-		prefixes[row.Event.Prefix] = true
+		prefixes[row.Route.Prefix.String()] = true
 	}
 	for _, expected := range []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"} {
 		if !prefixes[expected] {
@@ -372,7 +387,7 @@ func TestHistoryProcessRecord_MultiPrefix(t *testing.T) {
 		for j := i + 1; j < len(rows); j++ {
 			if bytes.Equal(rows[i].EventID, rows[j].EventID) {
 				t.Errorf("rows[%d] and rows[%d] have the same EventID (prefix=%s, prefix=%s) -- per-prefix event IDs broken",
-					i, j, rows[i].Event.Prefix, rows[j].Event.Prefix)
+					i, j, rows[i].Route.Prefix, rows[j].Route.Prefix)
 			}
 		}
 	}
@@ -384,9 +399,9 @@ func TestHistoryProcessRecord_MultiMessage(t *testing.T) {
 	// Build two separate BMP Route Monitoring messages, each with one prefix,
 	// and concatenate them in a single OpenBMP frame.
 	nlri1 := []byte{24, 10, 0, 0} // 10.0.0.0/24
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate1 := buildBGPUpdate(nil, pathAttrs, nlri1)
 	bmpMsg1 := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate1, "locrib")
 
@@ -406,7 +421,7 @@ func TestHistoryProcessRecord_MultiMessage(t *testing.T) {
 	binary.BigEndian.PutUint32(frame[6:10], uint32(len(combined)))
 	copy(frame[bmp.OpenBMPHeaderSize:], combined)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	if len(rows) != 2 {
@@ -415,7 +430,7 @@ func TestHistoryProcessRecord_MultiMessage(t *testing.T) {
 
 	prefixes := make(map[string]bool)
 	for _, row := range rows {
-		prefixes[row.Event.Prefix] = true
+		prefixes[row.Route.Prefix.String()] = true
 	}
 	if !prefixes["10.0.0.0/24"] {
 		t.Error("expected prefix '10.0.0.0/24' from first BMP message")
@@ -434,7 +449,7 @@ func TestHistoryProcessRecord_PeerUpASN(t *testing.T) {
 	peerUpMsg := buildBMPPeerUp(bmp.PeerTypeGlobal, 65001, false)
 	frame := wrapOpenBMPV17(peerUpMsg, [4]byte{10, 0, 0, 1})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	// Peer Up should not produce route rows.
@@ -455,7 +470,7 @@ func TestHistoryProcessRecord_PeerUpASN_CacheHit(t *testing.T) {
 	frame := wrapOpenBMPV17(peerUpMsg, [4]byte{10, 0, 0, 1})
 
 	// First Peer Up — populates cache.
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	p.processRecord(context.Background(), rec)
 
 	if p.asnCache["10.0.0.1"] != 65001 {
@@ -477,7 +492,7 @@ func TestHistoryProcessRecord_PeerUpASN_DifferentASN(t *testing.T) {
 
 	// First Peer Up with ASN 65001.
 	frame1 := wrapOpenBMPV17(buildBMPPeerUp(bmp.PeerTypeGlobal, 65001, false), [4]byte{10, 0, 0, 1})
-	p.processRecord(context.Background(), &kgo.Record{Value: frame1, Topic: "gobmp.raw"})
+	p.processRecord(context.Background(), &source.Record{Value: frame1, Topic: "gobmp.raw"})
 
 	if p.asnCache["10.0.0.1"] != 65001 {
 		t.Fatalf("expected asnCache=65001 after first Peer Up")
@@ -501,7 +516,7 @@ func TestHistoryProcessRecord_PeerUpLocRIB_NoASN(t *testing.T) {
 	peerUpMsg := buildBMPPeerUp(bmp.PeerTypeLocRIB, 0, false)
 	frame := wrapOpenBMPV17(peerUpMsg, [4]byte{10, 0, 0, 1})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	if len(rows) != 0 {
@@ -529,7 +544,7 @@ func TestHistoryProcessRecord_LocRIBPeerUp_RegistersRouter(t *testing.T) {
 	// The handler should use the BGP ID, not the OBMP IP.
 	frame := wrapOpenBMPV17(peerUpMsg, [4]byte{0, 0, 0, 0})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	rows := p.processRecord(context.Background(), rec)
 
 	if len(rows) != 0 {
@@ -549,7 +564,7 @@ func TestHistoryProcessRecord_PeerUp4ByteASN(t *testing.T) {
 	peerUpMsg := buildBMPPeerUp(bmp.PeerTypeGlobal, 400000, true)
 	frame := wrapOpenBMPV17(peerUpMsg, [4]byte{10, 0, 0, 1})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	p.processRecord(context.Background(), rec)
 
 	if p.asnCache["10.0.0.1"] != 400000 {
@@ -594,7 +609,7 @@ func TestHistoryProcessRecord_PeerUpASN_UsesBGPIDNotOBMPIP(t *testing.T) {
 	peerUpMsg := buildBMPPeerUp(bmp.PeerTypeGlobal, 65002, false)
 	frame := wrapOpenBMPV17(peerUpMsg, [4]byte{172, 30, 0, 30}) // wrong IP in OBMP
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	p.processRecord(context.Background(), rec)
 
 	// ASN must be cached under the BGP ID (10.0.0.1), not the OBMP IP (172.30.0.30).
@@ -605,3 +620,255 @@ func TestHistoryProcessRecord_PeerUpASN_UsesBGPIDNotOBMPIP(t *testing.T) {
 		t.Error("ASN should NOT be cached under OBMP peer IP 172.30.0.30")
 	}
 }
+
+// buildBMPStatsReport constructs a Loc-RIB BMP Statistics Report carrying a
+// single 64-bit Loc-RIB route count gauge.
+func buildBMPStatsReport(routerBGPID [4]byte, locRibRoutes uint64) []byte {
+	totalLen := bmp.CommonHeaderSize + bmp.PerPeerHeaderSize + 4 + 4 + 8
+	msg := make([]byte, totalLen)
+	msg[0] = 3 // BMP version
+	binary.BigEndian.PutUint32(msg[1:5], uint32(totalLen))
+	msg[5] = bmp.MsgTypeStatisticsReport
+	msg[bmp.CommonHeaderSize] = bmp.PeerTypeLocRIB
+	copy(msg[bmp.CommonHeaderSize+30:bmp.CommonHeaderSize+34], routerBGPID[:])
+
+	offset := bmp.CommonHeaderSize + bmp.PerPeerHeaderSize
+	binary.BigEndian.PutUint32(msg[offset:offset+4], 1) // stats count
+	binary.BigEndian.PutUint16(msg[offset+4:offset+6], bmp.StatTypeLocRibRoutes)
+	binary.BigEndian.PutUint16(msg[offset+6:offset+8], 8)
+	binary.BigEndian.PutUint64(msg[offset+8:offset+16], locRibRoutes)
+	return msg
+}
+
+func TestHistoryProcessRecord_StatsReportSetsGauge(t *testing.T) {
+	p := newTestHistoryPipeline()
+
+	frame := wrapOpenBMP(buildBMPStatsReport([4]byte{10, 0, 0, 9}, 912345))
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
+	rows := p.processRecord(context.Background(), rec)
+
+	if len(rows) != 0 {
+		t.Fatalf("expected no history rows for a Statistics Report, got %d", len(rows))
+	}
+	got := testutil.ToFloat64(metrics.BMPStatValue.WithLabelValues("10.0.0.9", "", "loc_rib_routes", "", ""))
+	if got != 912345 {
+		t.Errorf("expected loc_rib_routes gauge 912345, got %v", got)
+	}
+}
+
+func TestHistoryProcessRecord_TerminationNoRows(t *testing.T) {
+	p := newTestHistoryPipeline()
+	speaker := [4]byte{192, 0, 2, 1}
+
+	nlri := []byte{24, 10, 0, 0}
+	update := buildBGPUpdate(nil, buildPathAttr(0x40, 1, []byte{0}), nlri)
+	rm := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, update, "")
+	p.processRecord(context.Background(), &source.Record{Value: wrapOpenBMPV17(rm, speaker), Topic: "gobmp.raw"})
+
+	if got := p.speakerRouterIDs["192.0.2.1"]; got != "10.0.0.1" {
+		t.Fatalf("expected speaker 192.0.2.1 mapped to router 10.0.0.1, got %q", got)
+	}
+
+	term := make([]byte, bmp.CommonHeaderSize+6)
+	term[0] = 3
+	binary.BigEndian.PutUint32(term[1:5], uint32(len(term)))
+	term[5] = bmp.MsgTypeTermination
+	binary.BigEndian.PutUint16(term[6:8], bmp.TermTLVTypeReason)
+	binary.BigEndian.PutUint16(term[8:10], 2)
+	binary.BigEndian.PutUint16(term[10:12], bmp.TermReasonPermAdminClose)
+
+	rows := p.processRecord(context.Background(), &source.Record{Value: wrapOpenBMPV17(term, speaker), Topic: "gobmp.raw"})
+	if len(rows) != 0 {
+		t.Errorf("expected no history rows for a Termination, got %d", len(rows))
+	}
+}
+
+func TestHistoryProcessRecord_EventTime(t *testing.T) {
+	nlri := []byte{24, 10, 0, 0}
+	pathAttrs := wellKnownAttrs()
+	pathAttrs = append(pathAttrs, buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})...)
+	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
+
+	routerTS := time.Unix(1700000000, 123000).UTC()
+	collectorTS := time.Unix(1700000100, 0).UTC()
+
+	withRouterTS := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{}, bgpUpdate, "locrib")
+	// Per-peer header ts_sec/ts_usec at common header (6) + 34.
+	binary.BigEndian.PutUint32(withRouterTS[40:44], uint32(routerTS.Unix()))
+	binary.BigEndian.PutUint32(withRouterTS[44:48], 123)
+	noRouterTS := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{}, bgpUpdate, "locrib")
+
+	collectorFrame := func(bmpMsg []byte) []byte {
+		frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 1})
+		binary.BigEndian.PutUint32(frame[14:18], uint32(collectorTS.Unix()))
+		return frame
+	}
+
+	tests := []struct {
+		name string
+		rec  *source.Record
+		want time.Time
+	}{
+		{"router timestamp wins", &source.Record{Value: collectorFrame(withRouterTS)}, routerTS},
+		{"collector fallback", &source.Record{Value: collectorFrame(noRouterTS)}, collectorTS},
+		{"listener fallback", &source.Record{Value: noRouterTS, Raw: true, RouterIP: "10.0.0.1", ReceivedAt: collectorTS}, collectorTS},
+		{"unknown", &source.Record{Value: wrapOpenBMP(noRouterTS)}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := newTestHistoryPipeline().processRecord(context.Background(), tt.rec)
+			if len(rows) != 1 {
+				t.Fatalf("expected 1 row, got %d", len(rows))
+			}
+			if !rows[0].EventTime.Equal(tt.want) {
+				t.Errorf("expected EventTime %v, got %v", tt.want, rows[0].EventTime)
+			}
+		})
+	}
+}
+
+func TestNewPeerEventRow(t *testing.T) {
+	routerTS := time.Unix(1700000000, 0).UTC()
+	collectorTS := time.Unix(1700000100, 0).UTC()
+	notif := &bgp.Notification{Code: bgp.NotifCease, Subcode: bgp.CeaseAdministrativeShutdown, ShutdownMessage: "maintenance"}
+
+	tests := []struct {
+		name   string
+		parsed *bmp.ParsedBMP
+		want   PeerEventRow
+	}{
+		{
+			name: "peer up uses router timestamp",
+			parsed: &bmp.ParsedBMP{
+				MsgType: bmp.MsgTypePeerUp, TableName: "UNKNOWN", Timestamp: routerTS,
+				PeerAddress: "192.0.2.2", PeerAS: 65002,
+			},
+			want: PeerEventRow{
+				RouterID: "10.0.0.1", PeerAddress: "192.0.2.2", PeerAS: 65002,
+				Event: "up", EventTime: routerTS,
+			},
+		},
+		{
+			name: "peer down with notification",
+			parsed: &bmp.ParsedBMP{
+				MsgType: bmp.MsgTypePeerDown, TableName: "UNKNOWN", PeerAddress: "192.0.2.2",
+				PeerDownReason: bmp.PeerDownRemoteNotification, Notification: notif,
+			},
+			want: PeerEventRow{
+				RouterID: "10.0.0.1", PeerAddress: "192.0.2.2", Event: "down", EventTime: collectorTS,
+				ReasonCode: bmp.PeerDownRemoteNotification, Notification: notif,
+			},
+		},
+		{
+			name: "loc-rib peer down keeps table name",
+			parsed: &bmp.ParsedBMP{
+				MsgType: bmp.MsgTypePeerDown, IsLocRIB: true, TableName: "locrib",
+				PeerDownReason: bmp.PeerDownLocalNoNotification, FSMEvent: 18, Timestamp: routerTS,
+			},
+			want: PeerEventRow{
+				RouterID: "10.0.0.1", IsLocRIB: true, TableName: "locrib", Event: "down", EventTime: routerTS,
+				ReasonCode: bmp.PeerDownLocalNoNotification, FSMEvent: 18,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newPeerEventRow(tt.parsed, "10.0.0.1", collectorTS)
+			if *got != tt.want {
+				t.Errorf("unexpected row:\n got %+v\nwant %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryProcessRecord_PeerDownNoRows(t *testing.T) {
+	p := newTestHistoryPipeline()
+
+	up := buildBMPPeerUp(bmp.PeerTypeGlobal, 65001, false)
+	rec := func(msg []byte) *source.Record {
+		return &source.Record{Value: msg, Raw: true, RouterIP: "192.0.2.1", RouterHash: "conn-1"}
+	}
+	p.processRecord(context.Background(), rec(up))
+	if len(p.peerSessions) != 1 {
+		t.Fatalf("expected 1 cached session after Peer Up, got %d", len(p.peerSessions))
+	}
+
+	down := make([]byte, bmp.CommonHeaderSize+bmp.PerPeerHeaderSize+3)
+	down[0] = 3
+	binary.BigEndian.PutUint32(down[1:5], uint32(len(down)))
+	down[5] = bmp.MsgTypePeerDown
+	down[48] = bmp.PeerDownLocalNoNotification
+	binary.BigEndian.PutUint16(down[49:51], 18)
+
+	rows := p.processRecord(context.Background(), rec(down))
+	if len(rows) != 0 {
+		t.Errorf("expected no history rows for a Peer Down, got %d", len(rows))
+	}
+	if len(p.peerSessions) != 0 {
+		t.Errorf("expected Peer Down to drop the cached session, got %d", len(p.peerSessions))
+	}
+}
+
+func TestHistoryProcessRecord_ListenerEndOfSession(t *testing.T) {
+	p := newTestHistoryPipeline()
+
+	rec := &source.Record{Value: buildBMPPeerUp(bmp.PeerTypeGlobal, 65001, false), Raw: true, RouterIP: "192.0.2.1", RouterHash: "conn-1"}
+	p.processRecord(context.Background(), rec)
+	if len(p.peerSessions) != 1 || len(p.routerIDCache) != 1 {
+		t.Fatalf("expected the Peer Up to be cached, got %d sessions and %d router IDs", len(p.peerSessions), len(p.routerIDCache))
+	}
+
+	end := &source.Record{Topic: "bmp.listener", Raw: true, RouterIP: "192.0.2.1", RouterHash: "conn-1", EndOfSession: true}
+	if rows := p.processRecord(context.Background(), end); len(rows) != 0 {
+		t.Errorf("expected no history rows at the end of a session, got %d", len(rows))
+	}
+	if len(p.peerSessions) != 0 || len(p.routerIDCache) != 0 {
+		t.Errorf("expected the session's state to be dropped, got %d sessions and %d router IDs", len(p.peerSessions), len(p.routerIDCache))
+	}
+}
+
+func TestHistoryProcessRecord_RouteMirroring(t *testing.T) {
+	pdu := buildBGPUpdate(nil, buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{7}), []byte{24, 10, 0, 0})
+	tlv := func(typ uint16, value []byte) []byte {
+		b := make([]byte, 4+len(value))
+		binary.BigEndian.PutUint16(b[0:2], typ)
+		binary.BigEndian.PutUint16(b[2:4], uint16(len(value)))
+		copy(b[4:], value)
+		return b
+	}
+	body := tlv(bmp.MirrorTLVTypeInformation, []byte{0, byte(bmp.MirrorInfoErroredPDU)})
+	body = append(body, tlv(bmp.MirrorTLVTypeBGPMessage, pdu)...)
+
+	msg := make([]byte, bmp.CommonHeaderSize, bmp.CommonHeaderSize+len(body))
+	msg[0] = 3
+	msg[5] = bmp.MsgTypeRouteMirroring
+	msg = append(msg, buildPerPeerHeader(bmp.PeerTypeGlobal, 0, [4]byte{192, 0, 2, 1})...)
+	msg = append(msg, body...)
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(msg)))
+
+	before := testutil.ToFloat64(metrics.BMPRouteMirroringTotal.WithLabelValues("errored_pdu"))
+	p := newTestHistoryPipeline()
+	rows := p.processRecord(context.Background(), &source.Record{Value: wrapOpenBMP(msg), Topic: "gobmp.raw"})
+	if len(rows) != 0 {
+		t.Errorf("expected no route_events rows for Route Mirroring, got %d", len(rows))
+	}
+	if got := testutil.ToFloat64(metrics.BMPRouteMirroringTotal.WithLabelValues("errored_pdu")); got != before+1 {
+		t.Errorf("expected errored_pdu counter to increase by 1, got %v -> %v", before, got)
+	}
+
+	parsed, err := bmp.Parse(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	collectorTS := time.Unix(1700000100, 0).UTC()
+	mrows := newMirroringRows(parsed, "10.0.0.1", collectorTS)
+	if len(mrows) != 1 {
+		t.Fatalf("expected 1 mirroring row, got %d", len(mrows))
+	}
+	if !mrows[0].ErroredPDU || mrows[0].MessagesLost || !bytes.Equal(mrows[0].PDU, pdu) {
+		t.Errorf("unexpected mirroring row %+v", mrows[0])
+	}
+	if !mrows[0].EventTime.Equal(collectorTS) {
+		t.Errorf("expected collector time fallback, got %v", mrows[0].EventTime)
+	}
+}
@@ -0,0 +1,43 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+)
+
+// SessionLogRow represents a BMP session lifecycle event for bmp_session_log.
+type SessionLogRow struct {
+	RouterID   string
+	RouterIP   string
+	Event      string // "termination", or "closed" for a listener session closed without one
+	ReasonCode uint16
+	Reason     string
+	Info       string
+}
+
+// InsertSessionLog appends a BMP session lifecycle event to bmp_session_log.
+func (w *Writer) InsertSessionLog(ctx context.Context, row *SessionLogRow) error {
+	start := time.Now()
+
+	// Only a Termination carries a reason.
+	var reasonCode any
+	if row.Reason != "" {
+		reasonCode = int32(row.ReasonCode)
+	}
+	_, err := w.pool.Exec(ctx, `
+		INSERT INTO bmp_session_log (router_id, router_ip, event, reason_code, reason, info, logged_at)
+		VALUES ($1, $2, $3, $4, $5, $6, now())`,
+		row.RouterID, nilIfEmpty(row.RouterIP), row.Event, reasonCode,
+		nilIfEmpty(row.Reason), nilIfEmpty(row.Info),
+	)
+	if err != nil {
+		return fmt.Errorf("insert bmp_session_log: %w", err)
+	}
+
+	metrics.DBWriteDuration.WithLabelValues("history", "session_log").Observe(time.Since(start).Seconds())
+	metrics.DBRowsAffectedTotal.WithLabelValues("history", "bmp_session_log", "insert").Inc()
+	return nil
+}
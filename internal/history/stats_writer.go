@@ -0,0 +1,66 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/route-beacon/rib-ingester/internal/bmp"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+)
+
+// StatsRow represents a single stat counter to insert into bmp_stats.
+type StatsRow struct {
+	RouterID    string
+	PeerAddress string // Empty for Loc-RIB
+	PeerAS      uint32
+	PeerBGPID   string
+	IsLocRIB    bool
+	Stat        bmp.Stat
+}
+
+const insertStatsSQL = `
+INSERT INTO bmp_stats (router_id, peer_address, peer_asn, peer_bgp_id, is_loc_rib,
+    stat_type, stat_name, afi, safi, value, collected_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now())`
+
+// InsertStats writes the counters of one or more Statistics Reports to bmp_stats.
+func (w *Writer) InsertStats(ctx context.Context, rows []*StatsRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+
+	batch := &pgx.Batch{}
+	for _, row := range rows {
+		var peerAddr, peerASN, peerBGPID any
+		if !row.IsLocRIB && row.PeerAddress != "" {
+			peerAddr = row.PeerAddress
+			peerASN = int64(row.PeerAS)
+			peerBGPID = nilIfEmpty(row.PeerBGPID)
+		}
+		var afi, safi any
+		if row.Stat.AFI != 0 {
+			afi = int32(row.Stat.AFI)
+			safi = int16(row.Stat.SAFI)
+		}
+
+		batch.Queue(insertStatsSQL,
+			row.RouterID, peerAddr, peerASN, peerBGPID, row.IsLocRIB,
+			int32(row.Stat.Type), row.Stat.Name(), afi, safi,
+			fmt.Sprintf("%d", row.Stat.Value),
+		)
+	}
+
+	if err := w.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("insert bmp_stats: %w", err)
+	}
+
+	dur := time.Since(start).Seconds()
+	metrics.DBWriteDuration.WithLabelValues("history", "stats").Observe(dur)
+	metrics.DBRowsAffectedTotal.WithLabelValues("history", "bmp_stats", "insert").Add(float64(len(rows)))
+
+	return nil
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/klauspost/compress/zstd"
+	"github.com/route-beacon/rib-ingester/internal/attrset"
 	"github.com/route-beacon/rib-ingester/internal/bgp"
+	"github.com/route-beacon/rib-ingester/internal/config"
 	"github.com/route-beacon/rib-ingester/internal/metrics"
 	"go.uber.org/zap"
 )
@@ -29,33 +31,64 @@ type Writer struct {
 	logger         *zap.Logger
 	storeRawBytes  bool
 	compressRaw    bool
+	attrSets       *attrset.Store
+	// Partitioning by event time (config.TimeAxisEvent): an event is filed
+	// by its router time, at most eventTimeDays days back.
+	eventTimeAxis bool
+	eventTimeDays int
 }
 
-func NewWriter(pool *pgxpool.Pool, logger *zap.Logger, storeRawBytes, compressRaw bool) *Writer {
+// NewWriter returns a history writer. timeAxis is retention.time_axis and
+// retentionDays retention.days; they decide the partition_time of events.
+func NewWriter(pool *pgxpool.Pool, logger *zap.Logger, storeRawBytes, compressRaw bool, timeAxis string, retentionDays int) *Writer {
 	return &Writer{
 		pool:          pool,
 		logger:        logger,
 		storeRawBytes: storeRawBytes,
 		compressRaw:   compressRaw,
+		attrSets:      attrset.NewStore(pool, "history", attrset.DefaultCacheSize),
+		eventTimeAxis: timeAxis == config.TimeAxisEvent,
+		eventTimeDays: max(retentionDays-1, 0),
 	}
 }
 
-// HistoryRow represents a single row to insert into route_events.
+// partitionTime returns the time row is partitioned by, or nil to
+// partition it by ingest time. The insert statements clamp it to
+// [now() - eventTimeDays days, now()]: the partition manager keeps that
+// range's partitions, so an event replayed from before the retention
+// window, or stamped by a router clock running ahead, lands in its oldest
+// or newest day instead of failing the batch.
+func (w *Writer) partitionTime(row *HistoryRow) any {
+	if !w.eventTimeAxis {
+		return nil
+	}
+	return nilIfZeroTime(row.EventTime)
+}
+
+// HistoryRow represents a single row to insert into route_events, or
+// evpn_events for EVPN routes.
 type HistoryRow struct {
 	EventID      []byte // 32-byte SHA256
 	RouterID     string
 	TableName    string
-	Event        *bgp.RouteEvent
+	EventTime    time.Time // Router timestamp, else collector timestamp; zero if neither is known
+	Route        *bgp.Route // rendered as a bgp.RouteEvent by FlushBatch
 	BMPRaw       []byte // Optional raw BMP bytes
 	Topic        string // For dedup metric labeling
 	PeerAddress  string // Peer's IP address (empty for Loc-RIB)
 	PeerAS       uint32 // Peer's ASN (0 for Loc-RIB)
 	PeerBGPID    string // Peer's BGP Identifier (empty for Loc-RIB)
 	IsPostPolicy bool
+	IsAdjRIBOut  bool
 	IsLocRIB     bool
+	// LeakSuspected marks Adj-RIB-In announcements that violate the RFC
+	// 9234 OTC ingress rules.
+	LeakSuspected bool
 }
 
-// FlushBatch inserts a batch of history rows into route_events.
+// FlushBatch inserts a batch of history rows into route_events,
+// evpn_events and flowspec_events. The attribute sets of route_events
+// rows are inserted into path_attributes first and referenced by hash.
 // Returns the number of rows actually inserted (after dedup).
 func (w *Writer) FlushBatch(ctx context.Context, rows []*HistoryRow) (int64, error) {
 	if len(rows) == 0 {
@@ -64,6 +97,23 @@ func (w *Writer) FlushBatch(ctx context.Context, rows []*HistoryRow) (int64, err
 
 	start := time.Now()
 
+	routes := make([]*bgp.Route, len(rows))
+	for i, row := range rows {
+		routes[i] = row.Route
+	}
+	events := bgp.RenderEvents(routes)
+
+	var sets attrset.Batch
+	attrHashes := make([][]byte, len(rows))
+	for i, ev := range events {
+		if ev.EVPN == nil && ev.FlowSpec == nil {
+			attrHashes[i] = sets.Add(attrset.FromEvent(ev))
+		}
+	}
+	if _, err := w.attrSets.Ensure(ctx, &sets); err != nil {
+		return 0, err
+	}
+
 	tx, err := w.pool.Begin(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("begin tx: %w", err)
@@ -72,18 +122,57 @@ func (w *Writer) FlushBatch(ctx context.Context, rows []*HistoryRow) (int64, err
 
 	const insertSQL = `
 		INSERT INTO route_events (event_id, ingest_time, router_id, table_name, afi,
-			prefix, path_id, action, nexthop, as_path, origin, localpref, med,
-			origin_asn, communities_std, communities_ext, communities_large, attrs, bmp_raw,
-			peer_address, peer_asn, peer_bgp_id, is_post_policy)
+			prefix, path_id, action, nexthop, bmp_raw,
+			peer_address, peer_asn, peer_bgp_id, is_post_policy, is_adj_rib_out, event_time,
+			leak_suspected, safi, labels, rd, nexthop_ll, prefix_sid, parse_warnings, attr_hash,
+			atomic_aggregate, partition_time)
+		VALUES ($1, now(), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+			$19, $20, $21, $22, $23, false,
+			LEAST(GREATEST(COALESCE($24, now()), now() - make_interval(days => $25)), now()))
+		ON CONFLICT (event_id, partition_time) DO NOTHING`
+
+	const insertEVPNSQL = `
+		INSERT INTO evpn_events (event_id, ingest_time, router_id, table_name,
+			route_type, rd, route_key, path_id, action,
+			esi, ethernet_tag, mac, ip_address, ip_prefix, gateway_ip, labels, vnis,
+			nexthop, as_path, origin, localpref, med,
+			communities_std, communities_ext, communities_large, attrs, bmp_raw,
+			peer_address, peer_asn, peer_bgp_id, is_post_policy, is_adj_rib_out, event_time,
+			originator_id, cluster_list, prefix_sid, parse_warnings, partition_time)
 		VALUES ($1, now(), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
-			$19, $20, $21, $22)
-		ON CONFLICT (event_id, ingest_time) DO NOTHING`
+			$19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36,
+			LEAST(GREATEST(COALESCE($37, now()), now() - make_interval(days => $38)), now()))
+		ON CONFLICT (event_id, partition_time) DO NOTHING`
+
+	const insertFlowSpecSQL = `
+		INSERT INTO flowspec_events (event_id, ingest_time, router_id, table_name,
+			afi, safi, rd, rule, path_id, action,
+			dst_prefix, src_prefix, protocols, ports, dst_ports, src_ports, icmp_types, icmp_codes,
+			tcp_flags, packet_lengths, dscp, fragment, flow_label, actions,
+			nexthop, as_path, origin, localpref, med,
+			communities_std, communities_ext, communities_large, attrs, bmp_raw,
+			peer_address, peer_asn, peer_bgp_id, is_post_policy, is_adj_rib_out, event_time,
+			originator_id, cluster_list, parse_warnings, partition_time)
+		VALUES ($1, now(), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18,
+			$19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36,
+			$37, $38, $39, $40, $41, $42,
+			LEAST(GREATEST(COALESCE($43, now()), now() - make_interval(days => $44)), now()))
+		ON CONFLICT (event_id, partition_time) DO NOTHING`
 
 	batch := &pgx.Batch{}
-	for _, row := range rows {
+	for i, row := range rows {
+		ev := events[i]
 		var attrsJSON []byte
-		if len(row.Event.Attrs) > 0 {
-			attrsJSON, _ = json.Marshal(row.Event.Attrs)
+		if len(ev.Attrs) > 0 {
+			attrsJSON, _ = json.Marshal(ev.Attrs)
+		}
+		var prefixSIDJSON []byte
+		if ev.PrefixSID != nil {
+			prefixSIDJSON, _ = json.Marshal(ev.PrefixSID)
+		}
+		var parseWarningsJSON []byte
+		if len(ev.ParseWarnings) > 0 {
+			parseWarningsJSON, _ = json.Marshal(ev.ParseWarnings)
 		}
 
 		var rawBytes []byte
@@ -98,23 +187,64 @@ func (w *Writer) FlushBatch(ctx context.Context, rows []*HistoryRow) (int64, err
 		// For Loc-RIB rows, peer columns are NULL.
 		var peerAddr, peerBGPID any
 		var peerASN any
-		var isPostPolicy any
+		var isPostPolicy, isAdjRIBOut any
 		if !row.IsLocRIB && row.PeerAddress != "" {
 			peerAddr = row.PeerAddress
 			peerASN = int64(row.PeerAS)
 			peerBGPID = nilIfEmpty(row.PeerBGPID)
 			isPostPolicy = row.IsPostPolicy
+			isAdjRIBOut = row.IsAdjRIBOut
+		}
+
+		if e := ev.EVPN; e != nil {
+			batch.Queue(insertEVPNSQL,
+				row.EventID, row.RouterID, row.TableName,
+				e.RouteType, e.RD, e.Key(), nilIfZero(ev.PathID), ev.Action,
+				nilIfEmpty(e.ESI), e.EthernetTag, nilIfEmpty(e.MAC), nilIfEmpty(e.IP),
+				nilIfEmpty(e.Prefix), nilIfEmpty(e.GatewayIP), e.Labels, e.VNIs,
+				nilIfEmpty(ev.Nexthop), nilIfEmpty(ev.ASPath),
+				nilIfEmpty(ev.Origin), ev.LocalPref, ev.MED,
+				ev.CommStd, ev.CommExt, ev.CommLarge,
+				attrsJSON, rawBytes,
+				peerAddr, peerASN, peerBGPID, isPostPolicy, isAdjRIBOut,
+				nilIfZeroTime(row.EventTime),
+				nilIfEmpty(ev.OriginatorID), ev.ClusterList, prefixSIDJSON, parseWarningsJSON,
+				w.partitionTime(row), w.eventTimeDays,
+			)
+			continue
+		}
+
+		if f := ev.FlowSpec; f != nil {
+			batch.Queue(insertFlowSpecSQL,
+				row.EventID, row.RouterID, row.TableName,
+				ev.AFI, ev.SAFI, ev.RD, f.Rule,
+				nilIfZero(ev.PathID), ev.Action,
+				nilIfEmpty(f.DstPrefix), nilIfEmpty(f.SrcPrefix),
+				nilIfEmpty(f.Protocols), nilIfEmpty(f.Ports), nilIfEmpty(f.DstPorts), nilIfEmpty(f.SrcPorts),
+				nilIfEmpty(f.ICMPTypes), nilIfEmpty(f.ICMPCodes), nilIfEmpty(f.TCPFlags),
+				nilIfEmpty(f.PacketLengths), nilIfEmpty(f.DSCP), nilIfEmpty(f.Fragment),
+				nilIfEmpty(f.FlowLabel), f.Actions,
+				nilIfEmpty(ev.Nexthop), nilIfEmpty(ev.ASPath),
+				nilIfEmpty(ev.Origin), ev.LocalPref, ev.MED,
+				ev.CommStd, ev.CommExt, ev.CommLarge,
+				attrsJSON, rawBytes,
+				peerAddr, peerASN, peerBGPID, isPostPolicy, isAdjRIBOut,
+				nilIfZeroTime(row.EventTime),
+				nilIfEmpty(ev.OriginatorID), ev.ClusterList, parseWarningsJSON,
+				w.partitionTime(row), w.eventTimeDays,
+			)
+			continue
 		}
 
 		batch.Queue(insertSQL,
-			row.EventID, row.RouterID, row.TableName, row.Event.AFI,
-			row.Event.Prefix, nilIfZero(row.Event.PathID), row.Event.Action,
-			nilIfEmpty(row.Event.Nexthop), nilIfEmpty(row.Event.ASPath),
-			nilIfEmpty(row.Event.Origin), row.Event.LocalPref, row.Event.MED,
-			bgp.OriginASN(row.Event.ASPath),
-			row.Event.CommStd, row.Event.CommExt, row.Event.CommLarge,
-			attrsJSON, rawBytes,
-			peerAddr, peerASN, peerBGPID, isPostPolicy,
+			row.EventID, row.RouterID, row.TableName, ev.AFI,
+			ev.Prefix, nilIfZero(ev.PathID), ev.Action,
+			nilIfEmpty(ev.Nexthop), rawBytes,
+			peerAddr, peerASN, peerBGPID, isPostPolicy, isAdjRIBOut,
+			nilIfZeroTime(row.EventTime),
+			row.LeakSuspected, ev.SAFI, ev.Labels, nilIfEmpty(ev.RD),
+			nilIfEmpty(ev.NexthopLL), prefixSIDJSON, parseWarningsJSON, attrHashes[i],
+			w.partitionTime(row), w.eventTimeDays,
 		)
 	}
 
@@ -148,14 +278,18 @@ func (w *Writer) FlushBatch(ctx context.Context, rows []*HistoryRow) (int64, err
 	return totalInserted, nil
 }
 
-// UpdateSyncStatus upserts the rib_sync_status row for a given router/table/afi.
-func (w *Writer) UpdateSyncStatus(ctx context.Context, routerID, tableName string, afi int) error {
+// UpdateSyncStatus upserts the rib_sync_status row for a given router/table/afi/safi.
+// eventTime is the router time of the latest message, see HistoryRow; the
+// ingester's clock is used when it is zero, and a router clock ahead of it
+// is capped to it. last_raw_msg_time never moves backwards on replays.
+func (w *Writer) UpdateSyncStatus(ctx context.Context, routerID, tableName string, afi int, safi uint8, eventTime time.Time) error {
 	_, err := w.pool.Exec(ctx, `
-		INSERT INTO rib_sync_status (router_id, table_name, afi, last_raw_msg_time, eor_seen, session_start_time, updated_at)
-		VALUES ($1, $2, $3, now(), false, now(), now())
-		ON CONFLICT (router_id, table_name, afi)
-		DO UPDATE SET last_raw_msg_time = now(), updated_at = now()`,
-		routerID, tableName, afi,
+		INSERT INTO rib_sync_status (router_id, table_name, afi, safi, last_raw_msg_time, eor_seen, session_start_time, updated_at)
+		VALUES ($1, $2, $3, $4, LEAST(COALESCE($5, now()), now()), false, LEAST(COALESCE($5, now()), now()), now())
+		ON CONFLICT (router_id, table_name, afi, safi)
+		DO UPDATE SET last_raw_msg_time = GREATEST(rib_sync_status.last_raw_msg_time, EXCLUDED.last_raw_msg_time),
+			updated_at = now()`,
+		routerID, tableName, afi, safi, nilIfZeroTime(eventTime),
 	)
 	return err
 }
@@ -167,6 +301,13 @@ func nilIfZero(v int64) any {
 	return v
 }
 
+func nilIfZeroTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
 func nilIfEmpty(s string) any {
 	if s == "" {
 		return nil
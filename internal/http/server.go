@@ -28,6 +28,7 @@ type Server struct {
 	dbChecker       DBChecker
 	stateConsumer   ConsumerStatus
 	historyConsumer ConsumerStatus
+	bmpListener     ConsumerStatus
 	logger          *zap.Logger
 }
 
@@ -55,6 +56,11 @@ func NewServer(addr string, pool *pgxpool.Pool, stateConsumer, historyConsumer C
 	return s
 }
 
+// SetBMPListener adds the native BMP listener to the readiness checks.
+func (s *Server) SetBMPListener(l ConsumerStatus) {
+	s.bmpListener = l
+}
+
 func (s *Server) Start() error {
 	ln, err := net.Listen("tcp", s.srv.Addr)
 	if err != nil {
@@ -99,20 +105,31 @@ func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
 		allOK = false
 	}
 
-	// Check Kafka state consumer.
-	if s.stateConsumer != nil && s.stateConsumer.IsJoined() {
-		checks["kafka_state"] = "ok"
-	} else {
-		checks["kafka_state"] = "not_joined"
-		allOK = false
+	// Check Kafka consumers. Both nil means Kafka is disabled (listener-only).
+	if s.stateConsumer != nil || s.historyConsumer != nil {
+		if s.stateConsumer != nil && s.stateConsumer.IsJoined() {
+			checks["kafka_state"] = "ok"
+		} else {
+			checks["kafka_state"] = "not_joined"
+			allOK = false
+		}
+
+		if s.historyConsumer != nil && s.historyConsumer.IsJoined() {
+			checks["kafka_history"] = "ok"
+		} else {
+			checks["kafka_history"] = "not_joined"
+			allOK = false
+		}
 	}
 
-	// Check Kafka history consumer.
-	if s.historyConsumer != nil && s.historyConsumer.IsJoined() {
-		checks["kafka_history"] = "ok"
-	} else {
-		checks["kafka_history"] = "not_joined"
-		allOK = false
+	// Check BMP listener.
+	if s.bmpListener != nil {
+		if s.bmpListener.IsJoined() {
+			checks["bmp_listener"] = "ok"
+		} else {
+			checks["bmp_listener"] = "not_listening"
+			allOK = false
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -176,3 +176,31 @@ func TestReadyz_AllHealthy(t *testing.T) {
 		t.Errorf("expected kafka_history 'ok', got '%v'", checks["kafka_history"])
 	}
 }
+
+func TestReadyz_ListenerOnly(t *testing.T) {
+	s := NewServer(":0", nil, nil, nil, zap.NewNop())
+	s.dbChecker = &mockDBChecker{err: nil}
+	s.SetBMPListener(&mockConsumer{joined: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	s.handleReadyz(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+
+	var body map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	checks := body["checks"].(map[string]any)
+	if checks["bmp_listener"] != "ok" {
+		t.Errorf("expected bmp_listener 'ok', got '%v'", checks["bmp_listener"])
+	}
+	if _, ok := checks["kafka_state"]; ok {
+		t.Error("expected no kafka_state check when Kafka is disabled")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/route-beacon/rib-ingester/internal/source"
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/sasl"
 	"go.uber.org/zap"
@@ -64,7 +65,7 @@ func NewHistoryConsumer(brokers []string, groupID string, topics []string, clien
 
 // Run fetches records and sends them to the records channel.
 // commitWg is incremented for the commit goroutine so callers can wait for it to drain.
-func (hc *HistoryConsumer) Run(ctx context.Context, records chan<- []*kgo.Record, flushed <-chan []*kgo.Record, commitWg *sync.WaitGroup) {
+func (hc *HistoryConsumer) Run(ctx context.Context, records chan<- []*source.Record, flushed <-chan []*source.Record, commitWg *sync.WaitGroup) {
 	// Start a goroutine to handle offset commits.
 	// Drains the flushed channel completely before exiting.
 	commitWg.Add(1)
@@ -72,7 +73,9 @@ func (hc *HistoryConsumer) Run(ctx context.Context, records chan<- []*kgo.Record
 		defer commitWg.Done()
 		for recs := range flushed {
 			for _, r := range recs {
-				hc.client.MarkCommitRecords(r)
+				if kr, ok := r.Origin.(*kgo.Record); ok {
+					hc.client.MarkCommitRecords(kr)
+				}
 			}
 			commitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			if err := hc.client.CommitMarkedOffsets(commitCtx); err != nil {
@@ -98,9 +101,9 @@ func (hc *HistoryConsumer) Run(ctx context.Context, records chan<- []*kgo.Record
 			}
 		}
 
-		var batch []*kgo.Record
+		var batch []*source.Record
 		fetches.EachRecord(func(r *kgo.Record) {
-			batch = append(batch, r)
+			batch = append(batch, &source.Record{Topic: r.Topic, Value: r.Value, Origin: r})
 		})
 
 		if len(batch) > 0 {
@@ -7,6 +7,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/route-beacon/rib-ingester/internal/source"
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/sasl"
 	"go.uber.org/zap"
@@ -65,7 +66,7 @@ func NewStateConsumer(brokers []string, groupID string, topics []string, clientI
 // Run fetches records and sends them to the records channel.
 // It reads from flushed to commit offsets after successful DB writes.
 // commitWg is incremented for the commit goroutine so callers can wait for it to drain.
-func (sc *StateConsumer) Run(ctx context.Context, records chan<- []*kgo.Record, flushed <-chan []*kgo.Record, commitWg *sync.WaitGroup) {
+func (sc *StateConsumer) Run(ctx context.Context, records chan<- []*source.Record, flushed <-chan []*source.Record, commitWg *sync.WaitGroup) {
 	// Start a goroutine to handle offset commits.
 	// Drains the flushed channel completely before exiting.
 	commitWg.Add(1)
@@ -73,7 +74,9 @@ func (sc *StateConsumer) Run(ctx context.Context, records chan<- []*kgo.Record,
 		defer commitWg.Done()
 		for recs := range flushed {
 			for _, r := range recs {
-				sc.client.MarkCommitRecords(r)
+				if kr, ok := r.Origin.(*kgo.Record); ok {
+					sc.client.MarkCommitRecords(kr)
+				}
 			}
 			commitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			if err := sc.client.CommitMarkedOffsets(commitCtx); err != nil {
@@ -99,9 +102,9 @@ func (sc *StateConsumer) Run(ctx context.Context, records chan<- []*kgo.Record,
 			}
 		}
 
-		var batch []*kgo.Record
+		var batch []*source.Record
 		fetches.EachRecord(func(r *kgo.Record) {
-			batch = append(batch, r)
+			batch = append(batch, &source.Record{Topic: r.Topic, Value: r.Value, Origin: r})
 		})
 
 		if len(batch) > 0 {
@@ -0,0 +1,75 @@
+package listener
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/route-beacon/rib-ingester/internal/bmp"
+)
+
+// errBadFrame marks a BMP common header that cannot be framed. The stream
+// cannot be resynchronised after one, so the session is dropped.
+var errBadFrame = errors.New("listener: bad BMP frame")
+
+// readMessage reads one BMP message (RFC 7854 §4.1) from r. The common
+// header is validated before any bytes are consumed, so a framing error
+// leaves the reader positioned at the offending message.
+func readMessage(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	hdr, err := r.Peek(bmp.CommonHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	if hdr[0] != bmp.BMPVersion {
+		return nil, fmt.Errorf("%w: unsupported BMP version %d", errBadFrame, hdr[0])
+	}
+	msgLen := int(binary.BigEndian.Uint32(hdr[1:5]))
+	if msgLen < bmp.CommonHeaderSize {
+		return nil, fmt.Errorf("%w: msg_length %d smaller than common header", errBadFrame, msgLen)
+	}
+	if msgLen > maxBytes {
+		return nil, fmt.Errorf("%w: msg_length %d exceeds max %d", errBadFrame, msgLen, maxBytes)
+	}
+
+	msg := make([]byte, msgLen)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// readBurst reads one BMP message, then keeps appending messages that are
+// already fully buffered, up to maxBytes in total. This mirrors goBMP
+// bundling a whole TCP read into one Kafka record and keeps channel traffic
+// proportional to reads rather than messages.
+//
+// A burst always ends after a Peer Down or Termination: the state pipeline
+// stops processing a record at those messages, so anything after them must
+// travel in the next record.
+func readBurst(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	burst, err := readMessage(r, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	lastType := burst[5]
+
+	for lastType != bmp.MsgTypePeerDown && lastType != bmp.MsgTypeTermination &&
+		r.Buffered() >= bmp.CommonHeaderSize {
+		hdr, _ := r.Peek(bmp.CommonHeaderSize)
+		msgLen := int(binary.BigEndian.Uint32(hdr[1:5]))
+		if msgLen > r.Buffered() || len(burst)+msgLen > maxBytes {
+			break
+		}
+		// A malformed header is reported by the next readBurst call.
+		msg, err := readMessage(r, maxBytes)
+		if err != nil {
+			break
+		}
+		burst = append(burst, msg...)
+		lastType = msg[5]
+	}
+
+	return burst, nil
+}
@@ -0,0 +1,215 @@
+// Package listener accepts BMP sessions directly from routers over TCP
+// (RFC 7854 §3.2) as an alternative to consuming goBMP output from Kafka.
+package listener
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+	"github.com/route-beacon/rib-ingester/internal/source"
+	"go.uber.org/zap"
+)
+
+// Topic is the topic label carried by listener records in metrics and logs.
+const Topic = "bmp.listener"
+
+// readBufferSize is the per-connection read buffer. Bursts are assembled
+// from what is already buffered, so this bounds a typical record size.
+const readBufferSize = 1 << 20
+
+// BMPListener frames BMP byte streams from routers into source.Records and
+// fans each record out to every sink. Sends block, so a slow pipeline stops
+// reads from the socket and TCP flow control pushes back on the router.
+type BMPListener struct {
+	addr        string
+	maxMsgBytes int
+	logger      *zap.Logger
+
+	ln        net.Listener
+	listening atomic.Bool
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	sessions map[string]int // open sessions per router IP
+	wg       sync.WaitGroup
+}
+
+func NewBMPListener(addr string, maxMsgBytes int, logger *zap.Logger) *BMPListener {
+	return &BMPListener{
+		addr:        addr,
+		maxMsgBytes: maxMsgBytes,
+		logger:      logger,
+		conns:       make(map[net.Conn]struct{}),
+		sessions:    make(map[string]int),
+	}
+}
+
+// Start binds the listening socket so bind errors surface at startup.
+func (l *BMPListener) Start() error {
+	ln, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return err
+	}
+	l.ln = ln
+	l.listening.Store(true)
+	l.logger.Info("BMP listener listening", zap.String("addr", ln.Addr().String()))
+	return nil
+}
+
+// Addr returns the bound address, or nil before Start.
+func (l *BMPListener) Addr() net.Addr {
+	if l.ln == nil {
+		return nil
+	}
+	return l.ln.Addr()
+}
+
+// Run accepts BMP sessions until ctx is cancelled, then closes the listener
+// and all open sessions and waits for their goroutines to exit.
+func (l *BMPListener) Run(ctx context.Context, sinks ...chan<- []*source.Record) {
+	go func() {
+		<-ctx.Done()
+		l.listening.Store(false)
+		l.ln.Close()
+		l.mu.Lock()
+		for c := range l.conns {
+			c.Close()
+		}
+		l.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				l.logger.Error("BMP listener accept failed", zap.Error(err))
+			}
+			break
+		}
+
+		// Checked under the lock so a session accepted while shutting down
+		// is not missed by the closer goroutine.
+		l.mu.Lock()
+		if ctx.Err() != nil {
+			l.mu.Unlock()
+			conn.Close()
+			break
+		}
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.serveConn(ctx, conn, sinks)
+			l.mu.Lock()
+			delete(l.conns, conn)
+			l.mu.Unlock()
+		}()
+	}
+
+	l.wg.Wait()
+}
+
+func (l *BMPListener) serveConn(ctx context.Context, conn net.Conn, sinks []chan<- []*source.Record) {
+	defer conn.Close()
+
+	remote := conn.RemoteAddr().String()
+	routerIP, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		routerIP = remote
+	}
+
+	metrics.BMPListenerConnections.Inc()
+	defer metrics.BMPListenerConnections.Dec()
+	l.logger.Info("BMP session opened", zap.String("remote", remote))
+
+	l.mu.Lock()
+	l.sessions[routerIP]++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		if l.sessions[routerIP]--; l.sessions[routerIP] == 0 {
+			delete(l.sessions, routerIP)
+		}
+		l.mu.Unlock()
+	}()
+
+	r := bufio.NewReaderSize(conn, readBufferSize)
+	for {
+		burst, err := readBurst(r, l.maxMsgBytes)
+		if err != nil {
+			switch {
+			case ctx.Err() != nil:
+			case errors.Is(err, io.EOF):
+				l.logger.Info("BMP session closed by router", zap.String("remote", remote))
+			case errors.Is(err, errBadFrame):
+				metrics.BMPListenerFramingErrorsTotal.Inc()
+				l.logger.Warn("BMP session closed on framing error", zap.String("remote", remote), zap.Error(err))
+			default:
+				l.logger.Warn("BMP session read failed", zap.String("remote", remote), zap.Error(err))
+			}
+			if ctx.Err() == nil {
+				l.endSession(ctx, sinks, routerIP, remote)
+			}
+			return
+		}
+
+		// The record is shared read-only between pipelines.
+		rec := &source.Record{
+			Topic:      Topic,
+			Value:      burst,
+			Raw:        true,
+			RouterIP:   routerIP,
+			RouterHash: remote,
+			ReceivedAt: time.Now(),
+		}
+		for _, sink := range sinks {
+			select {
+			case sink <- []*source.Record{rec}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// endSession sends the end-of-session record of a closed session to every
+// sink, so the pipelines release its state even if the router sent no
+// Termination (see source.Record.EndOfSession). After a Termination the
+// pipelines find nothing left to release or purge.
+func (l *BMPListener) endSession(ctx context.Context, sinks []chan<- []*source.Record, routerIP, remote string) {
+	l.mu.Lock()
+	replaced := l.sessions[routerIP] > 1
+	l.mu.Unlock()
+
+	rec := &source.Record{
+		Topic:           Topic,
+		Raw:             true,
+		RouterIP:        routerIP,
+		RouterHash:      remote,
+		ReceivedAt:      time.Now(),
+		EndOfSession:    true,
+		SessionReplaced: replaced,
+	}
+	for _, sink := range sinks {
+		select {
+		case sink <- []*source.Record{rec}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// IsJoined reports whether the listener is accepting sessions. It satisfies
+// the HTTP server's readiness interface alongside the Kafka consumers.
+func (l *BMPListener) IsJoined() bool {
+	return l.listening.Load()
+}
@@ -0,0 +1,222 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bmp"
+	"github.com/route-beacon/rib-ingester/internal/source"
+	"go.uber.org/zap"
+)
+
+// buildBMPMsg builds a BMP message of the given type with a zeroed body.
+func buildBMPMsg(msgType uint8, bodyLen int) []byte {
+	msg := make([]byte, bmp.CommonHeaderSize+bodyLen)
+	msg[0] = bmp.BMPVersion
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(msg)))
+	msg[5] = msgType
+	return msg
+}
+
+func TestReadBurst_BundlesBufferedMessages(t *testing.T) {
+	m1 := buildBMPMsg(bmp.MsgTypeInitiation, 0)
+	m2 := buildBMPMsg(bmp.MsgTypeTermination, 0)
+	r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, m1...), m2...)))
+
+	burst, err := readBurst(r, 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(burst) != len(m1)+len(m2) {
+		t.Fatalf("expected both messages in one burst (%d bytes), got %d", len(m1)+len(m2), len(burst))
+	}
+	msgs, err := bmp.ParseAll(burst)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("expected burst to parse as 2 messages, got %d (err=%v)", len(msgs), err)
+	}
+	if _, err := readBurst(r, 1<<20); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestReadBurst_EndsAfterPeerDown(t *testing.T) {
+	m1 := buildBMPMsg(bmp.MsgTypePeerDown, 43)
+	m2 := buildBMPMsg(bmp.MsgTypeRouteMonitoring, 10)
+	r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, m1...), m2...)))
+
+	burst, err := readBurst(r, 1<<20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(burst, m1) {
+		t.Fatalf("expected burst to stop after Peer Down, got %d bytes", len(burst))
+	}
+	burst, err = readBurst(r, 1<<20)
+	if err != nil || !bytes.Equal(burst, m2) {
+		t.Fatalf("expected Route Monitoring in next burst, got %d bytes (err=%v)", len(burst), err)
+	}
+}
+
+func TestReadBurst_RespectsMaxBytes(t *testing.T) {
+	m1 := buildBMPMsg(bmp.MsgTypeRouteMonitoring, 30)
+	m2 := buildBMPMsg(bmp.MsgTypeRouteMonitoring, 30)
+	r := bufio.NewReader(bytes.NewReader(append(append([]byte{}, m1...), m2...)))
+
+	burst, err := readBurst(r, len(m1)+10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(burst) != len(m1) {
+		t.Errorf("expected burst capped at one message (%d bytes), got %d", len(m1), len(burst))
+	}
+}
+
+func TestReadBurst_BadFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		max  int
+	}{
+		{"wrong version", func() []byte { m := buildBMPMsg(0, 0); m[0] = 1; return m }(), 1 << 20},
+		{"length below header", func() []byte { m := buildBMPMsg(0, 0); binary.BigEndian.PutUint32(m[1:5], 3); return m }(), 1 << 20},
+		{"length above max", buildBMPMsg(0, 100), 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readBurst(bufio.NewReader(bytes.NewReader(tt.msg)), tt.max)
+			if !errors.Is(err, errBadFrame) {
+				t.Errorf("expected errBadFrame, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBMPListener_DeliversToAllSinks(t *testing.T) {
+	l := NewBMPListener("127.0.0.1:0", 1<<20, zap.NewNop())
+	if err := l.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stateCh := make(chan []*source.Record, 1)
+	historyCh := make(chan []*source.Record, 1)
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx, stateCh, historyCh)
+		close(done)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	msg := buildBMPMsg(bmp.MsgTypeInitiation, 0)
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	for name, ch := range map[string]chan []*source.Record{"state": stateCh, "history": historyCh} {
+		select {
+		case recs := <-ch:
+			if len(recs) != 1 {
+				t.Fatalf("%s: expected 1 record, got %d", name, len(recs))
+			}
+			rec := recs[0]
+			if !rec.Raw || rec.RouterIP != "127.0.0.1" || rec.Topic != Topic {
+				t.Errorf("%s: unexpected record raw=%v router_ip=%q topic=%q", name, rec.Raw, rec.RouterIP, rec.Topic)
+			}
+			if !bytes.Equal(rec.Value, msg) {
+				t.Errorf("%s: expected record value to be the BMP message", name)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: timed out waiting for record", name)
+		}
+	}
+
+	if !l.IsJoined() {
+		t.Error("expected listener to report ready while running")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if l.IsJoined() {
+		t.Error("expected listener to report not ready after shutdown")
+	}
+}
+
+func TestBMPListener_EndOfSession(t *testing.T) {
+	l := NewBMPListener("127.0.0.1:0", 1<<20, zap.NewNop())
+	if err := l.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stateCh := make(chan []*source.Record, 4)
+	historyCh := make(chan []*source.Record, 4)
+	go l.Run(ctx, stateCh, historyCh)
+
+	// receive returns the next record of both sinks.
+	receive := func() *source.Record {
+		t.Helper()
+		var rec *source.Record
+		for name, ch := range map[string]chan []*source.Record{"state": stateCh, "history": historyCh} {
+			select {
+			case recs := <-ch:
+				rec = recs[0]
+			case <-time.After(2 * time.Second):
+				t.Fatalf("%s: timed out waiting for record", name)
+			}
+		}
+		return rec
+	}
+	dial := func() net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		if _, err := conn.Write(buildBMPMsg(bmp.MsgTypeInitiation, 0)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if rec := receive(); rec.EndOfSession {
+			t.Fatal("expected the Initiation record first")
+		}
+		return conn
+	}
+
+	// The router reconnects before its old session is seen to close.
+	old := dial()
+	current := dial()
+	old.Close()
+	rec := receive()
+	if !rec.EndOfSession || !rec.SessionReplaced || len(rec.Value) != 0 {
+		t.Fatalf("expected a replaced end-of-session record, got end=%v replaced=%v value=%d bytes",
+			rec.EndOfSession, rec.SessionReplaced, len(rec.Value))
+	}
+	if rec.RouterIP != "127.0.0.1" || rec.RouterHash != old.LocalAddr().String() {
+		t.Errorf("expected the old session's router hash %q, got %q", old.LocalAddr().String(), rec.RouterHash)
+	}
+
+	current.Close()
+	rec = receive()
+	if !rec.EndOfSession || rec.SessionReplaced {
+		t.Fatalf("expected the last session's end-of-session record to purge, got end=%v replaced=%v",
+			rec.EndOfSession, rec.SessionReplaced)
+	}
+	if rec.RouterHash != current.LocalAddr().String() {
+		t.Errorf("expected router hash %q, got %q", current.LocalAddr().String(), rec.RouterHash)
+	}
+}
@@ -9,23 +9,33 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/route-beacon/rib-ingester/internal/attrset"
+	"github.com/route-beacon/rib-ingester/internal/config"
 	"go.uber.org/zap"
 )
 
-var validPartitionName = regexp.MustCompile(`^route_events_\d{8}$`)
+// partitionedTables are the history tables partitioned by day on
+// partition_time (migration 0029).
+var partitionedTables = []string{"route_events", "evpn_events", "flowspec_events"}
+
+var validPartitionName = regexp.MustCompile(`^(route_events|evpn_events|flowspec_events)_\d{8}$`)
 
 type PartitionManager struct {
 	pool          *pgxpool.Pool
 	retentionDays int
 	timezone      string
+	eventTimeAxis bool
 	logger        *zap.Logger
 }
 
-func NewPartitionManager(pool *pgxpool.Pool, retentionDays int, timezone string, logger *zap.Logger) *PartitionManager {
+// NewPartitionManager returns a partition manager. timeAxis is
+// retention.time_axis.
+func NewPartitionManager(pool *pgxpool.Pool, retentionDays int, timezone, timeAxis string, logger *zap.Logger) *PartitionManager {
 	return &PartitionManager{
 		pool:          pool,
 		retentionDays: retentionDays,
 		timezone:      timezone,
+		eventTimeAxis: timeAxis == config.TimeAxisEvent,
 		logger:        logger,
 	}
 }
@@ -40,6 +50,54 @@ func (pm *PartitionManager) Run(ctx context.Context) error {
 	if err := pm.RefreshSummary(ctx); err != nil {
 		return fmt.Errorf("refreshing route summary: %w", err)
 	}
+	if err := pm.PruneStats(ctx); err != nil {
+		return fmt.Errorf("pruning bmp stats: %w", err)
+	}
+	// After the old partitions are dropped, so their events no longer
+	// hold sets.
+	if err := pm.PruneAttrSets(ctx); err != nil {
+		return fmt.Errorf("pruning path attributes: %w", err)
+	}
+	return nil
+}
+
+// PruneAttrSets deletes the path_attributes sets no route or route event
+// references any more, including those inserted for a batch whose route
+// transaction failed.
+func (pm *PartitionManager) PruneAttrSets(ctx context.Context) error {
+	tag, err := pm.pool.Exec(ctx, attrset.SweepSQL, attrset.SweepAfter.Seconds())
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "42P01") || strings.Contains(errMsg, "42703") || strings.Contains(errMsg, "does not exist") {
+			pm.logger.Warn("path_attributes is not migrated yet, skipping prune", zap.Error(err))
+			return nil
+		}
+		return fmt.Errorf("deleting unreferenced path attributes: %w", err)
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		pm.logger.Info("pruned unreferenced path attributes", zap.Int64("deleted", n))
+	}
+	return nil
+}
+
+// PruneStats deletes bmp_stats rows older than the retention period.
+// bmp_stats is not partitioned, so retention is enforced with a DELETE.
+func (pm *PartitionManager) PruneStats(ctx context.Context) error {
+	tag, err := pm.pool.Exec(ctx,
+		`DELETE FROM bmp_stats WHERE collected_at < now() - make_interval(days => $1)`,
+		pm.retentionDays,
+	)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "42P01") || strings.Contains(errMsg, "does not exist") {
+			pm.logger.Warn("bmp_stats does not exist yet, skipping prune", zap.Error(err))
+			return nil
+		}
+		return fmt.Errorf("deleting old bmp_stats rows: %w", err)
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		pm.logger.Info("pruned old bmp stats", zap.Int64("deleted", n))
+	}
 	return nil
 }
 
@@ -71,7 +129,10 @@ func (pm *PartitionManager) refreshView(ctx context.Context, viewName string) er
 	return nil
 }
 
-// CreatePartitions creates daily partitions for today and tomorrow using the configured timezone.
+// CreatePartitions creates daily partitions of each partitioned table for
+// today and tomorrow using the configured timezone. When the tables are
+// partitioned by event time it also creates the partitions of the past
+// days retention keeps, which replayed and lagging events are filed in.
 func (pm *PartitionManager) CreatePartitions(ctx context.Context) error {
 	loc, err := time.LoadLocation(pm.timezone)
 	if err != nil {
@@ -80,27 +141,42 @@ func (pm *PartitionManager) CreatePartitions(ctx context.Context) error {
 
 	now := time.Now().In(loc)
 	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
-	tomorrow := today.AddDate(0, 0, 1)
-	dayAfter := today.AddDate(0, 0, 2)
+	days := partitionDays(today, pm.retentionDays, pm.eventTimeAxis)
 
-	if err := pm.createPartition(ctx, today, tomorrow); err != nil {
-		return err
-	}
-	if err := pm.createPartition(ctx, tomorrow, dayAfter); err != nil {
-		return err
+	for _, parent := range partitionedTables {
+		for _, day := range days {
+			if err := pm.createPartition(ctx, parent, day, day.AddDate(0, 0, 1)); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (pm *PartitionManager) createPartition(ctx context.Context, from, to time.Time) error {
-	name := fmt.Sprintf("route_events_%s", from.Format("20060102"))
+// partitionDays returns the first days of the partitions to create: today
+// and tomorrow, preceded on the event time axis by the retentionDays days
+// before today that DropOldPartitions keeps.
+func partitionDays(today time.Time, retentionDays int, eventTimeAxis bool) []time.Time {
+	first := today
+	if eventTimeAxis {
+		first = today.AddDate(0, 0, -retentionDays)
+	}
+	var days []time.Time
+	for day := first; !day.After(today.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+func (pm *PartitionManager) createPartition(ctx context.Context, parent string, from, to time.Time) error {
+	name := fmt.Sprintf("%s_%s", parent, from.Format("20060102"))
 	safeName := pgx.Identifier{name}.Sanitize()
 	fromStr := from.UTC().Format("2006-01-02 15:04:05+00")
 	toStr := to.UTC().Format("2006-01-02 15:04:05+00")
 
 	createSQL := fmt.Sprintf(
-		`CREATE TABLE IF NOT EXISTS %s PARTITION OF route_events FOR VALUES FROM ('%s') TO ('%s')`,
-		safeName, fromStr, toStr,
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+		safeName, pgx.Identifier{parent}.Sanitize(), fromStr, toStr,
 	)
 
 	if _, err := pm.pool.Exec(ctx, createSQL); err != nil {
@@ -108,6 +184,11 @@ func (pm *PartitionManager) createPartition(ctx context.Context, from, to time.T
 	}
 	pm.logger.Info("partition ensured", zap.String("partition", name))
 
+	// Indexes of other tables are defined on the partitioned parent.
+	if parent != "route_events" {
+		return nil
+	}
+
 	// Create per-partition indexes using sanitized names.
 	safeIdxPrefix := pgx.Identifier{fmt.Sprintf("idx_%s_prefix_history", name)}.Sanitize()
 	safeIdxChurn := pgx.Identifier{fmt.Sprintf("idx_%s_router_churn", name)}.Sanitize()
@@ -142,9 +223,18 @@ func (pm *PartitionManager) DropOldPartitions(ctx context.Context) error {
 	cutoff := time.Now().In(loc).AddDate(0, 0, -pm.retentionDays)
 	cutoffDate := time.Date(cutoff.Year(), cutoff.Month(), cutoff.Day(), 0, 0, 0, 0, loc)
 
-	// List existing partitions of route_events.
+	for _, parent := range partitionedTables {
+		if err := pm.dropOldPartitions(ctx, parent, loc, cutoffDate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pm *PartitionManager) dropOldPartitions(ctx context.Context, parent string, loc *time.Location, cutoffDate time.Time) error {
+	// List existing partitions of parent.
 	rows, err := pm.pool.Query(ctx,
-		`SELECT inhrelid::regclass::text FROM pg_inherits WHERE inhparent = 'route_events'::regclass`)
+		`SELECT inhrelid::regclass::text FROM pg_inherits WHERE inhparent = $1::regclass`, parent)
 	if err != nil {
 		return fmt.Errorf("listing partitions: %w", err)
 	}
@@ -168,7 +258,7 @@ func (pm *PartitionManager) DropOldPartitions(ctx context.Context) error {
 			continue
 		}
 
-		// Parse date from partition name: route_events_YYYYMMDD
+		// Parse date from partition name: <parent>_YYYYMMDD
 		dateStr := name[len(name)-8:]
 		partDate, err := time.ParseInLocation("20060102", dateStr, loc)
 		if err != nil {
@@ -1,11 +1,15 @@
 package maintenance
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestValidPartitionName_Valid(t *testing.T) {
-	name := "route_events_20250115"
-	if !validPartitionName.MatchString(name) {
-		t.Errorf("expected %q to match validPartitionName regex", name)
+	for _, name := range []string{"route_events_20250115", "evpn_events_20250115", "flowspec_events_20250115"} {
+		if !validPartitionName.MatchString(name) {
+			t.Errorf("expected %q to match validPartitionName regex", name)
+		}
 	}
 }
 
@@ -29,3 +33,23 @@ func TestValidPartitionName_InjectionAttempt(t *testing.T) {
 		t.Errorf("expected %q to NOT match validPartitionName regex (SQL injection attempt)", name)
 	}
 }
+
+func TestPartitionDays(t *testing.T) {
+	today := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	days := partitionDays(today, 30, false)
+	if len(days) != 2 || !days[0].Equal(today) || !days[1].Equal(today.AddDate(0, 0, 1)) {
+		t.Errorf("ingest time axis: expected today and tomorrow, got %v", days)
+	}
+
+	days = partitionDays(today, 30, true)
+	if len(days) != 32 {
+		t.Fatalf("event time axis: expected 32 days, got %d", len(days))
+	}
+	if first := today.AddDate(0, 0, -30); !days[0].Equal(first) {
+		t.Errorf("event time axis: expected first day %v, got %v", first, days[0])
+	}
+	if last := today.AddDate(0, 0, 1); !days[31].Equal(last) {
+		t.Errorf("event time axis: expected last day %v, got %v", last, days[31])
+	}
+}
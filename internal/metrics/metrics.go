@@ -55,7 +55,7 @@ var (
 			Name: "ribingester_eor_seen",
 			Help: "EOR received (0/1).",
 		},
-		[]string{"router_id", "table_name", "afi"},
+		[]string{"router_id", "table_name", "afi", "safi"},
 	)
 
 	// NOTE: router_id label creates per-router cardinality. In large deployments
@@ -92,6 +92,66 @@ var (
 		},
 		[]string{"reason"},
 	)
+
+	// NOTE: router_id and peer_address labels create per-peer cardinality.
+	// afi/safi are empty for stat types that are not per-AFI/SAFI.
+	BMPStatValue = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ribingester_bmp_stat_value",
+			Help: "Last value reported by a BMP Statistics Report, per stat type.",
+		},
+		[]string{"router_id", "peer_address", "stat", "afi", "safi"},
+	)
+
+	// info is "errored_pdu", "messages_lost", or "none" when the router sent
+	// no Information TLV.
+	BMPRouteMirroringTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ribingester_bmp_route_mirroring_total",
+			Help: "BMP Route Mirroring messages received, by information code.",
+		},
+		[]string{"info"},
+	)
+
+	RouteLeaksSuspectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ribingester_route_leaks_suspected_total",
+			Help: "Adj-RIB-In announcements violating the RFC 9234 OTC ingress rules.",
+		},
+		[]string{"afi"},
+	)
+
+	UpdateErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ribingester_bgp_update_errors_total",
+			Help: "Errors in parsed BGP UPDATEs by RFC 7606 action and path attribute type.",
+		},
+		[]string{"pipeline", "action", "attr"},
+	)
+
+	// result is "hit" for attribute sets known to be in path_attributes and
+	// "miss" for those inserted.
+	AttrSetLookupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ribingester_attr_set_lookups_total",
+			Help: "Distinct path attribute sets per batch looked up in the writer's cache.",
+		},
+		[]string{"pipeline", "result"},
+	)
+
+	BMPListenerConnections = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ribingester_bmp_listener_connections",
+			Help: "Open BMP sessions on the native TCP listener.",
+		},
+	)
+
+	BMPListenerFramingErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ribingester_bmp_listener_framing_errors_total",
+			Help: "BMP sessions closed because the byte stream could not be framed.",
+		},
+	)
 )
 
 var registerOnce sync.Once
@@ -109,6 +169,13 @@ func Register() {
 			BatchSize,
 			BatchDroppedTotal,
 			RoutesPurgedTotal,
+			BMPStatValue,
+			BMPRouteMirroringTotal,
+			RouteLeaksSuspectedTotal,
+			UpdateErrorsTotal,
+			AttrSetLookupsTotal,
+			BMPListenerConnections,
+			BMPListenerFramingErrorsTotal,
 		)
 	})
 }
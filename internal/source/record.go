@@ -0,0 +1,66 @@
+// Package source defines the unit of input shared by the state and history
+// pipelines, independent of where it came from (Kafka or the BMP listener).
+package source
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bmp"
+)
+
+// Record is one unit of pipeline input.
+//
+// Kafka records carry an OpenBMP frame (or goBMP JSON) in Value, and the
+// BMP speaker's identity is read from the OpenBMP v1.7 header. Listener
+// records set Raw: Value holds one or more bare BMP messages and the
+// speaker's identity comes from the TCP connection.
+type Record struct {
+	Topic string // Kafka topic, or the listener's topic label; used in metrics and logs
+	Value []byte
+
+	Raw        bool      // Value is bare BMP (no OpenBMP header)
+	RouterIP   string    // Speaker address for Raw records
+	RouterHash string    // Per-connection correlation key for Raw records
+	ReceivedAt time.Time // When the listener read Value off the socket (Raw records)
+
+	// EndOfSession marks a Raw record without Value, sent by the listener
+	// when the TCP session RouterHash closed without a BMP Termination. The
+	// pipelines end the session as on a Termination. SessionReplaced is set
+	// when another session from RouterIP is open: the router reconnected
+	// before the old session was seen to close, so only RouterHash's
+	// per-session state is dropped and the router's routes are kept.
+	EndOfSession    bool
+	SessionReplaced bool
+
+	// Origin is the source-specific handle (e.g. *kgo.Record) returned to
+	// the source on the flushed channel so it can acknowledge the record.
+	Origin any
+}
+
+// BMP returns the BMP message bytes carried by the record, together with
+// the speaker's router IP and router hash (empty if unknown).
+func (r *Record) BMP(maxPayloadBytes int) (bmpBytes []byte, routerIP, routerHash string, err error) {
+	if r.Raw {
+		if len(r.Value) > maxPayloadBytes {
+			return nil, "", "", fmt.Errorf("source: payload %d bytes exceeds max %d", len(r.Value), maxPayloadBytes)
+		}
+		return r.Value, r.RouterIP, r.RouterHash, nil
+	}
+
+	bmpBytes, err = bmp.DecodeOpenBMPFrame(r.Value, maxPayloadBytes)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return bmpBytes, bmp.RouterIPFromOpenBMPV17(r.Value), bmp.RouterHashFromOpenBMPV17(r.Value), nil
+}
+
+// CollectorTime returns when the collector received the record: the
+// OpenBMP v1.7 header timestamp for Kafka records, or the listener's read
+// time for Raw records. Zero if unknown.
+func (r *Record) CollectorTime() time.Time {
+	if r.Raw {
+		return r.ReceivedAt
+	}
+	return bmp.TimestampFromOpenBMPV17(r.Value)
+}
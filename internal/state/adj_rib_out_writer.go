@@ -0,0 +1,378 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// FlushAdjRibOutBatch writes a batch of Adj-RIB-Out routes (RFC 8671) to
+// adj_rib_out within a transaction.
+func (w *Writer) FlushAdjRibOutBatch(ctx context.Context, routes []*ParsedRoute) error {
+	if len(routes) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	renderPathAttrs(routes)
+
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var upserted, deleted int64
+
+	for _, r := range routes {
+		switch r.Action {
+		case "A":
+			n, err := w.upsertAdjRibOutRoute(ctx, tx, r)
+			if err != nil {
+				return fmt.Errorf("upsert adj_rib_out route: %w", err)
+			}
+			upserted += n
+		case "D":
+			n, err := w.deleteAdjRibOutRoute(ctx, tx, r)
+			if err != nil {
+				return fmt.Errorf("delete adj_rib_out route: %w", err)
+			}
+			deleted += n
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit adj_rib_out tx: %w", err)
+	}
+
+	dur := time.Since(start).Seconds()
+	metrics.DBWriteDuration.WithLabelValues("state", "adj_out_batch").Observe(dur)
+	metrics.DBRowsAffectedTotal.WithLabelValues("state", "adj_rib_out", "upsert").Add(float64(upserted))
+	metrics.DBRowsAffectedTotal.WithLabelValues("state", "adj_rib_out", "delete").Add(float64(deleted))
+	metrics.BatchSize.WithLabelValues("state_adj_out").Observe(float64(len(routes)))
+
+	return nil
+}
+
+func (w *Writer) upsertAdjRibOutRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute) (int64, error) {
+	if r.EVPN != nil {
+		return w.upsertEVPNRoute(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.FlowSpec != nil {
+		return w.upsertFlowSpecRule(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.LinkState != nil {
+		return w.upsertLSRoute(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.SRPolicy != nil {
+		return w.upsertSRPolicy(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.RD != "" {
+		return w.upsertVPNRoute(ctx, tx, r, ribAdjRibOut)
+	}
+	var attrsJSON []byte
+	if r.Attrs != nil {
+		var err error
+		attrsJSON, err = json.Marshal(r.Attrs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal attrs: %w", err)
+		}
+	}
+
+	prefixSID, err := prefixSIDJSON(r.PrefixSID)
+	if err != nil {
+		return 0, err
+	}
+	parseWarnings, err := parseWarningsJSON(r.ParseWarnings)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO adj_rib_out (router_id, peer_address, peer_asn, peer_bgp_id, is_post_policy,
+			table_name, afi, safi, prefix, path_id,
+			nexthop, as_path, origin, localpref, med, origin_asn,
+			communities_std, communities_ext, communities_large, attrs,
+			originator_id, cluster_list, atomic_aggregate, aggregator_asn, aggregator_address, otc,
+			labels, nexthop_ll, prefix_sid, parse_warnings, first_seen, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, now(), now())
+		ON CONFLICT (router_id, peer_address, is_post_policy, table_name, afi, safi, prefix, path_id)
+		DO UPDATE SET
+			peer_asn = EXCLUDED.peer_asn,
+			peer_bgp_id = EXCLUDED.peer_bgp_id,
+			nexthop = EXCLUDED.nexthop,
+			nexthop_ll = EXCLUDED.nexthop_ll,
+			as_path = EXCLUDED.as_path,
+			origin = EXCLUDED.origin,
+			localpref = EXCLUDED.localpref,
+			med = EXCLUDED.med,
+			origin_asn = EXCLUDED.origin_asn,
+			communities_std = EXCLUDED.communities_std,
+			communities_ext = EXCLUDED.communities_ext,
+			communities_large = EXCLUDED.communities_large,
+			attrs = EXCLUDED.attrs,
+			originator_id = EXCLUDED.originator_id,
+			cluster_list = EXCLUDED.cluster_list,
+			atomic_aggregate = EXCLUDED.atomic_aggregate,
+			aggregator_asn = EXCLUDED.aggregator_asn,
+			aggregator_address = EXCLUDED.aggregator_address,
+			otc = EXCLUDED.otc,
+			labels = EXCLUDED.labels,
+			prefix_sid = EXCLUDED.prefix_sid,
+			parse_warnings = EXCLUDED.parse_warnings,
+			updated_at = now()`,
+		r.RouterID, r.PeerAddress, r.PeerAS, r.PeerBGPID, r.IsPostPolicy,
+		r.TableName, r.AFI, r.SAFI, r.Prefix.String(), r.PathID,
+		nullableAddr(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
+		r.LocalPref, r.MED, r.OriginASN,
+		r.CommStd, r.CommExt, r.CommLarge, attrsJSON,
+		nullableString(r.OriginatorID), r.ClusterList, r.AtomicAggregate,
+		r.AggregatorASN, nullableString(r.AggregatorAddress), r.OTC,
+		r.Labels, nullableAddr(r.NexthopLL), prefixSID, parseWarnings,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (w *Writer) deleteAdjRibOutRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute) (int64, error) {
+	if r.EVPN != nil {
+		return w.deleteEVPNRoute(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.FlowSpec != nil {
+		return w.deleteFlowSpecRule(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.LinkState != nil {
+		return w.deleteLSRoute(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.SRPolicy != nil {
+		return w.deleteSRPolicy(ctx, tx, r, ribAdjRibOut)
+	}
+	if r.RD != "" {
+		return w.deleteVPNRoute(ctx, tx, r, ribAdjRibOut)
+	}
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM adj_rib_out WHERE router_id = $1 AND peer_address = $2 AND is_post_policy = $3 AND table_name = $4 AND afi = $5 AND safi = $6 AND prefix = $7 AND path_id = $8`,
+		r.RouterID, r.PeerAddress, r.IsPostPolicy, r.TableName, r.AFI, r.SAFI, r.Prefix.String(), r.PathID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// HandleAdjRibOutPeerDown removes all adj_rib_out routes and sync status for
+// a specific peer within a single transaction.
+func (w *Writer) HandleAdjRibOutPeerDown(ctx context.Context, routerID, peerAddress string) error {
+	start := time.Now()
+
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin adj out peer down tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM adj_rib_out WHERE router_id = $1 AND peer_address = $2`,
+		routerID, peerAddress,
+	)
+	if err != nil {
+		return fmt.Errorf("adj_rib_out peer down: %w", err)
+	}
+
+	side, err := purgeSideTables(ctx, tx, `router_id = $1 AND rib = $2 AND peer_address = $3 AND peer_rd = ''`,
+		routerID, ribAdjRibOut, peerAddress)
+	if err != nil {
+		return fmt.Errorf("adj_rib_out peer down: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM adj_rib_out_sync_status WHERE router_id = $1 AND peer_address = $2 AND peer_rd = ''`,
+		routerID, peerAddress,
+	)
+	if err != nil {
+		return fmt.Errorf("adj_rib_out_sync_status peer down: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit adj out peer down tx: %w", err)
+	}
+
+	dur := time.Since(start).Seconds()
+	metrics.DBWriteDuration.WithLabelValues("state", "adj_out_peer_down").Observe(dur)
+	purged := tag.RowsAffected() + side
+	if purged > 0 {
+		metrics.RoutesPurgedTotal.WithLabelValues("adj_out_peer_down").Add(float64(purged))
+	}
+
+	w.logger.Info("purged adj_rib_out routes on peer down",
+		zap.String("router_id", routerID),
+		zap.String("peer_address", peerAddress),
+		zap.Int64("purged", purged),
+	)
+
+	return nil
+}
+
+// HandleAdjRibOutSessionTermination removes ALL adj_rib_out routes and sync
+// status for a router when its BMP session goes away.
+func (w *Writer) HandleAdjRibOutSessionTermination(ctx context.Context, routerID string) error {
+	start := time.Now()
+
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin adj out session termination tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM adj_rib_out WHERE router_id = $1`,
+		routerID,
+	)
+	if err != nil {
+		return fmt.Errorf("adj_rib_out session termination: %w", err)
+	}
+
+	side, err := purgeSideTables(ctx, tx, `router_id = $1 AND rib = $2`, routerID, ribAdjRibOut)
+	if err != nil {
+		return fmt.Errorf("adj_rib_out session termination: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM adj_rib_out_sync_status WHERE router_id = $1`,
+		routerID,
+	)
+	if err != nil {
+		return fmt.Errorf("adj_rib_out_sync_status session termination: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit adj out session termination tx: %w", err)
+	}
+
+	dur := time.Since(start).Seconds()
+	metrics.DBWriteDuration.WithLabelValues("state", "adj_out_session_termination").Observe(dur)
+	purged := tag.RowsAffected() + side
+	if purged > 0 {
+		metrics.RoutesPurgedTotal.WithLabelValues("adj_out_session_down").Add(float64(purged))
+	}
+
+	w.logger.Info("purged all adj_rib_out routes on session termination",
+		zap.String("router_id", routerID),
+		zap.Int64("purged", purged),
+	)
+
+	return nil
+}
+
+// UpdateAdjRibOutSessionStart records session start for stale route
+// tracking, for every family of the peer. Called on non-Loc-RIB Peer Up
+// alongside UpdateAdjRibInSessionStart.
+func (w *Writer) UpdateAdjRibOutSessionStart(ctx context.Context, routerID, peerAddress, peerRD string) error {
+	_, err := w.pool.Exec(ctx, `
+		WITH reset AS (
+			UPDATE adj_rib_out_sync_status SET session_start_time = now(), eor_seen = false, eor_time = NULL, updated_at = now()
+			WHERE router_id = $1 AND peer_address = $2 AND peer_rd = $3
+		)
+		INSERT INTO adj_rib_out_sync_status (router_id, peer_address, peer_rd, afi, safi, session_start_time, eor_seen, updated_at)
+		SELECT $1::text, $2::inet, $3::text, f.afi, f.safi, now(), false, now()
+		FROM unnest($4::smallint[], $5::smallint[]) AS f(afi, safi)
+		ON CONFLICT (router_id, peer_address, peer_rd, afi, safi) DO NOTHING`,
+		routerID, peerAddress, peerRD, sessionAFIs, sessionSAFIs,
+	)
+	return err
+}
+
+// HandleAdjRibOutEOR updates sync status and purges stale adj_rib_out routes
+// after End-of-RIB for a specific (router, peer, table, afi) scope, and the
+// matching side table rows as in HandleAdjRibInEOR.
+func (w *Writer) HandleAdjRibOutEOR(ctx context.Context, routerID, peerAddress, peerRD, tableName string, afi int, safi uint8) error {
+	start := time.Now()
+
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE adj_rib_out_sync_status SET eor_seen = true, eor_time = now(), updated_at = now()
+		WHERE router_id = $1 AND peer_address = $2 AND peer_rd = $3 AND afi = $4 AND safi = $5`,
+		routerID, peerAddress, peerRD, afi, safi,
+	)
+	if err != nil {
+		return fmt.Errorf("update adj out eor status: %w", err)
+	}
+
+	// Without a sync-status row (missed Peer Up) there is no stale cutoff,
+	// so skip the purge rather than failing the record.
+	var sessionStart *time.Time
+	err = tx.QueryRow(ctx,
+		`SELECT session_start_time FROM adj_rib_out_sync_status WHERE router_id = $1 AND peer_address = $2 AND peer_rd = $3 AND afi = $4 AND safi = $5`,
+		routerID, peerAddress, peerRD, afi, safi,
+	).Scan(&sessionStart)
+	if errors.Is(err, pgx.ErrNoRows) {
+		w.logger.Warn("no adj_rib_out_sync_status row for EOR, skipping stale purge",
+			zap.String("router_id", routerID),
+			zap.String("peer_address", peerAddress),
+			zap.Int("afi", afi),
+			zap.Uint8("safi", safi),
+		)
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit adj out eor tx: %w", err)
+		}
+		dur := time.Since(start).Seconds()
+		metrics.DBWriteDuration.WithLabelValues("state", "adj_out_eor").Observe(dur)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get adj out session_start_time: %w", err)
+	}
+
+	if sessionStart != nil {
+		// An RD instance peer has no routes in adj_rib_out.
+		if peerRD == "" {
+			tag, err := tx.Exec(ctx,
+				`DELETE FROM adj_rib_out WHERE router_id = $1 AND peer_address = $2 AND table_name = $3 AND afi = $4 AND safi = $5 AND updated_at < $6`,
+				routerID, peerAddress, tableName, afi, safi, *sessionStart,
+			)
+			if err != nil {
+				return fmt.Errorf("purge stale adj out routes: %w", err)
+			}
+			purged := tag.RowsAffected()
+			if purged > 0 {
+				metrics.RoutesPurgedTotal.WithLabelValues("adj_out_eor_stale").Add(float64(purged))
+				w.logger.Info("purged stale adj_rib_out routes after EOR",
+					zap.String("router_id", routerID),
+					zap.String("peer_address", peerAddress),
+					zap.String("table_name", tableName),
+					zap.Int("afi", afi),
+					zap.Uint8("safi", safi),
+					zap.Int64("purged", purged),
+				)
+			}
+		}
+		for _, table := range eorSideTables(safi, peerRD) {
+			if err := w.purgeStaleSideRoutes(ctx, tx, table, ribAdjRibOut, routerID, peerAddress, peerRD, tableName, afi, safi, *sessionStart); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit adj out eor tx: %w", err)
+	}
+
+	dur := time.Since(start).Seconds()
+	metrics.DBWriteDuration.WithLabelValues("state", "adj_out_eor").Observe(dur)
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/route-beacon/rib-ingester/internal/attrset"
+)
+
+// The unicast and labeled unicast routes of a batch are written in bulk:
+// they are COPYed into a staging table local to the database session and
+// applied with one INSERT ... ON CONFLICT for the announcements and one
+// DELETE for the withdrawals. Their path attributes are stored once per
+// distinct set in path_attributes (see attrset) and referenced by
+// attr_hash. Routes bound for the side tables (EVPN, FlowSpec, BGP-LS,
+// SR Policy and VPN) are written one statement each.
+
+// bulkTable describes how routes are staged and applied to current_routes
+// or adj_rib_in.
+type bulkTable struct {
+	table  string
+	adj    bool     // adj_rib_in: keyed by peer as well
+	keys   []string // primary key
+	values []string // columns set from the route, in the order of routeValues
+
+	createStageSQL string
+	stageColumns   []string
+	upsertSQL      string
+	deleteSQL      string
+}
+
+// routeValueColumns are the columns of both tables set from a route, in
+// the order of routeValues.
+var routeValueColumns = []string{
+	"nexthop", "nexthop_ll", "labels", "prefix_sid", "parse_warnings", "attr_hash",
+}
+
+// inlineAttrColumns held the path attributes of a route before they moved
+// to path_attributes. Rows written since leave them NULL, and an update
+// clears them.
+var inlineAttrColumns = []string{
+	"as_path", "as_path_asns", "as_path_len", "as_path_has_set",
+	"origin", "localpref", "med", "origin_asn",
+	"communities_std", "communities_ext", "communities_large", "attrs",
+	"originator_id", "cluster_list", "aggregator_asn", "aggregator_address", "otc",
+}
+
+var (
+	currentRoutesBulk = newBulkTable("current_routes", false,
+		[]string{"router_id", "table_name", "afi", "safi", "prefix", "path_id"},
+		routeValueColumns)
+	adjRibInBulk = newBulkTable("adj_rib_in", true,
+		[]string{"router_id", "peer_address", "is_post_policy", "table_name", "afi", "safi", "prefix", "path_id"},
+		append([]string{"peer_asn", "peer_bgp_id", "leak_suspected"}, routeValueColumns...))
+)
+
+func newBulkTable(table string, adj bool, keys, values []string) *bulkTable {
+	t := &bulkTable{table: table, adj: adj, keys: keys, values: values}
+	stage := table + "_stage"
+	t.stageColumns = append(append([]string{"action"}, keys...), values...)
+	columns := strings.Join(append(append([]string{}, keys...), values...), ", ")
+
+	// The staging table takes its column types from the table and is
+	// emptied at every commit, so each connection creates it once.
+	t.createStageSQL = fmt.Sprintf(`
+		CREATE TEMP TABLE IF NOT EXISTS %s ON COMMIT DELETE ROWS AS
+		SELECT ''::text AS action, %s FROM %s WITH NO DATA`,
+		stage, columns, table)
+
+	set := make([]string, 0, len(values)+len(inlineAttrColumns)+1)
+	for _, c := range values {
+		set = append(set, c+" = EXCLUDED."+c)
+	}
+	for _, c := range inlineAttrColumns {
+		set = append(set, c+" = NULL")
+	}
+	set = append(set, "atomic_aggregate = false")
+	t.upsertSQL = fmt.Sprintf(`
+		INSERT INTO %s (%s, first_seen, updated_at)
+		SELECT %s, now(), now() FROM %s WHERE action = 'A'
+		ON CONFLICT (%s)
+		DO UPDATE SET %s, updated_at = now()`,
+		table, columns, columns, stage, strings.Join(keys, ", "), strings.Join(set, ", "))
+
+	match := make([]string, len(keys))
+	for i, c := range keys {
+		match[i] = "t." + c + " = s." + c
+	}
+	t.deleteSQL = fmt.Sprintf(`
+		DELETE FROM %s t USING %s s
+		WHERE s.action = 'D' AND %s`,
+		table, stage, strings.Join(match, " AND "))
+	return t
+}
+
+// routeKey identifies a route in current_routes or adj_rib_in. The peer
+// fields are only set for adj_rib_in.
+type routeKey struct {
+	routerID     string
+	peerAddress  string
+	isPostPolicy bool
+	tableName    string
+	afi          int
+	safi         uint8
+	prefix       netip.Prefix
+	pathID       int64
+}
+
+// isSideRoute reports whether r is written to one of the side tables
+// rather than current_routes or adj_rib_in.
+func isSideRoute(r *ParsedRoute) bool {
+	return r.EVPN != nil || r.FlowSpec != nil || r.LinkState != nil || r.SRPolicy != nil || r.RD != ""
+}
+
+// dedupeRoutes returns the last announcement or withdrawal of each route
+// in routes, as applying them in order would leave it. One INSERT ... ON
+// CONFLICT cannot update a row twice.
+func (t *bulkTable) dedupeRoutes(routes []*ParsedRoute) []*ParsedRoute {
+	index := make(map[routeKey]int, len(routes))
+	out := make([]*ParsedRoute, 0, len(routes))
+	for _, r := range routes {
+		k := routeKey{routerID: r.RouterID, tableName: r.TableName, afi: r.AFI, safi: r.SAFI, prefix: r.Prefix, pathID: r.PathID}
+		if t.adj {
+			k.peerAddress, k.isPostPolicy = r.PeerAddress, r.IsPostPolicy
+		}
+		if i, ok := index[k]; ok {
+			out[i] = r
+			continue
+		}
+		index[k] = len(out)
+		out = append(out, r)
+	}
+	return out
+}
+
+// stageRow returns the values of r for the staging table and adds its
+// attribute set to sets. Withdrawals only carry the key.
+func (t *bulkTable) stageRow(r *ParsedRoute, sets *attrset.Batch) ([]any, error) {
+	row := make([]any, 0, len(t.stageColumns))
+	row = append(row, r.Action, r.RouterID)
+	if t.adj {
+		row = append(row, r.PeerAddress, r.IsPostPolicy)
+	}
+	row = append(row, r.TableName, r.AFI, r.SAFI, r.Prefix.String(), r.PathID)
+
+	if r.Action != "A" {
+		return append(row, make([]any, len(t.values))...), nil
+	}
+	if t.adj {
+		row = append(row, r.PeerAS, r.PeerBGPID, r.LeakSuspected)
+	}
+	return routeValues(row, r, sets)
+}
+
+// routeValues appends the routeValueColumns of r to row.
+func routeValues(row []any, r *ParsedRoute, sets *attrset.Batch) ([]any, error) {
+	set, err := attrSet(r)
+	if err != nil {
+		return nil, err
+	}
+	prefixSID, err := prefixSIDJSON(r.PrefixSID)
+	if err != nil {
+		return nil, err
+	}
+	parseWarnings, err := parseWarningsJSON(r.ParseWarnings)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(row,
+		nullableAddr(r.Nexthop), nullableAddr(r.NexthopLL),
+		r.Labels, prefixSID, parseWarnings, sets.Add(set),
+	), nil
+}
+
+// attrSet returns the path attribute set of r.
+func attrSet(r *ParsedRoute) (*attrset.Set, error) {
+	s := &attrset.Set{
+		Origin:            r.Origin,
+		ASPath:            r.ASPath,
+		ASPathSegments:    r.ASPathSegments,
+		LocalPref:         r.LocalPref,
+		MED:               r.MED,
+		CommStd:           r.CommStd,
+		CommExt:           r.CommExt,
+		CommLarge:         r.CommLarge,
+		OriginatorID:      r.OriginatorID,
+		ClusterList:       r.ClusterList,
+		AtomicAggregate:   r.AtomicAggregate,
+		AggregatorASN:     r.AggregatorASN,
+		AggregatorAddress: r.AggregatorAddress,
+		OTC:               r.OTC,
+	}
+	if r.Attrs != nil {
+		var err error
+		if s.Attrs, err = json.Marshal(r.Attrs); err != nil {
+			return nil, fmt.Errorf("marshal attrs: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// bulkBatch holds routes staged for a bulkTable, and the attribute sets
+// they reference, which must be in path_attributes before it is written.
+type bulkBatch struct {
+	t         *bulkTable
+	rows      [][]any
+	announced int
+	withdrawn int
+	sets      attrset.Batch
+}
+
+// prepare stages routes, none of them side routes, for the table.
+func (t *bulkTable) prepare(routes []*ParsedRoute) (*bulkBatch, error) {
+	routes = t.dedupeRoutes(routes)
+	b := &bulkBatch{t: t, rows: make([][]any, 0, len(routes))}
+	for _, r := range routes {
+		switch r.Action {
+		case "A":
+			b.announced++
+		case "D":
+			b.withdrawn++
+		default:
+			continue
+		}
+		row, err := t.stageRow(r, &b.sets)
+		if err != nil {
+			return nil, err
+		}
+		b.rows = append(b.rows, row)
+	}
+	return b, nil
+}
+
+// write applies the batch to its table and returns the number of rows
+// upserted and deleted.
+func (b *bulkBatch) write(ctx context.Context, tx pgx.Tx) (upserted, deleted int64, err error) {
+	t := b.t
+	if len(b.rows) == 0 {
+		return 0, 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, t.createStageSQL); err != nil {
+		return 0, 0, fmt.Errorf("create %s staging table: %w", t.table, err)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{t.table + "_stage"}, t.stageColumns, pgx.CopyFromRows(b.rows)); err != nil {
+		return 0, 0, fmt.Errorf("copy %s routes: %w", t.table, err)
+	}
+	if b.announced > 0 {
+		tag, err := tx.Exec(ctx, t.upsertSQL)
+		if err != nil {
+			return 0, 0, fmt.Errorf("upsert %s routes: %w", t.table, err)
+		}
+		upserted = tag.RowsAffected()
+	}
+	if b.withdrawn > 0 {
+		tag, err := tx.Exec(ctx, t.deleteSQL)
+		if err != nil {
+			return 0, 0, fmt.Errorf("delete %s routes: %w", t.table, err)
+		}
+		deleted = tag.RowsAffected()
+	}
+	return upserted, deleted, nil
+}
+
+// syncStatusKey identifies a rib_sync_status row.
+type syncStatusKey struct {
+	routerID  string
+	tableName string
+	afi       int
+	safi      uint8
+}
+
+// syncStatus is a rib_sync_status row touched by a batch and the latest
+// event time of its routes.
+type syncStatus struct {
+	syncStatusKey
+	eventTime time.Time
+}
+
+// syncStatuses returns the rib_sync_status rows touched by routes, once
+// each, in the order first seen.
+func syncStatuses(routes []*ParsedRoute) []syncStatus {
+	index := make(map[syncStatusKey]int)
+	var statuses []syncStatus
+	for _, r := range routes {
+		k := syncStatusKey{r.RouterID, r.TableName, r.AFI, r.SAFI}
+		i, ok := index[k]
+		if !ok {
+			i = len(statuses)
+			index[k] = i
+			statuses = append(statuses, syncStatus{syncStatusKey: k})
+		}
+		if r.EventTime.After(statuses[i].eventTime) {
+			statuses[i].eventTime = r.EventTime
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,162 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/attrset"
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+	"github.com/route-beacon/rib-ingester/internal/db"
+	"go.uber.org/zap"
+)
+
+func TestBulkTable_DedupeRoutes(t *testing.T) {
+	a1 := &ParsedRoute{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.0.0/24"), Action: "A", PeerAddress: "192.0.2.1"}
+	d1 := &ParsedRoute{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.0.0/24"), Action: "D", PeerAddress: "192.0.2.2"}
+	a2 := &ParsedRoute{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.1.0/24"), Action: "A"}
+	a1b := &ParsedRoute{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.0.0/24"), Action: "A", PeerAddress: "192.0.2.1", PathID: 2}
+
+	// In current_routes the peer is not part of the key: the withdrawal
+	// replaces the announcement.
+	got := currentRoutesBulk.dedupeRoutes([]*ParsedRoute{a1, a2, d1, a1b})
+	if len(got) != 3 || got[0] != d1 || got[1] != a2 || got[2] != a1b {
+		t.Errorf("current_routes: unexpected routes %v", got)
+	}
+
+	// In adj_rib_in routes from different peers are distinct.
+	got = adjRibInBulk.dedupeRoutes([]*ParsedRoute{a1, a2, d1, a1b})
+	if len(got) != 4 {
+		t.Errorf("adj_rib_in: expected 4 routes, got %d", len(got))
+	}
+}
+
+func TestBulkTable_StageRow(t *testing.T) {
+	lp := uint32(100)
+	path, _ := bgp.ParseASPath("64496 64497")
+	r := &ParsedRoute{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.0.0/24"), Action: "A",
+		Nexthop: netip.MustParseAddr("192.0.2.1"), ASPath: path.String(), ASPathSegments: path, LocalPref: &lp,
+		Attrs: map[string]any{"99": "ab"}, PeerAddress: "192.0.2.1", PeerAS: 64496}
+
+	for _, bt := range []*bulkTable{currentRoutesBulk, adjRibInBulk} {
+		for _, action := range []string{"A", "D"} {
+			r.Action = action
+			var sets attrset.Batch
+			row, err := bt.stageRow(r, &sets)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", bt.table, err)
+			}
+			if len(row) != len(bt.stageColumns) {
+				t.Errorf("%s %s: expected %d values, got %d", bt.table, action, len(bt.stageColumns), len(row))
+			}
+
+			hash, _ := row[len(row)-1].([]byte)
+			if action == "A" && (len(hash) != 32 || sets.Len() != 1) {
+				t.Errorf("%s: expected the attr_hash of 1 set, got %x (%d sets)", bt.table, hash, sets.Len())
+			}
+			if action == "D" && (hash != nil || sets.Len() != 0) {
+				t.Errorf("%s: expected no attr_hash for a withdrawal, got %x", bt.table, hash)
+			}
+		}
+	}
+}
+
+func TestBulkTable_PrepareSharesSets(t *testing.T) {
+	lp := uint32(100)
+	routes := []*ParsedRoute{
+		{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.0.0/24"), Action: "A", Nexthop: netip.MustParseAddr("192.0.2.1"), LocalPref: &lp},
+		{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.1.0/24"), Action: "A", Nexthop: netip.MustParseAddr("192.0.2.2"), LocalPref: &lp},
+		{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.2.0/24"), Action: "A", Nexthop: netip.MustParseAddr("192.0.2.1"), Origin: "IGP"},
+		{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, Prefix: netip.MustParsePrefix("10.0.3.0/24"), Action: "D"},
+	}
+	b, err := currentRoutesBulk.prepare(routes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(b.rows) != 4 || b.announced != 3 || b.withdrawn != 1 {
+		t.Errorf("expected 3 announcements and 1 withdrawal, got %d rows (%d, %d)", len(b.rows), b.announced, b.withdrawn)
+	}
+	// The next hop is kept per route: the first two routes share a set.
+	if b.sets.Len() != 2 {
+		t.Errorf("expected 2 attribute sets, got %d", b.sets.Len())
+	}
+}
+
+func TestSyncStatuses(t *testing.T) {
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	routes := []*ParsedRoute{
+		{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, EventTime: t0.Add(time.Second)},
+		{RouterID: "r1", TableName: "t", AFI: 6, SAFI: 1},
+		{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 1, EventTime: t0},
+		{RouterID: "r1", TableName: "t", AFI: 4, SAFI: 128, EventTime: t0},
+		{RouterID: "r2", TableName: "t", AFI: 4, SAFI: 1, EventTime: t0},
+	}
+	want := []syncStatus{
+		{syncStatusKey{"r1", "t", 4, 1}, t0.Add(time.Second)},
+		{syncStatusKey{"r1", "t", 6, 1}, time.Time{}},
+		{syncStatusKey{"r1", "t", 4, 128}, t0},
+		{syncStatusKey{"r2", "t", 4, 1}, t0},
+	}
+	got := syncStatuses(routes)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// BenchmarkFlushBatch_Resync writes a full 1M-route Loc-RIB in batches of
+// ingest.batch_size routes, as a router does after a session reset. It
+// needs a scratch database whose schema it migrates and whose routes it
+// overwrites:
+//
+//	RIB_INGESTER_BENCH_DSN=postgres://... go test ./internal/state/ -run '^$' -bench Resync -benchtime 3x
+func BenchmarkFlushBatch_Resync(b *testing.B) {
+	dsn := os.Getenv("RIB_INGESTER_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("RIB_INGESTER_BENCH_DSN not set")
+	}
+	const (
+		ribSize   = 1 << 20
+		batchSize = 1000
+		routerID  = "bench-resync"
+	)
+
+	ctx := context.Background()
+	pool, err := db.NewPool(ctx, dsn, 4, 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pool.Close()
+	if err := db.RunMigrations(ctx, pool, "../../migrations", zap.NewNop()); err != nil {
+		b.Fatal(err)
+	}
+	w := NewWriter(pool, zap.NewNop())
+	defer w.HandleSessionTermination(ctx, routerID, "")
+
+	lp := uint32(100)
+	path, _ := bgp.ParseASPath("64496 64497 64498")
+	routes := make([]*ParsedRoute, ribSize)
+	for i := range routes {
+		addr := netip.AddrFrom4([4]byte{byte(10 + i>>16), byte(i >> 8), byte(i), 0})
+		routes[i] = &ParsedRoute{
+			RouterID: routerID, TableName: "global", AFI: 4, SAFI: bgp.SAFIUnicast,
+			Prefix: netip.PrefixFrom(addr, 24), Action: "A", IsLocRIB: true,
+			Nexthop: netip.MustParseAddr("192.0.2.1"), ASPath: path.String(), ASPathSegments: path, Origin: "IGP",
+			LocalPref: &lp, CommStd: []string{"64496:100"},
+		}
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		start := time.Now()
+		for i := 0; i < len(routes); i += batchSize {
+			if err := w.FlushBatch(ctx, routes[i:min(i+batchSize, len(routes))]); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(time.Since(start).Seconds(), "s/resync")
+	}
+	b.ReportMetric(float64(ribSize)*float64(b.N)/b.Elapsed().Seconds(), "routes/s")
+}
@@ -0,0 +1,88 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// upsertEVPNRoute writes an EVPN route (AFI 25, SAFI 70) to evpn_routes,
+// keyed by RD and the route key of its route type.
+func (w *Writer) upsertEVPNRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	var attrsJSON []byte
+	if r.Attrs != nil {
+		var err error
+		attrsJSON, err = json.Marshal(r.Attrs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal attrs: %w", err)
+		}
+	}
+
+	prefixSID, err := prefixSIDJSON(r.PrefixSID)
+	if err != nil {
+		return 0, err
+	}
+	parseWarnings, err := parseWarningsJSON(r.ParseWarnings)
+	if err != nil {
+		return 0, err
+	}
+
+	e := r.EVPN
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO evpn_routes (router_id, table_name, rib, peer_address, peer_rd, peer_asn, peer_bgp_id, is_post_policy,
+			route_type, rd, route_key, path_id,
+			esi, ethernet_tag, mac, ip_address, ip_prefix, gateway_ip, labels, vnis,
+			nexthop, as_path, origin, localpref, med,
+			communities_std, communities_ext, communities_large, attrs,
+			originator_id, cluster_list, prefix_sid, parse_warnings, first_seen, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, now(), now())
+		ON CONFLICT (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, rd, route_key, path_id)
+		DO UPDATE SET
+			peer_asn = EXCLUDED.peer_asn,
+			peer_bgp_id = EXCLUDED.peer_bgp_id,
+			esi = EXCLUDED.esi,
+			gateway_ip = EXCLUDED.gateway_ip,
+			labels = EXCLUDED.labels,
+			vnis = EXCLUDED.vnis,
+			nexthop = EXCLUDED.nexthop,
+			as_path = EXCLUDED.as_path,
+			origin = EXCLUDED.origin,
+			localpref = EXCLUDED.localpref,
+			med = EXCLUDED.med,
+			communities_std = EXCLUDED.communities_std,
+			communities_ext = EXCLUDED.communities_ext,
+			communities_large = EXCLUDED.communities_large,
+			attrs = EXCLUDED.attrs,
+			originator_id = EXCLUDED.originator_id,
+			cluster_list = EXCLUDED.cluster_list,
+			prefix_sid = EXCLUDED.prefix_sid,
+			parse_warnings = EXCLUDED.parse_warnings,
+			updated_at = now()`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.PeerAS, r.PeerBGPID, r.IsPostPolicy,
+		e.RouteType, e.RD, e.Key(), r.PathID,
+		nullableString(e.ESI), e.EthernetTag, nullableString(e.MAC), nullableString(e.IP),
+		nullableString(e.Prefix), nullableString(e.GatewayIP), e.Labels, e.VNIs,
+		nullableAddr(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
+		r.LocalPref, r.MED,
+		r.CommStd, r.CommExt, r.CommLarge, attrsJSON,
+		nullableString(r.OriginatorID), r.ClusterList, prefixSID, parseWarnings,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (w *Writer) deleteEVPNRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM evpn_routes WHERE router_id = $1 AND table_name = $2 AND rib = $3 AND peer_address = $4 AND peer_rd = $5 AND is_post_policy = $6 AND rd = $7 AND route_key = $8 AND path_id = $9`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.IsPostPolicy, r.EVPN.RD, r.EVPN.Key(), r.PathID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// upsertFlowSpecRule writes a Flow Specification rule (SAFI 133, 134) to
+// flowspec_rules, keyed by its canonical rule string. rd is the rule's RD
+// for SAFI 134, the Peer Distinguisher for an RD instance peer, else empty.
+func (w *Writer) upsertFlowSpecRule(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	var attrsJSON []byte
+	if r.Attrs != nil {
+		var err error
+		attrsJSON, err = json.Marshal(r.Attrs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal attrs: %w", err)
+		}
+	}
+
+	parseWarnings, err := parseWarningsJSON(r.ParseWarnings)
+	if err != nil {
+		return 0, err
+	}
+
+	f := r.FlowSpec
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO flowspec_rules (router_id, table_name, rib, peer_address, peer_rd, peer_asn, peer_bgp_id, is_post_policy,
+			afi, safi, rd, rule, path_id,
+			dst_prefix, src_prefix, protocols, ports, dst_ports, src_ports, icmp_types, icmp_codes,
+			tcp_flags, packet_lengths, dscp, fragment, flow_label, actions,
+			nexthop, as_path, origin, localpref, med,
+			communities_std, communities_ext, communities_large, attrs,
+			originator_id, cluster_list, parse_warnings, first_seen, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38,
+			$39, now(), now())
+		ON CONFLICT (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, afi, safi, rd, rule, path_id)
+		DO UPDATE SET
+			peer_asn = EXCLUDED.peer_asn,
+			peer_bgp_id = EXCLUDED.peer_bgp_id,
+			actions = EXCLUDED.actions,
+			nexthop = EXCLUDED.nexthop,
+			as_path = EXCLUDED.as_path,
+			origin = EXCLUDED.origin,
+			localpref = EXCLUDED.localpref,
+			med = EXCLUDED.med,
+			communities_std = EXCLUDED.communities_std,
+			communities_ext = EXCLUDED.communities_ext,
+			communities_large = EXCLUDED.communities_large,
+			attrs = EXCLUDED.attrs,
+			originator_id = EXCLUDED.originator_id,
+			cluster_list = EXCLUDED.cluster_list,
+			parse_warnings = EXCLUDED.parse_warnings,
+			updated_at = now()`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.PeerAS, r.PeerBGPID, r.IsPostPolicy,
+		r.AFI, r.SAFI, r.RD, f.Rule, r.PathID,
+		nullableString(f.DstPrefix), nullableString(f.SrcPrefix),
+		nullableString(f.Protocols), nullableString(f.Ports), nullableString(f.DstPorts), nullableString(f.SrcPorts),
+		nullableString(f.ICMPTypes), nullableString(f.ICMPCodes), nullableString(f.TCPFlags),
+		nullableString(f.PacketLengths), nullableString(f.DSCP), nullableString(f.Fragment),
+		nullableString(f.FlowLabel), f.Actions,
+		nullableAddr(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
+		r.LocalPref, r.MED,
+		r.CommStd, r.CommExt, r.CommLarge, attrsJSON,
+		nullableString(r.OriginatorID), r.ClusterList, parseWarnings,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (w *Writer) deleteFlowSpecRule(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM flowspec_rules WHERE router_id = $1 AND table_name = $2 AND rib = $3 AND peer_address = $4 AND peer_rd = $5 AND is_post_policy = $6 AND afi = $7 AND safi = $8 AND rd = $9 AND rule = $10 AND path_id = $11`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.IsPostPolicy, r.AFI, r.SAFI, r.RD, r.FlowSpec.Rule, r.PathID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,175 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+// lsTable returns the table holding BGP-LS NLRI of the given type.
+func lsTable(nlriType uint16) string {
+	switch nlriType {
+	case bgp.LSNodeNLRI:
+		return lsNodesTable
+	case bgp.LSLinkNLRI:
+		return lsLinksTable
+	}
+	return lsPrefixesTable
+}
+
+// lsJSON marshals v for a JSONB column, or returns nil for an empty slice.
+func lsJSON[T any](v []T) ([]byte, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func lsNullableFloat(f *float32) any {
+	if f == nil {
+		return nil
+	}
+	return float64(*f)
+}
+
+// upsertLSRoute writes a BGP-LS NLRI (AFI 16388, SAFI 71) to ls_nodes,
+// ls_links or ls_prefixes, keyed by the NLRI's descriptors.
+func (w *Writer) upsertLSRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	var attrsJSON []byte
+	if r.Attrs != nil {
+		var err error
+		attrsJSON, err = json.Marshal(r.Attrs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal attrs: %w", err)
+		}
+	}
+
+	parseWarnings, err := parseWarningsJSON(r.ParseWarnings)
+	if err != nil {
+		return 0, err
+	}
+
+	ls := r.LinkState
+	a := ls.Attr
+	if a == nil {
+		a = &bgp.LSAttribute{}
+	}
+
+	// Columns shared by the three tables, $1-$25.
+	args := []any{
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.PeerAS, r.PeerBGPID, r.IsPostPolicy,
+		ls.Key(), r.PathID, int16(ls.ProtocolID), int64(ls.Identifier),
+		int64(ls.LocalNode.ASN), int64(ls.LocalNode.BGPLSID),
+		nullableString(ls.LocalNode.OSPFAreaID), ls.LocalNode.IGPRouterID,
+		nullableAddr(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
+		r.LocalPref, r.MED, r.CommStd, r.CommExt, attrsJSON, parseWarnings,
+	}
+	const common = `router_id, table_name, rib, peer_address, peer_rd, peer_asn, peer_bgp_id, is_post_policy,
+			nlri_key, path_id, protocol_id, identifier,
+			local_asn, local_bgp_ls_id, local_area_id, local_igp_router_id,
+			nexthop, as_path, origin, localpref, med, communities_std, communities_ext, attrs, parse_warnings`
+	const commonValues = `$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25`
+	const commonUpdate = `
+			peer_asn = EXCLUDED.peer_asn,
+			peer_bgp_id = EXCLUDED.peer_bgp_id,
+			nexthop = EXCLUDED.nexthop,
+			as_path = EXCLUDED.as_path,
+			origin = EXCLUDED.origin,
+			localpref = EXCLUDED.localpref,
+			med = EXCLUDED.med,
+			communities_std = EXCLUDED.communities_std,
+			communities_ext = EXCLUDED.communities_ext,
+			attrs = EXCLUDED.attrs,
+			parse_warnings = EXCLUDED.parse_warnings,
+			updated_at = now()`
+	const conflict = `ON CONFLICT (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, nlri_key, path_id)
+		DO UPDATE SET`
+
+	var query string
+	switch ls.Type {
+	case bgp.LSNodeNLRI:
+		srgb, err := lsJSON(a.SRGB)
+		if err != nil {
+			return 0, fmt.Errorf("marshal srgb: %w", err)
+		}
+		var algorithms []int16
+		for _, alg := range a.SRAlgorithms {
+			algorithms = append(algorithms, int16(alg))
+		}
+		args = append(args, nullableString(a.NodeName), a.LocalRouterIDs, srgb, algorithms)
+		query = `
+		INSERT INTO ls_nodes (` + common + `,
+			node_name, router_ids, srgb, sr_algorithms, first_seen, updated_at)
+		VALUES (` + commonValues + `, $26, $27, $28, $29, now(), now())
+		` + conflict + `
+			node_name = EXCLUDED.node_name,
+			router_ids = EXCLUDED.router_ids,
+			srgb = EXCLUDED.srgb,
+			sr_algorithms = EXCLUDED.sr_algorithms,` + commonUpdate
+
+	case bgp.LSLinkNLRI:
+		adjSIDs, err := lsJSON(a.AdjSIDs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal adj sids: %w", err)
+		}
+		args = append(args,
+			int64(ls.RemoteNode.ASN), int64(ls.RemoteNode.BGPLSID),
+			nullableString(ls.RemoteNode.OSPFAreaID), ls.RemoteNode.IGPRouterID,
+			int64(ls.LocalLinkID), int64(ls.RemoteLinkID),
+			nullableString(ls.InterfaceAddr), nullableString(ls.NeighborAddr), int32(ls.MTID),
+			a.IGPMetric, a.TEMetric, lsNullableFloat(a.MaxLinkBandwidth), nullableString(a.LinkName), adjSIDs,
+			a.LocalRouterIDs, a.RemoteRouterIDs,
+		)
+		query = `
+		INSERT INTO ls_links (` + common + `,
+			remote_asn, remote_bgp_ls_id, remote_area_id, remote_igp_router_id,
+			local_link_id, remote_link_id, interface_address, neighbor_address, mt_id,
+			igp_metric, te_metric, max_link_bw, link_name, adj_sids,
+			local_router_ids, remote_router_ids, first_seen, updated_at)
+		VALUES (` + commonValues + `, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39,
+			$40, $41, now(), now())
+		` + conflict + `
+			igp_metric = EXCLUDED.igp_metric,
+			te_metric = EXCLUDED.te_metric,
+			max_link_bw = EXCLUDED.max_link_bw,
+			link_name = EXCLUDED.link_name,
+			adj_sids = EXCLUDED.adj_sids,
+			local_router_ids = EXCLUDED.local_router_ids,
+			remote_router_ids = EXCLUDED.remote_router_ids,` + commonUpdate
+
+	default:
+		prefixSIDs, err := lsJSON(a.PrefixSIDs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal prefix sids: %w", err)
+		}
+		args = append(args, ls.Prefix, int32(ls.MTID), int16(ls.OSPFRouteType), a.PrefixMetric, prefixSIDs)
+		query = `
+		INSERT INTO ls_prefixes (` + common + `,
+			prefix, mt_id, ospf_route_type, prefix_metric, prefix_sids, first_seen, updated_at)
+		VALUES (` + commonValues + `, $26, $27, $28, $29, $30, now(), now())
+		` + conflict + `
+			prefix_metric = EXCLUDED.prefix_metric,
+			prefix_sids = EXCLUDED.prefix_sids,` + commonUpdate
+	}
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (w *Writer) deleteLSRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM `+lsTable(r.LinkState.Type)+` WHERE router_id = $1 AND table_name = $2 AND rib = $3 AND peer_address = $4 AND peer_rd = $5 AND is_post_policy = $6 AND nlri_key = $7 AND path_id = $8`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.IsPostPolicy, r.LinkState.Key(), r.PathID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
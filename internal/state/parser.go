@@ -1,10 +1,14 @@
 package state
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/route-beacon/rib-ingester/internal/bgp"
 )
@@ -13,13 +17,21 @@ import (
 type ParsedRoute struct {
 	RouterID   string
 	TableName  string
-	AFI        int // 4 or 6
-	Prefix     string
+	AFI        int   // 4 or 6
+	SAFI       uint8 // bgp.SAFIUnicast or bgp.SAFILabeledUnicast
+	Prefix     netip.Prefix // invalid for EVPN, FlowSpec, BGP-LS, SR Policy and EOR
 	PathID     int64
+	Labels     []uint32 // MPLS label stack (labeled unicast and VPN)
+	RD         string   // Route Distinguisher; routes with one go to vpn_routes
+	EVPN       *bgp.EVPNRoute // EVPN route (AFI 25); written to evpn_routes
+	FlowSpec   *bgp.FlowSpecRule // FlowSpec rule (SAFI 133, 134); written to flowspec_rules
+	LinkState  *bgp.LSRoute // BGP-LS NLRI (AFI 16388); written to ls_nodes, ls_links or ls_prefixes
+	SRPolicy   *bgp.SRPolicy // SR Policy candidate path (SAFI 73); written to sr_policies
 	Action     string // "A" or "D"
 	IsLocRIB   bool
 	IsEOR      bool
-	Nexthop    string
+	Nexthop    netip.Addr
+	NexthopLL  netip.Addr // IPv6 link-local next hop (RFC 2545), if any
 	ASPath     string
 	Origin     string
 	LocalPref  *uint32
@@ -28,11 +40,28 @@ type ParsedRoute struct {
 	CommStd      []string
 	CommExt      []string
 	CommLarge    []string
+	OriginatorID      string
+	ClusterList       []string
+	AtomicAggregate   bool
+	AggregatorASN     *uint32
+	AggregatorAddress string
+	OTC               *uint32
+	PrefixSID         *bgp.PrefixSID
+	ParseWarnings     []bgp.ParseWarning // RFC 7606 errors of the UPDATE
+	ASPathSegments    bgp.ASPath // sequences and sets of ASPath
+	LeakSuspected     bool // Adj-RIB-In only: violates RFC 9234 OTC ingress rules
 	Attrs        map[string]any
+	// PathAttrs are the path attributes of an announcement decoded from a
+	// BMP UPDATE, referring to the message. The writers render them into
+	// the attribute fields above and clear it (see renderPathAttrs). nil
+	// for goBMP JSON routes, which carry those fields already.
+	PathAttrs    *bgp.UpdateAttrs
 	PeerAddress  string // Peer's IP address (empty for Loc-RIB)
 	PeerAS       uint32 // Peer's ASN (0 for Loc-RIB)
 	PeerBGPID    string // Peer's BGP Identifier (empty for Loc-RIB)
 	IsPostPolicy bool   // L-flag: false=pre-policy, true=post-policy
+	PeerRD       string // Peer Distinguisher of an RD instance peer (empty otherwise)
+	EventTime    time.Time // Loc-RIB: router timestamp, else collector timestamp (raw); zero if unknown
 }
 
 // PeerEvent represents a decoded goBMP peer topic message for session lifecycle.
@@ -53,6 +82,7 @@ func DecodeUnicastPrefix(data []byte, topicAFI int) (*ParsedRoute, error) {
 	r := &ParsedRoute{
 		TableName: "UNKNOWN",
 		AFI:       topicAFI,
+		SAFI:      bgp.SAFIUnicast,
 		PathID:    0,
 	}
 
@@ -101,17 +131,26 @@ func DecodeUnicastPrefix(data []byte, topicAFI int) (*ParsedRoute, error) {
 	// EOR indicator
 	r.IsEOR = boolField(raw, "is_eor")
 
+	// Router time of the message (per-peer header timestamp)
+	r.EventTime = timestampField(raw, "timestamp", time.Now())
+
 	// Prefix
-	r.Prefix = stringField(raw, "prefix")
-	if r.Prefix == "" && !r.IsEOR {
+	prefix := stringField(raw, "prefix")
+	if prefix == "" && !r.IsEOR {
 		return nil, fmt.Errorf("missing prefix")
 	}
 
 	// Add prefix length if not already in CIDR notation
-	if r.Prefix != "" && !strings.Contains(r.Prefix, "/") {
+	if prefix != "" && !strings.Contains(prefix, "/") {
 		prefixLen := intField(raw, "prefix_len")
 		if prefixLen > 0 {
-			r.Prefix = fmt.Sprintf("%s/%d", r.Prefix, prefixLen)
+			prefix = fmt.Sprintf("%s/%d", prefix, prefixLen)
+		}
+	}
+	if prefix != "" {
+		var err error
+		if r.Prefix, err = parsePrefix(prefix); err != nil {
+			return nil, err
 		}
 	}
 
@@ -120,8 +159,16 @@ func DecodeUnicastPrefix(data []byte, topicAFI int) (*ParsedRoute, error) {
 		r.PathID = int64Field(pid)
 	}
 
+	// Labeled unicast (RFC 8277) carries its label stack in "labels".
+	if v, ok := raw["labels"].([]any); ok && len(v) > 0 {
+		r.SAFI = bgp.SAFILabeledUnicast
+		for _, l := range v {
+			r.Labels = append(r.Labels, uint32(int64Field(l)))
+		}
+	}
+
 	// Attributes
-	r.Nexthop = stringField(raw, "nexthop")
+	r.Nexthop, _ = netip.ParseAddr(stringField(raw, "nexthop"))
 	r.ASPath = stringField(raw, "as_path")
 	r.Origin = stringField(raw, "origin")
 
@@ -142,8 +189,10 @@ func DecodeUnicastPrefix(data []byte, topicAFI int) (*ParsedRoute, error) {
 	// Fall back to base_attrs for fields goBMP v1.1.0 nests there
 	mergeBaseAttrs(raw, r)
 
-	// Derive origin ASN from as_path
-	r.OriginASN = bgp.OriginASN(r.ASPath)
+	// Derive the segments and origin ASN from as_path. A path that does
+	// not parse is still stored as text.
+	r.ASPathSegments, _ = bgp.ParseASPath(r.ASPath)
+	r.OriginASN = bgp.OriginASN(r.ASPathSegments)
 
 	// Remaining attributes → attrs JSONB
 	r.Attrs = extractRemainingAttrs(raw)
@@ -235,6 +284,54 @@ func int64Field(v any) int64 {
 	return 0
 }
 
+// timestampField reads a message timestamp: RFC 3339, Unix seconds, or
+// the year-less time.StampMicro layout goBMP renders per-peer header
+// timestamps in, which is taken as UTC in the year that puts it closest to
+// now. Zero if absent, unparseable, or the Unix epoch (a zero timestamp on
+// the wire, which goBMP renders as "Jan  1 00:00:00.000000").
+func timestampField(m map[string]any, key string, now time.Time) time.Time {
+	switch v := m[key].(type) {
+	case float64:
+		if v > 0 {
+			sec, frac := math.Modf(v)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t
+		}
+		t, err := time.ParseInLocation(time.StampMicro, v, time.UTC)
+		if err != nil {
+			t, err = time.ParseInLocation(time.Stamp, v, time.UTC)
+		}
+		if err != nil || t.Equal(time.Date(0, time.January, 1, 0, 0, 0, 0, time.UTC)) {
+			return time.Time{}
+		}
+		now = now.UTC()
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.Sub(now) > 183*24*time.Hour {
+			t = t.AddDate(-1, 0, 0)
+		} else if now.Sub(t) > 183*24*time.Hour {
+			t = t.AddDate(1, 0, 0)
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// parsePrefix parses a prefix in CIDR notation, or a bare address as a
+// host prefix.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p, nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q", s)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
 func stringArrayField(m map[string]any, key string) []string {
 	v, ok := m[key]
 	if !ok {
@@ -308,8 +405,8 @@ func mergeBaseAttrs(raw map[string]any, r *ParsedRoute) {
 		r.Origin = stringField(baseAttrs, "origin")
 	}
 
-	if r.Nexthop == "" {
-		r.Nexthop = stringField(baseAttrs, "nexthop")
+	if !r.Nexthop.IsValid() {
+		r.Nexthop, _ = netip.ParseAddr(stringField(baseAttrs, "nexthop"))
 	}
 
 	if r.LocalPref == nil {
@@ -335,6 +432,17 @@ func mergeBaseAttrs(raw map[string]any, r *ParsedRoute) {
 	if r.CommLarge == nil {
 		r.CommLarge = stringArrayField(baseAttrs, "large_community_list")
 	}
+
+	// Route reflection and aggregation. goBMP renders CLUSTER_LIST as a
+	// space-separated string and AGGREGATOR as the raw attribute bytes.
+	r.OriginatorID = stringField(baseAttrs, "originator_id")
+	r.ClusterList = stringArrayField(baseAttrs, "cluster_list")
+	r.AtomicAggregate = boolField(baseAttrs, "is_atomic_agg")
+	if agg := stringField(baseAttrs, "aggregator"); agg != "" {
+		if b, err := base64.StdEncoding.DecodeString(agg); err == nil {
+			r.AggregatorASN, r.AggregatorAddress = bgp.DecodeAggregator(b, nil)
+		}
+	}
 }
 
 // knownFields are fields already extracted; everything else goes to attrs.
@@ -3,6 +3,9 @@ package state
 import (
 	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/route-beacon/rib-ingester/internal/bgp"
 )
 
 func TestDecodeUnicastPrefix_BasicAnnouncement(t *testing.T) {
@@ -27,7 +30,7 @@ func TestDecodeUnicastPrefix_BasicAnnouncement(t *testing.T) {
 	if r.Action != "A" {
 		t.Errorf("expected action 'A', got '%s'", r.Action)
 	}
-	if r.Prefix != "10.0.0.0/24" {
+	if r.Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", r.Prefix)
 	}
 	if r.AFI != 4 {
@@ -200,11 +203,41 @@ func TestDecodeUnicastPrefix_PrefixWithoutCIDR(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if r.Prefix != "10.0.0.0/24" {
+	if r.Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected '10.0.0.0/24', got '%s'", r.Prefix)
 	}
 }
 
+func TestDecodeUnicastPrefix_HostAddress(t *testing.T) {
+	msg := map[string]any{
+		"router_hash": "abc123",
+		"action":      "add",
+		"prefix":      "2001:db8::1",
+	}
+	data, _ := json.Marshal(msg)
+
+	r, err := DecodeUnicastPrefix(data, 6)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Prefix.String() != "2001:db8::1/128" {
+		t.Errorf("expected '2001:db8::1/128', got '%s'", r.Prefix)
+	}
+}
+
+func TestDecodeUnicastPrefix_InvalidPrefix(t *testing.T) {
+	msg := map[string]any{
+		"router_hash": "abc123",
+		"action":      "add",
+		"prefix":      "10.0.0.0/33",
+	}
+	data, _ := json.Marshal(msg)
+
+	if _, err := DecodeUnicastPrefix(data, 4); err == nil {
+		t.Fatal("expected error for invalid prefix")
+	}
+}
+
 func TestDecodeUnicastPrefix_IPv6FromIsIPv4Flag(t *testing.T) {
 	msg := map[string]any{
 		"router_hash": "abc123",
@@ -272,6 +305,40 @@ func TestDecodeUnicastPrefix_BaseAttrsfallback(t *testing.T) {
 	}
 }
 
+func TestDecodeUnicastPrefix_RRAndAggregationAttrs(t *testing.T) {
+	msg := map[string]any{
+		"router_hash": "abc123",
+		"action":      "add",
+		"prefix":      "10.0.0.0",
+		"prefix_len":  float64(24),
+		"is_ipv4":     true,
+		"base_attrs": map[string]any{
+			"originator_id": "10.0.0.5",
+			"cluster_list":  "10.0.0.1 10.0.0.2",
+			"is_atomic_agg": true,
+			"aggregator":    []byte{0xFD, 0xE9, 192, 0, 2, 1}, // base64 in JSON
+		},
+	}
+	data, _ := json.Marshal(msg)
+
+	r, err := DecodeUnicastPrefix(data, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.OriginatorID != "10.0.0.5" {
+		t.Errorf("expected originator_id 10.0.0.5, got %q", r.OriginatorID)
+	}
+	if len(r.ClusterList) != 2 || r.ClusterList[0] != "10.0.0.1" || r.ClusterList[1] != "10.0.0.2" {
+		t.Errorf("expected cluster_list [10.0.0.1 10.0.0.2], got %v", r.ClusterList)
+	}
+	if !r.AtomicAggregate {
+		t.Error("expected AtomicAggregate=true")
+	}
+	if r.AggregatorASN == nil || *r.AggregatorASN != 65001 || r.AggregatorAddress != "192.0.2.1" {
+		t.Errorf("expected aggregator 65001/192.0.2.1, got %v/%q", r.AggregatorASN, r.AggregatorAddress)
+	}
+}
+
 func TestDecodePeerMessage_Down(t *testing.T) {
 	msg := map[string]any{
 		"router_hash": "abc123",
@@ -475,6 +542,35 @@ func TestStringField_Float64(t *testing.T) {
 	}
 }
 
+func TestTimestampField(t *testing.T) {
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		v    any
+		want time.Time
+	}{
+		{"stamp micro", "Jan  1 23:59:58.250000", time.Date(2026, 1, 1, 23, 59, 58, 250000000, time.UTC)},
+		{"stamp previous year", "Dec 31 23:59:59.000000", time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{"stamp", "Jan  2 00:00:00", now},
+		{"rfc3339", "2026-01-01T12:00:00Z", time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"unix seconds", float64(now.Unix()), now},
+		{"zero on the wire", "Jan  1 00:00:00.000000", time.Time{}},
+		{"unparseable", "yesterday", time.Time{}},
+		{"absent", nil, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := map[string]any{}
+			if tt.v != nil {
+				m["timestamp"] = tt.v
+			}
+			if got := timestampField(m, "timestamp", now); !got.Equal(tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
 // --- Additional: IsEOR without prefix ---
 
 func TestDecodeUnicastPrefix_IsEOR(t *testing.T) {
@@ -645,4 +741,37 @@ func TestDecodeUnicastPrefix_OriginASN_ASSet(t *testing.T) {
 	if r.OriginASN != nil {
 		t.Errorf("expected nil OriginASN for AS_SET origin, got %d", *r.OriginASN)
 	}
+	if r.ASPathSegments.Len() != 2 || !r.ASPathSegments.HasSet() {
+		t.Errorf("expected a sequence and a set, got %v", r.ASPathSegments)
+	}
+}
+
+func TestDecodeUnicastPrefix_LabeledUnicast(t *testing.T) {
+	msg := map[string]any{
+		"router_hash": "abc123",
+		"action":      "add",
+		"prefix":      "10.1.0.0",
+		"prefix_len":  float64(16),
+		"is_ipv4":     true,
+		"labels":      []any{float64(24001), float64(3)},
+	}
+	data, _ := json.Marshal(msg)
+
+	r, err := DecodeUnicastPrefix(data, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.SAFI != bgp.SAFILabeledUnicast {
+		t.Errorf("expected SAFI 4, got %d", r.SAFI)
+	}
+	if len(r.Labels) != 2 || r.Labels[0] != 24001 || r.Labels[1] != 3 {
+		t.Errorf("expected labels [24001 3], got %v", r.Labels)
+	}
+
+	delete(msg, "labels")
+	data, _ = json.Marshal(msg)
+	r, _ = DecodeUnicastPrefix(data, 4)
+	if r.SAFI != bgp.SAFIUnicast || r.Labels != nil {
+		t.Errorf("expected unlabeled unicast, got SAFI %d labels %v", r.SAFI, r.Labels)
+	}
 }
@@ -10,7 +10,7 @@ import (
 	"github.com/route-beacon/rib-ingester/internal/bmp"
 	"github.com/route-beacon/rib-ingester/internal/config"
 	"github.com/route-beacon/rib-ingester/internal/metrics"
-	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/route-beacon/rib-ingester/internal/source"
 	"go.uber.org/zap"
 )
 
@@ -25,7 +25,15 @@ type Pipeline struct {
 	// routerIDCache maps OBMP router hash → real router BGP ID (from Peer Up
 	// Sent OPEN). goBMP generates a unique router hash per (router, peer)
 	// combination, making it a reliable correlation key across message types.
+	// Entries are dropped when the BMP session ends.
 	routerIDCache map[string]string
+	// speakerRouterIDs maps OBMP router IP → Loc-RIB router ID, so that a
+	// Termination (which has no per-peer header) purges the router_id the
+	// speaker's Loc-RIB routes were stored under.
+	speakerRouterIDs map[string]string
+	// peerSessions holds the session negotiated in each peer's Peer Up,
+	// used to decode Add-Path NLRI in Adj-RIB messages.
+	peerSessions bmp.PeerSessions
 }
 
 func NewPipeline(writer *Writer, batchSize int, flushIntervalMs int, rawMode bool, maxPayloadBytes int, logger *zap.Logger, routerMeta map[string]config.RouterMeta) *Pipeline {
@@ -33,14 +41,16 @@ func NewPipeline(writer *Writer, batchSize int, flushIntervalMs int, rawMode boo
 		routerMeta = make(map[string]config.RouterMeta)
 	}
 	return &Pipeline{
-		writer:          writer,
-		batchSize:       batchSize,
-		flushInterval:   time.Duration(flushIntervalMs) * time.Millisecond,
-		rawMode:         rawMode,
-		maxPayloadBytes: maxPayloadBytes,
-		logger:          logger,
-		routerMeta:      routerMeta,
-		routerIDCache:   make(map[string]string),
+		writer:           writer,
+		batchSize:        batchSize,
+		flushInterval:    time.Duration(flushIntervalMs) * time.Millisecond,
+		rawMode:          rawMode,
+		maxPayloadBytes:  maxPayloadBytes,
+		logger:           logger,
+		routerMeta:       routerMeta,
+		routerIDCache:    make(map[string]string),
+		speakerRouterIDs: make(map[string]string),
+		peerSessions:     make(bmp.PeerSessions),
 	}
 }
 
@@ -53,25 +63,37 @@ const (
 	actionAdjRibInRoute    // Adj-RIB-In route add/withdraw
 	actionAdjRibInEOR      // Adj-RIB-In End-of-RIB
 	actionAdjRibInPeerDown // Non-Loc-RIB peer down
+	actionAdjRibOutRoute   // Adj-RIB-Out route add/withdraw (RFC 8671)
+	actionAdjRibOutEOR     // Adj-RIB-Out End-of-RIB
 )
 
 // processedRecord holds the results of processing a single Kafka record.
-// Routes are separated by type (Loc-RIB vs Adj-RIB-In) so Run() can
-// dispatch them to the correct batch without last-writer-wins corruption
-// when a single raw record contains both Loc-RIB and non-Loc-RIB messages.
+// Routes are separated by type (Loc-RIB vs Adj-RIB-In vs Adj-RIB-Out) so
+// Run() can dispatch them to the correct batch without last-writer-wins
+// corruption when a single raw record contains several kinds of messages.
+// Non-Loc-RIB Peer Down is reported through adjAction and purges both
+// Adj-RIB-In and Adj-RIB-Out for the peer.
 type processedRecord struct {
 	locRoutes []*ParsedRoute
 	adjRoutes []*ParsedRoute
+	outRoutes []*ParsedRoute
 	locAction recordAction
 	adjAction recordAction
+	outAction recordAction
+	// downRouterID and downTableName are what a locAction of
+	// actionPeerDown purges: one table of the router for a Loc-RIB Peer
+	// Down, or every table (empty downTableName) for a Termination.
+	downRouterID  string
+	downTableName string
 }
 
 // Run processes records from the channel until context is cancelled.
 // It returns the records that were successfully flushed for offset commit.
-func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushed chan<- []*kgo.Record) {
+func (p *Pipeline) Run(ctx context.Context, records <-chan []*source.Record, flushed chan<- []*source.Record) {
 	var batch []*ParsedRoute
 	var adjBatch []*ParsedRoute
-	var batchRecords []*kgo.Record
+	var outBatch []*ParsedRoute
+	var batchRecords []*source.Record
 	ticker := time.NewTicker(p.flushInterval)
 	defer ticker.Stop()
 
@@ -83,7 +105,7 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 			if len(batchRecords) > 0 {
 				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 				defer cancel()
-				if err := p.flushAll(shutdownCtx, batch, adjBatch, batchRecords, flushed); err != nil {
+				if err := p.flushAll(shutdownCtx, batch, adjBatch, outBatch, batchRecords, flushed); err != nil {
 					p.logger.Error("final flush failed", zap.Error(err))
 				}
 			}
@@ -94,7 +116,7 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 				if len(batchRecords) > 0 {
 					shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 					defer cancel()
-					if err := p.flushAll(shutdownCtx, batch, adjBatch, batchRecords, flushed); err != nil {
+					if err := p.flushAll(shutdownCtx, batch, adjBatch, outBatch, batchRecords, flushed); err != nil {
 						p.logger.Error("final flush failed", zap.Error(err))
 					}
 				}
@@ -104,7 +126,8 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 			for _, rec := range recs {
 				result := p.processRecord(ctx, rec)
 
-				if len(result.locRoutes) == 0 && len(result.adjRoutes) == 0 {
+				if len(result.locRoutes) == 0 && len(result.adjRoutes) == 0 && len(result.outRoutes) == 0 &&
+					result.locAction != actionPeerDown {
 					// Always track the record for offset commit, even if
 					// parsing failed or the message was filtered. This
 					// prevents unparseable records from stalling partition
@@ -145,7 +168,7 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 							if !r.IsEOR {
 								continue
 							}
-							if err := p.writer.HandleAdjRibInEOR(ctx, r.RouterID, r.PeerAddress, r.TableName, r.AFI); err != nil {
+							if err := p.writer.HandleAdjRibInEOR(ctx, r.RouterID, r.PeerAddress, r.PeerRD, r.TableName, r.AFI, r.SAFI); err != nil {
 								p.logger.Error("adj_rib_in EOR handling failed", zap.Error(err))
 								eorFailed = true
 							}
@@ -157,7 +180,7 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 						}
 
 					case actionAdjRibInPeerDown:
-						// Flush pending adj batch to persist routes from other routers.
+						// Flush pending adj batches to persist routes from other routers.
 						if len(adjBatch) > 0 {
 							if err := p.writer.FlushAdjRibInBatch(ctx, adjBatch); err != nil {
 								p.logger.Error("pre-adj-peerdown flush failed", zap.Error(err))
@@ -166,8 +189,26 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 							}
 							adjBatch = nil
 						}
-						if err := p.writer.HandleAdjRibInPeerDown(ctx, result.adjRoutes[0].RouterID, result.adjRoutes[0].PeerAddress); err != nil {
-							p.logger.Error("adj_rib_in peer down failed", zap.Error(err))
+						if len(outBatch) > 0 {
+							if err := p.writer.FlushAdjRibOutBatch(ctx, outBatch); err != nil {
+								p.logger.Error("pre-adj-peerdown adj_rib_out flush failed", zap.Error(err))
+								skipRecord = true
+								break
+							}
+							outBatch = nil
+						}
+						down := result.adjRoutes[0]
+						if down.PeerRD != "" {
+							if err := p.writer.HandleVPNPeerDown(ctx, down.RouterID, down.PeerAddress, down.PeerRD); err != nil {
+								p.logger.Error("vpn_routes peer down failed", zap.Error(err))
+							}
+						} else {
+							if err := p.writer.HandleAdjRibInPeerDown(ctx, down.RouterID, down.PeerAddress); err != nil {
+								p.logger.Error("adj_rib_in peer down failed", zap.Error(err))
+							}
+							if err := p.writer.HandleAdjRibOutPeerDown(ctx, down.RouterID, down.PeerAddress); err != nil {
+								p.logger.Error("adj_rib_out peer down failed", zap.Error(err))
+							}
 						}
 						needsImmediateCommit = true
 					}
@@ -177,8 +218,50 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 					continue
 				}
 
+				// --- Handle Adj-RIB-Out ---
+				if len(result.outRoutes) > 0 {
+					switch result.outAction {
+					case actionAdjRibOutRoute:
+						outBatch = append(outBatch, result.outRoutes...)
+
+					case actionAdjRibOutEOR:
+						for _, r := range result.outRoutes {
+							if !r.IsEOR {
+								outBatch = append(outBatch, r)
+							}
+						}
+						if len(outBatch) > 0 {
+							if err := p.writer.FlushAdjRibOutBatch(ctx, outBatch); err != nil {
+								p.logger.Error("pre-adj-out-eor flush failed", zap.Error(err))
+								skipRecord = true
+								break
+							}
+							outBatch = nil
+						}
+						eorFailed := false
+						for _, r := range result.outRoutes {
+							if !r.IsEOR {
+								continue
+							}
+							if err := p.writer.HandleAdjRibOutEOR(ctx, r.RouterID, r.PeerAddress, r.PeerRD, r.TableName, r.AFI, r.SAFI); err != nil {
+								p.logger.Error("adj_rib_out EOR handling failed", zap.Error(err))
+								eorFailed = true
+							}
+						}
+						if eorFailed {
+							skipRecord = true
+						} else {
+							needsImmediateCommit = true
+						}
+					}
+				}
+
+				if skipRecord {
+					continue
+				}
+
 				// --- Handle Loc-RIB ---
-				if len(result.locRoutes) > 0 {
+				if len(result.locRoutes) > 0 || result.locAction == actionPeerDown {
 					switch result.locAction {
 					case actionRoute:
 						batch = append(batch, result.locRoutes...)
@@ -204,7 +287,7 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 							if !r.IsEOR {
 								continue
 							}
-							if err := p.writer.HandleEOR(ctx, r.RouterID, r.TableName, r.AFI); err != nil {
+							if err := p.writer.HandleEOR(ctx, r.RouterID, r.TableName, r.AFI, r.SAFI); err != nil {
 								p.logger.Error("EOR handling failed", zap.Error(err))
 								eorFailed = true
 							}
@@ -224,6 +307,12 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 							}
 							adjBatch = nil
 						}
+						if len(outBatch) > 0 {
+							if err := p.writer.FlushAdjRibOutBatch(ctx, outBatch); err != nil {
+								p.logger.Error("pre-peerdown adj_rib_out flush failed", zap.Error(err))
+							}
+							outBatch = nil
+						}
 						// Flush pending Loc-RIB routes to DB before session termination.
 						if len(batch) > 0 {
 							if err := p.writer.FlushBatch(ctx, batch); err != nil {
@@ -232,14 +321,17 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 							}
 							batch = nil
 						}
-						if err := p.writer.HandleSessionTermination(ctx, result.locRoutes[0].RouterID, result.locRoutes[0].TableName); err != nil {
+						if err := p.writer.HandleSessionTermination(ctx, result.downRouterID, result.downTableName); err != nil {
 							p.logger.Error("session termination failed", zap.Error(err))
 						} else {
 							// Also purge all adj_rib_in for the router since BMP session loss
 							// means all peer monitoring data is stale.
-							if err := p.writer.HandleAdjRibInSessionTermination(ctx, result.locRoutes[0].RouterID); err != nil {
+							if err := p.writer.HandleAdjRibInSessionTermination(ctx, result.downRouterID); err != nil {
 								p.logger.Error("adj_rib_in session purge failed", zap.Error(err))
 							}
+							if err := p.writer.HandleAdjRibOutSessionTermination(ctx, result.downRouterID); err != nil {
+								p.logger.Error("adj_rib_out session purge failed", zap.Error(err))
+							}
 						}
 						needsImmediateCommit = true
 					}
@@ -257,11 +349,12 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 			}
 
 			if len(batchRecords) >= p.batchSize {
-				if err := p.flushAll(ctx, batch, adjBatch, batchRecords, flushed); err != nil {
+				if err := p.flushAll(ctx, batch, adjBatch, outBatch, batchRecords, flushed); err != nil {
 					p.logger.Error("batch flush failed", zap.Error(err))
 				} else {
 					batch = nil
 					adjBatch = nil
+					outBatch = nil
 					batchRecords = nil
 				}
 			}
@@ -273,21 +366,23 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 			if len(batchRecords) >= p.batchSize*10 {
 				p.logger.Error("dropping oversized batch after repeated flush failures",
 					zap.Int("dropped_records", len(batchRecords)),
-					zap.Int("dropped_routes", len(batch)+len(adjBatch)),
+					zap.Int("dropped_routes", len(batch)+len(adjBatch)+len(outBatch)),
 				)
 				metrics.BatchDroppedTotal.WithLabelValues("state").Inc()
 				batch = nil
 				adjBatch = nil
+				outBatch = nil
 				batchRecords = nil
 			}
 
 		case <-ticker.C:
 			if len(batchRecords) > 0 {
-				if err := p.flushAll(ctx, batch, adjBatch, batchRecords, flushed); err != nil {
+				if err := p.flushAll(ctx, batch, adjBatch, outBatch, batchRecords, flushed); err != nil {
 					p.logger.Error("timer flush failed", zap.Error(err))
 				} else {
 					batch = nil
 					adjBatch = nil
+					outBatch = nil
 					batchRecords = nil
 				}
 			}
@@ -295,8 +390,8 @@ func (p *Pipeline) Run(ctx context.Context, records <-chan []*kgo.Record, flushe
 	}
 }
 
-func (p *Pipeline) processRecord(ctx context.Context, rec *kgo.Record) *processedRecord {
-	if p.rawMode {
+func (p *Pipeline) processRecord(ctx context.Context, rec *source.Record) *processedRecord {
+	if p.rawMode || rec.Raw {
 		return p.processRawRecord(ctx, rec)
 	}
 
@@ -345,7 +440,7 @@ func (p *Pipeline) processRecord(ctx context.Context, rec *kgo.Record) *processe
 	}
 }
 
-func (p *Pipeline) processPeerRecord(ctx context.Context, rec *kgo.Record) *processedRecord {
+func (p *Pipeline) processPeerRecord(ctx context.Context, rec *source.Record) *processedRecord {
 	pe, err := DecodePeerMessage(rec.Value)
 	if err != nil {
 		metrics.ParseErrorsTotal.WithLabelValues("json", "peer_decode").Inc()
@@ -362,16 +457,13 @@ func (p *Pipeline) processPeerRecord(ctx context.Context, rec *kgo.Record) *proc
 
 	if pe.Action == "peer_up" {
 		metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, "", "peer_up").Inc()
-		// PeerUp is session-level — reset both AFI 4 and 6.
-		for _, afi := range []int{4, 6} {
-			if err := p.writer.UpdateSessionStart(ctx, pe.RouterID, pe.TableName, afi); err != nil {
-				p.logger.Error("UpdateSessionStart failed",
-					zap.String("router_id", pe.RouterID),
-					zap.String("table_name", pe.TableName),
-					zap.Int("afi", afi),
-					zap.Error(err),
-				)
-			}
+		// PeerUp is session-level — reset every family.
+		if err := p.writer.UpdateSessionStart(ctx, pe.RouterID, pe.TableName); err != nil {
+			p.logger.Error("UpdateSessionStart failed",
+				zap.String("router_id", pe.RouterID),
+				zap.String("table_name", pe.TableName),
+				zap.Error(err),
+			)
 		}
 		return &processedRecord{}
 	}
@@ -379,16 +471,59 @@ func (p *Pipeline) processPeerRecord(ctx context.Context, rec *kgo.Record) *proc
 	if pe.Action == "peer_down" {
 		metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, "", "peer_down").Inc()
 		return &processedRecord{
-			locRoutes: []*ParsedRoute{{RouterID: pe.RouterID, TableName: pe.TableName}},
-			locAction: actionPeerDown,
+			locAction:     actionPeerDown,
+			downRouterID:  pe.RouterID,
+			downTableName: pe.TableName,
 		}
 	}
 
 	return &processedRecord{}
 }
 
-func (p *Pipeline) processRawRecord(ctx context.Context, rec *kgo.Record) *processedRecord {
-	bmpBytes, err := bmp.DecodeOpenBMPFrame(rec.Value, p.maxPayloadBytes)
+// endSession forgets the per-session state of the BMP session
+// obmpRouterHash and returns the router ID whose routes the session end
+// purges, empty if unknown.
+func (p *Pipeline) endSession(obmpRouterIP, obmpRouterHash string) string {
+	routerID := obmpRouterIP
+	if cached, ok := p.speakerRouterIDs[obmpRouterIP]; ok {
+		routerID = cached
+	} else if cached, ok := p.routerIDCache[obmpRouterHash]; ok && obmpRouterHash != "" {
+		routerID = cached
+	}
+	p.peerSessions.ForgetRouter(obmpRouterHash)
+	delete(p.routerIDCache, obmpRouterHash)
+	return routerID
+}
+
+// processEndOfSession handles a listener session that closed without a BMP
+// Termination like a Termination, unless the router has already opened a
+// new session (see source.Record.EndOfSession).
+func (p *Pipeline) processEndOfSession(rec *source.Record) *processedRecord {
+	routerID := p.endSession(rec.RouterIP, rec.RouterHash)
+	if rec.SessionReplaced || routerID == "" {
+		return &processedRecord{}
+	}
+	metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, "", "session_closed").Inc()
+	p.logger.Info("BMP session closed without Termination",
+		zap.String("router_id", routerID),
+		zap.String("remote", rec.RouterHash),
+	)
+	return &processedRecord{
+		locAction:     actionPeerDown,
+		downRouterID:  routerID,
+		downTableName: "",
+	}
+}
+
+func (p *Pipeline) processRawRecord(ctx context.Context, rec *source.Record) *processedRecord {
+	if rec.EndOfSession {
+		return p.processEndOfSession(rec)
+	}
+
+	// Router IP is a fallback for Loc-RIB identity. Router hash is the
+	// correlation key for non-Loc-RIB messages (unique per router+peer for
+	// goBMP, per TCP connection for the BMP listener).
+	bmpBytes, obmpRouterIP, obmpRouterHash, err := rec.BMP(p.maxPayloadBytes)
 	if err != nil {
 		metrics.ParseErrorsTotal.WithLabelValues("raw", "openbmp_decode").Inc()
 		p.logger.Warn("failed to decode OpenBMP frame",
@@ -410,16 +545,36 @@ func (p *Pipeline) processRawRecord(ctx context.Context, rec *kgo.Record) *proce
 		return &processedRecord{}
 	}
 
-	// Extract router IP and router hash from the OpenBMP v1.7 header.
-	// Router IP is a fallback for Loc-RIB identity. Router hash is the
-	// correlation key for non-Loc-RIB messages (unique per router+peer).
-	obmpRouterIP := bmp.RouterIPFromOpenBMPV17(rec.Value)
-	obmpRouterHash := bmp.RouterHashFromOpenBMPV17(rec.Value)
+	// Fallback event time for messages whose per-peer header carries no
+	// timestamp (RFC 7854 §4.2 allows zero).
+	collectorTime := rec.CollectorTime()
 
 	var result processedRecord
 
 msgLoop:
 	for _, parsed := range msgs {
+		if parsed.MsgType == bmp.MsgTypeTermination {
+			// Termination ends the whole BMP session: every Loc-RIB table
+			// and every Adj-RIB-In peer of this router is now stale. An
+			// empty table name makes HandleSessionTermination purge all
+			// tables, and the peer-down path also purges adj_rib_in. The
+			// router ID is the one its Loc-RIB or, for a router sending
+			// only Adj-RIBs, its Peer Ups were stored under.
+			routerID := p.endSession(obmpRouterIP, obmpRouterHash)
+			if routerID == "" {
+				continue
+			}
+			metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, "", "termination").Inc()
+			p.logger.Info("BMP Termination received",
+				zap.String("router_id", routerID),
+				zap.Uint16("reason_code", parsed.TermReason),
+				zap.String("reason", bmp.TermReasonName(parsed.TermReason)),
+			)
+			result.locAction = actionPeerDown
+			result.downRouterID, result.downTableName = routerID, ""
+			break msgLoop
+		}
+
 		if parsed.IsLocRIB {
 			// --- Loc-RIB path (peer type 3) ---
 			peerHdrOffset := parsed.Offset + bmp.CommonHeaderSize
@@ -429,18 +584,18 @@ msgLoop:
 					routerID = obmpRouterIP
 				}
 			}
+			if obmpRouterIP != "" {
+				p.speakerRouterIDs[obmpRouterIP] = routerID
+			}
 
 			if parsed.MsgType == bmp.MsgTypePeerUp {
 				metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, "", "peer_up").Inc()
-				for _, afi := range []int{4, 6} {
-					if err := p.writer.UpdateSessionStart(ctx, routerID, parsed.TableName, afi); err != nil {
-						p.logger.Error("UpdateSessionStart failed",
-							zap.String("router_id", routerID),
-							zap.String("table_name", parsed.TableName),
-							zap.Int("afi", afi),
-							zap.Error(err),
-						)
-					}
+				if err := p.writer.UpdateSessionStart(ctx, routerID, parsed.TableName); err != nil {
+					p.logger.Error("UpdateSessionStart failed",
+						zap.String("router_id", routerID),
+						zap.String("table_name", parsed.TableName),
+						zap.Error(err),
+					)
 				}
 				continue
 			}
@@ -451,9 +606,10 @@ msgLoop:
 					zap.String("router_id", routerID),
 					zap.String("table_name", parsed.TableName),
 					zap.Uint8("reason_code", parsed.PeerDownReason),
+					zap.String("reason", bmp.PeerDownReasonName(parsed.PeerDownReason)),
 				)
 				result.locAction = actionPeerDown
-				result.locRoutes = append(result.locRoutes, &ParsedRoute{RouterID: routerID, TableName: parsed.TableName})
+				result.downRouterID, result.downTableName = routerID, parsed.TableName
 				break msgLoop
 			}
 
@@ -465,7 +621,12 @@ msgLoop:
 				continue
 			}
 
-			events, actualAddPath, err := bgp.ParseUpdateAutoDetect(parsed.BGPData, parsed.HasAddPath)
+			eventTime := parsed.Timestamp
+			if eventTime.IsZero() {
+				eventTime = collectorTime
+			}
+
+			bgpRoutes, actualAddPath, err := bgp.DecodeUpdateAutoDetect(parsed.BGPData, parsed.HasAddPath, bgp.ASNWidthAuto)
 			if err != nil {
 				metrics.ParseErrorsTotal.WithLabelValues("raw", "bgp_parse").Inc()
 				p.logger.Warn("failed to parse BGP UPDATE",
@@ -474,6 +635,7 @@ msgLoop:
 				)
 				continue
 			}
+			countUpdateErrors(bgpRoutes)
 
 			if actualAddPath != parsed.HasAddPath {
 				p.logger.Warn("Add-Path auto-detected: router sends Add-Path NLRI without F-bit in BMP per-peer header (RFC 9069 non-compliance)",
@@ -483,8 +645,8 @@ msgLoop:
 			}
 
 			// EOR: empty UPDATE means End-of-RIB.
-			if len(events) == 0 {
-				afi := bgp.DetectEORAFI(parsed.BGPData)
+			if len(bgpRoutes) == 0 {
+				afi, safi := bgp.DetectEORFamily(parsed.BGPData)
 				afiStr := fmt.Sprintf("%d", afi)
 				metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, afiStr, "eor").Inc()
 				metrics.LastMsgTimestamp.WithLabelValues("state", routerID, parsed.TableName, afiStr).SetToCurrentTime()
@@ -492,44 +654,42 @@ msgLoop:
 					RouterID:  routerID,
 					TableName: parsed.TableName,
 					AFI:       afi,
+					SAFI:      safi,
 					IsLocRIB:  true,
 					IsEOR:     true,
+					EventTime: eventTime,
 				})
 				result.locAction = actionEOR
 				continue
 			}
 
-			for _, ev := range events {
-				afiStr := fmt.Sprintf("%d", ev.AFI)
-				metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, afiStr, ev.Action).Inc()
+			for i := range bgpRoutes {
+				rt := &bgpRoutes[i]
+				afiStr := fmt.Sprintf("%d", rt.AFI)
+				metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, afiStr, rt.Action).Inc()
 				metrics.LastMsgTimestamp.WithLabelValues("state", routerID, parsed.TableName, afiStr).SetToCurrentTime()
 
-				r := &ParsedRoute{
-					RouterID:  routerID,
-					TableName: parsed.TableName,
-					AFI:       ev.AFI,
-					Prefix:    ev.Prefix,
-					PathID:    ev.PathID,
-					Action:    ev.Action,
-					IsLocRIB:  true,
-					Nexthop:   ev.Nexthop,
-					ASPath:    ev.ASPath,
-					Origin:    ev.Origin,
-					LocalPref: ev.LocalPref,
-					MED:       ev.MED,
-					OriginASN: bgp.OriginASN(ev.ASPath),
-					CommStd:   ev.CommStd,
-					CommExt:   ev.CommExt,
-					CommLarge: ev.CommLarge,
-				}
-				if len(ev.Attrs) > 0 {
-					attrs := make(map[string]any, len(ev.Attrs))
-					for k, v := range ev.Attrs {
-						attrs[k] = v
-					}
-					r.Attrs = attrs
-				}
-				result.locRoutes = append(result.locRoutes, r)
+				result.locRoutes = append(result.locRoutes, &ParsedRoute{
+					RouterID:      routerID,
+					TableName:     parsed.TableName,
+					AFI:           rt.AFI,
+					SAFI:          rt.SAFI,
+					RD:            rt.RD,
+					EVPN:          rt.EVPN,
+					FlowSpec:      rt.FlowSpec,
+					LinkState:     rt.LinkState,
+					SRPolicy:      rt.SRPolicy,
+					Prefix:        rt.Prefix,
+					PathID:        rt.PathID,
+					Labels:        rt.Labels,
+					Action:        rt.Action,
+					IsLocRIB:      true,
+					Nexthop:       rt.NextHop,
+					NexthopLL:     rt.NextHopLL,
+					PathAttrs:     rt.Attrs,
+					ParseWarnings: rt.Warnings,
+					EventTime:     eventTime,
+				})
 			}
 			if result.locAction != actionEOR {
 				result.locAction = actionRoute
@@ -563,17 +723,22 @@ msgLoop:
 				if obmpRouterHash != "" {
 					p.routerIDCache[obmpRouterHash] = peerUpRouterID
 				}
+				p.peerSessions.Learn(obmpRouterHash, parsed)
 				routerID = peerUpRouterID
 				if p.writer != nil {
-					for _, afi := range []int{4, 6} {
-						if err := p.writer.UpdateAdjRibInSessionStart(ctx, peerUpRouterID, parsed.PeerAddress, afi); err != nil {
-							p.logger.Error("UpdateAdjRibInSessionStart failed",
-								zap.String("router_id", peerUpRouterID),
-								zap.String("peer_address", parsed.PeerAddress),
-								zap.Int("afi", afi),
-								zap.Error(err),
-							)
-						}
+					if err := p.writer.UpdateAdjRibInSessionStart(ctx, peerUpRouterID, parsed.PeerAddress, parsed.PeerRD); err != nil {
+						p.logger.Error("UpdateAdjRibInSessionStart failed",
+							zap.String("router_id", peerUpRouterID),
+							zap.String("peer_address", parsed.PeerAddress),
+							zap.Error(err),
+						)
+					}
+					if err := p.writer.UpdateAdjRibOutSessionStart(ctx, peerUpRouterID, parsed.PeerAddress, parsed.PeerRD); err != nil {
+						p.logger.Error("UpdateAdjRibOutSessionStart failed",
+							zap.String("router_id", peerUpRouterID),
+							zap.String("peer_address", parsed.PeerAddress),
+							zap.Error(err),
+						)
 					}
 				}
 				continue
@@ -581,10 +746,12 @@ msgLoop:
 			case bmp.MsgTypePeerDown:
 				// Non-Loc-RIB Peer Down: delete all adj_rib_in for this peer.
 				metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, "", "adj_peer_down").Inc()
+				p.peerSessions.Forget(obmpRouterHash, parsed)
 				p.logger.Info("Adj-RIB-In Peer Down received",
 					zap.String("router_id", routerID),
 					zap.String("peer_address", parsed.PeerAddress),
 					zap.Uint8("reason_code", parsed.PeerDownReason),
+					zap.String("reason", bmp.PeerDownReasonName(parsed.PeerDownReason)),
 				)
 				result.adjAction = actionAdjRibInPeerDown
 				result.adjRoutes = append(result.adjRoutes, &ParsedRoute{
@@ -593,6 +760,7 @@ msgLoop:
 					PeerAS:       parsed.PeerAS,
 					PeerBGPID:    parsed.PeerBGPID,
 					IsPostPolicy: parsed.IsPostPolicy,
+					PeerRD:       parsed.PeerRD,
 				})
 				break msgLoop
 
@@ -604,34 +772,47 @@ msgLoop:
 					continue
 				}
 
-				events, _, err := bgp.ParseUpdateAutoDetect(parsed.BGPData, parsed.HasAddPath)
+				bgpRoutes, _, err := p.peerSessions.DecodeUpdate(obmpRouterHash, parsed)
 				if err != nil {
 					metrics.ParseErrorsTotal.WithLabelValues("raw", "bgp_parse_adj").Inc()
 					continue
 				}
+				countUpdateErrors(bgpRoutes)
+
+				// O-flag (RFC 8671): the same message layout, but the routes
+				// are what the router advertises to the peer. Keep them out
+				// of adj_rib_in.
+				routes, action := &result.adjRoutes, &result.adjAction
+				routeAction, eorAction, metricPrefix := actionAdjRibInRoute, actionAdjRibInEOR, "adj_"
+				if parsed.IsAdjRIBOut {
+					routes, action = &result.outRoutes, &result.outAction
+					routeAction, eorAction, metricPrefix = actionAdjRibOutRoute, actionAdjRibOutEOR, "adj_out_"
+				}
 
 				// EOR for Adj-RIB-In
-				if len(events) == 0 {
-					afi := bgp.DetectEORAFI(parsed.BGPData)
+				if len(bgpRoutes) == 0 {
+					afi, safi := bgp.DetectEORFamily(parsed.BGPData)
 					afiStr := fmt.Sprintf("%d", afi)
-					metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, afiStr, "adj_eor").Inc()
+					metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, afiStr, metricPrefix+"eor").Inc()
 
 					tableName := parsed.TableName
 					if tableName == "UNKNOWN" {
 						tableName = ""
 					}
 
-					result.adjRoutes = append(result.adjRoutes, &ParsedRoute{
+					*routes = append(*routes, &ParsedRoute{
 						RouterID:     routerID,
 						PeerAddress:  parsed.PeerAddress,
 						PeerAS:       parsed.PeerAS,
 						PeerBGPID:    parsed.PeerBGPID,
 						IsPostPolicy: parsed.IsPostPolicy,
+						PeerRD:       parsed.PeerRD,
 						TableName:    tableName,
 						AFI:          afi,
+						SAFI:         safi,
 						IsEOR:        true,
 					})
-					result.adjAction = actionAdjRibInEOR
+					*action = eorAction
 					continue
 				}
 
@@ -640,9 +821,10 @@ msgLoop:
 					tableName = ""
 				}
 
-				for _, ev := range events {
-					afiStr := fmt.Sprintf("%d", ev.AFI)
-					metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, afiStr, "adj_"+ev.Action).Inc()
+				for i := range bgpRoutes {
+					rt := &bgpRoutes[i]
+					afiStr := fmt.Sprintf("%d", rt.AFI)
+					metrics.KafkaMessagesTotal.WithLabelValues("state", rec.Topic, afiStr, metricPrefix+rt.Action).Inc()
 
 					r := &ParsedRoute{
 						RouterID:     routerID,
@@ -650,32 +832,33 @@ msgLoop:
 						PeerAS:       parsed.PeerAS,
 						PeerBGPID:    parsed.PeerBGPID,
 						IsPostPolicy: parsed.IsPostPolicy,
+						PeerRD:       parsed.PeerRD,
 						TableName:    tableName,
-						AFI:          ev.AFI,
-						Prefix:       ev.Prefix,
-						PathID:       ev.PathID,
-						Action:       ev.Action,
-						Nexthop:      ev.Nexthop,
-						ASPath:       ev.ASPath,
-						Origin:       ev.Origin,
-						LocalPref:    ev.LocalPref,
-						MED:          ev.MED,
-						OriginASN:    bgp.OriginASN(ev.ASPath),
-						CommStd:      ev.CommStd,
-						CommExt:      ev.CommExt,
-						CommLarge:    ev.CommLarge,
+						AFI:          rt.AFI,
+						SAFI:         rt.SAFI,
+						RD:           rt.RD,
+						EVPN:         rt.EVPN,
+						FlowSpec:     rt.FlowSpec,
+						LinkState:    rt.LinkState,
+						SRPolicy:     rt.SRPolicy,
+						Prefix:       rt.Prefix,
+						PathID:       rt.PathID,
+						Labels:       rt.Labels,
+						Action:       rt.Action,
+						Nexthop:      rt.NextHop,
+						NexthopLL:    rt.NextHopLL,
+						PathAttrs:    rt.Attrs,
+
+						ParseWarnings: rt.Warnings,
+						LeakSuspected: p.peerSessions.LeakSuspected(obmpRouterHash, parsed, rt),
 					}
-					if len(ev.Attrs) > 0 {
-						attrs := make(map[string]any, len(ev.Attrs))
-						for k, v := range ev.Attrs {
-							attrs[k] = v
-						}
-						r.Attrs = attrs
+					if r.LeakSuspected {
+						metrics.RouteLeaksSuspectedTotal.WithLabelValues(afiStr).Inc()
 					}
-					result.adjRoutes = append(result.adjRoutes, r)
+					*routes = append(*routes, r)
 				}
-				if result.adjAction != actionAdjRibInEOR {
-					result.adjAction = actionAdjRibInRoute
+				if *action != eorAction {
+					*action = routeAction
 				}
 			}
 		}
@@ -684,13 +867,27 @@ msgLoop:
 	return &result
 }
 
-func (p *Pipeline) flushAll(ctx context.Context, batch, adjBatch []*ParsedRoute, records []*kgo.Record, flushed chan<- []*kgo.Record) error {
+// countUpdateErrors counts the RFC 7606 errors of an UPDATE, which all of
+// its routes carry.
+func countUpdateErrors(routes []bgp.Route) {
+	if len(routes) == 0 {
+		return
+	}
+	for _, w := range routes[0].Warnings {
+		metrics.UpdateErrorsTotal.WithLabelValues("state", w.Action.String(), w.AttrLabel()).Inc()
+	}
+}
+
+func (p *Pipeline) flushAll(ctx context.Context, batch, adjBatch, outBatch []*ParsedRoute, records []*source.Record, flushed chan<- []*source.Record) error {
 	if err := p.writer.FlushBatch(ctx, batch); err != nil {
 		return err
 	}
 	if err := p.writer.FlushAdjRibInBatch(ctx, adjBatch); err != nil {
 		return err
 	}
+	if err := p.writer.FlushAdjRibOutBatch(ctx, outBatch); err != nil {
+		return err
+	}
 
 	// Signal successful flush for offset commit.
 	select {
@@ -4,10 +4,11 @@ import (
 	"context"
 	"encoding/binary"
 	"testing"
+	"time"
 
 	"github.com/route-beacon/rib-ingester/internal/bgp"
 	"github.com/route-beacon/rib-ingester/internal/bmp"
-	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/route-beacon/rib-ingester/internal/source"
 	"go.uber.org/zap"
 )
 
@@ -58,6 +59,12 @@ func buildPathAttr(flags byte, typeCode byte, data []byte) []byte {
 	return attr
 }
 
+// wellKnownAttrs returns ORIGIN IGP and an empty AS_PATH, the well-known
+// mandatory attributes of an UPDATE announcing routes.
+func wellKnownAttrs() []byte {
+	return append(buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0}), buildPathAttr(0x40, bgp.AttrTypeASPath, nil)...)
+}
+
 // buildPerPeerHeader constructs a 42-byte BMP per-peer header.
 // peerType: 0=Global, 1=RD, 2=Local, 3=LocRIB
 // peerAddr: 4-byte IPv4 address (12 zero bytes + 4 IPv4, per BMP spec).
@@ -184,7 +191,7 @@ func TestProcessRawRecord_IPv4Announcement(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionRoute {
@@ -195,7 +202,7 @@ func TestProcessRawRecord_IPv4Announcement(t *testing.T) {
 	}
 
 	r := result.locRoutes[0]
-	if r.Prefix != "10.0.0.0/24" {
+	if r.Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", r.Prefix)
 	}
 	if r.AFI != 4 {
@@ -204,9 +211,14 @@ func TestProcessRawRecord_IPv4Announcement(t *testing.T) {
 	if r.Action != "A" {
 		t.Errorf("expected action 'A', got '%s'", r.Action)
 	}
-	if r.Nexthop != "192.168.1.1" {
+	if r.Nexthop.String() != "192.168.1.1" {
 		t.Errorf("expected nexthop '192.168.1.1', got '%s'", r.Nexthop)
 	}
+	// The writers render the path attributes.
+	renderPathAttrs(result.locRoutes)
+	if r.PathAttrs != nil {
+		t.Error("expected the path attributes to be cleared once rendered")
+	}
 	if r.ASPath != "65001 65002" {
 		t.Errorf("expected as_path '65001 65002', got '%s'", r.ASPath)
 	}
@@ -224,6 +236,36 @@ func TestProcessRawRecord_IPv4Announcement(t *testing.T) {
 	}
 }
 
+func TestProcessRawRecord_EventTime(t *testing.T) {
+	p := newTestPipeline(true)
+	bgpUpdate := buildBGPUpdate(nil, append(wellKnownAttrs(), buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})...), []byte{24, 10, 0, 0})
+	received := time.Date(2026, 3, 1, 12, 0, 5, 0, time.UTC)
+
+	// Zero per-peer header timestamp: the listener's read time is used.
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
+	rec := &source.Record{Value: bmpMsg, Raw: true, RouterIP: "10.0.0.1", RouterHash: "h", ReceivedAt: received}
+	result := p.processRawRecord(context.Background(), rec)
+	if len(result.locRoutes) != 1 {
+		t.Fatalf("expected 1 loc route, got %d", len(result.locRoutes))
+	}
+	if got := result.locRoutes[0].EventTime; !got.Equal(received) {
+		t.Errorf("expected event time %v, got %v", received, got)
+	}
+
+	// The router's timestamp wins over the read time.
+	routerTime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	bmpMsg = buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
+	binary.BigEndian.PutUint32(bmpMsg[bmp.CommonHeaderSize+34:], uint32(routerTime.Unix()))
+	rec = &source.Record{Value: bmpMsg, Raw: true, RouterIP: "10.0.0.1", RouterHash: "h", ReceivedAt: received}
+	result = p.processRawRecord(context.Background(), rec)
+	if len(result.locRoutes) != 1 {
+		t.Fatalf("expected 1 loc route, got %d", len(result.locRoutes))
+	}
+	if got := result.locRoutes[0].EventTime; !got.Equal(routerTime) {
+		t.Errorf("expected event time %v, got %v", routerTime, got)
+	}
+}
+
 func TestProcessRawRecord_IPv4Withdrawal(t *testing.T) {
 	p := newTestPipeline(true)
 
@@ -232,7 +274,7 @@ func TestProcessRawRecord_IPv4Withdrawal(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionRoute {
@@ -244,7 +286,7 @@ func TestProcessRawRecord_IPv4Withdrawal(t *testing.T) {
 	if result.locRoutes[0].Action != "D" {
 		t.Errorf("expected action 'D', got '%s'", result.locRoutes[0].Action)
 	}
-	if result.locRoutes[0].Prefix != "10.0.0.0/24" {
+	if result.locRoutes[0].Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", result.locRoutes[0].Prefix)
 	}
 }
@@ -263,14 +305,14 @@ func TestProcessRawRecord_IPv6Announcement(t *testing.T) {
 	mpReach = append(mpReach, 0x20, 0x01, 0x0d, 0xb8) // prefix bytes
 
 	mpReachAttr := buildPathAttr(0x80, bgp.AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nil)
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionRoute {
@@ -282,10 +324,10 @@ func TestProcessRawRecord_IPv6Announcement(t *testing.T) {
 	if result.locRoutes[0].AFI != 6 {
 		t.Errorf("expected AFI 6, got %d", result.locRoutes[0].AFI)
 	}
-	if result.locRoutes[0].Prefix != "2001:db8::/32" {
+	if result.locRoutes[0].Prefix.String() != "2001:db8::/32" {
 		t.Errorf("expected prefix '2001:db8::/32', got '%s'", result.locRoutes[0].Prefix)
 	}
-	if result.locRoutes[0].Nexthop != "2001:db8::1" {
+	if result.locRoutes[0].Nexthop.String() != "2001:db8::1" {
 		t.Errorf("expected nexthop '2001:db8::1', got '%s'", result.locRoutes[0].Nexthop)
 	}
 }
@@ -300,15 +342,15 @@ func TestProcessRawRecord_MultiPrefix(t *testing.T) {
 		24, 10, 0, 1, // 10.0.1.0/24
 	}
 
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	bgpUpdate := buildBGPUpdate(withdrawn, pathAttrs, nlri)
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionRoute {
@@ -322,15 +364,15 @@ func TestProcessRawRecord_MultiPrefix(t *testing.T) {
 	if result.locRoutes[0].Action != "D" {
 		t.Errorf("expected first route action 'D', got '%s'", result.locRoutes[0].Action)
 	}
-	if result.locRoutes[0].Prefix != "172.16.0.0/16" {
+	if result.locRoutes[0].Prefix.String() != "172.16.0.0/16" {
 		t.Errorf("expected prefix '172.16.0.0/16', got '%s'", result.locRoutes[0].Prefix)
 	}
 
 	// Second and third should be announcements.
-	if result.locRoutes[1].Action != "A" || result.locRoutes[1].Prefix != "10.0.0.0/24" {
+	if result.locRoutes[1].Action != "A" || result.locRoutes[1].Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected second route: A 10.0.0.0/24, got %s %s", result.locRoutes[1].Action, result.locRoutes[1].Prefix)
 	}
-	if result.locRoutes[2].Action != "A" || result.locRoutes[2].Prefix != "10.0.1.0/24" {
+	if result.locRoutes[2].Action != "A" || result.locRoutes[2].Prefix.String() != "10.0.1.0/24" {
 		t.Errorf("expected third route: A 10.0.1.0/24, got %s %s", result.locRoutes[2].Action, result.locRoutes[2].Prefix)
 	}
 }
@@ -347,7 +389,7 @@ func TestProcessRawRecord_BackwardCompatibility(t *testing.T) {
 	// that would fail OpenBMP decoding if dispatched to raw mode.
 	// Since JSON mode expects valid JSON and this isn't, it should
 	// return empty result (parse error), not panic.
-	rec := &kgo.Record{
+	rec := &source.Record{
 		Value: []byte(`{"router_hash":"r1","action":"add","prefix":"1.2.3.0/24","is_loc_rib":true}`),
 		Topic: "gobmp.parsed.unicast_prefix_v4",
 	}
@@ -358,7 +400,7 @@ func TestProcessRawRecord_BackwardCompatibility(t *testing.T) {
 	if len(result.locRoutes) != 1 {
 		t.Fatalf("expected 1 route from JSON mode, got %d", len(result.locRoutes))
 	}
-	if result.locRoutes[0].Prefix != "1.2.3.0/24" {
+	if result.locRoutes[0].Prefix.String() != "1.2.3.0/24" {
 		t.Errorf("expected prefix '1.2.3.0/24', got '%s'", result.locRoutes[0].Prefix)
 	}
 }
@@ -373,7 +415,7 @@ func TestProcessRawRecord_IPv4EOR(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionEOR {
@@ -406,7 +448,7 @@ func TestProcessRawRecord_IPv6EOR(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionEOR {
@@ -432,7 +474,7 @@ func TestProcessRawRecord_WithdrawalIsNotEOR(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionRoute {
@@ -454,17 +496,14 @@ func TestProcessRawRecord_LocRIBPeerDown(t *testing.T) {
 	bmpMsg := buildBMPPeerDown(bmp.PeerTypeLocRIB, [4]byte{10, 0, 0, 1}, 0, [4]byte{})
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionPeerDown {
 		t.Fatalf("expected actionPeerDown, got %d", result.locAction)
 	}
-	if len(result.locRoutes) != 1 {
-		t.Fatalf("expected 1 loc route, got %d", len(result.locRoutes))
-	}
-	if result.locRoutes[0].RouterID != "10.0.0.1" {
-		t.Errorf("expected router_id '10.0.0.1', got '%s'", result.locRoutes[0].RouterID)
+	if result.downRouterID != "10.0.0.1" {
+		t.Errorf("expected router_id '10.0.0.1', got '%s'", result.downRouterID)
 	}
 }
 
@@ -474,7 +513,7 @@ func TestProcessRawRecord_NonLocRIBPeerDown(t *testing.T) {
 	bmpMsg := buildBMPPeerDown(bmp.PeerTypeGlobal, [4]byte{10, 0, 0, 1}, 65001, [4]byte{10, 0, 0, 1})
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInPeerDown {
@@ -504,14 +543,14 @@ func TestProcessRawRecord_PeerDownIPv4Mapped(t *testing.T) {
 	bmpMsg := buildBMPPeerDown(bmp.PeerTypeLocRIB, [4]byte{10, 0, 0, 1}, 0, [4]byte{})
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionPeerDown {
 		t.Fatalf("expected actionPeerDown, got %d", result.locAction)
 	}
-	if result.locRoutes[0].RouterID != "10.0.0.1" {
-		t.Errorf("expected router_id '10.0.0.1', got '%s'", result.locRoutes[0].RouterID)
+	if result.downRouterID != "10.0.0.1" {
+		t.Errorf("expected router_id '10.0.0.1', got '%s'", result.downRouterID)
 	}
 }
 
@@ -531,7 +570,7 @@ func TestProcessRawRecord_NonUpdateNotEOR(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, keepalive, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	// Non-UPDATE should produce empty result (no routes, no action).
@@ -549,16 +588,16 @@ func TestProcessRawRecord_GlobalPeerAdjRibIn(t *testing.T) {
 	p := newTestPipeline(true)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	// Non-Loc-RIB Route Monitoring has no TLVs (RFC 7854), so pass empty table name.
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -573,7 +612,7 @@ func TestProcessRawRecord_GlobalPeerAdjRibIn(t *testing.T) {
 	if result.adjRoutes[0].PeerAddress != "10.0.0.1" {
 		t.Errorf("expected PeerAddress '10.0.0.1', got '%s'", result.adjRoutes[0].PeerAddress)
 	}
-	if result.adjRoutes[0].Prefix != "10.0.0.0/24" {
+	if result.adjRoutes[0].Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", result.adjRoutes[0].Prefix)
 	}
 	if result.adjRoutes[0].IsPostPolicy {
@@ -585,15 +624,17 @@ func TestProcessRawRecord_RDPeerAdjRibIn(t *testing.T) {
 	p := newTestPipeline(true)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeRD, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
+	// Peer Distinguisher 65000:100 (type 0)
+	copy(bmpMsg[bmp.CommonHeaderSize+2:], []byte{0, 0, 0xFD, 0xE8, 0, 0, 0, 100})
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -608,24 +649,28 @@ func TestProcessRawRecord_RDPeerAdjRibIn(t *testing.T) {
 	if result.adjRoutes[0].PeerAddress != "10.0.0.1" {
 		t.Errorf("expected PeerAddress '10.0.0.1', got '%s'", result.adjRoutes[0].PeerAddress)
 	}
-	if result.adjRoutes[0].Prefix != "10.0.0.0/24" {
+	if result.adjRoutes[0].Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", result.adjRoutes[0].Prefix)
 	}
+	// Routes of an RD instance peer carry its RD and go to vpn_routes.
+	if result.adjRoutes[0].PeerRD != "65000:100" || result.adjRoutes[0].RD != "65000:100" {
+		t.Errorf("expected PeerRD and RD '65000:100', got %q and %q", result.adjRoutes[0].PeerRD, result.adjRoutes[0].RD)
+	}
 }
 
 func TestProcessRawRecord_LocalPeerAdjRibIn(t *testing.T) {
 	p := newTestPipeline(true)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -640,7 +685,7 @@ func TestProcessRawRecord_LocalPeerAdjRibIn(t *testing.T) {
 	if result.adjRoutes[0].PeerAddress != "10.0.0.1" {
 		t.Errorf("expected PeerAddress '10.0.0.1', got '%s'", result.adjRoutes[0].PeerAddress)
 	}
-	if result.adjRoutes[0].Prefix != "10.0.0.0/24" {
+	if result.adjRoutes[0].Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", result.adjRoutes[0].Prefix)
 	}
 }
@@ -649,18 +694,18 @@ func TestProcessRawRecord_AdjRibInAttrsPopulated(t *testing.T) {
 	p := newTestPipeline(true)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
 	// Add a LocalPref attr (type 5) to verify attrs propagation (R3-M11).
 	localPrefAttr := buildPathAttr(0x40, bgp.AttrTypeLocalPref, []byte{0, 0, 0, 100})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	pathAttrs = append(pathAttrs, localPrefAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -672,6 +717,7 @@ func TestProcessRawRecord_AdjRibInAttrsPopulated(t *testing.T) {
 	if result.adjRoutes[0].RouterID != "10.0.0.2" {
 		t.Errorf("expected RouterID '10.0.0.2' (from OBMP), got '%s'", result.adjRoutes[0].RouterID)
 	}
+	renderPathAttrs(result.adjRoutes)
 	if result.adjRoutes[0].LocalPref == nil || *result.adjRoutes[0].LocalPref != 100 {
 		t.Errorf("expected LocalPref 100, got %v", result.adjRoutes[0].LocalPref)
 	}
@@ -691,7 +737,7 @@ func TestProcessRawRecord_BMPInitiationFiltered(t *testing.T) {
 	binary.BigEndian.PutUint16(bmpMsg[8:10], 0) // TLV len
 
 	frame := wrapOpenBMP(bmpMsg)
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 	if len(result.locRoutes) != 0 || len(result.adjRoutes) != 0 {
 		t.Errorf("expected no routes for BMP Initiation, got loc=%d adj=%d", len(result.locRoutes), len(result.adjRoutes))
@@ -713,14 +759,14 @@ func TestProcessRawRecord_BMPStatisticsFiltered(t *testing.T) {
 	// Stats count = 0.
 
 	frame := wrapOpenBMP(bmpMsg)
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 	if len(result.locRoutes) != 0 || len(result.adjRoutes) != 0 {
 		t.Errorf("expected no routes for BMP Statistics, got loc=%d adj=%d", len(result.locRoutes), len(result.adjRoutes))
 	}
 }
 
-func TestProcessRawRecord_BMPTerminationFiltered(t *testing.T) {
+func TestProcessRawRecord_BMPTerminationNoRouterIdentity(t *testing.T) {
 	p := newTestPipeline(true)
 
 	msgLen := bmp.CommonHeaderSize
@@ -730,10 +776,155 @@ func TestProcessRawRecord_BMPTerminationFiltered(t *testing.T) {
 	bmpMsg[5] = bmp.MsgTypeTermination
 
 	frame := wrapOpenBMP(bmpMsg)
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
-	if len(result.locRoutes) != 0 || len(result.adjRoutes) != 0 {
-		t.Errorf("expected no routes for BMP Termination, got loc=%d adj=%d", len(result.locRoutes), len(result.adjRoutes))
+	if result.locAction == actionPeerDown || len(result.locRoutes) != 0 || len(result.adjRoutes) != 0 {
+		t.Errorf("expected no purge for BMP Termination without router identity, got action=%d loc=%d adj=%d",
+			result.locAction, len(result.locRoutes), len(result.adjRoutes))
+	}
+}
+
+// buildBMPTermination builds a BMP Termination message with a reason TLV.
+func buildBMPTermination(reason uint16) []byte {
+	msgLen := bmp.CommonHeaderSize + 6
+	msg := make([]byte, msgLen)
+	msg[0] = 3
+	binary.BigEndian.PutUint32(msg[1:5], uint32(msgLen))
+	msg[5] = bmp.MsgTypeTermination
+	binary.BigEndian.PutUint16(msg[6:8], bmp.TermTLVTypeReason)
+	binary.BigEndian.PutUint16(msg[8:10], 2)
+	binary.BigEndian.PutUint16(msg[10:12], reason)
+	return msg
+}
+
+func TestProcessRawRecord_BMPTerminationPurgesRouter(t *testing.T) {
+	p := newTestPipeline(true)
+
+	frame := wrapOpenBMPV17(buildBMPTermination(bmp.TermReasonAdminClose), [4]byte{192, 0, 2, 1})
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction != actionPeerDown {
+		t.Fatalf("expected actionPeerDown, got %d", result.locAction)
+	}
+	if result.downRouterID != "192.0.2.1" {
+		t.Errorf("expected router_id '192.0.2.1', got '%s'", result.downRouterID)
+	}
+	if result.downTableName != "" {
+		t.Errorf("expected empty table name (purge all tables), got '%s'", result.downTableName)
+	}
+}
+
+func TestProcessRawRecord_BMPTerminationUsesLocRIBRouterID(t *testing.T) {
+	p := newTestPipeline(true)
+	speaker := [4]byte{192, 0, 2, 1}
+
+	// A Loc-RIB route from the speaker establishes its router ID (from the
+	// per-peer header), which differs from the OBMP router IP.
+	nlri := []byte{24, 10, 0, 0}
+	update := buildBGPUpdate(nil, buildPathAttr(0x40, 1, []byte{0}), nlri)
+	rm := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, update, "")
+	p.processRawRecord(context.Background(), &source.Record{Value: wrapOpenBMPV17(rm, speaker), Topic: "gobmp.raw"})
+
+	frame := wrapOpenBMPV17(buildBMPTermination(bmp.TermReasonUnspecified), speaker)
+	result := p.processRawRecord(context.Background(), &source.Record{Value: frame, Topic: "gobmp.raw"})
+
+	if result.locAction != actionPeerDown {
+		t.Fatalf("expected a peer-down purge, got action=%d", result.locAction)
+	}
+	if result.downRouterID != "10.0.0.1" {
+		t.Errorf("expected Loc-RIB router_id '10.0.0.1', got '%s'", result.downRouterID)
+	}
+}
+
+func TestProcessRawRecord_BMPTerminationAfterLocRIBRoutes(t *testing.T) {
+	p := newTestPipeline(true)
+	speaker := [4]byte{192, 0, 2, 1}
+
+	// A route of table "vrf-red" in the same record must not narrow the
+	// Termination's purge to that table.
+	nlri := []byte{24, 10, 0, 0}
+	update := buildBGPUpdate(nil, buildPathAttr(0x40, 1, []byte{0}), nlri)
+	rm := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, update, "vrf-red")
+	msg := append(rm, buildBMPTermination(bmp.TermReasonAdminClose)...)
+	result := p.processRawRecord(context.Background(), &source.Record{Value: wrapOpenBMPV17(msg, speaker), Topic: "gobmp.raw"})
+
+	if result.locAction != actionPeerDown {
+		t.Fatalf("expected a peer-down purge, got action=%d", result.locAction)
+	}
+	if result.downRouterID != "10.0.0.1" || result.downTableName != "" {
+		t.Errorf("expected all tables of '10.0.0.1' purged, got router '%s' table '%s'", result.downRouterID, result.downTableName)
+	}
+}
+
+func TestProcessRawRecord_BMPTerminationAdjRibInOnly(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// A router sending only Adj-RIB-In is known by the BGP ID of its Peer
+	// Ups, not its OBMP router IP.
+	p.routerIDCache["ab000000000000000000000000000000"] = "10.9.9.9"
+	frame := wrapOpenBMPV17(buildBMPTermination(bmp.TermReasonUnspecified), [4]byte{192, 0, 2, 1})
+	frame[40] = 0xab // router hash, after the empty admin ID
+	result := p.processRawRecord(context.Background(), &source.Record{Value: frame, Topic: "gobmp.raw"})
+
+	if result.locAction != actionPeerDown || result.downRouterID != "10.9.9.9" {
+		t.Errorf("expected router '10.9.9.9' purged, got action=%d router '%s'", result.locAction, result.downRouterID)
+	}
+}
+
+func TestProcessRawRecord_ListenerEndOfSession(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// A listener session that ends without a Termination: the router
+	// sending only Adj-RIB-In is purged and its session state dropped.
+	p.routerIDCache["192.0.2.1:40000"] = "10.9.9.9"
+	p.peerSessions["192.0.2.1:40000/10.0.0.2"] = &bgp.Session{}
+	p.peerSessions["192.0.2.1:40001/10.0.0.2"] = &bgp.Session{}
+	rec := &source.Record{Topic: "bmp.listener", Raw: true, RouterIP: "192.0.2.1", RouterHash: "192.0.2.1:40000", EndOfSession: true}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction != actionPeerDown || result.downRouterID != "10.9.9.9" || result.downTableName != "" {
+		t.Errorf("expected all tables of '10.9.9.9' purged, got action=%d router '%s' table '%s'",
+			result.locAction, result.downRouterID, result.downTableName)
+	}
+	if _, ok := p.routerIDCache["192.0.2.1:40000"]; ok {
+		t.Error("expected the session's router ID cache entry to be deleted")
+	}
+	if len(p.peerSessions) != 1 || p.peerSessions["192.0.2.1:40001/10.0.0.2"] == nil {
+		t.Errorf("expected only the other session's peer state to remain, got %d entries", len(p.peerSessions))
+	}
+}
+
+func TestProcessRawRecord_ListenerEndOfReplacedSession(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// The router has reconnected: the new session's routes are kept.
+	p.routerIDCache["192.0.2.1:40000"] = "10.9.9.9"
+	rec := &source.Record{Topic: "bmp.listener", Raw: true, RouterIP: "192.0.2.1", RouterHash: "192.0.2.1:40000",
+		EndOfSession: true, SessionReplaced: true}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction == actionPeerDown {
+		t.Errorf("expected no purge for a replaced session, got router '%s' purged", result.downRouterID)
+	}
+	if len(p.routerIDCache) != 0 {
+		t.Error("expected the session's router ID cache entry to be deleted")
+	}
+}
+
+func TestProcessRawRecord_BMPTerminationForgetsRouterID(t *testing.T) {
+	p := newTestPipeline(true)
+
+	p.routerIDCache["192.0.2.1:40000"] = "10.9.9.9"
+	rec := &source.Record{Value: buildBMPTermination(bmp.TermReasonAdminClose), Topic: "bmp.listener", Raw: true,
+		RouterIP: "192.0.2.1", RouterHash: "192.0.2.1:40000"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction != actionPeerDown || result.downRouterID != "10.9.9.9" {
+		t.Errorf("expected router '10.9.9.9' purged, got action=%d router '%s'", result.locAction, result.downRouterID)
+	}
+	if len(p.routerIDCache) != 0 {
+		t.Error("expected the session's router ID cache entry to be deleted")
 	}
 }
 
@@ -741,7 +932,7 @@ func TestProcessRawRecord_MalformedOpenBMP(t *testing.T) {
 	p := newTestPipeline(true)
 
 	// Truncated OpenBMP header (only 5 bytes, need 10).
-	rec := &kgo.Record{Value: []byte{0, 2, 0, 0, 0}, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: []byte{0, 2, 0, 0, 0}, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 	if len(result.locRoutes) != 0 || len(result.adjRoutes) != 0 {
 		t.Errorf("expected no routes for malformed OpenBMP, got loc=%d adj=%d", len(result.locRoutes), len(result.adjRoutes))
@@ -758,7 +949,7 @@ func TestProcessRawRecord_MalformedBMP(t *testing.T) {
 	badBMP[5] = 0
 
 	frame := wrapOpenBMP(badBMP)
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 	if len(result.locRoutes) != 0 || len(result.adjRoutes) != 0 {
 		t.Errorf("expected no routes for malformed BMP, got loc=%d adj=%d", len(result.locRoutes), len(result.adjRoutes))
@@ -779,7 +970,7 @@ func TestProcessRawRecord_OversizedPayload(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bigBGP, "locrib")
 	frame := wrapOpenBMP(bmpMsg)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 	if len(result.locRoutes) != 0 || len(result.adjRoutes) != 0 {
 		t.Errorf("expected no routes for oversized payload, got loc=%d adj=%d", len(result.locRoutes), len(result.adjRoutes))
@@ -823,7 +1014,7 @@ func TestProcessRawRecord_PeerUp_NonLocRIB(t *testing.T) {
 	bmpMsg := buildBMPPeerUp(bmp.PeerTypeGlobal, [4]byte{10, 0, 0, 1}, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	// Non-Loc-RIB PeerUp should produce no routes (calls writer directly).
@@ -839,9 +1030,9 @@ func TestProcessRawRecord_MixedRoutesAndEOR(t *testing.T) {
 
 	// Build first BMP msg: route announcement
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate1 := buildBGPUpdate(nil, pathAttrs, nlri)
 	bmpMsg1 := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate1, "locrib")
 
@@ -853,7 +1044,7 @@ func TestProcessRawRecord_MixedRoutesAndEOR(t *testing.T) {
 	combined := append(bmpMsg1, bmpMsg2...)
 	frame := wrapOpenBMP(combined)
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.locAction != actionEOR {
@@ -870,7 +1061,7 @@ func TestProcessRawRecord_MixedRoutesAndEOR(t *testing.T) {
 		if r.IsEOR {
 			hasEOR = true
 		}
-		if r.Prefix == "10.0.0.0/24" {
+		if r.Prefix.String() == "10.0.0.0/24" {
 			hasRoute = true
 		}
 	}
@@ -888,9 +1079,9 @@ func TestProcessRawRecord_MixedLocRIBAndAdjRibIn(t *testing.T) {
 	p := newTestPipeline(true)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	// First BMP: Loc-RIB route
@@ -901,7 +1092,7 @@ func TestProcessRawRecord_MixedLocRIBAndAdjRibIn(t *testing.T) {
 	combined := append(bmpMsg1, bmpMsg2...)
 	frame := wrapOpenBMPV17(combined, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	// Should have both Loc-RIB and Adj-RIB-In routes.
@@ -936,7 +1127,7 @@ func TestProcessRawRecord_AdjRibInEOR(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInEOR {
@@ -962,16 +1153,16 @@ func TestProcessRawRecord_AdjRibInPostPolicy(t *testing.T) {
 	p := newTestPipeline(true)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	// L-flag set (0x40) = post-policy.
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, bmp.PeerFlagPostPolicy, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -988,6 +1179,63 @@ func TestProcessRawRecord_AdjRibInPostPolicy(t *testing.T) {
 	}
 }
 
+// --- Adj-RIB-Out (RFC 8671) tests ---
+
+func TestProcessRawRecord_AdjRibOutRoute(t *testing.T) {
+	p := newTestPipeline(true)
+
+	nlri := []byte{24, 10, 0, 0}
+	wellKnown := wellKnownAttrs()
+	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
+	bgpUpdate := buildBGPUpdate(nil, append(wellKnown, nexthopAttr...), nlri)
+
+	// O-flag + L-flag = post-policy Adj-RIB-Out.
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, bmp.PeerFlagAdjRIBOut|bmp.PeerFlagPostPolicy, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
+	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
+
+	result := p.processRawRecord(context.Background(), &source.Record{Value: frame, Topic: "gobmp.raw"})
+
+	if len(result.adjRoutes) != 0 {
+		t.Fatalf("expected no adj_rib_in routes for O-flag message, got %d", len(result.adjRoutes))
+	}
+	if result.outAction != actionAdjRibOutRoute {
+		t.Fatalf("expected actionAdjRibOutRoute, got %d", result.outAction)
+	}
+	if len(result.outRoutes) != 1 {
+		t.Fatalf("expected 1 adj_rib_out route, got %d", len(result.outRoutes))
+	}
+	r := result.outRoutes[0]
+	if !r.IsPostPolicy {
+		t.Error("expected IsPostPolicy=true for L-flag=1")
+	}
+	if r.PeerAddress != "10.0.0.1" || r.Prefix.String() != "10.0.0.0/24" {
+		t.Errorf("unexpected route peer=%s prefix=%s", r.PeerAddress, r.Prefix)
+	}
+}
+
+func TestProcessRawRecord_AdjRibOutEOR(t *testing.T) {
+	p := newTestPipeline(true)
+
+	bgpUpdate := buildBGPUpdate(nil, nil, nil)
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, bmp.PeerFlagAdjRIBOut, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
+	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
+
+	result := p.processRawRecord(context.Background(), &source.Record{Value: frame, Topic: "gobmp.raw"})
+
+	if result.outAction != actionAdjRibOutEOR {
+		t.Fatalf("expected actionAdjRibOutEOR, got %d", result.outAction)
+	}
+	if len(result.outRoutes) != 1 || !result.outRoutes[0].IsEOR {
+		t.Fatalf("expected 1 adj_rib_out EOR marker, got %d routes", len(result.outRoutes))
+	}
+	if result.outRoutes[0].IsPostPolicy {
+		t.Error("expected pre-policy EOR for L-flag=0")
+	}
+	if len(result.adjRoutes) != 0 {
+		t.Errorf("expected no adj_rib_in routes, got %d", len(result.adjRoutes))
+	}
+}
+
 // --- Adj-RIB-In withdrawal test ---
 
 func TestProcessRawRecord_AdjRibInWithdrawal(t *testing.T) {
@@ -998,7 +1246,7 @@ func TestProcessRawRecord_AdjRibInWithdrawal(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -1013,7 +1261,7 @@ func TestProcessRawRecord_AdjRibInWithdrawal(t *testing.T) {
 	if result.adjRoutes[0].Action != "D" {
 		t.Errorf("expected action 'D', got '%s'", result.adjRoutes[0].Action)
 	}
-	if result.adjRoutes[0].Prefix != "10.0.0.0/24" {
+	if result.adjRoutes[0].Prefix.String() != "10.0.0.0/24" {
 		t.Errorf("expected prefix '10.0.0.0/24', got '%s'", result.adjRoutes[0].Prefix)
 	}
 }
@@ -1034,14 +1282,14 @@ func TestProcessRawRecord_AdjRibInIPv6(t *testing.T) {
 	mpReach = append(mpReach, 0x20, 0x01, 0x0d, 0xb8, 0, 0) // prefix bytes
 
 	mpReachAttr := buildPathAttr(0x80, bgp.AttrTypeMPReachNLRI, mpReach)
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
-	pathAttrs := append(originAttr, mpReachAttr...)
+	wellKnown := wellKnownAttrs()
+	pathAttrs := append(wellKnown, mpReachAttr...)
 
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nil)
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -1053,10 +1301,10 @@ func TestProcessRawRecord_AdjRibInIPv6(t *testing.T) {
 	if result.adjRoutes[0].AFI != 6 {
 		t.Errorf("expected AFI 6, got %d", result.adjRoutes[0].AFI)
 	}
-	if result.adjRoutes[0].Prefix != "2001:db8::/48" {
+	if result.adjRoutes[0].Prefix.String() != "2001:db8::/48" {
 		t.Errorf("expected prefix '2001:db8::/48', got '%s'", result.adjRoutes[0].Prefix)
 	}
-	if result.adjRoutes[0].Nexthop != "2001:db8::1" {
+	if result.adjRoutes[0].Nexthop.String() != "2001:db8::1" {
 		t.Errorf("expected nexthop '2001:db8::1', got '%s'", result.adjRoutes[0].Nexthop)
 	}
 	if result.adjRoutes[0].RouterID != "10.0.0.2" {
@@ -1078,15 +1326,15 @@ func TestProcessRawRecord_AdjRibInMultiPrefix(t *testing.T) {
 		24, 10, 0, 0, // 10.0.0.0/24
 		24, 10, 0, 1, // 10.0.1.0/24
 	}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 
 	bgpUpdate := buildBGPUpdate(withdrawn, pathAttrs, nlri)
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -1097,7 +1345,7 @@ func TestProcessRawRecord_AdjRibInMultiPrefix(t *testing.T) {
 	}
 
 	// First should be the withdrawal.
-	if result.adjRoutes[0].Action != "D" || result.adjRoutes[0].Prefix != "172.16.0.0/16" {
+	if result.adjRoutes[0].Action != "D" || result.adjRoutes[0].Prefix.String() != "172.16.0.0/16" {
 		t.Errorf("expected first adj route: D 172.16.0.0/16, got %s %s", result.adjRoutes[0].Action, result.adjRoutes[0].Prefix)
 	}
 	// All routes should share the same RouterID and PeerAddress.
@@ -1117,9 +1365,9 @@ func TestProcessRawRecord_AdjRibInTableNameNormalization(t *testing.T) {
 	p := newTestPipeline(true)
 
 	nlri := []byte{24, 10, 0, 0}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	// Non-Loc-RIB with no TLVs gets TableName="UNKNOWN" from the parser,
@@ -1127,7 +1375,7 @@ func TestProcessRawRecord_AdjRibInTableNameNormalization(t *testing.T) {
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if len(result.adjRoutes) != 1 {
@@ -1149,16 +1397,16 @@ func TestProcessRawRecord_AdjRibInAddPath(t *testing.T) {
 		0, 0, 0, 1, 24, 10, 0, 0, // path_id=1, 10.0.0.0/24
 		0, 0, 0, 2, 24, 10, 0, 0, // path_id=2, 10.0.0.0/24
 	}
-	originAttr := buildPathAttr(0x40, bgp.AttrTypeOrigin, []byte{0})
+	wellKnown := wellKnownAttrs()
 	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
-	pathAttrs := append(originAttr, nexthopAttr...)
+	pathAttrs := append(wellKnown, nexthopAttr...)
 	bgpUpdate := buildBGPUpdate(nil, pathAttrs, nlri)
 
 	// F-bit set (0x80) = Add-Path capable.
 	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, bmp.PeerFlagAddPath, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
 	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
 
-	rec := &kgo.Record{Value: frame, Topic: "gobmp.raw"}
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
 	result := p.processRawRecord(context.Background(), rec)
 
 	if result.adjAction != actionAdjRibInRoute {
@@ -1169,7 +1417,7 @@ func TestProcessRawRecord_AdjRibInAddPath(t *testing.T) {
 	}
 	// Both should be for 10.0.0.0/24 but with different path IDs.
 	for i, r := range result.adjRoutes {
-		if r.Prefix != "10.0.0.0/24" {
+		if r.Prefix.String() != "10.0.0.0/24" {
 			t.Errorf("route[%d]: expected prefix '10.0.0.0/24', got '%s'", i, r.Prefix)
 		}
 		if r.RouterID != "10.0.0.2" {
@@ -1183,3 +1431,210 @@ func TestProcessRawRecord_AdjRibInAddPath(t *testing.T) {
 		t.Errorf("expected second PathID=2, got %d", result.adjRoutes[1].PathID)
 	}
 }
+
+func TestProcessRawRecord_AdjRibInEVPN(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// Inclusive Multicast Ethernet Tag route: RD 65000:100, tag 0, originator 192.168.1.1.
+	evpnNLRI := []byte{bgp.EVPNInclusiveMulticast, 17,
+		0, 0, 0xFD, 0xE8, 0, 0, 0, 100,
+		0, 0, 0, 0,
+		32, 192, 168, 1, 1,
+	}
+	mpReach := append([]byte{0, byte(bgp.AFIL2VPN), bgp.SAFIEVPN, 4, 192, 168, 1, 1, 0}, evpnNLRI...)
+	wellKnown := wellKnownAttrs()
+	mpReachAttr := buildPathAttr(0x80, bgp.AttrTypeMPReachNLRI, mpReach)
+	bgpUpdate := buildBGPUpdate(nil, append(wellKnown, mpReachAttr...), nil)
+
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeGlobal, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "")
+	frame := wrapOpenBMPV17(bmpMsg, [4]byte{10, 0, 0, 2})
+
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.adjAction != actionAdjRibInRoute {
+		t.Fatalf("expected actionAdjRibInRoute, got %d", result.adjAction)
+	}
+	if len(result.adjRoutes) != 1 {
+		t.Fatalf("expected 1 adj route, got %d", len(result.adjRoutes))
+	}
+	r := result.adjRoutes[0]
+	if r.EVPN == nil {
+		t.Fatal("expected EVPN route")
+	}
+	if r.AFI != int(bgp.AFIL2VPN) || r.SAFI != bgp.SAFIEVPN {
+		t.Errorf("expected AFI 25 SAFI 70, got %d/%d", r.AFI, r.SAFI)
+	}
+	if r.EVPN.RD != "65000:100" || r.EVPN.IP != "192.168.1.1" {
+		t.Errorf("expected RD 65000:100 and IP 192.168.1.1, got %q and %q", r.EVPN.RD, r.EVPN.IP)
+	}
+	if r.Nexthop.String() != "192.168.1.1" {
+		t.Errorf("expected nexthop 192.168.1.1, got %q", r.Nexthop)
+	}
+}
+
+func TestProcessRawRecord_LocRIBFlowSpec(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// dst 192.0.2.0/24 proto =6, no next hop.
+	rule := []byte{bgp.FlowDstPrefix, 24, 192, 0, 2, bgp.FlowProtocol, 0x81, 6}
+	mpReach := append([]byte{0, byte(bgp.AFIIPv4), bgp.SAFIFlowSpec, 0, 0, byte(len(rule))}, rule...)
+	wellKnown := wellKnownAttrs()
+	mpReachAttr := buildPathAttr(0x80, bgp.AttrTypeMPReachNLRI, mpReach)
+	bgpUpdate := buildBGPUpdate(nil, append(wellKnown, mpReachAttr...), nil)
+
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
+	frame := wrapOpenBMP(bmpMsg)
+
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction != actionRoute {
+		t.Fatalf("expected actionRoute, got %d", result.locAction)
+	}
+	if len(result.locRoutes) != 1 {
+		t.Fatalf("expected 1 loc route, got %d", len(result.locRoutes))
+	}
+	r := result.locRoutes[0]
+	if r.FlowSpec == nil {
+		t.Fatal("expected FlowSpec rule")
+	}
+	if r.AFI != 4 || r.SAFI != bgp.SAFIFlowSpec || r.Prefix.IsValid() {
+		t.Errorf("expected AFI 4 SAFI 133 without prefix, got %d/%d %q", r.AFI, r.SAFI, r.Prefix)
+	}
+	if r.FlowSpec.Rule != "dst 192.0.2.0/24 proto =6" {
+		t.Errorf("unexpected rule %q", r.FlowSpec.Rule)
+	}
+}
+
+func TestProcessRawRecord_LocRIBLinkStateNode(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// IS-IS L2 node NLRI: local node AS 65000, system ID 0000.0000.0001.
+	desc := []byte{
+		0x02, 0x00, 0x00, 0x04, 0x00, 0x00, 0xFD, 0xE8, // AS Number
+		0x02, 0x03, 0x00, 0x06, 0, 0, 0, 0, 0, 1, // IGP Router-ID
+	}
+	body := append([]byte{2, 0, 0, 0, 0, 0, 0, 0, 0, 0x01, 0x00, 0x00, byte(len(desc))}, desc...)
+	nlri := append([]byte{0x00, byte(bgp.LSNodeNLRI), 0x00, byte(len(body))}, body...)
+	mpReach := append([]byte{0x40, 0x04, bgp.SAFIBGPLS, 4, 192, 0, 2, 1, 0}, nlri...)
+	wellKnown := wellKnownAttrs()
+	mpReachAttr := buildPathAttr(0x80, bgp.AttrTypeMPReachNLRI, mpReach)
+	lsAttr := buildPathAttr(0x80, bgp.AttrTypeBGPLS, []byte{0x04, 0x02, 0x00, 0x03, 'p', 'e', '1'}) // Node Name
+	bgpUpdate := buildBGPUpdate(nil, append(append(wellKnown, mpReachAttr...), lsAttr...), nil)
+
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
+	frame := wrapOpenBMP(bmpMsg)
+
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction != actionRoute {
+		t.Fatalf("expected actionRoute, got %d", result.locAction)
+	}
+	if len(result.locRoutes) != 1 {
+		t.Fatalf("expected 1 loc route, got %d", len(result.locRoutes))
+	}
+	r := result.locRoutes[0]
+	if r.LinkState == nil || r.LinkState.Attr == nil {
+		t.Fatal("expected BGP-LS NLRI with attribute")
+	}
+	if r.AFI != int(bgp.AFIBGPLS) || r.SAFI != bgp.SAFIBGPLS || r.Prefix.IsValid() {
+		t.Errorf("expected AFI 16388 SAFI 71 without prefix, got %d/%d %q", r.AFI, r.SAFI, r.Prefix)
+	}
+	if r.LinkState.Attr.NodeName != "pe1" {
+		t.Errorf("unexpected node name %q", r.LinkState.Attr.NodeName)
+	}
+	if got := eorSideTables(r.SAFI, ""); len(got) != 3 || got[0] != lsNodesTable {
+		t.Errorf("unexpected EOR side tables %v", got)
+	}
+}
+
+func TestProcessRawRecord_LocRIBSRPolicy(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// SR Policy NLRI: distinguisher 1, color 100, endpoint 192.0.2.9; the
+	// candidate path has preference 200.
+	nlri := []byte{96, 0, 0, 0, 1, 0, 0, 0, 100, 192, 0, 2, 9}
+	mpReach := append([]byte{0x00, 0x01, bgp.SAFISRPolicy, 4, 192, 0, 2, 1, 0}, nlri...)
+	tunnelEncap := []byte{0x00, 0x0F, 0x00, 0x08, 12, 6, 0, 0, 0, 0, 0, 200}
+	wellKnown := wellKnownAttrs()
+	mpReachAttr := buildPathAttr(0x80, bgp.AttrTypeMPReachNLRI, mpReach)
+	tunnelAttr := buildPathAttr(0xC0, bgp.AttrTypeTunnelEncap, tunnelEncap)
+	bgpUpdate := buildBGPUpdate(nil, append(append(wellKnown, mpReachAttr...), tunnelAttr...), nil)
+
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
+	frame := wrapOpenBMP(bmpMsg)
+
+	rec := &source.Record{Value: frame, Topic: "gobmp.raw"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction != actionRoute {
+		t.Fatalf("expected actionRoute, got %d", result.locAction)
+	}
+	if len(result.locRoutes) != 1 {
+		t.Fatalf("expected 1 loc route, got %d", len(result.locRoutes))
+	}
+	r := result.locRoutes[0]
+	if r.SRPolicy == nil {
+		t.Fatal("expected SR Policy")
+	}
+	if r.AFI != 4 || r.SAFI != bgp.SAFISRPolicy || r.Prefix.IsValid() {
+		t.Errorf("expected AFI 4 SAFI 73 without prefix, got %d/%d %q", r.AFI, r.SAFI, r.Prefix)
+	}
+	if r.SRPolicy.Color != 100 || r.SRPolicy.Endpoint != "192.0.2.9" {
+		t.Errorf("unexpected policy %d/%s", r.SRPolicy.Color, r.SRPolicy.Endpoint)
+	}
+	if r.SRPolicy.Preference == nil || *r.SRPolicy.Preference != 200 {
+		t.Errorf("unexpected preference %v", r.SRPolicy.Preference)
+	}
+	if got := eorSideTables(r.SAFI, ""); len(got) != 1 || got[0] != srPoliciesTable {
+		t.Errorf("unexpected EOR side tables %v", got)
+	}
+}
+
+func TestProcessRawRecord_LocRIBTreatAsWithdraw(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// A 3-octet MED makes the UPDATE withdraw 10.0.0.0/24 (RFC 7606 §7.4).
+	wellKnown := wellKnownAttrs()
+	nexthopAttr := buildPathAttr(0x40, bgp.AttrTypeNextHop, []byte{192, 168, 1, 1})
+	medAttr := buildPathAttr(0x80, bgp.AttrTypeMED, []byte{0, 0, 1})
+	pathAttrs := append(wellKnown, nexthopAttr...)
+	bgpUpdate := buildBGPUpdate(nil, append(pathAttrs, medAttr...), []byte{24, 10, 0, 0})
+
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
+	rec := &source.Record{Value: wrapOpenBMP(bmpMsg), Topic: "gobmp.raw"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction != actionRoute {
+		t.Fatalf("expected actionRoute, got %d", result.locAction)
+	}
+	if len(result.locRoutes) != 1 {
+		t.Fatalf("expected 1 loc route, got %d", len(result.locRoutes))
+	}
+	r := result.locRoutes[0]
+	if r.Action != "D" || r.Prefix.String() != "10.0.0.0/24" {
+		t.Errorf("expected withdrawal of 10.0.0.0/24, got %s %s", r.Action, r.Prefix)
+	}
+	if len(r.ParseWarnings) != 1 || r.ParseWarnings[0].Action != bgp.TreatAsWithdraw || r.ParseWarnings[0].Attr != bgp.AttrTypeMED {
+		t.Errorf("unexpected parse warnings %v", r.ParseWarnings)
+	}
+}
+
+func TestProcessRawRecord_MalformedUpdateIsNotEOR(t *testing.T) {
+	p := newTestPipeline(true)
+
+	// MP_UNREACH_NLRI whose only prefix is truncated: no route survives,
+	// and the UPDATE must not be taken for an IPv6 End-of-RIB.
+	mpUnreach := []byte{0x00, 0x02, 0x01, 64, 0x20, 0x01}
+	bgpUpdate := buildBGPUpdate(nil, buildPathAttr(0x80, bgp.AttrTypeMPUnreachNLRI, mpUnreach), nil)
+
+	bmpMsg := buildBMPRouteMonitoring(bmp.PeerTypeLocRIB, 0, [4]byte{10, 0, 0, 1}, bgpUpdate, "locrib")
+	rec := &source.Record{Value: wrapOpenBMP(bmpMsg), Topic: "gobmp.raw"}
+	result := p.processRawRecord(context.Background(), rec)
+
+	if result.locAction == actionEOR || len(result.locRoutes) != 0 {
+		t.Errorf("expected no routes and no EOR, got action %d with %d routes", result.locAction, len(result.locRoutes))
+	}
+}
@@ -0,0 +1,109 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+)
+
+// prefixSIDJSON marshals a Prefix-SID attribute for the prefix_sid column,
+// or returns nil for a route without one.
+func prefixSIDJSON(p *bgp.PrefixSID) ([]byte, error) {
+	if p == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("marshal prefix sid: %w", err)
+	}
+	return b, nil
+}
+
+// upsertSRPolicy writes an SR Policy candidate path (SAFI 73) to
+// sr_policies, keyed by its NLRI: distinguisher, color and endpoint.
+func (w *Writer) upsertSRPolicy(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	var attrsJSON []byte
+	if r.Attrs != nil {
+		var err error
+		attrsJSON, err = json.Marshal(r.Attrs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal attrs: %w", err)
+		}
+	}
+
+	p := r.SRPolicy
+	segmentLists, err := lsJSON(p.SegmentLists)
+	if err != nil {
+		return 0, fmt.Errorf("marshal segment lists: %w", err)
+	}
+	parseWarnings, err := parseWarningsJSON(r.ParseWarnings)
+	if err != nil {
+		return 0, err
+	}
+	var priority *int16
+	if p.Priority != nil {
+		v := int16(*p.Priority)
+		priority = &v
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO sr_policies (router_id, table_name, rib, peer_address, peer_rd, peer_asn, peer_bgp_id, is_post_policy,
+			afi, safi, distinguisher, color, endpoint, path_id,
+			preference, priority, binding_sid, candidate_path_name, policy_name, segment_lists,
+			nexthop, as_path, origin, localpref, med,
+			communities_std, communities_ext, communities_large, attrs,
+			originator_id, cluster_list, parse_warnings, first_seen, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, now(), now())
+		ON CONFLICT (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, afi, safi, distinguisher, color, endpoint, path_id)
+		DO UPDATE SET
+			peer_asn = EXCLUDED.peer_asn,
+			peer_bgp_id = EXCLUDED.peer_bgp_id,
+			preference = EXCLUDED.preference,
+			priority = EXCLUDED.priority,
+			binding_sid = EXCLUDED.binding_sid,
+			candidate_path_name = EXCLUDED.candidate_path_name,
+			policy_name = EXCLUDED.policy_name,
+			segment_lists = EXCLUDED.segment_lists,
+			nexthop = EXCLUDED.nexthop,
+			as_path = EXCLUDED.as_path,
+			origin = EXCLUDED.origin,
+			localpref = EXCLUDED.localpref,
+			med = EXCLUDED.med,
+			communities_std = EXCLUDED.communities_std,
+			communities_ext = EXCLUDED.communities_ext,
+			communities_large = EXCLUDED.communities_large,
+			attrs = EXCLUDED.attrs,
+			originator_id = EXCLUDED.originator_id,
+			cluster_list = EXCLUDED.cluster_list,
+			parse_warnings = EXCLUDED.parse_warnings,
+			updated_at = now()`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.PeerAS, r.PeerBGPID, r.IsPostPolicy,
+		r.AFI, r.SAFI, int64(p.Distinguisher), int64(p.Color), p.Endpoint, r.PathID,
+		p.Preference, priority, nullableString(p.BindingSID),
+		nullableString(p.CandidatePathName), nullableString(p.PolicyName), segmentLists,
+		nullableAddr(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
+		r.LocalPref, r.MED,
+		r.CommStd, r.CommExt, r.CommLarge, attrsJSON,
+		nullableString(r.OriginatorID), r.ClusterList, parseWarnings,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (w *Writer) deleteSRPolicy(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	p := r.SRPolicy
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM sr_policies WHERE router_id = $1 AND table_name = $2 AND rib = $3 AND peer_address = $4 AND peer_rd = $5 AND is_post_policy = $6 AND afi = $7 AND safi = $8 AND distinguisher = $9 AND color = $10 AND endpoint = $11 AND path_id = $12`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.IsPostPolicy, r.AFI, r.SAFI, int64(p.Distinguisher), int64(p.Color), p.Endpoint, r.PathID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,246 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/route-beacon/rib-ingester/internal/bgp"
+	"github.com/route-beacon/rib-ingester/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// RIB names stored in the rib column of the side tables.
+const (
+	ribLocRIB    = "loc-rib"
+	ribAdjRibIn  = "adj-rib-in"
+	ribAdjRibOut = "adj-rib-out"
+)
+
+const (
+	vpnRoutesTable     = "vpn_routes"
+	evpnRoutesTable    = "evpn_routes"
+	flowSpecRulesTable = "flowspec_rules"
+	lsNodesTable       = "ls_nodes"
+	lsLinksTable       = "ls_links"
+	lsPrefixesTable    = "ls_prefixes"
+	srPoliciesTable    = "sr_policies"
+)
+
+// sideTables hold the routes kept out of the RIBs' own tables.
+var sideTables = []string{vpnRoutesTable, evpnRoutesTable, flowSpecRulesTable, lsNodesTable, lsLinksTable, lsPrefixesTable, srPoliciesTable}
+
+// locRIBPeerAddress fills the peer_address key column of the side tables
+// for Loc-RIB rows, which have no peer.
+const locRIBPeerAddress = "0.0.0.0"
+
+func vpnPeerAddress(r *ParsedRoute, rib string) string {
+	if rib == ribLocRIB || r.PeerAddress == "" {
+		return locRIBPeerAddress
+	}
+	return r.PeerAddress
+}
+
+// upsertVPNRoute writes a route carrying a Route Distinguisher — a VPNv4/VPNv6
+// NLRI (SAFI 128) or any route from an RD instance peer — to vpn_routes
+// instead of the RIB's own table.
+func (w *Writer) upsertVPNRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	var attrsJSON []byte
+	if r.Attrs != nil {
+		var err error
+		attrsJSON, err = json.Marshal(r.Attrs)
+		if err != nil {
+			return 0, fmt.Errorf("marshal attrs: %w", err)
+		}
+	}
+
+	prefixSID, err := prefixSIDJSON(r.PrefixSID)
+	if err != nil {
+		return 0, err
+	}
+	parseWarnings, err := parseWarningsJSON(r.ParseWarnings)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO vpn_routes (router_id, table_name, rib, peer_address, peer_rd, peer_asn, peer_bgp_id, is_post_policy,
+			afi, safi, rd, prefix, path_id, labels,
+			nexthop, as_path, origin, localpref, med, origin_asn,
+			communities_std, communities_ext, communities_large, attrs,
+			originator_id, cluster_list, atomic_aggregate, aggregator_asn, aggregator_address, otc,
+			leak_suspected, nexthop_ll, prefix_sid, parse_warnings, first_seen, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, now(), now())
+		ON CONFLICT (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, afi, safi, rd, prefix, path_id)
+		DO UPDATE SET
+			peer_asn = EXCLUDED.peer_asn,
+			peer_bgp_id = EXCLUDED.peer_bgp_id,
+			labels = EXCLUDED.labels,
+			nexthop = EXCLUDED.nexthop,
+			nexthop_ll = EXCLUDED.nexthop_ll,
+			as_path = EXCLUDED.as_path,
+			origin = EXCLUDED.origin,
+			localpref = EXCLUDED.localpref,
+			med = EXCLUDED.med,
+			origin_asn = EXCLUDED.origin_asn,
+			communities_std = EXCLUDED.communities_std,
+			communities_ext = EXCLUDED.communities_ext,
+			communities_large = EXCLUDED.communities_large,
+			attrs = EXCLUDED.attrs,
+			originator_id = EXCLUDED.originator_id,
+			cluster_list = EXCLUDED.cluster_list,
+			atomic_aggregate = EXCLUDED.atomic_aggregate,
+			aggregator_asn = EXCLUDED.aggregator_asn,
+			aggregator_address = EXCLUDED.aggregator_address,
+			otc = EXCLUDED.otc,
+			leak_suspected = EXCLUDED.leak_suspected,
+			prefix_sid = EXCLUDED.prefix_sid,
+			parse_warnings = EXCLUDED.parse_warnings,
+			updated_at = now()`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.PeerAS, r.PeerBGPID, r.IsPostPolicy,
+		r.AFI, r.SAFI, r.RD, r.Prefix.String(), r.PathID, r.Labels,
+		nullableAddr(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
+		r.LocalPref, r.MED, r.OriginASN,
+		r.CommStd, r.CommExt, r.CommLarge, attrsJSON,
+		nullableString(r.OriginatorID), r.ClusterList, r.AtomicAggregate,
+		r.AggregatorASN, nullableString(r.AggregatorAddress), r.OTC,
+		r.LeakSuspected, nullableAddr(r.NexthopLL), prefixSID, parseWarnings,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (w *Writer) deleteVPNRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	tag, err := tx.Exec(ctx,
+		`DELETE FROM vpn_routes WHERE router_id = $1 AND table_name = $2 AND rib = $3 AND peer_address = $4 AND peer_rd = $5 AND is_post_policy = $6 AND afi = $7 AND safi = $8 AND rd = $9 AND prefix = $10 AND path_id = $11`,
+		r.RouterID, r.TableName, rib, vpnPeerAddress(r, rib), r.PeerRD, r.IsPostPolicy, r.AFI, r.SAFI, r.RD, r.Prefix.String(), r.PathID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// purgeStaleSideRoutes deletes rows of one EOR scope that were not
+// refreshed since the session started from table, one of sideTables.
+// peerAddress and peerRD are empty for Loc-RIB.
+func (w *Writer) purgeStaleSideRoutes(ctx context.Context, tx pgx.Tx, table, rib, routerID, peerAddress, peerRD, tableName string, afi int, safi uint8, sessionStart time.Time) error {
+	if peerAddress == "" {
+		peerAddress = locRIBPeerAddress
+	}
+	// EVPN and BGP-LS rows have no afi/safi columns: the EOR's family is
+	// the table.
+	query := `DELETE FROM ` + table + ` WHERE router_id = $1 AND rib = $2 AND peer_address = $3 AND peer_rd = $4 AND table_name = $5 AND updated_at < $6`
+	args := []any{routerID, rib, peerAddress, peerRD, tableName, sessionStart}
+	if table == vpnRoutesTable || table == flowSpecRulesTable || table == srPoliciesTable {
+		query += ` AND afi = $7 AND safi = $8`
+		args = append(args, afi, safi)
+	}
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("purge stale %s: %w", table, err)
+	}
+	if purged := tag.RowsAffected(); purged > 0 {
+		metrics.RoutesPurgedTotal.WithLabelValues("side_eor_stale").Add(float64(purged))
+		w.logger.Info("purged stale routes after EOR",
+			zap.String("table", table),
+			zap.String("router_id", routerID),
+			zap.String("rib", rib),
+			zap.String("peer_address", peerAddress),
+			zap.String("peer_rd", peerRD),
+			zap.String("table_name", tableName),
+			zap.Int("afi", afi),
+			zap.Uint8("safi", safi),
+			zap.Int64("purged", purged),
+		)
+	}
+	return nil
+}
+
+// purgeSideTables deletes the rows matching cond from sideTables, which
+// follow the lifecycle of the RIB named in their rib column. cond may use
+// the placeholders of args.
+func purgeSideTables(ctx context.Context, tx pgx.Tx, cond string, args ...any) (int64, error) {
+	var purged int64
+	for _, table := range sideTables {
+		tag, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE `+cond, args...)
+		if err != nil {
+			return 0, fmt.Errorf("purge %s: %w", table, err)
+		}
+		purged += tag.RowsAffected()
+	}
+	return purged, nil
+}
+
+// eorSideTables returns the tables holding the routes of an EOR scope that
+// are kept out of the RIB's own table.
+func eorSideTables(safi uint8, peerRD string) []string {
+	switch {
+	case safi == bgp.SAFIEVPN:
+		return []string{evpnRoutesTable}
+	case safi == bgp.SAFIFlowSpec || safi == bgp.SAFIFlowSpecVPN:
+		return []string{flowSpecRulesTable}
+	case safi == bgp.SAFIBGPLS:
+		return []string{lsNodesTable, lsLinksTable, lsPrefixesTable}
+	case safi == bgp.SAFISRPolicy:
+		return []string{srPoliciesTable}
+	case safi == bgp.SAFIMPLSVPN || peerRD != "":
+		return []string{vpnRoutesTable}
+	}
+	return nil
+}
+
+// HandleVPNPeerDown removes the side table rows learned from or
+// advertised to one RD instance peer (PeerTypeRD), and its sync status.
+// Such a peer owns no rows in adj_rib_in or adj_rib_out, and a global peer
+// with the same address must keep its routes, so the per-table peer down
+// handlers are not used.
+func (w *Writer) HandleVPNPeerDown(ctx context.Context, routerID, peerAddress, peerRD string) error {
+	start := time.Now()
+
+	tx, err := w.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin vpn peer down tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	purged, err := purgeSideTables(ctx, tx, `router_id = $1 AND rib <> $2 AND peer_address = $3 AND peer_rd = $4`,
+		routerID, ribLocRIB, peerAddress, peerRD)
+	if err != nil {
+		return fmt.Errorf("vpn peer down: %w", err)
+	}
+
+	for _, table := range []string{"adj_rib_in_sync_status", "adj_rib_out_sync_status"} {
+		_, err = tx.Exec(ctx,
+			`DELETE FROM `+table+` WHERE router_id = $1 AND peer_address = $2 AND peer_rd = $3`,
+			routerID, peerAddress, peerRD,
+		)
+		if err != nil {
+			return fmt.Errorf("%s vpn peer down: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit vpn peer down tx: %w", err)
+	}
+
+	dur := time.Since(start).Seconds()
+	metrics.DBWriteDuration.WithLabelValues("state", "vpn_peer_down").Observe(dur)
+	if purged > 0 {
+		metrics.RoutesPurgedTotal.WithLabelValues("vpn_peer_down").Add(float64(purged))
+	}
+
+	w.logger.Info("purged routes on RD instance peer down",
+		zap.String("router_id", routerID),
+		zap.String("peer_address", peerAddress),
+		zap.String("peer_rd", peerRD),
+		zap.Int64("purged", purged),
+	)
+
+	return nil
+}
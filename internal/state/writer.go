@@ -5,30 +5,42 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/netip"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/route-beacon/rib-ingester/internal/attrset"
+	"github.com/route-beacon/rib-ingester/internal/bgp"
 	"github.com/route-beacon/rib-ingester/internal/metrics"
 	"go.uber.org/zap"
 )
 
 type Writer struct {
-	pool   *pgxpool.Pool
-	logger *zap.Logger
+	pool     *pgxpool.Pool
+	logger   *zap.Logger
+	attrSets *attrset.Store
 }
 
 func NewWriter(pool *pgxpool.Pool, logger *zap.Logger) *Writer {
-	return &Writer{pool: pool, logger: logger}
+	return &Writer{pool: pool, logger: logger, attrSets: attrset.NewStore(pool, "state", attrset.DefaultCacheSize)}
 }
 
-// FlushBatch writes a batch of parsed routes to current_routes within a transaction.
+// FlushBatch writes a batch of parsed routes to current_routes within a
+// transaction. Unicast routes are written in bulk (see bulkTable) and
+// rib_sync_status is updated once per (router, table, AFI, SAFI).
 func (w *Writer) FlushBatch(ctx context.Context, routes []*ParsedRoute) error {
 	if len(routes) == 0 {
 		return nil
 	}
 
 	start := time.Now()
+	renderPathAttrs(routes)
+
+	side, bulk, err := w.prepareRoutes(ctx, currentRoutesBulk, routes)
+	if err != nil {
+		return err
+	}
 
 	tx, err := w.pool.Begin(ctx)
 	if err != nil {
@@ -36,26 +48,13 @@ func (w *Writer) FlushBatch(ctx context.Context, routes []*ParsedRoute) error {
 	}
 	defer tx.Rollback(ctx)
 
-	var upserted, deleted int64
-
-	for _, r := range routes {
-		switch r.Action {
-		case "A":
-			n, err := w.upsertRoute(ctx, tx, r)
-			if err != nil {
-				return fmt.Errorf("upsert route: %w", err)
-			}
-			upserted += n
-		case "D":
-			n, err := w.deleteRoute(ctx, tx, r)
-			if err != nil {
-				return fmt.Errorf("delete route: %w", err)
-			}
-			deleted += n
-		}
+	upserted, deleted, err := w.writeRoutes(ctx, tx, ribLocRIB, side, bulk)
+	if err != nil {
+		return err
+	}
 
-		// Update sync status for each route.
-		if err := w.upsertSyncStatus(ctx, tx, r.RouterID, r.TableName, r.AFI); err != nil {
+	for _, s := range syncStatuses(routes) {
+		if err := w.upsertSyncStatus(ctx, tx, s.routerID, s.tableName, s.afi, s.safi, s.eventTime); err != nil {
 			return fmt.Errorf("upsert sync status: %w", err)
 		}
 	}
@@ -73,6 +72,107 @@ func (w *Writer) FlushBatch(ctx context.Context, routes []*ParsedRoute) error {
 	return nil
 }
 
+// renderPathAttrs renders the path attributes of the routes decoded from
+// BMP UPDATEs into their attribute fields. The routes of an UPDATE share
+// their attributes, which are rendered once.
+func renderPathAttrs(routes []*ParsedRoute) {
+	var (
+		last      *bgp.UpdateAttrs
+		text      *bgp.PathAttributes
+		attrs     map[string]any
+		originASN *int
+	)
+	for _, r := range routes {
+		if r.PathAttrs == nil {
+			continue
+		}
+		if r.PathAttrs != last {
+			last, text = r.PathAttrs, r.PathAttrs.Render()
+			attrs = nil
+			if len(text.Attrs) > 0 {
+				attrs = make(map[string]any, len(text.Attrs))
+				for k, v := range text.Attrs {
+					attrs[k] = v
+				}
+			}
+			originASN = bgp.OriginASN(text.ASPathSegments)
+		}
+		r.ASPath = text.ASPath
+		r.ASPathSegments = text.ASPathSegments
+		r.Origin = text.Origin
+		r.LocalPref = text.LocalPref
+		r.MED = text.MED
+		r.OriginASN = originASN
+		r.CommStd = text.CommStd
+		r.CommExt = text.CommExt
+		r.CommLarge = text.CommLarge
+		r.Attrs = attrs
+		r.OriginatorID = text.OriginatorID
+		r.ClusterList = text.ClusterList
+		r.AtomicAggregate = text.AtomicAggregate
+		r.AggregatorASN = text.AggregatorASN
+		r.AggregatorAddress = text.AggregatorAddress
+		r.OTC = text.OTC
+		switch {
+		case r.EVPN != nil:
+			r.PrefixSID = text.PrefixSID.WithLabel(r.EVPN.Labels)
+		case r.Prefix.IsValid():
+			r.PrefixSID = text.PrefixSID.WithLabel(r.Labels)
+		}
+		r.PathAttrs = nil
+	}
+}
+
+// prepareRoutes splits off the side routes of a batch and stages the rest
+// for t, inserting the attribute sets they reference. It runs before the
+// batch's transaction, so that one does not wait on path_attributes.
+func (w *Writer) prepareRoutes(ctx context.Context, t *bulkTable, routes []*ParsedRoute) ([]*ParsedRoute, *bulkBatch, error) {
+	var side []*ParsedRoute
+	rest := make([]*ParsedRoute, 0, len(routes))
+	for _, r := range routes {
+		if isSideRoute(r) {
+			side = append(side, r)
+		} else {
+			rest = append(rest, r)
+		}
+	}
+	bulk, err := t.prepare(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := w.attrSets.Ensure(ctx, &bulk.sets); err != nil {
+		return nil, nil, err
+	}
+	return side, bulk, nil
+}
+
+// writeRoutes writes the side routes of a batch one by one, in order, and
+// then the bulk batch.
+func (w *Writer) writeRoutes(ctx context.Context, tx pgx.Tx, rib string, side []*ParsedRoute, bulk *bulkBatch) (upserted, deleted int64, err error) {
+	for _, r := range side {
+		switch r.Action {
+		case "A":
+			n, err := w.upsertSideRoute(ctx, tx, r, rib)
+			if err != nil {
+				return 0, 0, fmt.Errorf("upsert %s route: %w", rib, err)
+			}
+			upserted += n
+		case "D":
+			n, err := w.deleteSideRoute(ctx, tx, r, rib)
+			if err != nil {
+				return 0, 0, fmt.Errorf("delete %s route: %w", rib, err)
+			}
+			deleted += n
+		}
+	}
+
+	u, d, err := bulk.write(ctx, tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return upserted + u, deleted + d, nil
+}
+
 // UpsertRouter inserts or updates router metadata from BMP Peer Up messages
 // and operator-provided config (display_name, location).
 func (w *Writer) UpsertRouter(ctx context.Context, routerID, routerIP, hostname, description, displayName, location string) error {
@@ -92,69 +192,58 @@ func (w *Writer) UpsertRouter(ctx context.Context, routerID, routerIP, hostname,
 	return err
 }
 
-func (w *Writer) upsertRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute) (int64, error) {
-	var attrsJSON []byte
-	if r.Attrs != nil {
-		var err error
-		attrsJSON, err = json.Marshal(r.Attrs)
-		if err != nil {
-			return 0, fmt.Errorf("marshal attrs: %w", err)
-		}
-	}
-
-	tag, err := tx.Exec(ctx, `
-		INSERT INTO current_routes (router_id, table_name, afi, prefix, path_id,
-			nexthop, as_path, origin, localpref, med, origin_asn,
-			communities_std, communities_ext, communities_large, attrs, first_seen, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, now(), now())
-		ON CONFLICT (router_id, table_name, afi, prefix, path_id)
-		DO UPDATE SET
-			nexthop = EXCLUDED.nexthop,
-			as_path = EXCLUDED.as_path,
-			origin = EXCLUDED.origin,
-			localpref = EXCLUDED.localpref,
-			med = EXCLUDED.med,
-			origin_asn = EXCLUDED.origin_asn,
-			communities_std = EXCLUDED.communities_std,
-			communities_ext = EXCLUDED.communities_ext,
-			communities_large = EXCLUDED.communities_large,
-			attrs = EXCLUDED.attrs,
-			updated_at = now()`,
-		r.RouterID, r.TableName, r.AFI, r.Prefix, r.PathID,
-		nullableString(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
-		r.LocalPref, r.MED, r.OriginASN,
-		r.CommStd, r.CommExt, r.CommLarge, attrsJSON,
-	)
-	if err != nil {
-		return 0, err
+// upsertSideRoute writes an announcement to its side table.
+func (w *Writer) upsertSideRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	switch {
+	case r.EVPN != nil:
+		return w.upsertEVPNRoute(ctx, tx, r, rib)
+	case r.FlowSpec != nil:
+		return w.upsertFlowSpecRule(ctx, tx, r, rib)
+	case r.LinkState != nil:
+		return w.upsertLSRoute(ctx, tx, r, rib)
+	case r.SRPolicy != nil:
+		return w.upsertSRPolicy(ctx, tx, r, rib)
+	default:
+		return w.upsertVPNRoute(ctx, tx, r, rib)
 	}
-	return tag.RowsAffected(), nil
 }
 
-func (w *Writer) deleteRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute) (int64, error) {
-	tag, err := tx.Exec(ctx,
-		`DELETE FROM current_routes WHERE router_id = $1 AND table_name = $2 AND afi = $3 AND prefix = $4 AND path_id = $5`,
-		r.RouterID, r.TableName, r.AFI, r.Prefix, r.PathID,
-	)
-	if err != nil {
-		return 0, err
+// deleteSideRoute removes a withdrawn route from its side table.
+func (w *Writer) deleteSideRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute, rib string) (int64, error) {
+	switch {
+	case r.EVPN != nil:
+		return w.deleteEVPNRoute(ctx, tx, r, rib)
+	case r.FlowSpec != nil:
+		return w.deleteFlowSpecRule(ctx, tx, r, rib)
+	case r.LinkState != nil:
+		return w.deleteLSRoute(ctx, tx, r, rib)
+	case r.SRPolicy != nil:
+		return w.deleteSRPolicy(ctx, tx, r, rib)
+	default:
+		return w.deleteVPNRoute(ctx, tx, r, rib)
 	}
-	return tag.RowsAffected(), nil
 }
 
-func (w *Writer) upsertSyncStatus(ctx context.Context, tx pgx.Tx, routerID, tableName string, afi int) error {
+// upsertSyncStatus records a batch's routes in rib_sync_status.
+// eventTime is the router time of the latest route, see ParsedRoute; the
+// ingester's clock is used when it is zero, and a router clock ahead of it
+// is capped to it. last_parsed_msg_time never moves backwards on replays.
+// session_start_time stays on the ingester's clock: the End-of-RIB purge
+// compares it with updated_at.
+func (w *Writer) upsertSyncStatus(ctx context.Context, tx pgx.Tx, routerID, tableName string, afi int, safi uint8, eventTime time.Time) error {
 	_, err := tx.Exec(ctx, `
-		INSERT INTO rib_sync_status (router_id, table_name, afi, last_parsed_msg_time, session_start_time, eor_seen, updated_at)
-		VALUES ($1, $2, $3, now(), now(), false, now())
-		ON CONFLICT (router_id, table_name, afi)
-		DO UPDATE SET last_parsed_msg_time = now(), updated_at = now()`,
-		routerID, tableName, afi,
+		INSERT INTO rib_sync_status (router_id, table_name, afi, safi, last_parsed_msg_time, session_start_time, eor_seen, updated_at)
+		VALUES ($1, $2, $3, $4, LEAST(COALESCE($5, now()), now()), now(), false, now())
+		ON CONFLICT (router_id, table_name, afi, safi)
+		DO UPDATE SET last_parsed_msg_time = GREATEST(rib_sync_status.last_parsed_msg_time, EXCLUDED.last_parsed_msg_time),
+			updated_at = now()`,
+		routerID, tableName, afi, safi, nullableTime(eventTime),
 	)
 	return err
 }
 
 // HandleEOR updates sync status and purges stale routes after End-of-RIB.
-func (w *Writer) HandleEOR(ctx context.Context, routerID, tableName string, afi int) error {
+func (w *Writer) HandleEOR(ctx context.Context, routerID, tableName string, afi int, safi uint8) error {
 	start := time.Now()
 
 	tx, err := w.pool.Begin(ctx)
@@ -166,27 +255,28 @@ func (w *Writer) HandleEOR(ctx context.Context, routerID, tableName string, afi
 	// Update EOR status.
 	_, err = tx.Exec(ctx, `
 		UPDATE rib_sync_status SET eor_seen = true, eor_time = now(), updated_at = now()
-		WHERE router_id = $1 AND table_name = $2 AND afi = $3`,
-		routerID, tableName, afi,
+		WHERE router_id = $1 AND table_name = $2 AND afi = $3 AND safi = $4`,
+		routerID, tableName, afi, safi,
 	)
 	if err != nil {
 		return fmt.Errorf("update eor status: %w", err)
 	}
 
-	// Get session_start_time for stale route purge.
+	// Get session_start_time for stale route purge. A family with neither
+	// routes nor a Peer Up row has nothing to purge.
 	var sessionStart *time.Time
 	err = tx.QueryRow(ctx,
-		`SELECT session_start_time FROM rib_sync_status WHERE router_id = $1 AND table_name = $2 AND afi = $3`,
-		routerID, tableName, afi,
+		`SELECT session_start_time FROM rib_sync_status WHERE router_id = $1 AND table_name = $2 AND afi = $3 AND safi = $4`,
+		routerID, tableName, afi, safi,
 	).Scan(&sessionStart)
-	if err != nil {
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		return fmt.Errorf("get session_start_time: %w", err)
 	}
 
 	if sessionStart != nil {
 		tag, err := tx.Exec(ctx,
-			`DELETE FROM current_routes WHERE router_id = $1 AND table_name = $2 AND afi = $3 AND updated_at < $4`,
-			routerID, tableName, afi, *sessionStart,
+			`DELETE FROM current_routes WHERE router_id = $1 AND table_name = $2 AND afi = $3 AND safi = $4 AND updated_at < $5`,
+			routerID, tableName, afi, safi, *sessionStart,
 		)
 		if err != nil {
 			return fmt.Errorf("purge stale routes: %w", err)
@@ -198,9 +288,15 @@ func (w *Writer) HandleEOR(ctx context.Context, routerID, tableName string, afi
 				zap.String("router_id", routerID),
 				zap.String("table_name", tableName),
 				zap.Int("afi", afi),
+				zap.Uint8("safi", safi),
 				zap.Int64("purged", purged),
 			)
 		}
+		for _, table := range eorSideTables(safi, "") {
+			if err := w.purgeStaleSideRoutes(ctx, tx, table, ribLocRIB, routerID, "", "", tableName, afi, safi, *sessionStart); err != nil {
+				return err
+			}
+		}
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -209,7 +305,7 @@ func (w *Writer) HandleEOR(ctx context.Context, routerID, tableName string, afi
 
 	dur := time.Since(start).Seconds()
 	metrics.DBWriteDuration.WithLabelValues("state", "eor").Observe(dur)
-	metrics.EORSeen.WithLabelValues(routerID, tableName, fmt.Sprintf("%d", afi)).Set(1)
+	metrics.EORSeen.WithLabelValues(routerID, tableName, fmt.Sprintf("%d", afi), fmt.Sprintf("%d", safi)).Set(1)
 
 	return nil
 }
@@ -235,6 +331,12 @@ func (w *Writer) HandleSessionTermination(ctx context.Context, routerID, tableNa
 		}
 		purged = tag.RowsAffected()
 
+		side, err := purgeSideTables(ctx, tx, `router_id = $1 AND rib = $2 AND table_name = $3`, routerID, ribLocRIB, tableName)
+		if err != nil {
+			return fmt.Errorf("purge routes for router %s table %s: %w", routerID, tableName, err)
+		}
+		purged += side
+
 		_, err = tx.Exec(ctx, `DELETE FROM rib_sync_status WHERE router_id = $1 AND table_name = $2`, routerID, tableName)
 		if err != nil {
 			return fmt.Errorf("delete sync status for router %s table %s: %w", routerID, tableName, err)
@@ -247,6 +349,12 @@ func (w *Writer) HandleSessionTermination(ctx context.Context, routerID, tableNa
 		}
 		purged = tag.RowsAffected()
 
+		side, err := purgeSideTables(ctx, tx, `router_id = $1 AND rib = $2`, routerID, ribLocRIB)
+		if err != nil {
+			return fmt.Errorf("purge routes for router %s: %w", routerID, err)
+		}
+		purged += side
+
 		_, err = tx.Exec(ctx, `DELETE FROM rib_sync_status WHERE router_id = $1`, routerID)
 		if err != nil {
 			return fmt.Errorf("delete sync status for router %s: %w", routerID, err)
@@ -272,25 +380,46 @@ func (w *Writer) HandleSessionTermination(ctx context.Context, routerID, tableNa
 	return nil
 }
 
-// UpdateSessionStart sets the session_start_time for a new BMP session.
-func (w *Writer) UpdateSessionStart(ctx context.Context, routerID, tableName string, afi int) error {
+// sessionAFIs and sessionSAFIs are the families whose sync status rows a
+// Peer Up creates: IPv4 and IPv6 unicast, EVPN and BGP-LS. Rows of other
+// families are created by their routes or End-of-RIB; a Peer Up resets
+// them as well.
+var (
+	sessionAFIs  = []int16{4, 6, int16(bgp.AFIL2VPN), int16(bgp.AFIBGPLS)}
+	sessionSAFIs = []int16{int16(bgp.SAFIUnicast), int16(bgp.SAFIUnicast), int16(bgp.SAFIEVPN), int16(bgp.SAFIBGPLS)}
+)
+
+// UpdateSessionStart sets the session_start_time for a new BMP session, for
+// every family of the router's table.
+func (w *Writer) UpdateSessionStart(ctx context.Context, routerID, tableName string) error {
 	_, err := w.pool.Exec(ctx, `
-		INSERT INTO rib_sync_status (router_id, table_name, afi, session_start_time, eor_seen, updated_at)
-		VALUES ($1, $2, $3, now(), false, now())
-		ON CONFLICT (router_id, table_name, afi)
-		DO UPDATE SET session_start_time = now(), eor_seen = false, eor_time = NULL, updated_at = now()`,
-		routerID, tableName, afi,
+		WITH reset AS (
+			UPDATE rib_sync_status SET session_start_time = now(), eor_seen = false, eor_time = NULL, updated_at = now()
+			WHERE router_id = $1 AND table_name = $2
+		)
+		INSERT INTO rib_sync_status (router_id, table_name, afi, safi, session_start_time, eor_seen, updated_at)
+		SELECT $1::text, $2::text, f.afi, f.safi, now(), false, now()
+		FROM unnest($3::smallint[], $4::smallint[]) AS f(afi, safi)
+		ON CONFLICT (router_id, table_name, afi, safi) DO NOTHING`,
+		routerID, tableName, sessionAFIs, sessionSAFIs,
 	)
 	return err
 }
 
-// FlushAdjRibInBatch writes a batch of Adj-RIB-In routes to adj_rib_in within a transaction.
+// FlushAdjRibInBatch writes a batch of Adj-RIB-In routes to adj_rib_in
+// within a transaction. Unicast routes are written in bulk (see bulkTable).
 func (w *Writer) FlushAdjRibInBatch(ctx context.Context, routes []*ParsedRoute) error {
 	if len(routes) == 0 {
 		return nil
 	}
 
 	start := time.Now()
+	renderPathAttrs(routes)
+
+	side, bulk, err := w.prepareRoutes(ctx, adjRibInBulk, routes)
+	if err != nil {
+		return err
+	}
 
 	tx, err := w.pool.Begin(ctx)
 	if err != nil {
@@ -298,23 +427,9 @@ func (w *Writer) FlushAdjRibInBatch(ctx context.Context, routes []*ParsedRoute)
 	}
 	defer tx.Rollback(ctx)
 
-	var upserted, deleted int64
-
-	for _, r := range routes {
-		switch r.Action {
-		case "A":
-			n, err := w.upsertAdjRibInRoute(ctx, tx, r)
-			if err != nil {
-				return fmt.Errorf("upsert adj_rib_in route: %w", err)
-			}
-			upserted += n
-		case "D":
-			n, err := w.deleteAdjRibInRoute(ctx, tx, r)
-			if err != nil {
-				return fmt.Errorf("delete adj_rib_in route: %w", err)
-			}
-			deleted += n
-		}
+	upserted, deleted, err := w.writeRoutes(ctx, tx, ribAdjRibIn, side, bulk)
+	if err != nil {
+		return err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
@@ -330,61 +445,6 @@ func (w *Writer) FlushAdjRibInBatch(ctx context.Context, routes []*ParsedRoute)
 	return nil
 }
 
-func (w *Writer) upsertAdjRibInRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute) (int64, error) {
-	var attrsJSON []byte
-	if r.Attrs != nil {
-		var err error
-		attrsJSON, err = json.Marshal(r.Attrs)
-		if err != nil {
-			return 0, fmt.Errorf("marshal attrs: %w", err)
-		}
-	}
-
-	tag, err := tx.Exec(ctx, `
-		INSERT INTO adj_rib_in (router_id, peer_address, peer_asn, peer_bgp_id, is_post_policy,
-			table_name, afi, prefix, path_id,
-			nexthop, as_path, origin, localpref, med, origin_asn,
-			communities_std, communities_ext, communities_large, attrs,
-			first_seen, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, now(), now())
-		ON CONFLICT (router_id, peer_address, is_post_policy, table_name, afi, prefix, path_id)
-		DO UPDATE SET
-			peer_asn = EXCLUDED.peer_asn,
-			peer_bgp_id = EXCLUDED.peer_bgp_id,
-			nexthop = EXCLUDED.nexthop,
-			as_path = EXCLUDED.as_path,
-			origin = EXCLUDED.origin,
-			localpref = EXCLUDED.localpref,
-			med = EXCLUDED.med,
-			origin_asn = EXCLUDED.origin_asn,
-			communities_std = EXCLUDED.communities_std,
-			communities_ext = EXCLUDED.communities_ext,
-			communities_large = EXCLUDED.communities_large,
-			attrs = EXCLUDED.attrs,
-			updated_at = now()`,
-		r.RouterID, r.PeerAddress, r.PeerAS, r.PeerBGPID, r.IsPostPolicy,
-		r.TableName, r.AFI, r.Prefix, r.PathID,
-		nullableString(r.Nexthop), nullableString(r.ASPath), nullableString(r.Origin),
-		r.LocalPref, r.MED, r.OriginASN,
-		r.CommStd, r.CommExt, r.CommLarge, attrsJSON,
-	)
-	if err != nil {
-		return 0, err
-	}
-	return tag.RowsAffected(), nil
-}
-
-func (w *Writer) deleteAdjRibInRoute(ctx context.Context, tx pgx.Tx, r *ParsedRoute) (int64, error) {
-	tag, err := tx.Exec(ctx,
-		`DELETE FROM adj_rib_in WHERE router_id = $1 AND peer_address = $2 AND is_post_policy = $3 AND table_name = $4 AND afi = $5 AND prefix = $6 AND path_id = $7`,
-		r.RouterID, r.PeerAddress, r.IsPostPolicy, r.TableName, r.AFI, r.Prefix, r.PathID,
-	)
-	if err != nil {
-		return 0, err
-	}
-	return tag.RowsAffected(), nil
-}
-
 // HandleAdjRibInPeerDown removes all adj_rib_in routes and sync status for a specific peer
 // within a single transaction (R3-M2: atomicity fix).
 func (w *Writer) HandleAdjRibInPeerDown(ctx context.Context, routerID, peerAddress string) error {
@@ -404,8 +464,14 @@ func (w *Writer) HandleAdjRibInPeerDown(ctx context.Context, routerID, peerAddre
 		return fmt.Errorf("adj_rib_in peer down: %w", err)
 	}
 
+	side, err := purgeSideTables(ctx, tx, `router_id = $1 AND rib = $2 AND peer_address = $3 AND peer_rd = ''`,
+		routerID, ribAdjRibIn, peerAddress)
+	if err != nil {
+		return fmt.Errorf("adj_rib_in peer down: %w", err)
+	}
+
 	_, err = tx.Exec(ctx,
-		`DELETE FROM adj_rib_in_sync_status WHERE router_id = $1 AND peer_address = $2`,
+		`DELETE FROM adj_rib_in_sync_status WHERE router_id = $1 AND peer_address = $2 AND peer_rd = ''`,
 		routerID, peerAddress,
 	)
 	if err != nil {
@@ -418,7 +484,7 @@ func (w *Writer) HandleAdjRibInPeerDown(ctx context.Context, routerID, peerAddre
 
 	dur := time.Since(start).Seconds()
 	metrics.DBWriteDuration.WithLabelValues("state", "adj_peer_down").Observe(dur)
-	purged := tag.RowsAffected()
+	purged := tag.RowsAffected() + side
 	if purged > 0 {
 		metrics.RoutesPurgedTotal.WithLabelValues("adj_peer_down").Add(float64(purged))
 	}
@@ -452,6 +518,11 @@ func (w *Writer) HandleAdjRibInSessionTermination(ctx context.Context, routerID
 		return fmt.Errorf("adj_rib_in session termination: %w", err)
 	}
 
+	side, err := purgeSideTables(ctx, tx, `router_id = $1 AND rib = $2`, routerID, ribAdjRibIn)
+	if err != nil {
+		return fmt.Errorf("adj_rib_in session termination: %w", err)
+	}
+
 	_, err = tx.Exec(ctx,
 		`DELETE FROM adj_rib_in_sync_status WHERE router_id = $1`,
 		routerID,
@@ -466,7 +537,7 @@ func (w *Writer) HandleAdjRibInSessionTermination(ctx context.Context, routerID
 
 	dur := time.Since(start).Seconds()
 	metrics.DBWriteDuration.WithLabelValues("state", "adj_session_termination").Observe(dur)
-	purged := tag.RowsAffected()
+	purged := tag.RowsAffected() + side
 	if purged > 0 {
 		metrics.RoutesPurgedTotal.WithLabelValues("adj_session_down").Add(float64(purged))
 	}
@@ -479,22 +550,29 @@ func (w *Writer) HandleAdjRibInSessionTermination(ctx context.Context, routerID
 	return nil
 }
 
-// UpdateAdjRibInSessionStart records session start for stale route tracking.
-// Called on non-Loc-RIB Peer Up.
-func (w *Writer) UpdateAdjRibInSessionStart(ctx context.Context, routerID, peerAddress string, afi int) error {
+// UpdateAdjRibInSessionStart records session start for stale route
+// tracking, for every family of the peer. Called on non-Loc-RIB Peer Up.
+func (w *Writer) UpdateAdjRibInSessionStart(ctx context.Context, routerID, peerAddress, peerRD string) error {
 	_, err := w.pool.Exec(ctx, `
-		INSERT INTO adj_rib_in_sync_status (router_id, peer_address, afi, session_start_time, eor_seen, updated_at)
-		VALUES ($1, $2, $3, now(), false, now())
-		ON CONFLICT (router_id, peer_address, afi)
-		DO UPDATE SET session_start_time = now(), eor_seen = false, eor_time = NULL, updated_at = now()`,
-		routerID, peerAddress, afi,
+		WITH reset AS (
+			UPDATE adj_rib_in_sync_status SET session_start_time = now(), eor_seen = false, eor_time = NULL, updated_at = now()
+			WHERE router_id = $1 AND peer_address = $2 AND peer_rd = $3
+		)
+		INSERT INTO adj_rib_in_sync_status (router_id, peer_address, peer_rd, afi, safi, session_start_time, eor_seen, updated_at)
+		SELECT $1::text, $2::inet, $3::text, f.afi, f.safi, now(), false, now()
+		FROM unnest($4::smallint[], $5::smallint[]) AS f(afi, safi)
+		ON CONFLICT (router_id, peer_address, peer_rd, afi, safi) DO NOTHING`,
+		routerID, peerAddress, peerRD, sessionAFIs, sessionSAFIs,
 	)
 	return err
 }
 
 // HandleAdjRibInEOR updates sync status and purges stale adj_rib_in routes
-// after End-of-RIB for a specific (router, peer, table, afi) scope.
-func (w *Writer) HandleAdjRibInEOR(ctx context.Context, routerID, peerAddress, tableName string, afi int) error {
+// after End-of-RIB for a specific (router, peer, table, afi) scope. peerRD is
+// the Peer Distinguisher of an RD instance peer, whose routes live in
+// vpn_routes; EVPN routes live in evpn_routes, FlowSpec rules in
+// flowspec_rules and BGP-LS NLRI in ls_nodes, ls_links and ls_prefixes.
+func (w *Writer) HandleAdjRibInEOR(ctx context.Context, routerID, peerAddress, peerRD, tableName string, afi int, safi uint8) error {
 	start := time.Now()
 
 	tx, err := w.pool.Begin(ctx)
@@ -506,8 +584,8 @@ func (w *Writer) HandleAdjRibInEOR(ctx context.Context, routerID, peerAddress, t
 	// Update EOR status.
 	_, err = tx.Exec(ctx, `
 		UPDATE adj_rib_in_sync_status SET eor_seen = true, eor_time = now(), updated_at = now()
-		WHERE router_id = $1 AND peer_address = $2 AND afi = $3`,
-		routerID, peerAddress, afi,
+		WHERE router_id = $1 AND peer_address = $2 AND peer_rd = $3 AND afi = $4 AND safi = $5`,
+		routerID, peerAddress, peerRD, afi, safi,
 	)
 	if err != nil {
 		return fmt.Errorf("update adj eor status: %w", err)
@@ -518,8 +596,8 @@ func (w *Writer) HandleAdjRibInEOR(ctx context.Context, routerID, peerAddress, t
 	// stale purge gracefully instead of hard-failing (R3-H7 fix).
 	var sessionStart *time.Time
 	err = tx.QueryRow(ctx,
-		`SELECT session_start_time FROM adj_rib_in_sync_status WHERE router_id = $1 AND peer_address = $2 AND afi = $3`,
-		routerID, peerAddress, afi,
+		`SELECT session_start_time FROM adj_rib_in_sync_status WHERE router_id = $1 AND peer_address = $2 AND peer_rd = $3 AND afi = $4 AND safi = $5`,
+		routerID, peerAddress, peerRD, afi, safi,
 	).Scan(&sessionStart)
 	if errors.Is(err, pgx.ErrNoRows) {
 		// No sync-status row — can't determine stale cutoff, skip purge.
@@ -527,6 +605,7 @@ func (w *Writer) HandleAdjRibInEOR(ctx context.Context, routerID, peerAddress, t
 			zap.String("router_id", routerID),
 			zap.String("peer_address", peerAddress),
 			zap.Int("afi", afi),
+			zap.Uint8("safi", safi),
 		)
 		if err := tx.Commit(ctx); err != nil {
 			return fmt.Errorf("commit adj eor tx: %w", err)
@@ -540,23 +619,32 @@ func (w *Writer) HandleAdjRibInEOR(ctx context.Context, routerID, peerAddress, t
 	}
 
 	if sessionStart != nil {
-		tag, err := tx.Exec(ctx,
-			`DELETE FROM adj_rib_in WHERE router_id = $1 AND peer_address = $2 AND table_name = $3 AND afi = $4 AND updated_at < $5`,
-			routerID, peerAddress, tableName, afi, *sessionStart,
-		)
-		if err != nil {
-			return fmt.Errorf("purge stale adj routes: %w", err)
-		}
-		purged := tag.RowsAffected()
-		if purged > 0 {
-			metrics.RoutesPurgedTotal.WithLabelValues("adj_eor_stale").Add(float64(purged))
-			w.logger.Info("purged stale adj_rib_in routes after EOR",
-				zap.String("router_id", routerID),
-				zap.String("peer_address", peerAddress),
-				zap.String("table_name", tableName),
-				zap.Int("afi", afi),
-				zap.Int64("purged", purged),
+		// An RD instance peer has no routes in adj_rib_in.
+		if peerRD == "" {
+			tag, err := tx.Exec(ctx,
+				`DELETE FROM adj_rib_in WHERE router_id = $1 AND peer_address = $2 AND table_name = $3 AND afi = $4 AND safi = $5 AND updated_at < $6`,
+				routerID, peerAddress, tableName, afi, safi, *sessionStart,
 			)
+			if err != nil {
+				return fmt.Errorf("purge stale adj routes: %w", err)
+			}
+			purged := tag.RowsAffected()
+			if purged > 0 {
+				metrics.RoutesPurgedTotal.WithLabelValues("adj_eor_stale").Add(float64(purged))
+				w.logger.Info("purged stale adj_rib_in routes after EOR",
+					zap.String("router_id", routerID),
+					zap.String("peer_address", peerAddress),
+					zap.String("table_name", tableName),
+					zap.Int("afi", afi),
+					zap.Uint8("safi", safi),
+					zap.Int64("purged", purged),
+				)
+			}
+		}
+		for _, table := range eorSideTables(safi, peerRD) {
+			if err := w.purgeStaleSideRoutes(ctx, tx, table, ribAdjRibIn, routerID, peerAddress, peerRD, tableName, afi, safi, *sessionStart); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -570,9 +658,36 @@ func (w *Writer) HandleAdjRibInEOR(ctx context.Context, routerID, peerAddress, t
 	return nil
 }
 
+// parseWarningsJSON marshals the RFC 7606 errors of a route's UPDATE for the
+// parse_warnings column, or returns nil for a well-formed UPDATE.
+func parseWarningsJSON(w []bgp.ParseWarning) ([]byte, error) {
+	if len(w) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(w)
+	if err != nil {
+		return nil, fmt.Errorf("marshal parse warnings: %w", err)
+	}
+	return b, nil
+}
+
 func nullableString(s string) any {
 	if s == "" {
 		return nil
 	}
 	return s
 }
+
+func nullableAddr(a netip.Addr) any {
+	if !a.IsValid() {
+		return nil
+	}
+	return a.String()
+}
+
+func nullableTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,28 @@
+-- =============================================================================
+-- Migration 0006: BMP Statistics Report time series
+-- =============================================================================
+
+-- One row per stat TLV per Statistics Report (RFC 7854 §4.8, RFC 8671 §5).
+-- peer_address/peer_asn/peer_bgp_id are NULL for Loc-RIB (peer type 3) reports.
+-- afi/safi are only set for the per-AFI/SAFI gauge types (9, 10, 16, 17).
+CREATE TABLE IF NOT EXISTS bmp_stats (
+    router_id     TEXT        NOT NULL,
+    peer_address  INET,
+    peer_asn      BIGINT,
+    peer_bgp_id   TEXT,
+    is_loc_rib    BOOLEAN     NOT NULL DEFAULT false,
+    stat_type     INTEGER     NOT NULL,
+    stat_name     TEXT        NOT NULL,
+    afi           INTEGER,
+    safi          SMALLINT,
+    value         NUMERIC(20) NOT NULL,
+    collected_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Per-peer time series: "rejected prefixes from 192.0.2.1 over the last day"
+CREATE INDEX IF NOT EXISTS idx_bmp_stats_router_peer_time
+    ON bmp_stats (router_id, peer_address, stat_type, collected_at DESC);
+
+-- Retention pruning by the maintenance job.
+CREATE INDEX IF NOT EXISTS idx_bmp_stats_collected_at
+    ON bmp_stats (collected_at);
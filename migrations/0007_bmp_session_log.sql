@@ -0,0 +1,19 @@
+-- =============================================================================
+-- Migration 0007: BMP session lifecycle log
+-- =============================================================================
+
+-- One row per BMP Termination message (RFC 7854 §4.5). router_ip is the BMP
+-- speaker address from the OpenBMP header; router_id is the Loc-RIB router ID
+-- previously seen from that speaker, or router_ip if none has been seen yet.
+CREATE TABLE IF NOT EXISTS bmp_session_log (
+    router_id    TEXT        NOT NULL,
+    router_ip    INET,
+    event        TEXT        NOT NULL,
+    reason_code  INTEGER,
+    reason       TEXT,
+    info         TEXT,
+    logged_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_bmp_session_log_router_time
+    ON bmp_session_log (router_id, logged_at DESC);
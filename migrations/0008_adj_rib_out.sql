@@ -0,0 +1,73 @@
+-- =============================================================================
+-- Migration 0008: Adj-RIB-Out route storage (RFC 8671)
+-- =============================================================================
+
+-- ---------------------------------------------------------------------------
+-- 1. New table: adj_rib_out
+-- ---------------------------------------------------------------------------
+-- Routes a router advertises to each neighbor, from Route Monitoring messages
+-- with the O-flag set. Same shape as adj_rib_in; is_post_policy is the L-flag.
+CREATE TABLE IF NOT EXISTS adj_rib_out (
+    router_id        TEXT        NOT NULL,
+    peer_address     INET        NOT NULL,
+    peer_asn         BIGINT      NOT NULL,
+    peer_bgp_id      TEXT        NOT NULL DEFAULT '',
+    is_post_policy   BOOLEAN     NOT NULL,
+    table_name       TEXT        NOT NULL,
+    afi              SMALLINT    NOT NULL CHECK (afi IN (4, 6)),
+    prefix           CIDR        NOT NULL,
+    path_id          BIGINT      NOT NULL DEFAULT 0,
+    nexthop          INET,
+    as_path          TEXT,
+    origin           TEXT,
+    localpref        INTEGER,
+    med              INTEGER,
+    origin_asn       INTEGER,
+    communities_std   TEXT[],
+    communities_ext   TEXT[],
+    communities_large TEXT[],
+    attrs            JSONB,
+    first_seen       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, peer_address, is_post_policy, table_name, afi, prefix, path_id)
+);
+
+-- ---------------------------------------------------------------------------
+-- 2. New table: adj_rib_out_sync_status
+-- ---------------------------------------------------------------------------
+CREATE TABLE IF NOT EXISTS adj_rib_out_sync_status (
+    router_id          TEXT        NOT NULL,
+    peer_address       INET        NOT NULL,
+    afi                SMALLINT    NOT NULL CHECK (afi IN (4, 6)),
+    session_start_time TIMESTAMPTZ,
+    eor_seen           BOOLEAN     NOT NULL DEFAULT false,
+    eor_time           TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, peer_address, afi)
+);
+
+-- ---------------------------------------------------------------------------
+-- 3. Indexes: adj_rib_out
+-- ---------------------------------------------------------------------------
+
+-- Prefix lookup (GiST for containment, B-tree for equality)
+CREATE INDEX IF NOT EXISTS idx_adj_rib_out_prefix_gist
+    ON adj_rib_out USING GIST (prefix inet_ops);
+CREATE INDEX IF NOT EXISTS idx_adj_rib_out_prefix_btree
+    ON adj_rib_out (prefix);
+
+-- Peer lookup + Peer Down deletion
+CREATE INDEX IF NOT EXISTS idx_adj_rib_out_router_peer
+    ON adj_rib_out (router_id, peer_address);
+
+-- Router lookup + session termination deletion
+CREATE INDEX IF NOT EXISTS idx_adj_rib_out_router_table_afi
+    ON adj_rib_out (router_id, table_name, afi);
+
+CREATE INDEX IF NOT EXISTS idx_adj_rib_out_updated_at
+    ON adj_rib_out (updated_at DESC);
+
+-- ---------------------------------------------------------------------------
+-- 4. Alter route_events: flag Adj-RIB-Out history rows
+-- ---------------------------------------------------------------------------
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS is_adj_rib_out BOOLEAN;
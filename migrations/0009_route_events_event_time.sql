@@ -0,0 +1,19 @@
+-- =============================================================================
+-- Migration 0009: Router-side event time on route_events
+-- =============================================================================
+
+-- When the route changed on the router: the BMP per-peer header timestamp
+-- (RFC 7854 §4.2), or the collector's receive timestamp when the router sent
+-- none. NULL when neither is known. ingest_time stays the partition key so
+-- retention keeps dropping data by when it was written, even for replays of
+-- old events.
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS event_time TIMESTAMPTZ;
+
+-- Event-time counterparts of the per-partition ingest_time indexes. Created
+-- on the partitioned parent so PostgreSQL builds them on every existing and
+-- future partition.
+CREATE INDEX IF NOT EXISTS idx_route_events_prefix_event_time
+    ON route_events (router_id, table_name, afi, prefix, event_time DESC);
+
+CREATE INDEX IF NOT EXISTS idx_route_events_router_event_time
+    ON route_events (router_id, table_name, afi, event_time DESC);
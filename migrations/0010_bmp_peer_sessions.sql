@@ -0,0 +1,37 @@
+-- =============================================================================
+-- Migration 0010: Negotiated BGP session capabilities
+-- =============================================================================
+
+-- One row per monitored BGP session, from the Sent and Received OPENs in a
+-- non-Loc-RIB Peer Up (RFC 7854 §4.10). "local" is the BMP-monitored router,
+-- "peer" its neighbor. Negotiated columns hold what both sides agreed on;
+-- sent_open/received_open keep every decoded capability as advertised.
+CREATE TABLE IF NOT EXISTS bmp_peer_sessions (
+    router_id              TEXT        NOT NULL,
+    peer_address           INET        NOT NULL,
+    peer_asn               BIGINT,
+    peer_bgp_id            INET,
+    local_address          INET,
+    local_port             INTEGER,
+    remote_port            INTEGER,
+    local_asn              BIGINT,
+    local_bgp_id           INET,
+    hold_time              INTEGER,
+    four_octet_as          BOOLEAN     NOT NULL,
+    extended_message       BOOLEAN     NOT NULL,
+    route_refresh          BOOLEAN     NOT NULL,
+    enhanced_route_refresh BOOLEAN     NOT NULL,
+    families               TEXT[]      NOT NULL,
+    add_path_rx            TEXT[]      NOT NULL,
+    add_path_tx            TEXT[]      NOT NULL,
+    graceful_restart_time  INTEGER,
+    local_role             TEXT,
+    peer_role              TEXT,
+    peer_hostname          TEXT,
+    peer_domain            TEXT,
+    sent_open              JSONB       NOT NULL,
+    received_open          JSONB       NOT NULL,
+    established_at         TIMESTAMPTZ,
+    updated_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, peer_address)
+);
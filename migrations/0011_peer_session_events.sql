@@ -0,0 +1,33 @@
+-- =============================================================================
+-- Migration 0011: BGP peer session event history
+-- =============================================================================
+
+-- One row per BMP Peer Up or Peer Down (RFC 7854 §4.9, §4.10). event_time is
+-- the router's per-peer header timestamp, or the collector time if the router
+-- sent none. Peer Down rows carry the reason and, depending on it, the
+-- NOTIFICATION that closed the session or the FSM event code.
+-- peer_address/peer_asn/peer_bgp_id are NULL for Loc-RIB (peer type 3) events.
+CREATE TABLE IF NOT EXISTS peer_session_events (
+    router_id                 TEXT        NOT NULL,
+    peer_address              INET,
+    peer_asn                  BIGINT,
+    peer_bgp_id               TEXT,
+    is_loc_rib                BOOLEAN     NOT NULL DEFAULT false,
+    table_name                TEXT,
+    event                     TEXT        NOT NULL CHECK (event IN ('up', 'down')),
+    event_time                TIMESTAMPTZ NOT NULL,
+    reason_code               SMALLINT,
+    reason                    TEXT,
+    notification_code         SMALLINT,
+    notification_code_name    TEXT,
+    notification_subcode      SMALLINT,
+    notification_subcode_name TEXT,
+    shutdown_message          TEXT,
+    notification_data         BYTEA,
+    fsm_event                 INTEGER,
+    logged_at                 TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Per-peer timeline: flap counts, uptime, "why did this neighbor drop".
+CREATE INDEX IF NOT EXISTS idx_peer_session_events_peer_time
+    ON peer_session_events (router_id, peer_address, event_time DESC);
@@ -0,0 +1,25 @@
+-- =============================================================================
+-- Migration 0012: BMP Route Mirroring capture
+-- =============================================================================
+
+-- One row per mirrored BGP PDU in a BMP Route Mirroring message (RFC 7854
+-- §4.7), or a single row with bgp_pdu NULL when the router only reported
+-- lost messages. bgp_pdu is zstd-compressed; bgp_msg_type is read from the
+-- PDU header before compression. event_time is the router's per-peer header
+-- timestamp, or the collector time if the router sent none.
+CREATE TABLE IF NOT EXISTS route_mirroring_events (
+    router_id      TEXT        NOT NULL,
+    peer_address   INET,
+    peer_asn       BIGINT,
+    peer_bgp_id    TEXT,
+    event_time     TIMESTAMPTZ NOT NULL,
+    errored_pdu    BOOLEAN     NOT NULL DEFAULT false,
+    messages_lost  BOOLEAN     NOT NULL DEFAULT false,
+    bgp_msg_type   SMALLINT,
+    bgp_pdu        BYTEA,
+    bgp_pdu_length INTEGER,
+    logged_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_route_mirroring_events_peer_time
+    ON route_mirroring_events (router_id, peer_address, event_time DESC);
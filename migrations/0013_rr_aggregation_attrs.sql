@@ -0,0 +1,69 @@
+-- =============================================================================
+-- Migration 0013: Route reflection and aggregation attribute columns
+-- =============================================================================
+
+-- ORIGINATOR_ID and CLUSTER_LIST (RFC 4456), ATOMIC_AGGREGATE and AGGREGATOR
+-- (RFC 4271 §5.1.6-7) were previously stored as hex in attrs. cluster_list
+-- holds cluster IDs in dotted-quad form, nearest reflector first.
+-- aggregator_asn is always 4-octet: for peers without the 4-octet AS
+-- capability, AS4_AGGREGATOR replaces AS_TRANS (RFC 6793).
+
+-- ---------------------------------------------------------------------------
+-- 1. current_routes
+-- ---------------------------------------------------------------------------
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS originator_id      INET;
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS cluster_list       TEXT[];
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS atomic_aggregate   BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS aggregator_asn     BIGINT;
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS aggregator_address INET;
+
+CREATE INDEX IF NOT EXISTS idx_current_routes_originator_id
+    ON current_routes (originator_id);
+CREATE INDEX IF NOT EXISTS idx_current_routes_cluster_list_gin
+    ON current_routes USING GIN (cluster_list);
+CREATE INDEX IF NOT EXISTS idx_current_routes_aggregates
+    ON current_routes (aggregator_asn)
+    WHERE atomic_aggregate OR aggregator_asn IS NOT NULL;
+
+-- ---------------------------------------------------------------------------
+-- 2. adj_rib_in
+-- ---------------------------------------------------------------------------
+ALTER TABLE adj_rib_in ADD COLUMN IF NOT EXISTS originator_id      INET;
+ALTER TABLE adj_rib_in ADD COLUMN IF NOT EXISTS cluster_list       TEXT[];
+ALTER TABLE adj_rib_in ADD COLUMN IF NOT EXISTS atomic_aggregate   BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE adj_rib_in ADD COLUMN IF NOT EXISTS aggregator_asn     BIGINT;
+ALTER TABLE adj_rib_in ADD COLUMN IF NOT EXISTS aggregator_address INET;
+
+CREATE INDEX IF NOT EXISTS idx_adj_rib_in_originator_id
+    ON adj_rib_in (originator_id);
+CREATE INDEX IF NOT EXISTS idx_adj_rib_in_cluster_list_gin
+    ON adj_rib_in USING GIN (cluster_list);
+CREATE INDEX IF NOT EXISTS idx_adj_rib_in_aggregates
+    ON adj_rib_in (aggregator_asn)
+    WHERE atomic_aggregate OR aggregator_asn IS NOT NULL;
+
+-- ---------------------------------------------------------------------------
+-- 3. adj_rib_out (same attribute columns as adj_rib_in)
+-- ---------------------------------------------------------------------------
+ALTER TABLE adj_rib_out ADD COLUMN IF NOT EXISTS originator_id      INET;
+ALTER TABLE adj_rib_out ADD COLUMN IF NOT EXISTS cluster_list       TEXT[];
+ALTER TABLE adj_rib_out ADD COLUMN IF NOT EXISTS atomic_aggregate   BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE adj_rib_out ADD COLUMN IF NOT EXISTS aggregator_asn     BIGINT;
+ALTER TABLE adj_rib_out ADD COLUMN IF NOT EXISTS aggregator_address INET;
+
+CREATE INDEX IF NOT EXISTS idx_adj_rib_out_originator_id
+    ON adj_rib_out (originator_id);
+
+-- ---------------------------------------------------------------------------
+-- 4. route_events
+-- ---------------------------------------------------------------------------
+-- Nullable with no default: rows written before this migration have no
+-- decoded value. Indexed on the partitioned parent so every partition gets it.
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS originator_id      INET;
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS cluster_list       TEXT[];
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS atomic_aggregate   BOOLEAN;
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS aggregator_asn     BIGINT;
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS aggregator_address INET;
+
+CREATE INDEX IF NOT EXISTS idx_route_events_originator_id
+    ON route_events (originator_id, ingest_time DESC);
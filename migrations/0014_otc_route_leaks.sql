@@ -0,0 +1,26 @@
+-- =============================================================================
+-- Migration 0014: Only-To-Customer (RFC 9234) and route-leak flagging
+-- =============================================================================
+
+-- otc is the ASN carried in the Only-To-Customer attribute (type 35), which
+-- was previously stored as hex in attrs.
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS otc BIGINT;
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS otc BIGINT;
+ALTER TABLE adj_rib_out    ADD COLUMN IF NOT EXISTS otc BIGINT;
+ALTER TABLE route_events   ADD COLUMN IF NOT EXISTS otc BIGINT;
+
+-- leak_suspected is set on Adj-RIB-In routes that violate the RFC 9234 §5
+-- ingress rules for the router's BGP Role on the session: OTC present on a
+-- route from a customer or RS-client, or OTC not matching a lateral peer's
+-- AS. Always false when the router advertised no BGP Role or its Peer Up
+-- was not seen.
+ALTER TABLE adj_rib_in   ADD COLUMN IF NOT EXISTS leak_suspected BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS leak_suspected BOOLEAN;
+
+CREATE INDEX IF NOT EXISTS idx_adj_rib_in_leak_suspected
+    ON adj_rib_in (router_id, peer_address)
+    WHERE leak_suspected;
+
+CREATE INDEX IF NOT EXISTS idx_route_events_leak_suspected
+    ON route_events (router_id, ingest_time DESC)
+    WHERE leak_suspected;
@@ -0,0 +1,48 @@
+-- =============================================================================
+-- Migration 0015: MPLS labeled unicast (SAFI 4, RFC 8277)
+-- =============================================================================
+
+-- safi is part of the route key: a router can carry the same prefix as
+-- plain unicast (SAFI 1) and labeled unicast (SAFI 4) at the same time.
+-- Existing rows are unicast. labels holds the 20-bit label values of the
+-- stack, bottom of stack last; NULL for unlabeled routes.
+
+-- ---------------------------------------------------------------------------
+-- 1. current_routes
+-- ---------------------------------------------------------------------------
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS safi   SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS labels INTEGER[];
+
+ALTER TABLE current_routes DROP CONSTRAINT IF EXISTS current_routes_pkey;
+ALTER TABLE current_routes ADD PRIMARY KEY (router_id, table_name, afi, safi, prefix, path_id);
+
+CREATE INDEX IF NOT EXISTS idx_current_routes_labels_gin
+    ON current_routes USING GIN (labels);
+
+-- ---------------------------------------------------------------------------
+-- 2. adj_rib_in
+-- ---------------------------------------------------------------------------
+ALTER TABLE adj_rib_in ADD COLUMN IF NOT EXISTS safi   SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE adj_rib_in ADD COLUMN IF NOT EXISTS labels INTEGER[];
+
+ALTER TABLE adj_rib_in DROP CONSTRAINT IF EXISTS adj_rib_in_pkey;
+ALTER TABLE adj_rib_in ADD PRIMARY KEY (router_id, peer_address, is_post_policy, table_name, afi, safi, prefix, path_id);
+
+CREATE INDEX IF NOT EXISTS idx_adj_rib_in_labels_gin
+    ON adj_rib_in USING GIN (labels);
+
+-- ---------------------------------------------------------------------------
+-- 3. adj_rib_out
+-- ---------------------------------------------------------------------------
+ALTER TABLE adj_rib_out ADD COLUMN IF NOT EXISTS safi   SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE adj_rib_out ADD COLUMN IF NOT EXISTS labels INTEGER[];
+
+ALTER TABLE adj_rib_out DROP CONSTRAINT IF EXISTS adj_rib_out_pkey;
+ALTER TABLE adj_rib_out ADD PRIMARY KEY (router_id, peer_address, is_post_policy, table_name, afi, safi, prefix, path_id);
+
+-- ---------------------------------------------------------------------------
+-- 4. route_events
+-- ---------------------------------------------------------------------------
+-- The default backfills existing partitions as unicast.
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS safi   SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS labels INTEGER[];
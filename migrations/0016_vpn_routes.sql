@@ -0,0 +1,76 @@
+-- =============================================================================
+-- Migration 0016: L3VPN routes (SAFI 128, RFC 4364) keyed by Route Distinguisher
+-- =============================================================================
+
+-- ---------------------------------------------------------------------------
+-- 1. New table: vpn_routes
+-- ---------------------------------------------------------------------------
+-- Every route that carries a Route Distinguisher: VPNv4/VPNv6 NLRI from any
+-- RIB, and all routes of RD instance peers (BMP peer type 1), whose RD is
+-- the peer's Peer Distinguisher. Such routes are not written to
+-- current_routes, adj_rib_in or adj_rib_out.
+--
+-- rib is 'loc-rib', 'adj-rib-in' or 'adj-rib-out'. Loc-RIB rows have
+-- peer_address 0.0.0.0, peer_asn 0 and is_post_policy false. peer_rd is
+-- the Peer Distinguisher of an RD instance peer, '' for global peers.
+CREATE TABLE IF NOT EXISTS vpn_routes (
+    router_id          TEXT        NOT NULL,
+    table_name         TEXT        NOT NULL,
+    rib                TEXT        NOT NULL CHECK (rib IN ('loc-rib', 'adj-rib-in', 'adj-rib-out')),
+    peer_address       INET        NOT NULL,
+    peer_rd            TEXT        NOT NULL DEFAULT '',
+    peer_asn           BIGINT      NOT NULL DEFAULT 0,
+    peer_bgp_id        TEXT        NOT NULL DEFAULT '',
+    is_post_policy     BOOLEAN     NOT NULL DEFAULT false,
+    afi                SMALLINT    NOT NULL CHECK (afi IN (4, 6)),
+    safi               SMALLINT    NOT NULL,
+    rd                 TEXT        NOT NULL,
+    prefix             CIDR        NOT NULL,
+    path_id            BIGINT      NOT NULL DEFAULT 0,
+    labels             INTEGER[],
+    nexthop            INET,
+    as_path            TEXT,
+    origin             TEXT,
+    localpref          INTEGER,
+    med                INTEGER,
+    origin_asn         INTEGER,
+    communities_std    TEXT[],
+    communities_ext    TEXT[],
+    communities_large  TEXT[],
+    attrs              JSONB,
+    originator_id      INET,
+    cluster_list       TEXT[],
+    atomic_aggregate   BOOLEAN     NOT NULL DEFAULT false,
+    aggregator_asn     BIGINT,
+    aggregator_address INET,
+    otc                BIGINT,
+    leak_suspected     BOOLEAN     NOT NULL DEFAULT false,
+    first_seen         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, afi, safi, rd, prefix, path_id)
+);
+
+-- RD-scoped longest prefix match: WHERE rd = ... AND prefix >>= ...
+CREATE INDEX IF NOT EXISTS idx_vpn_routes_rd_prefix_gist
+    ON vpn_routes USING GIST (rd, prefix inet_ops);
+
+-- Route-target-scoped lookups: WHERE communities_ext @> ARRAY['RT:...']
+CREATE INDEX IF NOT EXISTS idx_vpn_routes_comm_ext_gin
+    ON vpn_routes USING GIN (communities_ext);
+
+CREATE INDEX IF NOT EXISTS idx_vpn_routes_labels_gin
+    ON vpn_routes USING GIN (labels);
+
+-- Peer Down and session termination deletion
+CREATE INDEX IF NOT EXISTS idx_vpn_routes_router_rib_peer
+    ON vpn_routes (router_id, rib, peer_address, peer_rd);
+
+-- ---------------------------------------------------------------------------
+-- 2. route_events
+-- ---------------------------------------------------------------------------
+-- rd is the route's Route Distinguisher; NULL for routes without one.
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS rd TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_route_events_rd_prefix
+    ON route_events (rd, prefix, ingest_time DESC)
+    WHERE rd IS NOT NULL;
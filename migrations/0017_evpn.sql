@@ -0,0 +1,144 @@
+-- =============================================================================
+-- Migration 0017: EVPN routes (AFI 25 / SAFI 70, RFC 7432 and RFC 9136)
+-- =============================================================================
+
+-- ---------------------------------------------------------------------------
+-- 1. New table: evpn_routes
+-- ---------------------------------------------------------------------------
+-- EVPN routes of all RIBs, following the lifecycle of the RIB named in rib
+-- (EOR purge, Peer Down and session termination purge). The rib, peer and
+-- Loc-RIB conventions are those of vpn_routes.
+--
+-- route_key renders the fields that identify the route within its RD, e.g.
+-- '[2]:[0]:[00:11:22:33:44:55]:[10.0.0.1]' for a MAC/IP Advertisement route.
+-- Fields a route type does not carry are NULL. labels holds MPLS labels
+-- and vnis VXLAN/NVGRE/Geneve VNIs (RFC 8365), depending on the
+-- Encapsulation extended community of the UPDATE.
+CREATE TABLE IF NOT EXISTS evpn_routes (
+    router_id         TEXT        NOT NULL,
+    table_name        TEXT        NOT NULL,
+    rib               TEXT        NOT NULL CHECK (rib IN ('loc-rib', 'adj-rib-in', 'adj-rib-out')),
+    peer_address      INET        NOT NULL,
+    peer_rd           TEXT        NOT NULL DEFAULT '',
+    peer_asn          BIGINT      NOT NULL DEFAULT 0,
+    peer_bgp_id       TEXT        NOT NULL DEFAULT '',
+    is_post_policy    BOOLEAN     NOT NULL DEFAULT false,
+    route_type        SMALLINT    NOT NULL,
+    rd                TEXT        NOT NULL,
+    route_key         TEXT        NOT NULL,
+    path_id           BIGINT      NOT NULL DEFAULT 0,
+    esi               TEXT,
+    ethernet_tag      BIGINT,
+    mac               MACADDR,
+    ip_address        INET,
+    ip_prefix         CIDR,
+    gateway_ip        INET,
+    labels            INTEGER[],
+    vnis              INTEGER[],
+    nexthop           INET,
+    as_path           TEXT,
+    origin            TEXT,
+    localpref         INTEGER,
+    med               INTEGER,
+    communities_std   TEXT[],
+    communities_ext   TEXT[],
+    communities_large TEXT[],
+    attrs             JSONB,
+    originator_id     INET,
+    cluster_list      TEXT[],
+    first_seen        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, rd, route_key, path_id)
+);
+
+-- MAC and host lookups across all EVIs
+CREATE INDEX IF NOT EXISTS idx_evpn_routes_mac
+    ON evpn_routes (mac) WHERE mac IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_evpn_routes_ip_address
+    ON evpn_routes (ip_address) WHERE ip_address IS NOT NULL;
+
+-- IP Prefix routes: WHERE ip_prefix >>= ...
+CREATE INDEX IF NOT EXISTS idx_evpn_routes_ip_prefix_gist
+    ON evpn_routes USING GIST (ip_prefix inet_ops) WHERE ip_prefix IS NOT NULL;
+
+-- Multihoming: all routes of one Ethernet Segment
+CREATE INDEX IF NOT EXISTS idx_evpn_routes_esi
+    ON evpn_routes (esi) WHERE esi IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_evpn_routes_vnis_gin
+    ON evpn_routes USING GIN (vnis);
+
+-- Route-target-scoped lookups: WHERE communities_ext @> ARRAY['RT:...']
+CREATE INDEX IF NOT EXISTS idx_evpn_routes_comm_ext_gin
+    ON evpn_routes USING GIN (communities_ext);
+
+-- Peer Down and session termination deletion
+CREATE INDEX IF NOT EXISTS idx_evpn_routes_router_rib_peer
+    ON evpn_routes (router_id, rib, peer_address, peer_rd);
+
+-- ---------------------------------------------------------------------------
+-- 2. New table: evpn_events (partitioned by day, like route_events)
+-- ---------------------------------------------------------------------------
+-- Partitions are created and dropped by the partition manager. Indexes are
+-- defined here on the parent and inherited by every partition.
+CREATE TABLE IF NOT EXISTS evpn_events (
+    event_id          BYTEA       NOT NULL,
+    ingest_time       TIMESTAMPTZ NOT NULL,
+    router_id         TEXT        NOT NULL,
+    table_name        TEXT        NOT NULL,
+    route_type        SMALLINT    NOT NULL,
+    rd                TEXT        NOT NULL,
+    route_key         TEXT        NOT NULL,
+    path_id           BIGINT,
+    action            CHAR(1)     NOT NULL CHECK (action IN ('A', 'D')),
+    esi               TEXT,
+    ethernet_tag      BIGINT,
+    mac               MACADDR,
+    ip_address        INET,
+    ip_prefix         CIDR,
+    gateway_ip        INET,
+    labels            INTEGER[],
+    vnis              INTEGER[],
+    nexthop           INET,
+    as_path           TEXT,
+    origin            TEXT,
+    localpref         INTEGER,
+    med               INTEGER,
+    communities_std   TEXT[],
+    communities_ext   TEXT[],
+    communities_large TEXT[],
+    attrs             JSONB,
+    bmp_raw           BYTEA,
+    peer_address      INET,
+    peer_asn          BIGINT,
+    peer_bgp_id       TEXT,
+    is_post_policy    BOOLEAN,
+    is_adj_rib_out    BOOLEAN,
+    event_time        TIMESTAMPTZ,
+    originator_id     INET,
+    cluster_list      TEXT[],
+    PRIMARY KEY (event_id, ingest_time)
+) PARTITION BY RANGE (ingest_time);
+
+-- Route history: WHERE rd = ... AND route_key = ...
+CREATE INDEX IF NOT EXISTS idx_evpn_events_rd_route_key
+    ON evpn_events (rd, route_key, ingest_time DESC);
+
+-- MAC mobility history
+CREATE INDEX IF NOT EXISTS idx_evpn_events_mac
+    ON evpn_events (mac, ingest_time DESC) WHERE mac IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_evpn_events_router_ingest_time
+    ON evpn_events (router_id, table_name, ingest_time DESC);
+
+-- ---------------------------------------------------------------------------
+-- 3. Sync status: allow AFI 25 (L2VPN) EOR tracking
+-- ---------------------------------------------------------------------------
+ALTER TABLE rib_sync_status DROP CONSTRAINT IF EXISTS rib_sync_status_afi_check;
+ALTER TABLE rib_sync_status ADD CONSTRAINT rib_sync_status_afi_check CHECK (afi IN (4, 6, 25));
+
+ALTER TABLE adj_rib_in_sync_status DROP CONSTRAINT IF EXISTS adj_rib_in_sync_status_afi_check;
+ALTER TABLE adj_rib_in_sync_status ADD CONSTRAINT adj_rib_in_sync_status_afi_check CHECK (afi IN (4, 6, 25));
+
+ALTER TABLE adj_rib_out_sync_status DROP CONSTRAINT IF EXISTS adj_rib_out_sync_status_afi_check;
+ALTER TABLE adj_rib_out_sync_status ADD CONSTRAINT adj_rib_out_sync_status_afi_check CHECK (afi IN (4, 6, 25));
@@ -0,0 +1,136 @@
+-- =============================================================================
+-- Migration 0018: BGP Flow Specification rules (SAFI 133/134, RFC 8955/8956)
+-- =============================================================================
+
+-- ---------------------------------------------------------------------------
+-- 1. New table: flowspec_rules
+-- ---------------------------------------------------------------------------
+-- FlowSpec rules of all RIBs, following the lifecycle of the RIB named in
+-- rib like vpn_routes and evpn_routes. rd is the Route Distinguisher of a
+-- SAFI 134 rule, or the Peer Distinguisher of an RD instance peer; '' for
+-- SAFI 133 rules of global peers.
+--
+-- rule is the canonical rule string, e.g.
+-- 'dst 192.0.2.0/24 proto =6 dport =80,=443 tcp-flags =syn'. The component
+-- columns hold each component's part of it; dst_prefix and src_prefix are
+-- NULL for IPv6 patterns with a non-zero offset. actions holds the traffic
+-- filtering action extended communities of the UPDATE.
+CREATE TABLE IF NOT EXISTS flowspec_rules (
+    router_id         TEXT        NOT NULL,
+    table_name        TEXT        NOT NULL,
+    rib               TEXT        NOT NULL CHECK (rib IN ('loc-rib', 'adj-rib-in', 'adj-rib-out')),
+    peer_address      INET        NOT NULL,
+    peer_rd           TEXT        NOT NULL DEFAULT '',
+    peer_asn          BIGINT      NOT NULL DEFAULT 0,
+    peer_bgp_id       TEXT        NOT NULL DEFAULT '',
+    is_post_policy    BOOLEAN     NOT NULL DEFAULT false,
+    afi               SMALLINT    NOT NULL CHECK (afi IN (4, 6)),
+    safi              SMALLINT    NOT NULL,
+    rd                TEXT        NOT NULL DEFAULT '',
+    rule              TEXT        NOT NULL,
+    path_id           BIGINT      NOT NULL DEFAULT 0,
+    dst_prefix        CIDR,
+    src_prefix        CIDR,
+    protocols         TEXT,
+    ports             TEXT,
+    dst_ports         TEXT,
+    src_ports         TEXT,
+    icmp_types        TEXT,
+    icmp_codes        TEXT,
+    tcp_flags         TEXT,
+    packet_lengths    TEXT,
+    dscp              TEXT,
+    fragment          TEXT,
+    flow_label        TEXT,
+    actions           TEXT[],
+    nexthop           INET,
+    as_path           TEXT,
+    origin            TEXT,
+    localpref         INTEGER,
+    med               INTEGER,
+    communities_std   TEXT[],
+    communities_ext   TEXT[],
+    communities_large TEXT[],
+    attrs             JSONB,
+    originator_id     INET,
+    cluster_list      TEXT[],
+    first_seen        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, afi, safi, rd, rule, path_id)
+);
+
+-- Rules matching traffic to or from an address: WHERE dst_prefix >>= ...
+CREATE INDEX IF NOT EXISTS idx_flowspec_rules_dst_prefix_gist
+    ON flowspec_rules USING GIST (dst_prefix inet_ops) WHERE dst_prefix IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_flowspec_rules_src_prefix_gist
+    ON flowspec_rules USING GIST (src_prefix inet_ops) WHERE src_prefix IS NOT NULL;
+
+-- Rules by action: WHERE actions @> ARRAY['RATE:65000:0']
+CREATE INDEX IF NOT EXISTS idx_flowspec_rules_actions_gin
+    ON flowspec_rules USING GIN (actions);
+
+-- Peer Down and session termination deletion
+CREATE INDEX IF NOT EXISTS idx_flowspec_rules_router_rib_peer
+    ON flowspec_rules (router_id, rib, peer_address, peer_rd);
+
+-- ---------------------------------------------------------------------------
+-- 2. New table: flowspec_events (partitioned by day, like route_events)
+-- ---------------------------------------------------------------------------
+-- Partitions are created and dropped by the partition manager. Indexes are
+-- defined here on the parent and inherited by every partition.
+CREATE TABLE IF NOT EXISTS flowspec_events (
+    event_id          BYTEA       NOT NULL,
+    ingest_time       TIMESTAMPTZ NOT NULL,
+    router_id         TEXT        NOT NULL,
+    table_name        TEXT        NOT NULL,
+    afi               SMALLINT    NOT NULL CHECK (afi IN (4, 6)),
+    safi              SMALLINT    NOT NULL,
+    rd                TEXT        NOT NULL DEFAULT '',
+    rule              TEXT        NOT NULL,
+    path_id           BIGINT,
+    action            CHAR(1)     NOT NULL CHECK (action IN ('A', 'D')),
+    dst_prefix        CIDR,
+    src_prefix        CIDR,
+    protocols         TEXT,
+    ports             TEXT,
+    dst_ports         TEXT,
+    src_ports         TEXT,
+    icmp_types        TEXT,
+    icmp_codes        TEXT,
+    tcp_flags         TEXT,
+    packet_lengths    TEXT,
+    dscp              TEXT,
+    fragment          TEXT,
+    flow_label        TEXT,
+    actions           TEXT[],
+    nexthop           INET,
+    as_path           TEXT,
+    origin            TEXT,
+    localpref         INTEGER,
+    med               INTEGER,
+    communities_std   TEXT[],
+    communities_ext   TEXT[],
+    communities_large TEXT[],
+    attrs             JSONB,
+    bmp_raw           BYTEA,
+    peer_address      INET,
+    peer_asn          BIGINT,
+    peer_bgp_id       TEXT,
+    is_post_policy    BOOLEAN,
+    is_adj_rib_out    BOOLEAN,
+    event_time        TIMESTAMPTZ,
+    originator_id     INET,
+    cluster_list      TEXT[],
+    PRIMARY KEY (event_id, ingest_time)
+) PARTITION BY RANGE (ingest_time);
+
+-- Rule history: WHERE rule = ...
+CREATE INDEX IF NOT EXISTS idx_flowspec_events_rule
+    ON flowspec_events (rule, ingest_time DESC);
+
+-- Mitigations affecting an address over time
+CREATE INDEX IF NOT EXISTS idx_flowspec_events_dst_prefix
+    ON flowspec_events (dst_prefix, ingest_time DESC) WHERE dst_prefix IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_flowspec_events_router_ingest_time
+    ON flowspec_events (router_id, table_name, ingest_time DESC);
@@ -0,0 +1,183 @@
+-- =============================================================================
+-- Migration 0019: BGP-LS topology (AFI 16388, SAFI 71, RFC 9552/9085)
+-- =============================================================================
+
+-- The three tables hold the node, link and prefix NLRI of all RIBs,
+-- following the lifecycle of the RIB named in rib like vpn_routes.
+-- nlri_key renders the NLRI's descriptors, e.g.
+-- '[N][2][0][65000:0::0000.0000.0001]' for an IS-IS L2 node; local_* are
+-- the descriptors of the (local) node. local_igp_router_id is an IS-IS
+-- system ID ('0000.0000.0001', with a '.NN' pseudonode suffix) or an OSPF
+-- router ID. protocol_id: 1 IS-IS L1, 2 IS-IS L2, 3 OSPFv2, 4 Direct,
+-- 5 Static, 6 OSPFv3. The remaining columns come from the BGP-LS
+-- Attribute (path attribute 29) of the UPDATE.
+
+-- ---------------------------------------------------------------------------
+-- 1. New table: ls_nodes
+-- ---------------------------------------------------------------------------
+-- srgb is a JSON array of {"start", "size"} label ranges.
+CREATE TABLE IF NOT EXISTS ls_nodes (
+    router_id           TEXT        NOT NULL,
+    table_name          TEXT        NOT NULL,
+    rib                 TEXT        NOT NULL CHECK (rib IN ('loc-rib', 'adj-rib-in', 'adj-rib-out')),
+    peer_address        INET        NOT NULL,
+    peer_rd             TEXT        NOT NULL DEFAULT '',
+    peer_asn            BIGINT      NOT NULL DEFAULT 0,
+    peer_bgp_id         TEXT        NOT NULL DEFAULT '',
+    is_post_policy      BOOLEAN     NOT NULL DEFAULT false,
+    nlri_key            TEXT        NOT NULL,
+    path_id             BIGINT      NOT NULL DEFAULT 0,
+    protocol_id         SMALLINT    NOT NULL,
+    identifier          BIGINT      NOT NULL DEFAULT 0,
+    local_asn           BIGINT      NOT NULL DEFAULT 0,
+    local_bgp_ls_id     BIGINT      NOT NULL DEFAULT 0,
+    local_area_id       TEXT,
+    local_igp_router_id TEXT        NOT NULL DEFAULT '',
+    node_name           TEXT,
+    router_ids          INET[],
+    srgb                JSONB,
+    sr_algorithms       SMALLINT[],
+    nexthop             INET,
+    as_path             TEXT,
+    origin              TEXT,
+    localpref           INTEGER,
+    med                 INTEGER,
+    communities_std     TEXT[],
+    communities_ext     TEXT[],
+    attrs               JSONB,
+    first_seen          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, nlri_key, path_id)
+);
+
+-- Node lookup by name or IGP router ID
+CREATE INDEX IF NOT EXISTS idx_ls_nodes_node_name
+    ON ls_nodes (node_name) WHERE node_name IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ls_nodes_igp_router_id
+    ON ls_nodes (local_igp_router_id);
+
+-- Peer Down and session termination deletion
+CREATE INDEX IF NOT EXISTS idx_ls_nodes_router_rib_peer
+    ON ls_nodes (router_id, rib, peer_address, peer_rd);
+
+-- ---------------------------------------------------------------------------
+-- 2. New table: ls_links
+-- ---------------------------------------------------------------------------
+-- A link is directed, from the local to the remote node. max_link_bw is in
+-- bytes per second. adj_sids is a JSON array of {"flags", "weight", "sid",
+-- "is_index"} Adjacency and LAN Adjacency SIDs.
+CREATE TABLE IF NOT EXISTS ls_links (
+    router_id            TEXT        NOT NULL,
+    table_name           TEXT        NOT NULL,
+    rib                  TEXT        NOT NULL CHECK (rib IN ('loc-rib', 'adj-rib-in', 'adj-rib-out')),
+    peer_address         INET        NOT NULL,
+    peer_rd              TEXT        NOT NULL DEFAULT '',
+    peer_asn             BIGINT      NOT NULL DEFAULT 0,
+    peer_bgp_id          TEXT        NOT NULL DEFAULT '',
+    is_post_policy       BOOLEAN     NOT NULL DEFAULT false,
+    nlri_key             TEXT        NOT NULL,
+    path_id              BIGINT      NOT NULL DEFAULT 0,
+    protocol_id          SMALLINT    NOT NULL,
+    identifier           BIGINT      NOT NULL DEFAULT 0,
+    local_asn            BIGINT      NOT NULL DEFAULT 0,
+    local_bgp_ls_id      BIGINT      NOT NULL DEFAULT 0,
+    local_area_id        TEXT,
+    local_igp_router_id  TEXT        NOT NULL DEFAULT '',
+    remote_asn           BIGINT      NOT NULL DEFAULT 0,
+    remote_bgp_ls_id     BIGINT      NOT NULL DEFAULT 0,
+    remote_area_id       TEXT,
+    remote_igp_router_id TEXT        NOT NULL DEFAULT '',
+    local_link_id        BIGINT      NOT NULL DEFAULT 0,
+    remote_link_id       BIGINT      NOT NULL DEFAULT 0,
+    interface_address    INET,
+    neighbor_address     INET,
+    mt_id                INTEGER     NOT NULL DEFAULT 0,
+    igp_metric           BIGINT,
+    te_metric            BIGINT,
+    max_link_bw          DOUBLE PRECISION,
+    link_name            TEXT,
+    adj_sids             JSONB,
+    local_router_ids     INET[],
+    remote_router_ids    INET[],
+    nexthop              INET,
+    as_path              TEXT,
+    origin               TEXT,
+    localpref            INTEGER,
+    med                  INTEGER,
+    communities_std      TEXT[],
+    communities_ext      TEXT[],
+    attrs                JSONB,
+    first_seen           TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, nlri_key, path_id)
+);
+
+-- Adjacencies of a node, in either direction
+CREATE INDEX IF NOT EXISTS idx_ls_links_local_node
+    ON ls_links (local_igp_router_id);
+CREATE INDEX IF NOT EXISTS idx_ls_links_remote_node
+    ON ls_links (remote_igp_router_id);
+
+-- Peer Down and session termination deletion
+CREATE INDEX IF NOT EXISTS idx_ls_links_router_rib_peer
+    ON ls_links (router_id, rib, peer_address, peer_rd);
+
+-- ---------------------------------------------------------------------------
+-- 3. New table: ls_prefixes
+-- ---------------------------------------------------------------------------
+-- IPv4 and IPv6 prefixes advertised by the local node. prefix_sids is a
+-- JSON array of {"flags", "algorithm", "sid", "is_index"} Prefix SIDs.
+CREATE TABLE IF NOT EXISTS ls_prefixes (
+    router_id           TEXT        NOT NULL,
+    table_name          TEXT        NOT NULL,
+    rib                 TEXT        NOT NULL CHECK (rib IN ('loc-rib', 'adj-rib-in', 'adj-rib-out')),
+    peer_address        INET        NOT NULL,
+    peer_rd             TEXT        NOT NULL DEFAULT '',
+    peer_asn            BIGINT      NOT NULL DEFAULT 0,
+    peer_bgp_id         TEXT        NOT NULL DEFAULT '',
+    is_post_policy      BOOLEAN     NOT NULL DEFAULT false,
+    nlri_key            TEXT        NOT NULL,
+    path_id             BIGINT      NOT NULL DEFAULT 0,
+    protocol_id         SMALLINT    NOT NULL,
+    identifier          BIGINT      NOT NULL DEFAULT 0,
+    local_asn           BIGINT      NOT NULL DEFAULT 0,
+    local_bgp_ls_id     BIGINT      NOT NULL DEFAULT 0,
+    local_area_id       TEXT,
+    local_igp_router_id TEXT        NOT NULL DEFAULT '',
+    prefix              CIDR        NOT NULL,
+    mt_id               INTEGER     NOT NULL DEFAULT 0,
+    ospf_route_type     SMALLINT    NOT NULL DEFAULT 0,
+    prefix_metric       BIGINT,
+    prefix_sids         JSONB,
+    nexthop             INET,
+    as_path             TEXT,
+    origin              TEXT,
+    localpref           INTEGER,
+    med                 INTEGER,
+    communities_std     TEXT[],
+    communities_ext     TEXT[],
+    attrs               JSONB,
+    first_seen          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, nlri_key, path_id)
+);
+
+-- Nodes advertising an address: WHERE prefix >>= ...
+CREATE INDEX IF NOT EXISTS idx_ls_prefixes_prefix_gist
+    ON ls_prefixes USING GIST (prefix inet_ops);
+
+-- Peer Down and session termination deletion
+CREATE INDEX IF NOT EXISTS idx_ls_prefixes_router_rib_peer
+    ON ls_prefixes (router_id, rib, peer_address, peer_rd);
+
+-- ---------------------------------------------------------------------------
+-- 4. Sync status: allow AFI 16388 (BGP-LS) EOR tracking
+-- ---------------------------------------------------------------------------
+ALTER TABLE rib_sync_status DROP CONSTRAINT IF EXISTS rib_sync_status_afi_check;
+ALTER TABLE rib_sync_status ADD CONSTRAINT rib_sync_status_afi_check CHECK (afi IN (4, 6, 25, 16388));
+
+ALTER TABLE adj_rib_in_sync_status DROP CONSTRAINT IF EXISTS adj_rib_in_sync_status_afi_check;
+ALTER TABLE adj_rib_in_sync_status ADD CONSTRAINT adj_rib_in_sync_status_afi_check CHECK (afi IN (4, 6, 25, 16388));
+
+ALTER TABLE adj_rib_out_sync_status DROP CONSTRAINT IF EXISTS adj_rib_out_sync_status_afi_check;
+ALTER TABLE adj_rib_out_sync_status ADD CONSTRAINT adj_rib_out_sync_status_afi_check CHECK (afi IN (4, 6, 25, 16388));
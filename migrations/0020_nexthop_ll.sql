@@ -0,0 +1,17 @@
+-- =============================================================================
+-- Migration 0020: IPv6 link-local next hops (RFC 2545, RFC 8950)
+-- =============================================================================
+
+-- nexthop_ll holds the link-local address of an IPv6 next hop: the second
+-- address of a global + link-local pair, or the only address when a peer
+-- sends a link-local next hop alone. nexthop keeps the global address, or
+-- the link-local one when the global address is missing or unspecified
+-- (unnumbered BGP). IPv4 routes may carry either with an IPv6 next hop
+-- (RFC 8950). NULL otherwise.
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS nexthop_ll INET;
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS nexthop_ll INET;
+ALTER TABLE adj_rib_out    ADD COLUMN IF NOT EXISTS nexthop_ll INET;
+ALTER TABLE vpn_routes     ADD COLUMN IF NOT EXISTS nexthop_ll INET;
+
+-- Added to the partitioned parent, and so to every partition.
+ALTER TABLE route_events   ADD COLUMN IF NOT EXISTS nexthop_ll INET;
@@ -0,0 +1,78 @@
+-- =============================================================================
+-- Migration 0021: Segment Routing — BGP Prefix-SID (RFC 8669, RFC 9252) and
+-- SR Policy (SAFI 73, RFC 9830)
+-- =============================================================================
+
+-- ---------------------------------------------------------------------------
+-- 1. Prefix-SID attribute (path attribute 40)
+-- ---------------------------------------------------------------------------
+-- prefix_sid holds the decoded attribute as JSON: label_index and srgb
+-- (SR-MPLS labeled unicast), or srv6_services (SRv6 L3/L2 VPN and EVPN
+-- services), each {"layer", "sid", "flags", "behavior", "structure"}. An
+-- SRv6 SID whose function or argument is transposed into the NLRI's label
+-- field is stored complete. NULL when the route carries no Prefix-SID.
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS prefix_sid JSONB;
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS prefix_sid JSONB;
+ALTER TABLE adj_rib_out    ADD COLUMN IF NOT EXISTS prefix_sid JSONB;
+ALTER TABLE vpn_routes     ADD COLUMN IF NOT EXISTS prefix_sid JSONB;
+ALTER TABLE evpn_routes    ADD COLUMN IF NOT EXISTS prefix_sid JSONB;
+
+-- Added to the partitioned parents, and so to every partition.
+ALTER TABLE route_events   ADD COLUMN IF NOT EXISTS prefix_sid JSONB;
+ALTER TABLE evpn_events    ADD COLUMN IF NOT EXISTS prefix_sid JSONB;
+
+-- ---------------------------------------------------------------------------
+-- 2. New table: sr_policies
+-- ---------------------------------------------------------------------------
+-- One row per SR Policy candidate path of all RIBs, following the
+-- lifecycle of the RIB named in rib like vpn_routes. The NLRI gives
+-- distinguisher, color and endpoint; the remaining policy columns come from
+-- the SR Policy tunnel of the Tunnel Encapsulation attribute (path
+-- attribute 23). binding_sid and the segments of segment_lists are MPLS
+-- labels ('16001') or SRv6 SIDs ('2001:db8::1'); segment_lists is a JSON
+-- array of {"weight", "segments"}. SR Policies are kept as state only.
+CREATE TABLE IF NOT EXISTS sr_policies (
+    router_id           TEXT        NOT NULL,
+    table_name          TEXT        NOT NULL,
+    rib                 TEXT        NOT NULL CHECK (rib IN ('loc-rib', 'adj-rib-in', 'adj-rib-out')),
+    peer_address        INET        NOT NULL,
+    peer_rd             TEXT        NOT NULL DEFAULT '',
+    peer_asn            BIGINT      NOT NULL DEFAULT 0,
+    peer_bgp_id         TEXT        NOT NULL DEFAULT '',
+    is_post_policy      BOOLEAN     NOT NULL DEFAULT false,
+    afi                 SMALLINT    NOT NULL CHECK (afi IN (4, 6)),
+    safi                SMALLINT    NOT NULL DEFAULT 73,
+    distinguisher       BIGINT      NOT NULL,
+    color               BIGINT      NOT NULL,
+    endpoint            INET        NOT NULL,
+    path_id             BIGINT      NOT NULL DEFAULT 0,
+    preference          BIGINT,
+    priority            SMALLINT,
+    binding_sid         TEXT,
+    candidate_path_name TEXT,
+    policy_name         TEXT,
+    segment_lists       JSONB,
+    nexthop             INET,
+    as_path             TEXT,
+    origin              TEXT,
+    localpref           INTEGER,
+    med                 INTEGER,
+    communities_std     TEXT[],
+    communities_ext     TEXT[],
+    communities_large   TEXT[],
+    attrs               JSONB,
+    originator_id       INET,
+    cluster_list        TEXT[],
+    first_seen          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (router_id, table_name, rib, peer_address, peer_rd, is_post_policy, afi, safi,
+                 distinguisher, color, endpoint, path_id)
+);
+
+-- Candidate paths steering traffic to an endpoint with a color
+CREATE INDEX IF NOT EXISTS idx_sr_policies_color_endpoint
+    ON sr_policies (color, endpoint);
+
+-- Peer Down and session termination deletion
+CREATE INDEX IF NOT EXISTS idx_sr_policies_router_rib_peer
+    ON sr_policies (router_id, rib, peer_address, peer_rd);
@@ -0,0 +1,27 @@
+-- =============================================================================
+-- Migration 0022: Revised error handling for BGP UPDATEs (RFC 7606)
+-- =============================================================================
+
+-- parse_warnings lists the errors found in the UPDATE that carried the route
+-- as a JSON array of {"action", "attr", "reason"}. action is
+-- 'attribute-discard' (the attribute was ignored), 'treat-as-withdraw' (the
+-- UPDATE's announcements were stored as withdrawals) or 'session-reset'
+-- (the routes decoded before the error were kept); attr is the path
+-- attribute type, absent for errors in the NLRI fields. NULL for a
+-- well-formed UPDATE.
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE adj_rib_out    ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE vpn_routes     ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE evpn_routes    ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE flowspec_rules ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE ls_nodes       ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE ls_links       ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE ls_prefixes    ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE sr_policies    ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+
+-- Added to the partitioned parents, and so to every partition. Withdrawals
+-- produced by 'treat-as-withdraw' are recorded with their warnings.
+ALTER TABLE route_events    ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE evpn_events     ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
+ALTER TABLE flowspec_events ADD COLUMN IF NOT EXISTS parse_warnings JSONB;
@@ -0,0 +1,41 @@
+-- =============================================================================
+-- Migration 0023: Structured AS paths
+-- =============================================================================
+
+-- as_path_asns holds the ASNs of as_path in order, nearest AS first, with
+-- the members of AS_SETs in place; confederation segments are not part of
+-- it. as_path_len is the path length used in route selection (an AS_SET
+-- counts as one) and as_path_has_set flags paths that contain an AS_SET,
+-- whose ASNs in as_path_asns are then not all a sequence. All three are
+-- NULL when as_path is.
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS as_path_asns    BIGINT[];
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS as_path_len     INTEGER;
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS as_path_has_set BOOLEAN;
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS as_path_asns    BIGINT[];
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS as_path_len     INTEGER;
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS as_path_has_set BOOLEAN;
+
+-- Added to the partitioned parent, and so to every partition.
+ALTER TABLE route_events   ADD COLUMN IF NOT EXISTS as_path_asns    BIGINT[];
+ALTER TABLE route_events   ADD COLUMN IF NOT EXISTS as_path_len     INTEGER;
+ALTER TABLE route_events   ADD COLUMN IF NOT EXISTS as_path_has_set BOOLEAN;
+
+-- "Which routes transit AS X": as_path_asns @> ARRAY[X]::bigint[].
+CREATE INDEX IF NOT EXISTS idx_current_routes_as_path_asns
+    ON current_routes USING GIN (as_path_asns);
+
+CREATE INDEX IF NOT EXISTS idx_adj_rib_in_as_path_asns
+    ON adj_rib_in USING GIN (as_path_asns);
+
+CREATE INDEX IF NOT EXISTS idx_route_events_as_path_asns
+    ON route_events USING GIN (as_path_asns);
+
+-- as_path_prepends counts the ASNs of a path that repeat the one before,
+-- i.e. the prepends: 0 for 64496 64497, 2 for 64496 64497 64497 64497.
+CREATE OR REPLACE FUNCTION as_path_prepends(asns BIGINT[]) RETURNS INTEGER
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE
+AS $$
+    SELECT count(*)::integer
+    FROM generate_subscripts(asns, 1) AS i
+    WHERE i > 1 AND asns[i] = asns[i - 1]
+$$;
@@ -0,0 +1,154 @@
+-- =============================================================================
+-- Migration 0024: Shared path attribute sets
+-- =============================================================================
+
+-- Most routes of a table share one of a few thousand attribute sets.
+-- path_attributes stores each distinct set once, keyed by attr_hash, the
+-- SHA-256 of the set's normalized attributes (see internal/attrset).
+-- Rows are immutable and never deleted: a set no route references any
+-- more is kept.
+CREATE TABLE IF NOT EXISTS path_attributes (
+    attr_hash          BYTEA       PRIMARY KEY,
+    origin             TEXT,
+    as_path            TEXT,
+    as_path_asns       BIGINT[],
+    as_path_len        INTEGER,
+    as_path_has_set    BOOLEAN,
+    origin_asn         INTEGER,
+    localpref          INTEGER,
+    med                INTEGER,
+    communities_std    TEXT[],
+    communities_ext    TEXT[],
+    communities_large  TEXT[],
+    attrs              JSONB,
+    originator_id      INET,
+    cluster_list       TEXT[],
+    atomic_aggregate   BOOLEAN     NOT NULL DEFAULT false,
+    aggregator_asn     BIGINT,
+    aggregator_address INET,
+    otc                BIGINT,
+    first_seen         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_path_attributes_as_path_asns
+    ON path_attributes USING GIN (as_path_asns);
+CREATE INDEX IF NOT EXISTS idx_path_attributes_origin_asn
+    ON path_attributes (origin_asn);
+CREATE INDEX IF NOT EXISTS idx_path_attributes_comm_std_gin
+    ON path_attributes USING GIN (communities_std);
+CREATE INDEX IF NOT EXISTS idx_path_attributes_comm_ext_gin
+    ON path_attributes USING GIN (communities_ext);
+CREATE INDEX IF NOT EXISTS idx_path_attributes_comm_large_gin
+    ON path_attributes USING GIN (communities_large);
+CREATE INDEX IF NOT EXISTS idx_path_attributes_originator_id
+    ON path_attributes (originator_id);
+CREATE INDEX IF NOT EXISTS idx_path_attributes_cluster_list_gin
+    ON path_attributes USING GIN (cluster_list);
+CREATE INDEX IF NOT EXISTS idx_path_attributes_aggregates
+    ON path_attributes (aggregator_asn)
+    WHERE atomic_aggregate OR aggregator_asn IS NOT NULL;
+
+-- Routes written from now on reference their set in attr_hash and leave
+-- the attribute columns NULL (atomic_aggregate false). This breaks queries
+-- reading those columns from the tables: they return NULL for new routes
+-- and must read the *_flat views below instead. Rows written before
+-- keep their attributes inline, with a NULL attr_hash, until the route is
+-- announced again. There is no foreign key: sets are inserted in their own
+-- transaction ahead of the routes and never deleted.
+ALTER TABLE current_routes ADD COLUMN IF NOT EXISTS attr_hash BYTEA;
+ALTER TABLE adj_rib_in     ADD COLUMN IF NOT EXISTS attr_hash BYTEA;
+
+-- Added to the partitioned parent, and so to every partition.
+ALTER TABLE route_events   ADD COLUMN IF NOT EXISTS attr_hash BYTEA;
+
+CREATE INDEX IF NOT EXISTS idx_current_routes_attr_hash
+    ON current_routes (attr_hash);
+CREATE INDEX IF NOT EXISTS idx_adj_rib_in_attr_hash
+    ON adj_rib_in (attr_hash);
+CREATE INDEX IF NOT EXISTS idx_route_events_attr_hash
+    ON route_events (attr_hash, ingest_time DESC);
+
+-- ---------------------------------------------------------------------------
+-- Flat views: the route tables with their attributes in place, as before
+-- this migration, whether a row references a set or not.
+-- ---------------------------------------------------------------------------
+CREATE OR REPLACE VIEW current_routes_flat AS
+SELECT r.router_id, r.table_name, r.afi, r.safi, r.prefix, r.path_id,
+       r.nexthop, r.nexthop_ll, r.labels,
+       COALESCE(a.as_path, r.as_path)                       AS as_path,
+       COALESCE(a.as_path_asns, r.as_path_asns)             AS as_path_asns,
+       COALESCE(a.as_path_len, r.as_path_len)               AS as_path_len,
+       COALESCE(a.as_path_has_set, r.as_path_has_set)       AS as_path_has_set,
+       COALESCE(a.origin, r.origin)                         AS origin,
+       COALESCE(a.localpref, r.localpref)                   AS localpref,
+       COALESCE(a.med, r.med)                               AS med,
+       COALESCE(a.origin_asn, r.origin_asn)                 AS origin_asn,
+       COALESCE(a.communities_std, r.communities_std)       AS communities_std,
+       COALESCE(a.communities_ext, r.communities_ext)       AS communities_ext,
+       COALESCE(a.communities_large, r.communities_large)   AS communities_large,
+       COALESCE(a.attrs, r.attrs)                           AS attrs,
+       COALESCE(a.originator_id, r.originator_id)           AS originator_id,
+       COALESCE(a.cluster_list, r.cluster_list)             AS cluster_list,
+       COALESCE(a.atomic_aggregate, r.atomic_aggregate)     AS atomic_aggregate,
+       COALESCE(a.aggregator_asn, r.aggregator_asn)         AS aggregator_asn,
+       COALESCE(a.aggregator_address, r.aggregator_address) AS aggregator_address,
+       COALESCE(a.otc, r.otc)                               AS otc,
+       r.prefix_sid, r.parse_warnings, r.attr_hash,
+       r.first_seen, r.updated_at
+FROM current_routes r
+LEFT JOIN path_attributes a ON a.attr_hash = r.attr_hash;
+
+CREATE OR REPLACE VIEW adj_rib_in_flat AS
+SELECT r.router_id, r.peer_address, r.peer_asn, r.peer_bgp_id, r.is_post_policy,
+       r.table_name, r.afi, r.safi, r.prefix, r.path_id,
+       r.nexthop, r.nexthop_ll, r.labels,
+       COALESCE(a.as_path, r.as_path)                       AS as_path,
+       COALESCE(a.as_path_asns, r.as_path_asns)             AS as_path_asns,
+       COALESCE(a.as_path_len, r.as_path_len)               AS as_path_len,
+       COALESCE(a.as_path_has_set, r.as_path_has_set)       AS as_path_has_set,
+       COALESCE(a.origin, r.origin)                         AS origin,
+       COALESCE(a.localpref, r.localpref)                   AS localpref,
+       COALESCE(a.med, r.med)                               AS med,
+       COALESCE(a.origin_asn, r.origin_asn)                 AS origin_asn,
+       COALESCE(a.communities_std, r.communities_std)       AS communities_std,
+       COALESCE(a.communities_ext, r.communities_ext)       AS communities_ext,
+       COALESCE(a.communities_large, r.communities_large)   AS communities_large,
+       COALESCE(a.attrs, r.attrs)                           AS attrs,
+       COALESCE(a.originator_id, r.originator_id)           AS originator_id,
+       COALESCE(a.cluster_list, r.cluster_list)             AS cluster_list,
+       COALESCE(a.atomic_aggregate, r.atomic_aggregate)     AS atomic_aggregate,
+       COALESCE(a.aggregator_asn, r.aggregator_asn)         AS aggregator_asn,
+       COALESCE(a.aggregator_address, r.aggregator_address) AS aggregator_address,
+       COALESCE(a.otc, r.otc)                               AS otc,
+       r.leak_suspected, r.prefix_sid, r.parse_warnings, r.attr_hash,
+       r.first_seen, r.updated_at
+FROM adj_rib_in r
+LEFT JOIN path_attributes a ON a.attr_hash = r.attr_hash;
+
+CREATE OR REPLACE VIEW route_events_flat AS
+SELECT r.event_id, r.ingest_time, r.event_time, r.router_id, r.table_name,
+       r.afi, r.safi, r.rd, r.prefix, r.path_id, r.action,
+       r.nexthop, r.nexthop_ll, r.labels,
+       COALESCE(a.as_path, r.as_path)                       AS as_path,
+       COALESCE(a.as_path_asns, r.as_path_asns)             AS as_path_asns,
+       COALESCE(a.as_path_len, r.as_path_len)               AS as_path_len,
+       COALESCE(a.as_path_has_set, r.as_path_has_set)       AS as_path_has_set,
+       COALESCE(a.origin, r.origin)                         AS origin,
+       COALESCE(a.localpref, r.localpref)                   AS localpref,
+       COALESCE(a.med, r.med)                               AS med,
+       COALESCE(a.origin_asn, r.origin_asn)                 AS origin_asn,
+       COALESCE(a.communities_std, r.communities_std)       AS communities_std,
+       COALESCE(a.communities_ext, r.communities_ext)       AS communities_ext,
+       COALESCE(a.communities_large, r.communities_large)   AS communities_large,
+       COALESCE(a.attrs, r.attrs)                           AS attrs,
+       COALESCE(a.originator_id, r.originator_id)           AS originator_id,
+       COALESCE(a.cluster_list, r.cluster_list)             AS cluster_list,
+       COALESCE(a.atomic_aggregate, r.atomic_aggregate)     AS atomic_aggregate,
+       COALESCE(a.aggregator_asn, r.aggregator_asn)         AS aggregator_asn,
+       COALESCE(a.aggregator_address, r.aggregator_address) AS aggregator_address,
+       COALESCE(a.otc, r.otc)                               AS otc,
+       r.leak_suspected, r.prefix_sid, r.parse_warnings, r.attr_hash,
+       r.peer_address, r.peer_asn, r.peer_bgp_id, r.is_post_policy, r.is_adj_rib_out,
+       r.bmp_raw
+FROM route_events r
+LEFT JOIN path_attributes a ON a.attr_hash = r.attr_hash;
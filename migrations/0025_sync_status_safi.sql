@@ -0,0 +1,26 @@
+-- =============================================================================
+-- Migration 0025: Sync status per address family
+-- =============================================================================
+
+-- An End-of-RIB marks one AFI/SAFI as synchronized, so sync status is kept
+-- per SAFI as well as per AFI. Existing rows were written for the family
+-- stored under their AFI: unicast, EVPN (AFI 25) or BGP-LS (AFI 16388).
+ALTER TABLE rib_sync_status         ADD COLUMN IF NOT EXISTS safi SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE adj_rib_in_sync_status  ADD COLUMN IF NOT EXISTS safi SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE adj_rib_out_sync_status ADD COLUMN IF NOT EXISTS safi SMALLINT NOT NULL DEFAULT 1;
+
+UPDATE rib_sync_status         SET safi = 70 WHERE afi = 25;
+UPDATE adj_rib_in_sync_status  SET safi = 70 WHERE afi = 25;
+UPDATE adj_rib_out_sync_status SET safi = 70 WHERE afi = 25;
+UPDATE rib_sync_status         SET safi = 71 WHERE afi = 16388;
+UPDATE adj_rib_in_sync_status  SET safi = 71 WHERE afi = 16388;
+UPDATE adj_rib_out_sync_status SET safi = 71 WHERE afi = 16388;
+
+ALTER TABLE rib_sync_status DROP CONSTRAINT IF EXISTS rib_sync_status_pkey;
+ALTER TABLE rib_sync_status ADD PRIMARY KEY (router_id, table_name, afi, safi);
+
+ALTER TABLE adj_rib_in_sync_status DROP CONSTRAINT IF EXISTS adj_rib_in_sync_status_pkey;
+ALTER TABLE adj_rib_in_sync_status ADD PRIMARY KEY (router_id, peer_address, afi, safi);
+
+ALTER TABLE adj_rib_out_sync_status DROP CONSTRAINT IF EXISTS adj_rib_out_sync_status_pkey;
+ALTER TABLE adj_rib_out_sync_status ADD PRIMARY KEY (router_id, peer_address, afi, safi);
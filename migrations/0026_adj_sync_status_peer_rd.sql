@@ -0,0 +1,16 @@
+-- =============================================================================
+-- Migration 0026: Adj-RIB sync status per RD instance peer
+-- =============================================================================
+
+-- An RD instance peer (BMP peer type 1) may share its address with a
+-- global peer and with other RD instance peers, and has sessions of its
+-- own. peer_rd is its Peer Distinguisher, as in vpn_routes, and empty for
+-- the global peer.
+ALTER TABLE adj_rib_in_sync_status  ADD COLUMN IF NOT EXISTS peer_rd TEXT NOT NULL DEFAULT '';
+ALTER TABLE adj_rib_out_sync_status ADD COLUMN IF NOT EXISTS peer_rd TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE adj_rib_in_sync_status DROP CONSTRAINT IF EXISTS adj_rib_in_sync_status_pkey;
+ALTER TABLE adj_rib_in_sync_status ADD PRIMARY KEY (router_id, peer_address, peer_rd, afi, safi);
+
+ALTER TABLE adj_rib_out_sync_status DROP CONSTRAINT IF EXISTS adj_rib_out_sync_status_pkey;
+ALTER TABLE adj_rib_out_sync_status ADD PRIMARY KEY (router_id, peer_address, peer_rd, afi, safi);
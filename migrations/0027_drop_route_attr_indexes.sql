@@ -0,0 +1,35 @@
+-- =============================================================================
+-- Migration 0027: Drop the route tables' attribute indexes
+-- =============================================================================
+
+-- Since migration 0024 the ingester leaves the attribute columns of
+-- current_routes, adj_rib_in and route_events NULL on the rows it writes
+-- (and clears them on update), and the *_flat views read them through
+-- COALESCE, which no index on the route tables can serve. Attribute
+-- filters use the indexes of path_attributes, joining the routes on
+-- attr_hash; the route tables' attribute indexes only cost writes.
+
+-- AS path (0023)
+DROP INDEX IF EXISTS idx_current_routes_as_path_asns;
+DROP INDEX IF EXISTS idx_adj_rib_in_as_path_asns;
+-- Dropping the partitioned index drops it on every partition.
+DROP INDEX IF EXISTS idx_route_events_as_path_asns;
+
+-- Origin AS and communities (0001, 0005)
+DROP INDEX IF EXISTS idx_current_routes_origin_asn;
+DROP INDEX IF EXISTS idx_current_routes_comm_std_gin;
+DROP INDEX IF EXISTS idx_current_routes_comm_ext_gin;
+DROP INDEX IF EXISTS idx_current_routes_comm_large_gin;
+DROP INDEX IF EXISTS idx_adj_rib_in_origin_asn;
+DROP INDEX IF EXISTS idx_adj_rib_in_comm_std_gin;
+DROP INDEX IF EXISTS idx_adj_rib_in_comm_ext_gin;
+DROP INDEX IF EXISTS idx_adj_rib_in_comm_large_gin;
+
+-- Route reflection and aggregation (0013)
+DROP INDEX IF EXISTS idx_current_routes_originator_id;
+DROP INDEX IF EXISTS idx_current_routes_cluster_list_gin;
+DROP INDEX IF EXISTS idx_current_routes_aggregates;
+DROP INDEX IF EXISTS idx_adj_rib_in_originator_id;
+DROP INDEX IF EXISTS idx_adj_rib_in_cluster_list_gin;
+DROP INDEX IF EXISTS idx_adj_rib_in_aggregates;
+DROP INDEX IF EXISTS idx_route_events_originator_id;
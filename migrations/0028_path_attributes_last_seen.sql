@@ -0,0 +1,10 @@
+-- =============================================================================
+-- Migration 0028: Sweep unreferenced path attribute sets
+-- =============================================================================
+
+-- last_seen is when a writer last inserted the set or found it already
+-- there. Writers trust a set they have seen for an hour without touching
+-- the row, so the maintenance sweep only deletes sets that no route or
+-- route event references and that no writer has seen for two hours
+-- (internal/attrset.SweepSQL).
+ALTER TABLE path_attributes ADD COLUMN IF NOT EXISTS last_seen TIMESTAMPTZ NOT NULL DEFAULT now();
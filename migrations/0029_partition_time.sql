@@ -0,0 +1,122 @@
+-- =============================================================================
+-- Migration 0029: Partition the event tables on partition_time
+-- =============================================================================
+
+-- route_events, evpn_events and flowspec_events were partitioned by day on
+-- ingest_time. They are now partitioned on partition_time, which the history
+-- writer sets from the time axis chosen by retention.time_axis: ingest_time
+-- (the default, and the value of every existing row) or the router's
+-- event_time, kept within the partitions retention has not dropped. Queries
+-- bound partition_time to prune partitions, whichever axis they filter on.
+--
+-- PostgreSQL cannot change the partition key of a table, so each parent is
+-- rebuilt: its partitions are detached, the parent is recreated with the
+-- same columns, constraints and indexes, and the partitions are attached
+-- again with their day bounds. Filling partition_time rewrites every row and
+-- attaching scans each partition; expect the migration to take a while on a
+-- full 30-day history. Privileges granted on the parents must be granted
+-- again afterwards.
+
+ALTER TABLE route_events ADD COLUMN IF NOT EXISTS partition_time TIMESTAMPTZ;
+UPDATE route_events SET partition_time = ingest_time WHERE partition_time IS NULL;
+ALTER TABLE route_events ALTER COLUMN partition_time SET NOT NULL;
+
+ALTER TABLE evpn_events ADD COLUMN IF NOT EXISTS partition_time TIMESTAMPTZ;
+UPDATE evpn_events SET partition_time = ingest_time WHERE partition_time IS NULL;
+ALTER TABLE evpn_events ALTER COLUMN partition_time SET NOT NULL;
+
+ALTER TABLE flowspec_events ADD COLUMN IF NOT EXISTS partition_time TIMESTAMPTZ;
+UPDATE flowspec_events SET partition_time = ingest_time WHERE partition_time IS NULL;
+ALTER TABLE flowspec_events ALTER COLUMN partition_time SET NOT NULL;
+
+-- Depends on route_events; recreated below.
+DROP VIEW IF EXISTS route_events_flat;
+
+CREATE FUNCTION pg_temp.repartition_by_partition_time(parent TEXT) RETURNS void
+LANGUAGE plpgsql AS $$
+DECLARE
+    parts      TEXT[];
+    bounds     TEXT[];
+    index_defs TEXT[];
+    pkey       TEXT;
+    i          INTEGER;
+BEGIN
+    SELECT array_agg(c.oid::regclass::text ORDER BY c.relname),
+           array_agg(pg_get_expr(c.relpartbound, c.oid) ORDER BY c.relname)
+      INTO parts, bounds
+      FROM pg_inherits h
+      JOIN pg_class c ON c.oid = h.inhrelid
+     WHERE h.inhparent = parent::regclass;
+
+    -- Indexes of the parent other than the primary key. They are created on
+    -- the new parent before any partition is attached, so ONLY is dropped.
+    SELECT array_agg(replace(pg_get_indexdef(x.indexrelid), ' ON ONLY ', ' ON '))
+      INTO index_defs
+      FROM pg_index x
+     WHERE x.indrelid = parent::regclass AND NOT x.indisprimary;
+
+    -- A detached partition keeps its indexes. The primary key on
+    -- (event_id, ingest_time) is dropped; the other indexes are matched to
+    -- the new parent's when the partition is attached again.
+    FOR i IN 1 .. coalesce(array_length(parts, 1), 0) LOOP
+        EXECUTE format('ALTER TABLE %I DETACH PARTITION %s', parent, parts[i]);
+        SELECT conname INTO pkey
+          FROM pg_constraint
+         WHERE conrelid = parts[i]::regclass AND contype = 'p';
+        IF pkey IS NOT NULL THEN
+            EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', parts[i], pkey);
+        END IF;
+    END LOOP;
+
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING STORAGE INCLUDING COMMENTS) PARTITION BY RANGE (partition_time)',
+        parent || '_repartitioned', parent);
+    EXECUTE format('DROP TABLE %I', parent);
+    EXECUTE format('ALTER TABLE %I RENAME TO %I', parent || '_repartitioned', parent);
+    EXECUTE format('ALTER TABLE %I ADD PRIMARY KEY (event_id, partition_time)', parent);
+
+    FOR i IN 1 .. coalesce(array_length(index_defs, 1), 0) LOOP
+        EXECUTE index_defs[i];
+    END LOOP;
+
+    -- Every existing row has partition_time = ingest_time, so the ingest_time
+    -- day bounds hold for partition_time.
+    FOR i IN 1 .. coalesce(array_length(parts, 1), 0) LOOP
+        EXECUTE format('ALTER TABLE %I ATTACH PARTITION %s %s', parent, parts[i], bounds[i]);
+    END LOOP;
+END
+$$;
+
+SELECT pg_temp.repartition_by_partition_time('route_events');
+SELECT pg_temp.repartition_by_partition_time('evpn_events');
+SELECT pg_temp.repartition_by_partition_time('flowspec_events');
+
+DROP FUNCTION pg_temp.repartition_by_partition_time(TEXT);
+
+-- Migration 0024's view with partition_time added.
+CREATE VIEW route_events_flat AS
+SELECT r.event_id, r.ingest_time, r.event_time, r.partition_time, r.router_id, r.table_name,
+       r.afi, r.safi, r.rd, r.prefix, r.path_id, r.action,
+       r.nexthop, r.nexthop_ll, r.labels,
+       COALESCE(a.as_path, r.as_path)                       AS as_path,
+       COALESCE(a.as_path_asns, r.as_path_asns)             AS as_path_asns,
+       COALESCE(a.as_path_len, r.as_path_len)               AS as_path_len,
+       COALESCE(a.as_path_has_set, r.as_path_has_set)       AS as_path_has_set,
+       COALESCE(a.origin, r.origin)                         AS origin,
+       COALESCE(a.localpref, r.localpref)                   AS localpref,
+       COALESCE(a.med, r.med)                               AS med,
+       COALESCE(a.origin_asn, r.origin_asn)                 AS origin_asn,
+       COALESCE(a.communities_std, r.communities_std)       AS communities_std,
+       COALESCE(a.communities_ext, r.communities_ext)       AS communities_ext,
+       COALESCE(a.communities_large, r.communities_large)   AS communities_large,
+       COALESCE(a.attrs, r.attrs)                           AS attrs,
+       COALESCE(a.originator_id, r.originator_id)           AS originator_id,
+       COALESCE(a.cluster_list, r.cluster_list)             AS cluster_list,
+       COALESCE(a.atomic_aggregate, r.atomic_aggregate)     AS atomic_aggregate,
+       COALESCE(a.aggregator_asn, r.aggregator_asn)         AS aggregator_asn,
+       COALESCE(a.aggregator_address, r.aggregator_address) AS aggregator_address,
+       COALESCE(a.otc, r.otc)                               AS otc,
+       r.leak_suspected, r.prefix_sid, r.parse_warnings, r.attr_hash,
+       r.peer_address, r.peer_asn, r.peer_bgp_id, r.is_post_policy, r.is_adj_rib_out,
+       r.bmp_raw
+FROM route_events r
+LEFT JOIN path_attributes a ON a.attr_hash = r.attr_hash;